@@ -0,0 +1,6 @@
+// Package facev1 is the generated code of the gRPC API served by
+// 'face serve --grpc', for clients in Go. Regenerate it after changing
+// face.proto with protoc, protoc-gen-go and protoc-gen-go-grpc installed.
+package facev1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative face.proto
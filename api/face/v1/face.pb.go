@@ -0,0 +1,1434 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        (unknown)
+// source: face.proto
+
+// The gRPC API of 'face serve --grpc'. It mirrors the REST API: the same
+// pipeline, database, API keys and redaction levels apply.
+
+package facev1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Image struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Filename is used in error messages only
+	Filename string `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Data is the encoded image, e.g. JPEG or PNG
+	Data          []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Image) Reset() {
+	*x = Image{}
+	mi := &file_face_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Image) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Image) ProtoMessage() {}
+
+func (x *Image) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Image.ProtoReflect.Descriptor instead.
+func (*Image) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Image) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *Image) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type EnrollUserRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Name       string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Email      string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	Phone      string                 `protobuf:"bytes,3,opt,name=phone,proto3" json:"phone,omitempty"`
+	CardNumber string                 `protobuf:"bytes,4,opt,name=card_number,json=cardNumber,proto3" json:"card_number,omitempty"`
+	Badge      string                 `protobuf:"bytes,5,opt,name=badge,proto3" json:"badge,omitempty"`
+	Metadata   *structpb.Struct       `protobuf:"bytes,6,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	// ExpiresIn makes the user a visitor who expires after the duration
+	ExpiresIn *durationpb.Duration `protobuf:"bytes,7,opt,name=expires_in,json=expiresIn,proto3" json:"expires_in,omitempty"`
+	Images    []*Image             `protobuf:"bytes,8,rep,name=images,proto3" json:"images,omitempty"`
+	// Force enrolls a name another user has when the duplicate name policy
+	// is warn
+	Force         bool `protobuf:"varint,9,opt,name=force,proto3" json:"force,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnrollUserRequest) Reset() {
+	*x = EnrollUserRequest{}
+	mi := &file_face_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnrollUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnrollUserRequest) ProtoMessage() {}
+
+func (x *EnrollUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnrollUserRequest.ProtoReflect.Descriptor instead.
+func (*EnrollUserRequest) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EnrollUserRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *EnrollUserRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *EnrollUserRequest) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *EnrollUserRequest) GetCardNumber() string {
+	if x != nil {
+		return x.CardNumber
+	}
+	return ""
+}
+
+func (x *EnrollUserRequest) GetBadge() string {
+	if x != nil {
+		return x.Badge
+	}
+	return ""
+}
+
+func (x *EnrollUserRequest) GetMetadata() *structpb.Struct {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *EnrollUserRequest) GetExpiresIn() *durationpb.Duration {
+	if x != nil {
+		return x.ExpiresIn
+	}
+	return nil
+}
+
+func (x *EnrollUserRequest) GetImages() []*Image {
+	if x != nil {
+		return x.Images
+	}
+	return nil
+}
+
+func (x *EnrollUserRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+type IdentifyRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Image *Image                 `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	// Threshold is the minimum confidence of a match, the server's default
+	// if unset
+	Threshold *float64 `protobuf:"fixed64,2,opt,name=threshold,proto3,oneof" json:"threshold,omitempty"`
+	// Id is echoed in the IdentifyStream result of the image
+	Id string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	// RequireLiveness rejects a face that scores as a spoof, as does the
+	// server's require_liveness setting
+	RequireLiveness bool `protobuf:"varint,4,opt,name=require_liveness,json=requireLiveness,proto3" json:"require_liveness,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *IdentifyRequest) Reset() {
+	*x = IdentifyRequest{}
+	mi := &file_face_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IdentifyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentifyRequest) ProtoMessage() {}
+
+func (x *IdentifyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentifyRequest.ProtoReflect.Descriptor instead.
+func (*IdentifyRequest) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *IdentifyRequest) GetImage() *Image {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *IdentifyRequest) GetThreshold() float64 {
+	if x != nil && x.Threshold != nil {
+		return *x.Threshold
+	}
+	return 0
+}
+
+func (x *IdentifyRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *IdentifyRequest) GetRequireLiveness() bool {
+	if x != nil {
+		return x.RequireLiveness
+	}
+	return false
+}
+
+type VerifyRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	UserId    string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Image     *Image                 `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	Threshold *float64               `protobuf:"fixed64,3,opt,name=threshold,proto3,oneof" json:"threshold,omitempty"`
+	// Code is the PIN or authenticator code, when step-up rules apply
+	Code            string `protobuf:"bytes,4,opt,name=code,proto3" json:"code,omitempty"`
+	RequireLiveness bool   `protobuf:"varint,5,opt,name=require_liveness,json=requireLiveness,proto3" json:"require_liveness,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *VerifyRequest) Reset() {
+	*x = VerifyRequest{}
+	mi := &file_face_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyRequest) ProtoMessage() {}
+
+func (x *VerifyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyRequest.ProtoReflect.Descriptor instead.
+func (*VerifyRequest) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VerifyRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *VerifyRequest) GetImage() *Image {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+func (x *VerifyRequest) GetThreshold() float64 {
+	if x != nil && x.Threshold != nil {
+		return *x.Threshold
+	}
+	return 0
+}
+
+func (x *VerifyRequest) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *VerifyRequest) GetRequireLiveness() bool {
+	if x != nil {
+		return x.RequireLiveness
+	}
+	return false
+}
+
+type ListUsersRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name lists only the users with this name
+	Name          string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUsersRequest) Reset() {
+	*x = ListUsersRequest{}
+	mi := &file_face_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUsersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUsersRequest) ProtoMessage() {}
+
+func (x *ListUsersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUsersRequest.ProtoReflect.Descriptor instead.
+func (*ListUsersRequest) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListUsersRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ListUsersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Users         []*User                `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListUsersResponse) Reset() {
+	*x = ListUsersResponse{}
+	mi := &file_face_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListUsersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListUsersResponse) ProtoMessage() {}
+
+func (x *ListUsersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListUsersResponse.ProtoReflect.Descriptor instead.
+func (*ListUsersResponse) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListUsersResponse) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+// User is an enrolled user, without face embeddings and second factor
+// secrets. Fields the redaction level of the API key hides are empty.
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Email         string                 `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
+	Phone         string                 `protobuf:"bytes,4,opt,name=phone,proto3" json:"phone,omitempty"`
+	Metadata      *structpb.Struct       `protobuf:"bytes,5,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	CardNumber    string                 `protobuf:"bytes,6,opt,name=card_number,json=cardNumber,proto3" json:"card_number,omitempty"`
+	Badge         string                 `protobuf:"bytes,7,opt,name=badge,proto3" json:"badge,omitempty"`
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Faces         []*Face                `protobuf:"bytes,9,rep,name=faces,proto3" json:"faces,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,10,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_face_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *User) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *User) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *User) GetMetadata() *structpb.Struct {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *User) GetCardNumber() string {
+	if x != nil {
+		return x.CardNumber
+	}
+	return ""
+}
+
+func (x *User) GetBadge() string {
+	if x != nil {
+		return x.Badge
+	}
+	return ""
+}
+
+func (x *User) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *User) GetFaces() []*Face {
+	if x != nil {
+		return x.Faces
+	}
+	return nil
+}
+
+func (x *User) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *User) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type Face struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	QualityScore  float64                `protobuf:"fixed64,2,opt,name=quality_score,json=qualityScore,proto3" json:"quality_score,omitempty"`
+	EnrolledAt    *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=enrolled_at,json=enrolledAt,proto3" json:"enrolled_at,omitempty"`
+	Label         string                 `protobuf:"bytes,4,opt,name=label,proto3" json:"label,omitempty"`
+	Primary       bool                   `protobuf:"varint,5,opt,name=primary,proto3" json:"primary,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Face) Reset() {
+	*x = Face{}
+	mi := &file_face_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Face) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Face) ProtoMessage() {}
+
+func (x *Face) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Face.ProtoReflect.Descriptor instead.
+func (*Face) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Face) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Face) GetQualityScore() float64 {
+	if x != nil {
+		return x.QualityScore
+	}
+	return 0
+}
+
+func (x *Face) GetEnrolledAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EnrolledAt
+	}
+	return nil
+}
+
+func (x *Face) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+func (x *Face) GetPrimary() bool {
+	if x != nil {
+		return x.Primary
+	}
+	return false
+}
+
+// Box is a face box in the coordinates of the image
+type Box struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	XMin          int32                  `protobuf:"varint,1,opt,name=x_min,json=xMin,proto3" json:"x_min,omitempty"`
+	YMin          int32                  `protobuf:"varint,2,opt,name=y_min,json=yMin,proto3" json:"y_min,omitempty"`
+	XMax          int32                  `protobuf:"varint,3,opt,name=x_max,json=xMax,proto3" json:"x_max,omitempty"`
+	YMax          int32                  `protobuf:"varint,4,opt,name=y_max,json=yMax,proto3" json:"y_max,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Box) Reset() {
+	*x = Box{}
+	mi := &file_face_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Box) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Box) ProtoMessage() {}
+
+func (x *Box) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Box.ProtoReflect.Descriptor instead.
+func (*Box) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Box) GetXMin() int32 {
+	if x != nil {
+		return x.XMin
+	}
+	return 0
+}
+
+func (x *Box) GetYMin() int32 {
+	if x != nil {
+		return x.YMin
+	}
+	return 0
+}
+
+func (x *Box) GetXMax() int32 {
+	if x != nil {
+		return x.XMax
+	}
+	return 0
+}
+
+func (x *Box) GetYMax() int32 {
+	if x != nil {
+		return x.YMax
+	}
+	return 0
+}
+
+// QualityHint is a problem with a face and what the person can do about it,
+// e.g. "face too small — move closer". Codes never change meaning.
+type QualityHint struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QualityHint) Reset() {
+	*x = QualityHint{}
+	mi := &file_face_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QualityHint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QualityHint) ProtoMessage() {}
+
+func (x *QualityHint) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QualityHint.ProtoReflect.Descriptor instead.
+func (*QualityHint) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *QualityHint) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *QualityHint) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type Candidate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Confidence    float64                `protobuf:"fixed64,3,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Candidate) Reset() {
+	*x = Candidate{}
+	mi := &file_face_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Candidate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Candidate) ProtoMessage() {}
+
+func (x *Candidate) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Candidate.ProtoReflect.Descriptor instead.
+func (*Candidate) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Candidate) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Candidate) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Candidate) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+type Identification struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Matched    bool                   `protobuf:"varint,1,opt,name=matched,proto3" json:"matched,omitempty"`
+	User       *User                  `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	FaceId     string                 `protobuf:"bytes,3,opt,name=face_id,json=faceId,proto3" json:"face_id,omitempty"`
+	Confidence float64                `protobuf:"fixed64,4,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	Threshold  float64                `protobuf:"fixed64,5,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	Quality    float64                `protobuf:"fixed64,6,opt,name=quality,proto3" json:"quality,omitempty"`
+	Box        *Box                   `protobuf:"bytes,7,opt,name=box,proto3" json:"box,omitempty"`
+	// Candidates are the best matches, best first
+	Candidates []*Candidate `protobuf:"bytes,8,rep,name=candidates,proto3" json:"candidates,omitempty"`
+	// Enriched is set when the image was added to the user's faces
+	Enriched bool           `protobuf:"varint,9,opt,name=enriched,proto3" json:"enriched,omitempty"`
+	Hints    []*QualityHint `protobuf:"bytes,10,rep,name=hints,proto3" json:"hints,omitempty"`
+	// SpoofScore is how likely the face is a printed photo or a screen, from
+	// 0 (live) to 1
+	SpoofScore    float64 `protobuf:"fixed64,11,opt,name=spoof_score,json=spoofScore,proto3" json:"spoof_score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Identification) Reset() {
+	*x = Identification{}
+	mi := &file_face_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Identification) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Identification) ProtoMessage() {}
+
+func (x *Identification) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Identification.ProtoReflect.Descriptor instead.
+func (*Identification) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Identification) GetMatched() bool {
+	if x != nil {
+		return x.Matched
+	}
+	return false
+}
+
+func (x *Identification) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+func (x *Identification) GetFaceId() string {
+	if x != nil {
+		return x.FaceId
+	}
+	return ""
+}
+
+func (x *Identification) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *Identification) GetThreshold() float64 {
+	if x != nil {
+		return x.Threshold
+	}
+	return 0
+}
+
+func (x *Identification) GetQuality() float64 {
+	if x != nil {
+		return x.Quality
+	}
+	return 0
+}
+
+func (x *Identification) GetBox() *Box {
+	if x != nil {
+		return x.Box
+	}
+	return nil
+}
+
+func (x *Identification) GetCandidates() []*Candidate {
+	if x != nil {
+		return x.Candidates
+	}
+	return nil
+}
+
+func (x *Identification) GetEnriched() bool {
+	if x != nil {
+		return x.Enriched
+	}
+	return false
+}
+
+func (x *Identification) GetHints() []*QualityHint {
+	if x != nil {
+		return x.Hints
+	}
+	return nil
+}
+
+func (x *Identification) GetSpoofScore() float64 {
+	if x != nil {
+		return x.SpoofScore
+	}
+	return 0
+}
+
+type Verification struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Verified   bool                   `protobuf:"varint,1,opt,name=verified,proto3" json:"verified,omitempty"`
+	UserId     string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Confidence float64                `protobuf:"fixed64,3,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	Threshold  float64                `protobuf:"fixed64,4,opt,name=threshold,proto3" json:"threshold,omitempty"`
+	Quality    float64                `protobuf:"fixed64,5,opt,name=quality,proto3" json:"quality,omitempty"`
+	// Reason says why the verification failed, e.g. "no_match" or
+	// "step_up_required", empty if it succeeded
+	Reason        string         `protobuf:"bytes,6,opt,name=reason,proto3" json:"reason,omitempty"`
+	Hints         []*QualityHint `protobuf:"bytes,7,rep,name=hints,proto3" json:"hints,omitempty"`
+	SpoofScore    float64        `protobuf:"fixed64,8,opt,name=spoof_score,json=spoofScore,proto3" json:"spoof_score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Verification) Reset() {
+	*x = Verification{}
+	mi := &file_face_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Verification) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Verification) ProtoMessage() {}
+
+func (x *Verification) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Verification.ProtoReflect.Descriptor instead.
+func (*Verification) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Verification) GetVerified() bool {
+	if x != nil {
+		return x.Verified
+	}
+	return false
+}
+
+func (x *Verification) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Verification) GetConfidence() float64 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *Verification) GetThreshold() float64 {
+	if x != nil {
+		return x.Threshold
+	}
+	return 0
+}
+
+func (x *Verification) GetQuality() float64 {
+	if x != nil {
+		return x.Quality
+	}
+	return 0
+}
+
+func (x *Verification) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Verification) GetHints() []*QualityHint {
+	if x != nil {
+		return x.Hints
+	}
+	return nil
+}
+
+func (x *Verification) GetSpoofScore() float64 {
+	if x != nil {
+		return x.SpoofScore
+	}
+	return 0
+}
+
+// Error is a failed image of IdentifyStream, as in the REST error envelope
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Retryable     bool                   `protobuf:"varint,3,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	Details       *structpb.Struct       `protobuf:"bytes,4,opt,name=details,proto3" json:"details,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_face_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *Error) GetDetails() *structpb.Struct {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+type IdentifyResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Id is the id of the request
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are valid to be assigned to Result:
+	//
+	//	*IdentifyResult_Identification
+	//	*IdentifyResult_Error
+	Result        isIdentifyResult_Result `protobuf_oneof:"result"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IdentifyResult) Reset() {
+	*x = IdentifyResult{}
+	mi := &file_face_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IdentifyResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IdentifyResult) ProtoMessage() {}
+
+func (x *IdentifyResult) ProtoReflect() protoreflect.Message {
+	mi := &file_face_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IdentifyResult.ProtoReflect.Descriptor instead.
+func (*IdentifyResult) Descriptor() ([]byte, []int) {
+	return file_face_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *IdentifyResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *IdentifyResult) GetResult() isIdentifyResult_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *IdentifyResult) GetIdentification() *Identification {
+	if x != nil {
+		if x, ok := x.Result.(*IdentifyResult_Identification); ok {
+			return x.Identification
+		}
+	}
+	return nil
+}
+
+func (x *IdentifyResult) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Result.(*IdentifyResult_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isIdentifyResult_Result interface {
+	isIdentifyResult_Result()
+}
+
+type IdentifyResult_Identification struct {
+	Identification *Identification `protobuf:"bytes,2,opt,name=identification,proto3,oneof"`
+}
+
+type IdentifyResult_Error struct {
+	Error *Error `protobuf:"bytes,3,opt,name=error,proto3,oneof"`
+}
+
+func (*IdentifyResult_Identification) isIdentifyResult_Result() {}
+
+func (*IdentifyResult_Error) isIdentifyResult_Result() {}
+
+var File_face_proto protoreflect.FileDescriptor
+
+const file_face_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"face.proto\x12\aface.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"7\n" +
+	"\x05Image\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"\xb7\x02\n" +
+	"\x11EnrollUserRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12\x14\n" +
+	"\x05phone\x18\x03 \x01(\tR\x05phone\x12\x1f\n" +
+	"\vcard_number\x18\x04 \x01(\tR\n" +
+	"cardNumber\x12\x14\n" +
+	"\x05badge\x18\x05 \x01(\tR\x05badge\x123\n" +
+	"\bmetadata\x18\x06 \x01(\v2\x17.google.protobuf.StructR\bmetadata\x128\n" +
+	"\n" +
+	"expires_in\x18\a \x01(\v2\x19.google.protobuf.DurationR\texpiresIn\x12&\n" +
+	"\x06images\x18\b \x03(\v2\x0e.face.v1.ImageR\x06images\x12\x14\n" +
+	"\x05force\x18\t \x01(\bR\x05force\"\xa3\x01\n" +
+	"\x0fIdentifyRequest\x12$\n" +
+	"\x05image\x18\x01 \x01(\v2\x0e.face.v1.ImageR\x05image\x12!\n" +
+	"\tthreshold\x18\x02 \x01(\x01H\x00R\tthreshold\x88\x01\x01\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\x12)\n" +
+	"\x10require_liveness\x18\x04 \x01(\bR\x0frequireLivenessB\f\n" +
+	"\n" +
+	"_threshold\"\xbe\x01\n" +
+	"\rVerifyRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12$\n" +
+	"\x05image\x18\x02 \x01(\v2\x0e.face.v1.ImageR\x05image\x12!\n" +
+	"\tthreshold\x18\x03 \x01(\x01H\x00R\tthreshold\x88\x01\x01\x12\x12\n" +
+	"\x04code\x18\x04 \x01(\tR\x04code\x12)\n" +
+	"\x10require_liveness\x18\x05 \x01(\bR\x0frequireLivenessB\f\n" +
+	"\n" +
+	"_threshold\"&\n" +
+	"\x10ListUsersRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"8\n" +
+	"\x11ListUsersResponse\x12#\n" +
+	"\x05users\x18\x01 \x03(\v2\r.face.v1.UserR\x05users\"\x98\x03\n" +
+	"\x04User\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05email\x18\x03 \x01(\tR\x05email\x12\x14\n" +
+	"\x05phone\x18\x04 \x01(\tR\x05phone\x123\n" +
+	"\bmetadata\x18\x05 \x01(\v2\x17.google.protobuf.StructR\bmetadata\x12\x1f\n" +
+	"\vcard_number\x18\x06 \x01(\tR\n" +
+	"cardNumber\x12\x14\n" +
+	"\x05badge\x18\a \x01(\tR\x05badge\x129\n" +
+	"\n" +
+	"expires_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x12#\n" +
+	"\x05faces\x18\t \x03(\v2\r.face.v1.FaceR\x05faces\x129\n" +
+	"\n" +
+	"created_at\x18\n" +
+	" \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\"\xa8\x01\n" +
+	"\x04Face\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12#\n" +
+	"\rquality_score\x18\x02 \x01(\x01R\fqualityScore\x12;\n" +
+	"\venrolled_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"enrolledAt\x12\x14\n" +
+	"\x05label\x18\x04 \x01(\tR\x05label\x12\x18\n" +
+	"\aprimary\x18\x05 \x01(\bR\aprimary\"Y\n" +
+	"\x03Box\x12\x13\n" +
+	"\x05x_min\x18\x01 \x01(\x05R\x04xMin\x12\x13\n" +
+	"\x05y_min\x18\x02 \x01(\x05R\x04yMin\x12\x13\n" +
+	"\x05x_max\x18\x03 \x01(\x05R\x04xMax\x12\x13\n" +
+	"\x05y_max\x18\x04 \x01(\x05R\x04yMax\";\n" +
+	"\vQualityHint\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"X\n" +
+	"\tCandidate\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x03 \x01(\x01R\n" +
+	"confidence\"\xfb\x02\n" +
+	"\x0eIdentification\x12\x18\n" +
+	"\amatched\x18\x01 \x01(\bR\amatched\x12!\n" +
+	"\x04user\x18\x02 \x01(\v2\r.face.v1.UserR\x04user\x12\x17\n" +
+	"\aface_id\x18\x03 \x01(\tR\x06faceId\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x04 \x01(\x01R\n" +
+	"confidence\x12\x1c\n" +
+	"\tthreshold\x18\x05 \x01(\x01R\tthreshold\x12\x18\n" +
+	"\aquality\x18\x06 \x01(\x01R\aquality\x12\x1e\n" +
+	"\x03box\x18\a \x01(\v2\f.face.v1.BoxR\x03box\x122\n" +
+	"\n" +
+	"candidates\x18\b \x03(\v2\x12.face.v1.CandidateR\n" +
+	"candidates\x12\x1a\n" +
+	"\benriched\x18\t \x01(\bR\benriched\x12*\n" +
+	"\x05hints\x18\n" +
+	" \x03(\v2\x14.face.v1.QualityHintR\x05hints\x12\x1f\n" +
+	"\vspoof_score\x18\v \x01(\x01R\n" +
+	"spoofScore\"\x80\x02\n" +
+	"\fVerification\x12\x1a\n" +
+	"\bverified\x18\x01 \x01(\bR\bverified\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\x03 \x01(\x01R\n" +
+	"confidence\x12\x1c\n" +
+	"\tthreshold\x18\x04 \x01(\x01R\tthreshold\x12\x18\n" +
+	"\aquality\x18\x05 \x01(\x01R\aquality\x12\x16\n" +
+	"\x06reason\x18\x06 \x01(\tR\x06reason\x12*\n" +
+	"\x05hints\x18\a \x03(\v2\x14.face.v1.QualityHintR\x05hints\x12\x1f\n" +
+	"\vspoof_score\x18\b \x01(\x01R\n" +
+	"spoofScore\"\x86\x01\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1c\n" +
+	"\tretryable\x18\x03 \x01(\bR\tretryable\x121\n" +
+	"\adetails\x18\x04 \x01(\v2\x17.google.protobuf.StructR\adetails\"\x95\x01\n" +
+	"\x0eIdentifyResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12A\n" +
+	"\x0eidentification\x18\x02 \x01(\v2\x17.face.v1.IdentificationH\x00R\x0eidentification\x12&\n" +
+	"\x05error\x18\x03 \x01(\v2\x0e.face.v1.ErrorH\x00R\x05errorB\b\n" +
+	"\x06result2\xcb\x02\n" +
+	"\vFaceService\x127\n" +
+	"\n" +
+	"EnrollUser\x12\x1a.face.v1.EnrollUserRequest\x1a\r.face.v1.User\x12=\n" +
+	"\bIdentify\x12\x18.face.v1.IdentifyRequest\x1a\x17.face.v1.Identification\x127\n" +
+	"\x06Verify\x12\x16.face.v1.VerifyRequest\x1a\x15.face.v1.Verification\x12B\n" +
+	"\tListUsers\x12\x19.face.v1.ListUsersRequest\x1a\x1a.face.v1.ListUsersResponse\x12G\n" +
+	"\x0eIdentifyStream\x12\x18.face.v1.IdentifyRequest\x1a\x17.face.v1.IdentifyResult(\x010\x01B\x19Z\x17face/api/face/v1;facev1b\x06proto3"
+
+var (
+	file_face_proto_rawDescOnce sync.Once
+	file_face_proto_rawDescData []byte
+)
+
+func file_face_proto_rawDescGZIP() []byte {
+	file_face_proto_rawDescOnce.Do(func() {
+		file_face_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_face_proto_rawDesc), len(file_face_proto_rawDesc)))
+	})
+	return file_face_proto_rawDescData
+}
+
+var file_face_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_face_proto_goTypes = []any{
+	(*Image)(nil),                 // 0: face.v1.Image
+	(*EnrollUserRequest)(nil),     // 1: face.v1.EnrollUserRequest
+	(*IdentifyRequest)(nil),       // 2: face.v1.IdentifyRequest
+	(*VerifyRequest)(nil),         // 3: face.v1.VerifyRequest
+	(*ListUsersRequest)(nil),      // 4: face.v1.ListUsersRequest
+	(*ListUsersResponse)(nil),     // 5: face.v1.ListUsersResponse
+	(*User)(nil),                  // 6: face.v1.User
+	(*Face)(nil),                  // 7: face.v1.Face
+	(*Box)(nil),                   // 8: face.v1.Box
+	(*QualityHint)(nil),           // 9: face.v1.QualityHint
+	(*Candidate)(nil),             // 10: face.v1.Candidate
+	(*Identification)(nil),        // 11: face.v1.Identification
+	(*Verification)(nil),          // 12: face.v1.Verification
+	(*Error)(nil),                 // 13: face.v1.Error
+	(*IdentifyResult)(nil),        // 14: face.v1.IdentifyResult
+	(*structpb.Struct)(nil),       // 15: google.protobuf.Struct
+	(*durationpb.Duration)(nil),   // 16: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil), // 17: google.protobuf.Timestamp
+}
+var file_face_proto_depIdxs = []int32{
+	15, // 0: face.v1.EnrollUserRequest.metadata:type_name -> google.protobuf.Struct
+	16, // 1: face.v1.EnrollUserRequest.expires_in:type_name -> google.protobuf.Duration
+	0,  // 2: face.v1.EnrollUserRequest.images:type_name -> face.v1.Image
+	0,  // 3: face.v1.IdentifyRequest.image:type_name -> face.v1.Image
+	0,  // 4: face.v1.VerifyRequest.image:type_name -> face.v1.Image
+	6,  // 5: face.v1.ListUsersResponse.users:type_name -> face.v1.User
+	15, // 6: face.v1.User.metadata:type_name -> google.protobuf.Struct
+	17, // 7: face.v1.User.expires_at:type_name -> google.protobuf.Timestamp
+	7,  // 8: face.v1.User.faces:type_name -> face.v1.Face
+	17, // 9: face.v1.User.created_at:type_name -> google.protobuf.Timestamp
+	17, // 10: face.v1.User.updated_at:type_name -> google.protobuf.Timestamp
+	17, // 11: face.v1.Face.enrolled_at:type_name -> google.protobuf.Timestamp
+	6,  // 12: face.v1.Identification.user:type_name -> face.v1.User
+	8,  // 13: face.v1.Identification.box:type_name -> face.v1.Box
+	10, // 14: face.v1.Identification.candidates:type_name -> face.v1.Candidate
+	9,  // 15: face.v1.Identification.hints:type_name -> face.v1.QualityHint
+	9,  // 16: face.v1.Verification.hints:type_name -> face.v1.QualityHint
+	15, // 17: face.v1.Error.details:type_name -> google.protobuf.Struct
+	11, // 18: face.v1.IdentifyResult.identification:type_name -> face.v1.Identification
+	13, // 19: face.v1.IdentifyResult.error:type_name -> face.v1.Error
+	1,  // 20: face.v1.FaceService.EnrollUser:input_type -> face.v1.EnrollUserRequest
+	2,  // 21: face.v1.FaceService.Identify:input_type -> face.v1.IdentifyRequest
+	3,  // 22: face.v1.FaceService.Verify:input_type -> face.v1.VerifyRequest
+	4,  // 23: face.v1.FaceService.ListUsers:input_type -> face.v1.ListUsersRequest
+	2,  // 24: face.v1.FaceService.IdentifyStream:input_type -> face.v1.IdentifyRequest
+	6,  // 25: face.v1.FaceService.EnrollUser:output_type -> face.v1.User
+	11, // 26: face.v1.FaceService.Identify:output_type -> face.v1.Identification
+	12, // 27: face.v1.FaceService.Verify:output_type -> face.v1.Verification
+	5,  // 28: face.v1.FaceService.ListUsers:output_type -> face.v1.ListUsersResponse
+	14, // 29: face.v1.FaceService.IdentifyStream:output_type -> face.v1.IdentifyResult
+	25, // [25:30] is the sub-list for method output_type
+	20, // [20:25] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
+}
+
+func init() { file_face_proto_init() }
+func file_face_proto_init() {
+	if File_face_proto != nil {
+		return
+	}
+	file_face_proto_msgTypes[2].OneofWrappers = []any{}
+	file_face_proto_msgTypes[3].OneofWrappers = []any{}
+	file_face_proto_msgTypes[14].OneofWrappers = []any{
+		(*IdentifyResult_Identification)(nil),
+		(*IdentifyResult_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_face_proto_rawDesc), len(file_face_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_face_proto_goTypes,
+		DependencyIndexes: file_face_proto_depIdxs,
+		MessageInfos:      file_face_proto_msgTypes,
+	}.Build()
+	File_face_proto = out.File
+	file_face_proto_goTypes = nil
+	file_face_proto_depIdxs = nil
+}
@@ -0,0 +1,305 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: face.proto
+
+// The gRPC API of 'face serve --grpc'. It mirrors the REST API: the same
+// pipeline, database, API keys and redaction levels apply.
+
+package facev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FaceService_EnrollUser_FullMethodName     = "/face.v1.FaceService/EnrollUser"
+	FaceService_Identify_FullMethodName       = "/face.v1.FaceService/Identify"
+	FaceService_Verify_FullMethodName         = "/face.v1.FaceService/Verify"
+	FaceService_ListUsers_FullMethodName      = "/face.v1.FaceService/ListUsers"
+	FaceService_IdentifyStream_FullMethodName = "/face.v1.FaceService/IdentifyStream"
+)
+
+// FaceServiceClient is the client API for FaceService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FaceService enrolls and identifies people. Calls must send the API key as
+// "authorization: Bearer <key>" or "x-api-key: <key>" metadata when the
+// server has one, and may send "x-request-id" to correlate logs.
+//
+// Failed calls return a status with the gRPC code of the error and a
+// google.rpc.ErrorInfo detail whose reason is the stable error code of the
+// REST API, e.g. "face_not_detected", with domain "face". Retryable errors
+// also carry a google.rpc.RetryInfo detail.
+type FaceServiceClient interface {
+	// EnrollUser enrolls a user from one or more images. Either every image
+	// is enrolled or the call fails and nothing is stored.
+	EnrollUser(ctx context.Context, in *EnrollUserRequest, opts ...grpc.CallOption) (*User, error)
+	// Identify finds the user whose face is in the image
+	Identify(ctx context.Context, in *IdentifyRequest, opts ...grpc.CallOption) (*Identification, error)
+	// Verify checks the face in the image against a user
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*Verification, error)
+	// ListUsers lists enrolled users
+	ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error)
+	// IdentifyStream identifies a stream of images in order, answering each
+	// with a result carrying its request ID. Failures of one image are
+	// reported in its result and do not end the stream.
+	IdentifyStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[IdentifyRequest, IdentifyResult], error)
+}
+
+type faceServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFaceServiceClient(cc grpc.ClientConnInterface) FaceServiceClient {
+	return &faceServiceClient{cc}
+}
+
+func (c *faceServiceClient) EnrollUser(ctx context.Context, in *EnrollUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, FaceService_EnrollUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faceServiceClient) Identify(ctx context.Context, in *IdentifyRequest, opts ...grpc.CallOption) (*Identification, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Identification)
+	err := c.cc.Invoke(ctx, FaceService_Identify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faceServiceClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*Verification, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Verification)
+	err := c.cc.Invoke(ctx, FaceService_Verify_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faceServiceClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListUsersResponse)
+	err := c.cc.Invoke(ctx, FaceService_ListUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *faceServiceClient) IdentifyStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[IdentifyRequest, IdentifyResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FaceService_ServiceDesc.Streams[0], FaceService_IdentifyStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IdentifyRequest, IdentifyResult]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FaceService_IdentifyStreamClient = grpc.BidiStreamingClient[IdentifyRequest, IdentifyResult]
+
+// FaceServiceServer is the server API for FaceService service.
+// All implementations must embed UnimplementedFaceServiceServer
+// for forward compatibility.
+//
+// FaceService enrolls and identifies people. Calls must send the API key as
+// "authorization: Bearer <key>" or "x-api-key: <key>" metadata when the
+// server has one, and may send "x-request-id" to correlate logs.
+//
+// Failed calls return a status with the gRPC code of the error and a
+// google.rpc.ErrorInfo detail whose reason is the stable error code of the
+// REST API, e.g. "face_not_detected", with domain "face". Retryable errors
+// also carry a google.rpc.RetryInfo detail.
+type FaceServiceServer interface {
+	// EnrollUser enrolls a user from one or more images. Either every image
+	// is enrolled or the call fails and nothing is stored.
+	EnrollUser(context.Context, *EnrollUserRequest) (*User, error)
+	// Identify finds the user whose face is in the image
+	Identify(context.Context, *IdentifyRequest) (*Identification, error)
+	// Verify checks the face in the image against a user
+	Verify(context.Context, *VerifyRequest) (*Verification, error)
+	// ListUsers lists enrolled users
+	ListUsers(context.Context, *ListUsersRequest) (*ListUsersResponse, error)
+	// IdentifyStream identifies a stream of images in order, answering each
+	// with a result carrying its request ID. Failures of one image are
+	// reported in its result and do not end the stream.
+	IdentifyStream(grpc.BidiStreamingServer[IdentifyRequest, IdentifyResult]) error
+	mustEmbedUnimplementedFaceServiceServer()
+}
+
+// UnimplementedFaceServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFaceServiceServer struct{}
+
+func (UnimplementedFaceServiceServer) EnrollUser(context.Context, *EnrollUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnrollUser not implemented")
+}
+func (UnimplementedFaceServiceServer) Identify(context.Context, *IdentifyRequest) (*Identification, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Identify not implemented")
+}
+func (UnimplementedFaceServiceServer) Verify(context.Context, *VerifyRequest) (*Verification, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedFaceServiceServer) ListUsers(context.Context, *ListUsersRequest) (*ListUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsers not implemented")
+}
+func (UnimplementedFaceServiceServer) IdentifyStream(grpc.BidiStreamingServer[IdentifyRequest, IdentifyResult]) error {
+	return status.Errorf(codes.Unimplemented, "method IdentifyStream not implemented")
+}
+func (UnimplementedFaceServiceServer) mustEmbedUnimplementedFaceServiceServer() {}
+func (UnimplementedFaceServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeFaceServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FaceServiceServer will
+// result in compilation errors.
+type UnsafeFaceServiceServer interface {
+	mustEmbedUnimplementedFaceServiceServer()
+}
+
+func RegisterFaceServiceServer(s grpc.ServiceRegistrar, srv FaceServiceServer) {
+	// If the following call pancis, it indicates UnimplementedFaceServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FaceService_ServiceDesc, srv)
+}
+
+func _FaceService_EnrollUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnrollUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaceServiceServer).EnrollUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FaceService_EnrollUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaceServiceServer).EnrollUser(ctx, req.(*EnrollUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaceService_Identify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IdentifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaceServiceServer).Identify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FaceService_Identify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaceServiceServer).Identify(ctx, req.(*IdentifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaceService_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaceServiceServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FaceService_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaceServiceServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaceService_ListUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FaceServiceServer).ListUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FaceService_ListUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FaceServiceServer).ListUsers(ctx, req.(*ListUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FaceService_IdentifyStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FaceServiceServer).IdentifyStream(&grpc.GenericServerStream[IdentifyRequest, IdentifyResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FaceService_IdentifyStreamServer = grpc.BidiStreamingServer[IdentifyRequest, IdentifyResult]
+
+// FaceService_ServiceDesc is the grpc.ServiceDesc for FaceService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FaceService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "face.v1.FaceService",
+	HandlerType: (*FaceServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "EnrollUser",
+			Handler:    _FaceService_EnrollUser_Handler,
+		},
+		{
+			MethodName: "Identify",
+			Handler:    _FaceService_Identify_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _FaceService_Verify_Handler,
+		},
+		{
+			MethodName: "ListUsers",
+			Handler:    _FaceService_ListUsers_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IdentifyStream",
+			Handler:       _FaceService_IdentifyStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "face.proto",
+}
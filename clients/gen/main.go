@@ -0,0 +1,261 @@
+// Command gen generates the types of the Python and TypeScript clients from
+// the schemas of the OpenAPI definition of the REST API:
+//
+//	go run ./clients/gen
+//
+// The clients themselves are small and written by hand; only their types
+// are generated, so they follow the API as it changes.
+package main
+
+//go:generate go run . -spec ../../api/openapi.yaml -python ../python/face_client/models.py -typescript ../typescript/src/models.ts
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// header marks the generated files
+const header = "Code generated by clients/gen from api/openapi.yaml. DO NOT EDIT."
+
+// schema is the subset of OpenAPI schemas the API uses
+type schema struct {
+	Ref                  string    `yaml:"$ref"`
+	Type                 string    `yaml:"type"`
+	Format               string    `yaml:"format"`
+	Description          string    `yaml:"description"`
+	Required             []string  `yaml:"required"`
+	Properties           yaml.Node `yaml:"properties"`
+	Items                *schema   `yaml:"items"`
+	AdditionalProperties any       `yaml:"additionalProperties"`
+}
+
+// property is a property of an object schema, in the order of the
+// definition
+type property struct {
+	name     string
+	required bool
+	schema   *schema
+}
+
+// namedSchema is a schema of the components, in the order of the
+// definition
+type namedSchema struct {
+	name   string
+	schema *schema
+	props  []property
+}
+
+func main() {
+	spec := flag.String("spec", "api/openapi.yaml", "OpenAPI definition")
+	python := flag.String("python", "clients/python/face_client/models.py", "Python file to write")
+	typescript := flag.String("typescript", "clients/typescript/src/models.ts", "TypeScript file to write")
+	flag.Parse()
+
+	if err := run(*spec, *python, *typescript); err != nil {
+		fmt.Fprintln(os.Stderr, "gen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, pythonPath, typescriptPath string) error {
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return err
+	}
+	schemas, err := loadSchemas(data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(pythonPath, pythonModels(schemas), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(typescriptPath, typescriptModels(schemas), 0o644)
+}
+
+// loadSchemas returns the component schemas of an OpenAPI definition
+func loadSchemas(data []byte) ([]namedSchema, error) {
+	var spec struct {
+		Components struct {
+			Schemas yaml.Node `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI definition: %w", err)
+	}
+	node := spec.Components.Schemas
+	if node.Kind != yaml.MappingNode {
+		return nil, errors.New("no component schemas")
+	}
+
+	var schemas []namedSchema
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		s := &schema{}
+		if err := node.Content[i+1].Decode(s); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", node.Content[i].Value, err)
+		}
+		props, err := properties(s)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", node.Content[i].Value, err)
+		}
+		schemas = append(schemas, namedSchema{name: node.Content[i].Value, schema: s, props: props})
+	}
+	return schemas, nil
+}
+
+func properties(s *schema) ([]property, error) {
+	required := make(map[string]bool)
+	for _, name := range s.Required {
+		required[name] = true
+	}
+
+	var props []property
+	for i := 0; i+1 < len(s.Properties.Content); i += 2 {
+		p := &schema{}
+		if err := s.Properties.Content[i+1].Decode(p); err != nil {
+			return nil, err
+		}
+		name := s.Properties.Content[i].Value
+		props = append(props, property{name: name, required: required[name], schema: p})
+	}
+	return props, nil
+}
+
+// refName returns the schema name of a $ref
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func pythonType(s *schema) string {
+	switch {
+	case s.Ref != "":
+		return refName(s.Ref)
+	case s.Type == "array":
+		return "List[" + pythonType(s.Items) + "]"
+	case s.Type == "object":
+		return "Dict[str, Any]"
+	case s.Type == "integer":
+		return "int"
+	case s.Type == "number":
+		return "float"
+	case s.Type == "boolean":
+		return "bool"
+	case s.Type == "string":
+		return "str"
+	default:
+		return "Any"
+	}
+}
+
+func typescriptType(s *schema) string {
+	switch {
+	case s.Ref != "":
+		return refName(s.Ref)
+	case s.Type == "array":
+		return typescriptType(s.Items) + "[]"
+	case s.Type == "object":
+		return "Record<string, unknown>"
+	case s.Type == "integer", s.Type == "number":
+		return "number"
+	case s.Type == "boolean":
+		return "boolean"
+	case s.Type == "string":
+		return "string"
+	default:
+		return "unknown"
+	}
+}
+
+// description returns the description of a property, noting the format of
+// times
+func description(s *schema) string {
+	desc := s.Description
+	if s.Format == "date-time" {
+		desc = strings.TrimSpace(desc + " RFC 3339 time")
+	}
+	return desc
+}
+
+// pythonModels returns the schemas as TypedDicts. Required keys are
+// declared in a base class, as TypedDicts mark all keys of a class
+// required or none.
+func pythonModels(schemas []namedSchema) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\"\"\"Types of the face REST API.\"\"\"\n\n", header)
+	b.WriteString("from __future__ import annotations\n\nfrom typing import Any, Dict, List, TypedDict\n")
+
+	for _, ns := range schemas {
+		var required, optional []property
+		for _, p := range ns.props {
+			if p.required {
+				required = append(required, p)
+			} else {
+				optional = append(optional, p)
+			}
+		}
+
+		bases := "TypedDict"
+		if len(required) > 0 && len(optional) > 0 {
+			fmt.Fprintf(&b, "\n\nclass _%sRequired(TypedDict):\n", ns.name)
+			writePythonFields(&b, required)
+			bases = "_" + ns.name + "Required, total=False"
+		} else if len(required) == 0 {
+			bases = "TypedDict, total=False"
+		}
+
+		fmt.Fprintf(&b, "\n\nclass %s(%s):\n", ns.name, bases)
+		if ns.schema.Description != "" {
+			fmt.Fprintf(&b, "    \"\"\"%s.\"\"\"\n\n", ns.schema.Description)
+		}
+		switch {
+		case len(optional) > 0:
+			writePythonFields(&b, optional)
+		case len(required) > 0:
+			writePythonFields(&b, required)
+		case ns.schema.Description == "":
+			b.WriteString("    pass\n")
+		}
+	}
+	return b.Bytes()
+}
+
+func writePythonFields(b *bytes.Buffer, props []property) {
+	for _, p := range props {
+		if desc := description(p.schema); desc != "" {
+			fmt.Fprintf(b, "    # %s\n", desc)
+		}
+		fmt.Fprintf(b, "    %s: %s\n", p.name, pythonType(p.schema))
+	}
+}
+
+// typescriptModels returns the schemas as interfaces
+func typescriptModels(schemas []namedSchema) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n", header)
+
+	for _, ns := range schemas {
+		b.WriteString("\n")
+		if ns.schema.Description != "" {
+			fmt.Fprintf(&b, "/** %s */\n", ns.schema.Description)
+		}
+		fmt.Fprintf(&b, "export interface %s {\n", ns.name)
+		for _, p := range ns.props {
+			if desc := description(p.schema); desc != "" {
+				fmt.Fprintf(&b, "  /** %s */\n", desc)
+			}
+			optional := "?"
+			if p.required {
+				optional = ""
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", p.name, optional, typescriptType(p.schema))
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes()
+}
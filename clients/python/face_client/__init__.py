@@ -0,0 +1,41 @@
+"""Client of the REST API of 'face serve'."""
+
+from .client import Client
+from .errors import FaceAPIError
+from .models import (
+    Box,
+    Candidate,
+    ConfidenceStats,
+    DualVerification,
+    Event,
+    Face,
+    GalleryCandidate,
+    Identification,
+    Match,
+    MatchCandidate,
+    QualityHint,
+    User,
+    Verification,
+    VerifyBatchReport,
+    VerifyBatchResult,
+)
+
+__all__ = [
+    "Box",
+    "Candidate",
+    "Client",
+    "ConfidenceStats",
+    "DualVerification",
+    "Event",
+    "Face",
+    "FaceAPIError",
+    "GalleryCandidate",
+    "Identification",
+    "Match",
+    "MatchCandidate",
+    "QualityHint",
+    "User",
+    "Verification",
+    "VerifyBatchReport",
+    "VerifyBatchResult",
+]
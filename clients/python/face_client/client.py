@@ -0,0 +1,362 @@
+"""Client of the REST API of 'face serve'."""
+
+from __future__ import annotations
+
+import csv
+import io
+import json
+import os
+import time
+import uuid
+from typing import IO, Any, Dict, Iterator, List, Optional, Sequence, Tuple, Union
+from urllib.error import HTTPError
+from urllib.parse import quote, urlencode
+from urllib.request import Request, urlopen
+
+from .errors import FaceAPIError
+from .models import (
+    DualVerification,
+    Event,
+    Face,
+    GalleryCandidate,
+    Identification,
+    Match,
+    User,
+    Verification,
+    VerifyBatchReport,
+)
+
+# Image is a path, the encoded image, or a binary file
+Image = Union[str, "os.PathLike[str]", bytes, IO[bytes]]
+
+# File is a multipart file: field name, filename and data
+_File = Tuple[str, str, bytes]
+
+
+class Client:
+    """Client of the REST API.
+
+    Retryable errors, e.g. "busy" when the server's workers are all taken,
+    are retried up to `retries` times after the delay the server asks for.
+    Requests that change data are retried only for "busy", which the server
+    answers before doing any work.
+    """
+
+    def __init__(
+        self,
+        base_url: str,
+        api_key: Optional[str] = None,
+        timeout: float = 30.0,
+        retries: int = 2,
+    ) -> None:
+        self.base_url = base_url.rstrip("/")
+        self.api_key = api_key
+        self.timeout = timeout
+        self.retries = retries
+
+    def enroll(
+        self,
+        name: str,
+        images: Sequence[Image],
+        email: Optional[str] = None,
+        phone: Optional[str] = None,
+        card_number: Optional[str] = None,
+        badge: Optional[str] = None,
+        metadata: Optional[Dict[str, Any]] = None,
+        expires_in: Optional[str] = None,
+        force: bool = False,
+        request_id: Optional[str] = None,
+    ) -> User:
+        """Enroll a user from one or more images, all or nothing.
+
+        force enrolls a name another user has when the server's duplicate name
+        policy is warn.
+        """
+        fields = {
+            "name": name,
+            "email": email,
+            "phone": phone,
+            "card_number": card_number,
+            "badge": badge,
+            "metadata": json.dumps(metadata) if metadata is not None else None,
+            "expires_in": expires_in,
+            "force": "true" if force else None,
+        }
+        files = [_file("image", img, i) for i, img in enumerate(images)]
+        return self._json("POST", "/enroll", fields=fields, files=files, idempotent=False, request_id=request_id)
+
+    def identify(
+        self,
+        image: Image,
+        threshold: Optional[float] = None,
+        request_id: Optional[str] = None,
+        require_liveness: bool = False,
+    ) -> Identification:
+        """Identify the face of an image.
+
+        require_liveness rejects a face that looks like a printed photo or a
+        screen with spoof_detected.
+        """
+        return self._json(
+            "POST",
+            "/identify",
+            fields={"threshold": _number(threshold), "require_liveness": "true" if require_liveness else None},
+            files=[_file("image", image)],
+            request_id=request_id,
+        )
+
+    def verify(
+        self,
+        user_id: str,
+        image: Image,
+        threshold: Optional[float] = None,
+        code: Optional[str] = None,
+        request_id: Optional[str] = None,
+        require_liveness: bool = False,
+    ) -> Verification:
+        """Verify an image against a user.
+
+        require_liveness rejects a face that looks like a printed photo or a
+        screen with spoof_detected.
+        """
+        return self._json(
+            "POST",
+            "/verify",
+            fields={
+                "user_id": user_id,
+                "threshold": _number(threshold),
+                "code": code,
+                "require_liveness": "true" if require_liveness else None,
+            },
+            files=[_file("image", image)],
+            request_id=request_id,
+        )
+
+    def verify_dual(
+        self,
+        user_a: str,
+        image_a: Image,
+        user_b: str,
+        image_b: Image,
+        threshold: Optional[float] = None,
+        request_id: Optional[str] = None,
+    ) -> DualVerification:
+        """Verify two users, one image each; succeeds only if both verify."""
+        return self._json(
+            "POST",
+            "/verify-dual",
+            fields={"user_a": user_a, "user_b": user_b, "threshold": _number(threshold)},
+            files=[_file("image_a", image_a), _file("image_b", image_b)],
+            request_id=request_id,
+        )
+
+    def verify_batch(
+        self,
+        pairs: Sequence[Tuple[str, Image]],
+        threshold: Optional[float] = None,
+        request_id: Optional[str] = None,
+    ) -> VerifyBatchReport:
+        """Verify (user ID, image) pairs concurrently, up to 1000. Pairs that
+        fail are reported in the results rather than raised."""
+        rows = io.StringIO()
+        writer = csv.writer(rows, lineterminator="\n")
+        files = []
+        for i, (user_id, image) in enumerate(pairs):
+            field = f"image{i + 1}"
+            writer.writerow([user_id, field])
+            files.append(_file(field, image, i))
+        return self._json(
+            "POST",
+            "/verify-batch",
+            fields={"pairs": rows.getvalue(), "threshold": _number(threshold)},
+            files=files,
+            request_id=request_id,
+        )
+
+    def match(
+        self,
+        image: Image,
+        gallery: Union[Sequence[GalleryCandidate], bytes],
+        threshold: Optional[float] = None,
+        request_id: Optional[str] = None,
+    ) -> Match:
+        """Match an image against a gallery of embeddings, without the
+        server reading or writing its database. The gallery is a list of
+        candidates or a gallery snapshot bundle."""
+        fields = {"threshold": _number(threshold)}
+        files = [_file("image", image)]
+        if isinstance(gallery, bytes):
+            files.append(("gallery", "gallery.fgal", gallery))
+        else:
+            fields["gallery"] = json.dumps(list(gallery))
+        return self._json("POST", "/match", fields=fields, files=files, request_id=request_id)
+
+    def list_users(self, name: Optional[str] = None) -> List[User]:
+        """List users, only those with the name if given."""
+        query = {"name": name} if name else None
+        return self._json("GET", "/users", query=query)["users"]
+
+    def get_user(self, user_id: str) -> User:
+        return self._json("GET", "/users/" + quote(user_id, safe=""))
+
+    def delete_user(self, user_id: str) -> None:
+        """Delete a user and their images; cannot be undone."""
+        self._request("DELETE", "/users/" + quote(user_id, safe=""))
+
+    def avatar(self, user_id: str) -> bytes:
+        """Return the user's avatar as JPEG."""
+        return self._request("GET", "/users/" + quote(user_id, safe="") + "/avatar")
+
+    def list_faces(self, user_id: str) -> List[Face]:
+        return self._json("GET", "/users/" + quote(user_id, safe="") + "/faces")["faces"]
+
+    def add_faces(self, user_id: str, images: Sequence[Image], request_id: Optional[str] = None) -> List[Face]:
+        """Add the faces of images to a user, all or nothing."""
+        files = [_file("image", img, i) for i, img in enumerate(images)]
+        path = "/users/" + quote(user_id, safe="") + "/faces"
+        return self._json("POST", path, files=files, idempotent=False, request_id=request_id)["faces"]
+
+    def delete_face(self, user_id: str, face_id: str) -> None:
+        self._request("DELETE", "/users/" + quote(user_id, safe="") + "/faces/" + quote(face_id, safe=""))
+
+    def gallery_snapshot(self) -> bytes:
+        """Return the gallery bundle of every user, see 'face gallery'."""
+        return self._request("GET", "/gallery/snapshot")
+
+    def gallery_delta(self, since: int) -> bytes:
+        """Return the gallery bundle of the users changed since a revision."""
+        return self._request("GET", "/gallery/delta", query={"since": str(since)})
+
+    def events(self) -> Iterator[Event]:
+        """Yield the events of the server as they happen, until the
+        connection is closed."""
+        req = Request(self.base_url + "/events", headers=self._headers(None))
+        req.add_header("Accept", "text/event-stream")
+        try:
+            resp = urlopen(req)
+        except HTTPError as e:
+            raise _api_error(e) from None
+
+        with resp:
+            data: List[str] = []
+            for raw in resp:
+                line = raw.decode("utf-8").rstrip("\r\n")
+                if line.startswith("data:"):
+                    data.append(line[5:].lstrip(" "))
+                elif line == "" and data:
+                    yield json.loads("\n".join(data))
+                    data = []
+
+    def _json(self, method: str, path: str, **kwargs: Any) -> Any:
+        return json.loads(self._request(method, path, **kwargs))
+
+    def _request(
+        self,
+        method: str,
+        path: str,
+        query: Optional[Dict[str, str]] = None,
+        fields: Optional[Dict[str, Optional[str]]] = None,
+        files: Optional[List[_File]] = None,
+        idempotent: bool = True,
+        request_id: Optional[str] = None,
+    ) -> bytes:
+        url = self.base_url + path
+        if query:
+            url += "?" + urlencode(query)
+        headers = self._headers(request_id)
+        body = None
+        if fields is not None or files is not None:
+            body, headers["Content-Type"] = _multipart(fields or {}, files or [])
+
+        attempt = 0
+        while True:
+            req = Request(url, data=body, headers=headers, method=method)
+            try:
+                with urlopen(req, timeout=self.timeout) as resp:
+                    return resp.read()
+            except HTTPError as e:
+                err = _api_error(e)
+                retry_after = e.headers.get("Retry-After")
+            if attempt >= self.retries or not err.retryable or not (idempotent or err.code == "busy"):
+                raise err
+            attempt += 1
+            time.sleep(_delay(retry_after, err.details, attempt))
+
+    def _headers(self, request_id: Optional[str]) -> Dict[str, str]:
+        headers = {"User-Agent": "face-client-python"}
+        if self.api_key:
+            headers["Authorization"] = "Bearer " + self.api_key
+        if request_id:
+            headers["X-Request-ID"] = request_id
+        return headers
+
+
+def _file(field: str, image: Image, index: int = 0) -> _File:
+    """Return the multipart file of an image."""
+    if isinstance(image, bytes):
+        return field, f"image{index + 1}.jpg", image
+    if isinstance(image, (str, os.PathLike)):
+        with open(image, "rb") as f:
+            return field, os.path.basename(os.fspath(image)), f.read()
+    name = getattr(image, "name", None)
+    filename = os.path.basename(name) if isinstance(name, str) else f"image{index + 1}.jpg"
+    return field, filename, image.read()
+
+
+def _number(value: Optional[float]) -> Optional[str]:
+    return None if value is None else repr(float(value))
+
+
+def _multipart(fields: Dict[str, Optional[str]], files: List[_File]) -> Tuple[bytes, str]:
+    """Encode a multipart/form-data body, leaving out fields that are None."""
+    boundary = uuid.uuid4().hex
+    parts: List[bytes] = []
+    for name, value in fields.items():
+        if value is None:
+            continue
+        parts.append(
+            f'--{boundary}\r\nContent-Disposition: form-data; name="{name}"\r\n\r\n'.encode()
+            + value.encode()
+            + b"\r\n"
+        )
+    for name, filename, data in files:
+        filename = filename.replace('"', "")
+        parts.append(
+            f'--{boundary}\r\nContent-Disposition: form-data; name="{name}"; filename="{filename}"\r\n'
+            "Content-Type: application/octet-stream\r\n\r\n".encode()
+            + data
+            + b"\r\n"
+        )
+    parts.append(f"--{boundary}--\r\n".encode())
+    return b"".join(parts), "multipart/form-data; boundary=" + boundary
+
+
+def _api_error(e: HTTPError) -> FaceAPIError:
+    """Return the error of an error envelope, or a generic one for
+    responses without one, e.g. of a proxy."""
+    body = e.read()
+    try:
+        env = json.loads(body)["error"]
+        return FaceAPIError(
+            e.code,
+            env["code"],
+            env["message"],
+            env.get("retryable", False),
+            env.get("details"),
+            env.get("request_id", ""),
+        )
+    except (ValueError, KeyError, TypeError):
+        message = body.decode("utf-8", "replace").strip() or e.reason
+        return FaceAPIError(e.code, "http_" + str(e.code), str(message), e.code in (502, 503, 504))
+
+
+def _delay(retry_after: Optional[str], details: Dict[str, Any], attempt: int) -> float:
+    """Return the seconds to wait before a retry: what the server asks for,
+    else an exponential backoff."""
+    for value in (retry_after, details.get("retry_after_seconds")):
+        try:
+            if value is not None:
+                return float(value)
+        except (TypeError, ValueError):
+            pass
+    return 0.5 * 2 ** (attempt - 1)
@@ -0,0 +1,30 @@
+"""Errors of the face REST API."""
+
+from __future__ import annotations
+
+from typing import Any, Dict, Optional
+
+
+class FaceAPIError(Exception):
+    """A request the server answered with an error envelope.
+
+    code is the stable error code, e.g. "face_not_detected"; branch on it
+    rather than on the message or the HTTP status.
+    """
+
+    def __init__(
+        self,
+        status: int,
+        code: str,
+        message: str,
+        retryable: bool = False,
+        details: Optional[Dict[str, Any]] = None,
+        request_id: str = "",
+    ) -> None:
+        super().__init__(f"{code}: {message}")
+        self.status = status
+        self.code = code
+        self.message = message
+        self.retryable = retryable
+        self.details = details or {}
+        self.request_id = request_id
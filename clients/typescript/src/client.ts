@@ -0,0 +1,397 @@
+// Client of the REST API of 'face serve'.
+
+import type {
+  DualVerification,
+  Error as ErrorBody,
+  Event,
+  Face,
+  FaceList,
+  GalleryCandidate,
+  Identification,
+  Match,
+  User,
+  UserList,
+  Verification,
+  VerifyBatchReport,
+} from "./models.js";
+
+/** Image is an encoded image, e.g. a JPEG file read into memory. */
+export type Image = Blob | ArrayBuffer | Uint8Array;
+
+export interface ClientOptions {
+  /** apiKey is sent as a bearer token, when the server has one */
+  apiKey?: string;
+  /** timeoutMs bounds each request, events excepted; default 30s */
+  timeoutMs?: number;
+  /** retries is how often retryable errors are retried; default 2 */
+  retries?: number;
+}
+
+export interface EnrollOptions {
+  email?: string;
+  phone?: string;
+  cardNumber?: string;
+  badge?: string;
+  metadata?: Record<string, unknown>;
+  /** expiresIn makes the user a visitor expiring after the duration, e.g. "8h" */
+  expiresIn?: string;
+  /** force enrolls a name another user has when the duplicate name policy is warn */
+  force?: boolean;
+}
+
+interface RequestOptions {
+  query?: Record<string, string>;
+  form?: FormData;
+  /** idempotent requests are retried for every retryable error, others only for "busy" */
+  idempotent?: boolean;
+  requestId?: string;
+}
+
+/**
+ * FaceAPIError is a request the server answered with an error envelope.
+ * Branch on code, e.g. "face_not_detected", rather than on the message or
+ * the HTTP status.
+ */
+export class FaceAPIError extends Error {
+  constructor(
+    readonly status: number,
+    readonly code: string,
+    message: string,
+    readonly retryable: boolean = false,
+    readonly details: Record<string, unknown> = {},
+    readonly requestId: string = "",
+  ) {
+    super(`${code}: ${message}`);
+    this.name = "FaceAPIError";
+  }
+}
+
+/**
+ * Client of the REST API.
+ *
+ * Retryable errors, e.g. "busy" when the server's workers are all taken,
+ * are retried after the delay the server asks for. Requests that change
+ * data are retried only for "busy", which the server answers before doing
+ * any work.
+ */
+export class Client {
+  private readonly baseUrl: string;
+  private readonly apiKey?: string;
+  private readonly timeoutMs: number;
+  private readonly retries: number;
+
+  constructor(baseUrl: string, options: ClientOptions = {}) {
+    this.baseUrl = baseUrl.replace(/\/+$/, "");
+    this.apiKey = options.apiKey;
+    this.timeoutMs = options.timeoutMs ?? 30_000;
+    this.retries = options.retries ?? 2;
+  }
+
+  /** Enroll a user from one or more images, all or nothing. */
+  async enroll(name: string, images: Image[], options: EnrollOptions = {}, requestId?: string): Promise<User> {
+    const form = new FormData();
+    form.set("name", name);
+    setField(form, "email", options.email);
+    setField(form, "phone", options.phone);
+    setField(form, "card_number", options.cardNumber);
+    setField(form, "badge", options.badge);
+    if (options.metadata !== undefined) {
+      form.set("metadata", JSON.stringify(options.metadata));
+    }
+    setField(form, "expires_in", options.expiresIn);
+    if (options.force) {
+      form.set("force", "true");
+    }
+    images.forEach((img, i) => appendImage(form, "image", img, i));
+    return this.json<User>("POST", "/enroll", { form, idempotent: false, requestId });
+  }
+
+  /** Identify the face of an image; requireLiveness rejects printed photos and screens with "spoof_detected". */
+  async identify(image: Image, threshold?: number, requestId?: string, requireLiveness?: boolean): Promise<Identification> {
+    const form = new FormData();
+    appendImage(form, "image", image);
+    setField(form, "threshold", threshold);
+    if (requireLiveness) {
+      form.set("require_liveness", "true");
+    }
+    return this.json<Identification>("POST", "/identify", { form, requestId });
+  }
+
+  /**
+   * Verify an image against a user; code is the PIN or authenticator code
+   * when step-up rules apply, requireLiveness rejects printed photos and
+   * screens with "spoof_detected".
+   */
+  async verify(
+    userId: string,
+    image: Image,
+    threshold?: number,
+    code?: string,
+    requestId?: string,
+    requireLiveness?: boolean,
+  ): Promise<Verification> {
+    const form = new FormData();
+    form.set("user_id", userId);
+    appendImage(form, "image", image);
+    setField(form, "threshold", threshold);
+    setField(form, "code", code);
+    if (requireLiveness) {
+      form.set("require_liveness", "true");
+    }
+    return this.json<Verification>("POST", "/verify", { form, requestId });
+  }
+
+  /** Verify two users, one image each; succeeds only if both verify. */
+  async verifyDual(
+    userA: string,
+    imageA: Image,
+    userB: string,
+    imageB: Image,
+    threshold?: number,
+    requestId?: string,
+  ): Promise<DualVerification> {
+    const form = new FormData();
+    form.set("user_a", userA);
+    form.set("user_b", userB);
+    appendImage(form, "image_a", imageA);
+    appendImage(form, "image_b", imageB);
+    setField(form, "threshold", threshold);
+    return this.json<DualVerification>("POST", "/verify-dual", { form, requestId });
+  }
+
+  /**
+   * Verify [user ID, image] pairs concurrently, up to 1000. Pairs that fail
+   * are reported in the results rather than thrown.
+   */
+  async verifyBatch(
+    pairs: [userId: string, image: Image][],
+    threshold?: number,
+    requestId?: string,
+  ): Promise<VerifyBatchReport> {
+    const form = new FormData();
+    const rows = pairs.map(([userId, image], i) => {
+      const field = `image${i + 1}`;
+      appendImage(form, field, image, i);
+      return `${userId},${field}\n`;
+    });
+    form.set("pairs", rows.join(""));
+    setField(form, "threshold", threshold);
+    return this.json<VerifyBatchReport>("POST", "/verify-batch", { form, requestId });
+  }
+
+  /**
+   * Match an image against a gallery of embeddings, without the server
+   * reading or writing its database. The gallery is a list of candidates or
+   * a gallery snapshot bundle.
+   */
+  async match(
+    image: Image,
+    gallery: GalleryCandidate[] | Image,
+    threshold?: number,
+    requestId?: string,
+  ): Promise<Match> {
+    const form = new FormData();
+    appendImage(form, "image", image);
+    if (Array.isArray(gallery)) {
+      form.set("gallery", JSON.stringify(gallery));
+    } else {
+      form.append("gallery", toBlob(gallery), "gallery.fgal");
+    }
+    setField(form, "threshold", threshold);
+    return this.json<Match>("POST", "/match", { form, requestId });
+  }
+
+  /** List users, only those with the name if given. */
+  async listUsers(name?: string): Promise<User[]> {
+    const query = name ? { name } : undefined;
+    return (await this.json<UserList>("GET", "/users", { query })).users;
+  }
+
+  async getUser(userId: string): Promise<User> {
+    return this.json<User>("GET", userPath(userId));
+  }
+
+  /** Delete a user and their images; cannot be undone. */
+  async deleteUser(userId: string): Promise<void> {
+    await this.request("DELETE", userPath(userId));
+  }
+
+  /** The user's avatar as JPEG. */
+  async avatar(userId: string): Promise<Uint8Array> {
+    return this.bytes("GET", userPath(userId) + "/avatar");
+  }
+
+  async listFaces(userId: string): Promise<Face[]> {
+    return (await this.json<FaceList>("GET", userPath(userId) + "/faces")).faces;
+  }
+
+  /** Add the faces of images to a user, all or nothing. */
+  async addFaces(userId: string, images: Image[], requestId?: string): Promise<Face[]> {
+    const form = new FormData();
+    images.forEach((img, i) => appendImage(form, "image", img, i));
+    const path = userPath(userId) + "/faces";
+    return (await this.json<FaceList>("POST", path, { form, idempotent: false, requestId })).faces;
+  }
+
+  async deleteFace(userId: string, faceId: string): Promise<void> {
+    await this.request("DELETE", userPath(userId) + "/faces/" + encodeURIComponent(faceId));
+  }
+
+  /** The gallery bundle of every user, see 'face gallery'. */
+  async gallerySnapshot(): Promise<Uint8Array> {
+    return this.bytes("GET", "/gallery/snapshot");
+  }
+
+  /** The gallery bundle of the users changed since a revision. */
+  async galleryDelta(since: number): Promise<Uint8Array> {
+    return this.bytes("GET", "/gallery/delta", { query: { since: String(since) } });
+  }
+
+  /** Yield the events of the server as they happen, until signal is aborted or the connection closes. */
+  async *events(signal?: AbortSignal): AsyncGenerator<Event> {
+    const resp = await fetch(this.baseUrl + "/events", {
+      headers: { ...this.headers(), Accept: "text/event-stream" },
+      signal,
+    });
+    if (!resp.ok) {
+      throw await apiError(resp);
+    }
+    const body = resp.body;
+    if (!body) {
+      return;
+    }
+
+    const reader = body.getReader();
+    const decoder = new TextDecoder();
+    let buffered = "";
+    let data: string[] = [];
+    try {
+      for (;;) {
+        const { done, value } = await reader.read();
+        if (done) {
+          return;
+        }
+        buffered += decoder.decode(value, { stream: true });
+        let newline: number;
+        while ((newline = buffered.indexOf("\n")) >= 0) {
+          const line = buffered.slice(0, newline).replace(/\r$/, "");
+          buffered = buffered.slice(newline + 1);
+          if (line.startsWith("data:")) {
+            data.push(line.slice(5).replace(/^ /, ""));
+          } else if (line === "" && data.length > 0) {
+            const event = JSON.parse(data.join("\n")) as Event;
+            data = [];
+            yield event;
+          }
+        }
+      }
+    } finally {
+      reader.releaseLock();
+      await body.cancel().catch(() => undefined);
+    }
+  }
+
+  private async json<T>(method: string, path: string, options: RequestOptions = {}): Promise<T> {
+    return (await (await this.request(method, path, options)).json()) as T;
+  }
+
+  private async bytes(method: string, path: string, options: RequestOptions = {}): Promise<Uint8Array> {
+    return new Uint8Array(await (await this.request(method, path, options)).arrayBuffer());
+  }
+
+  private async request(method: string, path: string, options: RequestOptions = {}): Promise<Response> {
+    let url = this.baseUrl + path;
+    if (options.query) {
+      url += "?" + new URLSearchParams(options.query).toString();
+    }
+    const idempotent = options.idempotent ?? true;
+
+    for (let attempt = 0; ; attempt++) {
+      const resp = await fetch(url, {
+        method,
+        headers: this.headers(options.requestId),
+        body: options.form,
+        signal: AbortSignal.timeout(this.timeoutMs),
+      });
+      if (resp.ok) {
+        return resp;
+      }
+
+      const err = await apiError(resp);
+      if (attempt >= this.retries || !err.retryable || !(idempotent || err.code === "busy")) {
+        throw err;
+      }
+      await sleep(retryDelay(resp.headers.get("Retry-After"), err.details, attempt + 1));
+    }
+  }
+
+  private headers(requestId?: string): Record<string, string> {
+    const headers: Record<string, string> = {};
+    if (this.apiKey) {
+      headers["Authorization"] = "Bearer " + this.apiKey;
+    }
+    if (requestId) {
+      headers["X-Request-ID"] = requestId;
+    }
+    return headers;
+  }
+}
+
+function userPath(userId: string): string {
+  return "/users/" + encodeURIComponent(userId);
+}
+
+function setField(form: FormData, name: string, value: string | number | undefined): void {
+  if (value !== undefined) {
+    form.set(name, String(value));
+  }
+}
+
+function appendImage(form: FormData, field: string, image: Image, index = 0): void {
+  const filename = typeof File !== "undefined" && image instanceof File ? image.name : `image${index + 1}.jpg`;
+  form.append(field, toBlob(image), filename);
+}
+
+function toBlob(data: Image): Blob {
+  return data instanceof Blob ? data : new Blob([data instanceof ArrayBuffer ? data : new Uint8Array(data)]);
+}
+
+/**
+ * apiError returns the error of an error envelope, or a generic one for
+ * responses without one, e.g. of a proxy.
+ */
+async function apiError(resp: Response): Promise<FaceAPIError> {
+  const text = await resp.text();
+  try {
+    const { error } = JSON.parse(text) as { error: ErrorBody };
+    if (error && typeof error.code === "string") {
+      return new FaceAPIError(
+        resp.status,
+        error.code,
+        error.message,
+        error.retryable ?? false,
+        error.details ?? {},
+        error.request_id ?? "",
+      );
+    }
+  } catch {
+    // not an envelope
+  }
+  const retryable = resp.status === 502 || resp.status === 503 || resp.status === 504;
+  return new FaceAPIError(resp.status, `http_${resp.status}`, text.trim() || resp.statusText, retryable);
+}
+
+/** retryDelay returns the milliseconds to wait before a retry: what the server asks for, else an exponential backoff. */
+function retryDelay(retryAfter: string | null, details: Record<string, unknown>, attempt: number): number {
+  for (const value of [retryAfter, details["retry_after_seconds"]]) {
+    const seconds = Number(value);
+    if (value !== null && value !== undefined && value !== "" && Number.isFinite(seconds)) {
+      return seconds * 1000;
+    }
+  }
+  return 500 * 2 ** (attempt - 1);
+}
+
+function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
@@ -0,0 +1,19 @@
+export { Client, FaceAPIError } from "./client.js";
+export type { ClientOptions, EnrollOptions, Image } from "./client.js";
+export type {
+  Box,
+  Candidate,
+  ConfidenceStats,
+  DualVerification,
+  Event,
+  Face,
+  GalleryCandidate,
+  Identification,
+  Match,
+  MatchCandidate,
+  QualityHint,
+  User,
+  Verification,
+  VerifyBatchReport,
+  VerifyBatchResult,
+} from "./models.js";
@@ -0,0 +1,549 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/redaction"
+
+	"github.com/spf13/cobra"
+)
+
+// auditOperations are the operations recorded in the audit log
+var auditOperations = []string{models.AuditEnroll, models.AuditIdentify, models.AuditVerify, models.AuditDelete, models.AuditRemoveFace, models.AuditExport, models.AuditPurge}
+
+// auditPurgeInterval is how often recording events also purges the events
+// past the retention
+const auditPurgeInterval = time.Hour
+
+func NewAuditCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show or purge the audit log of biometric operations",
+		Long: `Every enrollment, identification, verification, deletion, face removal and
+export is recorded in the audit log of the database (sqlite or postgres): when, who
+ran it (the operator's login, or the API key of a 'face serve' client), the
+user, the result, the confidence of matches and the class of errors. Events
+keep the ID of a user after the user is deleted, but never the name or face.
+Faces identified by 'face watch' are recorded in the identifications table
+instead, see the built-in "identifications" query.
+
+Identifications and verifications run with --save-probe also keep the face
+that was decided on, as a probe linked to their event: 'face audit probe'
+shows it with its decision and writes out its crop, for review of a contested
+decision. 'face audit export' writes the events to CSV or Parquet, for
+archives and analysis in other tools.
+
+With audit_retention_days set (FACE_CLI_AUDIT_RETENTION_DAYS), older events
+and probes are purged as new ones are recorded; 'face audit purge' purges
+them at once.`,
+		Example: `  face audit list --since 2026-01-01
+  face audit list --user 1c7c769f-fc5c-4ac4-b163-e125dc63a318 --json
+  face audit export --format parquet --since 30d --out audit.parquet
+  face audit probe 0b5e0c52-3f0e-4d8a-9c41-7a9f2f1b6d10 --out probe.jpg
+  face audit purge --older-than 365`,
+	}
+
+	cmd.AddCommand(newAuditListCmd(cfg))
+	cmd.AddCommand(newAuditExportCmd(cfg))
+	cmd.AddCommand(newAuditProbeCmd(cfg))
+	cmd.AddCommand(newAuditPurgeCmd(cfg))
+
+	return cmd
+}
+
+// auditListOptions are the flags of 'face audit list'
+type auditListOptions struct {
+	since, until string
+	filter       database.AuditFilter
+	formatJSON   bool
+}
+
+func newAuditListCmd(cfg *config.Config) *cobra.Command {
+	var opts auditListOptions
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List audit events, oldest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditList(cfg, &opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.since, "since", "", "only events at or after this time (2006-01-02, RFC 3339 or an age like 30d)")
+	cmd.Flags().StringVar(&opts.until, "until", "", "only events before this time (2006-01-02, RFC 3339 or an age like 12h)")
+	cmd.Flags().StringVar(&opts.filter.UserID, "user", "", "only events of this user ID")
+	cmd.Flags().StringVar(&opts.filter.Operation, "operation", "", "only events of this operation ("+strings.Join(auditOperations, ", ")+")")
+	cmd.Flags().StringVar(&opts.filter.Actor, "actor", "", "only events of this operator login or API client, e.g. api:lobby")
+	cmd.Flags().IntVarP(&opts.filter.Limit, "limit", "l", 50, "number of most recent events to show (0 = all)")
+	cmd.Flags().BoolVar(&opts.formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func newAuditProbeCmd(cfg *config.Config) *cobra.Command {
+	var (
+		out        string
+		formatJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "probe <probe-id>",
+		Short: "Show a probe saved with --save-probe and its decision",
+		Long: `Show a probe saved by 'face identify --save-probe' or 'face verify
+--save-probe': the decision made on it, the user it was decided for and the
+audit events it is linked to. With --out, the crop of the face is written to
+a file, to compare with the user's enrolled faces.`,
+		Example: `  face audit probe 0b5e0c52-3f0e-4d8a-9c41-7a9f2f1b6d10
+  face audit probe 0b5e0c52-3f0e-4d8a-9c41-7a9f2f1b6d10 --out probe.jpg --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditProbe(cfg, args[0], out, formatJSON)
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "file to write the crop of the face to")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func newAuditPurgeCmd(cfg *config.Config) *cobra.Command {
+	var olderThan int
+
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete audit events past the retention",
+		Long: `Delete the audit events and saved probes older than --older-than days,
+by default audit_retention_days.`,
+		Annotations: recordAlways(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditPurge(cfg, olderThan)
+		},
+	}
+
+	cmd.Flags().IntVar(&olderThan, "older-than", 0, "delete events older than this many days (default audit_retention_days)")
+
+	return cmd
+}
+
+// openAuditLog opens the database and returns its audit log
+func openAuditLog(cfg *config.Config) (database.Database, database.AuditLog, error) {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	log, ok := db.(database.AuditLog)
+	if !ok {
+		db.Close()
+		return nil, nil, database.ErrAuditLogUnsupported
+	}
+	return db, log, nil
+}
+
+func runAuditList(cfg *config.Config, opts *auditListOptions) error {
+	if err := opts.parse(); err != nil {
+		return err
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	db, log, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	events, err := log.AuditEvents(opts.filter)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].UserID = redactor.UserID(events[i].UserID)
+	}
+
+	if opts.formatJSON {
+		if events == nil {
+			events = []models.AuditEvent{}
+		}
+		data, err := json.MarshalIndent(events, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No audit events recorded.")
+		return nil
+	}
+	printAuditEvents(db, redactor, events)
+	return nil
+}
+
+// parse checks the filter flags and parses the times
+func (opts *auditListOptions) parse() error {
+	if op := opts.filter.Operation; op != "" && !slices.Contains(auditOperations, op) {
+		return fmt.Errorf("unknown operation %q (use %s)", op, strings.Join(auditOperations, ", "))
+	}
+	var err error
+	if opts.filter.Since, err = parseAuditTime("--since", opts.since); err != nil {
+		return err
+	}
+	opts.filter.Until, err = parseAuditTime("--until", opts.until)
+	return err
+}
+
+// parseAuditTime parses a date, an RFC 3339 time or an age before now, e.g.
+// 30d or 12h; the zero time if empty
+func parseAuditTime(flag, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if age, ok := parseAge(value); ok {
+		return time.Now().Add(-age), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q (use 2006-01-02, RFC 3339 or an age like 30d)", flag, value)
+	}
+	return t, nil
+}
+
+// parseAge parses a positive age in days, e.g. 30d, or a Go duration, e.g.
+// 12h
+func parseAge(value string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		return time.Duration(n) * 24 * time.Hour, err == nil && n > 0
+	}
+	age, err := time.ParseDuration(value)
+	return age, err == nil && age > 0
+}
+
+// printAuditEvents prints events as a table, naming the users that still
+// exist
+func printAuditEvents(db database.Database, redactor *redaction.Redactor, events []models.AuditEvent) {
+	labels := make(map[string]string)
+	label := func(userID string) string {
+		if userID == "" {
+			return "-"
+		}
+		if l, ok := labels[userID]; ok {
+			return l
+		}
+		labels[userID] = userID
+		if redactor.Level != redaction.LevelIDOnly {
+			if u, err := db.GetUser(userID); err == nil {
+				labels[userID] = fmt.Sprintf("%s (%s)", u.Name, userID)
+			}
+		}
+		return labels[userID]
+	}
+
+	fmt.Printf("%-19s  %-16s  %-9s  %-26s  %6s  %s\n", "TIME", "ACTOR", "OPERATION", "RESULT", "CONF.", "USER")
+	fmt.Println(strings.Repeat("-", 120))
+	for _, e := range events {
+		result := e.Result
+		if e.Error != "" {
+			result += " (" + e.Error + ")"
+		}
+		confidence := "-"
+		if e.Confidence > 0 {
+			confidence = fmt.Sprintf("%.1f%%", e.Confidence*100)
+		}
+		user := label(e.UserID)
+		if e.ProbeID != "" {
+			user += "  [probe " + e.ProbeID + "]"
+		}
+		fmt.Printf("%-19s  %-16s  %-9s  %-26s  %6s  %s\n",
+			e.OccurredAt.Local().Format("2006-01-02 15:04:05"), e.Actor, e.Operation, result, confidence, user)
+	}
+}
+
+// auditProbe is the output of 'face audit probe --json'
+type auditProbe struct {
+	models.Probe
+	Events []models.AuditEvent `json:"events"`
+}
+
+func runAuditProbe(cfg *config.Config, id, out string, formatJSON bool) error {
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	db, log, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	store, ok := db.(database.ProbeStore)
+	if !ok {
+		return database.ErrProbeStoreUnsupported
+	}
+
+	probe, err := store.GetProbe(id)
+	if err != nil {
+		return err
+	}
+	events, err := log.AuditEvents(database.AuditFilter{ProbeID: probe.ID})
+	if err != nil {
+		return err
+	}
+	if out != "" {
+		if err := writeProbeImage(cfg, db, probe, out); err != nil {
+			return err
+		}
+	}
+
+	probe.UserID = redactor.UserID(probe.UserID)
+	for i := range events {
+		events[i].UserID = redactor.UserID(events[i].UserID)
+	}
+	if formatJSON {
+		if events == nil {
+			events = []models.AuditEvent{}
+		}
+		data, err := json.MarshalIndent(auditProbe{Probe: *probe, Events: events}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	printProbeDecision(db, redactor, probe)
+	if len(events) > 0 {
+		fmt.Println()
+		printAuditEvents(db, redactor, events)
+	}
+	if out != "" {
+		fmt.Printf("\n✓ Face saved to %s\n", out)
+	}
+	return nil
+}
+
+// printProbeDecision prints a probe and the decision made on it
+func printProbeDecision(db database.Database, redactor *redaction.Redactor, probe *models.Probe) {
+	decision := "✗ not matched"
+	if probe.Matched {
+		decision = "✓ matched"
+	}
+	user := "-"
+	if probe.UserID != "" {
+		user = probe.UserID
+		if u, err := db.GetUser(probe.UserID); err == nil {
+			user = redactor.Label(u)
+		}
+	}
+
+	fmt.Printf("Probe:       %s\n", probe.ID)
+	fmt.Printf("Captured:    %s\n", probe.CapturedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("Operation:   %s\n", probe.Operation)
+	fmt.Printf("Decision:    %s\n", decision)
+	fmt.Printf("User:        %s\n", user)
+	if probe.Confidence > 0 {
+		fmt.Printf("Confidence:  %.2f%% (threshold %.0f%%)\n", probe.Confidence*100, probe.Threshold*100)
+	} else {
+		fmt.Printf("Threshold:   %.0f%%\n", probe.Threshold*100)
+	}
+	fmt.Printf("Quality:     %.2f\n", probe.Quality)
+	if probe.RequestID != "" {
+		fmt.Printf("Request ID:  %s\n", probe.RequestID)
+	}
+}
+
+// writeProbeImage writes the crop of a probe to a file
+func writeProbeImage(cfg *config.Config, db database.Database, probe *models.Probe, out string) error {
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	data, err := stor.LoadData(probe.Filename)
+	if err != nil {
+		return fmt.Errorf("failed to load probe image: %w", err)
+	}
+	if err := os.WriteFile(out, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write probe image: %w", err)
+	}
+	return nil
+}
+
+func runAuditPurge(cfg *config.Config, olderThan int) error {
+	retention := cfg.AuditRetention()
+	if olderThan < 0 {
+		return errors.New("--older-than must not be negative")
+	}
+	if olderThan > 0 {
+		retention = time.Duration(olderThan) * 24 * time.Hour
+	}
+	if retention == 0 {
+		return errors.New("no retention configured; set audit_retention_days or pass --older-than")
+	}
+
+	db, log, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	before := time.Now().Add(-retention)
+	purged, err := log.PurgeAuditEvents(before)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Purged %d audit event(s) before %s\n", purged, before.Local().Format("2006-01-02 15:04:05"))
+
+	files, err := deleteProbes(cfg, db, database.ProbeFilter{Before: before})
+	if len(files) > 0 {
+		fmt.Printf("✓ Purged %d saved probe(s)\n", len(files))
+	}
+	return err
+}
+
+// auditRecord is the audit event of an operation being run
+type auditRecord struct {
+	cfg   *config.Config
+	db    database.Database
+	event models.AuditEvent
+}
+
+// startAudit starts the audit event of an operation run by this command
+func startAudit(cfg *config.Config, db database.Database, operation, userID string) *auditRecord {
+	return &auditRecord{cfg: cfg, db: db, event: models.AuditEvent{
+		Actor:     operatorLogin(),
+		Operation: operation,
+		UserID:    userID,
+		RequestID: cfg.RequestID(),
+	}}
+}
+
+// finish records the event with the result of the operation, failed if
+// err is not nil, warning if it cannot be recorded
+func (a *auditRecord) finish(err error) {
+	setAuditResult(&a.event, err)
+	if err := recordAudit(a.cfg, a.db, &a.event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// setAuditResult sets the result of an event from the error its operation
+// returned; without one, the result set by the operation is kept, or it
+// succeeded
+func setAuditResult(event *models.AuditEvent, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoMatch):
+		event.Result = models.AuditNoMatch
+	case err != nil:
+		event.Result = models.AuditFailed
+		event.Error = string(apierror.From(err).Code)
+	case event.Result == "":
+		event.Result = models.AuditSucceeded
+	}
+}
+
+// operatorLogin returns the login of the user running this command
+func operatorLogin() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// auditPurge remembers when this process last purged the audit log
+var auditPurge struct {
+	sync.Mutex
+	last time.Time
+}
+
+// recordAudit records an event in the audit log of db, purging the events
+// past the retention at most every auditPurgeInterval. Databases without an
+// audit log record nothing, see 'face audit'.
+func recordAudit(cfg *config.Config, db database.Database, event *models.AuditEvent) error {
+	log, ok := db.(database.AuditLog)
+	if !ok {
+		return nil
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	if err := log.LogAuditEvent(event); err != nil {
+		if errors.Is(err, database.ErrAuditLogUnsupported) {
+			return nil
+		}
+		return fmt.Errorf("audit event not recorded: %w", err)
+	}
+
+	retention := cfg.AuditRetention()
+	if retention == 0 {
+		return nil
+	}
+	auditPurge.Lock()
+	defer auditPurge.Unlock()
+	if time.Since(auditPurge.last) < auditPurgeInterval {
+		return nil
+	}
+	auditPurge.last = time.Now()
+	before := time.Now().Add(-retention)
+	if _, err := log.PurgeAuditEvents(before); err != nil {
+		return fmt.Errorf("audit log not purged: %w", err)
+	}
+	if _, err := deleteProbes(cfg, db, database.ProbeFilter{Before: before}); err != nil {
+		return fmt.Errorf("saved probes not purged: %w", err)
+	}
+	return nil
+}
+
+// warnUnaudited warns that operations are not audited if the database keeps
+// no audit log, for the servers to say once at startup
+func warnUnaudited(cfg *config.Config) {
+	if !cfg.DatabaseType.UsesMigrations() {
+		fmt.Printf("⚠ Warning: the %s database keeps no audit log, operations are not audited (use sqlite or postgres)\n", cfg.DatabaseType)
+	}
+}
+
+// audit records an operation of a DeepStack request in the audit log
+func (s *deepStackServer) audit(event models.AuditEvent, err error) {
+	event.Actor = "deepstack"
+	setAuditResult(&event, err)
+	if err := recordAudit(s.cfg, s.fs.DB, &event); err != nil {
+		slog.Warn(err.Error(), "operation", event.Operation)
+	}
+}
+
+// audit records an operation of an API request in the audit log, with the
+// API client as the actor
+func (s *apiServer) audit(ctx context.Context, event models.AuditEvent, err error) {
+	event.Actor = "api"
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		if info.client != "" {
+			event.Actor = "api:" + info.client
+		}
+		event.RequestID = info.id
+	}
+	setAuditResult(&event, err)
+	if err := recordAudit(s.cfg, s.fs.DB, &event); err != nil {
+		requestLogger(ctx).Warn(err.Error(), "operation", event.Operation)
+	}
+}
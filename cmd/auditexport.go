@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database/models"
+	"face/internal/parquet"
+
+	"github.com/spf13/cobra"
+)
+
+// auditColumn is a column of 'face audit export'
+type auditColumn struct {
+	name  string
+	typ   parquet.Type
+	value func(e *models.AuditEvent) any
+}
+
+// auditColumns are the columns 'face audit export' can write, in order
+var auditColumns = []auditColumn{
+	{"seq", parquet.Int64, func(e *models.AuditEvent) any { return e.Seq }},
+	{"occurred_at", parquet.Timestamp, func(e *models.AuditEvent) any { return e.OccurredAt }},
+	{"actor", parquet.String, func(e *models.AuditEvent) any { return e.Actor }},
+	{"operation", parquet.String, func(e *models.AuditEvent) any { return e.Operation }},
+	{"user_id", parquet.String, func(e *models.AuditEvent) any { return e.UserID }},
+	{"result", parquet.String, func(e *models.AuditEvent) any { return e.Result }},
+	{"confidence", parquet.Double, func(e *models.AuditEvent) any { return e.Confidence }},
+	{"error", parquet.String, func(e *models.AuditEvent) any { return e.Error }},
+	{"request_id", parquet.String, func(e *models.AuditEvent) any { return e.RequestID }},
+	{"probe_id", parquet.String, func(e *models.AuditEvent) any { return e.ProbeID }},
+}
+
+// auditExportOptions are the flags of 'face audit export'
+type auditExportOptions struct {
+	auditListOptions
+	format  string
+	columns []string
+	gzip    bool
+	out     string
+}
+
+func newAuditExportCmd(cfg *config.Config) *cobra.Command {
+	var opts auditExportOptions
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export audit events to CSV or Parquet, oldest first",
+		Long: `Write the audit events to a CSV or Parquet file, for a compliance archive or
+for analysis in other tools. User IDs are redacted per the redaction level.
+Parquet files hold the time of events as a timestamp and the confidence as a
+double; with --gzip their pages are compressed, while CSV is written as a
+gzip stream.
+
+The export itself is recorded in the audit log.`,
+		Example: `  face audit export --since 30d --out audit.csv
+  face audit export --format parquet --since 2026-01-01 --until 2026-02-01 --out january.parquet
+  face audit export --operation identify --columns occurred_at,actor,result,confidence --gzip > identify.csv.gz`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuditExport(cfg, &opts)
+		},
+	}
+
+	names := make([]string, len(auditColumns))
+	for i, c := range auditColumns {
+		names[i] = c.name
+	}
+	cmd.Flags().StringVar(&opts.format, "format", "csv", "file format (csv, parquet)")
+	cmd.Flags().StringVar(&opts.since, "since", "", "only events at or after this time (2006-01-02, RFC 3339 or an age like 30d)")
+	cmd.Flags().StringVar(&opts.until, "until", "", "only events before this time (2006-01-02, RFC 3339 or an age like 12h)")
+	cmd.Flags().StringVar(&opts.filter.UserID, "user", "", "only events of this user ID")
+	cmd.Flags().StringVar(&opts.filter.Operation, "operation", "", "only events of this operation ("+strings.Join(auditOperations, ", ")+")")
+	cmd.Flags().StringVar(&opts.filter.Actor, "actor", "", "only events of this operator login or API client, e.g. api:lobby")
+	cmd.Flags().StringSliceVar(&opts.columns, "columns", names, "columns to write, in order")
+	cmd.Flags().BoolVar(&opts.gzip, "gzip", false, "compress the output with gzip")
+	cmd.Flags().StringVarP(&opts.out, "out", "o", "", "file to write (default standard output)")
+
+	return cmd
+}
+
+func runAuditExport(cfg *config.Config, opts *auditExportOptions) (err error) {
+	if opts.format != "csv" && opts.format != "parquet" {
+		return fmt.Errorf("unknown format %q (use csv or parquet)", opts.format)
+	}
+	columns, err := selectAuditColumns(opts.columns)
+	if err != nil {
+		return err
+	}
+	if err := opts.parse(); err != nil {
+		return err
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	db, log, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	audit := startAudit(cfg, db, models.AuditExport, "")
+	defer func() { audit.finish(err) }()
+
+	events, err := log.AuditEvents(opts.filter)
+	if err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].UserID = redactor.UserID(events[i].UserID)
+	}
+
+	if opts.out == "" {
+		return writeAuditExport(os.Stdout, opts, columns, events)
+	}
+	file, err := os.OpenFile(opts.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create export: %w", err)
+	}
+	if err = writeAuditExport(file, opts, columns, events); err == nil {
+		if err = file.Close(); err != nil {
+			err = fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(opts.out)
+		return err
+	}
+	fmt.Printf("✓ Exported %d audit event(s) to %s\n", len(events), opts.out)
+	return nil
+}
+
+// writeAuditExport writes events in the format of opts
+func writeAuditExport(w io.Writer, opts *auditExportOptions, columns []auditColumn, events []models.AuditEvent) error {
+	var err error
+	if opts.format == "parquet" {
+		err = writeAuditParquet(w, columns, events, opts.gzip)
+	} else {
+		err = writeAuditCSV(w, columns, events, opts.gzip)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// selectAuditColumns returns the columns named, in the order named
+func selectAuditColumns(names []string) ([]auditColumn, error) {
+	columns := make([]auditColumn, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(auditColumns, func(c auditColumn) bool { return c.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns = append(columns, auditColumns[i])
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns to export")
+	}
+	return columns, nil
+}
+
+// writeAuditCSV writes events as CSV with a header row, as a gzip stream if
+// compress is set
+func writeAuditCSV(w io.Writer, columns []auditColumn, events []models.AuditEvent, compress bool) error {
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+
+	cw := csv.NewWriter(w)
+	row := make([]string, len(columns))
+	for i, c := range columns {
+		row[i] = c.name
+	}
+	cw.Write(row)
+	for i := range events {
+		for j, c := range columns {
+			row[j] = formatAuditValue(c.value(&events[i]))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
+
+// formatAuditValue formats a value of a column for CSV
+func formatAuditValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeAuditParquet writes events as a Parquet file, with gzip compressed
+// pages if compress is set
+func writeAuditParquet(w io.Writer, columns []auditColumn, events []models.AuditEvent, compress bool) error {
+	schema := make([]parquet.Column, len(columns))
+	for i, c := range columns {
+		schema[i] = parquet.Column{Name: c.name, Type: c.typ}
+	}
+
+	pw := parquet.NewWriter(w, schema, compress)
+	row := make([]any, len(columns))
+	for i := range events {
+		for j, c := range columns {
+			row[j] = c.value(&events[i])
+		}
+		if err := pw.Write(row); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
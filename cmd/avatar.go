@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/imaging"
+	"face/internal/storage"
+)
+
+const (
+	// avatarFaceID is the face ID avatars are stored under, which keeps
+	// them apart from the images of enrolled faces
+	avatarFaceID = "avatar"
+	// avatarSize is the width and height of generated avatars
+	avatarSize = 256
+)
+
+// errNoAvatar is returned for the avatar of a user without faces
+var errNoAvatar = errors.New("user has no faces to make an avatar from")
+
+// refreshAvatar regenerates a user's avatar after their faces changed. The
+// face change itself has succeeded by then, so a failure is only a warning.
+func refreshAvatar(db database.Database, stor storage.Storage, userID string) {
+	if _, err := generateAvatar(db, stor, userID); err != nil {
+		fmt.Printf("Warning: failed to update avatar: %v\n", err)
+	}
+}
+
+// generateAvatar stores a standardized square crop of the user's primary
+// or best quality face as their avatar and returns its filename. A user
+// without faces has their avatar removed.
+func generateAvatar(db database.Database, stor storage.Storage, userID string) (string, error) {
+	user, err := db.GetUser(userID)
+	if err != nil {
+		return "", fmt.Errorf("user not found: %w", err)
+	}
+
+	source, ok := models.AvatarFace(user.Faces)
+	if !ok {
+		if user.Avatar == "" {
+			return "", nil
+		}
+		if err := stor.DeleteImage(user.Avatar); err != nil {
+			return "", fmt.Errorf("failed to delete avatar: %w", err)
+		}
+		return "", db.SetUserAvatar(userID, "")
+	}
+
+	img, err := stor.LoadImage(source.Filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to load face image: %w", err)
+	}
+
+	filename, err := stor.SaveImage(userID, avatarFaceID, imaging.NormalizeCrop(img, avatarSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to save avatar: %w", err)
+	}
+	if filename == user.Avatar {
+		return filename, nil
+	}
+
+	if err := db.SetUserAvatar(userID, filename); err != nil {
+		return "", fmt.Errorf("failed to record avatar: %w", err)
+	}
+	// The storage layout may have changed since the last avatar was saved
+	if user.Avatar != "" {
+		_ = stor.DeleteImage(user.Avatar)
+	}
+	return filename, nil
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"face/config"
+
+	"github.com/spf13/cobra"
+)
+
+// testPostgresDSN names the variable of the PostgreSQL database the
+// backend tests also run against; they are skipped for PostgreSQL if it is
+// not set. Each run uses a new schema of the database.
+const testPostgresDSN = "FACE_CLI_TEST_POSTGRES_DSN"
+
+// testBackend is a database the commands are tested against
+type testBackend struct {
+	name string
+	// env returns the settings of the backend for a test in dir, nil to
+	// skip it
+	env func(dir string) map[string]string
+}
+
+var testBackends = []testBackend{
+	{"sqlite", func(dir string) map[string]string {
+		return map[string]string{"FACE_CLI_DB_TYPE": "sqlite", "FACE_CLI_DB_PATH": filepath.Join(dir, "face.db")}
+	}},
+	{"json", func(dir string) map[string]string {
+		return map[string]string{"FACE_CLI_DB_TYPE": "json", "FACE_CLI_DB_PATH": filepath.Join(dir, "face.json")}
+	}},
+	{"postgres", func(dir string) map[string]string {
+		dsn := os.Getenv(testPostgresDSN)
+		if dsn == "" {
+			return nil
+		}
+		return map[string]string{
+			"FACE_CLI_DB_TYPE":   "postgres",
+			"FACE_CLI_DB_PATH":   dsn,
+			"FACE_CLI_DB_SCHEMA": fmt.Sprintf("face_test_%d", time.Now().UnixNano()),
+		}
+	}},
+}
+
+// commandStep runs a command and checks its output
+type commandStep struct {
+	name string
+	args []string
+	// want and notWant are expected in and absent from the output
+	want, notWant string
+}
+
+// TestCommandsOnEveryBackend runs the commands that read and change users
+// against every database backend, with the mock pipeline: an image matches
+// itself, and no other image.
+func TestCommandsOnEveryBackend(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+			env := backend.env(dir)
+			if env == nil {
+				t.Skipf("set %s to test %s", testPostgresDSN, backend.name)
+			}
+			cfg := testConfig(t, dir, env)
+			alice, bob := testImage(t, dir, "alice", 1), testImage(t, dir, "bob", 2)
+
+			steps := []commandStep{
+				{"enroll", []string{"enroll", "--name", "Alice", "--images", alice}, "Faces enrolled: 1", ""},
+				{"enroll another", []string{"enroll", "--name", "Bob", "--images", bob}, "Faces enrolled: 1", ""},
+				{"list", []string{"list"}, "Total users: 2", ""},
+				{"identify", []string{"identify", "--image", alice}, "Name:        Alice", "No match found"},
+				{"verify", []string{"verify", "--user-name", "Alice", "--image", alice}, "✓ VERIFIED", ""},
+				{"verify someone else", []string{"verify", "--user-name", "Bob", "--image", alice}, "NOT VERIFIED", ""},
+				{"update", []string{"update", "--user-name", "Alice", "--name", "Alicia"}, "✓ Updated name to: Alicia", ""},
+				{"identify updated", []string{"identify", "--image", alice}, "Name:        Alicia", ""},
+				{"delete", []string{"delete", "--user-name", "Bob", "-y"}, "✓ User 'Bob' deleted successfully", ""},
+				{"identify deleted", []string{"identify", "--image", bob}, "No match found", ""},
+				{"list remaining", []string{"list"}, "Total users: 1", "Bob"},
+			}
+			for _, step := range steps {
+				out, err := runTestCommand(cfg, step.args)
+				if err != nil {
+					t.Fatalf("%s: %v\n%s", step.name, err, out)
+				}
+				if !strings.Contains(out, step.want) {
+					t.Errorf("%s: output does not contain %q:\n%s", step.name, step.want, out)
+				}
+				if step.notWant != "" && strings.Contains(out, step.notWant) {
+					t.Errorf("%s: output contains %q:\n%s", step.name, step.notWant, out)
+				}
+			}
+		})
+	}
+}
+
+// testConfig returns the config of a test in dir with the mock pipeline,
+// overlaid with env
+func testConfig(t *testing.T, dir string, env map[string]string) *config.Config {
+	t.Helper()
+	t.Setenv("FACE_CLI_CONFIG", filepath.Join(dir, "face.config.json"))
+	t.Setenv("FACE_CLI_FACES_DIR", filepath.Join(dir, "faces"))
+	t.Setenv("FACE_CLI_HISTORY_FILE", "none")
+	t.Setenv("FACE_CLI_UNDO_FILE", filepath.Join(dir, "undo.json"))
+	t.Setenv("FACE_CLI_AUTO_MIGRATE", "true")
+	t.Setenv("FACE_CLI_PIPELINE", "mock")
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	return config.LoadConfig()
+}
+
+// testImage writes a JPEG of random pixels, which the mock pipeline takes
+// for a face of its own, and returns its path
+func testImage(t *testing.T, dir, name string, seed int64) string {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 160, 160))
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 160; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+
+	path := filepath.Join(dir, name+".jpg")
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runTestCommand runs a command as the face binary would and returns what
+// it printed
+func runTestCommand(cfg *config.Config, args []string) (string, error) {
+	root := &cobra.Command{Use: "face", SilenceUsage: true, SilenceErrors: true}
+	root.AddCommand(NewEnrollCmd(cfg), NewIdentifyCmd(cfg), NewVerifyCmd(cfg), NewUpdateCmd(cfg), NewDeleteCmd(cfg), NewListCmd(cfg))
+	root.SetArgs(args)
+
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	os.Stdout = w
+	printed := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		printed <- string(out)
+	}()
+
+	err = root.Execute()
+	w.Close()
+	os.Stdout = stdout
+	return <-printed, err
+}
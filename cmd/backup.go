@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/backup"
+	"face/internal/compression"
+	"face/internal/database"
+	"face/internal/dataset"
+
+	"github.com/spf13/cobra"
+)
+
+// backupOptions are the flags of 'face backup create'
+type backupOptions struct {
+	Out     string
+	Images  bool
+	Encrypt bool
+	KeyFile string
+	Upload  string
+}
+
+func NewBackupCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Create, encrypt, upload and verify backups",
+		Long: `Back up everything enrolled as a 'face export' archive, encrypted with
+AES-256 and uploaded off-site, and check that a backup restores.
+
+Backups are encrypted with a key file (--key-file, or backup_key_file in the
+config) or a passphrase (--encrypt, prompted for unless backup_passphrase or
+FACE_CLI_BACKUP_PASSPHRASE is set). A key file holds 32 random bytes, e.g.
+made with 'openssl rand -hex 32'. Keep the key apart from the backups: a
+backup cannot be restored without it.
+
+Upload targets are URLs of a directory:
+  s3://bucket/prefix?endpoint=minio:9000&region=eu-west-1
+  sftp://user@host:22/srv/face-backups?key=/root/.ssh/backup_ed25519
+
+S3 credentials are read like those of the tiered storage backend. SFTP uses
+the SSH agent or the key file, and only connects to hosts in known_hosts.`,
+	}
+
+	cmd.AddCommand(newBackupCreateCmd(cfg))
+	cmd.AddCommand(newBackupVerifyCmd(cfg))
+
+	return cmd
+}
+
+func newBackupCreateCmd(cfg *config.Config) *cobra.Command {
+	var opts backupOptions
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Write a backup, optionally encrypted and uploaded",
+		Long: `Write a backup of the settings, users, faces, embeddings and face images,
+restorable with 'face import'. With --upload the backup is copied to an
+off-site target, which needs it to be encrypted; without --out it is then
+only kept there.`,
+		Example: `  face backup create --key-file /etc/face/backup.key --out /var/backups/face.tar.gz.enc
+  face backup create --key-file /etc/face/backup.key --upload s3://backups/face
+  FACE_CLI_BACKUP_PASSPHRASE=... face backup create --upload sftp://backup@nas/srv/face`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("key-file") {
+				opts.KeyFile = cfg.BackupKeyFile
+			}
+			if !cmd.Flags().Changed("upload") {
+				opts.Upload = cfg.BackupUpload
+			}
+			return runBackupCreate(cmd.Context(), cfg, cmd.Root().Version, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Out, "out", "o", "", "file to write (default face-backup-<time>.tar.gz[.enc])")
+	cmd.Flags().BoolVar(&opts.Images, "images", true, "include the stored face images")
+	cmd.Flags().BoolVar(&opts.Encrypt, "encrypt", false, "encrypt with a passphrase")
+	cmd.Flags().StringVar(&opts.KeyFile, "key-file", "", "encrypt with this key file")
+	cmd.Flags().StringVar(&opts.Upload, "upload", "", "upload to this target, e.g. s3://bucket/prefix or sftp://user@host/dir")
+
+	return cmd
+}
+
+func runBackupCreate(ctx context.Context, cfg *config.Config, version string, opts backupOptions) (err error) {
+	var target backup.Target
+	if opts.Upload != "" {
+		if target, err = backup.ParseTarget(opts.Upload); err != nil {
+			return err
+		}
+	}
+
+	var key *backup.Key
+	if opts.Encrypt || opts.KeyFile != "" || cfg.BackupPassphrase != "" {
+		if key, err = backupKey(cfg, opts.KeyFile, true); err != nil {
+			return err
+		}
+	}
+	if target != nil && key == nil {
+		return errors.New("off-site backups must be encrypted: give --key-file or --encrypt")
+	}
+
+	out, name, keep := backupPath(opts.Out, key != nil, target != nil)
+	if !keep {
+		dir, err := os.MkdirTemp("", "face-backup-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		out = filepath.Join(dir, name)
+	}
+
+	manifest, err := writeBackup(cfg, version, out, key, opts.Images)
+	if err != nil {
+		return err
+	}
+	if keep {
+		fmt.Printf("✓ Backed up %d user(s) with %d face(s) to %s\n", manifest.Users, manifest.Faces, out)
+	} else {
+		fmt.Printf("✓ Backed up %d user(s) with %d face(s)\n", manifest.Users, manifest.Faces)
+	}
+	if key != nil {
+		fmt.Printf("  Encrypted with a %s\n", key)
+	}
+
+	if target != nil {
+		if err := uploadBackup(ctx, target, out, name); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Uploaded to %s/%s\n", target, name)
+	}
+	return nil
+}
+
+// backupPath returns the file to write a backup to and its name at the
+// upload target. Without --out, a backup that is uploaded is not kept
+// locally and must be written to a temporary directory.
+func backupPath(out string, encrypted, upload bool) (string, string, bool) {
+	if out != "" {
+		return out, filepath.Base(out), true
+	}
+	name := fmt.Sprintf("face-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	if encrypted {
+		name += backup.Extension
+	}
+	return name, name, !upload
+}
+
+// writeBackup writes a dataset archive to out, compressed according to its
+// name and encrypted if a key is given
+func writeBackup(cfg *config.Config, version, out string, key *backup.Key, images bool) (manifest *dataset.Manifest, err error) {
+	file, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(out)
+		}
+	}()
+
+	var w io.Writer = file
+	var encrypter io.WriteCloser
+	if key != nil {
+		if encrypter, err = backup.Encrypt(file, *key); err != nil {
+			return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+		}
+		w = encrypter
+	}
+	compressor, err := compression.NewWriter(w, compression.FormatOf(strings.TrimSuffix(out, backup.Extension)))
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest, err = writeDataset(cfg, version, compressor, images); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return nil, fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return manifest, nil
+}
+
+func uploadBackup(ctx context.Context, target backup.Target, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return target.Upload(ctx, name, file, info.Size())
+}
+
+// backupKey returns the key given by a key file or passphrase, prompting
+// for the passphrase if neither is configured. A new passphrase is asked
+// twice on a terminal.
+func backupKey(cfg *config.Config, keyFile string, create bool) (*backup.Key, error) {
+	if keyFile != "" {
+		key, err := backup.ReadKeyFile(keyFile)
+		return &key, err
+	}
+
+	passphrase := cfg.BackupPassphrase
+	if passphrase == "" {
+		var err error
+		if passphrase, err = readSecret("Backup passphrase"); err != nil {
+			return nil, err
+		}
+		if create && stdinIsTerminal() {
+			again, err := readSecret("Repeat the passphrase")
+			if err != nil {
+				return nil, err
+			}
+			if again != passphrase {
+				return nil, errors.New("the passphrases do not match")
+			}
+		}
+	}
+
+	key, err := backup.Passphrase(passphrase)
+	return &key, err
+}
+
+func newBackupVerifyCmd(cfg *config.Config) *cobra.Command {
+	var keyFile string
+
+	cmd := &cobra.Command{
+		Use:   "verify <backup>",
+		Short: "Check that a backup restores",
+		Long: `Decrypt a backup and restore it into a temporary database and faces
+directory, which are removed afterwards, then check that what was restored
+matches the backup's manifest. The backup is a file or the URL of an
+uploaded one; nothing configured is read or changed.`,
+		Example: `  face backup verify /var/backups/face-backup-20261017-020000.tar.gz.enc --key-file /etc/face/backup.key
+  face backup verify s3://backups/face/face-backup-20261017-020000.tar.gz.enc`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("key-file") {
+				keyFile = cfg.BackupKeyFile
+			}
+			return runBackupVerify(cmd.Context(), cfg, args[0], keyFile)
+		},
+	}
+
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "key file the backup was encrypted with")
+
+	return cmd
+}
+
+func runBackupVerify(ctx context.Context, cfg *config.Config, location, keyFile string) error {
+	dir, err := os.MkdirTemp("", "face-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path, name := location, filepath.Base(location)
+	if backup.IsLocation(location) {
+		if path, name, err = downloadBackup(ctx, location, dir); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Downloaded %s\n", location)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	r, err := openBackup(cfg, bufio.NewReader(file), keyFile)
+	if err != nil {
+		return err
+	}
+	archive, err := readBackup(r, name)
+	if err != nil {
+		return err
+	}
+
+	m := archive.Manifest
+	fmt.Printf("✓ Read backup of %s, written %s by face %s from the %s database\n",
+		name, m.CreatedAt.Local().Format("2006-01-02 15:04"), m.Source, m.DatabaseType)
+
+	result, err := restoreBackup(cfg, archive, dir)
+	if err != nil {
+		return fmt.Errorf("backup did not restore: %w", err)
+	}
+	fmt.Printf("✓ Restored %d user(s), %d face(s) and %d image(s) into a temporary database\n", result.Users, result.Faces, result.Images)
+	fmt.Println("✓ Backup verified")
+	return nil
+}
+
+// downloadBackup copies an uploaded backup into dir
+func downloadBackup(ctx context.Context, location, dir string) (string, string, error) {
+	target, name, err := backup.ParseLocation(location)
+	if err != nil {
+		return "", "", err
+	}
+
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", "", err
+	}
+	if err := target.Download(ctx, name, file); err != nil {
+		file.Close()
+		return "", "", err
+	}
+	return path, name, file.Close()
+}
+
+// openBackup returns the contents of a backup, decrypted if encrypted
+func openBackup(cfg *config.Config, r *bufio.Reader, keyFile string) (io.Reader, error) {
+	encrypted, err := backup.IsEncrypted(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	if !encrypted {
+		fmt.Println("  The backup is not encrypted")
+		return r, nil
+	}
+
+	key, err := backupKey(cfg, keyFile, false)
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := backup.Decrypt(r, *key)
+	if err != nil {
+		return nil, err
+	}
+
+	// opening the first chunk tells a wrong key from a damaged backup
+	br := bufio.NewReader(decrypted)
+	if _, err := br.Peek(1); err != nil {
+		return nil, err
+	}
+	fmt.Printf("✓ Decrypted with a %s\n", key)
+	return br, nil
+}
+
+// readBackup decompresses a backup according to its name and reads its
+// archive
+func readBackup(r io.Reader, name string) (*dataset.Reader, error) {
+	decompressed, err := compression.NewReader(r, compression.FormatOf(strings.TrimSuffix(name, backup.Extension)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	archive, err := dataset.NewReader(decompressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return archive, nil
+}
+
+// restoreBackup imports an archive into a new SQLite database and local
+// faces directory in dir, and checks what was stored against the manifest
+func restoreBackup(cfg *config.Config, archive *dataset.Reader, dir string) (*importResult, error) {
+	restore := *cfg
+	restore.DatabaseType = database.DatabaseTypeSQLite
+	restore.DatabasePath = filepath.Join(dir, "face.db")
+	restore.DatabaseSchema, restore.TablePrefix, restore.Tenant = "", "", ""
+	restore.DatabaseRoles, restore.PGVector = false, false
+	restore.FacesDir = filepath.Join(dir, "faces")
+	restore.StorageBackend = ""
+
+	migrator, err := restore.GetMigrator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrator: %w", err)
+	}
+	err = migrator.Up()
+	migrator.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := restore.GetDatabaseConnection()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	stor, err := restore.GetStorage(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := importDataset(archive, db, stor, importOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return result, checkRestore(db, &archive.Manifest, result)
+}
+
+// checkRestore compares a restored database with the manifest of its backup
+func checkRestore(db database.Database, m *dataset.Manifest, result *importResult) error {
+	users, err := db.ListUsers()
+	if err != nil {
+		return err
+	}
+
+	faces, badEmbeddings, missingImages := 0, 0, 0
+	for _, user := range users {
+		for _, f := range user.Faces {
+			faces++
+			if m.EmbeddingDimension > 0 && len(f.Embedding) != m.EmbeddingDimension {
+				badEmbeddings++
+			}
+			if m.Images && f.Filename == "" {
+				missingImages++
+			}
+		}
+	}
+
+	var problems []string
+	if len(users) != m.Users {
+		problems = append(problems, fmt.Sprintf("%d user(s) restored, the manifest lists %d", len(users), m.Users))
+	}
+	if faces != m.Faces {
+		problems = append(problems, fmt.Sprintf("%d face(s) restored, the manifest lists %d", faces, m.Faces))
+	}
+	if badEmbeddings > 0 {
+		problems = append(problems, fmt.Sprintf("%d embedding(s) without %d dimensions", badEmbeddings, m.EmbeddingDimension))
+	}
+	if m.Images && (missingImages > 0 || result.Images != m.Faces) {
+		problems = append(problems, fmt.Sprintf("%d image(s) restored for %d face(s)", result.Images, m.Faces))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
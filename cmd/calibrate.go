@@ -0,0 +1,411 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"face/config"
+	"face/internal/calibration"
+	"face/internal/compression"
+	"face/internal/database"
+	"face/matching"
+
+	"github.com/spf13/cobra"
+)
+
+// calibrationPair is a row of a calibration pairs file: two images and
+// whether they show the same person. Line is its line in the file.
+type calibrationPair struct {
+	Line   int
+	ImageA string
+	ImageB string
+	Same   bool
+}
+
+// calibrationReport is the report of 'face calibrate'
+type calibrationReport struct {
+	// Model is the embedding model the pairs were scored with, as
+	// thresholds of one model do not suit another
+	Model string `json:"model"`
+	// Seed is the seed the pairs were sampled with, see --seed
+	Seed     int64 `json:"seed,omitempty"`
+	Pairs    int   `json:"pairs"`
+	Sampled  int   `json:"sampled,omitempty"`
+	Genuine  int   `json:"genuine"`
+	Impostor int   `json:"impostor"`
+	// Skipped are the pairs with an image that could not be scored
+	Skipped            int               `json:"skipped"`
+	GenuineSimilarity  *confidenceStats  `json:"genuine_similarity,omitempty"`
+	ImpostorSimilarity *confidenceStats  `json:"impostor_similarity,omitempty"`
+	AUC                float64           `json:"auc"`
+	EqualErrorRate     float64           `json:"equal_error_rate"`
+	EqualError         calibration.Point `json:"equal_error"`
+	// Criterion is how the recommended threshold was chosen: "eer" or
+	// "target_far"
+	Criterion   string              `json:"criterion"`
+	TargetFAR   float64             `json:"target_far,omitempty"`
+	Recommended calibration.Point   `json:"recommended"`
+	Current     calibration.Point   `json:"current"`
+	Curve       []calibration.Point `json:"curve"`
+}
+
+func NewCalibrateCmd(cfg *config.Config) *cobra.Command {
+	var (
+		pairsPath string
+		targetFAR float64
+		sample    int
+		output    string
+		write     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:         "calibrate",
+		Short:       "Recommend a match threshold from labeled pairs of images",
+		Annotations: recordWith("write"),
+		Long: `Score pairs of images known to show the same person (genuine) or two
+different people (impostor), and recommend the match threshold that
+separates them best, rather than guessing between 0.6 and 0.75.
+
+Each row of --pairs is image_a,image_b,same where same is 1, true, yes,
+same or genuine for a genuine pair and 0, false, no, different or impostor
+otherwise; a first row of image_a,image_b,same is taken as a header.
+Relative image paths are relative to the pairs file. Use images like the
+ones cameras take, of people who are not necessarily enrolled, and many more
+impostor pairs than genuine ones for a low --target-far to mean something.
+
+For every threshold from 0 to 1 in steps of 0.001, the false accept rate
+(FAR: impostor pairs scoring at least the threshold) and the false reject
+rate (FRR: genuine pairs scoring below it) are computed; together they are
+the ROC curve, summarized by its area (AUC). The recommended threshold is
+the one where FAR and FRR are equal (the equal error rate), or with
+--target-far the lowest one accepting at most that share of impostors.
+--output writes the whole curve as JSON; a name ending in .gz or .zst is
+compressed.
+
+--write stores the recommendation as the match threshold of 'face
+settings'. Commands match at --threshold (default_threshold in the config
+file), so set that too for it to take effect.
+
+With --sample, a random sample of the pairs is scored; --seed makes it the
+same on every run. Thresholds suit the embedding model the pairs were scored
+with, which the report names.`,
+		Example: `  face calibrate --pairs pairs.csv
+  face calibrate --pairs pairs.csv --target-far 0.001 --output roc.json
+  face calibrate --pairs pairs.csv --sample 2000 --seed 7
+  face calibrate --pairs pairs.csv --write`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sample < 0 {
+				return errors.New("--sample must not be negative")
+			}
+			if targetFAR < 0 || targetFAR > 1 {
+				return errors.New("--target-far must be between 0 and 1")
+			}
+			if !cmd.Flags().Changed("target-far") {
+				targetFAR = -1
+			}
+			return runCalibrate(cfg, pairsPath, targetFAR, sample, output, write)
+		},
+	}
+
+	cmd.Flags().StringVarP(&pairsPath, "pairs", "p", "", "CSV file of image_a,image_b,same rows")
+	cmd.Flags().Float64Var(&targetFAR, "target-far", 0, "recommend the lowest threshold with at most this false accept rate, e.g. 0.001 (default: equal error rate)")
+	cmd.Flags().IntVar(&sample, "sample", 0, "score a random sample of this many pairs (default all)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "JSON file to write the report with the whole curve to")
+	cmd.Flags().BoolVar(&write, "write", false, "store the recommended threshold in the settings")
+	cmd.MarkFlagRequired("pairs")
+
+	return cmd
+}
+
+// runCalibrate scores the pairs and recommends a threshold; a negative
+// targetFAR recommends the equal error threshold
+func runCalibrate(cfg *config.Config, pairsPath string, targetFAR float64, sample int, output string, write bool) error {
+	pairs, err := readCalibrationPairs(pairsPath)
+	if err != nil {
+		return err
+	}
+	report := &calibrationReport{Pairs: len(pairs)}
+	if sample > 0 && sample < len(pairs) {
+		pairs = samplePairs(cfg, pairs, sample)
+		report.Sampled, report.Seed = len(pairs), cfg.Seed
+	}
+	if report.Model, _, err = cfg.Embedding(); err != nil {
+		return err
+	}
+
+	fmt.Println("Initializing face recognition system...")
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	if report.Sampled > 0 {
+		fmt.Printf("Sampled %d of %d pair(s)%s\n", report.Sampled, report.Pairs, seedLabel(report.Seed))
+	}
+	fmt.Printf("Scoring %d pair(s)...\n", len(pairs))
+	scores := scorePairs(fs, filepath.Dir(pairsPath), pairs, report)
+	if err := scores.Check(); err != nil {
+		return fmt.Errorf("%w: %d genuine and %d impostor pair(s) scored", err, report.Genuine, report.Impostor)
+	}
+
+	if err := report.recommend(scores, targetFAR, cfg.DefaultThreshold); err != nil {
+		return err
+	}
+	printCalibration(report)
+
+	if output != "" {
+		if err := writeCalibrationReport(output, report); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Report written to %s\n", output)
+	}
+	if write {
+		return storeThreshold(cfg, fs.DB, report.Recommended.Threshold)
+	}
+	return nil
+}
+
+// readCalibrationPairs reads the pairs of a file
+func readCalibrationPairs(path string) ([]calibrationPair, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pairs file: %w", err)
+	}
+	defer file.Close()
+
+	pairs, err := parseCalibrationPairs(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no pairs in %s", path)
+	}
+	return pairs, nil
+}
+
+// parseCalibrationPairs reads image_a,image_b,same rows, skipping a header
+// row and blank lines
+func parseCalibrationPairs(r io.Reader) ([]calibrationPair, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var pairs []calibrationPair
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid pairs CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(pairs) == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "image_a") {
+			continue
+		}
+
+		pair := calibrationPair{Line: line, ImageA: strings.TrimSpace(record[0]), ImageB: strings.TrimSpace(record[1])}
+		if pair.ImageA == "" || pair.ImageB == "" {
+			return nil, fmt.Errorf("invalid pairs CSV: line %d needs two images", line)
+		}
+		if pair.Same, err = parseSame(record[2]); err != nil {
+			return nil, fmt.Errorf("invalid pairs CSV: line %d: %w", line, err)
+		}
+		pairs = append(pairs, pair)
+	}
+}
+
+// parseSame parses the label of a pair
+func parseSame(label string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "1", "true", "yes", "same", "genuine":
+		return true, nil
+	case "0", "false", "no", "different", "impostor":
+		return false, nil
+	}
+	return false, fmt.Errorf("same must be 1 or 0, true or false, got %q", label)
+}
+
+// samplePairs returns n of the pairs drawn at random, in file order
+func samplePairs(cfg *config.Config, pairs []calibrationPair, n int) []calibrationPair {
+	rng := cfg.Rand("calibrate")
+	sampled := slices.Clone(pairs)
+	rng.Shuffle(len(sampled), func(i, j int) { sampled[i], sampled[j] = sampled[j], sampled[i] })
+	sampled = sampled[:n]
+	slices.SortFunc(sampled, func(a, b calibrationPair) int { return a.Line - b.Line })
+	return sampled
+}
+
+// seedLabel names the seed of a random choice, if one was set
+func seedLabel(seed int64) string {
+	if seed == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" with seed %d", seed)
+}
+
+// scorePairs returns the similarities of the pairs, embedding each image
+// once. Pairs with an image that cannot be embedded are warned about and
+// counted as skipped.
+func scorePairs(fs *FaceSystem, dir string, pairs []calibrationPair, report *calibrationReport) calibration.Scores {
+	embeddings := make(map[string][]float32)
+	failed := make(map[string]bool)
+	embed := func(image string) []float32 {
+		if e, ok := embeddings[image]; ok || failed[image] {
+			return e
+		}
+		path := image
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		result, err := fs.ProcessImage(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", image, err)
+			failed[image] = true
+			return nil
+		}
+		embeddings[image] = result.Embedding
+		return result.Embedding
+	}
+
+	var scores calibration.Scores
+	for _, pair := range pairs {
+		a, b := embed(pair.ImageA), embed(pair.ImageB)
+		if a == nil || b == nil {
+			report.Skipped++
+			continue
+		}
+		similarity := matching.CosineSimilarity(a, b)
+		if pair.Same {
+			scores.Genuine = append(scores.Genuine, similarity)
+		} else {
+			scores.Impostor = append(scores.Impostor, similarity)
+		}
+	}
+	report.Genuine, report.Impostor = len(scores.Genuine), len(scores.Impostor)
+	return scores
+}
+
+// recommend fills in the curve and the recommended threshold, with the
+// error rates of the current one for comparison
+func (r *calibrationReport) recommend(scores calibration.Scores, targetFAR, current float64) error {
+	r.GenuineSimilarity = summarizeConfidences(scores.Genuine)
+	r.ImpostorSimilarity = summarizeConfidences(scores.Impostor)
+	r.AUC = scores.AUC()
+	r.Curve = scores.Curve()
+	r.EqualError = calibration.EqualError(r.Curve)
+	r.EqualErrorRate = (r.EqualError.FAR + r.EqualError.FRR) / 2
+	r.Current = scores.At(current)
+
+	if targetFAR < 0 {
+		r.Criterion, r.Recommended = "eer", r.EqualError
+		return nil
+	}
+	r.Criterion, r.TargetFAR = "target_far", targetFAR
+	point, ok := calibration.AtFAR(r.Curve, targetFAR)
+	if !ok {
+		return fmt.Errorf("no threshold accepts at most %g of the impostor pairs; check the pairs file for mislabeled genuine pairs", targetFAR)
+	}
+	r.Recommended = point
+	return nil
+}
+
+// calibrationTableRows is about how many thresholds of the curve are
+// printed
+const calibrationTableRows = 20
+
+func printCalibration(r *calibrationReport) {
+	fmt.Printf("\n✓ %d genuine and %d impostor pair(s) scored", r.Genuine, r.Impostor)
+	if r.Skipped > 0 {
+		fmt.Printf(", %d skipped", r.Skipped)
+	}
+	fmt.Printf(" with %s\n", r.Model)
+	for _, s := range []struct {
+		kind  string
+		stats *confidenceStats
+	}{{"Genuine", r.GenuineSimilarity}, {"Impostor", r.ImpostorSimilarity}} {
+		fmt.Printf("  %-8s similarity: min %.2f%%, mean %.2f%%, median %.2f%%, max %.2f%%\n",
+			s.kind, s.stats.Min*100, s.stats.Mean*100, s.stats.Median*100, s.stats.Max*100)
+	}
+	fmt.Printf("  AUC: %.4f\n", r.AUC)
+	fmt.Printf("  Equal error rate: %.2f%% at threshold %.3f\n", r.EqualErrorRate*100, r.EqualError.Threshold)
+
+	fmt.Printf("\n%-9s  %8s  %8s\n", "THRESHOLD", "FAR", "FRR")
+	for _, p := range calibrationTable(r.Curve, r.Recommended) {
+		marker := ""
+		if p == r.Recommended {
+			marker = "  ← recommended"
+		}
+		fmt.Printf("%9.3f  %7.2f%%  %7.2f%%%s\n", p.Threshold, p.FAR*100, p.FRR*100, marker)
+	}
+
+	criterion := "equal error rate"
+	if r.Criterion == "target_far" {
+		criterion = fmt.Sprintf("lowest with FAR <= %g%%", r.TargetFAR*100)
+	}
+	fmt.Printf("\n• Recommended threshold: %.3f (%s): FAR %.2f%%, FRR %.2f%%\n",
+		r.Recommended.Threshold, criterion, r.Recommended.FAR*100, r.Recommended.FRR*100)
+	fmt.Printf("  Current threshold:     %.3f: FAR %.2f%%, FRR %.2f%%\n", r.Current.Threshold, r.Current.FAR*100, r.Current.FRR*100)
+}
+
+// calibrationTable returns the points of a curve worth printing: evenly
+// spaced ones from the last threshold accepting every impostor to the first
+// rejecting every genuine pair, where the rates change, and the recommended
+// one
+func calibrationTable(curve []calibration.Point, recommended calibration.Point) []calibration.Point {
+	lo, hi := 0, len(curve)-1
+	for lo < hi && curve[lo+1].FAR == 1 {
+		lo++
+	}
+	for hi > lo && curve[hi-1].FRR == 1 {
+		hi--
+	}
+	step := max(1, (hi-lo)/calibrationTableRows)
+
+	var rows []calibration.Point
+	for i := lo; i <= hi; i++ {
+		if (i-lo)%step == 0 || i == hi || curve[i] == recommended {
+			rows = append(rows, curve[i])
+		}
+	}
+	return rows
+}
+
+func writeCalibrationReport(output string, report *calibrationReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format JSON: %w", err)
+	}
+	if err := compression.WriteFile(output, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// storeThreshold stores a match threshold in the settings
+func storeThreshold(cfg *config.Config, db database.Database, threshold float64) error {
+	settings, err := db.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	previous := settings.MatchThreshold
+	settings.MatchThreshold = threshold
+	if err := db.UpdateSettings(settings); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Stored match threshold %.3f (was %.3f)\n", threshold, previous)
+	if threshold != cfg.DefaultThreshold {
+		fmt.Printf("  Commands match at %.3f: set default_threshold in the config file (FACE_CLI_THRESHOLD) to use it\n", cfg.DefaultThreshold)
+	}
+	return nil
+}
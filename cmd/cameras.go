@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"face/config"
+	"face/internal/deadline"
+	"face/internal/onvif"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCamerasCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cameras",
+		Short: "ONVIF camera commands",
+		Long: `Find ONVIF cameras on the local network and take snapshots from them.
+
+Cameras are configured by name in the config file, with the device service
+address printed by 'face cameras discover':
+
+  "cameras": {
+    "front-door": {
+      "onvif": "http://192.168.1.20/onvif/device_service",
+      "username": "admin",
+      "password": "secret"
+    }
+  }
+
+'face identify --camera front-door' then identifies whoever is in front of
+the camera, without an image file or hand-crafted snapshot URL.`,
+	}
+
+	cmd.AddCommand(newCamerasDiscoverCmd())
+	cmd.AddCommand(newCamerasListCmd(cfg))
+	cmd.AddCommand(newCamerasShowCmd(cfg))
+	cmd.AddCommand(newCamerasSnapshotCmd(cfg))
+
+	return cmd
+}
+
+func newCamerasDiscoverCmd() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "discover",
+		Short: "Find ONVIF cameras on the local network",
+		Long: `Send a WS-Discovery probe to the local network and list the ONVIF cameras
+that answer. Discovery uses multicast, so it only finds cameras on the same
+network segment.`,
+		Example: `  face cameras discover
+  face cameras discover --timeout 10s`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCamerasDiscover(timeout)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 3*time.Second, "how long to wait for answers")
+
+	return cmd
+}
+
+func runCamerasDiscover(timeout time.Duration) error {
+	fmt.Printf("Searching for ONVIF cameras for %s...\n", timeout)
+
+	devices, err := onvif.Discover(timeout)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		fmt.Println("\n✗ No cameras found")
+		return nil
+	}
+
+	fmt.Printf("\n✓ Found %d camera(s):\n", len(devices))
+	for _, d := range devices {
+		fmt.Printf("\n  %s\n", d.Address)
+		if d.Name != "" {
+			fmt.Printf("    Name:     %s\n", d.Name)
+		}
+		if d.Hardware != "" {
+			fmt.Printf("    Hardware: %s\n", d.Hardware)
+		}
+		if d.Location != "" {
+			fmt.Printf("    Location: %s\n", d.Location)
+		}
+		for _, addr := range d.Addresses[1:] {
+			fmt.Printf("    Also at:  %s\n", addr)
+		}
+	}
+	fmt.Println("\nAdd a camera to \"cameras\" in the config file with its address as \"onvif\".")
+	return nil
+}
+
+func newCamerasListCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the configured cameras",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(cfg.Cameras) == 0 {
+				fmt.Println("No cameras configured. Find some with 'face cameras discover'.")
+				return nil
+			}
+
+			names := make([]string, 0, len(cfg.Cameras))
+			for name := range cfg.Cameras {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				camera := cfg.Cameras[name]
+				fmt.Printf("%-20s %s\n", name, camera.Address)
+			}
+			return nil
+		},
+	}
+}
+
+func newCamerasShowCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <camera>",
+		Short: "Show the profiles and snapshot and stream URLs of a camera",
+		Long: `Ask a configured camera for its media profiles and the snapshot and RTSP
+stream URLs of the selected profile ("profile" in the camera's config, the
+first profile by default).`,
+		Example: `  face cameras show front-door`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCamerasShow(cfg, args[0])
+		},
+	}
+}
+
+func runCamerasShow(cfg *config.Config, name string) error {
+	client, err := cameraClient(cfg, name)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := client.Profiles()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s\n", name)
+	fmt.Printf("  Address:    %s\n", cfg.Cameras[name].Address)
+	fmt.Println("  Profiles:")
+	for _, p := range profiles {
+		fmt.Printf("    %-20s %s\n", p.Token, p.Name)
+	}
+
+	if uri, err := client.SnapshotURI(); err != nil {
+		fmt.Printf("  Snapshot:   ✗ %v\n", err)
+	} else {
+		fmt.Printf("  Snapshot:   %s\n", uri)
+	}
+	if uri, err := client.StreamURI(); err != nil {
+		fmt.Printf("  Stream:     ✗ %v\n", err)
+	} else {
+		fmt.Printf("  Stream:     %s\n", uri)
+	}
+	return nil
+}
+
+func newCamerasSnapshotCmd(cfg *config.Config) *cobra.Command {
+	var out string
+
+	cmd := &cobra.Command{
+		Use:     "snapshot <camera>",
+		Short:   "Save a snapshot of a camera",
+		Example: `  face cameras snapshot front-door --out door.jpg`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := cameraClient(cfg, args[0])
+			if err != nil {
+				return err
+			}
+			data, err := client.Snapshot()
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(out, data, 0o644); err != nil {
+				return fmt.Errorf("failed to write snapshot: %w", err)
+			}
+			fmt.Printf("✓ Snapshot saved to %s\n", out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "file to save the snapshot to (required)")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+// cameraClient returns a client for a configured camera
+func cameraClient(cfg *config.Config, name string) (*onvif.Client, error) {
+	camera, ok := cfg.Cameras[name]
+	if !ok {
+		return nil, fmt.Errorf("camera %q is not configured, see 'face cameras --help'", name)
+	}
+	return onvif.NewClient(camera)
+}
+
+// processCameraSnapshot takes a snapshot from a configured camera and
+// detects the face in it
+func processCameraSnapshot(cfg *config.Config, fs *FaceSystem, name string) (*FaceResult, error) {
+	client, err := cameraClient(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := deadline.Do(fs.ctx, "camera snapshot", client.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := storage.DecodeInputImage(bytes.NewReader(data), fs.ImageLimits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	return fs.ProcessDecodedImage(img)
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+
+	"github.com/spf13/cobra"
+)
+
+// cdcGapTimeout is how long a gap in change sequence numbers is waited for
+// while following. Concurrent PostgreSQL transactions can commit out of
+// sequence order, so a gap may be a change that is about to appear; one
+// that stays open that long was rolled back.
+const cdcGapTimeout = 5 * time.Second
+
+func NewCDCCmd(cfg *config.Config) *cobra.Command {
+	var (
+		since    int64
+		follow   bool
+		interval time.Duration
+		batch    int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "cdc",
+		Short: "Stream changes to users and faces",
+		Long: `Print the create, update and delete events for users and faces recorded in
+the change log, oldest first, one JSON object per line. Each event has a
+sequence number; pass the last one seen to --since to resume.
+
+Events of users and faces that still exist carry their current state in
+"data". Soft-deleting a user is reported as its deletion. With --follow,
+new events are printed as they are recorded.
+
+The change log needs the sqlite or postgres database.`,
+		Example: `  face cdc
+  face cdc --follow
+  face cdc --since 1042 --follow --interval 500ms`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if batch <= 0 {
+				return fmt.Errorf("--batch must be positive")
+			}
+			return runCDC(cfg, since, follow, interval, batch)
+		},
+	}
+
+	cmd.Flags().Int64Var(&since, "since", 0, "only print events after this sequence number")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing new events")
+	cmd.Flags().DurationVar(&interval, "interval", time.Second, "how often to check for new events with --follow")
+	cmd.Flags().IntVar(&batch, "batch", 500, "maximum number of events read at once")
+
+	return cmd
+}
+
+// cdcEvent is one line of 'face cdc' output
+type cdcEvent struct {
+	models.Change
+	Data interface{} `json:"data,omitempty"`
+}
+
+func runCDC(cfg *config.Config, since int64, follow bool, interval time.Duration, batch int) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	changeLog, ok := db.(database.ChangeLog)
+	if !ok {
+		return database.ErrChangeLogUnsupported
+	}
+
+	follower := &cdcFollower{changes: changeLog, last: since}
+	for {
+		changes, err := follower.next(batch, follow)
+		if err != nil {
+			return err
+		}
+
+		for i := range changes {
+			line, err := json.Marshal(cdcEvent{Change: changes[i], Data: changeData(db, &changes[i])})
+			if err != nil {
+				return fmt.Errorf("failed to format JSON: %w", err)
+			}
+			fmt.Println(string(line))
+		}
+
+		if len(changes) == batch {
+			continue
+		}
+		if !follow {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// changeData returns the current state of the changed user or face, or nil
+// if it no longer exists
+func changeData(db database.Database, c *models.Change) interface{} {
+	if c.Op == models.ChangeDelete {
+		return nil
+	}
+
+	user, err := db.GetUser(c.UserID)
+	if err != nil {
+		return nil
+	}
+
+	if c.Entity == models.ChangeEntityUser {
+		// Faces have events of their own
+		user.Faces = nil
+		user.ClearSecrets()
+		return user
+	}
+	for i := range user.Faces {
+		if user.Faces[i].ID == c.EntityID {
+			return &user.Faces[i]
+		}
+	}
+	return nil
+}
+
+// cdcFollower reads the change log in sequence order
+type cdcFollower struct {
+	changes database.ChangeLog
+	last    int64
+	// gapSince is when the gap after last was first seen, zero if none
+	gapSince time.Time
+}
+
+// next returns the changes after the last one returned. When following,
+// changes after a gap in sequence numbers are held back until the gap is
+// filled or cdcGapTimeout has passed.
+func (f *cdcFollower) next(limit int, follow bool) ([]models.Change, error) {
+	changes, err := f.changes.ChangesSince(f.last, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if follow {
+		changes = f.settled(changes)
+	}
+	if len(changes) > 0 {
+		f.last = changes[len(changes)-1].Seq
+	}
+	return changes, nil
+}
+
+// settled returns the leading changes that follow on without an open gap
+func (f *cdcFollower) settled(changes []models.Change) []models.Change {
+	expected := f.last + 1
+	for i, c := range changes {
+		if c.Seq != expected {
+			if i > 0 {
+				return changes[:i]
+			}
+			if f.gapSince.IsZero() {
+				f.gapSince = time.Now()
+			}
+			if time.Since(f.gapSince) < cdcGapTimeout {
+				return nil
+			}
+		}
+		f.gapSince = time.Time{}
+		expected = c.Seq + 1
+	}
+	return changes
+}
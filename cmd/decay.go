@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/matching"
+)
+
+// decayCandidates is how many users more than wanted are rescored with the
+// confidence decay, as it can move users whose faces are old below others
+const decayCandidates = 5
+
+// decayedIdentifier discounts the matches of an identifier by the age of
+// the faces they matched, with the confidence decay of the config
+type decayedIdentifier struct {
+	identifier
+	db    database.Database
+	decay matching.Decay
+}
+
+// withDecay returns id discounting old faces with decay, or id itself if
+// decay is disabled
+func withDecay(id identifier, db database.Database, decay matching.Decay) identifier {
+	if !decay.Enabled() {
+		return id
+	}
+	return &decayedIdentifier{identifier: id, db: db, decay: decay}
+}
+
+// FindBestMatches returns up to n users with a face most similar to the
+// embedding after the decay, most similar first
+func (d *decayedIdentifier) FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error) {
+	matches, err := d.identifier.FindBestMatches(embedding, n+decayCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range matches {
+		if err := d.rescore(&matches[i], embedding, now); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Confidence > matches[j].Confidence })
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches, nil
+}
+
+// Match returns the user with the face most similar to the embedding after
+// the decay, or models.ErrNoMatch if none is at least threshold similar
+func (d *decayedIdentifier) Match(embedding []float32, threshold float64) (*models.MatchResult, error) {
+	matches, err := d.FindBestMatches(embedding, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bestMatch(matches, threshold)
+}
+
+// rescore sets the confidence of a match to the decayed similarity of the
+// user's best face, loading the user if the match came without their faces
+func (d *decayedIdentifier) rescore(match *models.MatchResult, embedding []float32, now time.Time) error {
+	if err := loadMatchedUser(d.db, match); err != nil {
+		return err
+	}
+	match.Confidence, match.FaceID = decayedBest(d.decay, embedding, match.User.Faces, now)
+	return nil
+}
+
+// loadMatchedUser loads the user of a match that came without their faces
+func loadMatchedUser(db database.Database, match *models.MatchResult) error {
+	if match.User != nil && len(match.User.Faces) > 0 {
+		return nil
+	}
+	user, err := db.GetUser(match.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load matched user: %w", err)
+	}
+	match.User = user
+	return nil
+}
+
+// decayedBest returns the similarity of the face closest to the probe once
+// each is discounted by its age, with the ID of that face; -1 and no ID if
+// there are no faces
+func decayedBest(decay matching.Decay, probe []float32, faces []models.Face, now time.Time) (float64, string) {
+	best, faceID := -1.0, ""
+	for _, f := range faces {
+		similarity := decay.Apply(matching.CosineSimilarity(probe, f.Embedding), now.Sub(f.EnrolledAt))
+		if similarity > best {
+			best, faceID = similarity, f.ID
+		}
+	}
+	return best, faceID
+}
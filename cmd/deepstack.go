@@ -0,0 +1,359 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/database/models"
+	"face/internal/deadline"
+	"face/internal/redaction"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// deepStackUnknown is the userid DeepStack reports for unrecognized faces
+const deepStackUnknown = "unknown"
+
+func NewDeepStackCmd(cfg *config.Config) *cobra.Command {
+	var listen string
+
+	cmd := &cobra.Command{
+		Use:   "deepstack",
+		Short: "Serve a DeepStack-compatible face recognition API",
+		Long: `Serve the face endpoints of the DeepStack API, so integrations written for
+DeepStack (Frigate add-ons, Blue Iris, Home Assistant, Double Take) can use
+this database without changes:
+
+  POST /v1/vision/face/register   form fields userid and image files
+  POST /v1/vision/face/recognize  form fields image and min_confidence
+  POST /v1/vision/face/list
+  POST /v1/vision/face/delete     form field userid
+
+DeepStack identifies users by a name, the userid. Registering a name that is
+already enrolled adds the faces to the oldest user with that name. Only the
+largest face of an image is recognized.
+
+When deepstack_api_key is set in the config (or FACE_CLI_DEEPSTACK_API_KEY),
+requests must send it in the api_key form field.`,
+		Example: `  face deepstack --listen :5000
+  curl -F userid="Jane Smith" -F image1=@jane.jpg localhost:5000/v1/vision/face/register
+  curl -F image=@snapshot.jpg localhost:5000/v1/vision/face/recognize`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDeepStack(cfg, listen)
+		},
+	}
+
+	cmd.Flags().StringVar(&listen, "listen", ":5000", "address to listen on")
+
+	return cmd
+}
+
+func runDeepStack(cfg *config.Config, listen string) error {
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	index, err := loadFaceIndex(cfg, fs.DB)
+	if err != nil {
+		return fmt.Errorf("failed to build face index: %w", err)
+	}
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           (&deepStackServer{cfg: cfg, fs: fs, redactor: redactor, index: index, busy: make(chan struct{}, 1)}).routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if cfg.DeepStackAPIKey == "" {
+		fmt.Println("⚠ Warning: deepstack_api_key is not set, anyone who can reach the server can use it")
+	}
+	warnUnaudited(cfg)
+	fmt.Printf("✓ DeepStack API listening on %s\n", listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+// deepStackServer implements the DeepStack face endpoints
+type deepStackServer struct {
+	cfg *config.Config
+	fs  *FaceSystem
+	// redactor names recognized users by the configured redaction level
+	redactor *redaction.Redactor
+	// index identifies faces when ann_index is set, nil otherwise
+	index *faceIndex
+
+	// busy holds a token while a request runs, serializing requests since
+	// the detector and extractor are not safe for concurrent use
+	busy chan struct{}
+}
+
+// deepStackHandler handles a request with a parsed form using the face
+// system bound to its deadline, returning the fields of the response
+// besides success and duration
+type deepStackHandler func(r *http.Request, fs *FaceSystem) (map[string]any, error)
+
+func (s *deepStackServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/vision/face/register", s.handle(s.register))
+	mux.HandleFunc("POST /v1/vision/face/recognize", s.handle(s.recognize))
+	mux.HandleFunc("POST /v1/vision/face/list", s.handle(s.list))
+	mux.HandleFunc("POST /v1/vision/face/delete", s.handle(s.delete))
+	return mux
+}
+
+// handle parses the form, checks the API key and writes the response in
+// the DeepStack format
+func (s *deepStackServer) handle(h deepStackHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		r.Body = http.MaxBytesReader(w, r.Body, uploadMaxRequest)
+
+		var (
+			resp map[string]any
+			err  error
+		)
+		if err = r.ParseMultipartForm(uploadFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+			err = badRequest("invalid form: %v", err)
+		} else if key := s.cfg.DeepStackAPIKey; key != "" && subtle.ConstantTimeCompare([]byte(r.FormValue("api_key")), []byte(key)) != 1 {
+			writeDeepStack(w, http.StatusUnauthorized, map[string]any{"success": false, "error": "Incorrect api key"})
+			return
+		} else {
+			resp, err = s.serve(r, h)
+		}
+		if r.MultipartForm != nil {
+			_ = r.MultipartForm.RemoveAll()
+		}
+
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusBadRequest
+			switch apierror.From(err).Code {
+			case apierror.CodeInternal:
+				status = http.StatusInternalServerError
+				slog.Error("deepstack request failed", "path", r.URL.Path, "error", err)
+			case apierror.CodeTimeout:
+				status = http.StatusGatewayTimeout
+			}
+			resp = map[string]any{"error": err.Error()}
+		}
+		resp["success"] = err == nil
+		resp["duration"] = time.Since(started).Milliseconds()
+		writeDeepStack(w, status, resp)
+	}
+}
+
+// serve runs a handler alone, within the configured request timeout. The
+// next request waits for any stage the handler abandoned at the deadline,
+// since the detector and extractor are not safe for concurrent use.
+func (s *deepStackServer) serve(r *http.Request, h deepStackHandler) (map[string]any, error) {
+	ctx, cancel := deadline.WithTimeout(r.Context(), s.cfg.RequestTimeout())
+	defer cancel()
+
+	select {
+	case s.busy <- struct{}{}:
+	case <-ctx.Done():
+		return nil, deadline.Err(ctx, "the wait for the detector")
+	}
+	fs := s.fs.WithContext(ctx)
+	resp, err := h(r.WithContext(ctx), fs)
+	if ctx.Err() == nil {
+		<-s.busy
+	} else {
+		go func() {
+			s.fs.stages.Wait()
+			<-s.busy
+		}()
+	}
+	return resp, err
+}
+
+func writeDeepStack(w http.ResponseWriter, status int, resp map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// register enrolls the uploaded images as faces of the user named userid,
+// creating the user if there is none
+func (s *deepStackServer) register(r *http.Request, fs *FaceSystem) (_ map[string]any, err error) {
+	audit := models.AuditEvent{Operation: models.AuditEnroll}
+	defer func() { s.audit(audit, err) }()
+
+	name := r.FormValue("userid")
+	if name == "" {
+		return nil, badRequest("userid not specified")
+	}
+	if r.MultipartForm == nil || len(r.MultipartForm.File) == 0 {
+		return nil, badRequest("no image specified")
+	}
+
+	users, err := fs.DB.ListUsersByName(name)
+	if err != nil {
+		return nil, err
+	}
+	user := &models.User{ID: uuid.New().String(), Name: name}
+	exists := len(users) > 0
+	if exists {
+		user = &users[0]
+	}
+	audit.UserID = user.ID
+
+	faces, err := saveUploadedFaces(fs, user.ID, formImages(r.MultipartForm))
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		err = addFaces(fs, user.ID, faces)
+	} else {
+		user.Faces = faces
+		err = fs.DB.CreateUser(user)
+	}
+	if err != nil {
+		discardFaces(fs, faces)
+		return nil, err
+	}
+	s.index.refresh(user.ID)
+	refreshAvatar(fs.DB, fs.Storage, user.ID)
+
+	slog.Info("deepstack face registered", "user_id", user.ID, "faces", len(faces))
+	return map[string]any{"message": "face added"}, nil
+}
+
+// recognize identifies the largest face of the uploaded image
+func (s *deepStackServer) recognize(r *http.Request, fs *FaceSystem) (_ map[string]any, err error) {
+	audit := models.AuditEvent{Operation: models.AuditIdentify, Result: models.AuditNoMatch}
+	defer func() { s.audit(audit, err) }()
+
+	// DeepStack keys have no roles, so like the clients of serve without
+	// an admin key, a client may raise the threshold but not lower it
+	threshold := s.cfg.DefaultThreshold
+	if v := r.FormValue("min_confidence"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 1 {
+			return nil, badRequest("min_confidence must be between 0 and 1")
+		}
+		threshold = max(t, threshold)
+	}
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, badRequest("no image specified")
+	}
+	defer file.Close()
+
+	predictions := []map[string]any{}
+	result, err := processUpload(fs, file)
+	if errors.Is(err, models.ErrFaceNotDetected) {
+		audit.Result, audit.Error = models.AuditFailed, string(apierror.CodeFaceNotDetected)
+		return map[string]any{"predictions": predictions}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userID, confidence := deepStackUnknown, 0.0
+	match, err := s.index.identifier(fs.DB, fs.Decay, fs.Strategy, s.cfg.Device).Match(result.Embedding, threshold)
+	switch {
+	case err == nil:
+		userID, confidence = s.redactor.Label(match.User), match.Confidence
+		audit.Result, audit.UserID, audit.Confidence = models.AuditSucceeded, match.UserID, match.Confidence
+	case !errors.Is(err, models.ErrNoMatch):
+		return nil, fmt.Errorf("matching failed: %w", err)
+	}
+
+	predictions = append(predictions, map[string]any{
+		"userid":     userID,
+		"confidence": confidence,
+		"x_min":      result.Box.Min.X,
+		"y_min":      result.Box.Min.Y,
+		"x_max":      result.Box.Max.X,
+		"y_max":      result.Box.Max.Y,
+	})
+	slog.Info("deepstack recognition", "matched", userID != deepStackUnknown, "confidence", confidence)
+	return map[string]any{"predictions": predictions}, nil
+}
+
+// list returns the names of the enrolled users of the device's scope, as
+// the configured redaction level shows them
+func (s *deepStackServer) list(r *http.Request, fs *FaceSystem) (map[string]any, error) {
+	users, err := fs.DB.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	names := []string{}
+	seen := make(map[string]bool)
+	for i := range users {
+		if !users[i].InScope(s.cfg.Device) {
+			continue
+		}
+		if name := s.redactor.Label(&users[i]); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return map[string]any{"faces": names}, nil
+}
+
+// delete removes every user named userid
+func (s *deepStackServer) delete(r *http.Request, fs *FaceSystem) (map[string]any, error) {
+	name := r.FormValue("userid")
+	if name == "" {
+		return nil, badRequest("userid not specified")
+	}
+
+	users, err := fs.DB.ListUsersByName(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		err := s.deleteUser(fs, &users[i])
+		s.audit(models.AuditEvent{Operation: models.AuditDelete, UserID: users[i].ID}, err)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("deepstack user deleted", "user_id", users[i].ID)
+	}
+	return map[string]any{}, nil
+}
+
+// deleteUser deletes a user with their images
+func (s *deepStackServer) deleteUser(fs *FaceSystem, user *models.User) error {
+	if err := fs.DB.SoftDeleteUser(user.ID); err != nil {
+		return fmt.Errorf("failed to mark user deleted: %w", err)
+	}
+	s.index.refresh(user.ID)
+	return finalizeUserDeletion(s.fs.DB, s.fs.Storage, user)
+}
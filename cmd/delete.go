@@ -3,88 +3,170 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
 
 	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
 	"face/internal/storage"
+	"face/internal/undo"
 
 	"github.com/spf13/cobra"
 )
 
 func NewDeleteCmd(cfg *config.Config) *cobra.Command {
 	var (
-		userID  string
-		confirm bool
+		selection userSelection
+		confirm   bool
 	)
 
 	cmd := &cobra.Command{
-		Use:   "delete",
-		Short: "Delete a user from the system",
-		Long:  `Delete a user and all their associated face images from the system.`,
+		Use:         "delete",
+		Short:       "Delete a user from the system",
+		Annotations: recordAlways(),
+		Long: `Delete a user from the system. The user is hidden at once and can be
+restored with 'face undo' within the undo window (undo_window_minutes,
+default 10). Their faces and face images are kept until then. They are
+removed for good by the next 'face delete' or 'face update', which cannot
+be undone together with this one, or once the window has passed by 'face
+prune' or 'face doctor --fix'. 'face purge' erases a user at once.
+
+With --user-name, if several users have the name, pick one from a list, or
+use --select-first or --all in scripts.`,
 		Example: `  face delete --id abc-123
-  face delete --id abc-123 --confirm`,
+  face delete --id abc-123 --confirm
+  face delete --user-name "John Doe"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDelete(cfg, userID, confirm)
+			return runDelete(cfg, selection, confirm)
 		},
 	}
 
-	cmd.Flags().StringVar(&userID, "id", "", "user ID to delete (required)")
+	cmd.Flags().StringVar(&selection.ID, "id", "", "user ID or unique prefix to delete")
 	cmd.Flags().BoolVarP(&confirm, "confirm", "y", false, "skip confirmation prompt")
-
-	_ = cmd.MarkFlagRequired("id")
+	selection.addNameFlags(cmd, "id", true)
 
 	return cmd
 }
 
-func runDelete(cfg *config.Config, userID string, confirm bool) error {
-	db, err := cfg.GetDatabaseConnection()
+func runDelete(cfg *config.Config, selection userSelection, confirm bool) error {
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer db.Close()
 
-	stor, err := storage.NewFileSystemStorage(cfg.FacesDir)
+	stor, err := cfg.GetStorage(db)
 	if err != nil {
 		return fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
-	user, err := db.GetUser(userID)
+	users, err := selectUsers(db, selection)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return err
 	}
 
-	fmt.Printf("\nUser to delete:\n")
-	fmt.Printf("  ID:    %s\n", user.ID)
-	fmt.Printf("  Name:  %s\n", user.Name)
-	fmt.Printf("  Faces: %d\n", len(user.Faces))
+	for i := range users {
+		fmt.Printf("\nUser to delete:\n")
+		fmt.Printf("  ID:    %s\n", users[i].ID)
+		fmt.Printf("  Name:  %s\n", users[i].Name)
+		fmt.Printf("  Faces: %d\n", len(users[i].Faces))
+	}
 
 	if !confirm {
-		fmt.Print("\nAre you sure you want to delete this user? (yes/no): ")
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf("failed to read input: %w", err)
+		question := "this user"
+		if len(users) > 1 {
+			question = fmt.Sprintf("these %d users", len(users))
+		}
+		if ok, err := confirmDeletion(question); !ok || err != nil {
+			return err
+		}
+	}
+
+	return deleteUsers(cfg, db, stor, users)
+}
+
+// confirmDeletion asks whether to delete what the question names
+func confirmDeletion(question string) (bool, error) {
+	fmt.Printf("\nAre you sure you want to delete %s? (yes/no): ", question)
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	response = strings.TrimSpace(strings.ToLower(response))
+	if response != "yes" && response != "y" {
+		fmt.Println("Deletion canceled.")
+		return false, nil
+	}
+	return true, nil
+}
+
+// deleteUsers hides users and finishes their deletion once it can no
+// longer be undone. Users deleted together are undone together, as only
+// the last operation is remembered for undo.
+func deleteUsers(cfg *config.Config, db database.Database, stor storage.Storage, users []models.User) (err error) {
+	audits := make([]*auditRecord, len(users))
+	for i := range users {
+		audits[i] = startAudit(cfg, db, models.AuditDelete, users[i].ID)
+	}
+	defer func() {
+		for _, audit := range audits {
+			audit.finish(err)
 		}
+	}()
 
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response != "yes" && response != "y" {
-			fmt.Println("Deletion canceled.")
-			return nil
+	record := &undo.Record{Op: undo.OpDelete, UserID: users[0].ID, UserName: users[0].Name}
+	for i := range users {
+		if err := db.SoftDeleteUser(users[i].ID); err != nil {
+			return fmt.Errorf("failed to mark user %s deleted: %w", users[i].ID, err)
 		}
+		if len(users) > 1 {
+			record.UserIDs = append(record.UserIDs, users[i].ID)
+		}
+	}
+
+	remembered, err := rememberUndo(cfg, db, stor, record)
+	if err != nil {
+		return fmt.Errorf("%w\n  The deleted users are hidden but not fully deleted; run 'face doctor --fix' to resume", err)
+	}
+
+	for i := range users {
+		forgetMQTTPerson(cfg, users[i].ID)
+		slog.Info("user deleted", "user_id", users[i].ID)
+		fmt.Printf("\n✓ User '%s' deleted successfully\n", users[i].Name)
+	}
+	if remembered {
+		restore := "the user"
+		if len(users) > 1 {
+			restore = fmt.Sprintf("all %d users", len(users))
+		}
+		fmt.Printf("  Run 'face undo' before %s to restore %s\n", undoDeadline(cfg), restore)
 	}
 
+	return nil
+}
+
+// finalizeUserDeletion removes the images of a soft-deleted user and then
+// the user row itself. The row is only removed once every image is gone,
+// so an interrupted deletion can be resumed by 'face doctor --fix'.
+func finalizeUserDeletion(db database.Database, stor storage.Storage, user *models.User) error {
 	for _, face := range user.Faces {
 		if err := stor.DeleteImage(face.Filename); err != nil {
-			fmt.Printf("Warning: failed to delete image %s: %v\n", face.Filename, err)
+			return fmt.Errorf("failed to delete image %s: %w", face.Filename, err)
+		}
+	}
+	if user.Avatar != "" {
+		if err := stor.DeleteImage(user.Avatar); err != nil {
+			return fmt.Errorf("failed to delete avatar %s: %w", user.Avatar, err)
 		}
 	}
 
-	if err := db.DeleteUser(userID); err != nil {
+	if err := db.DeleteUser(user.ID); err != nil {
 		return fmt.Errorf("failed to delete user from database: %w", err)
 	}
 
-	fmt.Printf("\n✓ User '%s' deleted successfully\n", user.Name)
-
 	return nil
 }
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/face"
+	"face/internal/pipeline"
+	"face/internal/samples"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// demoPeople are the synthetic identities enrolled by the demo
+var demoPeople = []struct {
+	Name string
+	Seed int64
+}{
+	{"Alice Demo", 101},
+	{"Bob Demo", 202},
+	{"Carol Demo", 303},
+}
+
+// demoStrangerSeed is a synthetic identity that is never enrolled
+const demoStrangerSeed = 909
+
+func NewDemoCmd(cfg *config.Config) *cobra.Command {
+	var (
+		threshold float64
+		keep      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "demo",
+		Short: "Walk through enroll, identify and verify with sample faces",
+		Long: `Run a guided demo against a temporary JSON database populated with bundled
+synthetic faces. Walks through enrollment, identification and verification,
+explaining each step, so the tool can be evaluated without your own photos.
+
+Synthetic faces are generated already cropped, so the demo feeds them straight
+to the extractor instead of running face detection.`,
+		Example: `  face demo
+  face demo --keep`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDemo(cfg, threshold, keep)
+		},
+	}
+
+	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	cmd.Flags().BoolVar(&keep, "keep", false, "keep the demo database and images instead of deleting them")
+
+	return cmd
+}
+
+func runDemo(cfg *config.Config, threshold float64, keep bool) error {
+	dir, err := os.MkdirTemp("", "face-demo-")
+	if err != nil {
+		return fmt.Errorf("failed to create demo directory: %w", err)
+	}
+	if !keep {
+		defer os.RemoveAll(dir)
+	}
+
+	dbPath := filepath.Join(dir, "demo.json")
+	facesDir := filepath.Join(dir, "faces")
+
+	db, err := database.NewJSONDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stor, err := storage.NewFileSystemStorage(facesDir, storage.LayoutFlat)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	detector, extractor, err := newPipeline(cfg)
+	if err != nil {
+		return err
+	}
+	defer detector.Close()
+	defer extractor.Close()
+
+	matcher := face.NewMatcher(db)
+	identify := func(embedding []float32) error {
+		matches, err := matcher.FindBestMatches(embedding, 3)
+		if err != nil {
+			return fmt.Errorf("failed to find matches: %w", err)
+		}
+		for i, match := range matches {
+			fmt.Printf("    %d. %s (%.2f%%)\n", i+1, match.User.Name, match.Confidence*100)
+		}
+
+		match, err := matcher.Match(embedding, threshold)
+		if err != nil {
+			if errors.Is(err, models.ErrNoMatch) {
+				fmt.Printf("  ✗ No match found with confidence >= %.0f%%\n", threshold*100)
+				return nil
+			}
+			return fmt.Errorf("matching failed: %w", err)
+		}
+
+		fmt.Printf("  ✓ Identified as %s (%.2f%%)\n", match.User.Name, match.Confidence*100)
+		return nil
+	}
+
+	fmt.Println("Face recognition demo")
+	fmt.Println("─────────────────────────────────────")
+	fmt.Printf("Using a temporary JSON database in %s\n", dir)
+
+	// Step 1: enrollment
+	fmt.Println("\nStep 1: Enrollment")
+	fmt.Println("  Each person is enrolled from three photos. Every photo is turned into an")
+	fmt.Println("  embedding - a vector describing the face - and stored with the user.")
+
+	users, err := demoEnroll(db, stor, extractor)
+	if err != nil {
+		return err
+	}
+
+	// Step 2: identification of an enrolled person
+	probeName := demoPeople[1].Name
+	fmt.Println("\nStep 2: Identification (1:N)")
+	fmt.Printf("  A new photo of %s, never seen during enrollment, is compared against\n", probeName)
+	fmt.Println("  every enrolled face. The closest user above the threshold wins.")
+
+	probe, err := extractor.Extract(samples.NewPerson(demoPeople[1].Seed).Render(samples.DefaultSize, 7))
+	if err != nil {
+		return fmt.Errorf("failed to extract embedding: %w", err)
+	}
+	if err := identify(probe); err != nil {
+		return err
+	}
+
+	// Step 3: identification of a stranger
+	fmt.Println("\nStep 3: Identification of a stranger")
+	fmt.Println("  Now a person who was never enrolled. A good threshold rejects them.")
+
+	stranger, err := extractor.Extract(samples.Face(demoStrangerSeed))
+	if err != nil {
+		return fmt.Errorf("failed to extract embedding: %w", err)
+	}
+	if err := identify(stranger); err != nil {
+		return err
+	}
+
+	// Step 4: verification
+	fmt.Println("\nStep 4: Verification (1:1)")
+	fmt.Printf("  The photo of %s is checked against one specific user at a time.\n", probeName)
+	for _, name := range []string{probeName, demoPeople[0].Name} {
+		if err := demoVerify(matcher.Verify, users[name], probe, threshold); err != nil {
+			return err
+		}
+	}
+
+	demoSummary(threshold, keep, dbPath, facesDir)
+	return nil
+}
+
+// demoEnroll enrolls every demo person from three synthetic photos
+func demoEnroll(db database.Database, stor storage.Storage, extractor pipeline.Extractor) (map[string]*models.User, error) {
+	users := make(map[string]*models.User, len(demoPeople))
+	for _, p := range demoPeople {
+		person := samples.NewPerson(p.Seed)
+		user := &models.User{ID: uuid.New().String(), Name: p.Name}
+
+		for variation := 0; variation < 3; variation++ {
+			img := person.Render(samples.DefaultSize, variation)
+			embedding, err := extractor.Extract(img)
+			if err != nil {
+				return nil, fmt.Errorf("failed to extract embedding: %w", err)
+			}
+
+			faceID := uuid.New().String()
+			filename, err := stor.SaveImage(user.ID, faceID, img)
+			if err != nil {
+				return nil, fmt.Errorf("failed to save image: %w", err)
+			}
+
+			user.Faces = append(user.Faces, models.Face{
+				ID:           faceID,
+				Filename:     filename,
+				Embedding:    models.Embedding(embedding),
+				QualityScore: 1,
+			})
+		}
+
+		if err := db.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to save user to database: %w", err)
+		}
+		users[p.Name] = user
+		fmt.Printf("  ✓ Enrolled %s with %d faces\n", user.Name, len(user.Faces))
+	}
+
+	return users, nil
+}
+
+// demoVerify checks a probe embedding against one enrolled user
+func demoVerify(verify func(string, []float32, float64) (bool, float64, error), user *models.User, probe []float32, threshold float64) error {
+	matched, confidence, err := verify(user.ID, probe, threshold)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	if matched {
+		fmt.Printf("  ✓ VERIFIED as %s (%.2f%%)\n", user.Name, confidence*100)
+	} else {
+		fmt.Printf("  ✗ NOT VERIFIED as %s (%.2f%%)\n", user.Name, confidence*100)
+	}
+	return nil
+}
+
+// demoSummary explains the threshold and where to go from here
+func demoSummary(threshold float64, keep bool, dbPath, facesDir string) {
+	fmt.Println("\n─────────────────────────────────────")
+	fmt.Printf("Threshold used: %.2f - raise it to reduce false matches, lower it to\n", threshold)
+	fmt.Println("reduce missed matches. Enroll real people with:")
+	fmt.Println("  face enroll --name \"Your Name\" --images \"photo.jpg\"")
+
+	if keep {
+		fmt.Println("\nDemo data kept. Explore it with:")
+		fmt.Printf("  face list --db-type json --db %s --faces-dir %s\n", dbPath, facesDir)
+	}
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"face/config"
+	"face/internal/compression"
+	"face/internal/database"
+	"face/internal/database/models"
+
+	"github.com/spf13/cobra"
+)
+
+func NewDiagCmd(cfg *config.Config) *cobra.Command {
+	var out string
+
+	cmd := &cobra.Command{
+		Use:   "diag",
+		Short: "Write a support bundle for troubleshooting",
+		Long: `Collect diagnostics into a tar archive to attach to a support request:
+
+  - runtime.json:   version, platform and memory statistics
+  - config.json:    the effective configuration, with passwords and the
+                    error reporting DSN redacted
+  - index.json:     user and face counts, embedding dimensions, settings
+                    and how long loading all embeddings takes
+  - goroutines.txt: stack traces of all goroutines
+  - heap.pprof:     heap profile, for 'go tool pprof'
+
+Database problems are recorded in index.json rather than failing the
+command. The archive is compressed if named *.gz or *.zst.`,
+		Example: `  face diag
+  face diag --out support.tar.zst`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if out == "" {
+				out = fmt.Sprintf("face-diag-%s.tar.gz", time.Now().Format("20060102-150405"))
+			}
+			return runDiag(cfg, cmd.Root().Version, out)
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "archive to write (default face-diag-<time>.tar.gz)")
+
+	return cmd
+}
+
+// diagRuntime is runtime.json of a support bundle
+type diagRuntime struct {
+	Version      string    `json:"version"`
+	GoVersion    string    `json:"go_version"`
+	OS           string    `json:"os"`
+	Arch         string    `json:"arch"`
+	CPUs         int       `json:"cpus"`
+	Goroutines   int       `json:"goroutines"`
+	HeapAllocMB  float64   `json:"heap_alloc_mb"`
+	HeapSysMB    float64   `json:"heap_sys_mb"`
+	TotalAllocMB float64   `json:"total_alloc_mb"`
+	NumGC        uint32    `json:"num_gc"`
+	CollectedAt  time.Time `json:"collected_at"`
+}
+
+// diagIndex is index.json of a support bundle
+type diagIndex struct {
+	DatabaseType string `json:"database_type"`
+	Users        int    `json:"users"`
+	DeletedUsers int    `json:"deleted_users"`
+	Faces        int    `json:"faces"`
+	MaxUserFaces int    `json:"max_user_faces"`
+	// Dimensions counts faces by embedding dimension
+	Dimensions     map[int]int      `json:"dimensions"`
+	LoadDurationMS float64          `json:"load_embeddings_ms"`
+	LatestChange   *int64           `json:"latest_change,omitempty"`
+	Settings       *models.Settings `json:"settings,omitempty"`
+	Errors         []string         `json:"errors,omitempty"`
+}
+
+func runDiag(cfg *config.Config, version, out string) error {
+	file, err := compression.Create(out, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer file.Close()
+
+	index := collectDiagIndex(cfg)
+
+	var goroutines, heap bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(&heap); err != nil {
+		return fmt.Errorf("failed to write heap profile: %w", err)
+	}
+
+	archive := tar.NewWriter(file)
+	for _, entry := range []struct {
+		name string
+		data interface{}
+	}{
+		{"runtime.json", collectDiagRuntime(version)},
+		{"config.json", cfg.Redacted()},
+		{"index.json", index},
+		{"goroutines.txt", goroutines.Bytes()},
+		{"heap.pprof", heap.Bytes()},
+	} {
+		if err := addDiagFile(archive, entry.name, entry.data); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	fmt.Printf("✓ Support bundle written to %s\n", out)
+	for _, e := range index.Errors {
+		fmt.Printf("Warning: %s\n", e)
+	}
+	return nil
+}
+
+// addDiagFile adds a file to the archive, encoding data as JSON unless it
+// is already bytes
+func addDiagFile(archive *tar.Writer, name string, data interface{}) error {
+	content, ok := data.([]byte)
+	if !ok {
+		var err error
+		if content, err = json.MarshalIndent(data, "", "  "); err != nil {
+			return fmt.Errorf("failed to format %s: %w", name, err)
+		}
+		content = append(content, '\n')
+	}
+
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := archive.Write(content); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+func collectDiagRuntime(version string) *diagRuntime {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	const mb = 1 << 20
+	return &diagRuntime{
+		Version:      version,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		CPUs:         runtime.NumCPU(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAllocMB:  float64(mem.HeapAlloc) / mb,
+		HeapSysMB:    float64(mem.HeapSys) / mb,
+		TotalAllocMB: float64(mem.TotalAlloc) / mb,
+		NumGC:        mem.NumGC,
+		CollectedAt:  time.Now(),
+	}
+}
+
+// collectDiagIndex gathers database statistics, recording failures in
+// Errors so the rest of the bundle is still written
+func collectDiagIndex(cfg *config.Config) *diagIndex {
+	index := &diagIndex{DatabaseType: string(cfg.DatabaseType), Dimensions: map[int]int{}}
+	fail := func(what string, err error) *diagIndex {
+		index.Errors = append(index.Errors, fmt.Sprintf("failed to %s: %v", what, err))
+		return index
+	}
+
+	db, err := cfg.GetDatabaseConnection()
+	if err != nil {
+		return fail("initialize database", err)
+	}
+	defer db.Close()
+
+	if settings, err := db.GetSettings(); err != nil {
+		fail("load settings", err)
+	} else {
+		index.Settings = settings
+	}
+
+	if deleted, err := db.ListDeletedUsers(); err != nil {
+		fail("list deleted users", err)
+	} else {
+		index.DeletedUsers = len(deleted)
+	}
+
+	if changeLog, ok := db.(database.ChangeLog); ok {
+		if seq, err := changeLog.LatestChange(); err != nil {
+			fail("read change log", err)
+		} else {
+			index.LatestChange = &seq
+		}
+	}
+
+	started := time.Now()
+	embeddings, err := db.GetAllEmbeddings()
+	if err != nil {
+		return fail("load embeddings", err)
+	}
+	index.LoadDurationMS = float64(time.Since(started).Microseconds()) / 1000
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fail("list users", err)
+	}
+	index.Users = len(users)
+
+	for _, faces := range embeddings {
+		index.Faces += len(faces)
+		if len(faces) > index.MaxUserFaces {
+			index.MaxUserFaces = len(faces)
+		}
+		for _, f := range faces {
+			index.Dimensions[len(f.Embedding)]++
+		}
+	}
+	return index
+}
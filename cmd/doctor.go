@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/embedding"
+	"face/internal/provenance"
+	"face/internal/storage"
+	"face/internal/undo"
+
+	"github.com/spf13/cobra"
+)
+
+// doctorEnv holds the resources shared by doctor checks
+type doctorEnv struct {
+	cfg     *config.Config
+	db      database.Database
+	storage storage.Storage
+}
+
+// doctorCheck inspects one aspect of the installation. It returns the
+// number of problems found and how many of them are left unresolved.
+type doctorCheck struct {
+	Name string
+	Run  func(env *doctorEnv, fix bool) (found, unresolved int, err error)
+}
+
+// doctorChecks lists the checks run by 'face doctor', in order
+var doctorChecks = []doctorCheck{
+	{"Schema version", doctorSchema},
+	{"Interrupted deletions", doctorPendingDeletions},
+	{"Cross-user contamination", doctorContamination},
+}
+
+// provenanceCheck verifies the provenance of every stored face image. It
+// reads every image, so it only runs with --verify-provenance.
+var provenanceCheck = doctorCheck{"Provenance", doctorProvenance}
+
+func NewDoctorCmd(cfg *config.Config) *cobra.Command {
+	var fix, verifyProvenance bool
+
+	cmd := &cobra.Command{
+		Use:         "doctor",
+		Short:       "Check the database and storage for problems",
+		Annotations: recordWith("fix"),
+		Long: `Inspect the database and face storage for inconsistencies and optionally
+repair them. Without --fix, problems are only reported.
+
+Checks:
+  - Schema version: a database schema other than this binary's, which other
+    commands refuse to use. --fix applies pending migrations.
+  - Interrupted deletions: users whose deletion started but did not finish
+  - Cross-user contamination: faces whose nearest neighbors mostly belong to
+    another user, i.e. probably enrolled under the wrong user. These are only
+    reported with a suggested owner; --fix does not move them.
+  - Provenance, with --verify-provenance: stored face images whose
+    provenance metadata is missing, does not match the image or belongs to
+    another face, i.e. images replaced or edited after enrollment. These
+    cannot be fixed automatically; re-enroll the faces.`,
+		Example: `  face doctor
+  face doctor --fix
+  face doctor --verify-provenance`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checks := doctorChecks
+			if verifyProvenance {
+				checks = append(slices.Clip(checks), provenanceCheck)
+			}
+			return runDoctor(cfg, checks, fix)
+		},
+	}
+
+	cmd.Flags().BoolVar(&fix, "fix", false, "repair problems that can be fixed automatically")
+	cmd.Flags().BoolVar(&verifyProvenance, "verify-provenance", false, "also check the provenance of every stored face image")
+
+	return cmd
+}
+
+func runDoctor(cfg *config.Config, checks []doctorCheck, fix bool) error {
+	db, err := cfg.GetDatabaseConnection()
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	env := &doctorEnv{cfg: cfg, db: db, storage: stor}
+
+	total := 0
+	for _, check := range checks {
+		fmt.Printf("\n%s\n", check.Name)
+		found, unresolved, err := check.Run(env, fix)
+		if err != nil {
+			return fmt.Errorf("%s check failed: %w", check.Name, err)
+		}
+		if found == 0 {
+			fmt.Println("  ✓ No problems found")
+		}
+		total += unresolved
+	}
+
+	fmt.Println()
+	if total > 0 {
+		if fix {
+			return fmt.Errorf("%d problem(s) could not be fixed", total)
+		}
+		return fmt.Errorf("%d problem(s) found, run with --fix to repair", total)
+	}
+
+	fmt.Println("✓ Everything looks good")
+	return nil
+}
+
+// doctorSchema reports a schema version other than the binary's and
+// applies pending migrations
+func doctorSchema(env *doctorEnv, fix bool) (int, int, error) {
+	if !env.cfg.DatabaseType.UsesMigrations() {
+		return 0, 0, nil
+	}
+
+	migrator, err := env.cfg.GetMigrator()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create migrator: %w", err)
+	}
+	defer migrator.Close()
+
+	var schemaErr *database.SchemaError
+	if err := migrator.CheckSchema(); !errors.As(err, &schemaErr) {
+		return 0, 0, err
+	}
+	fmt.Printf("  • %s\n", schemaErr)
+	if !fix || !schemaErr.Upgradable() {
+		for _, line := range strings.Split(strings.TrimSpace(schemaErr.Remediation()), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		return 1, 1, nil
+	}
+
+	backup, err := upgradeSchema(env.cfg, migrator, schemaErr)
+	if err != nil {
+		return 1, 1, err
+	}
+	if backup != "" {
+		fmt.Printf("    ✓ Backed up the database to %s\n", backup)
+	}
+	fmt.Printf("    ✓ Migrated to version %d\n", schemaErr.Required)
+	return 1, 0, nil
+}
+
+// doctorPendingDeletions finds soft-deleted users and finishes deleting them,
+// except those that can still be undone
+func doctorPendingDeletions(env *doctorEnv, fix bool) (int, int, error) {
+	users, err := env.db.ListDeletedUsers()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	record, err := loadUndo(env.cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	pending, problems := 0, 0
+	for i := range users {
+		user := &users[i]
+		if undoable, ok := undoableUntil(env.cfg, record, user); ok {
+			fmt.Printf("  • %s (%s) deleted %s, can be undone until %s\n",
+				user.Name, user.ID, user.DeletedAt.Format("2006-01-02 15:04:05"), undoable.Format("15:04:05"))
+			continue
+		}
+
+		pending++
+		fmt.Printf("  • %s (%s) deletion started %s, %d image(s) pending\n",
+			user.Name, user.ID, user.DeletedAt.Format("2006-01-02 15:04:05"), len(user.Faces))
+
+		if !fix {
+			problems++
+			continue
+		}
+
+		if err := finalizeUserDeletion(env.db, env.storage, user); err != nil {
+			fmt.Printf("    ✗ %v\n", err)
+			problems++
+			continue
+		}
+		fmt.Println("    ✓ Deletion completed")
+	}
+
+	return pending, problems, nil
+}
+
+// undoableUntil returns until when the deletion of a user can be undone,
+// going by when the user was deleted or, if later, by the undo record of
+// the deletion. It reports false if it can no longer be undone.
+func undoableUntil(cfg *config.Config, record *undo.Record, user *models.User) (time.Time, bool) {
+	window := cfg.UndoWindow()
+	if window == 0 {
+		return time.Time{}, false
+	}
+	undoable := user.DeletedAt.Add(window)
+	if record != nil && record.Op == undo.OpDelete && record.Covers(user.ID) && record.Time.Add(window).After(undoable) {
+		undoable = record.Time.Add(window)
+	}
+	return undoable, time.Now().Before(undoable)
+}
+
+const (
+	// contaminationNeighbors is how many nearest faces are compared
+	contaminationNeighbors = 5
+	// contaminationShare is the share of them that must belong to one
+	// other user for a face to be reported
+	contaminationShare = 0.8
+)
+
+// doctorContamination finds faces that look like another user's faces. They
+// cannot be repaired automatically since the heuristic may be wrong, e.g.
+// for twins.
+func doctorContamination(env *doctorEnv, _ bool) (int, int, error) {
+	users, err := env.db.ListUsers()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	faces := make(map[string][]models.Face, len(users))
+	names := make(map[string]string, len(users))
+	for i := range users {
+		faces[users[i].ID] = users[i].Faces
+		names[users[i].ID] = users[i].Name
+	}
+
+	suspects := embedding.FindContamination(faces, contaminationNeighbors, contaminationShare)
+	for _, c := range suspects {
+		fmt.Printf("  • Face %s of %s (%s) looks like %s (%s): %d of %d nearest faces, confidence %.2f\n",
+			c.FaceID, names[c.UserID], c.UserID, names[c.SuggestedUserID], c.SuggestedUserID, c.Votes, c.Neighbors, c.Confidence)
+	}
+
+	if len(suspects) > 0 {
+		fmt.Println("    Review with 'face embedding inspect --face-id <id>' and remove wrong faces")
+		fmt.Println("    with 'face update --id <user> --remove-face <id>'")
+	}
+
+	return len(suspects), len(suspects), nil
+}
+
+// doctorProvenance checks that every stored face image still carries the
+// provenance it was stored with. Images stored before provenance was
+// enabled are reported too, since a replaced image looks the same.
+func doctorProvenance(env *doctorEnv, _ bool) (int, int, error) {
+	stamper, err := env.cfg.ProvenanceStamper()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	users, err := env.db.ListUsers()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	checked, problems, missing := 0, 0, 0
+	for i := range users {
+		user := &users[i]
+		for _, f := range user.Faces {
+			checked++
+			err := verifyFaceProvenance(env.storage, stamper, user, &f)
+			if err == nil {
+				continue
+			}
+			problems++
+			if errors.Is(err, provenance.ErrMissing) {
+				missing++
+			}
+			fmt.Printf("  • Face %s of %s (%s): %v\n", f.ID, user.Name, user.ID, err)
+		}
+	}
+
+	if missing > 0 {
+		fmt.Printf("    %d image(s) have no provenance; images stored before provenance was enabled\n", missing)
+		fmt.Println("    have none either, re-enroll the faces to add it")
+	}
+	if problems == 0 && checked > 0 {
+		fmt.Printf("  • %d image(s) verified\n", checked)
+	}
+	return problems, problems, nil
+}
+
+// verifyFaceProvenance checks the provenance of one stored face image
+func verifyFaceProvenance(stor storage.Storage, stamper *provenance.Stamper, user *models.User, f *models.Face) error {
+	data, err := stor.LoadData(f.Filename)
+	if err != nil {
+		return err
+	}
+
+	record, err := stamper.Verify(data, f.ID)
+	if err != nil {
+		return err
+	}
+	if record.UserID != user.ID {
+		return fmt.Errorf("%w: it was stored for user %s", provenance.ErrTampered, record.UserID)
+	}
+	return nil
+}
@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"face/config"
+	"face/internal/compression"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/embedding"
+	"face/matching"
+
+	"github.com/spf13/cobra"
+)
+
+func NewEmbeddingCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "embedding",
+		Short: "Analyze stored face embeddings",
+		Long:  `Inspect the embeddings stored for enrolled faces, e.g. to debug low match scores.`,
+	}
+
+	cmd.AddCommand(newEmbeddingInspectCmd(cfg))
+	cmd.AddCommand(newEmbeddingMapCmd(cfg))
+
+	return cmd
+}
+
+func newEmbeddingInspectCmd(cfg *config.Config) *cobra.Command {
+	var (
+		faceID      string
+		compareFace string
+		neighbors   int
+		formatJSON  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Show details of a face embedding",
+		Long: `Show the dimension and norm of a stored face embedding, how similar it is to
+the other faces of the same user, and its nearest neighbors in the database.
+
+With --compare-face, also print the similarity of the two faces. This helps
+to find out why two photos of the same person score low: a face whose nearest
+neighbors belong to other users was probably enrolled from a bad photo.`,
+		Example: `  face embedding inspect --face-id 3f2a...
+  face embedding inspect --face-id 3f2a... --compare-face 9b1c...
+  face embedding inspect --face-id 3f2a... --neighbors 10 --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEmbeddingInspect(cfg, faceID, compareFace, neighbors, formatJSON)
+		},
+	}
+
+	cmd.Flags().StringVar(&faceID, "face-id", "", "face ID or unique prefix to inspect (required)")
+	cmd.Flags().StringVar(&compareFace, "compare-face", "", "face ID to compare with")
+	cmd.Flags().IntVarP(&neighbors, "neighbors", "k", 5, "number of nearest neighbors to show")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+	_ = cmd.MarkFlagRequired("face-id")
+
+	return cmd
+}
+
+// embeddingFace identifies a stored face and describes its embedding
+type embeddingFace struct {
+	FaceID    string  `json:"face_id"`
+	UserID    string  `json:"user_id"`
+	UserName  string  `json:"user_name"`
+	Dimension int     `json:"dimension"`
+	Norm      float64 `json:"norm"`
+	Quality   float64 `json:"quality_score"`
+}
+
+// embeddingNeighbor is a face similar to the inspected one
+type embeddingNeighbor struct {
+	FaceID     string  `json:"face_id"`
+	UserID     string  `json:"user_id"`
+	UserName   string  `json:"user_name"`
+	Similarity float64 `json:"similarity"`
+	SameUser   bool    `json:"same_user"`
+}
+
+// similarityRange summarizes the similarities to a set of faces
+type similarityRange struct {
+	Faces int     `json:"faces"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+}
+
+type embeddingInspection struct {
+	embeddingFace
+	SameUser   *similarityRange    `json:"same_user,omitempty"`
+	Neighbors  []embeddingNeighbor `json:"neighbors"`
+	Compare    *embeddingFace      `json:"compare,omitempty"`
+	Similarity *float64            `json:"similarity,omitempty"`
+}
+
+func runEmbeddingInspect(cfg *config.Config, faceID, compareFace string, neighbors int, formatJSON bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	owner, f, err := findFace(users, faceID)
+	if err != nil {
+		return err
+	}
+
+	inspection := embeddingInspection{
+		embeddingFace: describeEmbedding(owner, f),
+		SameUser:      sameUserSimilarity(owner, f),
+		Neighbors:     nearestNeighbors(users, owner, f, neighbors),
+	}
+
+	if compareFace != "" {
+		otherOwner, other, err := findFace(users, compareFace)
+		if err != nil {
+			return err
+		}
+		compared := describeEmbedding(otherOwner, other)
+		similarity := matching.CosineSimilarity(f.Embedding, other.Embedding)
+		inspection.Compare = &compared
+		inspection.Similarity = &similarity
+	}
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(inspection, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	printEmbeddingInspection(&inspection)
+	return nil
+}
+
+// findFace returns the face whose ID is faceID or an unambiguous prefix of
+// it, and the user it belongs to
+func findFace(users []models.User, faceID string) (*models.User, *models.Face, error) {
+	var ids []string
+	for i := range users {
+		for j := range users[i].Faces {
+			ids = append(ids, users[i].Faces[j].ID)
+		}
+	}
+
+	match, err := database.MatchIDPrefix(faceID, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range users {
+		for j := range users[i].Faces {
+			if match != "" && users[i].Faces[j].ID == match {
+				return &users[i], &users[i].Faces[j], nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("face not found: %s", faceID)
+}
+
+func describeEmbedding(user *models.User, f *models.Face) embeddingFace {
+	return embeddingFace{
+		FaceID:    f.ID,
+		UserID:    user.ID,
+		UserName:  user.Name,
+		Dimension: len(f.Embedding),
+		Norm:      matching.Norm(f.Embedding),
+		Quality:   f.QualityScore,
+	}
+}
+
+// sameUserSimilarity compares a face with the other faces of its user, or
+// returns nil if the user has no other faces
+func sameUserSimilarity(user *models.User, f *models.Face) *similarityRange {
+	r := &similarityRange{Min: math.Inf(1), Max: math.Inf(-1)}
+	var sum float64
+	for _, other := range user.Faces {
+		if other.ID == f.ID {
+			continue
+		}
+		s := matching.CosineSimilarity(f.Embedding, other.Embedding)
+		r.Min = math.Min(r.Min, s)
+		r.Max = math.Max(r.Max, s)
+		sum += s
+		r.Faces++
+	}
+
+	if r.Faces == 0 {
+		return nil
+	}
+	r.Mean = sum / float64(r.Faces)
+	return r
+}
+
+func nearestNeighbors(users []models.User, owner *models.User, f *models.Face, n int) []embeddingNeighbor {
+	faces := make(map[string][]models.Face, len(users))
+	names := make(map[string]string, len(users))
+	for i := range users {
+		faces[users[i].ID] = users[i].Faces
+		names[users[i].ID] = users[i].Name
+	}
+
+	result := []embeddingNeighbor{}
+	for _, nb := range embedding.Nearest(f.Embedding, faces, n, f.ID) {
+		result = append(result, embeddingNeighbor{
+			FaceID:     nb.FaceID,
+			UserID:     nb.UserID,
+			UserName:   names[nb.UserID],
+			Similarity: nb.Similarity,
+			SameUser:   nb.UserID == owner.ID,
+		})
+	}
+	return result
+}
+
+func printEmbeddingInspection(inspection *embeddingInspection) {
+	fmt.Printf("\nFace %s\n", inspection.FaceID)
+	fmt.Println("─────────────────────────────────────")
+	fmt.Printf("  User:       %s (%s)\n", inspection.UserName, inspection.UserID)
+	fmt.Printf("  Dimension:  %d\n", inspection.Dimension)
+	fmt.Printf("  Norm:       %.4f\n", inspection.Norm)
+	fmt.Printf("  Quality:    %.2f\n", inspection.Quality)
+
+	if r := inspection.SameUser; r != nil {
+		fmt.Printf("\nSimilarity to %d other face(s) of %s:\n", r.Faces, inspection.UserName)
+		fmt.Printf("  min %.4f  mean %.4f  max %.4f\n", r.Min, r.Mean, r.Max)
+	}
+
+	if len(inspection.Neighbors) > 0 {
+		fmt.Println("\nNearest neighbors:")
+		for i, nb := range inspection.Neighbors {
+			marker := " "
+			if !nb.SameUser {
+				marker = "!"
+			}
+			fmt.Printf("  %s %d. %.4f  %s (face %s)\n", marker, i+1, nb.Similarity, nb.UserName, nb.FaceID)
+		}
+		fmt.Println("  (! = different user)")
+	}
+
+	if inspection.Compare != nil {
+		c := inspection.Compare
+		fmt.Printf("\nCompared with face %s\n", c.FaceID)
+		fmt.Printf("  User:       %s (%s)\n", c.UserName, c.UserID)
+		fmt.Printf("  Dimension:  %d\n", c.Dimension)
+		fmt.Printf("  Norm:       %.4f\n", c.Norm)
+		if c.Dimension != inspection.Dimension {
+			fmt.Println("  ✗ Dimensions differ, the faces were embedded by different models")
+		} else {
+			fmt.Printf("  Similarity: %.4f\n", *inspection.Similarity)
+		}
+	}
+}
+
+func newEmbeddingMapCmd(cfg *config.Config) *cobra.Command {
+	var (
+		out        string
+		method     string
+		perplexity float64
+		iterations int
+	)
+
+	defaults := embedding.DefaultTSNEOptions()
+
+	cmd := &cobra.Command{
+		Use:   "map",
+		Short: "Export a 2-D map of all embeddings",
+		Long: `Project every stored face embedding to two dimensions and write the
+coordinates with user labels as JSON, to plot the cluster structure in a
+notebook or web UI. Faces of one person should form a tight cluster; a face
+inside another person's cluster was probably enrolled under the wrong user.
+
+Methods:
+  - tsne: t-SNE, keeps neighbors together (default, slow beyond a few
+    thousand faces)
+  - pca: first two principal components, fast but less faithful`,
+		Example: `  face embedding map --out map.json
+  face embedding map --out map.json --method pca`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := embedding.TSNEOptions{Perplexity: perplexity, Iterations: iterations}
+			return runEmbeddingMap(cfg, out, method, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "output JSON file, compressed if named *.gz or *.zst (required)")
+	cmd.Flags().StringVar(&method, "method", "tsne", "projection method (tsne, pca)")
+	cmd.Flags().Float64Var(&perplexity, "perplexity", defaults.Perplexity, "t-SNE perplexity")
+	cmd.Flags().IntVar(&iterations, "iterations", defaults.Iterations, "t-SNE iterations")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+// embeddingMap is the output of 'face embedding map'
+type embeddingMap struct {
+	Method string              `json:"method"`
+	Points []embeddingMapPoint `json:"points"`
+}
+
+type embeddingMapPoint struct {
+	FaceID   string  `json:"face_id"`
+	UserID   string  `json:"user_id"`
+	UserName string  `json:"user_name"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+}
+
+func runEmbeddingMap(cfg *config.Config, out, method string, opts embedding.TSNEOptions) error {
+	if method != "tsne" && method != "pca" {
+		return fmt.Errorf("unknown projection method %q (use tsne or pca)", method)
+	}
+	if opts.Perplexity <= 0 || opts.Iterations <= 0 {
+		return fmt.Errorf("perplexity and iterations must be positive")
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	result := embeddingMap{Method: method, Points: []embeddingMapPoint{}}
+	var data [][]float32
+	for i := range users {
+		for _, f := range users[i].Faces {
+			if len(data) > 0 && len(f.Embedding) != len(data[0]) {
+				return fmt.Errorf("face %s has a %d-d embedding, expected %d-d: embeddings from different models cannot be mapped together", f.ID, len(f.Embedding), len(data[0]))
+			}
+			data = append(data, f.Embedding)
+			result.Points = append(result.Points, embeddingMapPoint{
+				FaceID:   f.ID,
+				UserID:   users[i].ID,
+				UserName: users[i].Name,
+			})
+		}
+	}
+
+	if len(data) == 0 {
+		fmt.Println("No faces enrolled yet.")
+		return nil
+	}
+
+	fmt.Printf("Projecting %d face(s) of %d user(s) with %s...\n", len(data), len(users), method)
+
+	var points []embedding.Point
+	if method == "pca" {
+		points = embedding.ProjectPCA(data)
+	} else {
+		points = embedding.ProjectTSNE(data, opts)
+	}
+	for i, pt := range points {
+		result.Points[i].X = pt.X
+		result.Points[i].Y = pt.Y
+	}
+
+	jsonData, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format JSON: %w", err)
+	}
+	if err := compression.WriteFile(out, append(jsonData, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write map: %w", err)
+	}
+
+	fmt.Printf("✓ Map written to %s\n", out)
+	return nil
+}
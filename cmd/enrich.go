@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"face/config"
+	"face/internal/database/models"
+	"face/matching"
+
+	"github.com/google/uuid"
+)
+
+// enrichMaxSimilarity is the highest similarity a probe may have to any
+// existing face of the user; closer probes add nothing new to the templates
+const enrichMaxSimilarity = 0.95
+
+// enrichUser adds a probe identified with high confidence as a new face of
+// the matched user, keeping templates fresh as people age. When the user
+// already has the maximum number of faces, the lowest quality face is
+// replaced if the probe is better. It returns why the probe was not added,
+// or "" if it was.
+func enrichUser(cfg *config.Config, fs *FaceSystem, match *models.MatchResult, probe *FaceResult) (string, error) {
+	minConfidence, minQuality := cfg.AutoEnrichThresholds()
+	if match.Confidence < minConfidence {
+		return fmt.Sprintf("confidence below %.2f", minConfidence), nil
+	}
+	if probe.QualityScore < minQuality {
+		return fmt.Sprintf("quality below %.2f", minQuality), nil
+	}
+
+	user, err := fs.DB.GetUser(match.User.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load user: %w", err)
+	}
+
+	for _, f := range user.Faces {
+		if matching.CosineSimilarity(probe.Embedding, f.Embedding) >= enrichMaxSimilarity {
+			return "too similar to an existing face", nil
+		}
+	}
+
+	settings, err := fs.DB.GetSettings()
+	if err != nil {
+		return "", fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	var evict *models.Face
+	if len(user.Faces) >= settings.MaxFacesPerUser {
+		lowest, ok := lowestQualityFace(user.Faces)
+		if !ok || lowest.QualityScore >= probe.QualityScore {
+			return "face limit reached and every face has better quality", nil
+		}
+		evict = &lowest
+	}
+
+	faceID := uuid.New().String()
+	filename, err := fs.saveFace(user.ID, faceID, probe)
+	if err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	added := &models.Face{
+		ID:           faceID,
+		Filename:     filename,
+		Embedding:    models.Embedding(probe.Embedding),
+		QualityScore: probe.QualityScore,
+	}
+	if err := replaceFace(fs, user.ID, evict, added); err != nil {
+		_ = fs.Storage.DeleteImage(filename)
+		return "", err
+	}
+	refreshAvatar(fs.DB, fs.Storage, user.ID)
+
+	slog.Info("face auto-enrolled", "user_id", user.ID, "face_id", faceID, "confidence", match.Confidence, "quality", probe.QualityScore)
+	return "", nil
+}
+
+// replaceFace adds a face to a user, first removing evict if it is not nil.
+// If adding fails the evicted face is restored; its image is only deleted
+// once the new face is stored.
+func replaceFace(fs *FaceSystem, userID string, evict, added *models.Face) error {
+	if evict != nil {
+		if err := fs.DB.RemoveFace(userID, evict.ID); err != nil {
+			return fmt.Errorf("failed to remove face from database: %w", err)
+		}
+	}
+
+	evictedByPolicy, err := fs.DB.AddFace(userID, added)
+	if err != nil {
+		if evict != nil {
+			if _, restoreErr := fs.DB.AddFace(userID, evict); restoreErr != nil {
+				return fmt.Errorf("failed to add face to database: %w (and failed to restore face %s: %v)", err, evict.ID, restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to add face to database: %w", err)
+	}
+
+	for _, f := range []*models.Face{evict, evictedByPolicy} {
+		if f != nil {
+			deleteEvictedImage(fs, userID, f)
+		}
+	}
+	return nil
+}
+
+// deleteEvictedImage deletes the image of a face that was replaced by a new
+// one because the user had reached the face limit
+func deleteEvictedImage(fs *FaceSystem, userID string, evicted *models.Face) {
+	slog.Info("face evicted", "user_id", userID, "face_id", evicted.ID, "quality", evicted.QualityScore)
+	if err := fs.Storage.DeleteImage(evicted.Filename); err != nil {
+		fmt.Printf("Warning: failed to delete image file: %v\n", err)
+	}
+}
+
+// lowestQualityFace returns a copy of the face with the lowest quality
+// score; a copy, since removing faces may reorder the slice
+func lowestQualityFace(faces []models.Face) (models.Face, bool) {
+	lowest := -1
+	for i := range faces {
+		if lowest < 0 || faces[i].QualityScore < faces[lowest].QualityScore {
+			lowest = i
+		}
+	}
+	if lowest < 0 {
+		return models.Face{}, false
+	}
+	return faces[lowest], true
+}
@@ -1,12 +1,22 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"os"
 	"strings"
+	"time"
 
 	"face/config"
+	"face/internal/database"
 	"face/internal/database/models"
+	"face/internal/deadline"
+	"face/internal/names"
+	"face/internal/notify"
+	"face/internal/qrcode"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
@@ -14,117 +24,367 @@ import (
 
 func NewEnrollCmd(cfg *config.Config) *cobra.Command {
 	var (
-		name     string
-		email    string
-		phone    string
-		images   string
-		metadata string
+		details   userDetails
+		images    string
+		metadata  string
+		qr        enrollQR
+		temporary bool
+		expiresIn time.Duration
+		force     bool
+		group     groupEnrollInput
+		groupMode bool
+		timeout   time.Duration
 	)
 
 	cmd := &cobra.Command{
-		Use:   "enroll",
-		Short: "Enroll a new user with face images",
+		Use:         "enroll",
+		Short:       "Enroll a new user with face images",
+		Annotations: recordAlways(),
 		Long: `Enroll a new user by providing their information and one or more face images.
-The system will detect faces, extract embeddings, and store them in the database.`,
+The system will detect faces, extract embeddings, and store them in the database.
+
+With --qr or --qr-out, the new user ID is also printed as a QR code in the
+terminal or saved as a PNG image, for badge printing and pairing phones.
+--qr-key encodes a metadata value instead, such as an external employee ID.
+
+--card-number is the number of the user's access card. When a door controller
+is configured (wiegand_output in the config), 'face identify' sends it the
+card number of the identified user.
+
+--temporary enrolls a visitor, e.g. a contractor, whose access ends after
+--expires-in (24h by default). An expired visitor is no longer identified or
+verified, and 'face prune' deletes them with their images.
+
+--scope assigns the user to an org, site or device (see 'face scope'), so
+they are only identified there; without it, they are identified everywhere.
+
+Enrolling a name another user already has is allowed, unless the duplicate
+name policy ('face settings set --duplicate-name-policy') is warn, which
+needs --force, or reject.
+
+With --interactive-faces, every face of one group photo (--image) is
+enrolled in a single session: the faces are numbered from the left in a
+preview image (--preview, or a file in the temporary directory), and for each
+one the operator enters a new user's name, or the ID or name of an existing
+user to add the face to, or skips it. --metadata, --temporary and --force
+apply to each new user; --report saves what was done with each face as JSON.
+
+With --timeout, enrollment gives up with a timeout error once it has taken
+that long, instead of waiting on a slow disk; the faces saved so far are
+removed. If the deadline passes while the user is being saved, the user may
+still be enrolled afterwards. --timeout cannot be used with
+--interactive-faces, which waits on the operator.`,
 		Example: `  face enroll --name "John Doe" --email "john@example.com" --images "img1.jpg,img2.jpg"
-  face enroll --name "Jane Smith" --images "photo.jpg" --metadata '{"department":"Engineering"}'`,
+  face enroll --name "Jane Smith" --images "photo.jpg" --metadata '{"department":"Engineering"}'
+  face enroll --name "Jane Smith" --images "photo.jpg" --metadata '{"employee_id":"E1042"}' --qr-key employee_id --qr-out badge.png
+  face enroll --name "Jane Smith" --images "photo.jpg" --card-number 41237 --badge E1042
+  face enroll --name "Visitor Bob" --images "bob.jpg" --temporary --expires-in 8h
+  face enroll --name "Jane Smith" --images "photo.jpg" --scope acme/berlin
+  face enroll --name "Jane Smith" --images "photo.jpg" --timeout 30s
+  face enroll --image team.jpg --interactive-faces --preview team-numbered.png --report team.json`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runEnroll(cfg, name, email, phone, images, metadata)
+			if cmd.Flags().Changed("expires-in") && !temporary {
+				return errors.New("--expires-in requires --temporary")
+			}
+			if temporary {
+				if expiresIn <= 0 {
+					return errors.New("--expires-in must be positive")
+				}
+				expiresAt := time.Now().Add(expiresIn)
+				details.ExpiresAt = &expiresAt
+			}
+			if timeout < 0 {
+				return errors.New("--timeout must not be negative")
+			}
+			if !groupMode && (group.Preview != "" || group.Report != "") {
+				return errors.New("--preview and --report require --interactive-faces")
+			}
+			if groupMode {
+				group.Metadata, group.ExpiresAt, group.Force = metadata, details.ExpiresAt, force
+				return runEnrollGroup(cfg, group)
+			}
+			return runEnroll(cfg, details, images, metadata, qr, force, timeout)
 		},
 	}
 
-	cmd.Flags().StringVarP(&name, "name", "n", "", "user name (required)")
-	cmd.Flags().StringVarP(&email, "email", "e", "", "user email")
-	cmd.Flags().StringVarP(&phone, "phone", "p", "", "user phone number")
+	cmd.Flags().StringVarP(&details.Name, "name", "n", "", "user name (required)")
+	cmd.Flags().StringVarP(&details.Email, "email", "e", "", "user email")
+	cmd.Flags().StringVarP(&details.Phone, "phone", "p", "", "user phone number")
+	cmd.Flags().StringVar(&details.CardNumber, "card-number", "", "number of the user's access card")
+	cmd.Flags().StringVar(&details.Badge, "badge", "", "badge or employee ID printed on the user's card")
+	cmd.Flags().StringSliceVar(&details.Scopes, "scope", nil, "org, site or device the user is identified at, repeatable (default everywhere)")
 	cmd.Flags().StringVarP(&images, "images", "i", "", "comma-separated image paths (required)")
 	cmd.Flags().StringVarP(&metadata, "metadata", "m", "", "JSON metadata")
-	_ = cmd.MarkFlagRequired("name")
-	_ = cmd.MarkFlagRequired("images")
+	cmd.Flags().BoolVar(&qr.Terminal, "qr", false, "print the user ID as a QR code")
+	cmd.Flags().StringVar(&qr.Out, "qr-out", "", "save the user ID as a QR code PNG image")
+	cmd.Flags().StringVar(&qr.Key, "qr-key", "", "encode this metadata value instead of the user ID")
+	cmd.Flags().BoolVar(&temporary, "temporary", false, "enroll a visitor whose access expires")
+	cmd.Flags().DurationVar(&expiresIn, "expires-in", 24*time.Hour, "how long a visitor's access lasts")
+	cmd.Flags().BoolVar(&force, "force", false, "enroll even if another user has the name, under the warn duplicate name policy")
+	cmd.Flags().StringVar(&group.ImagePath, "image", "", "group photo to enroll several users from, with --interactive-faces")
+	cmd.Flags().BoolVar(&groupMode, "interactive-faces", false, "assign each face of the --image group photo to a new or existing user")
+	cmd.Flags().StringVar(&group.Preview, "preview", "", "file to write the group photo with numbered faces to")
+	cmd.Flags().StringVar(&group.Report, "report", "", "file to write the per-face results of the group photo to, as JSON")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "give up after this long, e.g. 30s (default no limit)")
+	cmd.MarkFlagsRequiredTogether("image", "interactive-faces")
+	cmd.MarkFlagsOneRequired("name", "interactive-faces")
+	cmd.MarkFlagsOneRequired("images", "image")
+	for _, single := range []string{"name", "email", "phone", "card-number", "badge", "scope", "images", "qr", "qr-out", "qr-key", "timeout"} {
+		cmd.MarkFlagsMutuallyExclusive(single, "interactive-faces")
+	}
 
 	return cmd
 }
 
-func runEnroll(cfg *config.Config, name, email, phone, imagesStr, metadataStr string) error {
-	fmt.Println("Initializing face recognition system...")
+// userDetails are the user's own fields given on the command line
+type userDetails struct {
+	Name       string
+	Email      string
+	Phone      string
+	CardNumber string
+	Badge      string
+	// ExpiresAt is set when enrolling a visitor
+	ExpiresAt *time.Time
+	// Scopes are the orgs, sites and devices the user is identified at
+	Scopes []string
+}
 
-	fs, err := NewFaceSystem(cfg)
+// enrollQR says how to output the QR code of an enrolled user
+type enrollQR struct {
+	Terminal bool
+	Out      string
+	// Key is the metadata entry to encode, empty for the user ID
+	Key string
+}
+
+// value returns the text encoded for the user
+func (q enrollQR) value(user *models.User) string {
+	if q.Key == "" {
+		return user.ID
+	}
+	return fmt.Sprint(user.Metadata[q.Key])
+}
+
+// write outputs the QR code of the user as requested
+func (q enrollQR) write(user *models.User) error {
+	if q.Terminal {
+		fmt.Println()
+		if err := qrcode.Terminal(os.Stdout, q.value(user)); err != nil {
+			return err
+		}
+	}
+	if q.Out != "" {
+		if err := qrcode.WritePNG(q.Out, q.value(user)); err != nil {
+			return err
+		}
+		fmt.Printf("✓ QR code saved to %s\n", q.Out)
+	}
+	return nil
+}
+
+// duplicateName returns the name of another user that is the same as the
+// name, empty if there is none, and the duplicate name policy that then
+// applies. Names are the same regardless of case and accents and, with
+// transliteration, of script, see names.Equal.
+func duplicateName(db database.Database, name string, transliterate bool) (string, models.DuplicateNamePolicy, error) {
+	settings, err := db.GetSettings()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load settings: %w", err)
+	}
+	policy, err := models.ParseDuplicateNamePolicy(string(settings.DuplicateNamePolicy))
+	if err != nil || policy == models.DuplicateNameAllow {
+		return "", policy, err
+	}
+
+	exists, err := db.UserExistsByName(name)
+	if err != nil || exists {
+		return names.Normalize(name), policy, err
+	}
+	users, err := db.ListUsers()
 	if err != nil {
+		return "", policy, fmt.Errorf("failed to list users: %w", err)
+	}
+	for i := range users {
+		if names.Equal(users[i].Name, name, transliterate) {
+			return users[i].Name, policy, nil
+		}
+	}
+	return "", policy, nil
+}
+
+// checkEnrollName applies the duplicate name policy before enrolling
+func checkEnrollName(db database.Database, name string, force, transliterate bool) error {
+	taken, policy, err := duplicateName(db, name, transliterate)
+	if err != nil || taken == "" {
 		return err
 	}
-	defer fs.Close()
 
-	imagePaths := strings.Split(imagesStr, ",")
-	for i := range imagePaths {
-		imagePaths[i] = strings.TrimSpace(imagePaths[i])
+	switch {
+	case policy == models.DuplicateNameReject:
+		return fmt.Errorf("%w: %s, and the duplicate name policy rejects it", models.ErrDuplicateName, taken)
+	case !policy.Admits(force):
+		return fmt.Errorf("%w: %s; use --force to enroll another user with the name", models.ErrDuplicateName, taken)
+	case policy == models.DuplicateNameWarn:
+		fmt.Printf("⚠ Another user is already named %s, enrolling anyway (--force)\n", taken)
 	}
+	return nil
+}
 
+// parseEnrollMetadata parses the --metadata JSON, which must hold the
+// --qr-key value if one is given
+func parseEnrollMetadata(metadataStr, qrKey string) (models.Metadata, error) {
 	var metadataMap models.Metadata
 	if metadataStr != "" {
 		if err := json.Unmarshal([]byte(metadataStr), &metadataMap); err != nil {
-			return fmt.Errorf("invalid metadata JSON: %w", err)
+			return nil, fmt.Errorf("invalid metadata JSON: %w", err)
 		}
 	}
-
-	userID := uuid.New().String()
-	user := &models.User{
-		ID:       userID,
-		Name:     name,
-		Email:    email,
-		Phone:    phone,
-		Metadata: metadataMap,
-		Faces:    []models.Face{},
+	if _, ok := metadataMap[qrKey]; qrKey != "" && !ok {
+		return nil, fmt.Errorf("--qr-key %q is not in the metadata", qrKey)
 	}
+	return metadataMap, nil
+}
 
-	fmt.Printf("\nEnrolling user: %s\n", name)
-	fmt.Printf("Processing %d image(s)...\n\n", len(imagePaths))
-
-	for idx, imgPath := range imagePaths {
-		fmt.Printf("[%d/%d] Processing %s...\n", idx+1, len(imagePaths), imgPath)
+func runEnroll(cfg *config.Config, details userDetails, imagesStr, metadataStr string, qr enrollQR, force bool, timeout time.Duration) (err error) {
+	fmt.Println("Initializing face recognition system...")
 
-		result, err := fs.ProcessImage(imgPath)
-		if err != nil {
-			fmt.Printf("  ✗ %v\n", err)
-			continue
-		}
+	ctx, cancel := deadline.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	fs, err := newBoundFaceSystem(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
 
-		fmt.Printf("  • Face detected (quality: %.2f)\n", result.QualityScore)
+	userID := uuid.New().String()
+	audit := startAudit(cfg, fs.DB, models.AuditEnroll, userID)
+	defer func() { audit.finish(err) }()
 
-		if result.QualityScore < 0.3 {
-			fmt.Printf("  ✗ Quality too low, skipping\n")
-			continue
-		}
+	imagePaths := strings.Split(imagesStr, ",")
+	for i := range imagePaths {
+		imagePaths[i] = strings.TrimSpace(imagePaths[i])
+	}
 
-		faceID := uuid.New().String()
-		filename, err := fs.Storage.SaveImage(userID, faceID, result.CroppedFace)
-		if err != nil {
-			fmt.Printf("  ✗ Failed to save image: %v\n", err)
-			continue
-		}
+	metadataMap, err := parseEnrollMetadata(metadataStr, qr.Key)
+	if err != nil {
+		return err
+	}
 
-		user.Faces = append(user.Faces, models.Face{
-			ID:           faceID,
-			Filename:     filename,
-			Embedding:    models.Embedding(result.Embedding),
-			QualityScore: result.QualityScore,
-		})
-		fmt.Printf("  ✓ Face enrolled successfully\n")
+	user := &models.User{
+		ID:         userID,
+		Name:       details.Name,
+		Email:      details.Email,
+		Phone:      details.Phone,
+		CardNumber: details.CardNumber,
+		Badge:      details.Badge,
+		ExpiresAt:  details.ExpiresAt,
+		Metadata:   metadataMap,
+		Scopes:     details.Scopes,
+		Faces:      []models.Face{},
+	}
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	if err := checkEnrollName(fs.DB, user.Name, force, cfg.NameTransliteration); err != nil {
+		return err
+	}
+	if err := checkScopes(fs.DB, user.Scopes); err != nil {
+		return err
 	}
 
+	fmt.Printf("\nEnrolling user: %s\n", user.Name)
+	fmt.Printf("Processing %d image(s)...\n\n", len(imagePaths))
+
+	if user.Faces, err = enrollImages(fs, userID, imagePaths); err != nil {
+		return err
+	}
 	if len(user.Faces) == 0 {
 		return fmt.Errorf("no faces were successfully enrolled")
 	}
 
 	if err := fs.DB.CreateUser(user); err != nil {
-		for _, faceData := range user.Faces {
-			_ = fs.Storage.DeleteImage(faceData.Filename)
+		if stageEnded(err) {
+			// the user may still be saved, with the faces
+			return fmt.Errorf("%w: the user may still be enrolled, check with 'face list'", err)
 		}
+		discardFaces(fs, user.Faces)
 		return fmt.Errorf("failed to save user to database: %w", err)
 	}
 
+	refreshAvatar(fs.DB, fs.Storage, userID)
+
+	slog.Info("user enrolled", "user_id", userID, "faces", len(user.Faces))
+
 	fmt.Printf("\n✓ User enrolled successfully!\n")
 	fmt.Printf("  User ID: %s\n", userID)
-	fmt.Printf("  Name: %s\n", name)
+	fmt.Printf("  Name: %s\n", user.Name)
 	fmt.Printf("  Faces enrolled: %d\n", len(user.Faces))
+	if user.IsVisitor() {
+		fmt.Printf("  Visitor until: %s\n", user.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+
+	if err := qr.write(user); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	notifyUser(cfg, notify.EventEnrolled, user, 0, "")
 
 	return nil
 }
+
+// enrollImages saves the faces of the images that have a good one, skipping
+// the others. If the deadline of the face system passes, the faces saved so
+// far are removed.
+func enrollImages(fs *FaceSystem, userID string, imagePaths []string) ([]models.Face, error) {
+	var faces []models.Face
+	for idx, imgPath := range imagePaths {
+		fmt.Printf("[%d/%d] Processing %s...\n", idx+1, len(imagePaths), imgPath)
+
+		face, err := enrollImage(fs, userID, imgPath)
+		if stageEnded(err) {
+			discardFaces(fs, faces)
+			return nil, err
+		}
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+		if face != nil {
+			faces = append(faces, *face)
+			fmt.Printf("  ✓ Face enrolled successfully\n")
+		}
+	}
+	return faces, nil
+}
+
+// enrollImage saves the face of an image, returning nil if its quality is
+// too low
+func enrollImage(fs *FaceSystem, userID, imgPath string) (*models.Face, error) {
+	result, err := fs.ProcessImage(imgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("  • Face detected (quality: %.2f)\n", result.QualityScore)
+	printQualityHints("  ", result)
+
+	if result.QualityScore < 0.3 {
+		fmt.Printf("  ✗ Quality too low, skipping\n")
+		return nil, nil
+	}
+
+	faceID := uuid.New().String()
+	filename, err := fs.saveFace(userID, faceID, result)
+	if err != nil {
+		if stageEnded(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to save image: %w", err)
+	}
+
+	return &models.Face{
+		ID:           faceID,
+		Filename:     filename,
+		Embedding:    models.Embedding(result.Embedding),
+		QualityScore: result.QualityScore,
+	}, nil
+}
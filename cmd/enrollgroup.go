@@ -0,0 +1,377 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/imaging"
+	"face/internal/notify"
+	"face/internal/pipeline"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// Actions taken on the faces of a group photo
+const (
+	groupEnrolled = "enrolled"
+	groupAdded    = "added"
+	groupSkipped  = "skipped"
+)
+
+// Choices of the operator for a face of a group photo
+const (
+	groupChoiceNew      = "new"
+	groupChoiceExisting = "existing"
+	groupChoiceSkip     = "skip"
+	groupChoiceQuit     = "quit"
+)
+
+// groupEnrollInput says what to enroll from a group photo
+type groupEnrollInput struct {
+	ImagePath string
+	// Preview is the annotated image showing the face numbers, in the
+	// temporary directory if empty
+	Preview string
+	// Report is a JSON file the per-face results are written to, if set
+	Report string
+	// Metadata and ExpiresAt apply to each new user
+	Metadata  string
+	ExpiresAt *time.Time
+	Force     bool
+}
+
+// groupEnrollment is the result of enrolling the faces of a group photo
+type groupEnrollment struct {
+	Image string      `json:"image"`
+	Faces []groupFace `json:"faces"`
+}
+
+// groupFace is what was done with one face of a group photo
+type groupFace struct {
+	// Number is the face's number in the preview, from the left
+	Number  int     `json:"number"`
+	Box     apiBox  `json:"box"`
+	Quality float64 `json:"quality"`
+	// Action is enrolled for a new user, added for an existing one, or
+	// skipped
+	Action string `json:"action"`
+	UserID string `json:"user_id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	FaceID string `json:"face_id,omitempty"`
+	// Reason says why a face was skipped
+	Reason string `json:"reason,omitempty"`
+}
+
+// runEnrollGroup detects every face of a group photo, writes a preview with
+// the faces numbered, and lets the operator assign each face to a new or an
+// existing user
+func runEnrollGroup(cfg *config.Config, input groupEnrollInput) error {
+	metadata, err := parseEnrollMetadata(input.Metadata, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Initializing face recognition system...")
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	img, sourceSHA256, err := loadGroupPhoto(fs, input.ImagePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nDetecting faces in %s...\n", input.ImagePath)
+	detections, err := fs.DetectFaces(img)
+	if err != nil {
+		return fmt.Errorf("face detection failed: %w", err)
+	}
+	if len(detections) == 0 {
+		return models.ErrFaceNotDetected
+	}
+	// numbered from the left, the way people in a group photo are named
+	slices.SortStableFunc(detections, func(a, b *pipeline.Detection) int {
+		return a.Box.Min.X - b.Box.Min.X
+	})
+
+	preview, err := writeGroupPreview(img, detections, input)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✓ Found %d face(s), numbered from the left in %s\n", len(detections), preview)
+
+	session := &groupSession{
+		cfg: cfg, fs: fs, prompter: newPrompter(),
+		img: img, sourceSHA256: sourceSHA256, metadata: metadata, input: input,
+	}
+	enrollment := &groupEnrollment{Image: input.ImagePath}
+	quit := false
+	for i, detection := range detections {
+		face := groupFace{Number: i + 1, Box: newAPIBox(detection.Box), Action: groupSkipped}
+		if quit {
+			face.Reason = "not assigned"
+		} else if quit, err = session.assign(detection, &face); err != nil {
+			return err
+		}
+		enrollment.Faces = append(enrollment.Faces, face)
+	}
+
+	printGroupEnrollment(enrollment)
+	if input.Report != "" {
+		if err := writeGroupReport(input.Report, enrollment); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Results written to %s\n", input.Report)
+	}
+	return nil
+}
+
+// loadGroupPhoto decodes the group photo and hashes the file, for the
+// provenance of the faces cropped from it
+func loadGroupPhoto(fs *FaceSystem, path string) (image.Image, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load image: %w", err)
+	}
+	defer file.Close()
+
+	img, err := storage.DecodeInputImage(file, fs.ImageLimits)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load image: %w", err)
+	}
+	sum, err := sourceSHA256(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, sum, nil
+}
+
+// writeGroupPreview writes the photo with the faces boxed and numbered,
+// returning where
+func writeGroupPreview(img image.Image, detections []*pipeline.Detection, input groupEnrollInput) (string, error) {
+	path := input.Preview
+	if path == "" {
+		name := strings.TrimSuffix(filepath.Base(input.ImagePath), filepath.Ext(input.ImagePath))
+		path = filepath.Join(os.TempDir(), name+".faces.png")
+	}
+
+	boxes := make([]image.Rectangle, len(detections))
+	for i, detection := range detections {
+		boxes[i] = detection.Box
+	}
+	if err := writeImageFile(path, imaging.Annotate(img, boxes)); err != nil {
+		return "", fmt.Errorf("failed to write preview: %w", err)
+	}
+	return path, nil
+}
+
+// groupSession is the state of enrolling the faces of a group photo
+type groupSession struct {
+	cfg      *config.Config
+	fs       *FaceSystem
+	prompter *prompter
+	img      image.Image
+	// sourceSHA256 is the hash of the photo, for the provenance of the
+	// faces cropped from it
+	sourceSHA256 string
+	metadata     models.Metadata
+	input        groupEnrollInput
+}
+
+// assign asks the operator what to do with a face until it is enrolled,
+// added or skipped, recording the outcome in face. It reports whether the
+// operator chose to quit.
+func (s *groupSession) assign(detection *pipeline.Detection, face *groupFace) (bool, error) {
+	box := detection.Box
+	fmt.Printf("\nFace %d: %dx%d at (%d,%d)\n", face.Number, box.Dx(), box.Dy(), box.Min.X, box.Min.Y)
+
+	result, err := s.fs.embedDetection(s.img, detection)
+	if err != nil {
+		fmt.Printf("  ✗ %v\n", err)
+		face.Reason = err.Error()
+		return false, nil
+	}
+	result.SourceSHA256 = s.sourceSHA256
+	face.Quality = result.QualityScore
+
+	fmt.Printf("  • Quality: %.2f\n", result.QualityScore)
+	printQualityHints("  ", result)
+	if result.QualityScore < 0.3 {
+		fmt.Printf("  ✗ Quality too low, skipping\n")
+		face.Reason = "quality too low"
+		return false, nil
+	}
+
+	for {
+		choice, err := s.prompter.choose("  Assign to", []string{groupChoiceNew, groupChoiceExisting, groupChoiceSkip, groupChoiceQuit}, groupChoiceSkip)
+		if err != nil {
+			return false, err
+		}
+
+		switch choice {
+		case groupChoiceSkip:
+			face.Reason = "skipped by the operator"
+			return false, nil
+		case groupChoiceQuit:
+			face.Reason = "not assigned"
+			return true, nil
+		case groupChoiceNew:
+			err = s.enrollUser(result, face)
+		case groupChoiceExisting:
+			err = s.addFace(result, face)
+		}
+		if err == nil {
+			return false, nil
+		}
+		fmt.Printf("  ✗ %v\n", err)
+	}
+}
+
+// enrollUser enrolls a face as a new user, whose name is asked for
+func (s *groupSession) enrollUser(result *FaceResult, face *groupFace) error {
+	name, err := s.prompter.ask("  Name", "")
+	if err != nil || name == "" {
+		return errors.Join(err, errors.New("a name is required"))
+	}
+
+	user := &models.User{
+		ID:        uuid.New().String(),
+		Name:      name,
+		ExpiresAt: s.input.ExpiresAt,
+		Metadata:  maps.Clone(s.metadata),
+	}
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	if err := checkEnrollName(s.fs.DB, user.Name, s.input.Force, s.cfg.NameTransliteration); err != nil {
+		return err
+	}
+
+	audit := startAudit(s.cfg, s.fs.DB, models.AuditEnroll, user.ID)
+	faceID, err := createGroupUser(s.fs, user, result)
+	audit.finish(err)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("user enrolled", "user_id", user.ID, "faces", 1)
+	notifyUser(s.cfg, notify.EventEnrolled, user, 0, "")
+	fmt.Printf("  ✓ Enrolled %s (ID: %s)\n", user.Name, user.ID)
+	face.Action, face.UserID, face.Name, face.FaceID = groupEnrolled, user.ID, user.Name, faceID
+	return nil
+}
+
+// createGroupUser stores the face and creates the user with it, returning
+// the face's ID
+func createGroupUser(fs *FaceSystem, user *models.User, result *FaceResult) (string, error) {
+	faceID := uuid.New().String()
+	filename, err := fs.saveFace(user.ID, faceID, result)
+	if err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	user.Faces = []models.Face{{
+		ID:           faceID,
+		Filename:     filename,
+		Embedding:    models.Embedding(result.Embedding),
+		QualityScore: result.QualityScore,
+	}}
+	if err := fs.DB.CreateUser(user); err != nil {
+		_ = fs.Storage.DeleteImage(filename)
+		return "", fmt.Errorf("failed to save user to database: %w", err)
+	}
+	refreshAvatar(fs.DB, fs.Storage, user.ID)
+	return faceID, nil
+}
+
+// addFace adds a face to an existing user, given by ID, unique ID prefix
+// or name. Users enrolled earlier from the same photo can be named too.
+func (s *groupSession) addFace(result *FaceResult, face *groupFace) error {
+	answer, err := s.prompter.ask("  User ID or name", "")
+	if err != nil || answer == "" {
+		return errors.Join(err, errors.New("a user ID or name is required"))
+	}
+	user, err := findGroupUser(s.fs.DB, answer)
+	if err != nil {
+		return err
+	}
+
+	audit := startAudit(s.cfg, s.fs.DB, models.AuditEnroll, user.ID)
+	faceID, evicted, err := addProcessedFace(s.fs, user.ID, result)
+	audit.finish(err)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("  ✓ Added to %s (ID: %s)\n", user.Name, user.ID)
+	if evicted != nil {
+		fmt.Printf("  • Face limit reached, replaced face %s (quality: %.2f)\n", evicted.ID, evicted.QualityScore)
+	}
+	face.Action, face.UserID, face.Name, face.FaceID = groupAdded, user.ID, user.Name, faceID
+	return nil
+}
+
+// findGroupUser returns the user with the ID, unique ID prefix or name
+func findGroupUser(db database.Database, answer string) (*models.User, error) {
+	if user, err := database.GetUserByIDPrefix(db, answer); err == nil {
+		return user, nil
+	}
+
+	users, err := db.ListUsersByName(answer)
+	switch {
+	case err != nil:
+		return nil, err
+	case len(users) == 0:
+		return nil, fmt.Errorf("no user with the ID or name %q", answer)
+	case len(users) > 1:
+		return nil, fmt.Errorf("%d users are named %q, give the user ID instead", len(users), answer)
+	}
+	return &users[0], nil
+}
+
+// printGroupEnrollment prints what was done with each face
+func printGroupEnrollment(enrollment *groupEnrollment) {
+	fmt.Println("\n─────────────────────────────────────")
+	counts := map[string]int{}
+	for _, face := range enrollment.Faces {
+		counts[face.Action]++
+		switch face.Action {
+		case groupEnrolled:
+			fmt.Printf("  ✓ Face %d: enrolled %s (%s)\n", face.Number, face.Name, face.UserID)
+		case groupAdded:
+			fmt.Printf("  ✓ Face %d: added to %s (%s)\n", face.Number, face.Name, face.UserID)
+		default:
+			fmt.Printf("  • Face %d: skipped, %s\n", face.Number, face.Reason)
+		}
+	}
+	fmt.Printf("\n%d user(s) enrolled, %d face(s) added to existing users, %d skipped\n",
+		counts[groupEnrolled], counts[groupAdded], counts[groupSkipped])
+}
+
+// writeGroupReport writes the per-face results as JSON
+func writeGroupReport(path string, enrollment *groupEnrollment) error {
+	data, err := json.MarshalIndent(enrollment, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format JSON: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"face/config"
+	"face/internal/compression"
+	"face/internal/evaluation"
+	"face/matching"
+
+	"github.com/spf13/cobra"
+)
+
+// evalConfusionsShown is how many people with errors 'face eval' prints;
+// --output has all of them
+const evalConfusionsShown = 10
+
+// evalPerson is a folder of a labeled dataset: the images of one person
+type evalPerson struct {
+	Name   string
+	Images []string
+}
+
+// evalReport is the report of 'face eval'
+type evalReport struct {
+	Dataset string `json:"dataset"`
+	// Model and Strategy are what the probes were identified with, as
+	// results of one do not carry over to another
+	Model    string            `json:"model"`
+	Strategy matching.Strategy `json:"strategy"`
+	// Seed is the seed people were sampled and their images split with,
+	// see --seed
+	Seed    int64 `json:"seed,omitempty"`
+	People  int   `json:"people"`
+	Sampled int   `json:"sampled,omitempty"`
+	// Enrolled is how many people had images enrolled, GalleryImages of
+	// each at most
+	Enrolled      int `json:"enrolled"`
+	GalleryImages int `json:"gallery_images"`
+	Probes        int `json:"probes"`
+	// Unknown is how many probes are of people not enrolled
+	Unknown int `json:"unknown"`
+	// Skipped are the images that could not be embedded
+	Skipped    int                    `json:"skipped"`
+	Rank1Rate  float64                `json:"rank1_rate"`
+	Threshold  float64                `json:"threshold"`
+	Metrics    []evaluation.Metrics   `json:"metrics"`
+	Confusions []evaluation.Confusion `json:"confusions"`
+	Results    []evaluation.Result    `json:"results"`
+}
+
+func NewEvalCmd(cfg *config.Config) *cobra.Command {
+	var (
+		dataset    string
+		gallery    int
+		sample     int
+		thresholds []float64
+		output     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Measure identification accuracy on a labeled dataset",
+		Long: `Measure how well the embedding model, match strategy and threshold identify
+people in a labeled dataset of your own, to compare models and thresholds
+before changing them. Nothing is enrolled in the database.
+
+The dataset is laid out like LFW: a folder per person, named after them,
+holding their images. Of each person, --gallery images picked at random are
+enrolled and the others are identified against everyone enrolled; people
+with no more images than that are not enrolled, and all their images are
+identified as unknown people, who should match no one.
+
+Reported are the rank-1 identification rate (probes of enrolled people whose
+closest enrolled person is their own, whatever the threshold) and, at the
+threshold and each of --thresholds:
+  accuracy   probes decided correctly: accepted as their own person, or
+             rejected when unknown
+  precision  accepted probes accepted as the right person
+  recall     probes of enrolled people accepted as them
+followed by the people with the most errors and whom they were mistaken
+for. --output writes the whole report as JSON, or a row per probe as CSV,
+by extension; a name ending in .gz or .zst is compressed.
+
+The images enrolled, and with --sample the people evaluated, are drawn at
+random; --seed makes them the same on every run, to compare models or
+strategies on the same split.`,
+		Example: `  face eval --dataset ./labeled
+  face eval --dataset ./lfw --sample 500 --seed 7 --thresholds 0.6,0.7,0.8
+  face eval --dataset ./labeled --gallery 3 --output eval.json
+  face eval --dataset ./labeled --model arcface --match-strategy average --seed 7`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if gallery < 1 {
+				return errors.New("--gallery must be at least 1")
+			}
+			if sample < 0 {
+				return errors.New("--sample must not be negative")
+			}
+			for _, t := range thresholds {
+				if t < 0 || t > 1 {
+					return fmt.Errorf("threshold %g is not between 0 and 1", t)
+				}
+			}
+			return runEval(cfg, dataset, gallery, sample, thresholds, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dataset, "dataset", "d", "", "folder with a folder of images per person")
+	cmd.Flags().IntVar(&gallery, "gallery", 1, "images of each person to enroll, the others are identified")
+	cmd.Flags().IntVar(&sample, "sample", 0, "evaluate a random sample of this many people (default all)")
+	cmd.Flags().Float64SliceVar(&thresholds, "thresholds", nil, "also report these thresholds, e.g. 0.6,0.7,0.8")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write the report to, JSON or CSV by extension")
+	cmd.MarkFlagRequired("dataset")
+
+	return cmd
+}
+
+func runEval(cfg *config.Config, dataset string, gallery, sample int, thresholds []float64, output string) error {
+	people, err := readEvalDataset(dataset)
+	if err != nil {
+		return err
+	}
+	rng := cfg.Rand("eval")
+	report := &evalReport{Dataset: dataset, People: len(people), GalleryImages: gallery, Threshold: cfg.DefaultThreshold, Seed: cfg.Seed}
+	if sample > 0 && sample < len(people) {
+		rng.Shuffle(len(people), func(i, j int) { people[i], people[j] = people[j], people[i] })
+		people = people[:sample]
+		slices.SortFunc(people, func(a, b evalPerson) int { return strings.Compare(a.Name, b.Name) })
+		report.Sampled = sample
+	}
+	for i := range people {
+		rng.Shuffle(len(people[i].Images), func(a, b int) {
+			people[i].Images[a], people[i].Images[b] = people[i].Images[b], people[i].Images[a]
+		})
+	}
+	if report.Model, _, err = cfg.Embedding(); err != nil {
+		return err
+	}
+
+	fmt.Println("Initializing face recognition system...")
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	report.Strategy = fs.Strategy
+
+	if report.Sampled > 0 {
+		fmt.Printf("Sampled %d of %d people%s\n", report.Sampled, report.People, seedLabel(report.Seed))
+	}
+	fmt.Printf("Embedding the images of %d people...\n", len(people))
+	enrolled, probes := embedEvalDataset(fs, people, gallery, report)
+	if len(enrolled) == 0 {
+		return fmt.Errorf("no one could be enrolled: every person needs more than %d image(s) with a face", gallery)
+	}
+	if report.Probes == report.Unknown {
+		return fmt.Errorf("no probes of enrolled people: every person needs more than %d image(s) with a face", gallery)
+	}
+
+	results := evaluation.Identify(fs.Strategy, enrolled, probes)
+	report.Rank1Rate = evaluation.Rank1Rate(results)
+	for _, t := range evalThresholds(cfg.DefaultThreshold, thresholds) {
+		report.Metrics = append(report.Metrics, evaluation.At(results, t))
+	}
+	report.Confusions = evaluation.Confusions(results, cfg.DefaultThreshold)
+	report.Results = results
+	printEval(report)
+
+	if output != "" {
+		if err := writeEvalReport(output, report); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Report written to %s\n", output)
+	}
+	return nil
+}
+
+// readEvalDataset returns the people of a dataset folder with their images,
+// in name order. Hidden folders and folders without images are left out.
+func readEvalDataset(dir string) ([]evalPerson, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+
+	var people []evalPerson
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		images, err := batchImages(filepath.Join(dir, e.Name()), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(images) > 0 {
+			people = append(people, evalPerson{Name: e.Name(), Images: images})
+		}
+	}
+	if len(people) == 0 {
+		return nil, fmt.Errorf("no folders of images in %s: the dataset needs a folder per person", dir)
+	}
+	return people, nil
+}
+
+// embedEvalDataset embeds the images of the people, enrolling the first
+// gallery images of those with more and making probes of the rest. Images
+// that cannot be embedded are warned about and counted as skipped.
+func embedEvalDataset(fs *FaceSystem, people []evalPerson, gallery int, report *evalReport) ([]matching.Candidate, []evaluation.Probe) {
+	embed := func(image string) []float32 {
+		result, err := fs.ProcessImage(image)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", image, err)
+			report.Skipped++
+			return nil
+		}
+		return result.Embedding
+	}
+
+	var enrolled []matching.Candidate
+	var probes []evaluation.Probe
+	for _, p := range people {
+		candidate := matching.Candidate{ID: p.Name, Name: p.Name}
+		rest := p.Images
+		if len(p.Images) > gallery {
+			for _, image := range p.Images[:gallery] {
+				if e := embed(image); e != nil {
+					candidate.Embeddings = append(candidate.Embeddings, e)
+				}
+			}
+			rest = p.Images[gallery:]
+		}
+		if len(candidate.Embeddings) > 0 {
+			enrolled = append(enrolled, candidate)
+		}
+
+		for _, image := range rest {
+			if e := embed(image); e != nil {
+				probes = append(probes, evaluation.Probe{Image: image, Person: p.Name, Enrolled: len(candidate.Embeddings) > 0, Embedding: e})
+			}
+		}
+	}
+
+	report.Enrolled, report.Probes = len(enrolled), len(probes)
+	for _, p := range probes {
+		if !p.Enrolled {
+			report.Unknown++
+		}
+	}
+	return enrolled, probes
+}
+
+// evalThresholds returns the thresholds to report, the current one among
+// them, in ascending order
+func evalThresholds(current float64, extra []float64) []float64 {
+	thresholds := append([]float64{current}, extra...)
+	slices.Sort(thresholds)
+	return slices.Compact(thresholds)
+}
+
+func printEval(r *evalReport) {
+	people := r.People
+	if r.Sampled > 0 {
+		people = r.Sampled
+	}
+	fmt.Printf("\n✓ %d probe(s) of %d people identified against %d enrolled", r.Probes, people, r.Enrolled)
+	if r.Skipped > 0 {
+		fmt.Printf(", %d image(s) skipped", r.Skipped)
+	}
+	fmt.Printf(" with %s (%s strategy)\n", r.Model, r.Strategy)
+	if r.Unknown > 0 {
+		fmt.Printf("  %d probe(s) of people not enrolled, who should match no one\n", r.Unknown)
+	}
+	fmt.Printf("  Rank-1 identification rate: %.2f%%\n", r.Rank1Rate*100)
+
+	fmt.Printf("\n%-9s  %8s  %9s  %8s  %5s  %5s  %5s  %5s\n", "THRESHOLD", "ACCURACY", "PRECISION", "RECALL", "TP", "FP", "FN", "TN")
+	for _, m := range r.Metrics {
+		marker := ""
+		if m.Threshold == r.Threshold {
+			marker = "  ← current"
+		}
+		fmt.Printf("%9.3f  %7.2f%%  %8.2f%%  %7.2f%%  %5d  %5d  %5d  %5d%s\n",
+			m.Threshold, m.Accuracy*100, m.Precision*100, m.Recall*100,
+			m.TruePositives, m.FalsePositives, m.FalseNegatives, m.TrueNegatives, marker)
+	}
+
+	printEvalConfusions(r.Confusions, r.Threshold)
+}
+
+// printEvalConfusions prints the people with the most errors
+func printEvalConfusions(confusions []evaluation.Confusion, threshold float64) {
+	var wrong []evaluation.Confusion
+	for _, c := range confusions {
+		if c.Errors() > 0 {
+			wrong = append(wrong, c)
+		}
+	}
+	if len(wrong) == 0 {
+		fmt.Printf("\n✓ No errors at threshold %.3f\n", threshold)
+		return
+	}
+
+	fmt.Printf("\nPeople with the most errors at threshold %.3f:\n", threshold)
+	for _, c := range wrong[:min(len(wrong), evalConfusionsShown)] {
+		line := fmt.Sprintf("%d of %d probe(s) correct", c.Correct, c.Probes)
+		if !c.Enrolled {
+			line += " (not enrolled)"
+		}
+		if c.Rejected > 0 {
+			line += fmt.Sprintf(", %d rejected", c.Rejected)
+		}
+		if len(c.MistakenFor) > 0 {
+			line += ", mistaken for " + describeCounts(c.MistakenFor)
+		}
+		if len(c.MistakenBy) > 0 {
+			line += "; mistaken by " + describeCounts(c.MistakenBy)
+		}
+		fmt.Printf("  • %s: %s\n", c.Person, line)
+	}
+	if len(wrong) > evalConfusionsShown {
+		fmt.Printf("  ... and %d more, see --output\n", len(wrong)-evalConfusionsShown)
+	}
+}
+
+// describeCounts lists the counts of people, most first, e.g. "Bob (2), Carol (1)"
+func describeCounts(counts map[string]int) string {
+	names := slices.Sorted(maps.Keys(counts))
+	slices.SortStableFunc(names, func(a, b string) int { return counts[b] - counts[a] })
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d)", name, counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// writeEvalReport writes the report as JSON, or its results as CSV
+func writeEvalReport(path string, report *evalReport) error {
+	var data []byte
+	if batchFormat(path) == "json" {
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		data = append(jsonData, '\n')
+	} else {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"image", "person", "enrolled", "predicted", "confidence", "rank1", "accepted"})
+		for _, r := range report.Results {
+			w.Write([]string{r.Image, r.Person, strconv.FormatBool(r.Enrolled), r.Predicted,
+				strconv.FormatFloat(r.Confidence, 'f', 4, 64), strconv.FormatBool(r.Rank1), strconv.FormatBool(r.Accepted(report.Threshold))})
+		}
+		w.Flush()
+		data = buf.Bytes()
+	}
+
+	if err := compression.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
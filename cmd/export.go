@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"face/config"
+	"face/internal/compression"
+	"face/internal/database/models"
+	"face/internal/dataset"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func NewExportCmd(cfg *config.Config) *cobra.Command {
+	var (
+		out    string
+		images bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export every user, face and setting to an archive",
+		Long: `Write everything enrolled to a single archive, for backups and for moving
+to another database backend with 'face import': the settings, every user
+with their faces and embeddings, and with --images the stored face images.
+Users whose deletion is in progress are left out.
+
+The archive is a tar file with a manifest.json describing it, compressed if
+named *.gz or *.zst. It holds biometric data and the users' second factor
+secrets: store it as carefully as the database.`,
+		Example: `  face export --out backup.tar.gz --images
+  face export --db-type sqlite --out move.tar.zst --images`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if out == "" {
+				out = fmt.Sprintf("face-export-%s.tar.gz", time.Now().Format("20060102-150405"))
+			}
+			return runExport(cfg, cmd.Root().Version, out, images)
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "archive to write (default face-export-<time>.tar.gz)")
+	cmd.Flags().BoolVar(&images, "images", false, "include the stored face images")
+
+	return cmd
+}
+
+func runExport(cfg *config.Config, version, out string, images bool) (err error) {
+	file, err := compression.Create(out, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(out)
+		}
+	}()
+
+	manifest, err := writeDataset(cfg, version, file, images)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	fmt.Printf("✓ Exported %d user(s) with %d face(s) to %s\n", manifest.Users, manifest.Faces, out)
+	if !images {
+		fmt.Println("  Face images are not included; add --images to include them")
+	}
+	return nil
+}
+
+// writeDataset writes a dataset archive of everything enrolled to w,
+// recording the export in the audit log
+func writeDataset(cfg *config.Config, version string, w io.Writer, images bool) (_ *dataset.Manifest, err error) {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	audit := startAudit(cfg, db, models.AuditExport, "")
+	defer func() { audit.finish(err) }()
+
+	var stor storage.Storage
+	if images {
+		if stor, err = cfg.GetStorage(db); err != nil {
+			return nil, fmt.Errorf("failed to initialize storage: %w", err)
+		}
+	}
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+	users, err := db.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	manifest := &dataset.Manifest{
+		CreatedAt:          time.Now().UTC(),
+		Source:             version,
+		DatabaseType:       string(cfg.DatabaseType),
+		EmbeddingModel:     settings.EmbeddingModel,
+		EmbeddingDimension: settings.EmbeddingDimension,
+		Users:              len(users),
+		Images:             images,
+	}
+	for i := range users {
+		manifest.Faces += len(users[i].Faces)
+	}
+
+	archive := dataset.NewWriter(w)
+	if err := archive.WriteData(manifest, settings, users); err != nil {
+		return nil, err
+	}
+	if images {
+		if err := exportImages(archive, stor, users); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// exportImages writes the stored image of every face. A missing image
+// fails the export, as the archive would not restore what was enrolled.
+func exportImages(archive *dataset.Writer, stor storage.Storage, users []models.User) error {
+	for i := range users {
+		for _, f := range users[i].Faces {
+			data, err := stor.LoadData(f.Filename)
+			if err != nil {
+				return fmt.Errorf("failed to read image of face %s of %s: %w", f.ID, users[i].Name, err)
+			}
+			if err := archive.WriteImage(users[i].ID, f.ID, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"face/config"
+	"face/internal/ann"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/matching"
+)
+
+// indexCandidatesPerUser is how many faces an index search returns per user
+// wanted, as the best faces found may belong to fewer users
+const indexCandidatesPerUser = 8
+
+// identifier matches embeddings against every user: the brute-force face
+// matcher or, with ann_index set, a faceIndex
+type identifier interface {
+	Match(embedding []float32, threshold float64) (*models.MatchResult, error)
+	FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error)
+}
+
+// faceIndex identifies faces with an approximate nearest-neighbor index of
+// every face embedding, kept in memory by the servers so identification
+// stays fast with hundreds of thousands of faces.
+//
+// The servers refresh the users they change. Changes by other processes
+// are picked up from the change log of sqlite and postgres before each
+// search; with the json and bolt databases they are not seen until restart.
+type faceIndex struct {
+	db      database.Database
+	changes database.ChangeLog // nil without a change log
+	index   *ann.Index
+
+	// mu guards the fields below and orders refreshes
+	mu sync.RWMutex
+	// seq is the last change of the change log applied
+	seq int64
+	// faces are the IDs of each user's indexed faces, owners the user of
+	// each indexed face
+	faces  map[string][]string
+	owners map[string]string
+}
+
+// loadFaceIndex builds the face index of the database when ann_index is
+// set, and returns nil otherwise
+func loadFaceIndex(cfg *config.Config, db database.Database) (*faceIndex, error) {
+	if !cfg.ANNIndex {
+		return nil, nil
+	}
+
+	start := time.Now()
+	x := &faceIndex{
+		db:     db,
+		index:  ann.New(ann.Options{EfSearch: cfg.ANNEfSearch, Seed: uint64(cfg.Seed)}),
+		faces:  make(map[string][]string),
+		owners: make(map[string]string),
+	}
+	if changes, ok := db.(database.ChangeLog); ok {
+		seq, err := changes.LatestChange()
+		if err != nil {
+			return nil, err
+		}
+		x.changes, x.seq = changes, seq
+	}
+
+	embeddings, err := db.GetAllEmbeddings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embeddings: %w", err)
+	}
+	// the graph depends on the order faces are added in, so a seeded run
+	// adds them one at a time
+	workers := runtime.GOMAXPROCS(0)
+	if cfg.Seed != 0 {
+		workers = 1
+	}
+	x.build(embeddings, workers)
+
+	fmt.Printf("✓ Face index built: %d faces of %d users in %s", x.index.Len(), len(x.faces), time.Since(start).Round(time.Millisecond))
+	if cfg.Seed != 0 {
+		fmt.Printf(" (seed %d)", cfg.Seed)
+	}
+	fmt.Println()
+	return x, nil
+}
+
+// build indexes the faces of every user in order of user ID
+func (x *faceIndex) build(embeddings map[string][]models.Face, workers int) {
+	type job struct {
+		userID string
+		face   *models.Face
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := x.index.Add(j.face.ID, j.face.Embedding); err != nil {
+					slog.Warn("face left out of the face index", "user_id", j.userID, "face_id", j.face.ID, "error", err)
+					continue
+				}
+				x.mu.Lock()
+				x.owners[j.face.ID] = j.userID
+				x.faces[j.userID] = append(x.faces[j.userID], j.face.ID)
+				x.mu.Unlock()
+			}
+		}()
+	}
+
+	userIDs := make([]string, 0, len(embeddings))
+	for userID := range embeddings {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	for _, userID := range userIDs {
+		faces := embeddings[userID]
+		for i := range faces {
+			jobs <- job{userID: userID, face: &faces[i]}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// identifier returns the face index if there is one, or else the
+// identifier of db, matching only the users of scope, scoring them with the
+// match strategy, discounting old faces with decay and running the matching
+// hooks
+func (x *faceIndex) identifier(db database.Database, decay matching.Decay, strategy matching.Strategy, scope string) identifier {
+	if x == nil {
+		return newIdentifier(db, decay, strategy, scope)
+	}
+	return withMatchHooks(withScoring(withScope(x, db, scope), db, decay, strategy))
+}
+
+// refresh re-reads a user's faces after a change. Nothing happens without
+// an index, and failures leave the user as indexed.
+func (x *faceIndex) refresh(userID string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if err := x.refreshUser(userID); err != nil {
+		slog.Warn("failed to refresh face index", "user_id", userID, "error", err)
+	}
+}
+
+func (x *faceIndex) refreshUser(userID string) error {
+	user, err := x.db.GetUser(userID)
+	if errors.Is(err, models.ErrUserNotFound) {
+		x.setFaces(userID, nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Expired(time.Now()) {
+		x.setFaces(userID, nil)
+		return nil
+	}
+	x.setFaces(userID, user.Faces)
+	return nil
+}
+
+// setFaces makes faces the indexed faces of a user. Faces already indexed
+// are kept as they are; embeddings do not change.
+func (x *faceIndex) setFaces(userID string, faces []models.Face) {
+	keep := make(map[string]bool, len(faces))
+	ids := make([]string, 0, len(faces))
+	for _, f := range faces {
+		keep[f.ID] = true
+		if _, ok := x.owners[f.ID]; !ok {
+			if err := x.index.Add(f.ID, f.Embedding); err != nil {
+				slog.Warn("face left out of the face index", "user_id", userID, "face_id", f.ID, "error", err)
+				continue
+			}
+			x.owners[f.ID] = userID
+		}
+		ids = append(ids, f.ID)
+	}
+
+	for _, id := range x.faces[userID] {
+		if !keep[id] {
+			x.index.Remove(id)
+			delete(x.owners, id)
+		}
+	}
+	if len(ids) == 0 {
+		delete(x.faces, userID)
+	} else {
+		x.faces[userID] = ids
+	}
+}
+
+// sync applies the changes of the change log since the last sync
+func (x *faceIndex) sync() error {
+	if x.changes == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for {
+		changes, err := x.changes.ChangesSince(x.seq, 500)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		users := make(map[string]bool)
+		for _, c := range changes {
+			users[c.UserID] = true
+		}
+		for userID := range users {
+			if err := x.refreshUser(userID); err != nil {
+				return err
+			}
+		}
+		x.seq = changes[len(changes)-1].Seq
+	}
+}
+
+// FindBestMatches returns up to n users with a face most similar to the
+// embedding, most similar first
+func (x *faceIndex) FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error) {
+	if err := x.sync(); err != nil {
+		return nil, err
+	}
+	found := x.index.Search(embedding, n*indexCandidatesPerUser)
+
+	var matches []models.MatchResult
+	seen := make(map[string]bool)
+	for _, r := range found {
+		if len(matches) == n {
+			break
+		}
+		x.mu.RLock()
+		userID, ok := x.owners[r.ID]
+		x.mu.RUnlock()
+		if !ok || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		user, err := x.db.GetUser(userID)
+		if errors.Is(err, models.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.Expired(time.Now()) {
+			// visitors expire without a change to the database
+			x.refresh(userID)
+			continue
+		}
+		matches = append(matches, models.MatchResult{UserID: userID, User: user, FaceID: r.ID, Confidence: r.Similarity})
+	}
+	return matches, nil
+}
+
+// Match returns the user with the face most similar to the embedding, or
+// models.ErrNoMatch if none is at least threshold similar
+func (x *faceIndex) Match(embedding []float32, threshold float64) (*models.MatchResult, error) {
+	matches, err := x.FindBestMatches(embedding, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bestMatch(matches, threshold)
+}
+
+// bestMatch returns the first of matches sorted most similar first, or
+// models.ErrNoMatch if it is less than threshold similar
+func bestMatch(matches []models.MatchResult, threshold float64) (*models.MatchResult, error) {
+	if len(matches) == 0 || matches[0].Confidence < threshold {
+		return nil, models.ErrNoMatch
+	}
+	match := matches[0]
+	match.Matched = true
+	return &match, nil
+}
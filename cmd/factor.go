@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"face/config"
+	"face/internal/database/models"
+	"face/internal/qrcode"
+	"face/internal/stepup"
+
+	"github.com/spf13/cobra"
+)
+
+func NewFactorCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "factor",
+		Short: "Manage users' PINs and authenticator apps for step-up verification",
+		Long: `Set up the second factors 'face verify' asks for when a verification needs
+more than a face: a PIN, stored as a salted hash, or an authenticator app
+(TOTP, as in Google Authenticator or 1Password).
+
+Which verifications need a second factor is configured with step_up rules in
+the config file. Each rule applies to a group, read from the "group" metadata
+entry of users (or the entry named by step_up_group_key), or to every user
+without a group, and requires a second factor when the match confidence is
+below below_confidence, or always without one:
+
+  "step_up": [
+    {"group": "vault"},
+    {"below_confidence": 0.85}
+  ]
+
+'face verify --step-up' requires a second factor regardless of the rules.`,
+	}
+
+	cmd.AddCommand(newFactorPINCmd(cfg))
+	cmd.AddCommand(newFactorTOTPCmd(cfg))
+	cmd.AddCommand(newFactorClearCmd(cfg))
+
+	return cmd
+}
+
+func newFactorPINCmd(cfg *config.Config) *cobra.Command {
+	var selection userSelection
+
+	cmd := &cobra.Command{
+		Use:         "pin",
+		Short:       "Set a user's PIN",
+		Annotations: recordAlways(),
+		Long: `Set a user's PIN, 4 to 12 digits. It is asked for twice without being shown;
+in scripts it is read from the first line of stdin.`,
+		Example: `  face factor pin --user-id abc123
+  echo 4711 | face factor pin --user-name "John Doe"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFactorPIN(cfg, selection)
+		},
+	}
+
+	cmd.Flags().StringVarP(&selection.ID, "user-id", "u", "", "user ID or unique prefix")
+	selection.addNameFlags(cmd, "user-id", false)
+
+	return cmd
+}
+
+func runFactorPIN(cfg *config.Config, selection userSelection) error {
+	return updateFactor(cfg, selection, func(user *models.User) (string, error) {
+		pin, err := readSecret("New PIN")
+		if err != nil {
+			return "", err
+		}
+		if stdinIsTerminal() {
+			again, err := readSecret("Repeat the PIN")
+			if err != nil {
+				return "", err
+			}
+			if again != pin {
+				return "", errors.New("the PINs do not match")
+			}
+		}
+
+		if user.PINHash, err = stepup.HashPIN(pin); err != nil {
+			return "", err
+		}
+		return "PIN set", nil
+	})
+}
+
+func newFactorTOTPCmd(cfg *config.Config) *cobra.Command {
+	var (
+		selection userSelection
+		qrOut     string
+	)
+
+	cmd := &cobra.Command{
+		Use:         "totp",
+		Short:       "Set up an authenticator app for a user",
+		Annotations: recordAlways(),
+		Long: `Create a new TOTP secret for a user and print it as a QR code to scan with
+an authenticator app. In a terminal, the app's first code is asked for to
+check the setup before it is saved. Any previous secret stops working.`,
+		Example: `  face factor totp --user-id abc123
+  face factor totp --user-id abc123 --qr-out totp.png`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runFactorTOTP(cfg, selection, qrOut)
+		},
+	}
+
+	cmd.Flags().StringVarP(&selection.ID, "user-id", "u", "", "user ID or unique prefix")
+	cmd.Flags().StringVar(&qrOut, "qr-out", "", "save the QR code as a PNG image instead of printing it")
+	selection.addNameFlags(cmd, "user-id", false)
+
+	return cmd
+}
+
+func runFactorTOTP(cfg *config.Config, selection userSelection, qrOut string) error {
+	return updateFactor(cfg, selection, func(user *models.User) (string, error) {
+		secret, err := stepup.NewTOTPSecret()
+		if err != nil {
+			return "", fmt.Errorf("failed to create TOTP secret: %w", err)
+		}
+
+		uri := stepup.TOTPURI(secret, user.Name)
+		if qrOut != "" {
+			if err := qrcode.WritePNG(qrOut, uri); err != nil {
+				return "", err
+			}
+			fmt.Printf("✓ QR code saved to %s\n", qrOut)
+		} else {
+			fmt.Println("\nScan this QR code with the authenticator app:")
+			if err := qrcode.Terminal(os.Stdout, uri); err != nil {
+				return "", err
+			}
+		}
+		fmt.Printf("\nOr enter the secret by hand: %s\n\n", secret)
+
+		if stdinIsTerminal() {
+			code, err := readSecret("Code shown by the app")
+			if err != nil {
+				return "", err
+			}
+			if !stepup.CheckTOTP(secret, code) {
+				return "", errors.New("wrong code, check the clock of the phone and try again")
+			}
+		}
+
+		user.TOTPSecret = secret
+		return "Authenticator app set up", nil
+	})
+}
+
+func newFactorClearCmd(cfg *config.Config) *cobra.Command {
+	var (
+		selection userSelection
+		pin, totp bool
+	)
+
+	cmd := &cobra.Command{
+		Use:         "clear",
+		Short:       "Remove a user's PIN or authenticator app",
+		Annotations: recordAlways(),
+		Long: `Remove a user's PIN (--pin), authenticator app (--totp), or both when neither
+is given. Verifications that need a second factor then fail for the user.`,
+		Example: `  face factor clear --user-id abc123
+  face factor clear --user-id abc123 --totp`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !pin && !totp {
+				pin, totp = true, true
+			}
+			return updateFactor(cfg, selection, func(user *models.User) (string, error) {
+				if pin {
+					user.PINHash = ""
+				}
+				if totp {
+					user.TOTPSecret = ""
+				}
+				return "Second factor removed", nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&selection.ID, "user-id", "u", "", "user ID or unique prefix")
+	cmd.Flags().BoolVar(&pin, "pin", false, "remove the PIN")
+	cmd.Flags().BoolVar(&totp, "totp", false, "remove the authenticator app")
+	selection.addNameFlags(cmd, "user-id", false)
+
+	return cmd
+}
+
+// updateFactor selects a user, lets set change their second factors and
+// saves them, printing the message set returns
+func updateFactor(cfg *config.Config, selection userSelection, set func(user *models.User) (string, error)) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	users, err := selectUsers(db, selection)
+	if err != nil {
+		return err
+	}
+	user := &users[0]
+
+	message, err := set(user)
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateUser(user); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	slog.Info("second factor changed", "user_id", user.ID, "pin", user.PINHash != "", "totp", user.TOTPSecret != "")
+	fmt.Printf("✓ %s for %s\n", message, user.Name)
+	return nil
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"fmt"
+
+	"face/config"
+	"face/internal/compression"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/gallery"
+
+	"github.com/spf13/cobra"
+)
+
+// galleryChangeBatch is how many change log entries a delta reads at once
+const galleryChangeBatch = 1000
+
+func NewGalleryCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gallery",
+		Short: "Export the gallery for offline devices",
+		Long: `Export the enrolled embeddings and user names as a compact binary bundle
+for devices that identify faces offline. A snapshot holds the whole gallery;
+a delta holds only the users changed since an earlier revision, so devices
+can stay current without downloading everything again. Bundles named *.gz or
+*.zst are compressed.
+
+Revisions are change log sequence numbers (see 'face cdc'). A snapshot may
+already include changes after its revision; applying a delta since that
+revision is still safe because every delta entry replaces the whole user.
+
+With --device (or "device" in the config file), bundles hold only the users
+the device identifies, see 'face scope'; a delta deletes users who left its
+scope.`,
+	}
+
+	cmd.AddCommand(newGallerySnapshotCmd(cfg))
+	cmd.AddCommand(newGalleryDeltaCmd(cfg))
+	cmd.AddCommand(newGalleryInspectCmd())
+
+	return cmd
+}
+
+func newGallerySnapshotCmd(cfg *config.Config) *cobra.Command {
+	var out string
+
+	cmd := &cobra.Command{
+		Use:     "snapshot",
+		Short:   "Export the whole gallery",
+		Example: `  face gallery snapshot --out gallery.bin`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGallerySnapshot(cfg, out)
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "bundle file to write (required)")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func newGalleryDeltaCmd(cfg *config.Config) *cobra.Command {
+	var (
+		since int64
+		out   string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "delta",
+		Short:   "Export the users changed since a revision",
+		Example: `  face gallery delta --since 1042 --out delta.bin`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGalleryDelta(cfg, since, out)
+		},
+	}
+
+	cmd.Flags().Int64Var(&since, "since", 0, "revision of the device's gallery (required)")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "bundle file to write (required)")
+	_ = cmd.MarkFlagRequired("since")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func newGalleryInspectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "inspect <bundle>",
+		Short:   "Describe a gallery bundle",
+		Example: `  face gallery inspect gallery.bin`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGalleryInspect(args[0])
+		},
+	}
+}
+
+func runGallerySnapshot(cfg *config.Config, out string) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	bundle, err := gallerySnapshot(db, cfg.Device)
+	if err != nil {
+		return err
+	}
+
+	if err := writeBundle(bundle, out); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Wrote snapshot of %d user(s) at revision %d to %s\n", len(bundle.Entries), bundle.Revision, out)
+	return nil
+}
+
+func runGalleryDelta(cfg *config.Config, since int64, out string) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	bundle, err := galleryDelta(db, since, cfg.Device)
+	if err != nil {
+		return err
+	}
+
+	if err := writeBundle(bundle, out); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Wrote delta of %d user(s) from revision %d to %d to %s\n", len(bundle.Entries), since, bundle.Revision, out)
+	return nil
+}
+
+// gallerySnapshot returns a bundle of every enrolled user identified in a
+// scope, see models.User.InScope
+func gallerySnapshot(db database.Database, scope string) (*gallery.Bundle, error) {
+	// Read the revision first, so changes made while exporting are
+	// included again by the next delta
+	var revision int64
+	if changeLog, ok := db.(database.ChangeLog); ok {
+		var err error
+		if revision, err = changeLog.LatestChange(); err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	bundle := &gallery.Bundle{Revision: revision}
+	for i := range users {
+		if users[i].InScope(scope) {
+			bundle.Entries = append(bundle.Entries, galleryUpsert(&users[i]))
+		}
+	}
+	return bundle, nil
+}
+
+// galleryUpsert returns the entry adding or replacing a user
+func galleryUpsert(user *models.User) gallery.Entry {
+	entry := gallery.Entry{Op: gallery.OpUpsert, UserID: user.ID, Name: user.Name}
+	for _, f := range user.Faces {
+		entry.Faces = append(entry.Faces, gallery.Face{ID: f.ID, Embedding: f.Embedding})
+	}
+	return entry
+}
+
+// galleryDelta returns a bundle of the users changed after since, with
+// deleted users and users no longer identified in scope marked deleted
+func galleryDelta(db database.Database, since int64, scope string) (*gallery.Bundle, error) {
+	changeLog, ok := db.(database.ChangeLog)
+	if !ok {
+		return nil, database.ErrChangeLogUnsupported
+	}
+
+	userIDs, revision, err := changedUsers(changeLog, since)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &gallery.Bundle{Delta: true, From: since, Revision: revision}
+	for _, id := range userIDs {
+		user, err := db.GetUser(id)
+		switch {
+		case err == nil && user.InScope(scope):
+			bundle.Entries = append(bundle.Entries, galleryUpsert(user))
+		case err == nil, err == models.ErrUserNotFound:
+			bundle.Entries = append(bundle.Entries, gallery.Delete(id))
+		default:
+			return nil, fmt.Errorf("failed to get user %s: %w", id, err)
+		}
+	}
+	return bundle, nil
+}
+
+// changedUsers returns the users with changes after since, in the order
+// they first changed, and the latest change read
+func changedUsers(changeLog database.ChangeLog, since int64) ([]string, int64, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	revision := since
+
+	for {
+		changes, err := changeLog.ChangesSince(revision, galleryChangeBatch)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, c := range changes {
+			if !seen[c.UserID] {
+				seen[c.UserID] = true
+				ids = append(ids, c.UserID)
+			}
+			revision = c.Seq
+		}
+		if len(changes) < galleryChangeBatch {
+			return ids, revision, nil
+		}
+	}
+}
+
+func writeBundle(bundle *gallery.Bundle, path string) error {
+	file, err := compression.Create(path, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	defer file.Close()
+
+	if err := bundle.Write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func runGalleryInspect(path string) error {
+	file, err := compression.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	bundle, err := gallery.Read(file)
+	if err != nil {
+		return err
+	}
+
+	dim, _ := bundle.Dimension()
+	faces, deletes := 0, 0
+	for _, e := range bundle.Entries {
+		faces += len(e.Faces)
+		if e.Op == gallery.OpDelete {
+			deletes++
+		}
+	}
+
+	if bundle.Delta {
+		fmt.Printf("Delta from revision %d to %d\n", bundle.From, bundle.Revision)
+	} else {
+		fmt.Printf("Snapshot at revision %d\n", bundle.Revision)
+	}
+	fmt.Printf("  Format version: %d\n", gallery.FormatVersion)
+	fmt.Printf("  Users:          %d (%d deleted)\n", len(bundle.Entries), deletes)
+	fmt.Printf("  Faces:          %d\n", faces)
+	fmt.Printf("  Dimension:      %d\n", dim)
+	return nil
+}
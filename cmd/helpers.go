@@ -1,56 +1,224 @@
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
+	"io"
+	"os"
+	"sync"
 
 	"face/config"
+	"face/internal/apierror"
 	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/deadline"
 	"face/internal/face"
+	"face/internal/faultinject"
+	"face/internal/hooks"
+	"face/internal/imaging"
+	"face/internal/liveness"
+	"face/internal/modelfiles"
+	"face/internal/pipeline"
+	"face/internal/pipeline/modelspec"
+	"face/internal/provenance"
+	"face/internal/quality"
 	"face/internal/storage"
+	"face/matching"
 )
 
 type FaceSystem struct {
 	DB        database.Database
-	Storage   *storage.FileSystemStorage
-	Detector  *face.Detector
-	Extractor face.Extractor
+	Storage   storage.Storage
+	Detector  pipeline.Detector
+	Extractor pipeline.Extractor
+	// CropSize is the size face crops are normalized to, 0 for native
+	CropSize int
+	// ImageLimits bounds the size of the images processed
+	ImageLimits imaging.Limits
+	// Liveness scores faces for presentation attacks; faces are not scored
+	// if nil
+	Liveness liveness.Model
+	// Decay discounts the similarity of faces enrolled long ago
+	Decay matching.Decay
+	// Strategy is how a user's faces are combined into their similarity
+	Strategy matching.Strategy
+
+	faults *faultinject.Injector
+	// ctx bounds the stages of a FaceSystem returned by WithContext
+	ctx context.Context
+	// stages counts the stages still running, including those abandoned
+	// when ctx ended, so the detector and extractor are only reused once
+	// they finish
+	stages *sync.WaitGroup
+	// pooled is the worker a FaceSystem returned by WithContext was made
+	// from
+	pooled *FaceSystem
+}
+
+// WithContext returns a copy of fs whose detection, extraction, liveness,
+// storage and database calls return a deadline.Error once the deadline of
+// ctx passes, rather than blocking on a hung camera or a slow disk
+func (fs *FaceSystem) WithContext(ctx context.Context) *FaceSystem {
+	bound := *fs
+	bound.ctx = deadline.WithStages(ctx, fs.stages)
+	bound.DB = deadline.WrapDatabase(fs.DB, bound.ctx)
+	bound.pooled = fs
+	return &bound
+}
+
+// stageEnded reports whether a stage failed because the context of fs
+// ended rather than on its own
+func stageEnded(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
 }
 
 func NewFaceSystem(cfg *config.Config) (*FaceSystem, error) {
-	db, err := cfg.GetDatabaseConnection()
+	limits, err := cfg.ImageLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	stor, err := storage.NewFileSystemStorage(cfg.FacesDir)
+	settings, err := db.GetSettings()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+	strategy, err := cfg.Strategy(settings.MatchStrategy)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	stor, err := cfg.GetStorage(db)
 	if err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
-	detector, err := face.NewDetector(cfg.ModelsDir)
+	livenessModel, err := cfg.Liveness()
 	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to initialize detector: %w", err)
+		return nil, err
 	}
 
-	extractor, err := face.NewExtractor(cfg.ModelsDir)
+	// the gallery's model, chosen with 'face model use', unless the config
+	// selects one
+	modelCfg := cfg.WithGalleryModel(settings.EmbeddingModel)
+	detector, extractor, err := newPipeline(modelCfg)
 	if err != nil {
 		db.Close()
+		return nil, err
+	}
+
+	// the model is recorded with a new gallery only once it has loaded
+	if err := checkEmbeddingModel(modelCfg, db, settings); err != nil {
+		extractor.Close()
 		detector.Close()
-		return nil, fmt.Errorf("failed to initialize extractor: %w", err)
+		db.Close()
+		return nil, err
 	}
 
 	return &FaceSystem{
-		DB:        db,
-		Storage:   stor,
-		Detector:  detector,
-		Extractor: extractor,
+		DB:          db,
+		Storage:     stor,
+		Detector:    detector,
+		Extractor:   extractor,
+		CropSize:    settings.CropSize,
+		ImageLimits: limits,
+		Liveness:    livenessModel,
+		Decay:       cfg.ConfidenceDecay(),
+		Strategy:    strategy,
+		faults:      cfg.FaultInjector(),
+		stages:      new(sync.WaitGroup),
 	}, nil
 }
 
+// newBoundFaceSystem initializes the face system of a command with a
+// timeout, bound to its context
+func newBoundFaceSystem(ctx context.Context, cfg *config.Config) (*FaceSystem, error) {
+	fs, err := deadline.Do(ctx, "initialization", func() (*FaceSystem, error) {
+		return NewFaceSystem(cfg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fs.WithContext(ctx), nil
+}
+
+// newPipeline initializes the face detector and extractor of the configured
+// pipeline backend
+func newPipeline(cfg *config.Config) (pipeline.Detector, pipeline.Extractor, error) {
+	backend, err := modelspec.ParseBackend(cfg.PipelineBackend)
+	if err != nil {
+		return nil, nil, err
+	}
+	if backend == modelspec.BackendMock {
+		detector, extractor := pipeline.NewMock()
+		return detector, extractor, nil
+	}
+
+	model, useONNX, err := cfg.ONNXModel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detector, err := newDetector(cfg.ModelsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if useONNX {
+		return newONNXPipeline(cfg, detector, model)
+	}
+
+	extractor, err := face.NewExtractor(cfg.ModelsDir)
+	if err != nil {
+		detector.Close()
+		return nil, nil, fmt.Errorf("failed to initialize extractor: %w", err)
+	}
+
+	wrappedDetector, wrappedExtractor := pipeline.NewPigo(detector, extractor, cfg.ModelsDir)
+	return wrappedDetector, wrappedExtractor, nil
+}
+
+// newONNXPipeline pairs the detector with the ONNX embedding model selected
+// in the config, closing the detector if the model cannot be loaded
+func newONNXPipeline(cfg *config.Config, detector *face.Detector, model modelspec.ONNXModel) (pipeline.Detector, pipeline.Extractor, error) {
+	extractor, err := pipeline.NewONNX(model, cfg.ONNXRuntime)
+	if err != nil {
+		detector.Close()
+		return nil, nil, fmt.Errorf("failed to initialize extractor: %w", err)
+	}
+	return pipeline.NewPigoDetector(detector, cfg.ModelsDir), extractor, nil
+}
+
+// newDetector initializes the face detector, reporting exactly which model
+// files are missing when initialization fails because of them
+func newDetector(modelsDir string) (*face.Detector, error) {
+	detector, err := face.NewDetector(modelsDir)
+	if err != nil {
+		if missingErr := modelfiles.Require(modelsDir); missingErr != nil {
+			return nil, missingErr
+		}
+		return nil, fmt.Errorf("failed to initialize detector: %w", err)
+	}
+	return detector, nil
+}
+
+// Close closes the database, detector and extractor. A FaceSystem whose
+// context ended closes nothing, as a stage it abandoned may still use them.
 func (fs *FaceSystem) Close() {
+	if fs.ctx != nil && fs.ctx.Err() != nil {
+		return
+	}
 	if fs.DB != nil {
 		fs.DB.Close()
 	}
@@ -67,31 +235,209 @@ type FaceResult struct {
 	CroppedFace  image.Image
 	Embedding    []float32
 	QualityScore float64
+	// Scores are the sub-scores the hints of a poor face are derived from
+	Scores quality.Scores
+	// Box is where the face is in Image
+	Box image.Rectangle
+	// SpoofScore is how likely the face is a printed photo or a screen
+	// rather than a live person, from 0 to 1
+	SpoofScore float64
+	// SourceSHA256 is the hash of the image file, recorded in the
+	// provenance of the stored crop; empty if Image is not from a file
+	SourceSHA256 string
 }
 
 func (fs *FaceSystem) ProcessImage(imagePath string) (*FaceResult, error) {
-	img, err := fs.Storage.LoadImageFromPath(imagePath)
+	source, err := deadline.Do(fs.ctx, "image loading", func() (*provenance.Source, error) {
+		return readInputImage(imagePath, fs.ImageLimits)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := fs.ProcessDecodedImage(source.Image)
+	if err != nil {
+		return nil, err
+	}
+	result.SourceSHA256 = source.SHA256
+	return result, nil
+}
+
+// readInputImage decodes an image file and hashes it
+func readInputImage(imagePath string, limits imaging.Limits) (*provenance.Source, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image: %w", err)
+	}
+	defer file.Close()
+
+	img, err := storage.DecodeInputImage(file, limits)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load image: %w", err)
 	}
+	sum, err := sourceSHA256(file)
+	if err != nil {
+		return nil, err
+	}
+	return &provenance.Source{Image: img, SHA256: sum}, nil
+}
+
+// sourceSHA256 returns the hex SHA-256 of a whole image file
+func sourceSHA256(file io.ReadSeeker) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to read image file: %w", err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read image file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// saveFace stores the crop of a processed face with the hash of its source
+// image, returning the filename to record
+func (fs *FaceSystem) saveFace(userID, faceID string, result *FaceResult) (string, error) {
+	return deadline.Do(fs.ctx, "storage", func() (string, error) {
+		return fs.Storage.SaveImage(userID, faceID, &provenance.Source{Image: result.CroppedFace, SHA256: result.SourceSHA256})
+	})
+}
+
+// printQualityHints prints what the person in an image can do about the
+// problems of their face, if it has any
+func printQualityHints(indent string, result *FaceResult) {
+	for _, hint := range result.Scores.Hints() {
+		fmt.Printf("%s⚠ %s\n", indent, hint.Message)
+	}
+}
+
+// printProbe prints the face detected in a probe image, with what the
+// person can do about its problems
+func printProbe(result *FaceResult, livenessChecked bool) {
+	fmt.Printf("✓ Face detected (quality: %.2f, spoof score: %.2f)\n", result.QualityScore, result.SpoofScore)
+	printQualityHints("", result)
+
+	if result.QualityScore < 0.2 {
+		fmt.Println("⚠ Warning: Low quality face detected, results may be inaccurate")
+	}
+	if livenessChecked {
+		fmt.Println("✓ Liveness check passed")
+	}
+}
+
+// checkLiveness returns an error with the code spoof_detected if a face
+// scores above the configured spoof threshold
+func checkLiveness(cfg *config.Config, spoofScore float64) error {
+	threshold := cfg.SpoofThreshold()
+	if spoofScore <= threshold {
+		return nil
+	}
+	return apierror.Wrap(apierror.CodeSpoofDetected, fmt.Errorf("%w (spoof score %.2f, maximum %.2f)", models.ErrSpoofDetected, spoofScore, threshold)).
+		WithDetail("spoof_score", spoofScore).WithDetail("threshold", threshold)
+}
+
+// ProcessDecodedImage detects the largest face in an image that is already
+// decoded and extracts its embedding
+func (fs *FaceSystem) ProcessDecodedImage(img image.Image) (*FaceResult, error) {
+	if err := fs.faults.Fail(faultinject.Detector, "DetectLargestFace"); err != nil {
+		return nil, err
+	}
+
+	img, err := hooks.BeforeDetect(img)
+	if err != nil {
+		return nil, err
+	}
+	detection, err := deadline.Do(fs.ctx, "detection", func() (*pipeline.Detection, error) {
+		return fs.Detector.DetectLargestFace(img)
+	})
+	if stageEnded(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, models.ErrFaceNotDetected
+	}
+	detections, err := hooks.AfterDetect(img, []*pipeline.Detection{detection})
+	if err != nil {
+		return nil, err
+	}
+	if len(detections) == 0 {
+		return nil, models.ErrFaceNotDetected
+	}
 
-	faceRect, err := fs.Detector.DetectLargestFace(img)
+	return fs.embedDetection(img, detections[0])
+}
+
+// DetectFaces finds every face in an image that is already decoded,
+// largest first, without extracting embeddings
+func (fs *FaceSystem) DetectFaces(img image.Image) ([]*pipeline.Detection, error) {
+	if err := fs.faults.Fail(faultinject.Detector, "DetectFaces"); err != nil {
+		return nil, err
+	}
+	img, err := hooks.BeforeDetect(img)
+	if err != nil {
+		return nil, err
+	}
+	detections, err := deadline.Do(fs.ctx, "detection", func() ([]*pipeline.Detection, error) {
+		return fs.Detector.DetectFaces(img)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("no face detected in image")
+		return nil, err
 	}
+	return hooks.AfterDetect(img, detections)
+}
 
-	croppedFace := fs.Detector.CropFace(img, faceRect)
-	qualityScore := fs.Detector.CalculateQuality(img, faceRect)
+// embedDetection normalizes the crop of a detected face and extracts its
+// embedding
+func (fs *FaceSystem) embedDetection(img image.Image, detection *pipeline.Detection) (*FaceResult, error) {
+	croppedFace := detection.Crop
+	if fs.CropSize > 0 {
+		croppedFace = imaging.NormalizeCrop(croppedFace, fs.CropSize)
+	}
+	qualityScore := detection.Quality
 
-	embedding, err := fs.Extractor.Extract(croppedFace)
+	croppedFace, err := hooks.BeforeExtract(croppedFace)
+	if err != nil {
+		return nil, err
+	}
+	embedding, err := deadline.Do(fs.ctx, "extraction", func() ([]float32, error) {
+		return fs.Extractor.Extract(croppedFace)
+	})
+	if stageEnded(err) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract embedding: %w", err)
 	}
+	if embedding, err = hooks.AfterExtract(croppedFace, embedding); err != nil {
+		return nil, err
+	}
+
+	spoofScore, err := fs.scoreLiveness(img, detection.Box)
+	if err != nil {
+		return nil, err
+	}
 
 	return &FaceResult{
 		Image:        img,
 		CroppedFace:  croppedFace,
 		Embedding:    embedding,
 		QualityScore: qualityScore,
+		Scores:       quality.Analyze(img, detection.Box),
+		Box:          detection.Box,
+		SpoofScore:   spoofScore,
 	}, nil
 }
+
+// scoreLiveness scores a detected face for presentation attacks, 0 if fs
+// has no liveness model
+func (fs *FaceSystem) scoreLiveness(img image.Image, box image.Rectangle) (float64, error) {
+	if fs.Liveness == nil {
+		return 0, nil
+	}
+	spoofScore, err := deadline.Do(fs.ctx, "liveness", func() (float64, error) {
+		return fs.Liveness.Score(img, box)
+	})
+	if err != nil && !stageEnded(err) {
+		return 0, fmt.Errorf("failed to score liveness: %w", err)
+	}
+	return spoofScore, err
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/history"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// historyAnnotation marks the commands recorded in the history file. An
+// empty value records every run, a flag name records only runs with that
+// flag set, and "!flag" records only runs without it.
+const historyAnnotation = "face:history"
+
+// recordAlways is the annotation of commands that always change something
+func recordAlways() map[string]string {
+	return map[string]string{historyAnnotation: ""}
+}
+
+// recordWith is the annotation of commands that change something only when
+// flag is set, or unless it is set if flag starts with '!'
+func recordWith(flag string) map[string]string {
+	return map[string]string{historyAnnotation: flag}
+}
+
+// historyDisabled is the history_file value that turns recording off
+const historyDisabled = "none"
+
+func NewHistoryCmd(cfg *config.Config) *cobra.Command {
+	var (
+		limit      int
+		failed     bool
+		formatJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the commands that changed data on this machine",
+		Long: `Show the commands recorded in the local history file (history_file in
+the config, FACE_CLI_HISTORY_FILE, default face.history.jsonl).
+
+Every run of a command that changes the database, the face images or the
+settings is recorded with its flags, the operator's login, the result and
+how long it took, whether or not it succeeded. Passwords in connection
+strings are redacted. The history is kept apart from the database, so it
+also shows commands that failed to reach it.`,
+		Example: `  face history
+  face history --failed --limit 50
+  face history --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHistory(cfg, limit, failed, formatJSON)
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "l", 20, "number of most recent entries to show (0 = all)")
+	cmd.Flags().BoolVar(&failed, "failed", false, "show only commands that failed")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func runHistory(cfg *config.Config, limit int, failed, formatJSON bool) error {
+	if cfg.HistoryFile == "" || cfg.HistoryFile == historyDisabled {
+		return fmt.Errorf("command history is disabled (history_file is %q)", cfg.HistoryFile)
+	}
+
+	entries, err := history.Read(cfg.HistoryFile)
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		var kept []history.Entry
+		for _, e := range entries {
+			if e.Error != "" {
+				kept = append(kept, e)
+			}
+		}
+		entries = kept
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	if formatJSON {
+		if entries == nil {
+			entries = []history.Entry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No commands recorded.")
+		return nil
+	}
+
+	fmt.Printf("%-19s  %-12s  %-8s  %8s  %s\n", "TIME", "USER", "RESULT", "DURATION", "COMMAND")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, e := range entries {
+		result := "✓ ok"
+		if e.Error != "" {
+			result = "✗ failed"
+		}
+		fmt.Printf("%-19s  %-12s  %-8s  %7dms  %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.User, result, e.DurationMS, historyCommandLine(&e))
+		if e.Error != "" {
+			fmt.Printf("    %s\n", e.Error)
+		}
+	}
+	return nil
+}
+
+// historyCommandLine formats an entry as the command line that was run
+func historyCommandLine(e *history.Entry) string {
+	parts := []string{e.Command}
+	names := make([]string, 0, len(e.Flags))
+	for name := range e.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("--%s=%s", name, e.Flags[name]))
+	}
+	return strings.Join(append(parts, e.Args...), " ")
+}
+
+// RecordHistory appends a run of c to the history file if c is annotated
+// as changing data. runErr is the result of the command.
+func RecordHistory(cfg *config.Config, c *cobra.Command, requestID string, started time.Time, runErr error) error {
+	if c == nil || cfg.HistoryFile == "" || cfg.HistoryFile == historyDisabled || !recordsHistory(c) {
+		return nil
+	}
+
+	entry := &history.Entry{
+		Time:       started,
+		Command:    c.CommandPath(),
+		Args:       c.Flags().Args(),
+		Flags:      map[string]string{},
+		RequestID:  requestID,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	if runErr != nil {
+		entry.Error = runErr.Error()
+	}
+
+	c.Flags().Visit(func(f *pflag.Flag) {
+		value := f.Value.String()
+		if f.Name == "db" {
+			value = config.RedactConnectionString(value)
+		}
+		entry.Flags[f.Name] = value
+	})
+
+	return history.Append(cfg.HistoryFile, entry)
+}
+
+// recordsHistory reports whether a run of c with its current flags is
+// recorded, according to its historyAnnotation
+func recordsHistory(c *cobra.Command) bool {
+	flag, ok := c.Annotations[historyAnnotation]
+	if !ok {
+		return false
+	}
+	if flag == "" {
+		return true
+	}
+	if name, negated := strings.CutPrefix(flag, "!"); negated {
+		return !flagSet(c, name)
+	}
+	return flagSet(c, flag)
+}
+
+// flagSet reports whether a flag was given on the command line with a
+// value other than false
+func flagSet(c *cobra.Command, name string) bool {
+	f := c.Flags().Lookup(name)
+	return f != nil && f.Changed && f.Value.String() != "false"
+}
@@ -1,13 +1,18 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
 	"face/config"
 	"face/internal/database/models"
-	"face/internal/face"
+	"face/internal/deadline"
+	"face/internal/notify"
+	"face/internal/redaction"
+	"face/internal/wiegand"
 
 	"github.com/spf13/cobra"
 )
@@ -16,55 +21,118 @@ func NewIdentifyCmd(cfg *config.Config) *cobra.Command {
 	var (
 		imagePath string
 		threshold float64
+		enrich    bool
+		camera    string
+		liveness  bool
+		timeout   time.Duration
+		save      bool
+		allScopes bool
 	)
 
 	cmd := &cobra.Command{
-		Use:   "identify",
-		Short: "Identify a person from an image",
+		Use:         "identify",
+		Short:       "Identify a person from an image",
+		Annotations: recordWith("enrich"),
 		Long: `Identify a person by analyzing their face in a provided image.
-The system will detect the face, extract embeddings, and match against the database.`,
+The system will detect the face, extract embeddings, and match against the database.
+
+When wiegand_output is set in the config (or FACE_CLI_WIEGAND_OUT), the card
+number of the identified user is sent there as a Wiegand frame, so a door
+controller can treat the match like the user presenting their card.
+
+Without --image, --camera takes a snapshot from a camera configured in the
+config file, see 'face cameras'. With --image, it only names the camera the
+image is from.
+
+When mqtt_broker is set (or FACE_CLI_MQTT_BROKER), the result is published for
+Home Assistant, see 'face mqtt'. Matches of users on the watchlist send the
+watchlist_match notifications, see 'face notify'.
+
+With --enrich (or "auto_enrich": true in the config file), a probe matched with
+very high confidence and good quality is added to the user's faces, unless it
+is nearly identical to an existing face. When the user has the maximum number
+of faces, the lowest quality one is replaced. This keeps templates fresh as
+people age.
+
+With --require-liveness (or "require_liveness": true in the config file), a
+face that looks like a printed photo or a screen rather than a live person is
+rejected before matching, see 'Liveness' in the README.
+
+With --timeout, identification gives up with a timeout error once it has
+taken that long, instead of waiting on a hung camera or a slow disk.
+
+With --save-probe, the crop and embedding of the face are kept with the
+decision and linked to its audit event, so a contested decision ("it said it
+was me but it wasn't") can be reviewed later with 'face audit probe'. Probes
+are deleted with the audit events past audit_retention_days and when their
+user is purged. Needs the sqlite or postgres database.
+
+With --device (or "device" in the config file), only the users of the
+device's org, site and device, and users with no scope, are matched, see
+'face scope'. --all-scopes matches everyone.`,
 		Example: `  face identify --image photo.jpg
-  face identify --image unknown.jpg --threshold 0.7`,
+  face identify --image unknown.jpg --threshold 0.7
+  face identify --image gate.jpg --enrich
+  face identify --image snapshot.jpg --camera "Front door"
+  face identify --camera front-door --require-liveness
+  face identify --camera front-door --timeout 5s
+  face identify --camera front-door --save-probe
+  face identify --device acme/berlin/lobby-door --image visitor.jpg`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runIdentify(cfg, imagePath, threshold)
+			if timeout < 0 {
+				return errors.New("--timeout must not be negative")
+			}
+			if allScopes {
+				cfg.Device = ""
+			}
+			return runIdentify(cfg, imagePath, threshold, enrich || cfg.AutoEnrich, camera, liveness, timeout, save)
 		},
 	}
 
-	cmd.Flags().StringVarP(&imagePath, "image", "i", "", "path to image file (required)")
+	cmd.Flags().StringVarP(&imagePath, "image", "i", "", "path to image file")
 	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
-	err := cmd.MarkFlagRequired("image")
-	if err != nil {
-		log.Fatal(err)
-		return nil
-	}
+	cmd.Flags().BoolVar(&enrich, "enrich", false, "add confidently matched probes to the user's faces")
+	cmd.Flags().StringVar(&camera, "camera", "", "configured camera to take a snapshot from, or camera the image is from")
+	cmd.Flags().BoolVar(&liveness, "require-liveness", cfg.RequireLiveness, "reject faces that look like a printed photo or a screen")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "give up after this long, e.g. 30s (default no limit)")
+	cmd.Flags().BoolVar(&save, "save-probe", false, "keep the face and decision for review, see 'face audit probe'")
+	cmd.Flags().BoolVar(&allScopes, "all-scopes", false, "match the users of every org, site and device, not only the --device's")
+	cmd.MarkFlagsOneRequired("image", "camera")
 
 	return cmd
 }
 
-func runIdentify(cfg *config.Config, imagePath string, threshold float64) error {
+func runIdentify(cfg *config.Config, imagePath string, threshold float64, enrich bool, camera string, requireLiveness bool, timeout time.Duration, save bool) (err error) {
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
 	fmt.Println("Initializing face recognition system...")
 
-	fs, err := NewFaceSystem(cfg)
+	ctx, cancel := deadline.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	fs, err := newBoundFaceSystem(ctx, cfg)
 	if err != nil {
 		return err
 	}
 	defer fs.Close()
 
-	matcher := face.NewMatcher(fs.DB)
+	if err := checkProbeStore(fs.DB, save); err != nil {
+		return err
+	}
+	audit := startAudit(cfg, fs.DB, models.AuditIdentify, "")
+	defer func() { audit.finish(err) }()
 
-	fmt.Printf("\nAnalyzing image: %s\n\n", imagePath)
-	fmt.Println("Detecting face...")
+	matcher := newIdentifier(fs.DB, fs.Decay, fs.Strategy, cfg.Device)
 
-	result, err := fs.ProcessImage(imagePath)
+	result, err := identifyProbe(cfg, fs, imagePath, camera, requireLiveness)
 	if err != nil {
 		return err
 	}
+	defer func() { saveProbe(fs, &audit.event, result, threshold, save, err) }()
 
-	fmt.Printf("✓ Face detected (quality: %.2f)\n", result.QualityScore)
-
-	if result.QualityScore < 0.2 {
-		fmt.Println("⚠ Warning: Low quality face detected, results may be inaccurate")
-	}
+	printProbe(result, requireLiveness)
 
 	users, err := fs.DB.ListUsers()
 	if err != nil {
@@ -72,15 +140,18 @@ func runIdentify(cfg *config.Config, imagePath string, threshold float64) error
 	}
 
 	if len(users) == 0 {
+		audit.event.Result = models.AuditNoMatch
 		fmt.Println("\n✗ Database is empty")
 		fmt.Println("  Please enroll at least one user first using:")
 		fmt.Println("  face enroll --name \"Your Name\" --images \"photo.jpg\"")
 		return nil
 	}
 
-	fmt.Printf("Matching against %d users in database...\n", len(users))
+	fmt.Println(matchingAgainst(cfg.Device, len(users)))
 
-	allMatches, err := matcher.FindBestMatches(result.Embedding, 5)
+	allMatches, err := deadline.Do(ctx, "matching", func() ([]models.MatchResult, error) {
+		return matcher.FindBestMatches(result.Embedding, 5)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to find matches: %w", err)
 	}
@@ -88,43 +159,166 @@ func runIdentify(cfg *config.Config, imagePath string, threshold float64) error
 	if len(allMatches) > 0 {
 		fmt.Println("\nTop matches:")
 		for i, match := range allMatches {
-			fmt.Printf("  %d. %s (%.2f%%)\n", i+1, match.User.Name, match.Confidence*100)
+			fmt.Printf("  %d. %s (%.2f%%%s)\n", i+1, redactor.Label(match.User), match.Confidence*100, votesLabel(match.Votes))
 		}
 		fmt.Println()
 	}
 
-	match, err := matcher.Match(result.Embedding, threshold)
+	match, err := deadline.Do(ctx, "matching", func() (*models.MatchResult, error) {
+		return matcher.Match(result.Embedding, threshold)
+	})
 	if err != nil {
 		if errors.Is(err, models.ErrNoMatch) {
+			audit.event.Result = models.AuditNoMatch
+			slog.Info("identification", "matched", false, "threshold", threshold)
 			fmt.Println("✗ No match found")
 			fmt.Printf("  No user matched with confidence >= %.0f%%\n", threshold*100)
+			if cfg.MQTTBroker != "" {
+				publishRecognition(cfg, redactor, nil, camera)
+			}
 			return nil
 		}
 		return fmt.Errorf("matching failed: %w", err)
 	}
 
-	printMatchResult(match)
+	audit.event.UserID, audit.event.Confidence = match.User.ID, match.Confidence
+	slog.Info("identification", "matched", true, "user_id", redactor.UserID(match.User.ID), "face_id", redactor.FaceID(match.FaceID), "confidence", match.Confidence)
+	printMatchResult(redactor, match)
+	if cfg.WiegandOutput != "" {
+		signalDoor(cfg, redactor, match.User)
+	}
+	if cfg.MQTTBroker != "" {
+		publishRecognition(cfg, redactor, match, camera)
+	}
+	if cfg.Notify().OnWatchlist(match.User) {
+		notifyUser(cfg, notify.EventWatchlistMatch, match.User, match.Confidence, camera)
+	}
+
+	if enrich {
+		return enrichIdentified(cfg, fs, redactor, match, result)
+	}
+
+	return nil
+}
+
+// enrichIdentified adds the probe to the identified user's faces if it
+// qualifies, reporting whether it did
+func enrichIdentified(cfg *config.Config, fs *FaceSystem, redactor *redaction.Redactor, match *models.MatchResult, result *FaceResult) error {
+	reason, err := enrichUser(cfg, fs, match, result)
+	if err != nil {
+		return fmt.Errorf("auto-enrichment failed: %w", err)
+	}
+	if reason != "" {
+		fmt.Printf("\n• Probe not added to %s's faces: %s\n", redactor.Label(match.User), reason)
+	} else {
+		fmt.Printf("\n✓ Probe added to %s's faces\n", redactor.Label(match.User))
+	}
 	return nil
 }
 
-func printMatchResult(match *models.MatchResult) {
+// identifyProbe detects the face to identify in the image file or, without
+// one, in a snapshot of the camera, checking its liveness if required
+func identifyProbe(cfg *config.Config, fs *FaceSystem, imagePath, camera string, requireLiveness bool) (*FaceResult, error) {
+	var result *FaceResult
+	var err error
+	if imagePath == "" {
+		fmt.Printf("\nTaking a snapshot from camera: %s\n\n", camera)
+		fmt.Println("Detecting face...")
+		result, err = processCameraSnapshot(cfg, fs, camera)
+	} else {
+		fmt.Printf("\nAnalyzing image: %s\n\n", imagePath)
+		fmt.Println("Detecting face...")
+		result, err = fs.ProcessImage(imagePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if requireLiveness {
+		if err := checkLiveness(cfg, result.SpoofScore); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// signalDoor sends the card number of an identified user to the door
+// controller output. Failures are reported as warnings, since the match
+// itself succeeded.
+func signalDoor(cfg *config.Config, redactor *redaction.Redactor, user *models.User) {
+	if user.CardNumber == "" {
+		fmt.Printf("\n• %s has no card number, nothing sent to the door controller\n", redactor.Label(user))
+		return
+	}
+
+	format, err := sendCardNumber(cfg, user)
+	if err != nil {
+		fmt.Printf("Warning: card number not sent to the door controller: %v\n", err)
+		return
+	}
+
+	slog.Info("door signalled", "user_id", redactor.UserID(user.ID), "format", format)
+	fmt.Printf("\n✓ Card number sent to the door controller (%s-bit Wiegand)\n", format)
+}
+
+// sendCardNumber writes the card number of a user to the door controller
+// output as a Wiegand frame, returning its format
+func sendCardNumber(cfg *config.Config, user *models.User) (wiegand.Format, error) {
+	format, err := cfg.Wiegand()
+	if err != nil {
+		return "", err
+	}
+	frame, err := wiegand.Encode(format, cfg.WiegandFacilityCode, user.CardNumber)
+	if err != nil {
+		return "", err
+	}
+	return format, wiegand.Write(cfg.WiegandOutput, frame)
+}
+
+// printMatchResult prints the matched user, redacted to the configured
+// level
+func printMatchResult(redactor *redaction.Redactor, match *models.MatchResult) {
+	user := redactor.User(match.User)
+
 	fmt.Println("\n✓ Match found!")
 	fmt.Println("─────────────────────────────────────")
-	fmt.Printf("User ID:     %s\n", match.User.ID)
-	fmt.Printf("Name:        %s\n", match.User.Name)
-	if match.User.Email != "" {
-		fmt.Printf("Email:       %s\n", match.User.Email)
+	fmt.Printf("User ID:     %s\n", user.ID)
+	if user.Name != "" {
+		fmt.Printf("Name:        %s\n", user.Name)
+	}
+	if user.Email != "" {
+		fmt.Printf("Email:       %s\n", user.Email)
 	}
-	if match.User.Phone != "" {
-		fmt.Printf("Phone:       %s\n", match.User.Phone)
+	if user.Phone != "" {
+		fmt.Printf("Phone:       %s\n", user.Phone)
+	}
+	if user.Badge != "" {
+		fmt.Printf("Badge:       %s\n", user.Badge)
+	}
+	if user.CardNumber != "" {
+		fmt.Printf("Card number: %s\n", user.CardNumber)
+	}
+	if user.IsVisitor() {
+		fmt.Printf("Visitor:     %s\n", visitorStatus(user))
 	}
 	fmt.Printf("Confidence:  %.2f%%\n", match.Confidence*100)
-	fmt.Printf("Face ID:     %s\n", match.FaceID)
+	if faceID := redactor.FaceID(match.FaceID); faceID != "" {
+		fmt.Printf("Face ID:     %s\n", faceID)
+	}
 
-	if len(match.User.Metadata) > 0 {
+	if len(user.Metadata) > 0 {
 		fmt.Println("\nMetadata:")
-		for key, value := range match.User.Metadata {
+		for key, value := range user.Metadata {
 			fmt.Printf("  %s: %v\n", key, value)
 		}
 	}
 }
+
+// matchingAgainst describes who a probe is matched against: the users of a
+// device's scope, or everyone
+func matchingAgainst(device string, users int) string {
+	if device != "" {
+		return fmt.Sprintf("Matching against the users of %s...", device)
+	}
+	return fmt.Sprintf("Matching against %d users in database...", users)
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/compression"
+	"face/internal/database/models"
+	"face/internal/redaction"
+
+	"github.com/spf13/cobra"
+)
+
+// batchImageExts are the extensions of the images 'face identify-batch'
+// picks up, the formats the input decoder accepts
+var batchImageExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".bmp": true, ".tif": true, ".tiff": true,
+}
+
+// batchResult is a row of the report of 'face identify-batch'
+type batchResult struct {
+	Image   string `json:"image"`
+	Matched bool   `json:"matched"`
+	UserID  string `json:"user_id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	FaceID  string `json:"face_id,omitempty"`
+	// Confidence is that of the match or, without one, of the best
+	// candidate
+	Confidence float64 `json:"confidence"`
+	Quality    float64 `json:"quality"`
+	ErrorCode  string  `json:"error_code,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// batchReport is the JSON report of 'face identify-batch'
+type batchReport struct {
+	Dir       string        `json:"dir"`
+	Threshold float64       `json:"threshold"`
+	Images    int           `json:"images"`
+	Matched   int           `json:"matched"`
+	Errors    int           `json:"errors"`
+	Results   []batchResult `json:"results"`
+}
+
+func NewIdentifyBatchCmd(cfg *config.Config) *cobra.Command {
+	var (
+		dir       string
+		output    string
+		format    string
+		recursive bool
+		threshold float64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "identify-batch",
+		Short: "Identify every image in a directory and write a report",
+		Long: `Identify the face of every JPEG and PNG image in a directory and write the
+results to a CSV or JSON report. With --recursive, subdirectories are
+included; hidden ones are skipped.
+
+Each image gets a row with its path relative to --dir, whether it matched,
+the user and face it matched, the confidence (of the best candidate when
+nothing matched) and the face quality. Images that fail, e.g. without a
+face, get the stable error code and message of the failure instead, see
+'face serve'; they do not stop the batch.
+
+The format follows --format, or else the name of --output: JSON for .json,
+CSV otherwise. Reports ending in .gz or .zst are compressed. Identities in
+the report follow the configured redaction level, as for 'face identify'.
+Nothing is enriched or otherwise written to the database.`,
+		Example: `  face identify-batch --dir ./photos --output report.csv
+  face identify-batch --dir ./photos --recursive --output report.json
+  face identify-batch --dir ./archive --output report.csv.gz --threshold 0.8`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runIdentifyBatch(cfg, dir, output, format, recursive, threshold)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dir, "dir", "d", "", "directory of images to identify")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "report file to write")
+	cmd.Flags().StringVar(&format, "format", "", "report format: csv or json (default from the --output name)")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "include subdirectories")
+	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	cmd.MarkFlagRequired("dir")
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+func runIdentifyBatch(cfg *config.Config, dir, output, format string, recursive bool, threshold float64) error {
+	if format == "" {
+		format = batchFormat(output)
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	images, err := batchImages(dir, recursive)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("no JPEG or PNG images in %s", dir)
+	}
+
+	fmt.Println("Initializing face recognition system...")
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	users, err := fs.DB.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	if len(users) == 0 {
+		return errors.New("database is empty: enroll at least one user first")
+	}
+
+	fmt.Printf("Identifying %d image(s) against %d users...\n\n", len(images), len(users))
+
+	report := batchReport{Dir: dir, Threshold: threshold, Images: len(images)}
+	matcher := newIdentifier(fs.DB, fs.Decay, fs.Strategy, cfg.Device)
+	for _, path := range images {
+		audit := startAudit(cfg, fs.DB, models.AuditIdentify, "")
+		result := identifyBatchImage(fs, matcher, redactor, path, threshold, &audit.event)
+		result.Image, _ = filepath.Rel(dir, path)
+		switch {
+		case result.ErrorCode != "":
+			audit.event.Result, audit.event.Error = models.AuditFailed, result.ErrorCode
+		case !result.Matched:
+			audit.event.Result = models.AuditNoMatch
+		}
+		audit.finish(nil)
+		printBatchResult(result)
+
+		if result.Matched {
+			report.Matched++
+		}
+		if result.ErrorCode != "" {
+			report.Errors++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if err := writeBatchReport(output, format, &report); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ %d image(s): %d matched, %d not matched, %d failed\n",
+		report.Images, report.Matched, report.Images-report.Matched-report.Errors, report.Errors)
+	fmt.Printf("✓ Report written to %s\n", output)
+	return nil
+}
+
+// batchFormat returns the report format implied by a file name, ignoring
+// a compression suffix
+func batchFormat(output string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(output, ".gz"), ".zst")
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		return "json"
+	}
+	return "csv"
+}
+
+// batchImages returns the images in a directory, in lexical order
+func batchImages(dir string, recursive bool) ([]string, error) {
+	var images []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if batchImageExts[strings.ToLower(filepath.Ext(path))] {
+			images = append(images, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	return images, nil
+}
+
+// identifyBatchImage identifies the face of one image with the matcher,
+// reporting failures in the result with the error codes of the API. The
+// matched user is set in the audit event.
+func identifyBatchImage(fs *FaceSystem, matcher identifier, redactor *redaction.Redactor, path string, threshold float64, event *models.AuditEvent) batchResult {
+	var result batchResult
+	file, err := os.Open(path)
+	if err != nil {
+		return batchError(result, err)
+	}
+	defer file.Close()
+
+	probe, err := processUpload(fs, file)
+	if err != nil {
+		return batchError(result, err)
+	}
+	result.Quality = probe.QualityScore
+
+	match, err := matcher.Match(probe.Embedding, threshold)
+	if errors.Is(err, models.ErrNoMatch) {
+		best, err := matcher.FindBestMatches(probe.Embedding, 1)
+		if err != nil {
+			return batchError(result, err)
+		}
+		if len(best) > 0 {
+			result.Confidence = best[0].Confidence
+		}
+		return result
+	}
+	if err != nil {
+		return batchError(result, err)
+	}
+
+	event.UserID, event.Confidence = match.User.ID, match.Confidence
+	user := redactor.User(match.User)
+	result.Matched = true
+	result.UserID = user.ID
+	result.Name = user.Name
+	result.FaceID = redactor.FaceID(match.FaceID)
+	result.Confidence = match.Confidence
+	return result
+}
+
+func batchError(result batchResult, err error) batchResult {
+	result.ErrorCode = string(apierror.From(err).Code)
+	result.Error = err.Error()
+	return result
+}
+
+func printBatchResult(result batchResult) {
+	switch {
+	case result.ErrorCode != "":
+		fmt.Printf("  ⚠ %s: %s\n", result.Image, result.Error)
+	case !result.Matched:
+		fmt.Printf("  ✗ %s: no match (best %.2f%%)\n", result.Image, result.Confidence*100)
+	case result.Name != "":
+		fmt.Printf("  ✓ %s: %s (%.2f%%)\n", result.Image, result.Name, result.Confidence*100)
+	default:
+		fmt.Printf("  ✓ %s: %s (%.2f%%)\n", result.Image, result.UserID, result.Confidence*100)
+	}
+}
+
+func writeBatchReport(output, format string, report *batchReport) error {
+	var data []byte
+	if format == "json" {
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		data = append(jsonData, '\n')
+	} else {
+		data = batchCSV(report.Results)
+	}
+
+	if err := compression.WriteFile(output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// batchCSV returns the results as CSV. The confidence and quality of
+// failed images are left empty.
+func batchCSV(results []batchResult) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"image", "matched", "user_id", "name", "face_id", "confidence", "quality", "error_code", "error"})
+	for _, r := range results {
+		confidence, quality := "", ""
+		if r.ErrorCode == "" {
+			confidence = strconv.FormatFloat(r.Confidence, 'f', 4, 64)
+			quality = strconv.FormatFloat(r.Quality, 'f', 4, 64)
+		}
+		w.Write([]string{r.Image, strconv.FormatBool(r.Matched), r.UserID, r.Name, r.FaceID, confidence, quality, r.ErrorCode, r.Error})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
@@ -0,0 +1,421 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"slices"
+	"strconv"
+
+	"face/config"
+	"face/internal/compression"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/dataset"
+	"face/internal/embedding"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// importOptions are the flags of 'face import'
+type importOptions struct {
+	SkipExisting bool
+	KeepSettings bool
+	// SkipInvalid leaves out the users with an unusable embedding instead
+	// of failing the import
+	SkipInvalid bool
+	// Renormalize scales embeddings to length 1
+	Renormalize bool
+	// MaxValue bounds the magnitude of embedding values, unchecked if 0
+	MaxValue float64
+	// Anomalies is the file to write the embedding anomalies to, if any
+	Anomalies string
+	DryRun    bool
+}
+
+func NewImportCmd(cfg *config.Config) *cobra.Command {
+	var opts importOptions
+
+	cmd := &cobra.Command{
+		Use:         "import <archive>",
+		Short:       "Import an archive written by 'face export'",
+		Annotations: recordWith("!dry-run"),
+		Long: `Add the users, faces and settings of an archive written by 'face export' to
+the configured database, whichever backend wrote the archive. Users keep
+their IDs, enrollment times and second factors. Face images in the archive
+are stored again, with the storage layout and provenance key of this
+installation, and avatars are regenerated from them.
+
+Nothing is written if a user of the archive already exists, unless
+--skip-existing leaves those users as they are. The settings of the archive
+replace the current ones unless --keep-settings is given. An archive of
+another embedding model than the database's is refused, as its embeddings
+cannot be compared with the enrolled ones.
+
+Embeddings are checked before anything is written, as archives built by
+other tools may hold vectors that would silently spoil matching. Values are
+stored as float32: float64 values are rounded, and those beyond the float32
+range count as overflow. An embedding is unusable if it has the wrong
+dimension, NaN or infinite values (including the NaN and Infinity of
+Python's json module), overflowed values, values beyond --max-value, or
+only zeros; values too small for a float32 are stored as 0 and reported.
+Unusable embeddings fail the import, unless --skip-invalid leaves out their
+users. --renormalize scales every embedding to length 1, for models whose
+embeddings are normalized. The anomalies are listed by line of users.jsonl
+and written in full to --anomalies, as CSV or, for a .json name, JSON;
+--dry-run only checks.`,
+		Example: `  face import backup.tar.gz
+  face import move.tar.zst --db-type postgres --skip-existing
+  face import vendor.tar.gz --dry-run --anomalies anomalies.csv
+  face import vendor.tar.gz --skip-invalid --renormalize --max-value 1`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.MaxValue < 0 {
+				return errors.New("--max-value must not be negative")
+			}
+			return runImport(cfg, args[0], opts)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.SkipExisting, "skip-existing", false, "skip users that already exist instead of failing")
+	cmd.Flags().BoolVar(&opts.KeepSettings, "keep-settings", false, "keep the current settings instead of those of the archive")
+	cmd.Flags().BoolVar(&opts.SkipInvalid, "skip-invalid", false, "leave out users with an unusable embedding instead of failing")
+	cmd.Flags().BoolVar(&opts.Renormalize, "renormalize", false, "scale every embedding to length 1")
+	cmd.Flags().Float64Var(&opts.MaxValue, "max-value", 0, "reject embedding values beyond plus or minus this, e.g. 1 for normalized models (default unchecked)")
+	cmd.Flags().StringVar(&opts.Anomalies, "anomalies", "", "file to write the embedding anomalies to, CSV or JSON by extension")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "only check the embeddings, importing nothing")
+
+	return cmd
+}
+
+func runImport(cfg *config.Config, path string, opts importOptions) error {
+	file, err := compression.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	archive, err := dataset.NewReader(file)
+	if err != nil {
+		return err
+	}
+	if err := checkArchiveEmbeddings(archive, opts); err != nil || opts.DryRun {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	result, err := importDataset(archive, db, stor, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Imported %d user(s) with %d face(s) from %s\n", result.Users, result.Faces, path)
+	if result.Skipped > 0 {
+		fmt.Printf("  Skipped %d user(s) that already exist\n", result.Skipped)
+	}
+	if archive.Manifest.Images {
+		fmt.Printf("  Stored %d face image(s)\n", result.Images)
+	} else {
+		fmt.Println("  The archive has no face images; faces match, but their images are missing")
+	}
+	return nil
+}
+
+// importResult counts what importDataset imported
+type importResult struct {
+	Users   int
+	Faces   int
+	Images  int
+	Skipped int
+}
+
+// importDataset adds the users, settings and images of an archive to db
+func importDataset(archive *dataset.Reader, db database.Database, stor storage.Storage, opts importOptions) (*importResult, error) {
+	users, skipped, err := importableUsers(db, archive.Users, opts.SkipExisting)
+	if err != nil {
+		return nil, err
+	}
+	if err := importSettings(db, &archive.Settings, opts.KeepSettings); err != nil {
+		return nil, err
+	}
+
+	result := &importResult{Skipped: skipped}
+	imported := make(map[string]bool, len(users))
+	for i := range users {
+		user := &users[i]
+		user.Avatar = ""
+		user.DeletedAt = nil
+		for j := range user.Faces {
+			user.Faces[j].UserID = user.ID
+		}
+		if err := db.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to import user %s (%s) after importing %d: %w", user.Name, user.ID, len(imported), err)
+		}
+		imported[user.ID] = true
+		result.Faces += len(user.Faces)
+	}
+	result.Users = len(imported)
+
+	if archive.Manifest.Images {
+		if result.Images, err = importImages(archive, db, stor, imported); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// importableUsers returns the users of the archive that do not exist yet
+// and how many do. Unless skipExisting is set, any existing user fails the
+// import before anything is written.
+func importableUsers(db database.Database, users []models.User, skipExisting bool) ([]models.User, int, error) {
+	var fresh, existing []models.User
+	for _, user := range users {
+		_, err := db.GetUser(user.ID)
+		switch {
+		case err == nil:
+			existing = append(existing, user)
+		case errors.Is(err, models.ErrUserNotFound):
+			fresh = append(fresh, user)
+		default:
+			return nil, 0, err
+		}
+	}
+
+	if len(existing) > 0 && !skipExisting {
+		return nil, 0, fmt.Errorf("%d user(s) of the archive already exist, e.g. %s (%s); import with --skip-existing to leave them as they are",
+			len(existing), existing[0].Name, existing[0].ID)
+	}
+	return fresh, len(existing), nil
+}
+
+// importSettings applies the settings of an archive, and refuses one whose
+// embeddings were computed by another model than the database's
+func importSettings(db database.Database, imported *models.Settings, keep bool) error {
+	current, err := db.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	model := current.EmbeddingModel
+	switch {
+	case imported.EmbeddingModel == "" || imported.EmbeddingModel == model:
+	case model == "":
+		model = imported.EmbeddingModel
+	default:
+		return fmt.Errorf("the archive holds embeddings of model %s, the database of model %s: they cannot be compared",
+			imported.EmbeddingModel, model)
+	}
+
+	settings := *current
+	if !keep {
+		settings = *imported
+	}
+	settings.EmbeddingModel = model
+	if err := settings.Validate(); err != nil {
+		return fmt.Errorf("invalid settings in archive: %w", err)
+	}
+	if err := db.UpdateSettings(&settings); err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+	return nil
+}
+
+// importImages stores the face images of the imported users, re-encoded by
+// the configured storage, and regenerates their avatars
+func importImages(archive *dataset.Reader, db database.Database, stor storage.Storage, imported map[string]bool) (int, error) {
+	count := 0
+	for {
+		userID, faceID, data, err := archive.NextImage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		if !imported[userID] {
+			continue
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return count, fmt.Errorf("failed to decode image of face %s: %w", faceID, err)
+		}
+		filename, err := stor.SaveImage(userID, faceID, img)
+		if err != nil {
+			return count, fmt.Errorf("failed to store image of face %s: %w", faceID, err)
+		}
+		if err := db.UpdateFaceFilename(userID, faceID, filename); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	for userID := range imported {
+		refreshAvatar(db, stor, userID)
+	}
+	return count, nil
+}
+
+// importAnomaly is an anomaly of an embedding of an archive, in the
+// --anomalies report of 'face import'
+type importAnomaly struct {
+	// Line is the line of the user in users.jsonl
+	Line   int    `json:"line"`
+	UserID string `json:"user_id"`
+	FaceID string `json:"face_id"`
+	embedding.Anomaly
+	// Action is what the import does about it: rejected (failing the
+	// import), skipped (leaving out the user), renormalized or imported
+	Action string `json:"action"`
+}
+
+// Actions of an importAnomaly
+const (
+	anomalyRejected     = "rejected"
+	anomalySkipped      = "skipped"
+	anomalyRenormalized = "renormalized"
+	anomalyImported     = "imported"
+)
+
+// importAnomaliesShown is how many anomalies 'face import' prints
+const importAnomaliesShown = 10
+
+// checkArchiveEmbeddings validates the embeddings of an archive's users,
+// renormalizing them if asked to, and reports the anomalies. Users with an
+// unusable embedding fail the import, or are removed from the archive's
+// users with --skip-invalid.
+func checkArchiveEmbeddings(archive *dataset.Reader, opts importOptions) error {
+	limits := embedding.Limits{Dimension: archive.Manifest.EmbeddingDimension, MaxAbs: opts.MaxValue, Normalized: opts.Renormalize}
+	if limits.Dimension == 0 && archive.Settings.EmbeddingModel != "" {
+		limits.Dimension = archive.Settings.EmbeddingDimension
+	}
+
+	var anomalies []importAnomaly
+	valid := archive.Users[:0:0]
+	for i := range archive.Users {
+		found := userAnomalies(&archive.Users[i], i+1, archive.Coerced, limits, opts)
+		anomalies = append(anomalies, found...)
+		if !slices.ContainsFunc(found, func(a importAnomaly) bool { return a.Fatal }) {
+			valid = append(valid, archive.Users[i])
+		}
+	}
+	invalid := len(archive.Users) - len(valid)
+
+	printImportAnomalies(anomalies, invalid)
+	if opts.Anomalies != "" {
+		if err := writeImportAnomalies(opts.Anomalies, anomalies); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Anomalies written to %s\n", opts.Anomalies)
+	}
+	if invalid > 0 && !opts.SkipInvalid {
+		first := anomalies[slices.IndexFunc(anomalies, func(a importAnomaly) bool { return a.Fatal })]
+		return fmt.Errorf("%d user(s) of the archive have unusable embeddings, e.g. line %d: %s; fix the archive or import with --skip-invalid to leave them out",
+			invalid, first.Line, first.Detail)
+	}
+	archive.Users = valid
+	return nil
+}
+
+// userAnomalies returns the anomalies of the embeddings of the user on a
+// line of users.jsonl, renormalizing usable ones if asked to
+func userAnomalies(user *models.User, line int, coerced map[string]dataset.Coercion, limits embedding.Limits, opts importOptions) []importAnomaly {
+	var found []importAnomaly
+	for i := range user.Faces {
+		face := &user.Faces[i]
+		anomalies := embedding.Validate(face.Embedding, limits)
+		if c := coerced[face.ID]; c.Overflowed > 0 {
+			anomalies = append(anomalies, embedding.Anomaly{Kind: embedding.AnomalyOverflow, Values: c.Overflowed, Fatal: true,
+				Detail: fmt.Sprintf("%d value(s) beyond the float32 range", c.Overflowed)})
+		}
+		if c := coerced[face.ID]; c.Underflowed > 0 {
+			anomalies = append(anomalies, embedding.Anomaly{Kind: embedding.AnomalyUnderflow, Values: c.Underflowed,
+				Detail: fmt.Sprintf("%d value(s) too small for a float32, stored as 0", c.Underflowed)})
+		}
+		fatal := embedding.Fatal(anomalies)
+		if opts.Renormalize && !fatal {
+			embedding.Normalize(face.Embedding)
+		}
+
+		for _, a := range anomalies {
+			found = append(found, importAnomaly{Line: line, UserID: user.ID, FaceID: face.ID, Anomaly: a,
+				Action: anomalyAction(a, fatal, opts)})
+		}
+	}
+	return found
+}
+
+// anomalyAction returns what the import does about an anomaly of an
+// embedding, fatal if any of its anomalies is
+func anomalyAction(a embedding.Anomaly, fatal bool, opts importOptions) string {
+	switch {
+	case fatal && opts.SkipInvalid:
+		return anomalySkipped
+	case fatal:
+		return anomalyRejected
+	case a.Kind == embedding.AnomalyNotNormalized:
+		return anomalyRenormalized
+	default:
+		return anomalyImported
+	}
+}
+
+func printImportAnomalies(anomalies []importAnomaly, invalid int) {
+	if len(anomalies) == 0 {
+		fmt.Println("✓ Embeddings checked: no anomalies")
+		return
+	}
+
+	fmt.Printf("⚠ %d embedding anomaly(ies), %d user(s) with unusable embeddings:\n", len(anomalies), invalid)
+	for _, a := range anomalies[:min(len(anomalies), importAnomaliesShown)] {
+		fmt.Printf("  line %d, face %s: %s: %s (%s)\n", a.Line, a.FaceID, a.Kind, a.Detail, a.Action)
+	}
+	if len(anomalies) > importAnomaliesShown {
+		fmt.Printf("  ... and %d more, see --anomalies\n", len(anomalies)-importAnomaliesShown)
+	}
+}
+
+// writeImportAnomalies writes the anomalies as JSON for a .json name and
+// as CSV otherwise, compressed for a name ending in .gz or .zst
+func writeImportAnomalies(path string, anomalies []importAnomaly) error {
+	var data []byte
+	if batchFormat(path) == "json" {
+		if anomalies == nil {
+			anomalies = []importAnomaly{}
+		}
+		jsonData, err := json.MarshalIndent(anomalies, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		data = append(jsonData, '\n')
+	} else {
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"line", "user_id", "face_id", "kind", "values", "detail", "fatal", "action"})
+		for _, a := range anomalies {
+			w.Write([]string{strconv.Itoa(a.Line), a.UserID, a.FaceID, a.Kind, strconv.Itoa(a.Values), a.Detail, strconv.FormatBool(a.Fatal), a.Action})
+		}
+		w.Flush()
+		data = buf.Bytes()
+	}
+
+	if err := compression.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write anomalies: %w", err)
+	}
+	return nil
+}
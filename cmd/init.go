@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/face"
+
+	"github.com/spf13/cobra"
+)
+
+func NewInitCmd(cfg *config.Config) *cobra.Command {
+	var (
+		configPath string
+		yes        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:         "init",
+		Short:       "Interactively set up a new installation",
+		Annotations: recordAlways(),
+		Long: `Walk through choosing a database backend, writing the config file,
+creating directories, downloading models, and running migrations.
+Each step is validated before moving on to the next one.
+Optionally enrolls the first user at the end.`,
+		Example: `  face init
+  face init --config-path /etc/face/face.config.json
+  face init --yes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInit(cfg, configPath, yes)
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config-path", config.ConfigFilePath(), "where to write the config file")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "accept all defaults without prompting")
+
+	return cmd
+}
+
+func runInit(cfg *config.Config, configPath string, yes bool) error {
+	p := newPrompter()
+
+	fmt.Println("Face recognition setup")
+	fmt.Println("─────────────────────────────────────")
+
+	newCfg, err := initAskConfig(cfg, p, yes)
+	if err != nil {
+		return err
+	}
+
+	if err := initPrepare(newCfg); err != nil {
+		return err
+	}
+
+	fmt.Println("[4/5] Writing config file...")
+	if err := initWriteConfig(initSavedConfig(newCfg, configPath), p, configPath, yes); err != nil {
+		return err
+	}
+	*cfg = *newCfg
+
+	fmt.Println("[5/5] First user")
+	enroll := false
+	if !yes {
+		if enroll, err = p.confirm("Enroll the first user now?", false); err != nil {
+			return err
+		}
+	}
+	if enroll {
+		if err := initEnrollFirstUser(cfg, p); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("  • Skipped")
+	}
+
+	fmt.Println("\n✓ Setup completed successfully")
+	return nil
+}
+
+// initAskConfig asks for the database backend and paths, starting from the
+// current configuration
+func initAskConfig(cfg *config.Config, p *prompter, yes bool) (*config.Config, error) {
+	ask := func(question, def string) (string, error) {
+		if yes {
+			return def, nil
+		}
+		return p.ask(question, def)
+	}
+
+	dbType := string(cfg.DatabaseType)
+	if !yes {
+		var err error
+		dbType, err = p.choose("Database backend", []string{
+			string(database.DatabaseTypeSQLite),
+			string(database.DatabaseTypePostgres),
+			string(database.DatabaseTypeJSON),
+			string(database.DatabaseTypeBolt),
+		}, dbType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	newType := database.ParseDatabaseType(dbType)
+
+	dbPathDefault := cfg.DatabasePath
+	if newType != cfg.DatabaseType {
+		dbPathDefault = defaultDatabasePath(newType)
+	}
+
+	dbQuestion := "Database file"
+	if newType == database.DatabaseTypePostgres {
+		dbQuestion = "PostgreSQL connection string"
+	}
+
+	dbPath, err := ask(dbQuestion, dbPathDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	facesDir, err := ask("Face images directory", cfg.FacesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	modelsDir, err := ask("Models directory", cfg.ModelsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	newCfg := *cfg
+	newCfg.DatabaseType = newType
+	newCfg.DatabasePath = dbPath
+	newCfg.FacesDir = facesDir
+	newCfg.ModelsDir = modelsDir
+
+	if err := newCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &newCfg, nil
+}
+
+// initPrepare creates directories, downloads models and prepares the database
+func initPrepare(cfg *config.Config) error {
+	fmt.Println("\n[1/5] Creating directories...")
+	dirs := []string{cfg.FacesDir, cfg.ModelsDir}
+	if cfg.DatabaseType != database.DatabaseTypePostgres {
+		dirs = append(dirs, filepath.Dir(cfg.DatabasePath))
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+	fmt.Println("  ✓ Directories ready")
+
+	fmt.Println("[2/5] Downloading models...")
+	detector, err := newDetector(cfg.ModelsDir)
+	if err != nil {
+		return err
+	}
+	detector.Close()
+
+	extractor, err := face.NewExtractor(cfg.ModelsDir)
+	if err != nil {
+		return fmt.Errorf("failed to initialize extractor: %w", err)
+	}
+	extractor.Close()
+	fmt.Println("  ✓ Models ready")
+
+	fmt.Println("[3/5] Preparing database...")
+	if cfg.DatabaseType.UsesMigrations() {
+		migrator, err := cfg.GetMigrator()
+		if err != nil {
+			return fmt.Errorf("failed to create migrator: %w", err)
+		}
+		err = migrator.Up()
+		migrator.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := cfg.GetDatabaseConnection()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	users, err := db.ListUsers()
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("database check failed: %w", err)
+	}
+	fmt.Printf("  ✓ Database ready (%d users)\n", len(users))
+
+	return nil
+}
+
+// initWriteConfig writes the config file, asking before overwriting one
+func initWriteConfig(cfg *config.Config, p *prompter, configPath string, yes bool) error {
+	if _, err := os.Stat(configPath); err == nil && !yes {
+		overwrite, err := p.confirm(fmt.Sprintf("%s already exists, overwrite?", configPath), false)
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			fmt.Println("  • Keeping existing config file")
+			return nil
+		}
+	}
+
+	if err := cfg.Save(configPath); err != nil {
+		return err
+	}
+	fmt.Printf("  ✓ Config written to %s\n", configPath)
+	return nil
+}
+
+// initSavedConfig returns the config file init writes to configPath: the
+// one there with the answers to init, leaving out values only environment
+// variables set, which may be secrets like FACE_CLI_ENCRYPTION_KEY or a
+// password in FACE_CLI_DB_PATH. An answer is left out when it is what the
+// environment set.
+func initSavedConfig(newCfg *config.Config, configPath string) *config.Config {
+	saved, err := config.FileConfig(configPath)
+	if err != nil {
+		saved = config.DefaultConfig()
+	}
+	// The environment overlays the config file LoadConfig read, which need
+	// not be configPath
+	loaded, err := config.FileConfig(config.ConfigFilePath())
+	if err != nil {
+		loaded = config.DefaultConfig()
+	}
+	env := config.LoadConfig()
+	fromEnv := func(answer, set, file string) bool { return answer == set && set != file }
+
+	left := false
+	if fromEnv(newCfg.DatabasePath, env.DatabasePath, loaded.DatabasePath) ||
+		fromEnv(string(newCfg.DatabaseType), string(env.DatabaseType), string(loaded.DatabaseType)) {
+		left = true
+	} else {
+		saved.DatabaseType, saved.DatabasePath = newCfg.DatabaseType, newCfg.DatabasePath
+	}
+	for _, dir := range []struct{ answer, set, loaded, saved *string }{
+		{&newCfg.FacesDir, &env.FacesDir, &loaded.FacesDir, &saved.FacesDir},
+		{&newCfg.ModelsDir, &env.ModelsDir, &loaded.ModelsDir, &saved.ModelsDir},
+	} {
+		if fromEnv(*dir.answer, *dir.set, *dir.loaded) {
+			left = true
+		} else {
+			*dir.saved = *dir.answer
+		}
+	}
+
+	if left {
+		fmt.Println("  • Answers taken from environment variables are left out of the config file; keep setting them")
+	}
+	return saved
+}
+
+func initEnrollFirstUser(cfg *config.Config, p *prompter) error {
+	name, err := p.ask("Name", "")
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+
+	email, err := p.ask("Email (optional)", "")
+	if err != nil {
+		return err
+	}
+
+	images, err := p.ask("Comma-separated image paths", "")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(images) == "" {
+		return fmt.Errorf("at least one image is required")
+	}
+
+	return runEnroll(cfg, userDetails{Name: name, Email: email}, images, "", enrollQR{}, false, 0)
+}
+
+// defaultDatabasePath returns a sensible default location for a backend
+func defaultDatabasePath(dbType database.DatabaseType) string {
+	switch dbType {
+	case database.DatabaseTypePostgres:
+		return "host=localhost user=postgres dbname=face sslmode=disable"
+	case database.DatabaseTypeJSON:
+		return "db.json"
+	case database.DatabaseTypeBolt:
+		return "face.bolt"
+	default:
+		return "face.db"
+	}
+}
@@ -3,35 +3,49 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"face/config"
+	"face/internal/database/models"
+	"face/internal/names"
 
 	"github.com/spf13/cobra"
 )
 
 func NewListCmd(cfg *config.Config) *cobra.Command {
 	var (
-		formatJSON bool
+		formatJSON   bool
+		nameContains string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all enrolled users",
-		Long:  `Display a list of all users enrolled in the face recognition system.`,
+		Long: `Display a list of all users enrolled in the face recognition system.
+
+--name-contains lists only the users whose name contains the text,
+regardless of case and accents: "jose" finds "José". With
+name_transliteration set in the config file (or
+FACE_CLI_NAME_TRANSLITERATION=true), also regardless of script: "maria"
+finds "Мария".`,
 		Example: `  face list
-  face list --json`,
+  face list --json
+  face list --name-contains maria`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runList(cfg, formatJSON)
+			return runList(cfg, formatJSON, nameContains)
 		},
 	}
 
 	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+	cmd.Flags().StringVar(&nameContains, "name-contains", "", "only list users whose name contains this text")
 
 	return cmd
 }
 
-func runList(cfg *config.Config, formatJSON bool) error {
-	db, err := cfg.GetDatabaseConnection()
+func runList(cfg *config.Config, formatJSON bool, nameContains string) error {
+	db, err := openDatabase(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -41,8 +55,25 @@ func runList(cfg *config.Config, formatJSON bool) error {
 	if err != nil {
 		return fmt.Errorf("failed to list users: %w", err)
 	}
+	if nameContains != "" {
+		users = slices.DeleteFunc(users, func(user models.User) bool {
+			return !names.Contains(user.Name, nameContains, cfg.NameTransliteration)
+		})
+	}
+	for i := range users {
+		models.SortFaces(users[i].Faces)
+	}
+	factors := make([]string, len(users))
+	for i := range users {
+		factors[i] = secondFactors(&users[i])
+		users[i].ClearSecrets()
+	}
 
-	if len(users) == 0 {
+	switch {
+	case len(users) == 0 && nameContains != "":
+		fmt.Printf("No user's name contains %q.\n", nameContains)
+		return nil
+	case len(users) == 0:
 		fmt.Println("No users enrolled yet.")
 		return nil
 	}
@@ -59,24 +90,7 @@ func runList(cfg *config.Config, formatJSON bool) error {
 	fmt.Printf("\nTotal users: %d\n\n", len(users))
 
 	for i := range users {
-		fmt.Printf("[%d] %s\n", i+1, users[i].Name)
-		fmt.Printf("    ID:         %s\n", users[i].ID)
-		if users[i].Email != "" {
-			fmt.Printf("    Email:      %s\n", users[i].Email)
-		}
-		if users[i].Phone != "" {
-			fmt.Printf("    Phone:      %s\n", users[i].Phone)
-		}
-		fmt.Printf("    Faces:      %d\n", len(users[i].Faces))
-		fmt.Printf("    Created:    %s\n", users[i].CreatedAt.Format("2006-01-02 15:04:05"))
-
-		if len(users[i].Metadata) > 0 {
-			fmt.Println("    Metadata:")
-			for key, value := range users[i].Metadata {
-				fmt.Printf("      %s: %v\n", key, value)
-			}
-		}
-
+		printListedUser(i+1, &users[i], factors[i])
 		if i < len(users)-1 {
 			fmt.Println()
 		}
@@ -84,3 +98,75 @@ func runList(cfg *config.Config, formatJSON bool) error {
 
 	return nil
 }
+
+// visitorStatus describes when a visitor's access ends or ended
+func visitorStatus(user *models.User) string {
+	at := user.ExpiresAt.Format("2006-01-02 15:04:05")
+	if user.Expired(time.Now()) {
+		return "expired " + at + ", remove with 'face prune'"
+	}
+	return "until " + at
+}
+
+// secondFactors lists the second factors the user has set up, empty if none
+func secondFactors(user *models.User) string {
+	var factors []string
+	if user.PINHash != "" {
+		factors = append(factors, "PIN")
+	}
+	if user.TOTPSecret != "" {
+		factors = append(factors, "authenticator app")
+	}
+	return strings.Join(factors, ", ")
+}
+
+// printListedUser prints the nth user of the list with their second
+// factors, which are cleared from the user itself
+func printListedUser(n int, user *models.User, factors string) {
+	fmt.Printf("[%d] %s\n", n, user.Name)
+	fmt.Printf("    ID:         %s\n", user.ID)
+	if user.Email != "" {
+		fmt.Printf("    Email:      %s\n", user.Email)
+	}
+	if user.Phone != "" {
+		fmt.Printf("    Phone:      %s\n", user.Phone)
+	}
+	if user.Badge != "" {
+		fmt.Printf("    Badge:      %s\n", user.Badge)
+	}
+	if user.CardNumber != "" {
+		fmt.Printf("    Card:       %s\n", user.CardNumber)
+	}
+	if user.IsVisitor() {
+		fmt.Printf("    Visitor:    %s\n", visitorStatus(user))
+	}
+	if factors != "" {
+		fmt.Printf("    2nd factor: %s\n", factors)
+	}
+	fmt.Printf("    Faces:      %d\n", len(user.Faces))
+	for _, f := range user.Faces {
+		if f.Primary || f.Label != "" {
+			fmt.Printf("      %s\n", describeFace(&f))
+		}
+	}
+	fmt.Printf("    Created:    %s\n", user.CreatedAt.Format("2006-01-02 15:04:05"))
+
+	if len(user.Metadata) > 0 {
+		fmt.Println("    Metadata:")
+		for key, value := range user.Metadata {
+			fmt.Printf("      %s: %v\n", key, value)
+		}
+	}
+}
+
+// describeFace returns a one-line summary of a face with its label
+func describeFace(f *models.Face) string {
+	desc := f.ID
+	if f.Label != "" {
+		desc += fmt.Sprintf(" %q", f.Label)
+	}
+	if f.Primary {
+		desc += " (primary)"
+	}
+	return desc
+}
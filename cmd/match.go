@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/compression"
+	"face/internal/gallery"
+	"face/matching"
+
+	"github.com/spf13/cobra"
+)
+
+// maxMatchEmbeddings bounds the embeddings of a supplied gallery. Matching
+// is a linear scan, meant for small ad hoc galleries.
+const maxMatchEmbeddings = 1000
+
+// matchCandidate is a person of a gallery supplied with a match request
+type matchCandidate = matching.Candidate
+
+// apiMatchCandidate is one of the best candidates of a match
+type apiMatchCandidate = matching.Score
+
+// apiMatch is the result of matching an image against a supplied gallery
+type apiMatch struct {
+	Matched    bool                `json:"matched"`
+	ID         string              `json:"id,omitempty"`
+	Name       string              `json:"name,omitempty"`
+	Confidence float64             `json:"confidence,omitempty"`
+	Threshold  float64             `json:"threshold"`
+	Quality    float64             `json:"quality"`
+	Box        apiBox              `json:"box"`
+	Candidates []apiMatchCandidate `json:"candidates"`
+}
+
+func NewMatchCmd(cfg *config.Config) *cobra.Command {
+	var (
+		imagePath   string
+		galleryPath string
+		threshold   float64
+		cropSize    int
+		formatJSON  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "match",
+		Short: "Match an image against a supplied gallery, without the database",
+		Long: `Match the face of an image against a gallery of embeddings given in a file,
+for ephemeral comparisons. The database is neither read nor written, and
+nothing is stored.
+
+The gallery is a JSON array of candidates, each with an id, an optional name
+and one or more embeddings from the same model:
+
+  [
+    {"id": "alice", "name": "Alice", "embeddings": [[0.012, -0.031, ...]]},
+    {"id": "bob", "embeddings": [[...], [...]]}
+  ]
+
+or a gallery snapshot bundle, see 'face gallery'; files named *.gz or *.zst
+are decompressed. The confidence of a
+candidate is the cosine similarity of its closest embedding, unless
+--match-strategy selects another (see 'face settings set'); the strategy
+stored in a database does not apply. A gallery may hold up to 1000
+embeddings.
+
+Faces are cropped at their native size unless --crop-size is given; set it
+to the crop size of the database the embeddings came from, see
+'face settings', or the embeddings will not be comparable.`,
+		Example: `  face match --image probe.jpg --gallery candidates.json
+  face match --image probe.jpg --gallery snapshot.fgal --threshold 0.8 --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMatch(cfg, imagePath, galleryPath, threshold, cropSize, formatJSON)
+		},
+	}
+
+	cmd.Flags().StringVarP(&imagePath, "image", "i", "", "path to image file")
+	cmd.Flags().StringVarP(&galleryPath, "gallery", "g", "", "JSON gallery or gallery snapshot bundle")
+	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	cmd.Flags().IntVar(&cropSize, "crop-size", 0, "face crop size the gallery was embedded with (0 = native size)")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+	cmd.MarkFlagRequired("image")
+	cmd.MarkFlagRequired("gallery")
+
+	return cmd
+}
+
+func runMatch(cfg *config.Config, imagePath, galleryPath string, threshold float64, cropSize int, formatJSON bool) error {
+	data, err := compression.ReadFile(galleryPath)
+	if err != nil {
+		return fmt.Errorf("failed to read gallery: %w", err)
+	}
+	candidates, err := parseMatchGallery(data)
+	if err != nil {
+		return err
+	}
+
+	fs, err := newStatelessFaceSystem(cfg, cropSize)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+	defer file.Close()
+
+	probe, err := processUpload(fs, file)
+	if err != nil {
+		return err
+	}
+	result, err := matchGallery(probe, candidates, threshold, fs.Strategy)
+	if err != nil {
+		return err
+	}
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+	printMatch(result)
+	return nil
+}
+
+// newStatelessFaceSystem returns a face system with the configured pipeline
+// but neither database nor storage
+func newStatelessFaceSystem(cfg *config.Config, cropSize int) (*FaceSystem, error) {
+	limits, err := cfg.ImageLimits()
+	if err != nil {
+		return nil, err
+	}
+	livenessModel, err := cfg.Liveness()
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := cfg.Strategy("")
+	if err != nil {
+		return nil, err
+	}
+	detector, extractor, err := newPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &FaceSystem{
+		Detector:    detector,
+		Extractor:   extractor,
+		CropSize:    cropSize,
+		ImageLimits: limits,
+		Liveness:    livenessModel,
+		Strategy:    strategy,
+		faults:      cfg.FaultInjector(),
+	}, nil
+}
+
+func printMatch(result *apiMatch) {
+	fmt.Printf("✓ Face detected (quality: %.2f)\n", result.Quality)
+	if len(result.Candidates) > 0 {
+		fmt.Println("\nTop candidates:")
+		for i, c := range result.Candidates {
+			fmt.Printf("  %d. %s (%.2f%%%s)\n", i+1, matchLabel(c.ID, c.Name), c.Confidence*100, votesLabel(c.Votes))
+		}
+	}
+
+	if !result.Matched {
+		fmt.Println("\n✗ No match found")
+		fmt.Printf("  No candidate matched with confidence >= %.0f%%\n", result.Threshold*100)
+		return
+	}
+	fmt.Printf("\n✓ Match found: %s (%.2f%%)\n", matchLabel(result.ID, result.Name), result.Confidence*100)
+}
+
+func matchLabel(id, name string) string {
+	if name == "" {
+		return id
+	}
+	return fmt.Sprintf("%s (%s)", name, id)
+}
+
+// parseMatchGallery parses a supplied gallery, a JSON array of candidates
+// or a gallery snapshot bundle
+func parseMatchGallery(data []byte) ([]matchCandidate, error) {
+	var candidates []matchCandidate
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &candidates); err != nil {
+			return nil, galleryError("invalid gallery JSON: %v", err)
+		}
+	} else {
+		bundle, err := gallery.Read(bytes.NewReader(data))
+		if err != nil {
+			return nil, galleryError("gallery is neither a JSON array nor a gallery bundle: %v", err)
+		}
+		if bundle.Delta {
+			return nil, galleryError("gallery is a delta bundle, expected a snapshot")
+		}
+		for _, entry := range bundle.Entries {
+			c := matchCandidate{ID: entry.UserID, Name: entry.Name}
+			for _, f := range entry.Faces {
+				c.Embeddings = append(c.Embeddings, f.Embedding)
+			}
+			if len(c.Embeddings) > 0 {
+				candidates = append(candidates, c)
+			}
+		}
+	}
+
+	if err := validateMatchGallery(candidates); err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
+
+// validateMatchGallery checks that a gallery is small enough and that its
+// candidates are distinct and have embeddings of one dimension
+func validateMatchGallery(candidates []matchCandidate) error {
+	if len(candidates) == 0 {
+		return galleryError("gallery has no candidates")
+	}
+
+	ids := make(map[string]bool, len(candidates))
+	total, dim := 0, 0
+	for _, c := range candidates {
+		if c.ID == "" {
+			return galleryError("gallery has a candidate without id")
+		}
+		if ids[c.ID] {
+			return galleryError("gallery has candidate %q twice", c.ID)
+		}
+		ids[c.ID] = true
+		if len(c.Embeddings) == 0 {
+			return galleryError("candidate %q has no embeddings", c.ID)
+		}
+
+		for _, e := range c.Embeddings {
+			if dim == 0 {
+				dim = len(e)
+			}
+			if len(e) == 0 || len(e) != dim {
+				return galleryError("candidate %q has a %d-d embedding, expected %d-d", c.ID, len(e), dim)
+			}
+			if !finiteEmbedding(e) {
+				return galleryError("candidate %q has an embedding with non-finite values", c.ID)
+			}
+		}
+		total += len(c.Embeddings)
+	}
+
+	if total > maxMatchEmbeddings {
+		return apierror.New(apierror.CodeTooLarge, "gallery has %d embeddings, at most %d are accepted", total, maxMatchEmbeddings).
+			WithDetail("field", "gallery").WithDetail("limit", maxMatchEmbeddings)
+	}
+	return nil
+}
+
+// galleryError reports a supplied gallery that cannot be used
+func galleryError(format string, args ...any) *apierror.Error {
+	return apierror.New(apierror.CodeInvalidArgument, format, args...).WithDetail("field", "gallery")
+}
+
+func finiteEmbedding(e []float32) bool {
+	for _, v := range e {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGallery ranks the candidates of a gallery by their similarity to the
+// probe under the match strategy
+func matchGallery(probe *FaceResult, candidates []matchCandidate, threshold float64, strategy matching.Strategy) (*apiMatch, error) {
+	if dim := len(candidates[0].Embeddings[0]); dim != len(probe.Embedding) {
+		return nil, galleryError("gallery embeddings are %d-d, the model produces %d-d", dim, len(probe.Embedding))
+	}
+
+	ranked := strategy.Rank(probe.Embedding, candidates, identifyCandidates)
+	result := &apiMatch{
+		Threshold:  threshold,
+		Quality:    probe.QualityScore,
+		Box:        newAPIBox(probe.Box),
+		Candidates: ranked,
+	}
+	if best := ranked[0]; matching.Matches(best.Confidence, threshold) {
+		result.Matched = true
+		result.ID = best.ID
+		result.Name = best.Name
+		result.Confidence = best.Confidence
+	}
+	return result, nil
+}
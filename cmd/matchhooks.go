@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"time"
+
+	"face/internal/database/models"
+	"face/internal/hooks"
+	"face/matching"
+)
+
+// hookedIdentifier runs the matching stages of the registered hooks around
+// an identifier
+type hookedIdentifier struct {
+	identifier
+}
+
+// withMatchHooks returns id running the matching hooks, or id itself if no
+// hooks are registered
+func withMatchHooks(id identifier) identifier {
+	if len(hooks.Names()) == 0 {
+		return id
+	}
+	return &hookedIdentifier{identifier: id}
+}
+
+// FindBestMatches returns the best matches the hooks did not reject
+func (h *hookedIdentifier) FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error) {
+	if err := hooks.BeforeMatch(embedding); err != nil {
+		return nil, err
+	}
+	matches, err := h.identifier.FindBestMatches(embedding, n)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := matches[:0]
+	for i := range matches {
+		err := hooks.AfterMatch(embedding, &matches[i])
+		if errors.Is(err, models.ErrNoMatch) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		kept = append(kept, matches[i])
+	}
+	return kept, nil
+}
+
+// Match returns the best match, or models.ErrNoMatch if there is none or
+// the hooks rejected it
+func (h *hookedIdentifier) Match(embedding []float32, threshold float64) (*models.MatchResult, error) {
+	if err := hooks.BeforeMatch(embedding); err != nil {
+		return nil, err
+	}
+	match, err := h.identifier.Match(embedding, threshold)
+	if err != nil {
+		return nil, err
+	}
+	if err := hooks.AfterMatch(embedding, match); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// verifier verifies embeddings against a single user (1:1) with the
+// scoring of the matching package, so devices verifying against a gallery
+// snapshot get the same results, running the matching stages of the
+// registered hooks. Faces are discounted by their age with the confidence
+// decay, if enabled, and combined with the match strategy.
+type verifier struct {
+	decay    matching.Decay
+	strategy matching.Strategy
+}
+
+func newVerifier(decay matching.Decay, strategy matching.Strategy) *verifier {
+	return &verifier{decay: decay, strategy: strategy}
+}
+
+// Verify reports whether the embedding is at least threshold similar to a
+// face of the user and the hooks did not reject the match, with the
+// similarity of the user under the match strategy
+func (v *verifier) Verify(user *models.User, embedding []float32, threshold float64) (bool, float64, error) {
+	if err := hooks.BeforeMatch(embedding); err != nil {
+		return false, 0, err
+	}
+	confidence := v.best(user, embedding)
+	if !matching.Matches(confidence, threshold) {
+		return false, confidence, nil
+	}
+
+	match := &models.MatchResult{UserID: user.ID, User: user, Confidence: confidence, Matched: true}
+	err := hooks.AfterMatch(embedding, match)
+	if errors.Is(err, models.ErrNoMatch) {
+		return false, confidence, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return true, confidence, nil
+}
+
+// best returns the similarity of the user to the embedding: of their
+// averaged template under the average strategy, otherwise of their face
+// closest to it, as there is nobody to vote against
+func (v *verifier) best(user *models.User, embedding []float32) float64 {
+	if v.strategy != matching.StrategyAverage && v.decay.Enabled() {
+		confidence, _ := decayedBest(v.decay, embedding, user.Faces, time.Now())
+		return confidence
+	}
+	embeddings := make([][]float32, len(user.Faces))
+	for i, f := range user.Faces {
+		embeddings[i] = f.Embedding
+	}
+	return v.strategy.Score(embedding, embeddings)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
 
 	"face/config"
 	"face/internal/database"
@@ -19,6 +20,8 @@ func NewMigrateCmd(cfg *config.Config) *cobra.Command {
 	cmd.AddCommand(newMigrateUpCmd(cfg))
 	cmd.AddCommand(newMigrateDownCmd(cfg))
 	cmd.AddCommand(newMigrateStatusCmd(cfg))
+	cmd.AddCommand(newMigrateForceCmd(cfg))
+	cmd.AddCommand(newMigrateInstallRolesCmd(cfg))
 
 	return cmd
 }
@@ -27,9 +30,10 @@ func newMigrateUpCmd(cfg *config.Config) *cobra.Command {
 	var steps int
 
 	cmd := &cobra.Command{
-		Use:   "up",
-		Short: "Run pending migrations",
-		Long:  `Apply all pending database migrations or a specific number of steps.`,
+		Use:         "up",
+		Short:       "Run pending migrations",
+		Annotations: recordAlways(),
+		Long:        `Apply all pending database migrations or a specific number of steps.`,
 		Example: `  face migrate up
   face migrate up --steps 1`,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -46,9 +50,10 @@ func newMigrateDownCmd(cfg *config.Config) *cobra.Command {
 	var steps int
 
 	cmd := &cobra.Command{
-		Use:   "down",
-		Short: "Rollback migrations",
-		Long:  `Rollback database migrations. By default rolls back one migration.`,
+		Use:         "down",
+		Short:       "Rollback migrations",
+		Annotations: recordAlways(),
+		Long:        `Rollback database migrations. By default rolls back one migration.`,
 		Example: `  face migrate down
   face migrate down --steps 2
   face migrate down --all`,
@@ -75,8 +80,57 @@ func newMigrateStatusCmd(cfg *config.Config) *cobra.Command {
 	}
 }
 
+func newMigrateForceCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:         "force VERSION",
+		Short:       "Record the schema version after repairing a failed migration",
+		Annotations: recordAlways(),
+		Long: `Record VERSION as the applied migration and clear the dirty state, without
+running any migration. Use it after a migration failed part way and the
+database has been restored or repaired by hand to the schema of VERSION;
+-1 means no migration applied.`,
+		Example: `  face migrate force 10`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			version, err := strconv.Atoi(args[0])
+			if err != nil || version < -1 {
+				return fmt.Errorf("invalid version %q", args[0])
+			}
+			return runMigrateForce(cfg, version)
+		},
+	}
+}
+
+func newMigrateInstallRolesCmd(cfg *config.Config) *cobra.Command {
+	var login string
+
+	cmd := &cobra.Command{
+		Use:         "install-roles",
+		Short:       "Install least-privilege roles and row-level security (PostgreSQL)",
+		Annotations: recordAlways(),
+		Long: `Create the face_reader, face_writer and face_admin roles, grant them to the
+role the application logs in as, and enable row-level security so each
+connection only sees the users and faces of its tenant.
+
+Run it as the owner of the tables after 'face migrate up', and again after
+later migrations. Then set "database_roles": true and "tenant" in the config
+file (or FACE_CLI_DB_ROLES and FACE_CLI_TENANT) so the application reads as
+face_reader, writes as face_writer and changes settings as face_admin.
+Rows that existed before installation belong to the empty tenant.`,
+		Example: `  face migrate install-roles --login face_app`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMigrateInstallRoles(cfg, login)
+		},
+	}
+
+	cmd.Flags().StringVar(&login, "login", "", "role the application connects as (required)")
+	_ = cmd.MarkFlagRequired("login")
+
+	return cmd
+}
+
 func runMigrateUp(cfg *config.Config, steps int) error {
-	migrator, err := database.NewMigrator(cfg.DatabaseType, cfg.DatabasePath)
+	migrator, err := cfg.GetMigrator()
 	if err != nil {
 		return fmt.Errorf("failed to create migrator: %w", err)
 	}
@@ -98,7 +152,7 @@ func runMigrateUp(cfg *config.Config, steps int) error {
 }
 
 func runMigrateDown(cfg *config.Config, steps int, all bool) error {
-	migrator, err := database.NewMigrator(cfg.DatabaseType, cfg.DatabasePath)
+	migrator, err := cfg.GetMigrator()
 	if err != nil {
 		return fmt.Errorf("failed to create migrator: %w", err)
 	}
@@ -120,7 +174,7 @@ func runMigrateDown(cfg *config.Config, steps int, all bool) error {
 }
 
 func runMigrateStatus(cfg *config.Config) error {
-	migrator, err := database.NewMigrator(cfg.DatabaseType, cfg.DatabasePath)
+	migrator, err := cfg.GetMigrator()
 	if err != nil {
 		return fmt.Errorf("failed to create migrator: %w", err)
 	}
@@ -138,3 +192,31 @@ func runMigrateStatus(cfg *config.Config) error {
 
 	return nil
 }
+
+func runMigrateForce(cfg *config.Config, version int) error {
+	migrator, err := cfg.GetMigrator()
+	if err != nil {
+		return fmt.Errorf("failed to create migrator: %w", err)
+	}
+	defer migrator.Close()
+
+	if err := migrator.Force(version); err != nil {
+		return err
+	}
+	fmt.Printf("Schema version set to %d\n", version)
+	return nil
+}
+
+func runMigrateInstallRoles(cfg *config.Config, login string) error {
+	if cfg.DatabaseType != database.DatabaseTypePostgres {
+		return fmt.Errorf("roles and row-level security need the postgres database")
+	}
+
+	if err := database.InstallRoles(cfg.DatabasePath, cfg.DatabaseOptions(), login); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Installed roles %s, %s and %s for %s\n", database.RoleReader, database.RoleWriter, database.RoleAdmin, login)
+	fmt.Println("✓ Row-level security enabled on users, faces and changes")
+	return nil
+}
@@ -0,0 +1,481 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"face/config"
+	"face/internal/modelfiles"
+	"face/internal/pipeline/modelspec"
+
+	"github.com/spf13/cobra"
+)
+
+// builtinModel is the name 'face model' gives the built-in embedding
+const builtinModel = "builtin"
+
+// Kinds of the models of 'face model list'
+const (
+	modelKindDetector  = "detector"
+	modelKindEmbedding = "embedding"
+)
+
+// Install states of the models of 'face model list'
+const (
+	modelBuiltIn    = "built in"
+	modelInstalled  = "installed"
+	modelUnverified = "installed, unverified"
+	modelMissing    = "missing"
+	modelCorrupt    = "checksum mismatch"
+	modelInvalid    = "invalid"
+)
+
+func NewModelCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "model",
+		Short: "Download, list and select models",
+		Long: `Manage the face detection cascade and the embedding models in the models
+directory, and choose the embedding model of the gallery.`,
+	}
+
+	cmd.AddCommand(newModelListCmd(cfg))
+	cmd.AddCommand(newModelDownloadCmd(cfg))
+	cmd.AddCommand(newModelUseCmd(cfg))
+
+	return cmd
+}
+
+func newModelListCmd(cfg *config.Config) *cobra.Command {
+	var formatJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the known models and whether they are installed",
+		Long: `List the face detection cascade, the built-in embedding, the ONNX presets
+and the models of embedding_models, with whether their files are in the
+models directory and match their checksums. The embedding model the
+gallery uses is marked active.`,
+		Example: `  face model list
+  face model list --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runModelList(cfg, formatJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func newModelDownloadCmd(cfg *config.Config) *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:         "download [model...]",
+		Short:       "Download models into the models directory",
+		Annotations: recordAlways(),
+		Long: `Download models into the models directory and verify their checksums.
+Without arguments, the files the configured pipeline needs are downloaded:
+the detection cascade and the embedding model of the gallery.
+
+ONNX models are downloaded from the url of their embedding_models entry,
+which also needs the sha256 of the file; models without a checksum are
+not downloaded. Installed files that match their checksum are kept unless
+--force is given.`,
+		Example: `  face model download
+  face model download facefinder
+  face model download arcface --force`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runModelDownload(cmd.Context(), cfg, args, force)
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "download even if the installed file is valid")
+
+	return cmd
+}
+
+func newModelUseCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "use <model>",
+		Short:       "Switch the embedding model of the gallery",
+		Annotations: recordAlways(),
+		Long: `Record the embedding model in the settings of the database, so every
+installation using it computes embeddings with that model, unless its
+config selects one with embedding_model or --model. The model is loaded
+first, so its file must be installed.
+
+'builtin' switches back to the built-in embedding. Embeddings of different
+models cannot be compared, so only a gallery without faces can be switched.`,
+		Example: `  face model use arcface
+  face model use builtin`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runModelUse(cfg, args[0])
+		},
+	}
+
+	return cmd
+}
+
+// modelEntry is a model 'face model' knows: the detection cascade, the
+// built-in embedding or an ONNX embedding model
+type modelEntry struct {
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Path        string `json:"path,omitempty"`
+	Status      string `json:"status"`
+	// EmbeddingModel is the name recorded with a gallery enrolled with the
+	// model, empty for the detector
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	Active         bool   `json:"active"`
+	// Error is why an ONNX model of the config cannot be used
+	Error string `json:"error,omitempty"`
+
+	// download is where the file is downloaded from, nil if it cannot be
+	download *modelfiles.File
+}
+
+// modelCatalog returns the models of the config with their install state
+func modelCatalog(cfg *config.Config) ([]modelEntry, error) {
+	var entries []modelEntry
+	for _, f := range modelfiles.Required {
+		entry := modelEntry{
+			Name:        f.Name,
+			Kind:        modelKindDetector,
+			Description: "Pigo face detection cascade",
+			Path:        filepath.Join(cfg.ModelsDir, f.Name),
+			download:    &f,
+		}
+		if err := entry.check(); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	entries = append(entries, modelEntry{
+		Name:           builtinModel,
+		Kind:           modelKindEmbedding,
+		Description:    fmt.Sprintf("HOG, LBP and region features, %d-d", modelspec.EmbeddingDimension),
+		Status:         modelBuiltIn,
+		EmbeddingModel: modelspec.BackendPigo.EmbeddingModel(),
+	})
+
+	for _, name := range onnxModelNames(cfg) {
+		entry, err := onnxModelEntry(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// onnxModelNames returns the names of the ONNX presets and of the models
+// of embedding_models, sorted
+func onnxModelNames(cfg *config.Config) []string {
+	names := modelspec.ONNXPresetNames()
+	for name := range cfg.EmbeddingModels {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// onnxModelEntry returns the entry of an ONNX model, which is invalid if
+// its embedding_models entry is
+func onnxModelEntry(cfg *config.Config, name string) (modelEntry, error) {
+	entry := modelEntry{Name: name, Kind: modelKindEmbedding}
+	model, err := modelspec.ResolveONNX(name, cfg.EmbeddingModels, cfg.ModelsDir)
+	if err != nil {
+		entry.Status, entry.Error = modelInvalid, err.Error()
+		return entry, nil
+	}
+
+	entry.Description = fmt.Sprintf("ONNX, %dx%d input, %d-d", model.InputSize, model.InputSize, model.Dimension)
+	entry.Path = model.Path
+	entry.EmbeddingModel = model.EmbeddingModel()
+	if model.URL != "" {
+		entry.download = &modelfiles.File{Name: name, URL: model.URL, SHA256: model.SHA256}
+	}
+	return entry, entry.check()
+}
+
+// check sets the install state of a model with a file
+func (e *modelEntry) check() error {
+	if _, err := os.Stat(e.Path); errors.Is(err, os.ErrNotExist) {
+		e.Status = modelMissing
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check %s: %w", e.Path, err)
+	}
+
+	if e.download == nil || e.download.SHA256 == "" {
+		e.Status = modelUnverified
+		return nil
+	}
+	valid, err := modelfiles.Verify(*e.download, e.Path)
+	if err != nil {
+		return err
+	}
+	e.Status = modelInstalled
+	if !valid {
+		e.Status = modelCorrupt
+	}
+	return nil
+}
+
+// activeEmbeddingModel returns the embedding model the gallery of the
+// database uses, as recorded with it. Before the database is set up, e.g.
+// by 'face init', it is the model of the config.
+func activeEmbeddingModel(cfg *config.Config) (string, error) {
+	recorded, err := recordedEmbeddingModel(cfg)
+	if err != nil {
+		slog.Debug("using the configured embedding model", "error", err)
+	}
+	model, _, err := cfg.WithGalleryModel(recorded).Embedding()
+	return model, err
+}
+
+// recordedEmbeddingModel returns the embedding model recorded with the
+// gallery of the database
+func recordedEmbeddingModel(cfg *config.Config) (string, error) {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return "", err
+	}
+	return settings.EmbeddingModel, nil
+}
+
+func runModelList(cfg *config.Config, formatJSON bool) error {
+	entries, err := modelCatalog(cfg)
+	if err != nil {
+		return err
+	}
+	active, err := activeEmbeddingModel(cfg)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].Active = entries[i].Kind == modelKindEmbedding && entries[i].EmbeddingModel == active
+	}
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	fmt.Printf("\nModels in %s\n", cfg.ModelsDir)
+	for _, kind := range []string{modelKindDetector, modelKindEmbedding} {
+		fmt.Printf("\n%s\n", map[string]string{modelKindDetector: "Detection", modelKindEmbedding: "Embedding"}[kind])
+		for i := range entries {
+			if entries[i].Kind == kind {
+				printModelEntry(&entries[i])
+			}
+		}
+	}
+	fmt.Println("\nDownload with 'face model download <model>', switch the gallery with 'face model use <model>'.")
+	return nil
+}
+
+func printModelEntry(e *modelEntry) {
+	mark := "✗"
+	switch e.Status {
+	case modelBuiltIn, modelInstalled:
+		mark = "✓"
+	case modelUnverified:
+		mark = "⚠"
+	}
+	active := ""
+	if e.Active {
+		active = " (active)"
+	}
+
+	if e.Error != "" {
+		fmt.Printf("  %s %-14s %s: %s\n", mark, e.Name, e.Status, e.Error)
+		return
+	}
+	fmt.Printf("  %s %-14s %-36s %s%s\n", mark, e.Name, e.Description, e.Status, active)
+}
+
+// defaultDownloads returns the models the configured pipeline needs: the
+// detection cascade and the ONNX model of the gallery, if it has one
+func defaultDownloads(cfg *config.Config, entries []modelEntry) ([]string, error) {
+	active, err := activeEmbeddingModel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Kind == modelKindDetector || (e.EmbeddingModel == active && e.Status != modelBuiltIn) {
+			names = append(names, e.Name)
+		}
+	}
+	return names, nil
+}
+
+func runModelDownload(ctx context.Context, cfg *config.Config, names []string, force bool) error {
+	entries, err := modelCatalog(cfg)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		if names, err = defaultDownloads(cfg, entries); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		i := slices.IndexFunc(entries, func(e modelEntry) bool { return e.Name == name })
+		if i < 0 {
+			return fmt.Errorf("unknown model %q (see 'face model list')", name)
+		}
+		if err := downloadModel(ctx, &entries[i], force); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadModel downloads the file of a model unless it is installed
+func downloadModel(ctx context.Context, e *modelEntry, force bool) error {
+	switch {
+	case e.Status == modelBuiltIn:
+		fmt.Printf("• %s is built in, nothing to download\n", e.Name)
+		return nil
+	case e.Status == modelInvalid:
+		return fmt.Errorf("model %s: %s", e.Name, e.Error)
+	case e.Status == modelInstalled && !force:
+		fmt.Printf("• %s is already installed in %s\n", e.Name, e.Path)
+		return nil
+	case e.download == nil:
+		return fmt.Errorf("no download URL is known for %s: set url and sha256 in embedding_models.%s, or copy the file to %s", e.Name, e.Name, e.Path)
+	case e.download.SHA256 == "":
+		return fmt.Errorf("no checksum is known for %s: set sha256 in embedding_models.%s to download it", e.Name, e.Name)
+	}
+
+	fmt.Printf("Downloading %s from %s...\n", e.Name, e.download.URL)
+	if err := modelfiles.Download(ctx, http.DefaultClient, *e.download, e.Path); err != nil {
+		return err
+	}
+	fmt.Printf("✓ %s installed in %s (checksum verified)\n", e.Name, e.Path)
+	return nil
+}
+
+func runModelUse(cfg *config.Config, name string) error {
+	selected, err := selectEmbeddingModel(cfg, name)
+	if err != nil {
+		return err
+	}
+
+	// the model is loaded with the config selecting it, to know it runs
+	detector, extractor, err := newPipeline(selected)
+	if err != nil {
+		return err
+	}
+	detector.Close()
+	extractor.Close()
+
+	model, _, err := selected.Embedding()
+	if err != nil {
+		return err
+	}
+	return recordGalleryModel(cfg, selected, name, model)
+}
+
+// selectEmbeddingModel returns a copy of the config selecting the named
+// embedding model, which must be installed
+func selectEmbeddingModel(cfg *config.Config, name string) (*config.Config, error) {
+	backend, err := modelspec.ParseBackend(cfg.PipelineBackend)
+	if err != nil {
+		return nil, err
+	}
+	if backend == modelspec.BackendMock {
+		return nil, fmt.Errorf("the mock pipeline has no embedding models: set pipeline_backend to pigo first")
+	}
+
+	selected := *cfg
+	selected.EmbeddingModel = ""
+	if name != builtinModel {
+		model, err := modelspec.ResolveONNX(name, cfg.EmbeddingModels, cfg.ModelsDir)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(model.Path); errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s is not installed in %s: download it with 'face model download %s'", name, model.Path, name)
+		}
+		selected.EmbeddingModel = name
+	}
+	return &selected, nil
+}
+
+// recordGalleryModel records the model with the gallery, which must not
+// hold faces of another model
+func recordGalleryModel(cfg, selected *config.Config, name, model string) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	if settings.EmbeddingModel == model {
+		fmt.Printf("✓ The gallery already uses %s (%s)\n", name, model)
+		warnModelOverride(cfg, name)
+		return nil
+	}
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	faces := 0
+	for i := range users {
+		faces += len(users[i].Faces)
+	}
+	if faces > 0 {
+		return fmt.Errorf("the gallery holds %d face(s) computed with %s, which cannot be compared with embeddings of %s: recompute them with 'face reembed %s'",
+			faces, cmp.Or(settings.EmbeddingModel, "the configured model"), model, name)
+	}
+
+	// an unrecorded model is recorded as with a new gallery
+	settings.EmbeddingModel = ""
+	if err := checkEmbeddingModel(selected, db, settings); err != nil {
+		return err
+	}
+	fmt.Printf("✓ The gallery now uses %s (%s)\n", name, model)
+	warnModelOverride(cfg, name)
+	return nil
+}
+
+// warnModelOverride warns if the config selects another embedding model
+// than the gallery's, as commands run with it would refuse the gallery
+func warnModelOverride(cfg *config.Config, name string) {
+	if cfg.EmbeddingModel != "" && cfg.EmbeddingModel != name {
+		fmt.Printf("⚠ embedding_model (or --model) selects %s, which overrides the gallery's model: unset it to use %s\n", cfg.EmbeddingModel, name)
+	}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"face/config"
+	"face/internal/database/models"
+	"face/internal/homeassistant"
+	"face/internal/redaction"
+
+	"github.com/spf13/cobra"
+)
+
+func NewMQTTCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mqtt",
+		Short: "Home Assistant MQTT integration commands",
+		Long: `Publish recognition events to an MQTT broker for Home Assistant.
+
+Set mqtt_broker in the config file (or FACE_CLI_MQTT_BROKER) and 'face
+identify' publishes every result. Users appear in Home Assistant as device
+trackers, which can be assigned to people, and cameras named with
+'face identify --camera' as sensors holding the last recognized person.`,
+	}
+
+	cmd.AddCommand(newMQTTAnnounceCmd(cfg))
+
+	return cmd
+}
+
+func newMQTTAnnounceCmd(cfg *config.Config) *cobra.Command {
+	var cameras []string
+
+	cmd := &cobra.Command{
+		Use:   "announce",
+		Short: "Create Home Assistant entities for all users",
+		Long: `Publish the Home Assistant discovery config of every enrolled user, and of
+the given cameras, so their entities exist before anyone is recognized.
+'face identify' announces the users and cameras it sees itself; this is
+only needed to set up automations in advance or after renaming users.`,
+		Example: `  face mqtt announce
+  face mqtt announce --camera "Front door" --camera Garage`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runMQTTAnnounce(cfg, cameras)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&cameras, "camera", nil, "also announce this camera (repeatable)")
+
+	return cmd
+}
+
+func runMQTTAnnounce(cfg *config.Config, cameras []string) error {
+	if cfg.MQTTBroker == "" {
+		return fmt.Errorf("no MQTT broker configured (mqtt_broker in the config, or FACE_CLI_MQTT_BROKER)")
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	publisher, err := homeassistant.Connect(cfg.MQTT())
+	if err != nil {
+		return err
+	}
+	defer publisher.Close()
+
+	for i := range users {
+		if err := publisher.AnnouncePerson(mqttPerson(redactor, &users[i])); err != nil {
+			return err
+		}
+	}
+	for _, camera := range cameras {
+		if err := publisher.AnnounceCamera(camera); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("✓ Announced %d user(s) and %d camera(s) to %s\n", len(users), len(cameras), config.RedactConnectionString(cfg.MQTTBroker))
+	return nil
+}
+
+// publishRecognition publishes the result of identifying a face to Home
+// Assistant, announcing the matched user and the camera first. match is
+// nil if no one matched. The user is redacted to the configured level.
+// Failures are reported as warnings, since the identification itself
+// succeeded.
+func publishRecognition(cfg *config.Config, redactor *redaction.Redactor, match *models.MatchResult, camera string) {
+	publisher, err := homeassistant.Connect(cfg.MQTT())
+	if err != nil {
+		fmt.Printf("Warning: result not published to MQTT: %v\n", err)
+		return
+	}
+	defer publisher.Close()
+
+	recognition := homeassistant.Recognition{Camera: camera, Time: time.Now()}
+	if match != nil {
+		user := redactor.User(match.User)
+		recognition.Matched = true
+		recognition.UserID = user.ID
+		recognition.Name = user.Name
+		recognition.FaceID = redactor.FaceID(match.FaceID)
+		recognition.Confidence = match.Confidence
+		err = publisher.AnnouncePerson(mqttPerson(redactor, match.User))
+	}
+	if err == nil && camera != "" {
+		err = publisher.AnnounceCamera(camera)
+	}
+	if err == nil {
+		err = publisher.PublishRecognition(recognition)
+	}
+	if err != nil {
+		fmt.Printf("Warning: result not published to MQTT: %v\n", err)
+	}
+}
+
+// mqttPerson returns the user as announced to Home Assistant, redacted and
+// named by the pseudonymous ID when names are redacted too
+func mqttPerson(redactor *redaction.Redactor, user *models.User) *models.User {
+	person := redactor.User(user)
+	person.Name = redactor.Label(user)
+	return person
+}
+
+// forgetMQTTPerson removes a deleted user's entity from Home Assistant, if
+// a broker is configured
+func forgetMQTTPerson(cfg *config.Config, userID string) {
+	if cfg.MQTTBroker == "" {
+		return
+	}
+
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		fmt.Printf("Warning: user not removed from Home Assistant: %v\n", err)
+		return
+	}
+
+	publisher, err := homeassistant.Connect(cfg.MQTT())
+	if err == nil {
+		err = publisher.ForgetPerson(redactor.UserID(userID))
+		publisher.Close()
+	}
+	if err != nil {
+		fmt.Printf("Warning: user not removed from Home Assistant: %v\n", err)
+	}
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database/models"
+	"face/internal/notify"
+	"face/internal/redaction"
+
+	"github.com/spf13/cobra"
+)
+
+// DefaultExpiringWithin is how far ahead 'face notify expiring' looks
+const DefaultExpiringWithin = 24 * time.Hour
+
+func NewNotifyCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Email, SMS, Slack and Teams notifications",
+		Long: `Send email (SMTP), SMS (Twilio), Slack and Microsoft Teams notifications of
+events, configured under "notifications" in the config file:
+
+  {
+    "notifications": {
+      "smtp": {"host": "smtp.example.com", "port": 587, "username": "face",
+               "password": "...", "from": "face@example.com"},
+      "twilio": {"account_sid": "AC...", "auth_token": "...", "from": "+15550100"},
+      "rules": [
+        {"event": "enrolled", "channel": "email", "to": ["security@example.com"]},
+        {"event": "watchlist_match", "channel": "sms", "to": ["+15550199"],
+         "template": "{{.Name}} seen at {{.Camera}}"},
+        {"event": "system_error", "channel": "slack", "min_interval_minutes": 15,
+         "webhook": "https://hooks.slack.com/services/..."}
+      ]
+    }
+  }
+
+Events:
+  - enrolled: a user was enrolled, by 'face enroll' or the REST API
+  - watchlist_match: a user whose "watchlist" metadata entry (or the entry
+    named by watchlist_key) is true was identified, by 'face identify' or
+    the REST API
+  - expiring: a visitor's access expires soon, sent by 'face notify expiring'
+  - verify_failures: verifying a user failed verify_failures times (default
+    3) within verify_failure_window_minutes (default 10), by 'face serve'
+  - system_error: an API request of 'face serve' failed with an internal error
+
+Email and SMS rules list recipients in "to", Slack and Teams rules the
+incoming webhook URL in "webhook". Subject (the title of Slack and Teams
+messages) and template are Go text/templates of the fields Event, Severity,
+Time, Tenant, UserID, Name, Email, Phone, Faces, Confidence, Percent, Camera,
+ExpiresAt, Failures, Error and RequestID; every event has a default.
+watchlist_match, verify_failures and system_error are of high severity.
+
+min_interval_minutes rate limits a rule: messages within the interval of the
+previous one are suppressed, and the next one says how many were. "tenants"
+limits a rule to installations whose tenant is listed.
+
+Users are redacted to the configured redaction level. FACE_CLI_SMTP_PASSWORD
+and FACE_CLI_TWILIO_AUTH_TOKEN override the secrets of the config file.
+
+A notification that cannot be sent is reported as a warning; it never fails
+the enrollment or identification it is about.`,
+	}
+
+	cmd.AddCommand(newNotifyTestCmd(cfg))
+	cmd.AddCommand(newNotifyExpiringCmd(cfg))
+
+	return cmd
+}
+
+func newNotifyTestCmd(cfg *config.Config) *cobra.Command {
+	var (
+		event  string
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a test message through every notification rule",
+		Long: `Render the template of every notification rule with a made-up user and send
+it, to check the templates, the SMTP and Twilio credentials and the
+recipients before a real event happens.`,
+		Example: `  face notify test
+  face notify test --event watchlist_match
+  face notify test --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNotifyTest(cmd.Context(), cfg, notify.Event(event), dryRun)
+		},
+	}
+
+	cmd.Flags().StringVar(&event, "event", "", "only test the rules of this event: enrolled, expiring, watchlist_match, verify_failures, system_error")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the messages instead of sending them")
+
+	return cmd
+}
+
+func newNotifyExpiringCmd(cfg *config.Config) *cobra.Command {
+	var (
+		within time.Duration
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "expiring",
+		Short: "Notify about visitors whose access expires soon",
+		Long: `Send the expiring notifications of the visitors enrolled with 'face enroll
+--temporary' whose access expires within --within.
+
+Run it from cron or a systemd timer as often as --within, e.g. daily with
+the default of 24h, so every visitor is reported once.`,
+		Example: `  face notify expiring
+  face notify expiring --within 2h --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runNotifyExpiring(cmd.Context(), cfg, within, dryRun)
+		},
+	}
+
+	cmd.Flags().DurationVar(&within, "within", DefaultExpiringWithin, "how far ahead to look for expiring access")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the visitors")
+
+	return cmd
+}
+
+func runNotifyTest(ctx context.Context, cfg *config.Config, event notify.Event, dryRun bool) error {
+	notifier, err := notify.New(cfg.Notify())
+	if err != nil {
+		return err
+	}
+
+	events := notify.Events
+	if event != "" {
+		if !slices.Contains(notify.Events, event) {
+			return fmt.Errorf("unknown event %q (use enrolled, expiring, watchlist_match, verify_failures or system_error)", event)
+		}
+		events = []notify.Event{event}
+	}
+
+	sent, failed := 0, 0
+	for _, e := range events {
+		data := testNotification(e)
+		for _, rule := range notifier.Rules(e) {
+			msg, err := rule.Render(data)
+			if err == nil && dryRun {
+				printNotification(e, rule, msg)
+				continue
+			}
+			if err == nil {
+				err = notifier.Send(ctx, msg)
+			}
+			if err != nil {
+				fmt.Printf("✗ %s by %s: %v\n", e, rule.Recipients(), err)
+				failed++
+				continue
+			}
+			fmt.Printf("✓ %s by %s\n", e, rule.Recipients())
+			sent++
+		}
+	}
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d of %d notifications failed", failed, sent+failed)
+	case sent == 0 && !dryRun:
+		fmt.Println("No notification rules configured, see 'face notify --help'")
+	}
+	return nil
+}
+
+// testNotification returns made-up data of an event
+func testNotification(event notify.Event) notify.Data {
+	now := time.Now()
+	return notify.Data{
+		Event:      event,
+		Time:       now,
+		UserID:     "00000000-0000-0000-0000-000000000000",
+		Name:       "Test User",
+		Email:      "test.user@example.com",
+		Phone:      "+15550100",
+		Faces:      3,
+		Confidence: 0.93,
+		Camera:     "Test camera",
+		ExpiresAt:  now.Add(DefaultExpiringWithin),
+		Failures:   notify.DefaultVerifyFailures,
+		Error:      "test error",
+		RequestID:  "00000000-0000-0000-0000-000000000000",
+	}
+}
+
+func printNotification(event notify.Event, rule notify.Rule, msg notify.Message) {
+	fmt.Printf("• %s by %s\n", event, rule.Recipients())
+	if msg.Channel != notify.ChannelSMS {
+		fmt.Printf("  Subject: %s\n", msg.Subject)
+	}
+	for _, line := range strings.Split(strings.TrimRight(msg.Body, "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+}
+
+func runNotifyExpiring(ctx context.Context, cfg *config.Config, within time.Duration, dryRun bool) error {
+	if within <= 0 {
+		return errors.New("--within must be positive")
+	}
+	notifier, err := notify.New(cfg.Notify())
+	if err != nil {
+		return err
+	}
+	if len(notifier.Rules(notify.EventExpiring)) == 0 && !dryRun {
+		return errors.New("no notification rules for the expiring event, see 'face notify --help'")
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	now := time.Now()
+	expiring, failed := 0, 0
+	for i := range users {
+		user := &users[i]
+		if !user.IsVisitor() || user.Expired(now) || user.ExpiresAt.After(now.Add(within)) {
+			continue
+		}
+		expiring++
+		if dryRun {
+			fmt.Printf("  • %s expires %s\n", redactor.Label(user), user.ExpiresAt.Local().Format("2006-01-02 15:04"))
+			continue
+		}
+		if err := notifier.Notify(ctx, userNotification(redactor, notify.EventExpiring, user)); err != nil {
+			fmt.Printf("✗ %s: %v\n", redactor.Label(user), err)
+			failed++
+			continue
+		}
+		fmt.Printf("✓ Notified that %s expires %s\n", redactor.Label(user), user.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+
+	switch {
+	case expiring == 0:
+		fmt.Printf("No visitor's access expires within %s\n", within)
+	case failed > 0:
+		return fmt.Errorf("%d of %d notifications failed", failed, expiring)
+	}
+	return nil
+}
+
+// userNotification returns the data of an event about a user, redacted to
+// the level of the redactor
+func userNotification(redactor *redaction.Redactor, event notify.Event, user *models.User) notify.Data {
+	data := notify.UserData(event, redactor.User(user))
+	data.Name = redactor.Label(user)
+	data.Faces = len(user.Faces)
+	if user.ExpiresAt != nil {
+		data.ExpiresAt = *user.ExpiresAt
+	}
+	return data
+}
+
+// notifyUser sends the notifications of an event about a user from a
+// command, warning about those that could not be sent. The confidence and
+// camera are those of an identification, if the event is one.
+func notifyUser(cfg *config.Config, event notify.Event, user *models.User, confidence float64, camera string) {
+	if !cfg.Notify().Enabled(event) {
+		return
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		fmt.Printf("Warning: notification not sent: %v\n", err)
+		return
+	}
+	notifier, err := notify.New(cfg.Notify())
+	if err != nil {
+		fmt.Printf("Warning: notification not sent: %v\n", err)
+		return
+	}
+
+	data := userNotification(redactor, event, user)
+	data.Confidence, data.Camera = confidence, camera
+	if err := notifier.Notify(context.Background(), data); err != nil {
+		slog.Warn("notification failed", "event", event, "user_id", redactor.UserID(user.ID), "error", err)
+		fmt.Printf("Warning: notification not sent: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ %s notification sent\n", event)
+}
+
+// sendNotification sends a notification in the background, logging
+// failures
+func sendNotification(logger *slog.Logger, notifier *notify.Notifier, data notify.Data) {
+	go func() {
+		if err := notifier.Notify(context.Background(), data); err != nil {
+			logger.Warn("notification failed", "event", data.Event, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/embedding"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func NewOutliersCmd(cfg *config.Config) *cobra.Command {
+	var (
+		userID        string
+		all           bool
+		minSimilarity float64
+		remove        bool
+		formatJSON    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:         "outliers",
+		Short:       "Find faces that do not look like the rest of a user's faces",
+		Annotations: recordWith("remove"),
+		Long: `Flag enrolled faces whose embedding is far from the centroid of the other
+faces of the same user. These are usually photos of the wrong person that
+were enrolled by accident, and they cause false matches.
+
+Users need at least 3 faces to be checked. With --remove, each flagged face
+is shown and removed after confirmation.`,
+		Example: `  face outliers --id abc-123
+  face outliers --all
+  face outliers --all --min-similarity 0.6 --remove`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if remove && formatJSON {
+				return fmt.Errorf("--remove cannot be combined with --json")
+			}
+			return runOutliers(cfg, userID, minSimilarity, remove, formatJSON)
+		},
+	}
+
+	cmd.Flags().StringVar(&userID, "id", "", "user ID or unique prefix to check")
+	cmd.Flags().BoolVar(&all, "all", false, "check every user")
+	cmd.Flags().Float64Var(&minSimilarity, "min-similarity", 0.5, "flag faces less similar than this to their user's centroid")
+	cmd.Flags().BoolVar(&remove, "remove", false, "interactively remove flagged faces")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+	cmd.MarkFlagsMutuallyExclusive("id", "all")
+	cmd.MarkFlagsOneRequired("id", "all")
+
+	return cmd
+}
+
+// faceOutlier is a flagged face and the user it belongs to
+type faceOutlier struct {
+	UserID     string  `json:"user_id"`
+	UserName   string  `json:"user_name"`
+	FaceID     string  `json:"face_id"`
+	Filename   string  `json:"filename"`
+	Similarity float64 `json:"similarity"`
+}
+
+func runOutliers(cfg *config.Config, userID string, minSimilarity float64, remove, formatJSON bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	var users []models.User
+	if userID != "" {
+		user, err := database.GetUserByIDPrefix(db, userID)
+		if err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		users = []models.User{*user}
+	} else {
+		users, err = db.ListUsers()
+		if err != nil {
+			return fmt.Errorf("failed to list users: %w", err)
+		}
+	}
+
+	outliers := []faceOutlier{}
+	checked := 0
+	for i := range users {
+		if len(users[i].Faces) < embedding.MinOutlierFaces {
+			continue
+		}
+		checked++
+		outliers = append(outliers, userOutliers(&users[i], minSimilarity)...)
+	}
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(outliers, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	if checked == 0 {
+		fmt.Printf("No users with at least %d faces to check.\n", embedding.MinOutlierFaces)
+		return nil
+	}
+
+	if len(outliers) == 0 {
+		fmt.Printf("✓ No outliers found in %d user(s) (similarity >= %.2f)\n", checked, minSimilarity)
+		return nil
+	}
+
+	fmt.Printf("\nFound %d outlier face(s) in %d user(s) checked (similarity < %.2f):\n\n", len(outliers), checked, minSimilarity)
+	for _, o := range outliers {
+		fmt.Printf("  ✗ %s (%s): face %s, similarity %.4f\n", o.UserName, o.UserID, o.FaceID, o.Similarity)
+	}
+
+	if !remove {
+		fmt.Println("\nInspect a face with 'face embedding inspect --face-id <id>' or re-run with --remove.")
+		return nil
+	}
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	return removeOutliers(db, stor, outliers)
+}
+
+func userOutliers(user *models.User, minSimilarity float64) []faceOutlier {
+	filenames := make(map[string]string, len(user.Faces))
+	for _, f := range user.Faces {
+		filenames[f.ID] = f.Filename
+	}
+
+	var result []faceOutlier
+	for _, o := range embedding.FindOutliers(user.Faces, minSimilarity) {
+		result = append(result, faceOutlier{
+			UserID:     user.ID,
+			UserName:   user.Name,
+			FaceID:     o.FaceID,
+			Filename:   filenames[o.FaceID],
+			Similarity: o.Similarity,
+		})
+	}
+	return result
+}
+
+// removeOutliers asks for each outlier whether to remove it. A user's last
+// face is never removed.
+func removeOutliers(db database.Database, stor storage.Storage, outliers []faceOutlier) error {
+	reader := bufio.NewReader(os.Stdin)
+	removed := 0
+
+	for _, o := range outliers {
+		fmt.Printf("\nRemove face %s of %s (image %s)? (yes/no): ", o.FaceID, o.UserName, o.Filename)
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		response = strings.TrimSpace(strings.ToLower(response))
+		if response != "yes" && response != "y" {
+			fmt.Println("  • Kept")
+			continue
+		}
+
+		user, err := db.GetUser(o.UserID)
+		if err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		if len(user.Faces) <= 1 {
+			fmt.Println("  ✗ Not removed: it is the user's last face")
+			continue
+		}
+
+		if err := db.RemoveFace(o.UserID, o.FaceID); err != nil {
+			return fmt.Errorf("failed to remove face from database: %w", err)
+		}
+		if err := stor.DeleteImage(o.Filename); err != nil {
+			fmt.Printf("Warning: failed to delete image file: %v\n", err)
+		}
+		refreshAvatar(db, stor, o.UserID)
+
+		slog.Info("outlier face removed", "user_id", o.UserID, "face_id", o.FaceID, "similarity", o.Similarity)
+		fmt.Println("  ✓ Removed")
+		removed++
+	}
+
+	fmt.Printf("\n✓ Removed %d of %d outlier face(s)\n", removed, len(outliers))
+	return nil
+}
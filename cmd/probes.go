@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/erasure"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// probeImageOwner is the user ID probe crops are stored under, as they
+// belong to no enrolled face
+const probeImageOwner = "probe"
+
+// checkProbeStore returns database.ErrProbeStoreUnsupported if probes are
+// to be saved but db cannot keep them, so --save-probe fails before
+// anything is decided
+func checkProbeStore(db database.Database, save bool) error {
+	if !save {
+		return nil
+	}
+	store, ok := db.(database.ProbeStore)
+	if !ok {
+		return database.ErrProbeStoreUnsupported
+	}
+	// databases bound to a deadline keep probes only if the one they wrap
+	// does
+	if _, err := store.GetProbe(""); errors.Is(err, database.ErrProbeStoreUnsupported) {
+		return err
+	}
+	return nil
+}
+
+// saveProbe saves the probe of a decision for review, if save is set, and
+// links it to the decision's audit event, which is recorded afterwards.
+// Nothing is saved if the operation failed before deciding; a probe that
+// cannot be saved is warned about, as the decision stands either way.
+func saveProbe(fs *FaceSystem, event *models.AuditEvent, result *FaceResult, threshold float64, save bool, err error) {
+	if !save || err != nil || result == nil {
+		return
+	}
+	setAuditResult(event, nil)
+	probe, err := storeProbe(fs, event, result, threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: probe not saved: %v\n", err)
+		return
+	}
+	event.ProbeID = probe.ID
+	fmt.Printf("• Probe saved for review: %s (see 'face audit probe')\n", probe.ID)
+}
+
+// storeProbe stores the crop of a probe and the probe with the decision of
+// its audit event
+func storeProbe(fs *FaceSystem, event *models.AuditEvent, result *FaceResult, threshold float64) (*models.Probe, error) {
+	store, ok := fs.DB.(database.ProbeStore)
+	if !ok {
+		return nil, database.ErrProbeStoreUnsupported
+	}
+
+	probe := &models.Probe{
+		ID:         uuid.New().String(),
+		CapturedAt: time.Now(),
+		Operation:  event.Operation,
+		UserID:     event.UserID,
+		Matched:    event.Result == models.AuditSucceeded,
+		Confidence: event.Confidence,
+		Threshold:  threshold,
+		Quality:    result.QualityScore,
+		Embedding:  result.Embedding,
+		RequestID:  event.RequestID,
+	}
+	filename, err := fs.saveFace(probeImageOwner, probe.ID, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save probe image: %w", err)
+	}
+	probe.Filename = filename
+
+	if err := store.SaveProbe(probe); err != nil {
+		_ = fs.Storage.DeleteImage(filename)
+		return nil, err
+	}
+	return probe, nil
+}
+
+// deleteProbes deletes the probes matching a filter with their images,
+// returning the images deleted; databases without probes have none
+func deleteProbes(cfg *config.Config, db database.Database, filter database.ProbeFilter) ([]erasure.File, error) {
+	store, ok := db.(database.ProbeStore)
+	if !ok {
+		return nil, nil
+	}
+	probes, err := store.DeleteProbes(filter)
+	if err != nil || len(probes) == 0 {
+		return nil, err
+	}
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	return deleteProbeImages(stor, probes)
+}
+
+// deleteProbeImages deletes the crops of probes
+func deleteProbeImages(stor storage.Storage, probes []models.Probe) ([]erasure.File, error) {
+	files := make([]erasure.File, 0, len(probes))
+	for _, probe := range probes {
+		file := erasure.File{Path: probe.Filename, Action: erasure.ActionDeleted}
+		if data, err := stor.LoadData(probe.Filename); err == nil {
+			file.SHA256 = erasure.HashBytes(data)
+		}
+		if err := stor.DeleteImage(probe.Filename); err != nil {
+			return files, fmt.Errorf("failed to delete probe image %s: %w", probe.Filename, err)
+		}
+		file.ErasedAt = time.Now().UTC()
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// prompter reads answers to interactive questions from stdin
+type prompter struct {
+	reader *bufio.Reader
+}
+
+func newPrompter() *prompter {
+	return &prompter{reader: bufio.NewReader(os.Stdin)}
+}
+
+// ask prints a question and returns the answer, or def when left empty
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	response, err := p.reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return def, nil
+	}
+	return response, nil
+}
+
+// confirm asks a yes/no question and returns def when left empty
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+
+	response, err := p.ask(fmt.Sprintf("%s (%s)", question, hint), "")
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(response) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// choose asks the user to pick one of the options and returns def when left empty
+func (p *prompter) choose(question string, options []string, def string) (string, error) {
+	for {
+		response, err := p.ask(fmt.Sprintf("%s (%s)", question, strings.Join(options, "/")), def)
+		if err != nil {
+			return "", err
+		}
+		for _, option := range options {
+			if strings.EqualFold(response, option) {
+				return option, nil
+			}
+		}
+		if response == def {
+			return "", fmt.Errorf("invalid choice %q", response)
+		}
+		fmt.Printf("  ✗ Please choose one of: %s\n", strings.Join(options, ", "))
+	}
+}
+
+// readSecret asks for a PIN or code without echoing it. When stdin is not
+// a terminal, the first line of stdin is read instead, for scripts.
+func readSecret(question string) (string, error) {
+	if !stdinIsTerminal() {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read input: %w", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	fmt.Printf("%s: ", question)
+	secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(string(secret)), nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"face/config"
+	"face/internal/database/models"
+
+	"github.com/spf13/cobra"
+)
+
+func NewPruneCmd(cfg *config.Config) *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:         "prune",
+		Short:       "Delete visitors whose access has expired",
+		Annotations: recordWith("!dry-run"),
+		Long: `Delete the visitors enrolled with 'face enroll --temporary' whose access has
+expired, together with their face images. Expired visitors are already left
+out of identification; pruning removes their data for good, so the deletion
+cannot be undone.
+
+Deletions and removed faces kept for 'face undo' whose undo window has
+passed are finished too, so their images do not wait for the next delete or
+update.
+
+Run it from cron or a systemd timer to clean up visitors without manual work.`,
+		Example: `  face prune
+  face prune --dry-run`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPrune(cfg, dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only list the expired visitors")
+
+	return cmd
+}
+
+func runPrune(cfg *config.Config, dryRun bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	if !dryRun {
+		settleExpiredUndo(cfg, db, stor)
+	}
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	now := time.Now()
+	expired, failed := 0, 0
+	for i := range users {
+		user := &users[i]
+		if !user.Expired(now) {
+			continue
+		}
+
+		expired++
+		fmt.Printf("• %s (%s) expired %s\n", user.Name, user.ID, user.ExpiresAt.Format("2006-01-02 15:04:05"))
+		if dryRun {
+			continue
+		}
+
+		err := db.SoftDeleteUser(user.ID)
+		if err != nil {
+			err = fmt.Errorf("failed to mark user deleted: %w", err)
+		} else if err = finalizeUserDeletion(db, stor, user); err != nil {
+			err = fmt.Errorf("%w\n    Run 'face doctor --fix' to resume", err)
+		}
+		startAudit(cfg, db, models.AuditDelete, user.ID).finish(err)
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			failed++
+			continue
+		}
+		forgetMQTTPerson(cfg, user.ID)
+
+		slog.Info("visitor pruned", "user_id", user.ID)
+		fmt.Println("  ✓ Deleted")
+	}
+
+	switch {
+	case expired == 0:
+		fmt.Println("✓ No expired visitors")
+	case dryRun:
+		fmt.Printf("\n%d expired visitor(s), run without --dry-run to delete them\n", expired)
+	case failed > 0:
+		return fmt.Errorf("%d of %d expired visitor(s) could not be deleted", failed, expired)
+	default:
+		fmt.Printf("\n✓ Deleted %d expired visitor(s)\n", expired)
+	}
+	return nil
+}
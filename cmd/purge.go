@@ -0,0 +1,293 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/erasure"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+func NewPurgeCmd(cfg *config.Config) *cobra.Command {
+	var (
+		selection userSelection
+		confirm   bool
+		receipt   string
+	)
+
+	cmd := &cobra.Command{
+		Use:         "purge",
+		Short:       "Erase a user for good and write a receipt of the erasure",
+		Annotations: recordAlways(),
+		Long: `Erase a user at once, for right-to-erasure requests: the user, their faces
+and every image of them, including a face kept for 'face undo' and probes
+saved for review with --save-probe, with no undo.
+Users deleted with 'face delete' but still within the undo window can be
+purged by ID.
+
+With the json database, the database is then rewritten and the copies of it
+that can still hold the user, the backup kept while saving and the journal,
+are shredded: overwritten with random data before they are removed. The undo
+file is shredded if it refers to the user.
+
+The receipt is a JSON file with the user ID, hashes of the name, of every
+embedding and of every file erased, and when each was erased. It is sealed
+with an HMAC-SHA256 digest when erasure_key (FACE_CLI_ERASURE_KEY) is set,
+and a plain SHA-256 otherwise. Check it with 'face purge verify'.
+
+Backups taken with 'face backup' and copies outside the database and
+storage are not touched.`,
+		Example: `  face purge --id abc-123
+  face purge --user-name "John Doe" --receipt erasure-john.json --confirm
+  face purge verify erasure-abc-123.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runPurge(cfg, selection, confirm, receipt)
+		},
+	}
+
+	cmd.Flags().StringVar(&selection.ID, "id", "", "user ID or unique prefix to purge")
+	cmd.Flags().BoolVarP(&confirm, "confirm", "y", false, "skip confirmation prompt")
+	cmd.Flags().StringVarP(&receipt, "receipt", "o", "", "receipt file to write (default erasure-<user ID>.json)")
+	selection.addNameFlags(cmd, "id", false)
+
+	cmd.AddCommand(newPurgeVerifyCmd(cfg))
+	return cmd
+}
+
+func newPurgeVerifyCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify <receipt>",
+		Short: "Check that an erasure receipt was not changed",
+		Long: `Check the digest of a receipt written by 'face purge'. Signed receipts need
+the erasure_key they were signed with.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read receipt: %w", err)
+			}
+			var receipt erasure.Receipt
+			if err := json.Unmarshal(data, &receipt); err != nil {
+				return fmt.Errorf("invalid receipt: %w", err)
+			}
+			if err := receipt.Check([]byte(cfg.ErasureKey)); err != nil {
+				return err
+			}
+
+			kind := "unsigned"
+			if receipt.Signed {
+				kind = "signed"
+			}
+			fmt.Printf("✓ Receipt %s is intact (%s)\n", receipt.ID, kind)
+			fmt.Printf("  User %s erased %s: %d face(s), %d file(s)\n",
+				receipt.UserID, receipt.CompletedAt.Local().Format("2006-01-02 15:04:05"), len(receipt.Faces), len(receipt.Files))
+			return nil
+		},
+	}
+}
+
+func runPurge(cfg *config.Config, selection userSelection, confirm bool, receiptPath string) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	user, err := selectPurgeUser(db, selection)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nUser to purge:\n")
+	fmt.Printf("  ID:    %s\n", user.ID)
+	fmt.Printf("  Name:  %s\n", user.Name)
+	fmt.Printf("  Faces: %d\n", len(user.Faces))
+	if user.DeletedAt != nil {
+		fmt.Printf("  Deleted %s, still within the undo window\n", user.DeletedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	if !confirm {
+		if ok, err := confirmDeletion("this user for good"); !ok || err != nil {
+			return err
+		}
+	}
+
+	if receiptPath == "" {
+		receiptPath = "erasure-" + user.ID + ".json"
+	}
+	return purgeUser(cfg, db, stor, user, receiptPath)
+}
+
+// selectPurgeUser returns the user the selection applies to, including a
+// user deleted within the undo window when selected by ID
+func selectPurgeUser(db database.Database, selection userSelection) (*models.User, error) {
+	users, err := selectUsers(db, selection)
+	if err == nil {
+		return &users[0], nil
+	}
+	if selection.ID == "" || !errors.Is(err, models.ErrUserNotFound) {
+		return nil, err
+	}
+
+	deleted, listErr := db.ListDeletedUsers()
+	if listErr != nil {
+		return nil, fmt.Errorf("failed to list deleted users: %w", listErr)
+	}
+	var found *models.User
+	for i := range deleted {
+		if !strings.HasPrefix(deleted[i].ID, selection.ID) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("user ID prefix %q is ambiguous", selection.ID)
+		}
+		found = &deleted[i]
+	}
+	if found == nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// purgeUser erases a user, their images and the copies of them the
+// database and the undo file keep, and writes the receipt
+func purgeUser(cfg *config.Config, db database.Database, stor storage.Storage, user *models.User, receiptPath string) (err error) {
+	audit := startAudit(cfg, db, models.AuditPurge, user.ID)
+	defer func() { audit.finish(err) }()
+
+	receipt := &erasure.Receipt{
+		Version:    erasure.ReceiptVersion,
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		NameSHA256: erasure.HashString(user.Name),
+		Operator:   operatorLogin(),
+		Database:   string(cfg.DatabaseType),
+		StartedAt:  time.Now().UTC(),
+		Faces:      []erasure.Face{},
+		Files:      []erasure.File{},
+	}
+
+	faces := user.Faces
+	record, err := loadUndo(cfg)
+	if err != nil {
+		return err
+	}
+	if record == nil || record.UserID != user.ID {
+		record = nil
+	} else if record.RemovedFace != nil {
+		faces = append(faces[:len(faces):len(faces)], *record.RemovedFace)
+	}
+
+	if err := eraseImages(stor, user, faces, receipt); err != nil {
+		return err
+	}
+	probes, err := deleteProbes(cfg, db, database.ProbeFilter{UserID: user.ID})
+	receipt.Files = append(receipt.Files, probes...)
+	if err != nil {
+		return err
+	}
+	if err := db.DeleteUser(user.ID); err != nil {
+		return fmt.Errorf("failed to delete user from database: %w", err)
+	}
+	if err := shredCopies(cfg, db, record != nil, receipt); err != nil {
+		return err
+	}
+
+	forgetMQTTPerson(cfg, user.ID)
+	slog.Info("user purged", "user_id", user.ID, "receipt", receipt.ID)
+
+	receipt.CompletedAt = time.Now().UTC()
+	if err := writeReceipt(cfg, receipt, receiptPath); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ User '%s' purged: %d face(s), %d file(s) erased\n", user.Name, len(receipt.Faces), len(receipt.Files))
+	fmt.Printf("✓ Receipt written to %s\n", receiptPath)
+	if !receipt.Signed {
+		fmt.Println("⚠ The receipt is not signed; set erasure_key to sign receipts")
+	}
+	return nil
+}
+
+// eraseImages deletes the images of the faces and the avatar, adding them
+// to the receipt
+func eraseImages(stor storage.Storage, user *models.User, faces []models.Face, receipt *erasure.Receipt) error {
+	filenames := make([]string, 0, len(faces)+1)
+	for _, face := range faces {
+		receipt.Faces = append(receipt.Faces, erasure.Face{ID: face.ID, EmbeddingSHA256: erasure.HashEmbedding(face.Embedding)})
+		filenames = append(filenames, face.Filename)
+	}
+	if user.Avatar != "" {
+		filenames = append(filenames, user.Avatar)
+	}
+
+	for _, filename := range filenames {
+		file := erasure.File{Path: filename, Action: erasure.ActionDeleted}
+		if data, err := stor.LoadData(filename); err == nil {
+			file.SHA256 = erasure.HashBytes(data)
+		}
+		if err := stor.DeleteImage(filename); err != nil {
+			return fmt.Errorf("failed to delete image %s: %w", filename, err)
+		}
+		file.ErasedAt = time.Now().UTC()
+		receipt.Files = append(receipt.Files, file)
+	}
+	return nil
+}
+
+// shredCopies shreds the database's own copies of its data and, if it
+// refers to the user, the undo file, adding them to the receipt
+func shredCopies(cfg *config.Config, db database.Database, undoFile bool, receipt *erasure.Receipt) error {
+	if shredder, ok := db.(database.CopyShredder); ok {
+		shredded, err := shredder.ShredCopies()
+		receipt.Files = append(receipt.Files, shredded...)
+		if err != nil && !errors.Is(err, database.ErrShreddingUnsupported) {
+			return fmt.Errorf("failed to shred database copies: %w", err)
+		}
+	}
+	if !undoFile {
+		return nil
+	}
+
+	sum, existed, err := erasure.Shred(cfg.UndoFile)
+	if err != nil {
+		return fmt.Errorf("failed to shred undo file: %w", err)
+	}
+	if existed {
+		receipt.Files = append(receipt.Files, erasure.File{Path: cfg.UndoFile, SHA256: sum, Action: erasure.ActionShredded, ErasedAt: time.Now().UTC()})
+	}
+	return nil
+}
+
+// writeReceipt seals a receipt and writes it to path, printing it instead
+// if it cannot be written so the record of the erasure is not lost
+func writeReceipt(cfg *config.Config, receipt *erasure.Receipt, path string) error {
+	if err := receipt.Seal([]byte(cfg.ErasureKey)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		fmt.Printf("\n%s\n", data)
+		return fmt.Errorf("failed to write receipt: %w\n  The user was erased; keep the receipt printed above", err)
+	}
+	return nil
+}
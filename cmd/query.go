@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/privacy"
+
+	"github.com/spf13/cobra"
+)
+
+func NewQueryCmd(cfg *config.Config) *cobra.Command {
+	var (
+		name   string
+		params map[string]string
+		format string
+		list   bool
+		noise  privacy.Noise
+	)
+
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Run a predefined read-only report",
+		Long: `Run one of the predefined reports against the database. Reports are
+named, parameterized SELECT queries defined under "queries" in the config
+file, so no arbitrary SQL can be run and nothing can be written.
+
+In a query, {{.Table "users"}} expands to the configured table name and
+@name refers to a parameter passed with --param name=value:
+
+  "queries": {
+    "faces_per_department": {
+      "description": "Enrolled faces per department",
+      "sql": "SELECT json_extract(u.metadata, '$.department') AS department, COUNT(f.id) AS faces FROM {{.Table \"users\"}} u JOIN {{.Table \"faces\"}} f ON f.user_id = u.id GROUP BY department",
+      "counts": ["faces"]
+    }
+  }
+
+Reports shared outside the organization can have differential-privacy noise
+added to the columns listed under "counts", with --epsilon or an "epsilon"
+in the query: lower values are more private and noisier. "sensitivity" is
+the most one person can change a count (default 1). Every run spends the
+budget again, so averaging repeated runs of a report removes the noise;
+share one run.`,
+		Example: `  face query --list
+  face query --name faces_per_user
+  face query --name low_quality_faces --param max_quality=0.5 --format csv
+  face query --name faces_per_department --epsilon 0.5 --format csv`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if list {
+				printQueries(cfg.AllQueries())
+				return nil
+			}
+			if name == "" {
+				return fmt.Errorf("--name is required (see --list)")
+			}
+			return runQuery(cfg, name, params, format, noise)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "name of the query to run")
+	cmd.Flags().StringToStringVar(&params, "param", nil, "query parameter as name=value (repeatable)")
+	cmd.Flags().StringVar(&format, "format", "table", "output format: table, csv or json")
+	cmd.Flags().BoolVar(&list, "list", false, "list the available queries")
+	cmd.Flags().Float64Var(&noise.Epsilon, "epsilon", 0, "add differential-privacy noise to the counts with this privacy budget")
+	cmd.Flags().Int64Var(&noise.Sensitivity, "sensitivity", 0, "most one person can change a count, overriding the query's (default 1)")
+	cmd.MarkFlagsMutuallyExclusive("name", "list")
+
+	return cmd
+}
+
+func runQuery(cfg *config.Config, name string, params map[string]string, format string, noise privacy.Noise) error {
+	if format != "table" && format != "csv" && format != "json" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	q, ok := cfg.AllQueries()[name]
+	if !ok {
+		return fmt.Errorf("unknown query %q (see 'face query --list')", name)
+	}
+	noise, noisy, err := queryNoise(name, q, noise)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	querier, ok := db.(database.Querier)
+	if !ok {
+		return database.ErrQueriesUnsupported
+	}
+
+	result, err := querier.RunQuery(q, params)
+	if err != nil {
+		return err
+	}
+	if noisy {
+		noise.Rand = cfg.Rand("noise")
+		if err := addQueryNoise(result, q.Counts, noise); err != nil {
+			return err
+		}
+		if cfg.Seed != 0 {
+			fmt.Fprintf(os.Stderr, "Noise drawn with seed %d: anyone with the seed can remove it, do not share it with the report\n", cfg.Seed)
+		}
+	}
+
+	switch format {
+	case "csv":
+		return writeQueryCSV(result)
+	case "json":
+		return writeQueryJSON(result)
+	default:
+		writeQueryTable(result)
+		return nil
+	}
+}
+
+// queryNoise combines the noise settings of the query and the flags, and
+// reports whether noise is added at all
+func queryNoise(name string, q database.Query, flags privacy.Noise) (privacy.Noise, bool, error) {
+	noise := privacy.Noise{Epsilon: q.Epsilon, Sensitivity: q.Sensitivity}
+	if flags.Epsilon != 0 {
+		noise.Epsilon = flags.Epsilon
+	}
+	if flags.Sensitivity != 0 {
+		noise.Sensitivity = flags.Sensitivity
+	}
+	if noise.Epsilon == 0 {
+		return noise, false, nil
+	}
+
+	if err := noise.Validate(); err != nil {
+		return noise, false, err
+	}
+	if len(q.Counts) == 0 {
+		return noise, false, fmt.Errorf("query %q lists no count columns to add noise to", name)
+	}
+	return noise, true, nil
+}
+
+// addQueryNoise replaces the counts of a result with noisy counts
+func addQueryNoise(result *database.QueryResult, counts []string, noise privacy.Noise) error {
+	for _, count := range counts {
+		if !slices.Contains(result.Columns, count) {
+			return fmt.Errorf("count column %s is not in the result", count)
+		}
+	}
+
+	for col, column := range result.Columns {
+		if !slices.Contains(counts, column) {
+			continue
+		}
+		for _, row := range result.Rows {
+			count, err := strconv.ParseInt(row[col], 10, 64)
+			if err != nil {
+				return fmt.Errorf("column %s is not a count: %q", column, row[col])
+			}
+			row[col] = strconv.FormatInt(noise.Count(count), 10)
+		}
+	}
+	return nil
+}
+
+func printQueries(queries map[string]database.Query) {
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("\nAvailable queries: %d\n\n", len(names))
+	for _, name := range names {
+		q := queries[name]
+		fmt.Printf("  • %s", name)
+		if len(q.Params) > 0 {
+			fmt.Printf(" (params: %s)", strings.Join(q.Params, ", "))
+		}
+		if q.Epsilon > 0 {
+			fmt.Printf(" (noise: epsilon %g)", q.Epsilon)
+		}
+		fmt.Println()
+		if q.Description != "" {
+			fmt.Printf("      %s\n", q.Description)
+		}
+	}
+}
+
+func writeQueryTable(result *database.QueryResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(result.Columns, "\t")))
+	for _, row := range result.Rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	fmt.Printf("\n%d row(s)\n", len(result.Rows))
+}
+
+func writeQueryCSV(result *database.QueryResult) error {
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(result.Columns); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	if err := w.WriteAll(result.Rows); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// writeQueryJSON prints the rows as objects keyed by column name
+func writeQueryJSON(result *database.QueryResult) error {
+	rows := make([]map[string]string, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = make(map[string]string, len(row))
+		for j, column := range result.Columns {
+			rows[i][column] = row[j]
+		}
+	}
+
+	jsonData, err := json.MarshalIndent(rows, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format JSON: %w", err)
+	}
+	fmt.Println(string(jsonData))
+	return nil
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/imaging"
+	"face/internal/pipeline"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// Redaction styles
+const (
+	redactBlur     = "blur"
+	redactPixelate = "pixelate"
+)
+
+// redactMargin widens face boxes by this share of their size on each side,
+// to cover hair, ears and chin
+const redactMargin = 0.2
+
+func NewRedactCmd(cfg *config.Config) *cobra.Command {
+	var (
+		imagePath string
+		out       string
+		keep      []string
+		style     string
+		threshold float64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "redact",
+		Short: "Blur the faces in an image before sharing it",
+		Long: `Blur or pixelate every face detected in an image, so incident photos can be
+shared without exposing bystanders. With --keep-user-id, faces that verify as
+one of the given enrolled users are left visible.
+
+The output format follows the extension of --out: PNG for .png, JPEG
+otherwise. Only the pixels are written; metadata of the original image, such
+as its EXIF location, is not copied.
+
+Detection can miss faces that are small, turned away or partly hidden, so
+check the result before sharing it.`,
+		Example: `  face redact --image group.jpg --out redacted.jpg
+  face redact --image incident.jpg --out shared.png --keep-user-id abc123 --style pixelate`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if style != redactBlur && style != redactPixelate {
+				return fmt.Errorf("unknown style %q (use %s or %s)", style, redactBlur, redactPixelate)
+			}
+			return runRedact(cfg, imagePath, out, keep, style, threshold)
+		},
+	}
+
+	cmd.Flags().StringVarP(&imagePath, "image", "i", "", "path to image file (required)")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "file to write the redacted image to (required)")
+	cmd.Flags().StringSliceVar(&keep, "keep-user-id", nil, "leave the faces of these users visible (ID or unique prefix, repeatable)")
+	cmd.Flags().StringVar(&style, "style", redactBlur, "how to hide faces: blur or pixelate")
+	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold for --keep-user-id (0.0-1.0)")
+	_ = cmd.MarkFlagRequired("image")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func runRedact(cfg *config.Config, imagePath, out string, keepIDs []string, style string, threshold float64) error {
+	if sameFile(imagePath, out) {
+		return errors.New("--out must not overwrite the original image")
+	}
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	keep := make([]*models.User, len(keepIDs))
+	for i, id := range keepIDs {
+		if keep[i], err = database.GetUserByIDPrefix(fs.DB, id); err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+	}
+
+	img, err := storage.LoadInputImage(imagePath, fs.ImageLimits)
+	if err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+
+	fmt.Printf("Detecting faces in %s...\n", imagePath)
+	detections, err := fs.DetectFaces(img)
+	if err != nil {
+		return fmt.Errorf("face detection failed: %w", err)
+	}
+	if len(detections) == 0 {
+		return errors.New("no faces detected, nothing to redact")
+	}
+	fmt.Printf("✓ Found %d face(s)\n\n", len(detections))
+
+	redacted := image.NewRGBA(img.Bounds())
+	draw.Draw(redacted, redacted.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	hidden := 0
+	for i, detection := range detections {
+		box := detection.Box
+		fmt.Printf("  [%d] %dx%d at (%d,%d): ", i+1, box.Dx(), box.Dy(), box.Min.X, box.Min.Y)
+
+		user, confidence, err := keptUser(fs, img, detection, keep, threshold)
+		if err != nil {
+			return err
+		}
+		if user != nil {
+			fmt.Printf("kept, %s (%.2f%%)\n", user.Name, confidence*100)
+			continue
+		}
+
+		hideFace(redacted, box, style)
+		hidden++
+		fmt.Println("hidden")
+	}
+
+	if err := writeImageFile(out, redacted); err != nil {
+		return err
+	}
+	fmt.Printf("\n✓ %d of %d face(s) hidden, written to %s\n", hidden, len(detections), out)
+	return nil
+}
+
+// keptUser returns the user among keep that the detected face verifies as,
+// nil if none
+func keptUser(fs *FaceSystem, img image.Image, detection *pipeline.Detection, keep []*models.User, threshold float64) (*models.User, float64, error) {
+	if len(keep) == 0 {
+		return nil, 0, nil
+	}
+
+	result, err := fs.embedDetection(img, detection)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matcher := newVerifier(fs.Decay, fs.Strategy)
+	var best *models.User
+	bestConfidence := 0.0
+	for _, user := range keep {
+		matched, confidence, err := matcher.Verify(user, result.Embedding, threshold)
+		if err != nil {
+			return nil, 0, fmt.Errorf("verification failed: %w", err)
+		}
+		if matched && confidence > bestConfidence {
+			best, bestConfidence = user, confidence
+		}
+	}
+	return best, bestConfidence, nil
+}
+
+// hideFace blurs or pixelates a face box, widened by redactMargin
+func hideFace(img *image.RGBA, box image.Rectangle, style string) {
+	margin := int(float64(max(box.Dx(), box.Dy())) * redactMargin)
+	area := box.Inset(-margin)
+	side := max(area.Dx(), area.Dy())
+
+	if style == redactPixelate {
+		imaging.Pixelate(img, area, max(side/8, 4))
+		return
+	}
+	imaging.Blur(img, area, max(side/6, 3))
+}
+
+// sameFile reports whether two paths name the same existing file
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
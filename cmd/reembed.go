@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/hooks"
+	"face/internal/imaging"
+	"face/internal/pipeline"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func NewReembedCmd(cfg *config.Config) *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:         "reembed [model]",
+		Short:       "Recompute every stored embedding with another embedding model",
+		Annotations: recordWith("!dry-run"),
+		Long: `Recompute the embedding of every enrolled face from its stored image and
+record the model the gallery was computed with, so the gallery can switch
+embedding models without enrolling everyone again.
+
+Without an argument the embeddings are computed with the model commands
+would use: embedding_model (or --model) if set, otherwise the gallery's.
+With one, they are computed with the named model, 'builtin' or one listed
+by 'face model list', which must be installed.
+
+Every embedding is computed before any is stored, and they are stored
+together with the model in one transaction: if an image cannot be read,
+nothing changes. Restart running servers afterwards, as they keep the
+embeddings they loaded.`,
+		Example: `  face reembed arcface
+  face reembed --model arcface --dry-run
+  face reembed builtin`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var name string
+			if len(args) > 0 {
+				name = args[0]
+			}
+			return runReembed(cfg, name, dryRun)
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "compute the embeddings and report, without storing them")
+
+	return cmd
+}
+
+// reembedFailure is a face whose embedding could not be recomputed
+type reembedFailure struct {
+	user *models.User
+	face *models.Face
+	err  error
+}
+
+func runReembed(cfg *config.Config, name string, dryRun bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	selected, err := reembedModel(cfg, settings, name)
+	if err != nil {
+		return err
+	}
+	model, dimension, err := selected.Embedding()
+	if err != nil {
+		return err
+	}
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	detector, extractor, err := newPipeline(selected)
+	if err != nil {
+		return err
+	}
+	detector.Close()
+	defer extractor.Close()
+
+	users, err := reembedUsers(db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Recomputing the embeddings of %d user(s) with %s (%d-d), replacing %s\n",
+		len(users), model, dimension, cmp.Or(settings.EmbeddingModel, "an unrecorded model"))
+	embeddings, failures := reembedFaces(users, stor, extractor, settings.CropSize, dimension)
+	if len(failures) > 0 {
+		for _, f := range failures {
+			fmt.Printf("  ✗ %s (%s): face %s: %v\n", f.user.Name, f.user.ID, f.face.ID, f.err)
+		}
+		return fmt.Errorf("%d of %d face(s) could not be re-embedded and nothing was changed: "+
+			"remove them with 'face update --id <id> --remove-face <face-id>' and run again",
+			len(failures), len(failures)+len(embeddings))
+	}
+
+	if dryRun {
+		fmt.Printf("• Dry run: %d face(s) can be re-embedded with %s, nothing was changed\n", len(embeddings), model)
+		return nil
+	}
+
+	if err := db.ReplaceEmbeddings(embeddings, model, dimension); err != nil {
+		if errors.Is(err, database.ErrGalleryChanged) {
+			return fmt.Errorf("%w: nothing was changed, run 'face reembed' again", err)
+		}
+		return fmt.Errorf("failed to store the embeddings: %w", err)
+	}
+	slog.Info("gallery re-embedded", "model", model, "dimension", dimension, "faces", len(embeddings))
+
+	fmt.Printf("✓ Re-embedded %d face(s) with %s: the gallery now uses it\n", len(embeddings), model)
+	if name != "" {
+		warnModelOverride(cfg, name)
+	}
+	fmt.Println("  Restart running servers so they load the new embeddings.")
+	return nil
+}
+
+// reembedModel returns the config selecting the model to recompute the
+// embeddings with: the named one, or the one commands would use
+func reembedModel(cfg *config.Config, settings *models.Settings, name string) (*config.Config, error) {
+	selected := cfg.WithGalleryModel(settings.EmbeddingModel)
+	if name != "" {
+		var err error
+		if selected, err = selectEmbeddingModel(cfg, name); err != nil {
+			return nil, err
+		}
+	}
+
+	model, dimension, err := selected.Embedding()
+	if err != nil {
+		if name == "" && selected != cfg {
+			return nil, fmt.Errorf("the gallery's model cannot be loaded: %w: name the model to recompute the embeddings with, e.g. 'face reembed builtin'", err)
+		}
+		return nil, err
+	}
+	if err := checkVectorDimension(cfg, model, dimension); err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// reembedUsers returns every user with faces to recompute, including users
+// pending deletion, as they keep their faces until it is finalized and are
+// restored with them
+func reembedUsers(db database.Database) ([]models.User, error) {
+	users, err := db.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	deleted, err := db.ListDeletedUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deleted users: %w", err)
+	}
+	return append(users, deleted...), nil
+}
+
+// reembedFaces recomputes the embeddings of the users' faces, by face ID,
+// and returns the faces that failed
+func reembedFaces(users []models.User, stor storage.Storage, extractor pipeline.Extractor, cropSize, dimension int) (map[string]models.Embedding, []reembedFailure) {
+	embeddings := make(map[string]models.Embedding)
+	var failures []reembedFailure
+	for i := range users {
+		for k := range users[i].Faces {
+			f := &users[i].Faces[k]
+			embedding, err := reembedFace(stor, extractor, cropSize, f)
+			if err == nil && len(embedding) != dimension {
+				err = fmt.Errorf("%w: the extractor returned a %d-d embedding", models.ErrDimensionMismatch, len(embedding))
+			}
+			if err != nil {
+				failures = append(failures, reembedFailure{user: &users[i], face: f, err: err})
+				continue
+			}
+			embeddings[f.ID] = embedding
+		}
+	}
+	return embeddings, failures
+}
+
+// reembedFace computes the embedding of a face from its stored image, the
+// way enrollment computed it from the crop
+func reembedFace(stor storage.Storage, extractor pipeline.Extractor, cropSize int, f *models.Face) (models.Embedding, error) {
+	crop, err := stor.LoadImage(f.Filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image %s: %w", f.Filename, err)
+	}
+	if cropSize > 0 {
+		crop = imaging.NormalizeCrop(crop, cropSize)
+	}
+
+	crop, err = hooks.BeforeExtract(crop)
+	if err != nil {
+		return nil, err
+	}
+	embedding, err := extractor.Extract(crop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract embedding: %w", err)
+	}
+	return hooks.AfterExtract(crop, embedding)
+}
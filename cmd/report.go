@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/redaction"
+	"face/internal/report"
+
+	"github.com/spf13/cobra"
+)
+
+// reportSamples is the most sample probes a report shows
+const reportSamples = 12
+
+func NewReportCmd(cfg *config.Config) *cobra.Command {
+	var auditRange, out string
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Write a report of the identifications of a range of days",
+		Long: `Write a report of the identifications and verifications in the audit log
+over a range of days, for management and compliance reviews: the matches,
+unknown faces, rejected verifications and failures of each day, the unknown
+rate, the users matched most often and thumbnails of a sample of the probes
+saved with --save-probe.
+
+The report is a PDF document or a self-contained HTML page, by the extension
+of --out. Users are named per the redaction level; at id-only, users appear
+by their pseudonymous ID and no thumbnails are included. The report is
+recorded in the audit log as an export.`,
+		Example: `  face report --audit-range 2026-06-01..2026-06-30 --out report.pdf
+  face report --audit-range 2026-06-01..2026-06-07 --out week.html`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReport(cfg, auditRange, out)
+		},
+	}
+
+	cmd.Flags().StringVar(&auditRange, "audit-range", "", "first and last day of the report, e.g. 2026-06-01..2026-06-30 (required)")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "report to write, *.pdf or *.html (required)")
+	_ = cmd.MarkFlagRequired("audit-range")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func runReport(cfg *config.Config, auditRange, out string) (err error) {
+	from, to, err := parseAuditRange(auditRange)
+	if err != nil {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(out))
+	if ext != ".pdf" && ext != ".html" && ext != ".htm" {
+		return fmt.Errorf("unknown report format %q (name the report *.pdf or *.html)", ext)
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	db, log, err := openAuditLog(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	audit := startAudit(cfg, db, models.AuditExport, "")
+	defer func() { audit.finish(err) }()
+
+	events, err := log.AuditEvents(database.AuditFilter{Since: from, Until: to.AddDate(0, 0, 1)})
+	if err != nil {
+		return err
+	}
+	label := reportLabel(db, redactor)
+	r := report.New(from, to, events, label)
+	if redactor.Level != redaction.LevelIDOnly {
+		r.Samples = loadReportSamples(cfg, db, events, label)
+	}
+
+	if err := writeReport(r, out, ext); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Report of %s to %s written to %s\n", from.Format("2006-01-02"), to.Format("2006-01-02"), out)
+	fmt.Printf("  %d identification(s), %d verification(s), %.1f%% unknown\n", r.Identifications, r.Verifications, r.UnknownRate()*100)
+	return nil
+}
+
+// parseAuditRange parses a range of days like 2026-06-01..2026-06-30,
+// returning its first and last day
+func parseAuditRange(value string) (from, to time.Time, err error) {
+	first, last, ok := strings.Cut(value, "..")
+	if ok {
+		from, err = time.ParseInLocation("2006-01-02", first, time.Local)
+	}
+	if ok && err == nil {
+		to, err = time.ParseInLocation("2006-01-02", last, time.Local)
+	}
+	if !ok || err != nil {
+		return from, to, fmt.Errorf("invalid --audit-range %q (use 2006-01-02..2006-01-02)", value)
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("invalid --audit-range %q: it ends before it starts", value)
+	}
+	return from, to, nil
+}
+
+// reportLabel returns how a report names the user of an ID: by their label
+// if they still exist, by their ID otherwise, as the redaction level allows
+func reportLabel(db database.Database, redactor *redaction.Redactor) func(string) string {
+	return func(userID string) string {
+		if redactor.Level != redaction.LevelIDOnly {
+			if u, err := db.GetUser(userID); err == nil {
+				return redactor.Label(u)
+			}
+		}
+		return redactor.UserID(userID)
+	}
+}
+
+// loadReportSamples loads up to reportSamples probes of the events, spread
+// over the range, warning about those that cannot be loaded
+func loadReportSamples(cfg *config.Config, db database.Database, events []models.AuditEvent, label func(string) string) []report.Sample {
+	store, ok := db.(database.ProbeStore)
+	if !ok {
+		return nil
+	}
+	var probed []string
+	for _, e := range events {
+		if e.ProbeID != "" && (e.Operation == models.AuditIdentify || e.Operation == models.AuditVerify) {
+			probed = append(probed, e.ProbeID)
+		}
+	}
+	if len(probed) == 0 {
+		return nil
+	}
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: sample probes not included: failed to initialize storage: %v\n", err)
+		return nil
+	}
+
+	var samples []report.Sample
+	n := min(len(probed), reportSamples)
+	for i := range n {
+		id := probed[i*len(probed)/n]
+		probe, err := store.GetProbe(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: sample probe %s not included: %v\n", id, err)
+			continue
+		}
+		data, err := stor.LoadData(probe.Filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: sample probe %s not included: %v\n", id, err)
+			continue
+		}
+		sample := report.Sample{
+			CapturedAt: probe.CapturedAt,
+			Operation:  probe.Operation,
+			Matched:    probe.Matched,
+			Confidence: probe.Confidence,
+			JPEG:       data,
+		}
+		if probe.UserID != "" {
+			sample.Label = label(probe.UserID)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// writeReport writes a report to out in the format of its extension
+func writeReport(r *report.Report, out, ext string) error {
+	file, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if ext == ".pdf" {
+		err = r.WritePDF(file)
+	} else {
+		err = r.WriteHTML(file)
+	}
+	if err == nil {
+		if err = file.Close(); err != nil {
+			err = fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(out)
+		return err
+	}
+	return nil
+}
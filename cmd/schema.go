@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+)
+
+// openDatabase opens the configured database once its schema is the one
+// this binary was built for, applying pending migrations first with
+// --auto-migrate. Commands that diagnose the database, such as doctor, use
+// cfg.GetDatabaseConnection directly.
+func openDatabase(cfg *config.Config) (database.Database, error) {
+	if err := checkSchema(cfg); err != nil {
+		return nil, err
+	}
+	return cfg.GetDatabaseConnection()
+}
+
+// checkSchema refuses a database at another schema version than the
+// binary's, so an upgrade of either shows up before a command starts
+// rather than as SQL errors part way through it
+func checkSchema(cfg *config.Config) error {
+	if !cfg.DatabaseType.UsesMigrations() {
+		return nil
+	}
+
+	migrator, err := cfg.GetMigrator()
+	if err != nil {
+		return fmt.Errorf("failed to create migrator: %w", err)
+	}
+	defer migrator.Close()
+
+	err = migrator.CheckSchema()
+	var schemaErr *database.SchemaError
+	if !errors.As(err, &schemaErr) || !cfg.AutoMigrate || !schemaErr.Upgradable() {
+		return err
+	}
+
+	backup, err := upgradeSchema(cfg, migrator, schemaErr)
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		fmt.Fprintf(os.Stderr, "✓ Backed up the database to %s\n", backup)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Migrated the database schema from version %d to %d\n", schemaErr.Version, schemaErr.Required)
+	return nil
+}
+
+// upgradeSchema applies the pending migrations, copying a SQLite database
+// aside first. It returns the path of the copy, if any.
+func upgradeSchema(cfg *config.Config, migrator *database.Migrator, schemaErr *database.SchemaError) (string, error) {
+	var backup string
+	if cfg.DatabaseType == database.DatabaseTypeSQLite && schemaErr.Version > 0 {
+		backup = fmt.Sprintf("%s.v%d.bak", cfg.DatabasePath, schemaErr.Version)
+		if err := copyFile(cfg.DatabasePath, backup); err != nil {
+			return "", fmt.Errorf("failed to back up the database before migrating: %w", err)
+		}
+	}
+	return backup, migrator.Up()
+}
+
+// checkEmbeddingModel refuses a gallery enrolled with another embedding
+// model than the configured pipeline computes, as its embeddings would match
+// no one or the wrong people. A gallery without a recorded model, enrolled
+// before models were recorded, is taken to be of the configured one.
+func checkEmbeddingModel(cfg *config.Config, db database.Database, settings *models.Settings) error {
+	model, dimension, err := cfg.Embedding()
+	if err != nil {
+		return err
+	}
+	if err := checkVectorDimension(cfg, model, dimension); err != nil {
+		return err
+	}
+
+	switch settings.EmbeddingModel {
+	case model:
+		return nil
+	case "":
+		settings.EmbeddingModel, settings.EmbeddingDimension = model, dimension
+		if err := db.UpdateSettings(settings); err != nil {
+			return fmt.Errorf("failed to record the embedding model: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("the gallery was enrolled with embedding model %s, but the pipeline computes %s: "+
+		"switch pipeline_backend or embedding_model back, or recompute the embeddings with 'face reembed'", settings.EmbeddingModel, model)
+}
+
+// checkVectorDimension refuses an embedding model whose embeddings the
+// pgvector column cannot store
+func checkVectorDimension(cfg *config.Config, model string, dimension int) error {
+	if cfg.PGVector && cfg.DatabaseType == database.DatabaseTypePostgres && dimension != database.VectorDimension {
+		return fmt.Errorf("pgvector stores %d-d embeddings, but embedding model %s computes %d-d ones: disable pgvector to use it",
+			database.VectorDimension, model, dimension)
+	}
+	return nil
+}
+
+// copyFile copies src to dst, replacing dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
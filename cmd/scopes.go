@@ -0,0 +1,341 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+
+	"github.com/spf13/cobra"
+)
+
+// scopeCandidates is how many users more than wanted are searched for when
+// identifying in a scope, as the closest users may be of other sites; the
+// search widens until enough users of the scope are found
+const scopeCandidates = 10
+
+func NewScopeCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scope",
+		Short: "Manage the orgs, sites and devices users are identified at",
+		Long: `For deployments with several sites under one database, orgs have sites and
+sites have devices, each a scope named by its path: "acme", "acme/berlin",
+"acme/berlin/lobby-door". Users are assigned to scopes, and a device only
+identifies the users of its scope: those assigned to it, to its site or to
+its org. Users assigned to no scope are identified everywhere, as before
+scopes existed.
+
+A device gives its scope with --device or "device" in the config file
+(FACE_CLI_DEVICE); 'face serve' uses the "device" of the client's API key in
+serve_api_keys, or its own. 'face identify --all-scopes' searches everyone.
+Verification against a named user is not restricted.
+
+Scopes need the sqlite or postgres database.`,
+		Example: `  face scope add acme --name "Acme Corp"
+  face scope add acme/berlin --name "Berlin office"
+  face scope add acme/berlin/lobby-door
+  face scope assign acme/berlin --user-id abc123
+  face identify --device acme/berlin/lobby-door --image visitor.jpg`,
+	}
+
+	cmd.AddCommand(newScopeAddCmd(cfg))
+	cmd.AddCommand(newScopeListCmd(cfg))
+	cmd.AddCommand(newScopeRemoveCmd(cfg))
+	cmd.AddCommand(newScopeAssignCmd(cfg))
+	cmd.AddCommand(newScopeUnassignCmd(cfg))
+
+	return cmd
+}
+
+func newScopeAddCmd(cfg *config.Config) *cobra.Command {
+	var name string
+
+	cmd := &cobra.Command{
+		Use:         "add <org>[/<site>[/<device>]]",
+		Short:       "Add an org, a site or a device",
+		Long:        `Add an org, a site of an existing org or a device of an existing site.`,
+		Annotations: recordAlways(),
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withScopeStore(cfg, func(db database.Database, store database.ScopeStore) error {
+				scope := &models.Scope{Path: args[0], Name: name}
+				if err := store.CreateScope(scope); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Added %s %s\n", scope.Kind(), scope.Path)
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "what the scope is called, e.g. \"Berlin office\"")
+
+	return cmd
+}
+
+// scopeEntry is a scope in the output of 'face scope list --json'
+type scopeEntry struct {
+	models.Scope
+	Kind string `json:"kind"`
+	// Users is how many users are assigned to the scope itself
+	Users int `json:"users"`
+}
+
+func newScopeListCmd(cfg *config.Config) *cobra.Command {
+	var formatJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the orgs, sites and devices with their users",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withScopeStore(cfg, func(db database.Database, store database.ScopeStore) error {
+				return runScopeList(db, store, formatJSON)
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func runScopeList(db database.Database, store database.ScopeStore, formatJSON bool) error {
+	scopes, err := store.ListScopes()
+	if err != nil {
+		return err
+	}
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	assigned := make(map[string]int)
+	everywhere := 0
+	for _, u := range users {
+		if len(u.Scopes) == 0 {
+			everywhere++
+		}
+		for _, s := range u.Scopes {
+			assigned[s]++
+		}
+	}
+	entries := make([]scopeEntry, len(scopes))
+	for i := range scopes {
+		entries[i] = scopeEntry{Scope: scopes[i], Kind: scopes[i].Kind(), Users: assigned[scopes[i].Path]}
+	}
+
+	if formatJSON {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No orgs, sites or devices yet; everyone is identified everywhere.")
+		return nil
+	}
+	fmt.Printf("%-40s  %-6s  %5s  %s\n", "SCOPE", "KIND", "USERS", "NAME")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, e := range entries {
+		indent := strings.Repeat("  ", strings.Count(e.Path, "/"))
+		fmt.Printf("%-40s  %-6s  %5d  %s\n", indent+e.Path, e.Kind, e.Users, e.Name)
+	}
+	fmt.Printf("\n%d user(s) with no scope, identified everywhere\n", everywhere)
+	return nil
+}
+
+func newScopeRemoveCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <scope>",
+		Short: "Remove an org, a site or a device",
+		Long: `Remove an org, a site or a device. Its sites and devices must be removed
+and its users unassigned first.`,
+		Annotations: recordAlways(),
+		Args:        cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withScopeStore(cfg, func(db database.Database, store database.ScopeStore) error {
+				if err := store.DeleteScope(args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("✓ Removed %s\n", args[0])
+				return nil
+			})
+		},
+	}
+}
+
+func newScopeAssignCmd(cfg *config.Config) *cobra.Command {
+	var selection userSelection
+
+	cmd := &cobra.Command{
+		Use:   "assign <scope>...",
+		Short: "Assign a user to orgs, sites or devices",
+		Long: `Assign a user to orgs, sites or devices, in addition to the ones they are
+assigned to. They are then identified only by the devices of their scopes.`,
+		Example: `  face scope assign acme/berlin --user-id abc123
+  face scope assign acme/berlin/lobby-door acme/paris --user-name "John Doe"`,
+		Annotations: recordAlways(),
+		Args:        cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setUserScopes(cfg, selection, func(scopes []string) []string {
+				return append(scopes, args...)
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&selection.ID, "user-id", "u", "", "user ID or unique prefix")
+	selection.addNameFlags(cmd, "user-id", true)
+
+	return cmd
+}
+
+func newScopeUnassignCmd(cfg *config.Config) *cobra.Command {
+	var selection userSelection
+
+	cmd := &cobra.Command{
+		Use:   "unassign [scope]...",
+		Short: "Unassign a user from orgs, sites or devices",
+		Long: `Unassign a user from the given orgs, sites or devices, or from all of them
+when none is given. A user with no scope left is identified everywhere.`,
+		Example: `  face scope unassign acme/paris --user-id abc123
+  face scope unassign --user-id abc123`,
+		Annotations: recordAlways(),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return setUserScopes(cfg, selection, func(scopes []string) []string {
+				if len(args) == 0 {
+					return nil
+				}
+				return slices.DeleteFunc(scopes, func(s string) bool { return slices.Contains(args, s) })
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&selection.ID, "user-id", "u", "", "user ID or unique prefix")
+	selection.addNameFlags(cmd, "user-id", true)
+
+	return cmd
+}
+
+// withScopeStore opens the database and runs fn with its scope store
+func withScopeStore(cfg *config.Config, fn func(db database.Database, store database.ScopeStore) error) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	store, ok := db.(database.ScopeStore)
+	if !ok {
+		return database.ErrScopeStoreUnsupported
+	}
+	return fn(db, store)
+}
+
+// setUserScopes selects users and replaces their scopes with what change
+// returns for their current ones
+func setUserScopes(cfg *config.Config, selection userSelection, change func(scopes []string) []string) error {
+	return withScopeStore(cfg, func(db database.Database, store database.ScopeStore) error {
+		users, err := selectUsers(db, selection)
+		if err != nil {
+			return err
+		}
+		for i := range users {
+			scopes := change(slices.Clone(users[i].Scopes))
+			if err := store.SetUserScopes(users[i].ID, scopes); err != nil {
+				return err
+			}
+			fmt.Printf("✓ %s: %s\n", users[i].Name, describeScopes(scopes))
+		}
+		return nil
+	})
+}
+
+// describeScopes describes where a user with the scopes is identified
+func describeScopes(scopes []string) string {
+	if len(scopes) == 0 {
+		return "identified everywhere"
+	}
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+	return "identified at " + strings.Join(scopes, ", ")
+}
+
+// checkScopes returns models.ErrScopeNotFound unless every scope exists,
+// or database.ErrScopeStoreUnsupported if db keeps no scopes
+func checkScopes(db database.Database, scopes []string) error {
+	if len(scopes) == 0 {
+		return nil
+	}
+	store, ok := db.(database.ScopeStore)
+	if !ok {
+		return database.ErrScopeStoreUnsupported
+	}
+	existing, err := store.ListScopes()
+	if err != nil {
+		return err
+	}
+	for _, path := range scopes {
+		if !slices.ContainsFunc(existing, func(s models.Scope) bool { return s.Path == path }) {
+			return fmt.Errorf("%w: %s", models.ErrScopeNotFound, path)
+		}
+	}
+	return nil
+}
+
+// scopedIdentifier leaves out the matches of an identifier that are not
+// identified in a scope, see models.User.InScope
+type scopedIdentifier struct {
+	identifier
+	db    database.Database
+	scope string
+}
+
+// withScope returns id matching only the users of scope, or id itself if
+// the scope is empty
+func withScope(id identifier, db database.Database, scope string) identifier {
+	if scope == "" {
+		return id
+	}
+	return &scopedIdentifier{identifier: id, db: db, scope: scope}
+}
+
+// FindBestMatches returns up to n users of the scope with a face most
+// similar to the embedding, most similar first
+func (s *scopedIdentifier) FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error) {
+	for want := n + scopeCandidates; ; want *= 2 {
+		matches, err := s.identifier.FindBestMatches(embedding, want)
+		if err != nil {
+			return nil, err
+		}
+
+		var kept []models.MatchResult
+		for i := range matches {
+			if err := loadMatchedUser(s.db, &matches[i]); err != nil {
+				return nil, err
+			}
+			if matches[i].User.InScope(s.scope) {
+				kept = append(kept, matches[i])
+			}
+		}
+		// fewer matches than wanted means every user was searched
+		if len(kept) >= n || len(matches) < want {
+			return kept[:min(n, len(kept))], nil
+		}
+	}
+}
+
+// Match returns the user of the scope with the face most similar to the
+// embedding, or models.ErrNoMatch if none is at least threshold similar
+func (s *scopedIdentifier) Match(embedding []float32, threshold float64) (*models.MatchResult, error) {
+	matches, err := s.FindBestMatches(embedding, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bestMatch(matches, threshold)
+}
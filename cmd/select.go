@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"face/internal/database"
+	"face/internal/database/models"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// userSelection says which users a command applies to: the user with ID,
+// or the users named Name. When several users share the name, the operator
+// picks one interactively unless SelectFirst or All decides.
+type userSelection struct {
+	ID          string
+	Name        string
+	SelectFirst bool
+	All         bool
+
+	// idFlag and allowAll describe the command's flags for error messages
+	idFlag   string
+	allowAll bool
+}
+
+// addNameFlags registers --user-name and the policy flags for users
+// sharing a name. idFlag is the command's user ID flag; exactly one of the
+// two must be given. Commands that cannot apply to several users pass
+// allowAll false.
+func (s *userSelection) addNameFlags(cmd *cobra.Command, idFlag string, allowAll bool) {
+	s.idFlag, s.allowAll = idFlag, allowAll
+	cmd.Flags().StringVar(&s.Name, "user-name", "", "select the user by name instead of ID")
+	cmd.Flags().BoolVar(&s.SelectFirst, "select-first", false, "if several users have the name, use the one enrolled first")
+	if allowAll {
+		cmd.Flags().BoolVar(&s.All, "all", false, "if several users have the name, use all of them")
+		cmd.MarkFlagsMutuallyExclusive("select-first", "all")
+	}
+	cmd.MarkFlagsMutuallyExclusive(idFlag, "user-name")
+	cmd.MarkFlagsOneRequired(idFlag, "user-name")
+}
+
+// selectUsers returns the users the selection applies to
+func selectUsers(db database.Database, s userSelection) ([]models.User, error) {
+	if s.Name == "" {
+		user, err := database.GetUserByIDPrefix(db, s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+		return []models.User{*user}, nil
+	}
+
+	users, err := db.ListUsersByName(s.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(users) == 0:
+		return nil, fmt.Errorf("no user named %q", s.Name)
+	case len(users) == 1 || s.All:
+		return users, nil
+	case s.SelectFirst:
+		return users[:1], nil
+	}
+	return askUser(users, s)
+}
+
+// askUser lists the users sharing a name and lets the operator pick one
+func askUser(users []models.User, s userSelection) ([]models.User, error) {
+	fmt.Printf("\n%d users are named %q:\n", len(users), s.Name)
+	for i := range users {
+		u := &users[i]
+		email := u.Email
+		if email == "" {
+			email = "-"
+		}
+		fmt.Printf("  %d) %s  %-25s  %d face(s)  enrolled %s\n",
+			i+1, u.ID, email, len(u.Faces), u.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	if !stdinIsTerminal() {
+		policy := "--select-first"
+		if s.allowAll {
+			policy += " or --all"
+		}
+		return nil, fmt.Errorf("%d users are named %q; select one with --%s, or use %s", len(users), s.Name, s.idFlag, policy)
+	}
+
+	p := newPrompter()
+	for {
+		answer, err := p.ask(fmt.Sprintf("Select a user (1-%d)", len(users)), "")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			return nil, fmt.Errorf("no user selected")
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(answer, ")")); err == nil && n >= 1 && n <= len(users) {
+			return users[n-1 : n], nil
+		}
+		fmt.Printf("  ✗ Please enter a number from 1 to %d\n", len(users))
+	}
+}
+
+// stdinIsTerminal reports whether stdin is interactive, so questions can
+// be asked instead of failing
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/modelfiles"
+	"face/internal/pipeline"
+	"face/internal/pipeline/modelspec"
+	"face/internal/samples"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+// selftestStatus is the outcome of a single selftest check
+type selftestStatus string
+
+const (
+	selftestPass selftestStatus = "PASS"
+	selftestWarn selftestStatus = "WARN"
+	selftestFail selftestStatus = "FAIL"
+	selftestSkip selftestStatus = "SKIP"
+)
+
+// selftestResult reports the outcome of one component check
+type selftestResult struct {
+	Component string         `json:"component"`
+	Status    selftestStatus `json:"status"`
+	Detail    string         `json:"detail"`
+}
+
+func NewSelftestCmd(cfg *config.Config) *cobra.Command {
+	var (
+		imagePath  string
+		formatJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "selftest",
+		Short: "Validate the installation end to end",
+		Long: `Run the face pipeline on a bundled synthetic sample, round-trip a temporary
+database and storage directory, and verify model checksums. Reports pass/fail
+per component and exits non-zero if any component fails.
+
+Synthetic samples exercise extraction but may not be detected as faces;
+pass --image with a real photo to require a successful detection.`,
+		Example: `  face selftest
+  face selftest --image photo.jpg
+  face selftest --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSelftest(cfg, imagePath, formatJSON)
+		},
+	}
+
+	cmd.Flags().StringVarP(&imagePath, "image", "i", "", "real face photo that must be detected")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func runSelftest(cfg *config.Config, imagePath string, formatJSON bool) error {
+	results := []selftestResult{selftestConfig(cfg), selftestModels(cfg)}
+	results = append(results, selftestPipeline(cfg, imagePath)...)
+	results = append(results, selftestStorage(), selftestDatabase(database.DatabaseTypeJSON), selftestDatabase(database.DatabaseTypeBolt), selftestDatabase(database.DatabaseTypeSQLite))
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == selftestFail {
+			failed++
+		}
+	}
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		fmt.Println("Self-test results:")
+		fmt.Println("─────────────────────────────────────")
+		for _, r := range results {
+			fmt.Printf("  [%s] %-12s %s\n", r.Status, r.Component, r.Detail)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("selftest failed: %d component(s) failed", failed)
+	}
+
+	if !formatJSON {
+		fmt.Println("\n✓ All components passed")
+	}
+	return nil
+}
+
+func selftestConfig(cfg *config.Config) selftestResult {
+	if err := cfg.Validate(); err != nil {
+		return selftestResult{"config", selftestFail, err.Error()}
+	}
+	return selftestResult{"config", selftestPass, fmt.Sprintf("%s backend, threshold %.2f", cfg.DatabaseType, cfg.DefaultThreshold)}
+}
+
+func selftestModels(cfg *config.Config) selftestResult {
+	if backend, err := modelspec.ParseBackend(cfg.PipelineBackend); err == nil && backend == modelspec.BackendMock {
+		return selftestResult{"models", selftestSkip, "not used by the mock pipeline backend"}
+	}
+
+	statuses, err := modelfiles.Check(cfg.ModelsDir)
+	if err != nil {
+		return selftestResult{"models", selftestFail, err.Error()}
+	}
+
+	var problems []string
+	for i := range statuses {
+		s := &statuses[i]
+		switch {
+		case !s.Present:
+			problems = append(problems, s.File.Name+" missing")
+		case !s.Valid():
+			problems = append(problems, s.File.Name+" checksum mismatch")
+		}
+	}
+
+	model, useONNX, err := cfg.ONNXModel()
+	switch {
+	case err != nil:
+		problems = append(problems, err.Error())
+	case useONNX:
+		if _, err := os.Stat(model.Path); err != nil {
+			problems = append(problems, model.Path+" missing")
+		}
+	}
+
+	if len(problems) > 0 {
+		return selftestResult{"models", selftestFail, strings.Join(problems, ", ")}
+	}
+	return selftestResult{"models", selftestPass, fmt.Sprintf("%d file(s) verified in %s", len(statuses), cfg.ModelsDir)}
+}
+
+func selftestPipeline(cfg *config.Config, imagePath string) []selftestResult {
+	backend, err := modelspec.ParseBackend(cfg.PipelineBackend)
+	if err != nil {
+		return []selftestResult{{"detector", selftestFail, err.Error()}}
+	}
+
+	detector, extractor, err := newPipeline(cfg)
+	if err != nil {
+		return []selftestResult{
+			{"detector", selftestFail, err.Error()},
+			{"extractor", selftestSkip, "pipeline unavailable"},
+		}
+	}
+	defer detector.Close()
+	defer extractor.Close()
+
+	sample := samples.Face(1)
+
+	detection := selftestResult{"detection", selftestWarn, "no face found in synthetic sample (use --image to check a real photo)"}
+	if _, err := detector.DetectLargestFace(sample); err == nil {
+		detection = selftestResult{"detection", selftestPass, "face found in synthetic sample"}
+	}
+
+	if imagePath != "" {
+		img, err := storage.LoadImageFromPath(imagePath)
+		if err != nil {
+			detection = selftestResult{"detection", selftestFail, err.Error()}
+		} else if found, err := detector.DetectLargestFace(img); err != nil {
+			detection = selftestResult{"detection", selftestFail, "no face detected in " + imagePath}
+		} else {
+			detection = selftestResult{"detection", selftestPass, fmt.Sprintf("face found in %s (quality: %.2f)", imagePath, found.Quality)}
+		}
+	}
+
+	return []selftestResult{
+		{"detector", selftestPass, fmt.Sprintf("initialized (%s backend)", backend)},
+		detection,
+		selftestExtraction(extractor, sample),
+	}
+}
+
+func selftestExtraction(extractor pipeline.Extractor, sample image.Image) selftestResult {
+	embedding, err := extractor.Extract(sample)
+	if err != nil {
+		return selftestResult{"extraction", selftestFail, err.Error()}
+	}
+	if len(embedding) == 0 {
+		return selftestResult{"extraction", selftestFail, "empty embedding"}
+	}
+
+	var norm float64
+	for _, v := range embedding {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return selftestResult{"extraction", selftestFail, "embedding contains NaN/Inf"}
+		}
+		norm += float64(v) * float64(v)
+	}
+
+	return selftestResult{"extraction", selftestPass, fmt.Sprintf("%d-d embedding, norm %.3f", len(embedding), math.Sqrt(norm))}
+}
+
+func selftestStorage() selftestResult {
+	dir, err := os.MkdirTemp("", "face-selftest-storage-")
+	if err != nil {
+		return selftestResult{"storage", selftestFail, err.Error()}
+	}
+	defer os.RemoveAll(dir)
+
+	for _, layout := range []storage.Layout{storage.LayoutFlat, storage.LayoutSharded} {
+		stor, err := storage.NewFileSystemStorage(dir, layout)
+		if err != nil {
+			return selftestResult{"storage", selftestFail, err.Error()}
+		}
+
+		filename, err := stor.SaveImage(uuid.New().String(), uuid.New().String(), samples.Face(2))
+		if err != nil {
+			return selftestResult{"storage", selftestFail, err.Error()}
+		}
+		if _, err := stor.LoadImage(filename); err != nil {
+			return selftestResult{"storage", selftestFail, err.Error()}
+		}
+		if err := stor.DeleteImage(filename); err != nil {
+			return selftestResult{"storage", selftestFail, err.Error()}
+		}
+	}
+
+	return selftestResult{"storage", selftestPass, "save/load/delete round trip (flat and sharded)"}
+}
+
+func selftestDatabase(dbType database.DatabaseType) selftestResult {
+	component := "db:" + string(dbType)
+
+	dir, err := os.MkdirTemp("", "face-selftest-db-")
+	if err != nil {
+		return selftestResult{component, selftestFail, err.Error()}
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "selftest.db")
+	if dbType.UsesMigrations() {
+		migrator, err := database.NewMigrator(dbType, path, database.Options{})
+		if err != nil {
+			return selftestResult{component, selftestFail, err.Error()}
+		}
+		err = migrator.Up()
+		migrator.Close()
+		if err != nil {
+			return selftestResult{component, selftestFail, err.Error()}
+		}
+	}
+
+	db, err := database.NewDatabaseConnection(dbType, path, database.Options{})
+	if err != nil {
+		return selftestResult{component, selftestFail, err.Error()}
+	}
+	defer db.Close()
+
+	user := &models.User{ID: uuid.New().String(), Name: "Selftest User"}
+	if err := db.CreateUser(user); err != nil {
+		return selftestResult{component, selftestFail, err.Error()}
+	}
+
+	faceData := &models.Face{
+		ID:           uuid.New().String(),
+		Filename:     "selftest.jpg",
+		Embedding:    models.Embedding{0.6, 0.8},
+		QualityScore: 1,
+	}
+	if _, err := db.AddFace(user.ID, faceData); err != nil {
+		return selftestResult{component, selftestFail, err.Error()}
+	}
+
+	embeddings, err := db.GetAllEmbeddings()
+	if err != nil {
+		return selftestResult{component, selftestFail, err.Error()}
+	}
+	if len(embeddings[user.ID]) != 1 {
+		return selftestResult{component, selftestFail, "stored face not returned"}
+	}
+
+	if err := db.DeleteUser(user.ID); err != nil {
+		return selftestResult{component, selftestFail, err.Error()}
+	}
+
+	return selftestResult{component, selftestPass, "create/add face/read/delete round trip"}
+}
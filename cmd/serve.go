@@ -0,0 +1,619 @@
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/database"
+	"face/internal/deadline"
+	"face/internal/logging"
+	"face/internal/notify"
+	"face/internal/redaction"
+	"face/internal/stepup"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+)
+
+// serveRetryAfter is the Retry-After sent with 429 responses, in seconds
+const serveRetryAfter = 1
+
+// serveOptions are the settings of the REST server
+type serveOptions struct {
+	Listen string
+	// GRPC is the address of the gRPC API, none if empty
+	GRPC string
+	// Workers is how many images are processed at once, each worker with
+	// its own detector and extractor
+	Workers int
+	// Queue is how many requests may wait for a worker before further
+	// ones are turned away with 429
+	Queue int
+	// Pprof serves the Go profiler under /debug/pprof/ to admin keys
+	Pprof bool
+}
+
+func NewServeCmd(cfg *config.Config) *cobra.Command {
+	var opts serveOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a REST or gRPC API for enrollment and identification",
+		Long: `Serve a JSON REST API backed by the same pipeline, database and storage as
+the other commands:
+
+  POST   /enroll                        enroll a user from uploaded images
+  POST   /identify                      identify the face of an uploaded image
+  POST   /verify                        verify an uploaded image against a user
+  POST   /verify-dual                   verify two users, one image each
+  POST   /match                         match an image against a gallery sent
+                                        with the request, see 'face match'
+  GET    /users                         list users, ?name= to filter
+  GET    /users/{id}                    show a user
+  DELETE /users/{id}                    delete a user and their images
+  GET    /users/{id}/avatar             the user's avatar as JPEG
+  GET    /users/{id}/faces              list a user's faces
+  POST   /users/{id}/faces              add uploaded images as faces
+  DELETE /users/{id}/faces/{face_id}    remove a face
+  GET    /gallery/snapshot              gallery bundle, see 'face gallery'
+  GET    /gallery/delta?since=N         users changed since a revision
+  GET    /events                        server-sent events of enrollments,
+                                        identifications and deletions, or a
+                                        WebSocket of them
+
+Images are uploaded as multipart/form-data; the other fields are form fields
+too. Responses are JSON; errors are {"error": {"code": ..., "message": ...,
+"retryable": ..., "details": ..., "request_id": ...}}, where code is one of
+the stable codes listed in the README.
+
+--workers images are processed at once. Up to --queue further requests wait
+for a worker; beyond that, requests are answered with 429 and Retry-After.
+Their defaults are serve_workers and serve_queue in the config (or
+FACE_CLI_SERVE_WORKERS and FACE_CLI_SERVE_QUEUE), 1 and 16 if unset.
+
+With ann_index set in the config (or FACE_CLI_ANN_INDEX), identification
+searches an approximate nearest-neighbor index of every face, built at
+startup, instead of comparing the image with every face.
+
+Every response carries an X-Request-ID header, taken from the request when it
+sends a valid one, and the ID is added to the log lines of the request.
+
+With --grpc, the gRPC service of api/face/v1/face.proto is served on a second
+address too, with EnrollUser, Identify, Verify, ListUsers and the streaming
+IdentifyStream. It shares the workers, API keys and event feed of the REST
+API; keys are sent as authorization or x-api-key metadata.
+
+A request that takes longer than request_timeout_seconds in the config (or
+FACE_CLI_REQUEST_TIMEOUT_SECONDS; 30 by default, negative for no limit) is
+answered with the timeout error code, so a slow disk or a hung detector does
+not hold clients forever. /events and IdentifyStream are not bounded.
+
+When serve_api_key is set in the config (or FACE_CLI_SERVE_API_KEY), requests
+must send it as "Authorization: Bearer <key>" or in an X-API-Key header.
+Further keys in serve_api_keys each have a redaction level limiting what
+their clients learn about users: full, name-only, or id-only, which replaces
+user IDs with pseudonymous IDs. serve_api_key always sees full results;
+without any key, the redaction level of the config applies.`,
+		Example: `  face serve --listen :8080
+  curl -F name="Jane Smith" -F image=@jane.jpg localhost:8080/enroll
+  curl -F image=@snapshot.jpg localhost:8080/identify
+  curl -F user_id=abc123 -F image=@door.jpg localhost:8080/verify
+  face serve --listen :8080 --grpc :9090`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Workers < 1 || opts.Queue < 0 {
+				return errors.New("--workers must be at least 1 and --queue must not be negative")
+			}
+			return runServe(cfg, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Listen, "listen", ":8080", "address to listen on")
+	cmd.Flags().StringVar(&opts.GRPC, "grpc", "", "address to serve the gRPC API on, e.g. :9090")
+	workers, queue := cfg.Workers()
+	cmd.Flags().IntVar(&opts.Workers, "workers", workers, "images processed at once, each worker loads its own models")
+	cmd.Flags().IntVar(&opts.Queue, "queue", queue, "requests waiting for a worker before answering 429")
+	cmd.Flags().BoolVar(&opts.Pprof, "pprof", false, "serve the Go profiler under /debug/pprof/ to admin keys")
+
+	return cmd
+}
+
+func runServe(cfg *config.Config, opts serveOptions) error {
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	api := &apiServer{cfg: cfg, fs: fs, events: newEventHub(), stepUp: stepup.NewGuard()}
+	if err := api.loadKeys(); err != nil {
+		return err
+	}
+	if api.notifier, err = notify.New(cfg.Notify()); err != nil {
+		return err
+	}
+	api.verifyFailures = notify.NewFailureCounter(cfg.Notify().VerifyFailureLimit())
+	if api.index, err = loadFaceIndex(cfg, fs.DB); err != nil {
+		return fmt.Errorf("failed to build face index: %w", err)
+	}
+
+	pool, err := newWorkerPool(cfg, fs, opts.Workers, opts.Queue)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	api.pool = pool
+
+	server := &http.Server{
+		Addr:              opts.Listen,
+		Handler:           api.routes(opts.Pprof),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var grpcServer *grpc.Server
+	if opts.GRPC != "" {
+		if grpcServer, err = api.serveGRPC(opts.GRPC); err != nil {
+			return err
+		}
+		fmt.Printf("✓ gRPC API listening on %s\n", opts.GRPC)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := api.shutdownOnSignal(ctx, server, grpcServer)
+
+	if cfg.ServeAPIKey == "" && len(cfg.ServeAPIKeys) == 0 {
+		fmt.Println("⚠ Warning: serve_api_key is not set, anyone who can reach the server can use it")
+	}
+	warnUnaudited(cfg)
+	fmt.Printf("✓ REST API listening on %s (%d worker(s))\n", opts.Listen, opts.Workers)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	<-stopped
+	return nil
+}
+
+// serveGRPC serves the gRPC API on an address in the background
+func (s *apiServer) serveGRPC(addr string) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+	srv := s.newGRPCServer()
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			slog.Error("gRPC server failed", "error", err)
+		}
+	}()
+	return srv, nil
+}
+
+// shutdownOnSignal shuts the servers down when ctx is done, letting running
+// requests finish for up to 10 seconds. The returned channel is closed when
+// they have stopped.
+func (s *apiServer) shutdownOnSignal(ctx context.Context, server *http.Server, grpcServer *grpc.Server) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		s.events.Close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		if grpcServer != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stopGRPC(shutdownCtx, grpcServer)
+			}()
+		}
+		_ = server.Shutdown(shutdownCtx)
+		wg.Wait()
+	}()
+	return stopped
+}
+
+// apiServer implements the REST and gRPC APIs
+type apiServer struct {
+	cfg    *config.Config
+	fs     *FaceSystem
+	pool   *workerPool
+	events *eventHub
+	// notifier sends the notifications of enrollments, watchlist matches,
+	// repeated verification failures and internal errors
+	notifier       *notify.Notifier
+	verifyFailures *notify.FailureCounter
+	// stepUp limits the second factor attempts of each user
+	stepUp *stepup.Guard
+	// index identifies faces when ann_index is set, nil otherwise
+	index *faceIndex
+
+	// redactor applies the configured redaction level, to logs and to
+	// clients when no API key is set
+	redactor *redaction.Redactor
+	keys     []apiKey
+}
+
+// apiKey is an API key with the redactor, the device scope and the role of
+// its clients
+type apiKey struct {
+	name     string
+	key      []byte
+	redactor *redaction.Redactor
+	scope    string
+	role     config.APIKeyRole
+}
+
+// loadKeys prepares the configured API keys and redactors
+func (s *apiServer) loadKeys() error {
+	var err error
+	if s.redactor, err = s.cfg.Redactor(); err != nil {
+		return err
+	}
+
+	if s.cfg.ServeAPIKey != "" {
+		full, _ := s.cfg.RedactorFor(string(redaction.LevelFull))
+		s.keys = append(s.keys, apiKey{name: "serve_api_key", key: []byte(s.cfg.ServeAPIKey), redactor: full, scope: s.cfg.Device, role: config.APIKeyAdmin})
+	}
+	for _, k := range s.cfg.ServeAPIKeys {
+		if k.Key == "" {
+			return fmt.Errorf("API key %q has no key", k.Name)
+		}
+		redactor, err := s.cfg.RedactorFor(k.Redaction)
+		if err != nil {
+			return fmt.Errorf("API key %q: %w", k.Name, err)
+		}
+		role, err := config.ParseAPIKeyRole(k.Role)
+		if err != nil {
+			return fmt.Errorf("API key %q: %w", k.Name, err)
+		}
+		s.keys = append(s.keys, apiKey{name: k.Name, key: []byte(k.Key), redactor: redactor, scope: cmp.Or(k.Device, s.cfg.Device), role: role})
+	}
+	return nil
+}
+
+// apiHandler handles a request, writing the response itself on success
+type apiHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (s *apiServer) routes(withPprof bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /enroll", s.handle(writes(s.enroll)))
+	mux.HandleFunc("POST /identify", s.handle(s.identify))
+	mux.HandleFunc("POST /verify", s.handle(s.verify))
+	mux.HandleFunc("POST /verify-dual", s.handle(s.verifyDual))
+	mux.HandleFunc("POST /verify-batch", s.handle(s.verifyBatch))
+	mux.HandleFunc("POST /match", s.handle(s.match))
+	mux.HandleFunc("GET /users", s.handle(s.listUsers))
+	mux.HandleFunc("GET /users/{id}", s.handle(s.getUser))
+	mux.HandleFunc("DELETE /users/{id}", s.handle(writes(s.deleteUser)))
+	mux.HandleFunc("GET /users/{id}/avatar", s.handle(s.avatar))
+	mux.HandleFunc("GET /users/{id}/faces", s.handle(s.listUserFaces))
+	mux.HandleFunc("POST /users/{id}/faces", s.handle(writes(s.addUserFaces)))
+	mux.HandleFunc("DELETE /users/{id}/faces/{face_id}", s.handle(writes(s.deleteUserFace)))
+	mux.HandleFunc("GET /gallery/snapshot", s.handle(s.gallerySnapshot))
+	mux.HandleFunc("GET /gallery/delta", s.handle(s.galleryDelta))
+	mux.HandleFunc("GET /events", s.handleStream(s.streamEvents))
+
+	if withPprof {
+		s.pprofRoutes(mux)
+	}
+	return s.middleware(mux)
+}
+
+// middleware assigns the request ID, checks the API key, limits the body
+// size and logs each request
+func (s *apiServer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		ctx, info := s.startRequest(r.Context(), r.Header.Get("X-Request-ID"))
+		r = r.WithContext(ctx)
+		w.Header().Set("X-Request-ID", info.id)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if s.authenticate(info, sentAPIKey(r.Header.Get("Authorization"), r.Header.Get("X-API-Key"))) {
+			r.Body = http.MaxBytesReader(rec, r.Body, uploadMaxRequest)
+			next.ServeHTTP(rec, r)
+		} else {
+			writeAPIError(rec, r, apierror.New(apierror.CodeUnauthenticated, "missing or wrong API key"))
+		}
+		if r.MultipartForm != nil {
+			_ = r.MultipartForm.RemoveAll()
+		}
+
+		info.logger.Info("api request", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+			"duration_ms", time.Since(started).Milliseconds())
+	})
+}
+
+// startRequest assigns a request its ID, the one it sent if valid, and
+// returns the context carrying its requestInfo
+func (s *apiServer) startRequest(ctx context.Context, sentID string) (context.Context, *requestInfo) {
+	id := sentID
+	if !logging.RequestIDPattern.MatchString(id) {
+		id = uuid.New().String()
+	}
+	info := &requestInfo{id: id, logger: slog.With("http_request_id", id), redactor: s.redactor, scope: s.cfg.Device, role: config.APIKeyAdmin, notifier: s.notifier}
+	return context.WithValue(ctx, requestInfoKey{}, info), info
+}
+
+// authenticate checks the API key sent with a request, setting the logger,
+// redactor, scope and role of the request for its client. It reports false
+// if keys are configured and the request sent none of them.
+func (s *apiServer) authenticate(info *requestInfo, sent string) bool {
+	if len(s.keys) == 0 {
+		return true
+	}
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(sent), key.key) == 1 {
+			info.logger = info.logger.With("api_client", key.name)
+			info.client = key.name
+			info.redactor = key.redactor
+			info.scope = key.scope
+			info.role = key.role
+			return true
+		}
+	}
+	return false
+}
+
+// sentAPIKey returns the API key sent as a bearer token or an X-API-Key
+// header
+func sentAPIKey(authorization, xAPIKey string) string {
+	if bearer, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		return bearer
+	}
+	return xAPIKey
+}
+
+// handle writes the error of a handler as the response. The request must
+// finish within the configured request timeout, or its stages fail with a
+// deadline.Error, answered as a timeout.
+func (s *apiServer) handle(h apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := deadline.WithTimeout(r.Context(), s.cfg.RequestTimeout())
+		defer cancel()
+		r = r.WithContext(ctx)
+		if err := h(w, r); err != nil {
+			writeAPIError(w, r, err)
+		}
+	}
+}
+
+// writes wraps a handler that changes users or faces, refusing clients
+// whose API key does not allow writing
+func writes(h apiHandler) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := requireRole(r.Context(), config.APIKeyWrite); err != nil {
+			return err
+		}
+		return h(w, r)
+	}
+}
+
+// requireRole returns an error with the code permission_denied unless the
+// client's API key has the role or a higher one
+func requireRole(ctx context.Context, role config.APIKeyRole) error {
+	if !requestRole(ctx).Allows(role) {
+		return apierror.New(apierror.CodePermissionDenied, "API key needs the %s role", role).WithDetail("role", string(role))
+	}
+	return nil
+}
+
+// handleStream is handle for a handler that streams its response for as
+// long as the client listens, without the request timeout
+func (s *apiServer) handleStream(h apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			writeAPIError(w, r, err)
+		}
+	}
+}
+
+// db returns the database bound to the deadline of a request
+func (s *apiServer) db(ctx context.Context) database.Database {
+	return deadline.WrapDatabase(s.fs.DB, ctx)
+}
+
+// requestInfoKey is the context key of the requestInfo of a request
+type requestInfoKey struct{}
+
+// requestInfo is what the middleware knows about a request
+type requestInfo struct {
+	id     string
+	logger *slog.Logger
+	// client is the name of the client's API key, empty without keys
+	client string
+	// redactor applies the redaction level of the client's API key
+	redactor *redaction.Redactor
+	// scope is the device scope of the client's API key, whose users
+	// alone are identified
+	scope string
+	// role is what the client's API key allows, admin without keys
+	role config.APIKeyRole
+	// notifier reports internal errors
+	notifier *notify.Notifier
+}
+
+// requestLogger returns the logger of the request of a context, which adds
+// its request ID
+func requestLogger(ctx context.Context) *slog.Logger {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.logger
+	}
+	return slog.Default()
+}
+
+// requestRedactor returns the redactor of the client of the request of a
+// context
+func requestRedactor(ctx context.Context) *redaction.Redactor {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.redactor
+	}
+	return &redaction.Redactor{Level: redaction.LevelIDOnly}
+}
+
+// requestScope returns the device scope of the client of the request of a
+// context, empty to identify everyone
+func requestScope(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.scope
+	}
+	return ""
+}
+
+// requestRole returns the role of the client of the request of a context
+func requestRole(ctx context.Context) config.APIKeyRole {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.role
+	}
+	return config.APIKeyAdmin
+}
+
+// requestIDOf returns the ID of the request of a context
+func requestIDOf(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// statusRecorder remembers the status of a response for the request log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands the connection to a WebSocket client of /events
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g.
+// to flush events
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// reportedError returns the API error reporting err to clients. Internal
+// errors are logged, as clients only learn that one happened.
+func reportedError(ctx context.Context, err error) *apierror.Error {
+	apiErr := apierror.From(err)
+	if apiErr.Code == apierror.CodeInternal {
+		requestLogger(ctx).Error("api request failed", "error", err)
+		notifySystemError(ctx, err)
+	}
+	return apiErr
+}
+
+// notifySystemError sends the system_error notifications of an internal
+// error of a request
+func notifySystemError(ctx context.Context, err error) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok || info.notifier == nil || len(info.notifier.Rules(notify.EventSystemError)) == 0 {
+		return
+	}
+	sendNotification(info.logger, info.notifier, notify.Data{
+		Event:     notify.EventSystemError,
+		Time:      time.Now(),
+		Error:     err.Error(),
+		RequestID: info.id,
+	})
+}
+
+// writeAPIError writes the error envelope reporting err
+func writeAPIError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := reportedError(r.Context(), err)
+	if apiErr.Code == apierror.CodeBusy {
+		w.Header().Set("Retry-After", strconv.Itoa(serveRetryAfter))
+	}
+	writeJSON(w, apiErr.HTTPStatus(), map[string]any{"error": apiErr.Envelope(requestIDOf(r.Context()))})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// parseForm parses a multipart or URL-encoded form
+func parseForm(r *http.Request) error {
+	if err := r.ParseMultipartForm(uploadFormMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return err
+		}
+		return badRequest("invalid form: %v", err)
+	}
+	return nil
+}
+
+// formBool returns a boolean form field, false if it is not set
+func formBool(r *http.Request, field string) (bool, error) {
+	v := r.FormValue(field)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, apierror.New(apierror.CodeInvalidArgument, "%s must be true or false", field).WithDetail("field", field)
+	}
+	return b, nil
+}
+
+// requestThreshold returns the threshold form field of a request matching
+// against the database, the configured threshold if it is not set. Only
+// admin clients may lower it below the configured threshold; a lower one
+// is raised to it.
+func (s *apiServer) requestThreshold(r *http.Request) (float64, error) {
+	t, err := formThreshold(r, s.cfg.DefaultThreshold)
+	if err != nil {
+		return 0, err
+	}
+	return clampThreshold(r.Context(), t, s.cfg.DefaultThreshold), nil
+}
+
+// clampThreshold raises a threshold sent by a client to the configured one
+// unless the client's API key is an admin key
+func clampThreshold(ctx context.Context, t, configured float64) float64 {
+	if t < configured && !requestRole(ctx).Allows(config.APIKeyAdmin) {
+		return configured
+	}
+	return t
+}
+
+// formThreshold returns the threshold form field, or def if it is not set
+func formThreshold(r *http.Request, def float64) (float64, error) {
+	v := r.FormValue("threshold")
+	if v == "" {
+		return def, nil
+	}
+	t, err := strconv.ParseFloat(v, 64)
+	if err != nil || t < 0 || t > 1 {
+		return 0, badRequest("threshold must be between 0 and 1")
+	}
+	return t, nil
+}
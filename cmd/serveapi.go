@@ -0,0 +1,617 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"face/internal/apierror"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/deadline"
+	"face/internal/notify"
+	"face/internal/quality"
+	"face/internal/redaction"
+	"face/internal/stepup"
+
+	"github.com/google/uuid"
+)
+
+// identifyCandidates is how many of the best matches /identify reports
+const identifyCandidates = 5
+
+// Reasons a verification failed
+const (
+	reasonNoMatch        = "no_match"
+	reasonExpired        = "expired"
+	reasonStepUpRequired = "step_up_required"
+	reasonStepUpFailed   = "step_up_failed"
+	reasonNoFactor       = "no_second_factor"
+	reasonStepUpLocked   = "step_up_locked"
+)
+
+// apiUser is a user as returned by the API, without face embeddings and
+// second factor secrets. Fields the client's redaction level hides are
+// omitted.
+type apiUser struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Email      string          `json:"email,omitempty"`
+	Phone      string          `json:"phone,omitempty"`
+	Metadata   models.Metadata `json:"metadata,omitempty"`
+	CardNumber string          `json:"card_number,omitempty"`
+	Badge      string          `json:"badge,omitempty"`
+	ExpiresAt  *time.Time      `json:"expires_at,omitempty"`
+	Faces      []apiFace       `json:"faces,omitempty"`
+	CreatedAt  time.Time       `json:"created_at,omitzero"`
+	UpdatedAt  time.Time       `json:"updated_at,omitzero"`
+}
+
+// apiFace is a face as returned by the API
+type apiFace struct {
+	ID           string    `json:"id"`
+	QualityScore float64   `json:"quality_score"`
+	EnrolledAt   time.Time `json:"enrolled_at"`
+	Label        string    `json:"label,omitempty"`
+	Primary      bool      `json:"primary,omitempty"`
+}
+
+// apiBox is a face box in the coordinates of the uploaded image
+type apiBox struct {
+	XMin int `json:"x_min"`
+	YMin int `json:"y_min"`
+	XMax int `json:"x_max"`
+	YMax int `json:"y_max"`
+}
+
+// apiCandidate is one of the best matches of an identification
+type apiCandidate struct {
+	UserID     string  `json:"user_id"`
+	Name       string  `json:"name,omitempty"`
+	Confidence float64 `json:"confidence"`
+	// Votes is set under the vote match strategy
+	Votes int `json:"votes,omitempty"`
+}
+
+// apiIdentification is the response of /identify
+type apiIdentification struct {
+	Matched    bool           `json:"matched"`
+	User       *apiUser       `json:"user,omitempty"`
+	FaceID     string         `json:"face_id,omitempty"`
+	Confidence float64        `json:"confidence,omitempty"`
+	Threshold  float64        `json:"threshold"`
+	Quality    float64        `json:"quality"`
+	SpoofScore float64        `json:"spoof_score"`
+	Box        apiBox         `json:"box"`
+	Candidates []apiCandidate `json:"candidates"`
+	// Hints say what the person can do about the problems of their face
+	Hints []quality.Hint `json:"hints,omitempty"`
+	// Enriched is set when the probe was added to the user's faces
+	Enriched bool `json:"enriched,omitempty"`
+}
+
+// apiVerification is the result of verifying an image against a user
+type apiVerification struct {
+	Verified   bool    `json:"verified"`
+	UserID     string  `json:"user_id"`
+	Confidence float64 `json:"confidence"`
+	Threshold  float64 `json:"threshold"`
+	Quality    float64 `json:"quality"`
+	SpoofScore float64 `json:"spoof_score"`
+	// Reason says why the verification failed, empty if it succeeded
+	Reason string `json:"reason,omitempty"`
+	// Hints say what the person can do about the problems of their face
+	Hints []quality.Hint `json:"hints,omitempty"`
+}
+
+// newAPIUser returns the user as a client with the redactor may see them
+func newAPIUser(redactor *redaction.Redactor, user *models.User, withFaces bool) *apiUser {
+	user = redactor.User(user)
+	u := &apiUser{
+		ID:         user.ID,
+		Name:       user.Name,
+		Email:      user.Email,
+		Phone:      user.Phone,
+		Metadata:   user.Metadata,
+		CardNumber: user.CardNumber,
+		Badge:      user.Badge,
+		ExpiresAt:  user.ExpiresAt,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+	}
+	if withFaces {
+		u.Faces = newAPIFaces(user.Faces)
+	}
+	return u
+}
+
+func newAPIFaces(faces []models.Face) []apiFace {
+	list := make([]apiFace, len(faces))
+	for i, f := range faces {
+		list[i] = apiFace{ID: f.ID, QualityScore: f.QualityScore, EnrolledAt: f.EnrolledAt, Label: f.Label, Primary: f.Primary}
+	}
+	return list
+}
+
+func newAPIBox(r image.Rectangle) apiBox {
+	return apiBox{XMin: r.Min.X, YMin: r.Min.Y, XMax: r.Max.X, YMax: r.Max.Y}
+}
+
+// formImage opens the image uploaded in a form field
+func formImage(r *http.Request, field string) (multipart.File, error) {
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, apierror.New(apierror.CodeInvalidArgument, "no %s uploaded", field).WithDetail("field", field)
+	}
+	return file, nil
+}
+
+// enroll creates a user from the form fields with the faces of every
+// uploaded image. Either every image is enrolled or none is.
+func (s *apiServer) enroll(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	user, err := enrollFormUser(r)
+	if err != nil {
+		return err
+	}
+	force, err := formBool(r, "force")
+	if err != nil {
+		return err
+	}
+
+	enrolled, err := s.enrollUser(r.Context(), user, formImages(r.MultipartForm), force)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, enrolled)
+	return nil
+}
+
+// enrollFormUser returns the user described by the enroll form fields
+func enrollFormUser(r *http.Request) (*models.User, error) {
+	user := newEnrollUser()
+	user.Name = r.FormValue("name")
+	user.Email = r.FormValue("email")
+	user.Phone = r.FormValue("phone")
+	user.CardNumber = r.FormValue("card_number")
+	user.Badge = r.FormValue("badge")
+
+	if v := r.FormValue("metadata"); v != "" {
+		if err := json.Unmarshal([]byte(v), &user.Metadata); err != nil {
+			return nil, badRequest("invalid metadata JSON: %v", err)
+		}
+	}
+	if v := r.FormValue("expires_in"); v != "" {
+		expiresIn, err := time.ParseDuration(v)
+		if err != nil || expiresIn <= 0 {
+			return nil, badRequest("expires_in must be a positive duration, e.g. 8h")
+		}
+		expiresAt := time.Now().Add(expiresIn)
+		user.ExpiresAt = &expiresAt
+	}
+	return user, nil
+}
+
+// newEnrollUser returns a user to fill in from an enrollment request
+func newEnrollUser() *models.User {
+	return &models.User{ID: uuid.New().String()}
+}
+
+// enrollUser creates a user with the faces of every image, returning them
+// as the client may see them. Either every image is enrolled or none is.
+// force enrolls a name another user has under the warn duplicate name
+// policy.
+func (s *apiServer) enrollUser(ctx context.Context, user *models.User, images []uploadedImage, force bool) (_ *apiUser, err error) {
+	defer func() { s.audit(ctx, models.AuditEvent{Operation: models.AuditEnroll, UserID: user.ID}, err) }()
+
+	if err := user.Validate(); err != nil {
+		return nil, badRequest("%w", err)
+	}
+	if len(images) == 0 {
+		return nil, badRequest("no image uploaded")
+	}
+
+	fs, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.pool.Release(fs)
+
+	if err := checkAPIEnrollName(fs.DB, user.Name, force, s.cfg.NameTransliteration); err != nil {
+		return nil, err
+	}
+	if user.Faces, err = saveUploadedFaces(fs, user.ID, images); err != nil {
+		return nil, err
+	}
+	if err := fs.DB.CreateUser(user); err != nil {
+		discardFaces(fs, user.Faces)
+		return nil, fmt.Errorf("failed to save user to database: %w", err)
+	}
+	s.index.refresh(user.ID)
+	refreshAvatar(fs.DB, fs.Storage, user.ID)
+
+	requestLogger(ctx).Info("user enrolled", "user_id", user.ID, "faces", len(user.Faces))
+	event := newEvent(ctx, eventEnroll, user)
+	event.Faces = len(user.Faces)
+	s.events.Publish(event)
+	s.notify(ctx, notify.EventEnrolled, user, 0, 0)
+	return newAPIUser(requestRedactor(ctx), user, true), nil
+}
+
+// notify sends the notifications of an event about a user in the
+// background, so a slow mail server does not delay the response. Failures
+// are logged.
+func (s *apiServer) notify(ctx context.Context, event notify.Event, user *models.User, confidence float64, failures int) {
+	if len(s.notifier.Rules(event)) == 0 {
+		return
+	}
+	data := userNotification(s.redactor, event, user)
+	data.Confidence, data.Failures, data.RequestID = confidence, failures, requestIDOf(ctx)
+	sendNotification(requestLogger(ctx), s.notifier, data)
+}
+
+// checkAPIEnrollName applies the duplicate name policy before enrolling
+func checkAPIEnrollName(db database.Database, name string, force, transliterate bool) error {
+	taken, policy, err := duplicateName(db, name, transliterate)
+	if err != nil || taken == "" || policy.Admits(force) {
+		return err
+	}
+
+	apiErr := apierror.New(apierror.CodeDuplicateName, "a user named %q already exists; send force=true to enroll another user with the name", taken)
+	if policy == models.DuplicateNameReject {
+		apiErr = apierror.New(apierror.CodeDuplicateName, "a user named %q already exists, and the duplicate name policy rejects it", taken)
+	}
+	return apiErr.WithDetail("name", taken).WithDetail("policy", string(policy))
+}
+
+// identify matches the face of the uploaded image against every user
+func (s *apiServer) identify(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	threshold, err := s.requestThreshold(r)
+	if err != nil {
+		return err
+	}
+	requireLiveness, err := formBool(r, "require_liveness")
+	if err != nil {
+		return err
+	}
+	file, err := formImage(r, "image")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	resp, err := s.identifyImage(r.Context(), file, threshold, requireLiveness || s.cfg.RequireLiveness)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// identifyImage matches the face of an image against every user, adding it
+// to the matched user's faces when auto-enrichment is on. With
+// requireLiveness, a face that scores as a spoof is rejected first.
+func (s *apiServer) identifyImage(ctx context.Context, file io.ReadSeeker, threshold float64, requireLiveness bool) (_ *apiIdentification, err error) {
+	audit := models.AuditEvent{Operation: models.AuditIdentify, Result: models.AuditNoMatch}
+	defer func() { s.audit(ctx, audit, err) }()
+
+	fs, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.pool.Release(fs)
+
+	result, err := processUpload(fs, file)
+	if err != nil {
+		return nil, err
+	}
+	if requireLiveness {
+		if err := checkLiveness(s.cfg, result.SpoofScore); err != nil {
+			return nil, err
+		}
+	}
+
+	matcher := s.index.identifier(fs.DB, fs.Decay, fs.Strategy, requestScope(ctx))
+	matches, err := deadline.Do(ctx, "matching", func() ([]models.MatchResult, error) {
+		return matcher.FindBestMatches(result.Embedding, identifyCandidates)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find matches: %w", err)
+	}
+	redactor := requestRedactor(ctx)
+	resp := &apiIdentification{
+		Threshold:  threshold,
+		Quality:    result.QualityScore,
+		SpoofScore: result.SpoofScore,
+		Box:        newAPIBox(result.Box),
+		Candidates: []apiCandidate{},
+		Hints:      result.Scores.Hints(),
+	}
+	for _, m := range matches {
+		user := redactor.User(m.User)
+		resp.Candidates = append(resp.Candidates, apiCandidate{UserID: user.ID, Name: user.Name, Confidence: m.Confidence, Votes: m.Votes})
+	}
+
+	match, err := matcher.Match(result.Embedding, threshold)
+	switch {
+	case errors.Is(err, models.ErrNoMatch):
+	case err != nil:
+		return nil, fmt.Errorf("matching failed: %w", err)
+	default:
+		resp.Matched = true
+		resp.User = newAPIUser(redactor, match.User, false)
+		resp.FaceID = redactor.FaceID(match.FaceID)
+		resp.Confidence = match.Confidence
+		audit.Result, audit.UserID, audit.Confidence = models.AuditSucceeded, match.UserID, match.Confidence
+		if s.cfg.Notify().OnWatchlist(match.User) {
+			s.notify(ctx, notify.EventWatchlistMatch, match.User, match.Confidence, 0)
+		}
+		if s.cfg.AutoEnrich {
+			reason, err := enrichUser(s.cfg, fs, match, result)
+			if err != nil {
+				return nil, fmt.Errorf("auto-enrichment failed: %w", err)
+			}
+			s.index.refresh(match.UserID)
+			resp.Enriched = reason == ""
+		}
+	}
+
+	var matched *models.User
+	if resp.Matched {
+		matched = match.User
+	}
+	event := newEvent(ctx, eventIdentify, matched)
+	event.Matched, event.Confidence = &resp.Matched, resp.Confidence
+	requestLogger(ctx).Info("identification", "matched", resp.Matched, "user_id", s.redactor.UserID(event.UserID),
+		"confidence", resp.Confidence, "threshold", threshold)
+	s.events.Publish(event)
+	return resp, nil
+}
+
+// verify checks the face of the uploaded image against user_id, asking for
+// the user's second factor in the code field when step-up rules require it
+func (s *apiServer) verify(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	threshold, err := s.requestThreshold(r)
+	if err != nil {
+		return err
+	}
+	userID := r.FormValue("user_id")
+	if userID == "" {
+		return missingField("user_id")
+	}
+	requireLiveness, err := formBool(r, "require_liveness")
+	if err != nil {
+		return err
+	}
+	file, err := formImage(r, "image")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	v, err := s.verifyImage(r.Context(), userID, file, threshold, r.FormValue("code"), requireLiveness || s.cfg.RequireLiveness)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, v)
+	return nil
+}
+
+// verifyImage checks the face of an image against a user, checking the
+// second factor code when step-up rules require one. With requireLiveness, a
+// face that scores as a spoof is rejected.
+func (s *apiServer) verifyImage(ctx context.Context, userID string, file io.ReadSeeker, threshold float64, code string, requireLiveness bool) (_ *apiVerification, err error) {
+	defer func() {
+		if err != nil {
+			s.audit(ctx, models.AuditEvent{Operation: models.AuditVerify, UserID: userID}, err)
+		}
+	}()
+
+	user, err := s.userInScope(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.pool.Release(fs)
+
+	v, err := verifyUpload(fs, user, file, threshold)
+	if err != nil {
+		return nil, err
+	}
+	if requireLiveness {
+		if err := checkLiveness(s.cfg, v.SpoofScore); err != nil {
+			return nil, err
+		}
+	}
+	if v.Verified {
+		if v.Reason = s.stepUpReason(user, v.Confidence, code); v.Reason != "" {
+			v.Verified = false
+		}
+	}
+
+	s.logVerification(ctx, user, v)
+	v.UserID = requestRedactor(ctx).UserID(v.UserID)
+	return v, nil
+}
+
+// verifyDual verifies image_a against user_a and image_b against user_b,
+// succeeding only if both verify, checking the second factor of each in
+// code_a and code_b when step-up rules require one. With require_liveness,
+// a face that scores as a spoof is rejected.
+func (s *apiServer) verifyDual(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	threshold, err := s.requestThreshold(r)
+	if err != nil {
+		return err
+	}
+	requireLiveness, err := formBool(r, "require_liveness")
+	if err != nil {
+		return err
+	}
+
+	parties := [2]string{"a", "b"}
+	users, err := s.dualUsers(r, parties)
+	if err != nil {
+		return err
+	}
+
+	files := make([]multipart.File, len(parties))
+	for i, party := range parties {
+		if files[i], err = formImage(r, "image_"+party); err != nil {
+			return err
+		}
+		defer files[i].Close()
+	}
+
+	fs, err := s.pool.Acquire(r.Context())
+	if err != nil {
+		return err
+	}
+	defer s.pool.Release(fs)
+
+	resp := struct {
+		Verified bool               `json:"verified"`
+		Parties  []*apiVerification `json:"parties"`
+	}{Verified: true}
+	for i, user := range users {
+		v, err := verifyUpload(fs, user, files[i], threshold)
+		if err == nil && (requireLiveness || s.cfg.RequireLiveness) {
+			err = checkLiveness(s.cfg, v.SpoofScore)
+		}
+		if err != nil {
+			s.audit(r.Context(), models.AuditEvent{Operation: models.AuditVerify, UserID: user.ID}, err)
+			return err
+		}
+		if v.Verified {
+			if v.Reason = s.stepUpReason(user, v.Confidence, r.FormValue("code_"+parties[i])); v.Reason != "" {
+				v.Verified = false
+			}
+		}
+		s.logVerification(r.Context(), user, v)
+		v.UserID = requestRedactor(r.Context()).UserID(v.UserID)
+		resp.Parties = append(resp.Parties, v)
+		resp.Verified = resp.Verified && v.Verified
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// dualUsers looks up the users of the user_ fields of the parties, who
+// must be different
+func (s *apiServer) dualUsers(r *http.Request, parties [2]string) ([]*models.User, error) {
+	users := make([]*models.User, len(parties))
+	for i, party := range parties {
+		id := r.FormValue("user_" + party)
+		if id == "" {
+			return nil, missingField("user_" + party)
+		}
+		user, err := s.userInScope(r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+		users[i] = user
+	}
+	if users[0].ID == users[1].ID {
+		return nil, badRequest("user_a and user_b must be different users")
+	}
+	return users, nil
+}
+
+// verifyUpload verifies the face of an uploaded image against a user.
+// Expired visitors never verify.
+func verifyUpload(fs *FaceSystem, user *models.User, file io.ReadSeeker, threshold float64) (*apiVerification, error) {
+	result, err := processUpload(fs, file)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &apiVerification{UserID: user.ID, Threshold: threshold, Quality: result.QualityScore, SpoofScore: result.SpoofScore, Hints: result.Scores.Hints()}
+	if user.Expired(time.Now()) {
+		v.Reason = reasonExpired
+		return v, nil
+	}
+
+	matched, confidence, err := newVerifier(fs.Decay, fs.Strategy).Verify(user, result.Embedding, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("verification failed: %w", err)
+	}
+	v.Verified, v.Confidence = matched, confidence
+	if !matched {
+		v.Reason = reasonNoMatch
+	}
+	return v, nil
+}
+
+// stepUpReason checks the second factor sent with a verification if the
+// step-up rules require one, returning why it failed or "" if it passed
+func (s *apiServer) stepUpReason(user *models.User, confidence float64, code string) string {
+	if !s.cfg.StepUp().Required(user, confidence) {
+		return ""
+	}
+	if !stepup.HasFactor(user) {
+		return reasonNoFactor
+	}
+	if code == "" {
+		return reasonStepUpRequired
+	}
+	err := s.stepUp.Check(user, code, time.Now())
+	switch {
+	case errors.Is(err, stepup.ErrLockedOut):
+		return reasonStepUpLocked
+	case err != nil:
+		return reasonStepUpFailed
+	}
+	return ""
+}
+
+// logVerification logs a verification of the user, records it in the
+// audit log and publishes it as an event, notifying when verifying the user
+// failed repeatedly
+func (s *apiServer) logVerification(ctx context.Context, user *models.User, v *apiVerification) {
+	requestLogger(ctx).Info("verification", "user_id", s.redactor.UserID(v.UserID), "matched", v.Verified, "confidence", v.Confidence,
+		"threshold", v.Threshold, "reason", v.Reason)
+	event := newEvent(ctx, eventVerify, user)
+	event.Name, event.Matched, event.Confidence = "", &v.Verified, v.Confidence
+	s.events.Publish(event)
+
+	audit := models.AuditEvent{Operation: models.AuditVerify, UserID: user.ID, Confidence: v.Confidence}
+	switch v.Reason {
+	case "":
+	case reasonNoMatch:
+		audit.Result = models.AuditNoMatch
+	default:
+		audit.Result, audit.Error = models.AuditFailed, v.Reason
+	}
+	s.audit(ctx, audit, nil)
+
+	// asking for the second factor is part of verifying, not a failure
+	switch v.Reason {
+	case "":
+		s.verifyFailures.Succeed(user.ID)
+	case reasonNoMatch, reasonStepUpFailed, reasonStepUpLocked:
+		if failures, ok := s.verifyFailures.Fail(user.ID, time.Now()); ok {
+			s.notify(ctx, notify.EventVerifyFailures, user, v.Confidence, failures)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"face/internal/database/models"
+	"face/internal/redaction"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event types of the /events feed
+const (
+	eventEnroll   = "enroll"
+	eventIdentify = "identify"
+	eventVerify   = "verify"
+	eventDelete   = "delete"
+)
+
+// Event feed settings
+const (
+	// eventBuffer is how many events a slow subscriber may fall behind
+	// before further events are dropped for it
+	eventBuffer = 64
+	// eventKeepAlive is how often idle feeds get a comment, so proxies do
+	// not close them
+	eventKeepAlive = 30 * time.Second
+)
+
+// apiEvent is an event of the /events feed
+type apiEvent struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	UserID     string    `json:"user_id,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Matched    *bool     `json:"matched,omitempty"`
+	Confidence float64   `json:"confidence,omitempty"`
+	Faces      int       `json:"faces,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+
+	// userScopes are the scopes of the user, scope that of the client
+	// whose request the event is of; see visibleTo
+	userScopes models.Scopes
+	scope      string
+}
+
+// newEvent returns an event of the request of ctx about a user, or about
+// no one if user is nil
+func newEvent(ctx context.Context, typ string, user *models.User) apiEvent {
+	e := apiEvent{Type: typ, RequestID: requestIDOf(ctx), scope: requestScope(ctx)}
+	if user != nil {
+		e.UserID, e.Name, e.userScopes = user.ID, user.Name, user.Scopes
+	}
+	return e
+}
+
+// eventHub broadcasts the events of this server to the /events feeds
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan apiEvent]struct{}
+	closed      bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan apiEvent]struct{})}
+}
+
+// Publish sends an event to every subscriber, dropping it for those that
+// are too far behind
+func (h *eventHub) Publish(e apiEvent) {
+	e.Time = time.Now().UTC()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events published from now on,
+// closed when the hub is
+func (h *eventHub) Subscribe() chan apiEvent {
+	ch := make(chan apiEvent, eventBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch
+	}
+	h.subscribers[ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe stops sending events to a channel from Subscribe
+func (h *eventHub) Unsubscribe(ch chan apiEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Close ends every feed, so the server can shut down
+func (h *eventHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// redact returns the event as a client with the redactor may see it
+func (e apiEvent) redact(redactor *redaction.Redactor) apiEvent {
+	if e.UserID != "" {
+		user := redactor.User(&models.User{ID: e.UserID, Name: e.Name})
+		e.UserID, e.Name = user.ID, user.Name
+	}
+	return e
+}
+
+// visibleTo reports whether a client of scope may see the event: its user
+// must be in the scope, and its request must come from within the scope
+// or from a client above it
+func (e apiEvent) visibleTo(scope string) bool {
+	if scope == "" {
+		return true
+	}
+	if e.UserID != "" && !(&models.User{Scopes: e.userScopes}).InScope(scope) {
+		return false
+	}
+	return e.scope == "" || models.ScopeCovers(scope, e.scope) || models.ScopeCovers(e.scope, scope)
+}
+
+// streamEvents sends the events of the server as server-sent events until
+// the client disconnects, or over a WebSocket if the client asks for one.
+// Clients only get the events of their scope.
+func (s *apiServer) streamEvents(w http.ResponseWriter, r *http.Request) error {
+	if websocket.IsWebSocketUpgrade(r) {
+		return s.streamEventsWebSocket(w, r)
+	}
+
+	redactor, scope := requestRedactor(r.Context()), requestScope(r.Context())
+	rc := http.NewResponseController(w)
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return nil
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if !e.visibleTo(scope) {
+				continue
+			}
+			data, err := json.Marshal(e.redact(redactor))
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return nil
+		}
+	}
+}
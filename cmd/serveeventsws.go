@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// eventWriteTimeout bounds how long a WebSocket client of /events may take
+// to accept an event, so a stalled client does not hold its feed open
+const eventWriteTimeout = 10 * time.Second
+
+// eventUpgrader accepts WebSocket clients of /events. Browsers may only
+// connect from the origin of the server.
+var eventUpgrader = websocket.Upgrader{}
+
+// streamEventsWebSocket sends the events of the server as JSON text
+// messages over a WebSocket until the client disconnects. Clients only get
+// the events of their scope, as with server-sent events.
+func (s *apiServer) streamEventsWebSocket(w http.ResponseWriter, r *http.Request) error {
+	conn, err := eventUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has answered the client
+		return nil
+	}
+	defer conn.Close()
+
+	redactor, scope := requestRedactor(r.Context()), requestScope(r.Context())
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	// Clients send nothing but control frames; reading answers pings and
+	// notices when the client goes away
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-gone:
+			return nil
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return nil
+			}
+		case e, ok := <-events:
+			if !ok {
+				closing := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				_ = conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(eventWriteTimeout))
+				return nil
+			}
+			if !e.visibleTo(scope) {
+				continue
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteJSON(e.redact(redactor)); err != nil {
+				return nil
+			}
+		}
+	}
+}
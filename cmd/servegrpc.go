@@ -0,0 +1,385 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	facev1 "face/api/face/v1"
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/deadline"
+	"face/internal/quality"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcErrorDomain is the domain of the ErrorInfo details of gRPC errors
+const grpcErrorDomain = "face"
+
+// newGRPCServer returns the gRPC server of the API, sharing the workers,
+// keys and event feed of the REST API
+func (s *apiServer) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.MaxRecvMsgSize(uploadMaxRequest),
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	facev1.RegisterFaceServiceServer(srv, &grpcServer{api: s})
+	reflection.Register(srv)
+	return srv
+}
+
+// stopGRPC stops the gRPC server, waiting for running calls until ctx is
+// done
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// startCall does for gRPC calls what middleware does for HTTP requests:
+// assigns the request ID and checks the API key
+func (s *apiServer) startCall(ctx context.Context) (context.Context, *requestInfo, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, info := s.startRequest(ctx, firstMetadata(md, "x-request-id"))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("x-request-id", info.id))
+
+	if !s.authenticate(info, sentAPIKey(firstMetadata(md, "authorization"), firstMetadata(md, "x-api-key"))) {
+		return ctx, info, apierror.New(apierror.CodeUnauthenticated, "missing or wrong API key")
+	}
+	return ctx, info, nil
+}
+
+func (s *apiServer) unaryInterceptor(ctx context.Context, req any, call *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	started := time.Now()
+	ctx, cancel := deadline.WithTimeout(ctx, s.cfg.RequestTimeout())
+	defer cancel()
+	ctx, info, err := s.startCall(ctx)
+	var resp any
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	err = grpcError(ctx, err)
+
+	info.logger.Info("api request", "method", call.FullMethod, "code", status.Code(err).String(),
+		"duration_ms", time.Since(started).Milliseconds())
+	return resp, err
+}
+
+func (s *apiServer) streamInterceptor(srv any, stream grpc.ServerStream, call *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	started := time.Now()
+	ctx, info, err := s.startCall(stream.Context())
+	if err == nil {
+		err = handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	}
+	err = grpcError(ctx, err)
+
+	info.logger.Info("api request", "method", call.FullMethod, "code", status.Code(err).String(),
+		"duration_ms", time.Since(started).Milliseconds())
+	return err
+}
+
+// contextStream replaces the context of a stream with one carrying the
+// requestInfo
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context { return s.ctx }
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcError converts err to a gRPC status with the API error code as the
+// reason of an ErrorInfo detail. Statuses of gRPC itself, e.g. of
+// cancelled calls, are returned unchanged.
+func grpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	apiErr := reportedError(ctx, err)
+	errInfo := &errdetails.ErrorInfo{
+		Reason:   string(apiErr.Code),
+		Domain:   grpcErrorDomain,
+		Metadata: map[string]string{"request_id": requestIDOf(ctx)},
+	}
+	for key, value := range apiErr.Details {
+		errInfo.Metadata[key] = metadataValue(value)
+	}
+
+	st := status.New(codes.Code(apiErr.GRPCCode()), apiErr.Message())
+	if apiErr.Retryable() {
+		st, _ = st.WithDetails(errInfo, &errdetails.RetryInfo{RetryDelay: durationpb.New(serveRetryAfter * time.Second)})
+	} else {
+		st, _ = st.WithDetails(errInfo)
+	}
+	return st.Err()
+}
+
+// metadataValue formats an error detail as error metadata, lists as their
+// comma-separated items
+func metadataValue(value any) string {
+	list, ok := value.([]any)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// grpcServer implements the gRPC API with the operations of the REST API
+type grpcServer struct {
+	facev1.UnimplementedFaceServiceServer
+	api *apiServer
+}
+
+func (g *grpcServer) EnrollUser(ctx context.Context, req *facev1.EnrollUserRequest) (*facev1.User, error) {
+	if err := requireRole(ctx, config.APIKeyWrite); err != nil {
+		return nil, err
+	}
+	user := newEnrollUser()
+	user.Name = req.GetName()
+	user.Email = req.GetEmail()
+	user.Phone = req.GetPhone()
+	user.CardNumber = req.GetCardNumber()
+	user.Badge = req.GetBadge()
+	if req.GetMetadata() != nil {
+		user.Metadata = req.GetMetadata().AsMap()
+	}
+	if req.GetExpiresIn() != nil {
+		expiresIn := req.GetExpiresIn().AsDuration()
+		if req.GetExpiresIn().CheckValid() != nil || expiresIn <= 0 {
+			return nil, badRequest("expires_in must be a positive duration")
+		}
+		expiresAt := time.Now().Add(expiresIn)
+		user.ExpiresAt = &expiresAt
+	}
+
+	images := make([]uploadedImage, len(req.GetImages()))
+	for i, img := range req.GetImages() {
+		filename := img.GetFilename()
+		if filename == "" {
+			filename = fmt.Sprintf("image %d", i+1)
+		}
+		images[i] = bytesImage(filename, img.GetData())
+	}
+
+	enrolled, err := g.api.enrollUser(ctx, user, images, req.GetForce())
+	if err != nil {
+		return nil, err
+	}
+	return protoUser(enrolled), nil
+}
+
+func (g *grpcServer) Identify(ctx context.Context, req *facev1.IdentifyRequest) (*facev1.Identification, error) {
+	threshold, err := g.threshold(ctx, req.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	image, err := protoImage(req.GetImage())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := g.api.identifyImage(ctx, image, threshold, req.GetRequireLiveness() || g.api.cfg.RequireLiveness)
+	if err != nil {
+		return nil, err
+	}
+	return protoIdentification(resp), nil
+}
+
+// IdentifyStream identifies the images of a stream one after another. A
+// failed image is reported in its result; the stream goes on.
+func (g *grpcServer) IdentifyStream(stream facev1.FaceService_IdentifyStreamServer) error {
+	ctx := stream.Context()
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		result := &facev1.IdentifyResult{Id: req.GetId()}
+		if resp, err := g.Identify(ctx, req); err != nil {
+			apiErr := reportedError(ctx, err)
+			details, _ := structpb.NewStruct(apiErr.Details)
+			result.Result = &facev1.IdentifyResult_Error{Error: &facev1.Error{
+				Code:      string(apiErr.Code),
+				Message:   apiErr.Message(),
+				Retryable: apiErr.Retryable(),
+				Details:   details,
+			}}
+		} else {
+			result.Result = &facev1.IdentifyResult_Identification{Identification: resp}
+		}
+		if err := stream.Send(result); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *grpcServer) Verify(ctx context.Context, req *facev1.VerifyRequest) (*facev1.Verification, error) {
+	threshold, err := g.threshold(ctx, req.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetUserId() == "" {
+		return nil, missingField("user_id")
+	}
+	image, err := protoImage(req.GetImage())
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := g.api.verifyImage(ctx, req.GetUserId(), image, threshold, req.GetCode(), req.GetRequireLiveness() || g.api.cfg.RequireLiveness)
+	if err != nil {
+		return nil, err
+	}
+	return &facev1.Verification{
+		Verified:   v.Verified,
+		UserId:     v.UserID,
+		Confidence: v.Confidence,
+		Threshold:  v.Threshold,
+		Quality:    v.Quality,
+		SpoofScore: v.SpoofScore,
+		Reason:     v.Reason,
+		Hints:      protoHints(v.Hints),
+	}, nil
+}
+
+func (g *grpcServer) ListUsers(ctx context.Context, req *facev1.ListUsersRequest) (*facev1.ListUsersResponse, error) {
+	users, err := g.api.findUsers(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	resp := &facev1.ListUsersResponse{Users: make([]*facev1.User, len(users))}
+	for i, u := range users {
+		resp.Users[i] = protoUser(u)
+	}
+	return resp, nil
+}
+
+// threshold returns the threshold of a request, the default if it is not
+// set; see requestThreshold
+func (g *grpcServer) threshold(ctx context.Context, t *float64) (float64, error) {
+	if t == nil {
+		return g.api.cfg.DefaultThreshold, nil
+	}
+	if *t < 0 || *t > 1 {
+		return 0, badRequest("threshold must be between 0 and 1")
+	}
+	return clampThreshold(ctx, *t, g.api.cfg.DefaultThreshold), nil
+}
+
+// protoImage returns the data of a required image field
+func protoImage(img *facev1.Image) (io.ReadSeeker, error) {
+	if len(img.GetData()) == 0 {
+		return nil, missingField("image")
+	}
+	return bytes.NewReader(img.GetData()), nil
+}
+
+func protoUser(u *apiUser) *facev1.User {
+	user := &facev1.User{
+		Id:         u.ID,
+		Name:       u.Name,
+		Email:      u.Email,
+		Phone:      u.Phone,
+		CardNumber: u.CardNumber,
+		Badge:      u.Badge,
+		CreatedAt:  protoTime(u.CreatedAt),
+		UpdatedAt:  protoTime(u.UpdatedAt),
+	}
+	if len(u.Metadata) > 0 {
+		user.Metadata, _ = structpb.NewStruct(u.Metadata)
+	}
+	if u.ExpiresAt != nil {
+		user.ExpiresAt = timestamppb.New(*u.ExpiresAt)
+	}
+	for _, f := range u.Faces {
+		user.Faces = append(user.Faces, &facev1.Face{
+			Id:           f.ID,
+			QualityScore: f.QualityScore,
+			EnrolledAt:   protoTime(f.EnrolledAt),
+			Label:        f.Label,
+			Primary:      f.Primary,
+		})
+	}
+	return user
+}
+
+func protoIdentification(resp *apiIdentification) *facev1.Identification {
+	ident := &facev1.Identification{
+		Matched:    resp.Matched,
+		FaceId:     resp.FaceID,
+		Confidence: resp.Confidence,
+		Threshold:  resp.Threshold,
+		Quality:    resp.Quality,
+		SpoofScore: resp.SpoofScore,
+		Box: &facev1.Box{
+			XMin: int32(resp.Box.XMin),
+			YMin: int32(resp.Box.YMin),
+			XMax: int32(resp.Box.XMax),
+			YMax: int32(resp.Box.YMax),
+		},
+		Enriched: resp.Enriched,
+		Hints:    protoHints(resp.Hints),
+	}
+	if resp.User != nil {
+		ident.User = protoUser(resp.User)
+	}
+	for _, c := range resp.Candidates {
+		ident.Candidates = append(ident.Candidates, &facev1.Candidate{UserId: c.UserID, Name: c.Name, Confidence: c.Confidence})
+	}
+	return ident
+}
+
+func protoHints(hints []quality.Hint) []*facev1.QualityHint {
+	var list []*facev1.QualityHint
+	for _, h := range hints {
+		list = append(list, &facev1.QualityHint{Code: h.Code, Message: h.Message})
+	}
+	return list
+}
+
+// protoTime converts a time, leaving zero times unset
+func protoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
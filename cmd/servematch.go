@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// match matches the face of the uploaded image against the gallery sent
+// with the request. The database is not used and nothing is stored or
+// published to /events.
+func (s *apiServer) match(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	threshold, err := formThreshold(r, s.cfg.DefaultThreshold)
+	if err != nil {
+		return err
+	}
+	data, err := formData(r, "gallery")
+	if err != nil {
+		return err
+	}
+	candidates, err := parseMatchGallery(data)
+	if err != nil {
+		return err
+	}
+	file, err := formImage(r, "image")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	resp, err := s.matchImage(r.Context(), file, candidates, threshold)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+// formData returns a form field sent as a file or as a value, such as the
+// gallery of a match request
+func formData(r *http.Request, field string) ([]byte, error) {
+	if file, _, err := r.FormFile(field); err == nil {
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+	if v := r.FormValue(field); v != "" {
+		return []byte(v), nil
+	}
+	return nil, missingField(field)
+}
+
+// matchImage detects the face of an image with a worker and matches it
+// against a supplied gallery
+func (s *apiServer) matchImage(ctx context.Context, file io.ReadSeeker, candidates []matchCandidate, threshold float64) (*apiMatch, error) {
+	fs, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := processUpload(fs, file)
+	s.pool.Release(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := matchGallery(probe, candidates, threshold, s.fs.Strategy)
+	if err != nil {
+		return nil, err
+	}
+	requestLogger(ctx).Info("gallery match", "matched", resp.Matched, "candidates", len(candidates),
+		"confidence", resp.Confidence, "threshold", threshold)
+	return resp, nil
+}
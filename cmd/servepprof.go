@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"face/config"
+)
+
+// pprofHandlers are the Go profiler endpoints of serve --pprof
+var pprofHandlers = map[string]http.HandlerFunc{
+	"/debug/pprof/":        pprof.Index,
+	"/debug/pprof/cmdline": pprof.Cmdline,
+	"/debug/pprof/profile": pprof.Profile,
+	"/debug/pprof/symbol":  pprof.Symbol,
+	"/debug/pprof/trace":   pprof.Trace,
+}
+
+// pprofRoutes serves the Go profiler under /debug/pprof/. Profiles, stacks
+// and the command line reveal the server's internals, so only clients with
+// an admin key get them. Profiles run for as long as the client asks, so
+// they are not bound by the request timeout.
+func (s *apiServer) pprofRoutes(mux *http.ServeMux) {
+	for path, h := range pprofHandlers {
+		mux.HandleFunc("GET "+path, s.handleStream(adminOnly(h)))
+	}
+}
+
+// adminOnly wraps a plain handler, refusing clients whose API key is not
+// an admin key
+func adminOnly(h http.HandlerFunc) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := requireRole(r.Context(), config.APIKeyAdmin); err != nil {
+			return err
+		}
+		h(w, r)
+		return nil
+	}
+}
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+
+	"face/internal/apierror"
+	"face/internal/database/models"
+	"face/internal/gallery"
+	"face/internal/redaction"
+	"face/internal/storage"
+)
+
+// listUsers returns every user in the client's scope, or those named by the
+// name parameter
+func (s *apiServer) listUsers(w http.ResponseWriter, r *http.Request) error {
+	list, err := s.findUsers(r.Context(), r.URL.Query().Get("name"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"users": list})
+	return nil
+}
+
+// findUsers returns every user in the client's scope, or those with the
+// name if it is not empty, as the client may see them
+func (s *apiServer) findUsers(ctx context.Context, name string) ([]*apiUser, error) {
+	var (
+		users []models.User
+		err   error
+	)
+	if name != "" {
+		users, err = s.db(ctx).ListUsersByName(name)
+	} else {
+		users, err = s.db(ctx).ListUsers()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	list := make([]*apiUser, 0, len(users))
+	for i := range users {
+		if users[i].InScope(requestScope(ctx)) {
+			list = append(list, newAPIUser(requestRedactor(ctx), &users[i], true))
+		}
+	}
+	return list, nil
+}
+
+// scopedUser retrieves the user with the ID of the request path, reporting
+// users outside the client's scope as not found
+func (s *apiServer) scopedUser(r *http.Request) (*models.User, error) {
+	return s.userInScope(r.Context(), r.PathValue("id"))
+}
+
+// userInScope retrieves a user, reporting users outside the scope of the
+// client of ctx as not found
+func (s *apiServer) userInScope(ctx context.Context, id string) (*models.User, error) {
+	user, err := s.db(ctx).GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.InScope(requestScope(ctx)) {
+		return nil, models.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *apiServer) getUser(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.scopedUser(r)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newAPIUser(requestRedactor(r.Context()), user, true))
+	return nil
+}
+
+// deleteUser deletes a user with their images. Unlike 'face delete', this
+// cannot be undone.
+func (s *apiServer) deleteUser(w http.ResponseWriter, r *http.Request) (err error) {
+	defer func() {
+		s.audit(r.Context(), models.AuditEvent{Operation: models.AuditDelete, UserID: r.PathValue("id")}, err)
+	}()
+
+	user, err := s.scopedUser(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db(r.Context()).SoftDeleteUser(user.ID); err != nil {
+		return fmt.Errorf("failed to mark user deleted: %w", err)
+	}
+	s.index.refresh(user.ID)
+	if err := finalizeUserDeletion(s.fs.DB, s.fs.Storage, user); err != nil {
+		return err
+	}
+	forgetMQTTPerson(s.cfg, user.ID)
+
+	requestLogger(r.Context()).Info("user deleted", "user_id", user.ID)
+	s.events.Publish(newEvent(r.Context(), eventDelete, user))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// avatar returns the user's avatar as JPEG, without the provenance
+// metadata of the stored image
+func (s *apiServer) avatar(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.scopedUser(r)
+	if err != nil {
+		return err
+	}
+
+	img, err := loadAvatar(s.db(r.Context()), s.fs.Storage, user)
+	if errors.Is(err, errNoAvatar) {
+		return apierror.Wrap(apierror.CodeNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: storage.JPEGQuality}); err != nil {
+		return fmt.Errorf("failed to encode avatar: %w", err)
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}
+
+func (s *apiServer) listUserFaces(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.scopedUser(r)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"faces": newAPIFaces(user.Faces)})
+	return nil
+}
+
+// addUserFaces adds the faces of every uploaded image to a user. Either
+// every image is added or none is.
+func (s *apiServer) addUserFaces(w http.ResponseWriter, r *http.Request) (err error) {
+	defer func() {
+		s.audit(r.Context(), models.AuditEvent{Operation: models.AuditEnroll, UserID: r.PathValue("id")}, err)
+	}()
+
+	user, err := s.scopedUser(r)
+	if err != nil {
+		return err
+	}
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	if r.MultipartForm == nil || len(r.MultipartForm.File) == 0 {
+		return badRequest("no image uploaded")
+	}
+
+	fs, err := s.pool.Acquire(r.Context())
+	if err != nil {
+		return err
+	}
+	defer s.pool.Release(fs)
+
+	faces, err := saveUploadedFaces(fs, user.ID, formImages(r.MultipartForm))
+	if err != nil {
+		return err
+	}
+	if err := addFaces(fs, user.ID, faces); err != nil {
+		discardFaces(fs, faces)
+		return err
+	}
+	s.index.refresh(user.ID)
+	refreshAvatar(fs.DB, fs.Storage, user.ID)
+
+	requestLogger(r.Context()).Info("faces added", "user_id", user.ID, "faces", len(faces))
+	event := newEvent(r.Context(), eventEnroll, user)
+	event.Faces = len(faces)
+	s.events.Publish(event)
+	writeJSON(w, http.StatusCreated, map[string]any{"faces": newAPIFaces(faces)})
+	return nil
+}
+
+// deleteUserFace removes one of a user's faces and its image
+func (s *apiServer) deleteUserFace(w http.ResponseWriter, r *http.Request) (err error) {
+	defer func() {
+		s.audit(r.Context(), models.AuditEvent{Operation: models.AuditRemoveFace, UserID: r.PathValue("id")}, err)
+	}()
+
+	user, err := s.scopedUser(r)
+	if err != nil {
+		return err
+	}
+
+	var removed *models.Face
+	for i := range user.Faces {
+		if user.Faces[i].ID == r.PathValue("face_id") {
+			removed = &user.Faces[i]
+		}
+	}
+	if removed == nil {
+		return apierror.New(apierror.CodeNotFound, "face not found")
+	}
+
+	if err := s.db(r.Context()).RemoveFace(user.ID, removed.ID); err != nil {
+		return fmt.Errorf("failed to remove face from database: %w", err)
+	}
+	s.index.refresh(user.ID)
+	if err := s.fs.Storage.DeleteImage(removed.Filename); err != nil {
+		requestLogger(r.Context()).Warn("failed to delete image file", "filename", removed.Filename, "error", err)
+	}
+	refreshAvatar(s.fs.DB, s.fs.Storage, user.ID)
+
+	requestLogger(r.Context()).Info("face removed", "user_id", user.ID, "face_id", removed.ID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *apiServer) gallerySnapshot(w http.ResponseWriter, r *http.Request) error {
+	bundle, err := gallerySnapshot(s.db(r.Context()), requestScope(r.Context()))
+	if err != nil {
+		return err
+	}
+	return writeBundleResponse(w, redactBundle(requestRedactor(r.Context()), bundle))
+}
+
+// galleryDelta returns the users changed since the revision in the since
+// parameter
+func (s *apiServer) galleryDelta(w http.ResponseWriter, r *http.Request) error {
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		return badRequest("since must be a revision number")
+	}
+
+	bundle, err := galleryDelta(s.db(r.Context()), since, requestScope(r.Context()))
+	if err != nil {
+		return err
+	}
+	return writeBundleResponse(w, redactBundle(requestRedactor(r.Context()), bundle))
+}
+
+// redactBundle hides what the redactor does not allow in the entries of a
+// bundle. Embeddings are kept, as devices need them to match.
+func redactBundle(redactor *redaction.Redactor, bundle *gallery.Bundle) *gallery.Bundle {
+	for i := range bundle.Entries {
+		e := &bundle.Entries[i]
+		user := redactor.User(&models.User{ID: e.UserID, Name: e.Name})
+		e.UserID, e.Name = user.ID, user.Name
+		for j := range e.Faces {
+			e.Faces[j].ID = redactor.FaceID(e.Faces[j].ID)
+		}
+	}
+	return bundle
+}
+
+// writeBundleResponse sends a gallery bundle, encoded in full first so an
+// error can still be reported
+func writeBundleResponse(w http.ResponseWriter, bundle *gallery.Bundle) error {
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}
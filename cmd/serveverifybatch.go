@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"face/internal/apierror"
+	"face/internal/database/models"
+)
+
+// verifyBatch verifies the pairs of a CSV sent as the pairs field, each
+// row a user ID and the form field of an uploaded image, on as many
+// workers as are idle. Pairs do not publish to /events, notify on failure
+// or check step-up rules; each is audited. With require_liveness, a face
+// that scores as a spoof fails its pair.
+func (s *apiServer) verifyBatch(w http.ResponseWriter, r *http.Request) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	threshold, err := s.requestThreshold(r)
+	if err != nil {
+		return err
+	}
+	requireLiveness, err := formBool(r, "require_liveness")
+	if err != nil {
+		return err
+	}
+	data, err := formData(r, "pairs")
+	if err != nil {
+		return err
+	}
+	pairs, err := parseVerifyPairs(bytes.NewReader(data))
+	if err != nil {
+		return badRequest("%v", err)
+	}
+	if len(pairs) == 0 {
+		return badRequest("no pairs")
+	}
+	if len(pairs) > maxVerifyBatchPairs {
+		return apierror.New(apierror.CodeTooLarge, "%d pairs, at most %d are allowed", len(pairs), maxVerifyBatchPairs).
+			WithDetail("max_pairs", maxVerifyBatchPairs)
+	}
+
+	verifier := &pairVerifier{pool: s.pool, threshold: threshold, scope: requestScope(r.Context()), open: func(image string) (io.ReadSeekCloser, error) {
+		return formImage(r, image)
+	}}
+	if requireLiveness || s.cfg.RequireLiveness {
+		verifier.liveness = s.cfg
+	}
+	report, err := verifier.run(r.Context(), pairs)
+	if err != nil {
+		return err
+	}
+
+	for i := range report.Results {
+		event := models.AuditEvent{Operation: models.AuditVerify, UserID: report.Results[i].UserID}
+		setPairAuditResult(&event, &report.Results[i])
+		s.audit(r.Context(), event, nil)
+	}
+	redactPairResults(requestRedactor(r.Context()), report.Results)
+
+	requestLogger(r.Context()).Info("batch verification", "pairs", report.Pairs, "verified", report.Verified,
+		"not_verified", report.NotVerified, "errors", report.Errors, "threshold", threshold)
+	writeJSON(w, http.StatusOK, report)
+	return nil
+}
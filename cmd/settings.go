@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"face/config"
+	"face/internal/database/models"
+	"face/matching"
+
+	"github.com/spf13/cobra"
+)
+
+func NewSettingsCmd(cfg *config.Config) *cobra.Command {
+	var formatJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "settings",
+		Short: "Show or change settings stored in the database",
+		Long: `Show the settings stored in the database and shared by every installation
+using it. Use 'face settings set' to change them.`,
+		Example: `  face settings
+  face settings --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runSettingsShow(cfg, formatJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	cmd.AddCommand(newSettingsSetCmd(cfg))
+
+	return cmd
+}
+
+func newSettingsSetCmd(cfg *config.Config) *cobra.Command {
+	var (
+		cropSize        int
+		maxFaces        int
+		matchThreshold  float64
+		faceLimitPolicy string
+		duplicateNames  string
+		matchStrategy   string
+	)
+
+	cmd := &cobra.Command{
+		Use:         "set",
+		Short:       "Change settings",
+		Annotations: recordAlways(),
+		Long: `Change settings stored in the database. Only the given flags are changed.
+
+--crop-size resizes every face crop to a square of that many pixels before it
+is saved and embedded, so stored crops are uniform and re-embedding them after
+a model change gives the same input as enrollment did. Faces enrolled before
+the change keep their original crops; 0 disables resizing.
+
+--face-limit-policy decides what happens when a face is added to a user who
+already has --max-faces faces:
+  - reject: adding fails (default)
+  - evict-lowest-quality: the face with the lowest quality is replaced
+  - evict-oldest: the face enrolled first is replaced
+
+--duplicate-name-policy decides what happens when a user is enrolled under a
+name another user already has:
+  - allow: the user is enrolled (default)
+  - warn: enrollment fails unless --force (or force=true over the API) is given
+  - reject: enrollment fails
+
+--match-strategy decides how a user's faces are combined into their
+similarity to a probe by identify, verify and the servers:
+  - best: the similarity of their closest face (default)
+  - average: the similarity of the mean of their embeddings, which evens out
+    faces of poor quality when users have many
+  - vote: the 5 faces closest to the probe across the gallery vote for their
+    users; the user with the most votes wins, scored by the mean similarity
+    of their voting faces, so one lookalike face does not outrank a user
+    whose faces agree in large galleries
+
+Which is most accurate depends on the model and the gallery: try them on
+known images with the global --match-strategy flag, which (like
+match_strategy in the config) overrides the stored strategy for one run,
+before storing one. Running servers keep the strategy they started with.`,
+		Example: `  face settings set --crop-size 160
+  face settings set --max-faces 20
+  face settings set --face-limit-policy evict-oldest
+  face settings set --duplicate-name-policy warn
+  face settings set --match-strategy average`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			settings := models.Settings{
+				CropSize:            cropSize,
+				MaxFacesPerUser:     maxFaces,
+				MatchThreshold:      matchThreshold,
+				FaceLimitPolicy:     models.FaceLimitPolicy(faceLimitPolicy),
+				DuplicateNamePolicy: models.DuplicateNamePolicy(duplicateNames),
+				MatchStrategy:       matching.Strategy(matchStrategy),
+			}
+			return runSettingsSet(cfg, cmd, &settings)
+		},
+	}
+
+	cmd.Flags().IntVar(&cropSize, "crop-size", 0, fmt.Sprintf("face crop size in pixels, %d-%d (0 = native size)", models.MinCropSize, models.MaxCropSize))
+	cmd.Flags().IntVar(&maxFaces, "max-faces", 0, "maximum faces per user")
+	cmd.Flags().Float64Var(&matchThreshold, "match-threshold", 0, "stored match threshold (0.0-1.0)")
+	cmd.Flags().StringVar(&faceLimitPolicy, "face-limit-policy", "", "when a user has max faces: reject, evict-lowest-quality, evict-oldest")
+	cmd.Flags().StringVar(&duplicateNames, "duplicate-name-policy", "", "when enrolling a name another user has: allow, warn, reject")
+	cmd.Flags().StringVar(&matchStrategy, "match-strategy", "", "how users' faces are scored: best, average, vote")
+
+	return cmd
+}
+
+func runSettingsShow(cfg *config.Config, formatJSON bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	printSettings(settings)
+	return nil
+}
+
+// settingsFlags lists the flags of 'face settings set'
+var settingsFlags = []string{"crop-size", "max-faces", "match-threshold", "face-limit-policy", "duplicate-name-policy", "match-strategy"}
+
+// runSettingsSet applies the fields of changes whose flags were given
+func runSettingsSet(cfg *config.Config, cmd *cobra.Command, changes *models.Settings) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	settings, err := db.GetSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	flags := cmd.Flags()
+	changed := false
+	for _, name := range settingsFlags {
+		changed = changed || flags.Changed(name)
+	}
+	if !changed {
+		fmt.Println("No changes specified. Use --help to see available options.")
+		return nil
+	}
+
+	if flags.Changed("crop-size") {
+		settings.CropSize = changes.CropSize
+	}
+	if flags.Changed("max-faces") {
+		settings.MaxFacesPerUser = changes.MaxFacesPerUser
+	}
+	if flags.Changed("match-threshold") {
+		settings.MatchThreshold = changes.MatchThreshold
+	}
+	if flags.Changed("face-limit-policy") {
+		settings.FaceLimitPolicy = changes.FaceLimitPolicy
+	}
+	if flags.Changed("duplicate-name-policy") {
+		settings.DuplicateNamePolicy = changes.DuplicateNamePolicy
+	}
+	if flags.Changed("match-strategy") {
+		settings.MatchStrategy = changes.MatchStrategy
+	}
+
+	if err := settings.Validate(); err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+
+	if err := db.UpdateSettings(settings); err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Settings updated")
+	printSettings(settings)
+	return nil
+}
+
+func printSettings(settings *models.Settings) {
+	faceLimitPolicy, err := models.ParseFaceLimitPolicy(string(settings.FaceLimitPolicy))
+	if err != nil {
+		faceLimitPolicy = settings.FaceLimitPolicy
+	}
+	duplicateNamePolicy, err := models.ParseDuplicateNamePolicy(string(settings.DuplicateNamePolicy))
+	if err != nil {
+		duplicateNamePolicy = settings.DuplicateNamePolicy
+	}
+	matchStrategy, err := matching.ParseStrategy(string(settings.MatchStrategy))
+	if err != nil {
+		matchStrategy = settings.MatchStrategy
+	}
+
+	cropSize := "native"
+	if settings.CropSize > 0 {
+		cropSize = fmt.Sprintf("%dx%d", settings.CropSize, settings.CropSize)
+	}
+
+	fmt.Println("\nSettings:")
+	fmt.Println("─────────────────────────────────────")
+	fmt.Printf("  Match threshold:     %.3g\n", settings.MatchThreshold)
+	fmt.Printf("  Max faces per user:  %d\n", settings.MaxFacesPerUser)
+	fmt.Printf("  Embedding dimension: %d\n", settings.EmbeddingDimension)
+	if settings.EmbeddingModel != "" {
+		fmt.Printf("  Embedding model:     %s\n", settings.EmbeddingModel)
+	}
+	fmt.Printf("  Crop size:           %s\n", cropSize)
+	fmt.Printf("  Face limit policy:   %s\n", faceLimitPolicy)
+	fmt.Printf("  Duplicate names:     %s\n", duplicateNamePolicy)
+	fmt.Printf("  Match strategy:      %s\n", matchStrategy)
+}
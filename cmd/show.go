@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func NewShowCmd(cfg *config.Config) *cobra.Command {
+	var (
+		userID     string
+		avatarPath string
+		formatJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the details of a user",
+		Long: `Show a user and their enrolled faces, primary face first.
+
+With --avatar, the user's avatar is written to a file: a standardized
+square crop of their primary face, or of their best quality face if none
+is primary. Avatars are regenerated whenever the user's faces change. The
+file is written as PNG if its name ends in .png and as JPEG otherwise.`,
+		Example: `  face show --id abc-123
+  face show --id abc-123 --avatar avatar.jpg
+  face show --id abc-123 --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runShow(cfg, userID, avatarPath, formatJSON)
+		},
+	}
+
+	cmd.Flags().StringVar(&userID, "id", "", "user ID or unique prefix to show (required)")
+	cmd.Flags().StringVar(&avatarPath, "avatar", "", "write the user's avatar to this file")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+	_ = cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func runShow(cfg *config.Config, userID, avatarPath string, formatJSON bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	user, err := database.GetUserByIDPrefix(db, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	models.SortFaces(user.Faces)
+
+	if avatarPath != "" {
+		stor, err := cfg.GetStorage(db)
+		if err != nil {
+			return fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		if err := writeAvatar(db, stor, user, avatarPath); err != nil {
+			return err
+		}
+	}
+
+	factors := secondFactors(user)
+	user.ClearSecrets()
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(user, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	printUser(user, factors)
+	if avatarPath != "" {
+		fmt.Printf("\n✓ Avatar written to %s\n", avatarPath)
+	}
+	return nil
+}
+
+func printUser(user *models.User, factors string) {
+	fmt.Printf("\n%s\n", user.Name)
+	fmt.Printf("  ID:         %s\n", user.ID)
+	if user.Email != "" {
+		fmt.Printf("  Email:      %s\n", user.Email)
+	}
+	if user.Phone != "" {
+		fmt.Printf("  Phone:      %s\n", user.Phone)
+	}
+	if user.Badge != "" {
+		fmt.Printf("  Badge:      %s\n", user.Badge)
+	}
+	if user.CardNumber != "" {
+		fmt.Printf("  Card:       %s\n", user.CardNumber)
+	}
+	if user.IsVisitor() {
+		fmt.Printf("  Visitor:    %s\n", visitorStatus(user))
+	}
+	if factors != "" {
+		fmt.Printf("  2nd factor: %s\n", factors)
+	}
+	if len(user.Scopes) > 0 {
+		fmt.Printf("  Scopes:     %s\n", strings.Join(user.Scopes, ", "))
+	}
+	fmt.Printf("  Created:    %s\n", user.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Updated:    %s\n", user.UpdatedAt.Format("2006-01-02 15:04:05"))
+
+	if len(user.Metadata) > 0 {
+		fmt.Println("  Metadata:")
+		for key, value := range user.Metadata {
+			fmt.Printf("    %s: %v\n", key, value)
+		}
+	}
+
+	fmt.Printf("  Faces:      %d\n", len(user.Faces))
+	for i := range user.Faces {
+		f := &user.Faces[i]
+		fmt.Printf("    • %s\n", describeFace(f))
+		fmt.Printf("      quality %.2f, enrolled %s\n", f.QualityScore, f.EnrolledAt.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// writeAvatar writes the user's avatar to path, generating it first if it
+// has not been stored yet
+func writeAvatar(db database.Database, stor storage.Storage, user *models.User, path string) error {
+	img, err := loadAvatar(db, stor, user)
+	if err != nil {
+		return err
+	}
+	return writeImageFile(path, img)
+}
+
+// loadAvatar loads the user's avatar, generating it first if it has not
+// been stored yet
+func loadAvatar(db database.Database, stor storage.Storage, user *models.User) (image.Image, error) {
+	filename := user.Avatar
+	if filename == "" || !stor.Exists(filename) {
+		var err error
+		filename, err = generateAvatar(db, stor, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if filename == "" {
+			return nil, errNoAvatar
+		}
+		user.Avatar = filename
+	}
+
+	img, err := stor.LoadImage(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load avatar: %w", err)
+	}
+	return img, nil
+}
+
+// writeImageFile writes img to path as PNG or JPEG depending on the
+// extension
+func writeImageFile(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := encodeImageFile(file, img, path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// encodeImageFile encodes img as PNG or JPEG depending on the extension of
+// path
+func encodeImageFile(w io.Writer, img image.Image, path string) error {
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		return png.Encode(w, img)
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 95})
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"face/config"
+	"face/internal/database/models"
+
+	"github.com/spf13/cobra"
+)
+
+func NewStatsCmd(cfg *config.Config) *cobra.Command {
+	var (
+		staleAfterDays int
+		formatJSON     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show gallery statistics and users due for re-enrollment",
+		Long: `Show how many users and faces are enrolled, their quality and age, and
+list the users whose newest face is older than the staleness threshold.
+
+Faces drift from how people look as the years pass, and matches against
+them get less confident. Adding a recent photo of the listed users with
+'face update --add-face' keeps them identified reliably.
+
+The threshold is stale_after_days in the config file
+(FACE_CLI_STALE_AFTER_DAYS), 730 days unless set, or --stale-after-days.`,
+		Example: `  face stats
+  face stats --stale-after-days 365
+  face stats --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			staleAfter := cfg.StaleAfter()
+			if cmd.Flags().Changed("stale-after-days") {
+				if staleAfterDays <= 0 {
+					return fmt.Errorf("--stale-after-days must be positive")
+				}
+				staleAfter = time.Duration(staleAfterDays) * 24 * time.Hour
+			}
+			return runStats(cfg, staleAfter, formatJSON)
+		},
+	}
+
+	cmd.Flags().IntVar(&staleAfterDays, "stale-after-days", 0, "list users whose newest face is older than this many days (default: stale_after_days)")
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+// galleryStats summarizes the enrolled users and faces
+type galleryStats struct {
+	Users          int        `json:"users"`
+	Faces          int        `json:"faces"`
+	FacesPerUser   float64    `json:"faces_per_user"`
+	AverageQuality float64    `json:"average_quality"`
+	OldestFace     *time.Time `json:"oldest_face,omitempty"`
+	NewestFace     *time.Time `json:"newest_face,omitempty"`
+	// DecayHalfLifeDays is the half-life of the confidence decay, 0 if
+	// there is none
+	DecayHalfLifeDays int         `json:"decay_half_life_days"`
+	StaleAfterDays    int         `json:"stale_after_days"`
+	Stale             []staleUser `json:"stale"`
+}
+
+// staleUser is a user whose newest face is older than the staleness
+// threshold
+type staleUser struct {
+	UserID     string    `json:"user_id"`
+	Name       string    `json:"name"`
+	Faces      int       `json:"faces"`
+	NewestFace time.Time `json:"newest_face"`
+	AgeDays    int       `json:"age_days"`
+}
+
+func runStats(cfg *config.Config, staleAfter time.Duration, formatJSON bool) error {
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	stats := collectGalleryStats(users, staleAfter, time.Now())
+	stats.DecayHalfLifeDays = max(cfg.DecayHalfLifeDays, 0)
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+
+	printGalleryStats(cfg, stats)
+	return nil
+}
+
+// collectGalleryStats counts the faces of the users and finds those whose
+// newest face is older than staleAfter, oldest first
+func collectGalleryStats(users []models.User, staleAfter time.Duration, now time.Time) *galleryStats {
+	stats := &galleryStats{Users: len(users), StaleAfterDays: int(staleAfter.Hours() / 24), Stale: []staleUser{}}
+	var qualitySum float64
+	for i := range users {
+		var newest time.Time
+		for _, f := range users[i].Faces {
+			stats.Faces++
+			qualitySum += f.QualityScore
+			if stats.OldestFace == nil || f.EnrolledAt.Before(*stats.OldestFace) {
+				stats.OldestFace = &f.EnrolledAt
+			}
+			if stats.NewestFace == nil || f.EnrolledAt.After(*stats.NewestFace) {
+				stats.NewestFace = &f.EnrolledAt
+			}
+			if f.EnrolledAt.After(newest) {
+				newest = f.EnrolledAt
+			}
+		}
+
+		age := now.Sub(newest)
+		if len(users[i].Faces) > 0 && age > staleAfter {
+			stats.Stale = append(stats.Stale, staleUser{
+				UserID:     users[i].ID,
+				Name:       users[i].Name,
+				Faces:      len(users[i].Faces),
+				NewestFace: newest,
+				AgeDays:    int(age.Hours() / 24),
+			})
+		}
+	}
+
+	if stats.Users > 0 {
+		stats.FacesPerUser = float64(stats.Faces) / float64(stats.Users)
+	}
+	if stats.Faces > 0 {
+		stats.AverageQuality = qualitySum / float64(stats.Faces)
+	}
+	sort.SliceStable(stats.Stale, func(i, j int) bool { return stats.Stale[i].NewestFace.Before(stats.Stale[j].NewestFace) })
+	return stats
+}
+
+func printGalleryStats(cfg *config.Config, stats *galleryStats) {
+	const date = "2006-01-02"
+
+	fmt.Println("\nGallery")
+	fmt.Println("─────────────────────────────────────")
+	fmt.Printf("Users:            %d\n", stats.Users)
+	fmt.Printf("Faces:            %d (%.1f per user)\n", stats.Faces, stats.FacesPerUser)
+	if stats.Faces > 0 {
+		fmt.Printf("Average quality:  %.2f\n", stats.AverageQuality)
+		fmt.Printf("Oldest face:      %s\n", stats.OldestFace.Format(date))
+		fmt.Printf("Newest face:      %s\n", stats.NewestFace.Format(date))
+	}
+	if decay := cfg.ConfidenceDecay(); decay.Enabled() {
+		fmt.Printf("Confidence decay: half-life %d days, up to %.0f%%\n", stats.DecayHalfLifeDays, decay.Max*100)
+	} else {
+		fmt.Println("Confidence decay: off")
+	}
+
+	fmt.Printf("\nStale enrollments (newest face older than %d days)\n", stats.StaleAfterDays)
+	fmt.Println("─────────────────────────────────────")
+	if len(stats.Stale) == 0 {
+		fmt.Println("✓ None")
+		return
+	}
+	for _, s := range stats.Stale {
+		fmt.Printf("⚠ %s (%s): %d face(s), newest %s (%d days ago)\n", s.Name, s.UserID, s.Faces, s.NewestFace.Format(date), s.AgeDays)
+	}
+	fmt.Printf("\n%d user(s) should be re-enrolled: add a recent photo with 'face update --id <id> --add-face photo.jpg'\n", len(stats.Stale))
+}
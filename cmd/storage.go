@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+func NewStorageCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "storage",
+		Short: "Face image storage commands",
+		Long:  `Manage how face images are laid out on disk.`,
+	}
+
+	cmd.AddCommand(newStorageMigrateLayoutCmd(cfg))
+
+	return cmd
+}
+
+func newStorageMigrateLayoutCmd(cfg *config.Config) *cobra.Command {
+	var (
+		to     string
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:         "migrate-layout",
+		Short:       "Move existing images to another storage layout",
+		Annotations: recordWith("!dry-run"),
+		Long: `Move every stored face image to the given layout and update the database
+to point at the new location. Images are found through the database, so the
+faces directory is never scanned.
+
+Layouts:
+  - flat: all images directly in the faces directory
+  - sharded: faces/ab/cd/<hash>.jpg, for installations with many images
+
+The command can be re-run safely if it is interrupted. Set storage_layout
+in the config file (or FACE_CLI_STORAGE_LAYOUT) afterwards so new images
+are saved with the same layout.`,
+		Example: `  face storage migrate-layout --to sharded
+  face storage migrate-layout --to sharded --dry-run
+  face storage migrate-layout --to flat`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runStorageMigrateLayout(cfg, to, dryRun)
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", string(storage.LayoutSharded), "target layout (flat, sharded)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "report what would be moved without changing anything")
+
+	return cmd
+}
+
+func runStorageMigrateLayout(cfg *config.Config, to string, dryRun bool) error {
+	target, err := storage.ParseLayout(to)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	configured, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	stor, ok := configured.(*storage.FileSystemStorage)
+	if !ok {
+		return fmt.Errorf("migrate-layout only supports the %s storage backend", storage.BackendLocal)
+	}
+
+	users, err := db.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	// Users pending deletion still own images that 'face doctor' has to find
+	deleted, err := db.ListDeletedUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list deleted users: %w", err)
+	}
+	users = append(users, deleted...)
+
+	moved, current, missing := 0, 0, 0
+	for i := range users {
+		for j := range users[i].Faces {
+			result, err := migrateFaceImage(db, stor, &users[i], &users[i].Faces[j], target, dryRun)
+			if err != nil {
+				return err
+			}
+			switch result {
+			case layoutMoved:
+				moved++
+			case layoutCurrent:
+				current++
+			case layoutMissing:
+				missing++
+			}
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("\nDry run: %d image(s) would be moved to the %s layout (%d already in place, %d missing)\n", moved, target, current, missing)
+		return nil
+	}
+
+	fmt.Printf("\n✓ Moved %d image(s) to the %s layout (%d already in place, %d missing)\n", moved, target, current, missing)
+
+	if stor.Layout() != target {
+		fmt.Printf("\nNew images are still saved with the %s layout. Set \"storage_layout\": %q\n", stor.Layout(), string(target))
+		fmt.Println("in the config file or FACE_CLI_STORAGE_LAYOUT to switch.")
+	}
+
+	return nil
+}
+
+// layoutResult is the outcome of migrating one face image
+type layoutResult int
+
+const (
+	layoutMoved layoutResult = iota
+	layoutCurrent
+	layoutMissing
+)
+
+// migrateFaceImage moves the image of one face to the target layout and
+// points the database at it
+func migrateFaceImage(db database.Database, stor *storage.FileSystemStorage, user *models.User, f *models.Face, target storage.Layout, dryRun bool) (layoutResult, error) {
+	filename := storage.Filename(target, user.ID, f.ID)
+	if f.Filename == filename {
+		return layoutCurrent, nil
+	}
+
+	switch {
+	case stor.Exists(f.Filename):
+		if dryRun {
+			fmt.Printf("  • %s -> %s\n", f.Filename, filename)
+			return layoutMoved, nil
+		}
+		if err := stor.MoveImage(f.Filename, filename); err != nil {
+			return 0, err
+		}
+		if err := db.UpdateFaceFilename(user.ID, f.ID, filename); err != nil {
+			if moveErr := stor.MoveImage(filename, f.Filename); moveErr != nil {
+				return 0, fmt.Errorf("failed to update face %s: %w (image left at %s)", f.ID, err, filename)
+			}
+			return 0, fmt.Errorf("failed to update face %s: %w", f.ID, err)
+		}
+
+	case stor.Exists(filename):
+		// Moved by an interrupted run before the database was updated
+		if dryRun {
+			fmt.Printf("  • %s (already moved)\n", filename)
+			return layoutMoved, nil
+		}
+		if err := db.UpdateFaceFilename(user.ID, f.ID, filename); err != nil {
+			return 0, fmt.Errorf("failed to update face %s: %w", f.ID, err)
+		}
+
+	default:
+		fmt.Printf("  ✗ Image missing for face %s of %s: %s\n", f.ID, user.Name, f.Filename)
+		return layoutMissing, nil
+	}
+
+	return layoutMoved, nil
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/matching"
+)
+
+// strategyCandidates is how many users more than wanted are rescored with
+// the average or vote strategy, as the users with the closest faces are
+// not always those with the closest template or the most votes
+const strategyCandidates = 10
+
+// strategyIdentifier rescores the matches of an identifier with the
+// average or vote strategy. Under vote, faces are discounted by their age
+// with the confidence decay before they vote; an average blends faces of
+// every age, so it is not discounted.
+type strategyIdentifier struct {
+	identifier
+	db       database.Database
+	decay    matching.Decay
+	strategy matching.Strategy
+}
+
+// withScoring returns id scoring users with the strategy and discounting
+// old faces with decay, or id itself if neither changes its scores
+func withScoring(id identifier, db database.Database, decay matching.Decay, strategy matching.Strategy) identifier {
+	if strategy != matching.StrategyAverage && strategy != matching.StrategyVote {
+		return withDecay(id, db, decay)
+	}
+	return &strategyIdentifier{identifier: id, db: db, decay: decay, strategy: strategy}
+}
+
+// FindBestMatches returns up to n users most similar to the embedding under
+// the strategy, most similar first
+func (s *strategyIdentifier) FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error) {
+	matches, err := s.identifier.FindBestMatches(embedding, max(n, matching.VoteK)+strategyCandidates)
+	if err != nil {
+		return nil, err
+	}
+	for i := range matches {
+		if err := loadMatchedUser(s.db, &matches[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.strategy == matching.StrategyVote {
+		s.vote(matches, embedding)
+	} else {
+		average(matches, embedding)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Votes != matches[j].Votes {
+			return matches[i].Votes > matches[j].Votes
+		}
+		return matches[i].Confidence > matches[j].Confidence
+	})
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches, nil
+}
+
+// Match returns the user most similar to the embedding under the strategy,
+// or models.ErrNoMatch if they are not at least threshold similar
+func (s *strategyIdentifier) Match(embedding []float32, threshold float64) (*models.MatchResult, error) {
+	matches, err := s.FindBestMatches(embedding, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bestMatch(matches, threshold)
+}
+
+// vote scores the matches by the votes of the faces closest to the
+// embedding among theirs, each discounted by its age
+func (s *strategyIdentifier) vote(matches []models.MatchResult, embedding []float32) {
+	now := time.Now()
+	similarities := make([][]float64, len(matches))
+	for i := range matches {
+		for _, f := range matches[i].User.Faces {
+			similarity := s.decay.Apply(matching.CosineSimilarity(embedding, f.Embedding), now.Sub(f.EnrolledAt))
+			similarities[i] = append(similarities[i], similarity)
+		}
+	}
+	for i, v := range matching.Votes(similarities, matching.VoteK) {
+		matches[i].Confidence, matches[i].Votes, matches[i].FaceID = v.Confidence, v.Votes, ""
+		if v.Face >= 0 {
+			matches[i].FaceID = matches[i].User.Faces[v.Face].ID
+		}
+	}
+}
+
+// votesLabel describes the votes of a match under the vote strategy, empty
+// under the others
+func votesLabel(votes int) string {
+	if votes == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d/%d votes", votes, matching.VoteK)
+}
+
+// average scores the matches by the similarity of their averaged template
+// to the embedding, keeping their closest face as the face matched
+func average(matches []models.MatchResult, embedding []float32) {
+	for i := range matches {
+		faces := matches[i].User.Faces
+		embeddings := make([][]float32, len(faces))
+		for k, f := range faces {
+			embeddings[k] = f.Embedding
+		}
+		matches[i].Confidence = matching.Average(embedding, embeddings)
+		_, matches[i].FaceID = decayedBest(matching.Decay{}, embedding, faces, time.Time{})
+	}
+}
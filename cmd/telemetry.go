@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/telemetry"
+
+	"github.com/spf13/cobra"
+)
+
+// telemetryDisabled is the telemetry_file value that turns telemetry off
+// for good, so it cannot be enabled
+const telemetryDisabled = "none"
+
+func NewTelemetryCmd(cfg *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Show or change whether anonymous usage statistics are sent",
+		Long: `Usage statistics are off unless enabled with 'face telemetry enable'.
+Until then nothing is counted and no network request is made.
+
+Once enabled, this machine counts how often each command runs and, for
+failed runs, the class of the error (the error codes of the API, e.g.
+face_not_detected, and internal for any other error). About once a day the
+counts are sent to telemetry_endpoint with a random installation ID, the
+version, the operating system and the database and storage types. Names,
+images, embeddings, file paths, flag values and error messages are never
+sent. 'face telemetry status' shows the exact report that would be sent.
+
+DO_NOT_TRACK=1 turns telemetry off whatever was enabled, and telemetry_file
+"none" keeps it from being enabled.`,
+		Example: `  face telemetry status
+  face telemetry enable
+  face telemetry disable`,
+	}
+
+	cmd.AddCommand(newTelemetryStatusCmd(cfg))
+	cmd.AddCommand(newTelemetryEnableCmd(cfg))
+	cmd.AddCommand(newTelemetryDisableCmd(cfg))
+
+	return cmd
+}
+
+func newTelemetryStatusCmd(cfg *config.Config) *cobra.Command {
+	var formatJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether usage statistics are sent, and the next report",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTelemetryStatus(cfg, formatJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func newTelemetryEnableCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "enable",
+		Short: "Send anonymous usage statistics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTelemetryEnable(cfg)
+		},
+	}
+}
+
+func newTelemetryDisableCmd(cfg *config.Config) *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable",
+		Short: "Stop sending usage statistics and drop unsent counts",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTelemetryDisable(cfg)
+		},
+	}
+}
+
+// telemetryStatus is the output of 'face telemetry status --json'
+type telemetryStatus struct {
+	Enabled    bool              `json:"enabled"`
+	DoNotTrack bool              `json:"do_not_track"`
+	File       string            `json:"file"`
+	Endpoint   string            `json:"endpoint,omitempty"`
+	LastSent   *time.Time        `json:"last_sent,omitempty"`
+	NextReport *telemetry.Report `json:"next_report,omitempty"`
+}
+
+func runTelemetryStatus(cfg *config.Config, formatJSON bool) error {
+	status := telemetryStatus{
+		DoNotTrack: telemetry.DoNotTrack(),
+		File:       cfg.TelemetryFile,
+		Endpoint:   cfg.TelemetryEndpoint,
+	}
+	if telemetryAvailable(cfg) {
+		state, err := telemetry.Load(cfg.TelemetryFile)
+		if err != nil {
+			return err
+		}
+		status.Enabled = state.Enabled && !status.DoNotTrack
+		if !state.LastSent.IsZero() {
+			status.LastSent = &state.LastSent
+		}
+		if status.Enabled {
+			status.NextReport = state.Report(cfg.TelemetryEnvironment(), time.Now())
+		}
+	}
+
+	if formatJSON {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	printTelemetryStatus(cfg, &status)
+	return nil
+}
+
+func printTelemetryStatus(cfg *config.Config, status *telemetryStatus) {
+	if !status.Enabled {
+		fmt.Println("Telemetry: disabled")
+		switch {
+		case status.DoNotTrack:
+			fmt.Printf("  %s is set\n", telemetry.DoNotTrackEnv)
+		case !telemetryAvailable(cfg):
+			fmt.Printf("  telemetry_file is %q\n", cfg.TelemetryFile)
+		}
+		fmt.Println("  Nothing is counted and no network requests are made.")
+		return
+	}
+
+	fmt.Println("Telemetry: enabled")
+	if status.Endpoint == "" {
+		fmt.Println("Endpoint:  none configured, counts are kept locally only")
+	} else {
+		fmt.Printf("Endpoint:  %s\n", status.Endpoint)
+	}
+	fmt.Printf("File:      %s\n", status.File)
+	if status.LastSent != nil {
+		fmt.Printf("Last sent: %s\n", status.LastSent.Local().Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Println("Last sent: never")
+	}
+
+	report := status.NextReport
+	fmt.Println()
+	fmt.Printf("Next report (install %s, since %s):\n", report.InstallID, report.From.Local().Format("2006-01-02 15:04"))
+	if len(report.Commands) == 0 {
+		fmt.Println("  no commands counted yet")
+		return
+	}
+	commands := make([]string, 0, len(report.Commands))
+	for command := range report.Commands {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		counts := report.Commands[command]
+		fmt.Printf("  %-24s %5d runs", command, counts.Runs)
+		if len(counts.Errors) > 0 {
+			fmt.Printf("  (%s)", formatErrorClasses(counts.Errors))
+		}
+		fmt.Println()
+	}
+}
+
+// formatErrorClasses lists failed runs by class, e.g. "2 face_not_detected"
+func formatErrorClasses(errs map[string]int) string {
+	classes := make([]string, 0, len(errs))
+	for class := range errs {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	parts := make([]string, len(classes))
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%d %s", errs[class], class)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func runTelemetryEnable(cfg *config.Config) error {
+	if !telemetryAvailable(cfg) {
+		return fmt.Errorf("telemetry is turned off (telemetry_file is %q)", cfg.TelemetryFile)
+	}
+	if telemetry.DoNotTrack() {
+		return fmt.Errorf("telemetry is turned off by %s", telemetry.DoNotTrackEnv)
+	}
+	if err := telemetry.ValidateEndpoint(cfg.TelemetryEndpoint); err != nil {
+		return err
+	}
+
+	state, err := telemetry.Load(cfg.TelemetryFile)
+	if err != nil {
+		return err
+	}
+	state.Enable(time.Now())
+	if err := telemetry.Save(cfg.TelemetryFile, state); err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Telemetry enabled")
+	if cfg.TelemetryEndpoint == "" {
+		fmt.Println("Warning: no telemetry_endpoint is configured, counts are kept locally until one is")
+	} else {
+		fmt.Printf("  Command counts and error classes are sent to %s about once a day.\n", cfg.TelemetryEndpoint)
+	}
+	fmt.Println("  Run 'face telemetry status' to see what is sent.")
+	return nil
+}
+
+func runTelemetryDisable(cfg *config.Config) error {
+	if !telemetryAvailable(cfg) {
+		fmt.Println("✓ Telemetry disabled")
+		return nil
+	}
+
+	state, err := telemetry.Load(cfg.TelemetryFile)
+	if err != nil {
+		return err
+	}
+	state.Disable()
+	if err := telemetry.Save(cfg.TelemetryFile, state); err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Telemetry disabled, unsent counts were dropped")
+	return nil
+}
+
+// telemetryAvailable reports whether telemetry can be enabled at all
+func telemetryAvailable(cfg *config.Config) bool {
+	return cfg.TelemetryFile != "" && cfg.TelemetryFile != telemetryDisabled
+}
+
+// RecordTelemetry counts the run of c, failed with runErr if not nil, and
+// sends the counts when they are due. It does nothing, and in particular
+// makes no network request, unless telemetry was enabled. A report that
+// cannot be sent is kept and sent later.
+func RecordTelemetry(cfg *config.Config, c *cobra.Command, runErr error) error {
+	if c == nil || !telemetryAvailable(cfg) || telemetry.DoNotTrack() || isTelemetryCmd(c) {
+		return nil
+	}
+
+	state, err := telemetry.Load(cfg.TelemetryFile)
+	if err != nil || !state.Enabled {
+		return err
+	}
+
+	errClass := ""
+	if runErr != nil {
+		errClass = string(apierror.From(runErr).Code)
+	}
+	command := strings.TrimPrefix(c.CommandPath(), c.Root().Name()+" ")
+	state.Record(command, errClass)
+
+	now := time.Now()
+	if cfg.TelemetryEndpoint != "" && state.Due(now) {
+		report := state.Report(cfg.TelemetryEnvironment(), now)
+		if err := telemetry.Send(context.Background(), cfg.TelemetryEndpoint, report); err != nil {
+			slog.Debug("usage statistics not sent", "error", err)
+			state.Failed(now)
+		} else {
+			state.Sent(now)
+		}
+	}
+	return telemetry.Save(cfg.TelemetryFile, state)
+}
+
+// isTelemetryCmd reports whether c is 'face telemetry' or one of its
+// subcommands, whose runs are neither counted nor trigger a report
+func isTelemetryCmd(c *cobra.Command) bool {
+	for ; c != nil; c = c.Parent() {
+		if c.Name() == "telemetry" && c.HasParent() && !c.Parent().HasParent() {
+			return true
+		}
+	}
+	return false
+}
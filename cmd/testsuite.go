@@ -0,0 +1,389 @@
+package cmd
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/pipeline"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// testSuiteFile is a cases file of 'face test-suite'
+type testSuiteFile struct {
+	Threshold float64         `yaml:"threshold"`
+	Cases     []testSuiteCase `yaml:"cases"`
+}
+
+// testSuiteCase enrolls people into an empty database and checks how probe
+// images are identified
+type testSuiteCase struct {
+	Name      string                `yaml:"name"`
+	Threshold float64               `yaml:"threshold"`
+	Enroll    []testSuiteEnrollment `yaml:"enroll"`
+	Identify  []testSuiteIdentify   `yaml:"identify"`
+}
+
+type testSuiteEnrollment struct {
+	Name   string   `yaml:"name"`
+	Images []string `yaml:"images"`
+}
+
+// testSuiteIdentify expects an image to be identified as a person with at
+// least MinScore confidence, or to match nobody when Expect is empty
+type testSuiteIdentify struct {
+	Image    string  `yaml:"image"`
+	Expect   string  `yaml:"expect"`
+	MinScore float64 `yaml:"min_score"`
+}
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func NewTestSuiteCmd(cfg *config.Config) *cobra.Command {
+	var (
+		casesPath string
+		junitPath string
+		threshold float64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "test-suite",
+		Short: "Run declarative recognition scenarios",
+		Long: `Run the scenarios of a cases file against the configured models. Every case
+starts from an empty temporary database, enrolls the listed people and checks
+how each probe image is identified. Image paths are relative to the cases
+file. The configured database is never touched.
+
+Results are written as a JUnit XML report and the command exits non-zero if
+any check fails, so model and threshold changes can be validated in CI.
+
+Cases file:
+  threshold: 0.75            # optional, overrides --threshold
+  cases:
+    - name: alice-is-recognized
+      threshold: 0.8         # optional, per case
+      enroll:
+        - name: Alice
+          images: [alice/1.jpg, alice/2.jpg]
+        - name: Bob
+          images: [bob/1.jpg]
+      identify:
+        - image: alice/probe.jpg
+          expect: Alice
+          min_score: 0.85
+        - image: stranger.jpg  # no expect: must match nobody`,
+		Example: `  face test-suite --cases cases.yaml
+  face test-suite --cases cases.yaml --junit reports/face.xml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runTestSuite(cfg, casesPath, junitPath, threshold)
+		},
+	}
+
+	cmd.Flags().StringVar(&casesPath, "cases", "", "YAML cases file (required)")
+	cmd.Flags().StringVar(&junitPath, "junit", "junit.xml", "path of the JUnit XML report")
+	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	_ = cmd.MarkFlagRequired("cases")
+
+	return cmd
+}
+
+func runTestSuite(cfg *config.Config, casesPath, junitPath string, threshold float64) error {
+	suite, err := loadTestSuite(casesPath)
+	if err != nil {
+		return err
+	}
+	if suite.Threshold > 0 {
+		threshold = suite.Threshold
+	}
+
+	detector, extractor, err := newPipeline(cfg)
+	if err != nil {
+		return err
+	}
+	defer detector.Close()
+	defer extractor.Close()
+
+	baseDir := filepath.Dir(casesPath)
+	started := time.Now()
+	report := junitTestSuites{}
+
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		caseThreshold := threshold
+		if c.Threshold > 0 {
+			caseThreshold = c.Threshold
+		}
+
+		result := runTestSuiteCase(detector, extractor, c, baseDir, caseThreshold)
+		printTestSuiteCase(&result)
+
+		report.Suites = append(report.Suites, result)
+		report.Tests += result.Tests
+		report.Failures += result.Failures
+		report.Errors += result.Errors
+	}
+	report.Time = junitSeconds(time.Since(started))
+
+	if err := writeJUnitReport(junitPath, &report); err != nil {
+		return err
+	}
+
+	failed := report.Failures + report.Errors
+	fmt.Printf("\n%d check(s), %d failed. Report written to %s\n", report.Tests, failed, junitPath)
+
+	if failed > 0 {
+		return fmt.Errorf("test suite failed: %d of %d check(s) failed", failed, report.Tests)
+	}
+	return nil
+}
+
+// loadTestSuite reads and validates a cases file
+func loadTestSuite(path string) (*testSuiteFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cases file: %w", err)
+	}
+
+	var suite testSuiteFile
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("invalid cases file %s: %w", path, err)
+	}
+
+	if len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("no cases in %s", path)
+	}
+	for i, c := range suite.Cases {
+		if c.Name == "" {
+			return nil, fmt.Errorf("case %d has no name", i+1)
+		}
+		if len(c.Identify) == 0 {
+			return nil, fmt.Errorf("case %s has no identify checks", c.Name)
+		}
+	}
+
+	return &suite, nil
+}
+
+// runTestSuiteCase runs one case against a fresh temporary database. A
+// failed enrollment is reported as an error of every check of the case.
+func runTestSuiteCase(detector pipeline.Detector, extractor pipeline.Extractor, c *testSuiteCase, baseDir string, threshold float64) junitTestSuite {
+	started := time.Now()
+	result := junitTestSuite{Name: c.Name}
+
+	fs, cleanup, err := newTestSuiteSystem(detector, extractor)
+	if err == nil {
+		defer cleanup()
+		err = testSuiteEnroll(fs, c.Enroll, baseDir)
+	}
+
+	for _, check := range c.Identify {
+		testCase := junitTestCase{
+			Name:      "identify " + check.Image,
+			Classname: c.Name,
+			Time:      junitSeconds(0),
+		}
+
+		if err != nil {
+			testCase.Error = &junitMessage{Message: "enrollment failed", Text: err.Error()}
+			result.Errors++
+		} else {
+			checkStarted := time.Now()
+			if failure := testSuiteIdentifyCheck(fs, check, baseDir, threshold); failure != "" {
+				testCase.Failure = &junitMessage{Message: failure}
+				result.Failures++
+			}
+			testCase.Time = junitSeconds(time.Since(checkStarted))
+		}
+
+		result.Cases = append(result.Cases, testCase)
+		result.Tests++
+	}
+
+	result.Time = junitSeconds(time.Since(started))
+	return result
+}
+
+// newTestSuiteSystem creates a face system backed by a temporary JSON
+// database and image directory, sharing the already loaded models
+func newTestSuiteSystem(detector pipeline.Detector, extractor pipeline.Extractor) (*FaceSystem, func(), error) {
+	dir, err := os.MkdirTemp("", "face-test-suite-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	db, err := database.NewJSONDatabase(filepath.Join(dir, "face.json"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	stor, err := storage.NewFileSystemStorage(filepath.Join(dir, "faces"), storage.LayoutFlat)
+	if err != nil {
+		db.Close()
+		os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	fs := &FaceSystem{
+		DB:        db,
+		Storage:   stor,
+		Detector:  detector,
+		Extractor: extractor,
+	}
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+
+	return fs, cleanup, nil
+}
+
+// testSuiteEnroll enrolls the people of a case; unlike 'face enroll' every
+// image must produce a face
+func testSuiteEnroll(fs *FaceSystem, enrollments []testSuiteEnrollment, baseDir string) error {
+	for _, e := range enrollments {
+		user := &models.User{
+			ID:    uuid.New().String(),
+			Name:  e.Name,
+			Faces: []models.Face{},
+		}
+
+		for _, image := range e.Images {
+			result, err := fs.ProcessImage(testSuitePath(baseDir, image))
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", e.Name, image, err)
+			}
+
+			faceID := uuid.New().String()
+			filename, err := fs.saveFace(user.ID, faceID, result)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", e.Name, image, err)
+			}
+
+			user.Faces = append(user.Faces, models.Face{
+				ID:           faceID,
+				Filename:     filename,
+				Embedding:    models.Embedding(result.Embedding),
+				QualityScore: result.QualityScore,
+			})
+		}
+
+		if err := fs.DB.CreateUser(user); err != nil {
+			return fmt.Errorf("failed to enroll %s: %w", e.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// testSuiteIdentifyCheck identifies a probe image and returns why the check
+// failed, or "" if it passed
+func testSuiteIdentifyCheck(fs *FaceSystem, check testSuiteIdentify, baseDir string, threshold float64) string {
+	result, err := fs.ProcessImage(testSuitePath(baseDir, check.Image))
+	if err != nil {
+		return err.Error()
+	}
+
+	match, err := newIdentifier(fs.DB, fs.Decay, fs.Strategy, "").Match(result.Embedding, threshold)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoMatch) {
+			return fmt.Sprintf("matching failed: %v", err)
+		}
+		if check.Expect != "" {
+			return fmt.Sprintf("expected %s, got no match with confidence >= %.2f", check.Expect, threshold)
+		}
+		return ""
+	}
+
+	switch {
+	case check.Expect == "":
+		return fmt.Sprintf("expected no match, got %s (%.4f)", match.User.Name, match.Confidence)
+	case match.User.Name != check.Expect:
+		return fmt.Sprintf("expected %s, got %s (%.4f)", check.Expect, match.User.Name, match.Confidence)
+	case match.Confidence < check.MinScore:
+		return fmt.Sprintf("matched %s with %.4f, below min_score %.4f", match.User.Name, match.Confidence, check.MinScore)
+	}
+	return ""
+}
+
+func printTestSuiteCase(result *junitTestSuite) {
+	if result.Failures+result.Errors == 0 {
+		fmt.Printf("✓ %s (%d check(s))\n", result.Name, result.Tests)
+		return
+	}
+
+	fmt.Printf("✗ %s (%d of %d check(s) failed)\n", result.Name, result.Failures+result.Errors, result.Tests)
+	for _, c := range result.Cases {
+		switch {
+		case c.Failure != nil:
+			fmt.Printf("    %s: %s\n", c.Name, c.Failure.Message)
+		case c.Error != nil:
+			fmt.Printf("    %s: %s: %s\n", c.Name, c.Error.Message, c.Error.Text)
+		}
+	}
+}
+
+func writeJUnitReport(path string, report *junitTestSuites) error {
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format report: %w", err)
+	}
+
+	data = append([]byte(xml.Header), data...)
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// testSuitePath resolves an image path relative to the cases file
+func testSuitePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
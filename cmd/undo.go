@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/database"
+	"face/internal/storage"
+	"face/internal/undo"
+
+	"github.com/spf13/cobra"
+)
+
+// undoChangeBatch is how many change log entries are read at a time when
+// looking for later changes to an undone user
+const undoChangeBatch = 1000
+
+func NewUndoCmd(cfg *config.Config) *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:         "undo",
+		Short:       "Reverse the last delete or update run on this machine",
+		Annotations: recordAlways(),
+		Long: `Reverse the most recent 'face delete' or 'face update' (changed details or
+--remove-face) run on this machine, if it is within the undo window
+(undo_window_minutes in the config, FACE_CLI_UNDO_WINDOW, default 10).
+
+Deleted users are kept hidden and removed faces keep their image until the
+window has passed or the next delete or update is run, so undoing restores
+them completely. Only the last operation can be undone; the users of a
+'face delete --all' are restored together.
+
+With the sqlite and postgres databases, undo refuses to run if the user has
+been changed since, e.g. from another machine, unless --force is given.`,
+		Example: `  face delete --id abc-123 --confirm
+  face undo`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUndo(cfg, force)
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "undo even if the user has been changed since")
+
+	return cmd
+}
+
+func runUndo(cfg *config.Config, force bool) error {
+	window := cfg.UndoWindow()
+	if window == 0 {
+		return fmt.Errorf("undo is disabled (undo_window_minutes is negative or undo_file is empty)")
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	stor, err := cfg.GetStorage(db)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	record, err := loadUndo(cfg)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		fmt.Println("Nothing to undo.")
+		return nil
+	}
+
+	if record.Expired(window) {
+		settleUndo(cfg, db, stor)
+		return fmt.Errorf("the %s of %s at %s is older than the undo window of %s",
+			record.Op, record.UserName, record.Time.Format("15:04:05"), window)
+	}
+
+	if changeLog, ok := db.(database.ChangeLog); ok && record.Seq > 0 && !force {
+		changed, err := userChangedSince(changeLog, record)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return fmt.Errorf("%s has been changed since the %s, use --force to undo anyway", record.UserName, record.Op)
+		}
+	}
+
+	if err := revertUndoRecord(db, stor, record); err != nil {
+		return err
+	}
+	if err := undo.Remove(cfg.UndoFile); err != nil {
+		return err
+	}
+
+	slog.Info("operation undone", "op", record.Op, "user_id", record.UserID)
+	fmt.Printf("✓ Undid the %s of %s (%s) from %s\n", record.Op, record.UserName, strings.Join(record.Users(), ", "), record.Time.Format("15:04:05"))
+	return nil
+}
+
+// revertUndoRecord reverses the operation described by record
+func revertUndoRecord(db database.Database, stor storage.Storage, record *undo.Record) error {
+	if record.Op == undo.OpDelete {
+		for _, id := range record.Users() {
+			if err := db.RestoreUser(id); err != nil {
+				return fmt.Errorf("failed to restore user %s: %w", id, err)
+			}
+		}
+		return nil
+	}
+
+	if record.Before != nil {
+		user, err := db.GetUser(record.UserID)
+		if err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		user.Name = record.Before.Name
+		user.Email = record.Before.Email
+		user.Phone = record.Before.Phone
+		user.CardNumber = record.Before.CardNumber
+		user.Badge = record.Before.Badge
+		user.Metadata = record.Before.Metadata
+		if err := db.UpdateUser(user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	if record.RemovedFace != nil {
+		face := *record.RemovedFace
+		evicted, err := db.AddFace(record.UserID, &face)
+		if err != nil {
+			return fmt.Errorf("failed to restore face: %w", err)
+		}
+		if evicted != nil {
+			if err := stor.DeleteImage(evicted.Filename); err != nil {
+				fmt.Printf("Warning: failed to delete image of evicted face: %v\n", err)
+			}
+		}
+		refreshAvatar(db, stor, record.UserID)
+	}
+
+	return nil
+}
+
+// userChangedSince reports whether the change log has entries for the
+// users of the record after it was made
+func userChangedSince(changeLog database.ChangeLog, record *undo.Record) (bool, error) {
+	seq := record.Seq
+	for {
+		changes, err := changeLog.ChangesSince(seq, undoChangeBatch)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range changes {
+			if record.Covers(c.UserID) {
+				return true, nil
+			}
+		}
+		if len(changes) < undoChangeBatch {
+			return false, nil
+		}
+		seq = changes[len(changes)-1].Seq
+	}
+}
+
+// rememberUndo records an operation for 'face undo', after finishing the
+// operation remembered before. If undo is disabled or the record cannot be
+// saved, the operation itself is finished right away instead. It reports
+// whether the operation was remembered.
+func rememberUndo(cfg *config.Config, db database.Database, stor storage.Storage, record *undo.Record) (bool, error) {
+	if cfg.UndoWindow() == 0 {
+		return false, finishUndoRecord(db, stor, record)
+	}
+
+	settleUndo(cfg, db, stor)
+
+	record.Time = time.Now()
+	if changeLog, ok := db.(database.ChangeLog); ok {
+		if seq, err := changeLog.LatestChange(); err == nil {
+			record.Seq = seq
+		}
+	}
+
+	if err := saveUndo(cfg, record); err != nil {
+		fmt.Printf("Warning: %v, the %s cannot be undone\n", err, record.Op)
+		return false, finishUndoRecord(db, stor, record)
+	}
+	return true, nil
+}
+
+// loadUndo returns the operation remembered for undo, nil if there is none
+func loadUndo(cfg *config.Config) (*undo.Record, error) {
+	key, err := cfg.Encryption()
+	if err != nil {
+		return nil, err
+	}
+	return undo.Load(cfg.UndoFile, key)
+}
+
+// saveUndo remembers an operation for undo, encrypted if the stored faces
+// are
+func saveUndo(cfg *config.Config, record *undo.Record) error {
+	key, err := cfg.Encryption()
+	if err != nil {
+		return err
+	}
+	return undo.Save(cfg.UndoFile, record, key)
+}
+
+// settleUndo finishes the operation remembered for undo and any deletion
+// older than the undo window, so what they kept is removed for good.
+// Failures are reported as warnings; 'face doctor --fix' picks up what is
+// left.
+func settleUndo(cfg *config.Config, db database.Database, stor storage.Storage) {
+	settleUndoRecord(cfg, db, stor, true)
+	finalizeExpiredDeletions(cfg, db, stor)
+}
+
+// settleExpiredUndo is settleUndo for what can no longer be undone: the
+// remembered operation is only finished once it is older than the undo
+// window
+func settleExpiredUndo(cfg *config.Config, db database.Database, stor storage.Storage) {
+	settleUndoRecord(cfg, db, stor, false)
+	finalizeExpiredDeletions(cfg, db, stor)
+}
+
+// settleUndoRecord finishes the operation remembered for undo and forgets
+// it, unless it can still be undone and always is false
+func settleUndoRecord(cfg *config.Config, db database.Database, stor storage.Storage, always bool) {
+	record, err := loadUndo(cfg)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if record == nil || (!always && !record.Expired(cfg.UndoWindow())) {
+		return
+	}
+	if err := finishUndoRecord(db, stor, record); err != nil {
+		fmt.Printf("Warning: failed to finish the earlier %s of %s: %v\n", record.Op, record.UserName, err)
+	}
+	if err := undo.Remove(cfg.UndoFile); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// finalizeExpiredDeletions finishes the deletions older than the undo
+// window
+func finalizeExpiredDeletions(cfg *config.Config, db database.Database, stor storage.Storage) {
+	deleted, err := db.ListDeletedUsers()
+	if err != nil {
+		fmt.Printf("Warning: failed to list deleted users: %v\n", err)
+		return
+	}
+	window := cfg.UndoWindow()
+	for i := range deleted {
+		if time.Since(*deleted[i].DeletedAt) <= window {
+			continue
+		}
+		if err := finalizeUserDeletion(db, stor, &deleted[i]); err != nil {
+			fmt.Printf("Warning: failed to finish deleting %s: %v\n", deleted[i].Name, err)
+		}
+	}
+}
+
+// finishUndoRecord completes an operation so it can no longer be undone:
+// the user of a delete is finalized and a removed face's image is deleted
+func finishUndoRecord(db database.Database, stor storage.Storage, record *undo.Record) error {
+	if record.RemovedFace != nil {
+		if err := stor.DeleteImage(record.RemovedFace.Filename); err != nil {
+			return fmt.Errorf("failed to delete image file: %w", err)
+		}
+	}
+
+	if record.Op != undo.OpDelete {
+		return nil
+	}
+
+	deleted, err := db.ListDeletedUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list deleted users: %w", err)
+	}
+	// Users no longer listed were already finalized, e.g. by 'face doctor
+	// --fix'
+	for i := range deleted {
+		if !record.Covers(deleted[i].ID) {
+			continue
+		}
+		if err := finalizeUserDeletion(db, stor, &deleted[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoDeadline formats until when an operation remembered now can be undone
+func undoDeadline(cfg *config.Config) string {
+	return time.Now().Add(cfg.UndoWindow()).Format("15:04:05")
+}
@@ -5,6 +5,7 @@ import (
 
 	"face/config"
 	"face/internal/database/models"
+	"face/internal/undo"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
@@ -12,76 +13,139 @@ import (
 
 func NewUpdateCmd(cfg *config.Config) *cobra.Command {
 	var (
-		userID     string
-		name       string
-		email      string
-		phone      string
+		selection  userSelection
+		details    userDetails
 		addFace    string
 		removeFace string
+		faceID     string
+		label      string
+		primary    bool
 	)
 
 	cmd := &cobra.Command{
-		Use:   "update",
-		Short: "Update user information or manage face images",
-		Long:  `Update user information such as name, email, phone, or add/remove face images.`,
+		Use:         "update",
+		Short:       "Update user information or manage face images",
+		Annotations: recordAlways(),
+		Long: `Update user information such as name, email, phone, card number and badge,
+or add/remove face images. --card-number "" and --badge "" clear them.
+
+Select a face with --face-id to give it a label ("passport photo", "with
+glasses") or make it the primary face, which is shown first and used as the
+user's avatar. --label "" removes a label.
+
+Select the user by name with --user-name; if several users have the name,
+pick one from a list, or use --select-first in scripts.`,
 		Example: `  face update --id abc-123 --email new@example.com
   face update --id abc-123 --add-face photo.jpg
-  face update --id abc-123 --remove-face face-uuid`,
+  face update --id abc-123 --remove-face face-uuid
+  face update --id abc-123 --face-id face-uuid --label "passport photo" --primary
+  face update --user-name "John Doe" --select-first --phone 555-0100
+  face update --id abc-123 --card-number 41237 --badge E1042`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runUpdate(cfg, userID, name, email, phone, addFace, removeFace)
+			edit := faceEdit{FaceID: faceID, Primary: primary}
+			if cmd.Flags().Changed("label") {
+				edit.Label = &label
+			}
+			if faceID == "" && (edit.Label != nil || primary) {
+				return fmt.Errorf("--label and --primary require --face-id")
+			}
+			return runUpdate(cfg, selection, details, changedCardFields(cmd), addFace, removeFace, edit)
 		},
 	}
 
-	cmd.Flags().StringVar(&userID, "id", "", "user ID to update (required)")
-	cmd.Flags().StringVar(&name, "name", "", "update user name")
-	cmd.Flags().StringVar(&email, "email", "", "update user email")
-	cmd.Flags().StringVar(&phone, "phone", "", "update user phone")
+	cmd.Flags().StringVar(&selection.ID, "id", "", "user ID or unique prefix to update")
+	cmd.Flags().StringVar(&details.Name, "name", "", "update user name")
+	cmd.Flags().StringVar(&details.Email, "email", "", "update user email")
+	cmd.Flags().StringVar(&details.Phone, "phone", "", "update user phone")
+	cmd.Flags().StringVar(&details.CardNumber, "card-number", "", "update the number of the user's access card")
+	cmd.Flags().StringVar(&details.Badge, "badge", "", "update the user's badge or employee ID")
 	cmd.Flags().StringVar(&addFace, "add-face", "", "add a new face image")
 	cmd.Flags().StringVar(&removeFace, "remove-face", "", "remove a face by face ID")
-	_ = cmd.MarkFlagRequired("id")
+	cmd.Flags().StringVar(&faceID, "face-id", "", "face to change with --label or --primary")
+	cmd.Flags().StringVar(&label, "label", "", "set the label of the face")
+	cmd.Flags().BoolVar(&primary, "primary", false, "make the face the user's primary face")
+	selection.addNameFlags(cmd, "id", false)
 
 	return cmd
 }
 
-func runUpdate(cfg *config.Config, userID, name, email, phone, addFace, removeFace string) error {
+// faceEdit describes changes to an existing face
+type faceEdit struct {
+	FaceID  string
+	Label   *string // nil leaves the label unchanged
+	Primary bool
+}
+
+// cardFields says which of the card fields are set by an update; unlike the
+// other fields, they can be set to empty
+type cardFields struct {
+	CardNumber bool
+	Badge      bool
+}
+
+func changedCardFields(cmd *cobra.Command) cardFields {
+	return cardFields{
+		CardNumber: cmd.Flags().Changed("card-number"),
+		Badge:      cmd.Flags().Changed("badge"),
+	}
+}
+
+func runUpdate(cfg *config.Config, selection userSelection, details userDetails, card cardFields, addFace, removeFace string, edit faceEdit) error {
 	fs, err := NewFaceSystem(cfg)
 	if err != nil {
 		return err
 	}
 	defer fs.Close()
 
-	user, err := fs.DB.GetUser(userID)
+	users, err := selectUsers(fs.DB, selection)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return err
 	}
+	user := &users[0]
+	userID := user.ID
 
-	updated := false
-
-	if name != "" {
-		user.Name = name
-		updated = true
-		fmt.Printf("✓ Updated name to: %s\n", name)
+	if removeFace, err = resolveFaceID(user, removeFace); err != nil {
+		return err
 	}
-
-	if email != "" {
-		user.Email = email
-		updated = true
-		fmt.Printf("✓ Updated email to: %s\n", email)
+	if edit.FaceID, err = resolveFaceID(user, edit.FaceID); err != nil {
+		return err
 	}
 
-	if phone != "" {
-		user.Phone = phone
-		updated = true
-		fmt.Printf("✓ Updated phone to: %s\n", phone)
+	before := *user
+	var record *undo.Record
+
+	updated := updateUserInfo(user, details, card)
+	if updated {
+		if err := fs.DB.UpdateUser(user); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+		record = &undo.Record{Op: undo.OpUpdate, Before: &models.User{
+			Name:       before.Name,
+			Email:      before.Email,
+			Phone:      before.Phone,
+			CardNumber: before.CardNumber,
+			Badge:      before.Badge,
+			Metadata:   before.Metadata,
+		}}
 	}
 
 	if removeFace != "" {
-		if err := removeFaceFromUser(fs, userID, removeFace, user); err != nil {
+		removed, err := removeFaceFromUser(fs, userID, removeFace, user)
+		startAudit(cfg, fs.DB, models.AuditRemoveFace, userID).finish(err)
+		if err != nil {
 			return err
 		}
+		if record == nil {
+			record = &undo.Record{Op: undo.OpRemoveFace}
+		}
+		record.RemovedFace = removed
 		updated = true
 	}
 
+	if record != nil {
+		rememberUpdate(cfg, fs, record, &before)
+	}
+
 	if addFace != "" {
 		if err := addFaceToUser(fs, userID, addFace); err != nil {
 			return err
@@ -89,10 +153,11 @@ func runUpdate(cfg *config.Config, userID, name, email, phone, addFace, removeFa
 		updated = true
 	}
 
-	if updated && (name != "" || email != "" || phone != "") {
-		if err := fs.DB.UpdateUser(user); err != nil {
-			return fmt.Errorf("failed to update user: %w", err)
+	if edit.FaceID != "" {
+		if err := editFace(fs, userID, edit); err != nil {
+			return err
 		}
+		updated = true
 	}
 
 	if !updated {
@@ -104,30 +169,116 @@ func runUpdate(cfg *config.Config, userID, name, email, phone, addFace, removeFa
 	return nil
 }
 
-func removeFaceFromUser(fs *FaceSystem, userID, faceID string, user *models.User) error {
-	var faceFilename string
-	found := false
-	for _, face := range user.Faces {
-		if face.ID == faceID {
-			faceFilename = face.Filename
-			found = true
+// resolveFaceID expands a prefix of the ID of one of the user's faces to
+// the full ID. An empty ID is returned as it is.
+func resolveFaceID(user *models.User, faceID string) (string, error) {
+	if faceID == "" {
+		return "", nil
+	}
+	_, face, err := findFace([]models.User{*user}, faceID)
+	if err != nil {
+		return "", err
+	}
+	return face.ID, nil
+}
+
+// updateUserInfo applies the non-empty fields and the card fields that are
+// set to user, reporting whether anything changed
+func updateUserInfo(user *models.User, details userDetails, card cardFields) bool {
+	updated := false
+
+	if details.Name != "" {
+		user.Name = details.Name
+		updated = true
+		fmt.Printf("✓ Updated name to: %s\n", details.Name)
+	}
+
+	if details.Email != "" {
+		user.Email = details.Email
+		updated = true
+		fmt.Printf("✓ Updated email to: %s\n", details.Email)
+	}
+
+	if details.Phone != "" {
+		user.Phone = details.Phone
+		updated = true
+		fmt.Printf("✓ Updated phone to: %s\n", details.Phone)
+	}
+
+	if card.CardNumber {
+		user.CardNumber = details.CardNumber
+		updated = true
+		fmt.Printf("✓ Updated card number to: %q\n", details.CardNumber)
+	}
+
+	if card.Badge {
+		user.Badge = details.Badge
+		updated = true
+		fmt.Printf("✓ Updated badge to: %q\n", details.Badge)
+	}
+
+	return updated
+}
+
+// removeFaceFromUser removes a face from the database and returns it. Its
+// image is left for rememberUpdate, so the removal can be undone.
+func removeFaceFromUser(fs *FaceSystem, userID, faceID string, user *models.User) (*models.Face, error) {
+	var removed *models.Face
+	for i := range user.Faces {
+		if user.Faces[i].ID == faceID {
+			removed = &user.Faces[i]
 			break
 		}
 	}
 
-	if !found {
-		return fmt.Errorf("face ID not found")
+	if removed == nil {
+		return nil, fmt.Errorf("face ID not found")
 	}
 
 	if err := fs.DB.RemoveFace(userID, faceID); err != nil {
-		return fmt.Errorf("failed to remove face from database: %w", err)
+		return nil, fmt.Errorf("failed to remove face from database: %w", err)
 	}
+	refreshAvatar(fs.DB, fs.Storage, userID)
+
+	fmt.Printf("✓ Removed face: %s\n", faceID)
+	return removed, nil
+}
+
+// rememberUpdate makes the user details changed and the face removed by an
+// update undoable, deleting the image of the face if undo is unavailable
+func rememberUpdate(cfg *config.Config, fs *FaceSystem, record *undo.Record, before *models.User) {
+	record.UserID = before.ID
+	record.UserName = before.Name
 
-	if err := fs.Storage.DeleteImage(faceFilename); err != nil {
-		fmt.Printf("Warning: failed to delete image file: %v\n", err)
+	remembered, err := rememberUndo(cfg, fs.DB, fs.Storage, record)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if remembered {
+		fmt.Printf("  Run 'face undo' before %s to revert this update\n", undoDeadline(cfg))
+	}
+}
+
+func editFace(fs *FaceSystem, userID string, edit faceEdit) error {
+	if edit.Label == nil && !edit.Primary {
+		return fmt.Errorf("--face-id requires --label or --primary")
+	}
+
+	if edit.Label != nil {
+		if err := fs.DB.SetFaceLabel(userID, edit.FaceID, *edit.Label); err != nil {
+			return fmt.Errorf("failed to set label: %w", err)
+		}
+		fmt.Printf("✓ Updated label of face %s to: %q\n", edit.FaceID, *edit.Label)
+	}
+
+	if edit.Primary {
+		if err := fs.DB.SetPrimaryFace(userID, edit.FaceID); err != nil {
+			return fmt.Errorf("failed to set primary face: %w", err)
+		}
+		fmt.Printf("✓ Face %s is now the primary face\n", edit.FaceID)
+		refreshAvatar(fs.DB, fs.Storage, userID)
 	}
 
-	fmt.Printf("✓ Removed face: %s\n", faceID)
 	return nil
 }
 
@@ -141,15 +292,32 @@ func addFaceToUser(fs *FaceSystem, userID, imagePath string) error {
 	}
 
 	fmt.Printf("Face detected (quality: %.2f)\n", result.QualityScore)
+	printQualityHints("", result)
 
 	if result.QualityScore < 0.3 {
 		return fmt.Errorf("quality too low (%.2f), minimum required: 0.30", result.QualityScore)
 	}
 
+	faceID, evicted, err := addProcessedFace(fs, userID, result)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Face added successfully (ID: %s)\n", faceID)
+	if evicted != nil {
+		fmt.Printf("• Face limit reached, replaced face %s (quality: %.2f)\n", evicted.ID, evicted.QualityScore)
+	}
+	return nil
+}
+
+// addProcessedFace stores a processed face and adds it to a user's faces,
+// returning its ID and the lowest quality face it replaced if the user had
+// the maximum number of faces
+func addProcessedFace(fs *FaceSystem, userID string, result *FaceResult) (string, *models.Face, error) {
 	faceID := uuid.New().String()
-	filename, err := fs.Storage.SaveImage(userID, faceID, result.CroppedFace)
+	filename, err := fs.saveFace(userID, faceID, result)
 	if err != nil {
-		return fmt.Errorf("failed to save image: %w", err)
+		return "", nil, fmt.Errorf("failed to save image: %w", err)
 	}
 
 	faceData := &models.Face{
@@ -159,11 +327,15 @@ func addFaceToUser(fs *FaceSystem, userID, imagePath string) error {
 		QualityScore: result.QualityScore,
 	}
 
-	if err := fs.DB.AddFace(userID, faceData); err != nil {
+	evicted, err := fs.DB.AddFace(userID, faceData)
+	if err != nil {
 		_ = fs.Storage.DeleteImage(filename)
-		return fmt.Errorf("failed to add face to database: %w", err)
+		return "", nil, fmt.Errorf("failed to add face to database: %w", err)
 	}
 
-	fmt.Printf("✓ Face added successfully (ID: %s)\n", faceID)
-	return nil
+	if evicted != nil {
+		deleteEvictedImage(fs, userID, evicted)
+	}
+	refreshAvatar(fs.DB, fs.Storage, userID)
+	return faceID, evicted, nil
 }
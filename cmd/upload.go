@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"mime/multipart"
+
+	"face/internal/apierror"
+	"face/internal/database/models"
+	"face/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// Limits of API requests with uploaded images
+const (
+	uploadMaxRequest = 64 << 20 // bytes, all images of a request together
+	uploadFormMemory = 16 << 20 // bytes of a form held in memory, the rest goes to temporary files
+)
+
+// minUploadQuality is the lowest face quality accepted for enrollment
+const minUploadQuality = 0.3
+
+func badRequest(format string, args ...any) error {
+	return apierror.New(apierror.CodeInvalidArgument, format, args...)
+}
+
+// missingField reports a required request field that was not sent
+func missingField(field string) error {
+	return apierror.New(apierror.CodeInvalidArgument, "%s not specified", field).WithDetail("field", field)
+}
+
+// processUpload detects the face of an uploaded image. Problems with the
+// image are typed errors, reported as invalid_image or too_large. The face
+// box is reported in the coordinates of the upload, even if it was
+// downscaled.
+func processUpload(fs *FaceSystem, file io.ReadSeeker) (*FaceResult, error) {
+	img, err := storage.DecodeInputImage(file, fs.ImageLimits)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+
+	result, err := fs.ProcessDecodedImage(img)
+	if err != nil {
+		return nil, err
+	}
+
+	if width := img.Bounds().Dx(); width != header.Width {
+		scale := float64(header.Width) / float64(width)
+		box := result.Box
+		result.Box = image.Rect(int(float64(box.Min.X)*scale), int(float64(box.Min.Y)*scale),
+			int(float64(box.Max.X)*scale), int(float64(box.Max.Y)*scale))
+	}
+	return result, nil
+}
+
+// lowQualityError reports a face too poor to enroll with the hints of what
+// to do about it, their codes in the "hints" detail
+func lowQualityError(filename string, result *FaceResult) error {
+	msg := fmt.Sprintf("face quality too low in %s (%.2f), minimum required: %.2f", filename, result.QualityScore, minUploadQuality)
+	hints := result.Scores.Hints()
+	codes := make([]any, len(hints))
+	for i, hint := range hints {
+		msg += "; " + hint.Message
+		codes[i] = hint.Code
+	}
+	return apierror.New(apierror.CodeLowQuality, "%s", msg).
+		WithDetail("image", filename).WithDetail("quality", result.QualityScore).WithDetail("minimum", minUploadQuality).
+		WithDetail("hints", codes)
+}
+
+// uploadedImage is an image uploaded with a request, opened when it is
+// processed
+type uploadedImage struct {
+	filename string
+	open     func() (io.ReadSeekCloser, error)
+}
+
+// formImages returns every image uploaded with a form
+func formImages(form *multipart.Form) []uploadedImage {
+	if form == nil {
+		return nil
+	}
+	var images []uploadedImage
+	for _, files := range form.File {
+		for _, header := range files {
+			images = append(images, uploadedImage{
+				filename: header.Filename,
+				open:     func() (io.ReadSeekCloser, error) { return header.Open() },
+			})
+		}
+	}
+	return images
+}
+
+// bytesImage returns an image uploaded as the bytes of a message
+func bytesImage(filename string, data []byte) uploadedImage {
+	return uploadedImage{
+		filename: filename,
+		open:     func() (io.ReadSeekCloser, error) { return nopSeekCloser{bytes.NewReader(data)}, nil },
+	}
+}
+
+// nopSeekCloser adds a no-op Close to an io.ReadSeeker
+type nopSeekCloser struct{ io.ReadSeeker }
+
+func (nopSeekCloser) Close() error { return nil }
+
+// saveUploadedFace processes an uploaded image and saves its face crop
+func saveUploadedFace(fs *FaceSystem, userID string, upload uploadedImage) (*models.Face, error) {
+	file, err := upload.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result, err := processUpload(fs, file)
+	if err != nil {
+		return nil, err
+	}
+	if result.SourceSHA256, err = sourceSHA256(file); err != nil {
+		return nil, err
+	}
+	if result.QualityScore < minUploadQuality {
+		return nil, lowQualityError(upload.filename, result)
+	}
+
+	faceID := uuid.New().String()
+	filename, err := fs.saveFace(userID, faceID, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save image: %w", err)
+	}
+	return &models.Face{
+		ID:           faceID,
+		Filename:     filename,
+		Embedding:    models.Embedding(result.Embedding),
+		QualityScore: result.QualityScore,
+	}, nil
+}
+
+// saveUploadedFaces saves the faces of every uploaded image, deleting the
+// images already saved if one fails
+func saveUploadedFaces(fs *FaceSystem, userID string, images []uploadedImage) ([]models.Face, error) {
+	var faces []models.Face
+	for _, upload := range images {
+		f, err := saveUploadedFace(fs, userID, upload)
+		if err != nil {
+			discardFaces(fs, faces)
+			return nil, err
+		}
+		faces = append(faces, *f)
+	}
+	return faces, nil
+}
+
+// addFaces adds faces to an existing user, deleting the images of faces
+// evicted by the face limit
+func addFaces(fs *FaceSystem, userID string, faces []models.Face) error {
+	for i := range faces {
+		evicted, err := fs.DB.AddFace(userID, &faces[i])
+		if err != nil {
+			return fmt.Errorf("failed to add face to database: %w", err)
+		}
+		if evicted != nil {
+			deleteEvictedImage(fs, userID, evicted)
+		}
+	}
+	return nil
+}
+
+// discardFaces deletes the images of faces that were not saved
+func discardFaces(fs *FaceSystem, faces []models.Face) {
+	for _, f := range faces {
+		_ = fs.Storage.DeleteImage(f.Filename)
+	}
+}
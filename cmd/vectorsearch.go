@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/face"
+	"face/matching"
+)
+
+// vectorMatcher identifies faces with the vector search of the database,
+// PostgreSQL with pgvector, which ranks the faces in SQL instead of the
+// matcher loading every embedding
+type vectorMatcher struct {
+	db       database.Database
+	searcher database.VectorSearcher
+}
+
+// newIdentifier returns the vector search of db when pgvector is enabled,
+// or else the brute-force matcher, matching only the users of scope,
+// scoring them with the match strategy, discounting old faces with decay
+// and running the matching hooks
+func newIdentifier(db database.Database, decay matching.Decay, strategy matching.Strategy, scope string) identifier {
+	if searcher, ok := db.(database.VectorSearcher); ok && searcher.VectorSearch() {
+		return withMatchHooks(withScoring(withScope(&vectorMatcher{db: db, searcher: searcher}, db, scope), db, decay, strategy))
+	}
+	return withMatchHooks(withScoring(withScope(face.NewMatcher(db), db, scope), db, decay, strategy))
+}
+
+// FindBestMatches returns up to n users with a face most similar to the
+// embedding, most similar first. Embeddings the vector column cannot hold
+// are matched by the brute-force matcher.
+func (m *vectorMatcher) FindBestMatches(embedding []float32, n int) ([]models.MatchResult, error) {
+	if len(embedding) != database.VectorDimension {
+		return face.NewMatcher(m.db).FindBestMatches(embedding, n)
+	}
+	found, err := m.searcher.NearestFaces(embedding, n*indexCandidatesPerUser)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []models.MatchResult
+	seen := make(map[string]bool)
+	for _, f := range found {
+		if len(matches) == n {
+			break
+		}
+		if seen[f.UserID] {
+			continue
+		}
+		seen[f.UserID] = true
+
+		user, err := m.db.GetUser(f.UserID)
+		if errors.Is(err, models.ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, models.MatchResult{UserID: f.UserID, User: user, FaceID: f.FaceID, Confidence: f.Similarity})
+	}
+	return matches, nil
+}
+
+// Match returns the user with the face most similar to the embedding, or
+// models.ErrNoMatch if none is at least threshold similar
+func (m *vectorMatcher) Match(embedding []float32, threshold float64) (*models.MatchResult, error) {
+	matches, err := m.FindBestMatches(embedding, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bestMatch(matches, threshold)
+}
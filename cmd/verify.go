@@ -1,97 +1,335 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"face/config"
-	"face/internal/face"
+	"face/internal/apierror"
+	"face/internal/database/models"
+	"face/internal/deadline"
+	"face/internal/redaction"
+	"face/internal/stepup"
 
 	"github.com/spf13/cobra"
 )
 
+// Defaults of sampling a camera for a face to verify
+const (
+	DefaultVerifyCameraTimeout = 10 * time.Second
+	DefaultVerifyMinQuality    = 0.5
+)
+
+// verifyRetryInterval is the pause between snapshots of verify --camera
+const verifyRetryInterval = 500 * time.Millisecond
+
+// verifyProbeInput is where the face to verify comes from
+type verifyProbeInput struct {
+	ImagePath string
+	// Camera is the configured camera to take snapshots from, without an
+	// image
+	Camera string
+	// SampleFor bounds how long snapshots are taken for a face of
+	// MinQuality
+	SampleFor  time.Duration
+	MinQuality float64
+	// RequireLiveness rejects a face that scores as a spoof; snapshots of
+	// the camera that do are skipped
+	RequireLiveness bool
+}
+
 func NewVerifyCmd(cfg *config.Config) *cobra.Command {
 	var (
-		userID    string
-		imagePath string
+		selection userSelection
+		probe     verifyProbeInput
 		threshold float64
+		step      stepUpInput
+		timeout   time.Duration
+		save      bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "verify",
 		Short: "Verify if a face image belongs to a specific user",
 		Long: `Verify if a given image matches a specific user in the database (1:1 verification).
-This is different from identify which searches all users (1:N identification).`,
+This is different from identify which searches all users (1:N identification).
+
+With --user-name, if several users have the name, pick one from a list, or
+use --select-first, or --all to verify against each of them.
+
+Step-up verification: when the step_up rules of the config file require it
+for the user's group and the match confidence, or with --step-up, the face
+alone is not enough and the user must also give their PIN or the code of
+their authenticator app (see 'face factor'). Without --code, it is asked for.
+
+Without --image, --camera takes snapshots from a camera configured in the
+config file (see 'face cameras') until the face reaches --min-quality, or
+--sample-for passes; then the best face seen is verified. A blurry frame or a
+person still walking up to the camera does not fail the verification.
+
+With --require-liveness (or "require_liveness": true in the config file), a
+face that looks like a printed photo or a screen rather than a live person is
+rejected before matching; with --camera, such snapshots are skipped.
+
+With --timeout, verification gives up with a timeout error once it has taken
+that long, instead of waiting on a hung camera or a slow disk. It bounds the
+whole command: snapshots are taken for --sample-for within it.
+
+With --save-probe, the crop and embedding of the face are kept with the
+decision for each user and linked to its audit event, for review with 'face
+audit probe'. Needs the sqlite or postgres database.`,
 		Example: `  face verify --user-id abc123 --image photo.jpg
-  face verify -u abc123 -i unknown.jpg --threshold 0.7`,
+  face verify -u abc123 -i unknown.jpg --threshold 0.7
+  face verify --user-name "John Doe" --all -i photo.jpg
+  face verify -u abc123 -i photo.jpg --step-up
+  face verify -u abc123 --camera front-door --sample-for 15s --timeout 20s
+  face verify -u abc123 -i selfie.jpg --require-liveness
+  face verify -u abc123 --camera front-door --save-probe`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runVerify(cfg, userID, imagePath, threshold)
+			if timeout < 0 || probe.SampleFor < 0 || probe.MinQuality < 0 || probe.MinQuality > 1 {
+				return errors.New("--timeout and --sample-for must not be negative and --min-quality must be between 0 and 1")
+			}
+			return runVerify(cfg, selection, probe, threshold, step, timeout, save)
 		},
 	}
 
-	cmd.Flags().StringVarP(&userID, "user-id", "u", "", "user ID to verify against (required)")
-	cmd.Flags().StringVarP(&imagePath, "image", "i", "", "path to image file (required)")
+	cmd.Flags().StringVarP(&selection.ID, "user-id", "u", "", "user ID or unique prefix to verify against")
+	cmd.Flags().StringVarP(&probe.ImagePath, "image", "i", "", "path to image file")
+	cmd.Flags().StringVar(&probe.Camera, "camera", "", "configured camera to take snapshots from instead of an image")
+	cmd.Flags().DurationVar(&probe.SampleFor, "sample-for", DefaultVerifyCameraTimeout, "how long to keep taking snapshots for a good face")
+	cmd.Flags().Float64Var(&probe.MinQuality, "min-quality", DefaultVerifyMinQuality, "face quality that ends taking snapshots (0.0-1.0)")
+	cmd.Flags().BoolVar(&probe.RequireLiveness, "require-liveness", cfg.RequireLiveness, "reject faces that look like a printed photo or a screen")
 	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
-	_ = cmd.MarkFlagRequired("user-id")
-	_ = cmd.MarkFlagRequired("image")
+	cmd.Flags().BoolVar(&step.Always, "step-up", false, "require the user's PIN or authenticator code too")
+	cmd.Flags().StringVar(&step.Code, "code", "", "PIN or authenticator code for step-up verification")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "give up after this long, e.g. 30s (default no limit)")
+	cmd.Flags().BoolVar(&save, "save-probe", false, "keep the face and decision for review, see 'face audit probe'")
+	cmd.MarkFlagsOneRequired("image", "camera")
+	cmd.MarkFlagsMutuallyExclusive("image", "camera")
+	selection.addNameFlags(cmd, "user-id", true)
 
 	return cmd
 }
 
-func runVerify(cfg *config.Config, userID, imagePath string, threshold float64) error {
+// stepUpInput is how a verification asks for a second factor
+type stepUpInput struct {
+	// Always requires a second factor regardless of the config's rules
+	Always bool
+	// Code is the PIN or authenticator code, asked for if empty
+	Code string
+}
+
+func runVerify(cfg *config.Config, selection userSelection, probe verifyProbeInput, threshold float64, step stepUpInput, timeout time.Duration, save bool) error {
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
 	fmt.Println("Initializing face verification system...")
 
-	fs, err := NewFaceSystem(cfg)
+	ctx, cancel := deadline.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	fs, err := newBoundFaceSystem(ctx, cfg)
 	if err != nil {
 		return err
 	}
 	defer fs.Close()
+	if err := checkProbeStore(fs.DB, save); err != nil {
+		return err
+	}
 
-	user, err := fs.DB.GetUser(userID)
+	users, err := selectUsers(fs.DB, selection)
 	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return err
 	}
 
-	matcher := face.NewMatcher(fs.DB)
-
-	fmt.Printf("\nVerifying image against user: %s\n", user.Name)
-	fmt.Printf("User ID: %s\n\n", userID)
-	fmt.Println("Detecting face...")
+	for i := range users {
+		fmt.Printf("\nVerifying image against user: %s\n", redactor.Label(&users[i]))
+		fmt.Printf("User ID: %s\n", redactor.UserID(users[i].ID))
+	}
 
-	result, err := fs.ProcessImage(imagePath)
+	result, err := verifyProbe(cfg, fs, probe)
 	if err != nil {
+		for i := range users {
+			startAudit(cfg, fs.DB, models.AuditVerify, users[i].ID).finish(err)
+		}
 		return err
 	}
 
-	fmt.Printf("✓ Face detected (quality: %.2f)\n", result.QualityScore)
+	printProbe(result, probe.RequireLiveness)
+
+	matcher := newVerifier(fs.Decay, fs.Strategy)
+	for i := range users {
+		if err := verifyUser(cfg, fs, matcher, redactor, &users[i], result, threshold, step, save); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyUser verifies the probe against one user, recording the result in
+// the audit log and, with save, the probe for review
+func verifyUser(cfg *config.Config, fs *FaceSystem, matcher *verifier, redactor *redaction.Redactor, user *models.User, result *FaceResult, threshold float64, step stepUpInput, save bool) (err error) {
+	audit := startAudit(cfg, fs.DB, models.AuditVerify, user.ID)
+	defer func() { audit.finish(err) }()
+	defer func() { saveProbe(fs, &audit.event, result, threshold, save, err) }()
 
-	if result.QualityScore < 0.2 {
-		fmt.Println("⚠ Warning: Low quality face detected, results may be inaccurate")
+	if user.Expired(time.Now()) {
+		audit.event.Result = models.AuditNoMatch
+		slog.Info("verification", "user_id", redactor.UserID(user.ID), "matched", false, "expired", true)
+		fmt.Println("\n─────────────────────────────────────")
+		fmt.Printf("✗ NOT VERIFIED - Visitor access of '%s' expired %s\n",
+			redactor.Label(user), user.ExpiresAt.Format("2006-01-02 15:04:05"))
+		return nil
 	}
 
-	matched, confidence, err := matcher.Verify(userID, result.Embedding, threshold)
+	matched, confidence, err := matcher.Verify(user, result.Embedding, threshold)
 	if err != nil {
 		return fmt.Errorf("verification failed: %w", err)
 	}
+	audit.event.Confidence = confidence
 
+	if matched {
+		if err := verifyStepUp(cfg, redactor, user, confidence, step); err != nil {
+			audit.event.Result, audit.event.Error = models.AuditFailed, string(apierror.CodeUnauthenticated)
+			slog.Info("verification", "user_id", redactor.UserID(user.ID), "matched", false, "confidence", confidence, "step_up", err.Error())
+			fmt.Println("\n─────────────────────────────────────")
+			fmt.Printf("✗ NOT VERIFIED - The face matches but the second factor failed: %v\n", err)
+			return nil
+		}
+	} else {
+		audit.event.Result = models.AuditNoMatch
+	}
+
+	slog.Info("verification", "user_id", redactor.UserID(user.ID), "matched", matched, "confidence", confidence, "threshold", threshold)
+	printVerification(redactor.User(user), redactor.Label(user), matched, confidence, threshold)
+	return nil
+}
+
+// verifyProbe detects the face to verify in the image file or, without one,
+// in the best of the camera's snapshots, checking its liveness if required
+func verifyProbe(cfg *config.Config, fs *FaceSystem, probe verifyProbeInput) (*FaceResult, error) {
+	if probe.ImagePath == "" {
+		return verifyCameraProbe(cfg, fs, probe)
+	}
+
+	fmt.Println("\nDetecting face...")
+	result, err := fs.ProcessImage(probe.ImagePath)
+	if err != nil {
+		return nil, err
+	}
+	if probe.RequireLiveness {
+		if err := checkLiveness(cfg, result.SpoofScore); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// verifyCameraProbe takes snapshots until one has a face of the minimum
+// quality, returning the best face seen if none does before the timeout.
+// Faces that fail a required liveness check are skipped.
+func verifyCameraProbe(cfg *config.Config, fs *FaceSystem, probe verifyProbeInput) (*FaceResult, error) {
+	until := time.Now().Add(probe.SampleFor)
+	fmt.Printf("\nTaking snapshots from camera %s until %s...\n", probe.Camera, until.Format("15:04:05"))
+
+	var best, spoofed *FaceResult
+	for attempt := 1; ; attempt++ {
+		result, err := processCameraSnapshot(cfg, fs, probe.Camera)
+		switch {
+		case errors.Is(err, models.ErrFaceNotDetected):
+			fmt.Printf("  • Attempt %d: no face\n", attempt)
+		case err != nil:
+			return nil, err
+		case probe.RequireLiveness && checkLiveness(cfg, result.SpoofScore) != nil:
+			fmt.Printf("  • Attempt %d: spoof score %.2f, not a live face\n", attempt, result.SpoofScore)
+			spoofed = result
+		case result.QualityScore >= probe.MinQuality:
+			return result, nil
+		default:
+			fmt.Printf("  • Attempt %d: quality %.2f\n", attempt, result.QualityScore)
+			printQualityHints("    ", result)
+			if best == nil || result.QualityScore > best.QualityScore {
+				best = result
+			}
+		}
+
+		if time.Now().Add(verifyRetryInterval).After(until) {
+			break
+		}
+		time.Sleep(verifyRetryInterval)
+	}
+
+	if best == nil && spoofed != nil {
+		return nil, checkLiveness(cfg, spoofed.SpoofScore)
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no face seen by camera %s within %s: %w", probe.Camera, probe.SampleFor, models.ErrFaceNotDetected)
+	}
+	fmt.Printf("⚠ No face reached quality %.2f within %s, verifying the best one\n", probe.MinQuality, probe.SampleFor)
+	return best, nil
+}
+
+// verifyStepUp checks the user's second factor if the verification needs
+// one
+func verifyStepUp(cfg *config.Config, redactor *redaction.Redactor, user *models.User, confidence float64, step stepUpInput) error {
+	if !step.Always && !cfg.StepUp().Required(user, confidence) {
+		return nil
+	}
+
+	fmt.Printf("\n• Step-up verification required for %s\n", redactor.Label(user))
+	if !stepup.HasFactor(user) {
+		return stepup.ErrNoFactor
+	}
+	code := step.Code
+	if code == "" {
+		var err error
+		prompt := "  PIN"
+		if user.TOTPSecret != "" {
+			prompt = "  Authenticator code"
+		}
+		if code, err = readSecret(prompt); err != nil {
+			return err
+		}
+	}
+	if err := stepup.Check(user, code); err != nil {
+		return err
+	}
+	fmt.Println("  ✓ Second factor accepted")
+	return nil
+}
+
+// printVerification prints the result of verifying against a user, already
+// redacted, referred to by label
+func printVerification(user *models.User, label string, matched bool, confidence, threshold float64) {
 	fmt.Println("\n─────────────────────────────────────")
 	if matched {
 		fmt.Println("✓ VERIFIED - Face matches the user!")
 		fmt.Printf("Confidence:  %.2f%%\n", confidence*100)
 		fmt.Printf("Threshold:   %.2f\n", threshold)
 		fmt.Printf("\nUser ID:     %s\n", user.ID)
-		fmt.Printf("Name:        %s\n", user.Name)
+		if user.Name != "" {
+			fmt.Printf("Name:        %s\n", user.Name)
+		}
 		if user.Email != "" {
 			fmt.Printf("Email:       %s\n", user.Email)
 		}
 		if user.Phone != "" {
 			fmt.Printf("Phone:       %s\n", user.Phone)
 		}
+		if user.Badge != "" {
+			fmt.Printf("Badge:       %s\n", user.Badge)
+		}
+		if user.CardNumber != "" {
+			fmt.Printf("Card number: %s\n", user.CardNumber)
+		}
 	} else {
 		fmt.Println("✗ NOT VERIFIED - Face does not match the user")
 		fmt.Printf("Confidence:  %.2f%%\n", confidence*100)
 		fmt.Printf("Threshold:   %.2f\n", threshold)
-		fmt.Printf("\nThe face in the image does not belong to user '%s'\n", user.Name)
+		fmt.Printf("\nThe face in the image does not belong to user '%s'\n", label)
 	}
-
-	return nil
 }
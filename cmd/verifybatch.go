@@ -0,0 +1,442 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/compression"
+	"face/internal/database/models"
+	"face/internal/redaction"
+
+	"github.com/spf13/cobra"
+)
+
+// maxVerifyBatchPairs bounds the pairs of a /verify-batch request
+const maxVerifyBatchPairs = 1000
+
+// verifyPair is a row of a pairs file: a user and an image to verify
+// against them. Line is its line in the file.
+type verifyPair struct {
+	Line   int
+	UserID string
+	Image  string
+}
+
+// verifyPairResult is the result of verifying one pair
+type verifyPairResult struct {
+	Line       int     `json:"line"`
+	UserID     string  `json:"user_id"`
+	Image      string  `json:"image"`
+	Verified   bool    `json:"verified"`
+	Confidence float64 `json:"confidence"`
+	Quality    float64 `json:"quality"`
+	// Reason is why a pair that was scored did not verify
+	Reason    string `json:"reason,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// confidenceStats summarizes the confidences of the scored pairs
+type confidenceStats struct {
+	Min    float64 `json:"min"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Max    float64 `json:"max"`
+}
+
+// verifyBatchReport is the report of 'face verify-batch' and /verify-batch
+type verifyBatchReport struct {
+	Threshold   float64 `json:"threshold"`
+	Pairs       int     `json:"pairs"`
+	Verified    int     `json:"verified"`
+	NotVerified int     `json:"not_verified"`
+	Errors      int     `json:"errors"`
+	// Confidence is left out when no pair was scored
+	Confidence *confidenceStats   `json:"confidence,omitempty"`
+	DurationMS int64              `json:"duration_ms"`
+	Results    []verifyPairResult `json:"results"`
+}
+
+func NewVerifyBatchCmd(cfg *config.Config) *cobra.Command {
+	var (
+		pairsPath string
+		output    string
+		format    string
+		workers   int
+		threshold float64
+		liveness  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify-batch",
+		Short: "Verify a file of user and image pairs and write a report",
+		Long: `Verify every pair of a CSV file of user IDs and image paths, e.g. to
+reconcile timesheet photos with the employees who clocked in, and write the
+results with summary statistics to a CSV or JSON report.
+
+Each row of --pairs is user_id,image_path; a first row of user_id,image_path
+is taken as a header. Relative image paths are relative to the pairs file.
+Pairs are verified --workers at a time, each worker with its own models.
+
+Each pair gets a row with whether it verified, the confidence, the face
+quality and, for pairs that did not verify, the reason (no_match or
+expired). Pairs that fail, e.g. an unknown user or an image without a face,
+get the stable error code and message of the failure instead, see 'face
+serve'; they do not stop the batch. Step-up rules do not apply. With
+--require-liveness (or "require_liveness": true in the config file), a face
+that looks like a printed photo or a screen fails its pair with
+spoof_detected.
+
+The format follows --format, or else the name of --output: JSON for .json,
+CSV otherwise; the CSV report has no summary, which is printed. Reports
+ending in .gz or .zst are compressed. User IDs in the report follow the
+configured redaction level.`,
+		Example: `  face verify-batch --pairs timesheet.csv --output report.csv
+  face verify-batch --pairs timesheet.csv --output report.json --workers 8
+  face verify-batch --pairs timesheet.csv --output report.csv.gz --threshold 0.8`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if workers < 1 {
+				return errors.New("--workers must be at least 1")
+			}
+			return runVerifyBatch(cfg, pairsPath, output, format, workers, threshold, liveness)
+		},
+	}
+
+	cmd.Flags().StringVarP(&pairsPath, "pairs", "p", "", "CSV file of user_id,image_path rows")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "report file to write")
+	cmd.Flags().StringVar(&format, "format", "", "report format: csv or json (default from the --output name)")
+	cmd.Flags().IntVarP(&workers, "workers", "w", 4, "pairs verified at once, each worker loads its own models")
+	cmd.Flags().Float64VarP(&threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	cmd.Flags().BoolVar(&liveness, "require-liveness", cfg.RequireLiveness, "reject faces that look like a printed photo or a screen")
+	cmd.MarkFlagRequired("pairs")
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+func runVerifyBatch(cfg *config.Config, pairsPath, output, format string, workers int, threshold float64, requireLiveness bool) error {
+	if format == "" {
+		format = batchFormat(output)
+	}
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(pairsPath)
+	if err != nil {
+		return fmt.Errorf("failed to open pairs file: %w", err)
+	}
+	pairs, err := parseVerifyPairs(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return fmt.Errorf("no pairs in %s", pairsPath)
+	}
+
+	fmt.Println("Initializing face verification system...")
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	pool, err := newWorkerPool(cfg, fs, min(workers, len(pairs)), 0)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	fmt.Printf("Verifying %d pair(s) with %d worker(s)...\n\n", len(pairs), pool.Size())
+
+	dir := filepath.Dir(pairsPath)
+	verifier := &pairVerifier{pool: pool, threshold: threshold, open: func(image string) (io.ReadSeekCloser, error) {
+		if !filepath.IsAbs(image) {
+			image = filepath.Join(dir, image)
+		}
+		return os.Open(image)
+	}}
+	if requireLiveness {
+		verifier.liveness = cfg
+	}
+	report, err := verifier.run(context.Background(), pairs)
+	if err != nil {
+		return err
+	}
+
+	for i := range report.Results {
+		result := &report.Results[i]
+		audit := startAudit(cfg, fs.DB, models.AuditVerify, result.UserID)
+		setPairAuditResult(&audit.event, result)
+		audit.finish(nil)
+
+		result.UserID = redactor.UserID(result.UserID)
+		printPairResult(result)
+	}
+
+	if err := writeVerifyBatchReport(output, format, report); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ %d pair(s): %d verified, %d not verified, %d failed\n",
+		report.Pairs, report.Verified, report.NotVerified, report.Errors)
+	if c := report.Confidence; c != nil {
+		fmt.Printf("  Confidence: min %.2f%%, mean %.2f%%, median %.2f%%, max %.2f%%\n", c.Min*100, c.Mean*100, c.Median*100, c.Max*100)
+	}
+	fmt.Printf("✓ Report written to %s\n", output)
+	return nil
+}
+
+// parseVerifyPairs reads user_id,image rows, skipping a header row and
+// blank lines
+func parseVerifyPairs(r io.Reader) ([]verifyPair, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var pairs []verifyPair
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return pairs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid pairs CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(pairs) == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "user_id") {
+			continue
+		}
+
+		pair := verifyPair{Line: line, UserID: strings.TrimSpace(record[0]), Image: strings.TrimSpace(record[1])}
+		if pair.UserID == "" || pair.Image == "" {
+			return nil, fmt.Errorf("invalid pairs CSV: line %d needs a user ID and an image", line)
+		}
+		pairs = append(pairs, pair)
+	}
+}
+
+// pairVerifier verifies the pairs of a batch on the workers of a pool
+type pairVerifier struct {
+	pool      *workerPool
+	threshold float64
+	// liveness is the config whose spoof threshold faces must pass, nil to
+	// not check liveness
+	liveness *config.Config
+	// scope is the scope of the client, users outside of it are not found;
+	// everyone if empty
+	scope string
+	// open opens the image of a pair
+	open func(image string) (io.ReadSeekCloser, error)
+}
+
+// run verifies the pairs on as many workers as are idle, at least one,
+// returning the results in the order of the pairs
+func (v *pairVerifier) run(ctx context.Context, pairs []verifyPair) (*verifyBatchReport, error) {
+	started := time.Now()
+
+	first, err := v.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	workers := []*FaceSystem{first}
+	for len(workers) < len(pairs) {
+		worker := v.pool.TryAcquire(ctx)
+		if worker == nil {
+			break
+		}
+		workers = append(workers, worker)
+	}
+
+	report := &verifyBatchReport{Threshold: v.threshold, Pairs: len(pairs), Results: make([]verifyPairResult, len(pairs))}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer v.pool.Release(worker)
+			for i := range next {
+				report.Results[i] = v.verify(worker, pairs[i])
+			}
+		}()
+	}
+	for i := range pairs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	report.summarize()
+	report.DurationMS = time.Since(started).Milliseconds()
+	return report, nil
+}
+
+// verify verifies one pair, reporting failures in the result with the
+// error codes of the API
+func (v *pairVerifier) verify(fs *FaceSystem, pair verifyPair) verifyPairResult {
+	result := verifyPairResult{Line: pair.Line, UserID: pair.UserID, Image: pair.Image}
+	fail := func(err error) verifyPairResult {
+		result.ErrorCode = string(apierror.From(err).Code)
+		result.Error = err.Error()
+		return result
+	}
+
+	user, err := fs.DB.GetUser(pair.UserID)
+	if err == nil && !user.InScope(v.scope) {
+		err = models.ErrUserNotFound
+	}
+	if err != nil {
+		return fail(err)
+	}
+	file, err := v.open(pair.Image)
+	if err != nil {
+		return fail(apierror.Wrap(apierror.CodeInvalidArgument, fmt.Errorf("failed to open image: %w", err)))
+	}
+	defer file.Close()
+
+	verification, err := verifyUpload(fs, user, file, v.threshold)
+	if err == nil && v.liveness != nil {
+		err = checkLiveness(v.liveness, verification.SpoofScore)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	result.Verified = verification.Verified
+	result.Confidence = verification.Confidence
+	result.Quality = verification.Quality
+	result.Reason = verification.Reason
+	return result
+}
+
+// summarize counts the results and computes the confidence statistics of
+// the pairs that were scored
+func (r *verifyBatchReport) summarize() {
+	var confidences []float64
+	for _, result := range r.Results {
+		switch {
+		case result.ErrorCode != "":
+			r.Errors++
+			continue
+		case result.Verified:
+			r.Verified++
+		default:
+			r.NotVerified++
+		}
+		if result.Reason != reasonExpired {
+			confidences = append(confidences, result.Confidence)
+		}
+	}
+	r.Confidence = summarizeConfidences(confidences)
+}
+
+// summarizeConfidences returns the statistics of confidences, or nil if
+// there are none
+func summarizeConfidences(confidences []float64) *confidenceStats {
+	if len(confidences) == 0 {
+		return nil
+	}
+
+	confidences = slices.Sorted(slices.Values(confidences))
+	stats := &confidenceStats{Min: confidences[0], Max: confidences[len(confidences)-1]}
+	for _, c := range confidences {
+		stats.Mean += c
+	}
+	stats.Mean /= float64(len(confidences))
+	mid := len(confidences) / 2
+	stats.Median = confidences[mid]
+	if len(confidences)%2 == 0 {
+		stats.Median = (confidences[mid-1] + confidences[mid]) / 2
+	}
+	return stats
+}
+
+// setPairAuditResult sets the audit event of a verified pair
+func setPairAuditResult(event *models.AuditEvent, result *verifyPairResult) {
+	event.Confidence = result.Confidence
+	switch {
+	case result.ErrorCode != "":
+		event.Result, event.Error = models.AuditFailed, result.ErrorCode
+	case result.Verified:
+		event.Result = models.AuditSucceeded
+	case result.Reason == reasonNoMatch:
+		event.Result = models.AuditNoMatch
+	default:
+		event.Result, event.Error = models.AuditFailed, result.Reason
+	}
+}
+
+// redactPairResults applies a redaction level to the user IDs of results
+func redactPairResults(redactor *redaction.Redactor, results []verifyPairResult) {
+	for i := range results {
+		results[i].UserID = redactor.UserID(results[i].UserID)
+	}
+}
+
+func printPairResult(result *verifyPairResult) {
+	label := fmt.Sprintf("line %d: %s / %s", result.Line, result.UserID, result.Image)
+	switch {
+	case result.ErrorCode != "":
+		fmt.Printf("  ⚠ %s: %s\n", label, result.Error)
+	case result.Verified:
+		fmt.Printf("  ✓ %s (%.2f%%)\n", label, result.Confidence*100)
+	default:
+		fmt.Printf("  ✗ %s: %s (%.2f%%)\n", label, result.Reason, result.Confidence*100)
+	}
+}
+
+func writeVerifyBatchReport(output, format string, report *verifyBatchReport) error {
+	var data []byte
+	if format == "json" {
+		jsonData, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		data = append(jsonData, '\n')
+	} else {
+		data = verifyBatchCSV(report.Results)
+	}
+
+	if err := compression.WriteFile(output, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// verifyBatchCSV returns the results as CSV. The confidence and quality of
+// failed pairs are left empty.
+func verifyBatchCSV(results []verifyPairResult) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"line", "user_id", "image", "verified", "confidence", "quality", "reason", "error_code", "error"})
+	for _, r := range results {
+		confidence, quality := "", ""
+		if r.ErrorCode == "" {
+			confidence = strconv.FormatFloat(r.Confidence, 'f', 4, 64)
+			quality = strconv.FormatFloat(r.Quality, 'f', 4, 64)
+		}
+		w.Write([]string{strconv.Itoa(r.Line), r.UserID, r.Image, strconv.FormatBool(r.Verified), confidence, quality, r.Reason, r.ErrorCode, r.Error})
+	}
+	w.Flush()
+	return buf.Bytes()
+}
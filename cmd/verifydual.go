@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/redaction"
+
+	"github.com/spf13/cobra"
+)
+
+// dualPollInterval is how often the camera is checked in dual verification
+const dualPollInterval = time.Second
+
+// dualOptions are the settings of a dual verification
+type dualOptions struct {
+	Threshold float64
+	// Window is the longest time allowed between the two verifications
+	Window time.Duration
+	// Timeout bounds how long the camera is watched
+	Timeout time.Duration
+	// StepUp requires a second factor of both users regardless of the
+	// config's rules
+	StepUp bool
+	// Codes are the PINs or authenticator codes of user A and user B, asked
+	// for if empty
+	Codes [2]string
+	// RequireLiveness skips faces that score as spoofs
+	RequireLiveness bool
+}
+
+// dualParty is one of the two people of a dual verification
+type dualParty struct {
+	user *models.User
+	// label refers to the user in output, see redaction.Redactor.Label
+	label string
+	// verifiedAt is when the user's face was last verified, zero if not yet
+	verifiedAt time.Time
+	confidence float64
+	// stepUp is why the user's second factor failed, nil if it passed or
+	// was not needed
+	stepUp error
+}
+
+// dualVerifyFunc verifies an embedding against a party
+type dualVerifyFunc func(p *dualParty, embedding []float32) (matched bool, confidence float64, err error)
+
+func NewVerifyDualCmd(cfg *config.Config) *cobra.Command {
+	var (
+		ids    [2]string
+		images string
+		camera string
+		opts   dualOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "verify-dual",
+		Short: "Require two people to verify before granting access",
+		Long: `Verify two different users, for vaults, server rooms and other places that may
+only be entered by two authorized people together. Success is only reported
+when both users verify within --window of each other; otherwise the command
+fails with a non-zero exit status.
+
+With --images, the first image is verified against --user-a and the second
+against --user-b. The images must have been taken within the window, judged
+by their modification times, as with snapshots saved by a door camera.
+
+With --camera, snapshots are taken from a configured camera (see 'face
+cameras') until both users have shown their faces within the window, or
+--timeout passes.
+
+With --require-liveness (or "require_liveness": true in the config file), a
+face that looks like a printed photo or a screen does not verify.
+
+Step-up verification applies to each user as in 'face verify': once both
+faces verified, the users whose step_up rules require it, or both with
+--step-up, must give their PIN or authenticator code, with --code-a and
+--code-b or when asked.
+
+Expired visitors cannot take part in a dual verification.`,
+		Example: `  face verify-dual --user-a abc123 --user-b def456 --images a.jpg,b.jpg
+  face verify-dual --user-a abc123 --user-b def456 --camera vault --window 1m
+  face verify-dual --user-a abc123 --user-b def456 --images a.jpg,b.jpg --step-up`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Window <= 0 || opts.Timeout <= 0 {
+				return errors.New("--window and --timeout must be positive")
+			}
+			return runVerifyDual(cfg, ids, images, camera, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&ids[0], "user-a", "", "ID or unique prefix of the first user (required)")
+	cmd.Flags().StringVar(&ids[1], "user-b", "", "ID or unique prefix of the second user (required)")
+	cmd.Flags().StringVarP(&images, "images", "i", "", "two comma-separated images, of user A and user B")
+	cmd.Flags().StringVar(&camera, "camera", "", "configured camera to watch instead of images")
+	cmd.Flags().Float64VarP(&opts.Threshold, "threshold", "t", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	cmd.Flags().DurationVar(&opts.Window, "window", 30*time.Second, "longest time allowed between the two verifications")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 2*time.Minute, "how long to watch the camera")
+	cmd.Flags().BoolVar(&opts.RequireLiveness, "require-liveness", cfg.RequireLiveness, "reject faces that look like a printed photo or a screen")
+	cmd.Flags().BoolVar(&opts.StepUp, "step-up", false, "require the PIN or authenticator code of both users too")
+	cmd.Flags().StringVar(&opts.Codes[0], "code-a", "", "PIN or authenticator code of user A for step-up verification")
+	cmd.Flags().StringVar(&opts.Codes[1], "code-b", "", "PIN or authenticator code of user B for step-up verification")
+	_ = cmd.MarkFlagRequired("user-a")
+	_ = cmd.MarkFlagRequired("user-b")
+	cmd.MarkFlagsOneRequired("images", "camera")
+	cmd.MarkFlagsMutuallyExclusive("images", "camera")
+
+	return cmd
+}
+
+func runVerifyDual(cfg *config.Config, ids [2]string, images, camera string, opts dualOptions) error {
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Initializing face verification system...")
+
+	fs, err := NewFaceSystem(cfg)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	parties, err := dualParties(fs.DB, redactor, ids)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nUser A: %s (%s)\n", parties[0].label, redactor.UserID(parties[0].user.ID))
+	fmt.Printf("User B: %s (%s)\n", parties[1].label, redactor.UserID(parties[1].user.ID))
+
+	matcher := newVerifier(fs.Decay, fs.Strategy)
+	verify := func(p *dualParty, embedding []float32) (bool, float64, error) {
+		return matcher.Verify(p.user, embedding, opts.Threshold)
+	}
+
+	if images != "" {
+		err = verifyDualImages(cfg, fs, parties, images, opts, verify)
+	} else {
+		err = verifyDualCamera(cfg, fs, parties, camera, opts, verify)
+	}
+	if err == nil {
+		dualStepUp(cfg, redactor, parties, opts)
+	}
+	auditDual(cfg, fs, parties, err)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	return reportDual(redactor, parties, opts)
+}
+
+// auditDual records the verification of each party in the audit log
+func auditDual(cfg *config.Config, fs *FaceSystem, parties []*dualParty, err error) {
+	for _, p := range parties {
+		audit := startAudit(cfg, fs.DB, models.AuditVerify, p.user.ID)
+		switch {
+		case p.stepUp != nil:
+			audit.event.Result, audit.event.Error = models.AuditFailed, string(apierror.CodeUnauthenticated)
+		case p.verifiedAt.IsZero():
+			audit.event.Result = models.AuditNoMatch
+		}
+		audit.event.Confidence = p.confidence
+		audit.finish(err)
+	}
+}
+
+// dualStepUp checks the second factor of each party that needs one, once
+// both verified within the window. A party whose second factor fails is no
+// longer verified.
+func dualStepUp(cfg *config.Config, redactor *redaction.Redactor, parties []*dualParty, opts dualOptions) {
+	if !dualComplete(parties, opts.Window) {
+		return
+	}
+	for i, p := range parties {
+		step := stepUpInput{Always: opts.StepUp, Code: opts.Codes[i]}
+		if err := verifyStepUp(cfg, redactor, p.user, p.confidence, step); err != nil {
+			slog.Info("verification", "user_id", redactor.UserID(p.user.ID), "matched", false, "confidence", p.confidence, "step_up", err.Error())
+			fmt.Printf("  ✗ The face of %s matches but the second factor failed: %v\n", p.label, err)
+			p.verifiedAt, p.stepUp = time.Time{}, err
+		}
+	}
+}
+
+// dualParties looks up the two users, who must be different and must not
+// be expired visitors
+func dualParties(db database.Database, redactor *redaction.Redactor, ids [2]string) ([]*dualParty, error) {
+	parties := make([]*dualParty, len(ids))
+	for i, id := range ids {
+		user, err := database.GetUserByIDPrefix(db, id)
+		if err != nil {
+			return nil, fmt.Errorf("user not found: %w", err)
+		}
+		if user.Expired(time.Now()) {
+			return nil, fmt.Errorf("visitor access of '%s' expired %s", redactor.Label(user), user.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+		parties[i] = &dualParty{user: user, label: redactor.Label(user)}
+	}
+
+	if parties[0].user.ID == parties[1].user.ID {
+		return nil, errors.New("--user-a and --user-b must be different users")
+	}
+	return parties, nil
+}
+
+// verifyDualImages verifies each image against its party. A verification
+// counts from the time the image was taken.
+func verifyDualImages(cfg *config.Config, fs *FaceSystem, parties []*dualParty, images string, opts dualOptions, verify dualVerifyFunc) error {
+	paths := strings.Split(images, ",")
+	if len(paths) != len(parties) {
+		return errors.New("--images needs exactly two images, one of each user")
+	}
+
+	for i, path := range paths {
+		path = strings.TrimSpace(path)
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to load image: %w", err)
+		}
+
+		fmt.Printf("\nVerifying %s against %s...\n", path, parties[i].label)
+		result, err := fs.ProcessImage(path)
+		if err == nil && opts.RequireLiveness {
+			err = checkLiveness(cfg, result.SpoofScore)
+		}
+		if err != nil {
+			fmt.Printf("  ✗ %v\n", err)
+			continue
+		}
+
+		matched, confidence, err := verify(parties[i], result.Embedding)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			fmt.Printf("  ✗ Face does not match (confidence %.2f%%)\n", confidence*100)
+			continue
+		}
+		parties[i].verifiedAt, parties[i].confidence = info.ModTime(), confidence
+		fmt.Printf("  ✓ Verified (confidence %.2f%%, taken %s)\n", confidence*100, info.ModTime().Format("15:04:05"))
+	}
+	return nil
+}
+
+// verifyDualCamera watches a camera until both parties have verified within
+// the window or the timeout passes. Faces that fail a required liveness
+// check are skipped.
+func verifyDualCamera(cfg *config.Config, fs *FaceSystem, parties []*dualParty, camera string, opts dualOptions, verify dualVerifyFunc) error {
+	deadline := time.Now().Add(opts.Timeout)
+	fmt.Printf("\nWatching camera %s until %s...\n", camera, deadline.Format("15:04:05"))
+
+	for time.Now().Before(deadline) && !dualComplete(parties, opts.Window) {
+		result, err := processCameraSnapshot(cfg, fs, camera)
+		switch {
+		case errors.Is(err, models.ErrFaceNotDetected):
+			// Nobody in front of the camera
+		case err != nil:
+			return err
+		case opts.RequireLiveness && checkLiveness(cfg, result.SpoofScore) != nil:
+			fmt.Printf("  • Spoof score %.2f, not a live face\n", result.SpoofScore)
+		default:
+			if err := verifyDualProbe(parties, result.Embedding, time.Now(), opts.Window, verify); err != nil {
+				return err
+			}
+		}
+		time.Sleep(dualPollInterval)
+	}
+	return nil
+}
+
+// verifyDualProbe records which party, if any, a camera probe verifies as
+func verifyDualProbe(parties []*dualParty, embedding []float32, now time.Time, window time.Duration, verify dualVerifyFunc) error {
+	var best *dualParty
+	bestConfidence := 0.0
+	for _, p := range parties {
+		matched, confidence, err := verify(p, embedding)
+		if err != nil {
+			return err
+		}
+		if matched && confidence > bestConfidence {
+			best, bestConfidence = p, confidence
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	// Only report a party again once their last verification has lapsed
+	if best.verifiedAt.IsZero() || now.Sub(best.verifiedAt) > window {
+		fmt.Printf("  ✓ %s verified at %s (confidence %.2f%%)\n", best.label, now.Format("15:04:05"), bestConfidence*100)
+	}
+	best.verifiedAt, best.confidence = now, bestConfidence
+	return nil
+}
+
+// dualComplete reports whether both parties verified within the window
+func dualComplete(parties []*dualParty, window time.Duration) bool {
+	for _, p := range parties {
+		if p.verifiedAt.IsZero() {
+			return false
+		}
+	}
+	return dualGap(parties) <= window
+}
+
+// dualGap returns the time between the two verifications
+func dualGap(parties []*dualParty) time.Duration {
+	gap := parties[1].verifiedAt.Sub(parties[0].verifiedAt)
+	if gap < 0 {
+		gap = -gap
+	}
+	return gap
+}
+
+// reportDual prints the outcome, failing unless both parties verified
+// within the window
+func reportDual(redactor *redaction.Redactor, parties []*dualParty, opts dualOptions) error {
+	a, b := parties[0], parties[1]
+	verified := dualComplete(parties, opts.Window)
+	slog.Info("dual verification", "user_a", redactor.UserID(a.user.ID), "user_b", redactor.UserID(b.user.ID), "verified", verified, "threshold", opts.Threshold)
+
+	fmt.Println("\n─────────────────────────────────────")
+	if verified {
+		fmt.Println("✓ DUAL VERIFIED - Both users are present")
+		fmt.Printf("User A:      %s (%.2f%%)\n", a.label, a.confidence*100)
+		fmt.Printf("User B:      %s (%.2f%%)\n", b.label, b.confidence*100)
+		fmt.Printf("Gap:         %s (window %s)\n", dualGap(parties).Round(time.Second), opts.Window)
+		return nil
+	}
+
+	fmt.Println("✗ NOT VERIFIED - Both users must verify")
+	var missing []string
+	for _, p := range parties {
+		switch {
+		case p.stepUp != nil:
+			missing = append(missing, p.label+" (second factor failed)")
+		case p.verifiedAt.IsZero():
+			missing = append(missing, p.label)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("Not verified: %s\n", strings.Join(missing, ", "))
+	} else {
+		fmt.Printf("Verified %s apart, more than the %s window\n", dualGap(parties).Round(time.Second), opts.Window)
+	}
+	return errors.New("dual verification failed")
+}
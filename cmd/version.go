@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	facev1 "face/api/face/v1"
+	"face/config"
+	"face/internal/database"
+	"face/internal/gallery"
+	"face/internal/hooks"
+	"face/internal/modelfiles"
+	"face/internal/pipeline/modelspec"
+	"face/internal/samples"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/spf13/cobra"
+)
+
+// restAPIVersion is the version of the REST API, info.version of
+// api/openapi.yaml
+const restAPIVersion = "1.0.0"
+
+// driverModules are the Go modules behind each database type
+var driverModules = map[database.DatabaseType][]string{
+	database.DatabaseTypeSQLite:   {"gorm.io/gorm", "gorm.io/driver/sqlite", "github.com/golang-migrate/migrate/v4"},
+	database.DatabaseTypePostgres: {"gorm.io/gorm", "gorm.io/driver/postgres", "github.com/jackc/pgx/v5", "github.com/golang-migrate/migrate/v4"},
+	database.DatabaseTypeBolt:     {"go.etcd.io/bbolt"},
+}
+
+// sqliteDriverModules are the modules of the SQLite drivers
+var sqliteDriverModules = map[string]string{
+	database.SQLiteDriverCGO:    "github.com/mattn/go-sqlite3",
+	database.SQLiteDriverPureGo: "modernc.org/sqlite",
+}
+
+// versionInfo is the output of 'face version'
+type versionInfo struct {
+	Version    string          `json:"version"`
+	Commit     string          `json:"commit,omitempty"`
+	CommitTime string          `json:"commit_time,omitempty"`
+	Modified   bool            `json:"modified,omitempty"`
+	GoVersion  string          `json:"go_version"`
+	Platform   string          `json:"platform"`
+	Database   versionDatabase `json:"database"`
+	Pipeline   versionPipeline `json:"pipeline"`
+	APIs       versionAPIs     `json:"apis"`
+	// Errors are the parts that could not be determined
+	Errors []string `json:"errors,omitempty"`
+}
+
+type versionDatabase struct {
+	Type string `json:"type"`
+	// SQLiteDriver is cgo or purego
+	SQLiteDriver  string `json:"sqlite_driver,omitempty"`
+	ServerVersion string `json:"server_version,omitempty"`
+	// SchemaVersion is the applied migration, nil for databases without
+	// migrations or none applied
+	SchemaVersion *uint `json:"schema_version,omitempty"`
+	SchemaDirty   bool  `json:"schema_dirty,omitempty"`
+	// LatestSchemaVersion is the newest migration this binary carries
+	LatestSchemaVersion uint `json:"latest_schema_version,omitempty"`
+	// EmbeddingModel and EmbeddingDimension are the model and dimension of
+	// the stored embeddings
+	EmbeddingModel     string `json:"embedding_model,omitempty"`
+	EmbeddingDimension int    `json:"embedding_dimension,omitempty"`
+	// Modules are the versions of the Go modules of the driver
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+type versionPipeline struct {
+	Backend string `json:"backend"`
+	// EmbeddingModel is the model the pipeline computes embeddings with, as
+	// recorded with the gallery
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	// EmbeddingDimension is the dimension of the embeddings the pipeline
+	// extracts
+	EmbeddingDimension int            `json:"embedding_dimension,omitempty"`
+	Models             []versionModel `json:"models,omitempty"`
+	// Hooks are the custom stages compiled in, in the order they run
+	Hooks []string `json:"hooks,omitempty"`
+}
+
+// versionModel is a model file of the pipeline
+type versionModel struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Present bool   `json:"present"`
+	SHA256  string `json:"sha256,omitempty"`
+	// Expected is the checksum of the released file, so Valid tells
+	// whether the deployment runs the model it should
+	Expected string `json:"expected_sha256"`
+	Valid    bool   `json:"valid"`
+}
+
+type versionAPIs struct {
+	REST          string `json:"rest"`
+	GRPC          string `json:"grpc"`
+	DeepStack     string `json:"deepstack"`
+	GalleryBundle int    `json:"gallery_bundle"`
+}
+
+func NewVersionCmd(cfg *config.Config) *cobra.Command {
+	var formatJSON bool
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show what exactly this deployment is running",
+		Long: `Show the versions of everything that decides how this deployment behaves,
+to tell support or to check that two installations are compatible:
+
+  - the binary: version, commit, Go version and platform
+  - the database: type, server version, applied and newest schema
+    migration, dimension of the stored embeddings and driver versions
+  - the pipeline: backend, embedding dimension, the checksums of the
+    model files, compared with the released ones, and the hooks compiled in
+  - the API versions served: REST, gRPC, DeepStack and gallery bundles
+
+Nothing is created or changed; parts that cannot be determined, e.g.
+because the database is unreachable, are listed as errors.`,
+		Example: `  face version
+  face version --json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVersion(cfg, cmd.Root().Version, formatJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&formatJSON, "json", false, "output in JSON format")
+
+	return cmd
+}
+
+func runVersion(cfg *config.Config, version string, formatJSON bool) error {
+	info := &versionInfo{
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		APIs: versionAPIs{
+			REST:          restAPIVersion,
+			GRPC:          facev1.FaceService_ServiceDesc.ServiceName,
+			DeepStack:     "v1",
+			GalleryBundle: gallery.FormatVersion,
+		},
+	}
+	build, _ := debug.ReadBuildInfo()
+	if build != nil {
+		collectVersionBuild(info, build)
+	}
+	collectVersionDatabase(cfg, info, build)
+	collectVersionPipeline(cfg, info)
+
+	if formatJSON {
+		jsonData, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format JSON: %w", err)
+		}
+		fmt.Println(string(jsonData))
+		return nil
+	}
+	printVersion(info)
+	return nil
+}
+
+func collectVersionBuild(info *versionInfo, build *debug.BuildInfo) {
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+}
+
+func collectVersionDatabase(cfg *config.Config, info *versionInfo, build *debug.BuildInfo) {
+	d := &info.Database
+	d.Type = string(cfg.DatabaseType)
+	modules := driverModules[cfg.DatabaseType]
+	if cfg.DatabaseType == database.DatabaseTypeSQLite {
+		d.SQLiteDriver = cfg.DatabaseOptions().SQLiteDriverInUse()
+		modules = append(modules, sqliteDriverModules[d.SQLiteDriver])
+	}
+	if build != nil {
+		d.Modules = moduleVersions(build, modules)
+	}
+	if cfg.DatabaseType.UsesMigrations() {
+		latest, err := database.LatestMigration()
+		if err != nil {
+			info.Errors = append(info.Errors, err.Error())
+		}
+		d.LatestSchemaVersion = latest
+	}
+
+	// opening a file database that does not exist would create it
+	if cfg.DatabaseType != database.DatabaseTypePostgres {
+		if _, err := os.Stat(cfg.DatabasePath); err != nil {
+			info.Errors = append(info.Errors, fmt.Sprintf("database %s: %v", cfg.DatabasePath, err))
+			return
+		}
+	}
+
+	if cfg.DatabaseType.UsesMigrations() {
+		collectVersionSchema(cfg, info)
+	}
+
+	db, err := cfg.GetDatabaseConnection()
+	if err != nil {
+		info.Errors = append(info.Errors, err.Error())
+		return
+	}
+	defer db.Close()
+
+	if v, ok := db.(database.ServerVersioner); ok {
+		if d.ServerVersion, err = v.ServerVersion(); err != nil {
+			info.Errors = append(info.Errors, err.Error())
+		}
+	}
+	if settings, err := db.GetSettings(); err != nil {
+		info.Errors = append(info.Errors, err.Error())
+	} else {
+		d.EmbeddingModel, d.EmbeddingDimension = settings.EmbeddingModel, settings.EmbeddingDimension
+	}
+}
+
+func collectVersionSchema(cfg *config.Config, info *versionInfo) {
+	migrator, err := cfg.GetMigrator()
+	if err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("failed to create migrator: %v", err))
+		return
+	}
+	defer migrator.Close()
+
+	version, dirty, err := migrator.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return
+	}
+	if err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("failed to get schema version: %v", err))
+		return
+	}
+	info.Database.SchemaVersion = &version
+	info.Database.SchemaDirty = dirty
+}
+
+// moduleVersions returns the versions of the modules the binary was built
+// with, of those among paths
+func moduleVersions(build *debug.BuildInfo, paths []string) map[string]string {
+	versions := make(map[string]string)
+	for _, dep := range build.Deps {
+		for _, path := range paths {
+			if dep.Path != path {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			versions[path] = dep.Version
+		}
+	}
+	return versions
+}
+
+func collectVersionPipeline(cfg *config.Config, info *versionInfo) {
+	cfg = cfg.WithGalleryModel(info.Database.EmbeddingModel)
+	p := &info.Pipeline
+	backend, err := modelspec.ParseBackend(cfg.PipelineBackend)
+	if err != nil {
+		info.Errors = append(info.Errors, err.Error())
+		return
+	}
+	p.Backend = string(backend)
+	p.Hooks = hooks.Names()
+	if p.EmbeddingModel, _, err = cfg.Embedding(); err != nil {
+		info.Errors = append(info.Errors, err.Error())
+	}
+
+	if backend == modelspec.BackendPigo {
+		statuses, err := modelfiles.Check(cfg.ModelsDir)
+		if err != nil {
+			info.Errors = append(info.Errors, err.Error())
+		}
+		for i := range statuses {
+			s := &statuses[i]
+			p.Models = append(p.Models, versionModel{
+				Name:     s.File.Name,
+				Path:     s.Path,
+				Present:  s.Present,
+				SHA256:   s.SHA256,
+				Expected: s.File.SHA256,
+				Valid:    s.Valid(),
+			})
+		}
+	}
+
+	// the dimension is that of an embedding of a synthetic face
+	detector, extractor, err := newPipeline(cfg)
+	if err != nil {
+		info.Errors = append(info.Errors, err.Error())
+		return
+	}
+	defer detector.Close()
+	defer extractor.Close()
+	embedding, err := extractor.Extract(samples.Face(1))
+	if err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("failed to extract an embedding: %v", err))
+		return
+	}
+	p.EmbeddingDimension = len(embedding)
+}
+
+func printVersion(info *versionInfo) {
+	fmt.Printf("face %s\n", info.Version)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = ", modified"
+		}
+		fmt.Printf("  Commit:   %s (%s%s)\n", info.Commit, info.CommitTime, modified)
+	}
+	fmt.Printf("  Go:       %s %s\n", info.GoVersion, info.Platform)
+
+	d := info.Database
+	fmt.Printf("\nDatabase:   %s\n", d.Type)
+	if d.SQLiteDriver != "" {
+		fmt.Printf("  Driver:   %s\n", d.SQLiteDriver)
+	}
+	if d.ServerVersion != "" {
+		fmt.Printf("  Server:   %s\n", d.ServerVersion)
+	}
+	if d.LatestSchemaVersion > 0 {
+		fmt.Printf("  Schema:   %s (latest %d)\n", schemaLabel(d), d.LatestSchemaVersion)
+	}
+	if d.EmbeddingDimension > 0 {
+		fmt.Printf("  Stored embeddings: %d-d, %s\n", d.EmbeddingDimension, d.EmbeddingModel)
+	}
+	for _, path := range sortedKeys(d.Modules) {
+		fmt.Printf("  %s %s\n", path, d.Modules[path])
+	}
+
+	p := info.Pipeline
+	fmt.Printf("\nPipeline:   %s\n", p.Backend)
+	if p.EmbeddingDimension > 0 {
+		fmt.Printf("  Embeddings: %d-d, %s\n", p.EmbeddingDimension, p.EmbeddingModel)
+	}
+	for _, m := range p.Models {
+		switch {
+		case !m.Present:
+			fmt.Printf("  ✗ %s: missing (%s)\n", m.Name, m.Path)
+		case m.Valid:
+			fmt.Printf("  ✓ %s: sha256 %s\n", m.Name, m.SHA256)
+		default:
+			fmt.Printf("  ✗ %s: sha256 %s, expected %s\n", m.Name, m.SHA256, m.Expected)
+		}
+	}
+	if len(p.Hooks) > 0 {
+		fmt.Printf("  Hooks:    %s\n", strings.Join(p.Hooks, ", "))
+	}
+
+	a := info.APIs
+	fmt.Printf("\nAPIs:       REST %s, gRPC %s, DeepStack %s, gallery bundle v%d\n", a.REST, a.GRPC, a.DeepStack, a.GalleryBundle)
+
+	if len(info.Errors) > 0 {
+		fmt.Println("\nCould not determine:")
+		for _, e := range info.Errors {
+			fmt.Printf("  ⚠ %s\n", e)
+		}
+	}
+}
+
+func schemaLabel(d versionDatabase) string {
+	switch {
+	case d.SchemaVersion == nil:
+		return "no migrations applied"
+	case d.SchemaDirty:
+		return fmt.Sprintf("version %d (dirty)", *d.SchemaVersion)
+	default:
+		return fmt.Sprintf("version %d", *d.SchemaVersion)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+
+	"face/config"
+	"face/internal/apierror"
+	"face/internal/deadline"
+)
+
+// errServerBusy is returned when every worker is busy and the queue is full
+var errServerBusy = apierror.New(apierror.CodeBusy, "server busy, try again later").
+	WithDetail("retry_after_seconds", serveRetryAfter)
+
+// workerPool bounds how many images are processed at once. Detectors and
+// extractors are not safe for concurrent use, so each worker is a copy of
+// the FaceSystem with its own; the database and storage are shared.
+type workerPool struct {
+	idle chan *FaceSystem
+	// slots holds a token for every request running or waiting for a
+	// worker, so the queue length is bounded
+	slots chan struct{}
+	// owned are the workers whose detector and extractor the pool closes
+	owned []*FaceSystem
+}
+
+// newWorkerPool creates a pool of n workers, the first of which is fs, with
+// room for queue requests waiting
+func newWorkerPool(cfg *config.Config, fs *FaceSystem, n, queue int) (*workerPool, error) {
+	p := &workerPool{
+		idle:  make(chan *FaceSystem, n),
+		slots: make(chan struct{}, n+queue),
+	}
+	if fs.stages == nil {
+		fs.stages = new(sync.WaitGroup)
+	}
+	p.idle <- fs
+
+	for range n - 1 {
+		detector, extractor, err := newPipeline(cfg)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		worker := *fs
+		worker.Detector, worker.Extractor = detector, extractor
+		worker.stages = new(sync.WaitGroup)
+		p.owned = append(p.owned, &worker)
+		p.idle <- &worker
+	}
+	return p, nil
+}
+
+// Acquire waits for an idle worker, bound to the context. It returns
+// errServerBusy at once when the queue is full, or deadline.Err if the
+// context ends while waiting.
+func (p *workerPool) Acquire(ctx context.Context) (*FaceSystem, error) {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return nil, errServerBusy
+	}
+
+	select {
+	case worker := <-p.idle:
+		return worker.WithContext(ctx), nil
+	case <-ctx.Done():
+		<-p.slots
+		return nil, deadline.Err(ctx, "the wait for a worker")
+	}
+}
+
+// TryAcquire returns an idle worker bound to the context, or nil if none is
+// idle or the queue is full. Batches take their first worker with Acquire
+// and any more with TryAcquire, so concurrent batches never wait on each
+// other.
+func (p *workerPool) TryAcquire(ctx context.Context) *FaceSystem {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return nil
+	}
+
+	select {
+	case worker := <-p.idle:
+		return worker.WithContext(ctx)
+	default:
+		<-p.slots
+		return nil
+	}
+}
+
+// Size returns the number of workers
+func (p *workerPool) Size() int {
+	return cap(p.idle)
+}
+
+// Release returns a worker to the pool. A worker whose context ended may
+// still be running a stage it abandoned, so it is returned in the
+// background once the stage finishes.
+func (p *workerPool) Release(worker *FaceSystem) {
+	pooled := worker.pooled
+	if worker.ctx.Err() == nil {
+		p.idle <- pooled
+		<-p.slots
+		return
+	}
+	go func() {
+		pooled.stages.Wait()
+		p.idle <- pooled
+		<-p.slots
+	}()
+}
+
+// Close closes the detectors and extractors of the workers the pool
+// created
+func (p *workerPool) Close() {
+	for _, worker := range p.owned {
+		worker.Detector.Close()
+		worker.Extractor.Close()
+	}
+}
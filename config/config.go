@@ -1,20 +1,264 @@
 package config
 
 import (
+	"cmp"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"math/rand/v2"
+	"net/url"
 	"os"
+	"os/user"
+	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/encryption"
+	"face/internal/errreport"
+	"face/internal/faultinject"
+	"face/internal/homeassistant"
+	"face/internal/imaging"
+	"face/internal/liveness"
+	"face/internal/logging"
+	"face/internal/notify"
+	"face/internal/onvif"
+	"face/internal/pipeline/modelspec"
+	"face/internal/provenance"
+	"face/internal/redaction"
+	"face/internal/stepup"
+	"face/internal/storage"
+	"face/internal/telemetry"
+	"face/internal/wiegand"
+	"face/matching"
+)
+
+// DefaultConfigFile is the config file read from the working directory
+// when FACE_CLI_CONFIG is not set
+const DefaultConfigFile = "face.config.json"
+
+// DefaultHistoryFile is where commands that change anything are recorded
+const DefaultHistoryFile = "face.history.jsonl"
+
+// DefaultTelemetryFile is where opting in to usage statistics and the
+// counts not yet sent are kept
+const DefaultTelemetryFile = "face.telemetry.json"
+
+// DefaultUndoFile is where the last destructive operation is remembered
+// so 'face undo' can reverse it
+const DefaultUndoFile = "face.undo.json"
+
+// DefaultUndoWindowMinutes is how long a destructive operation can be undone
+const DefaultUndoWindowMinutes = 10
+
+// DefaultCacheSizeMB is the local cache limit of the tiered storage backend
+const DefaultCacheSizeMB = 512
+
+// Auto-enrichment defaults, used when the config leaves them at 0
+const (
+	DefaultAutoEnrichConfidence = 0.9
+	DefaultAutoEnrichQuality    = 0.6
+)
+
+// DefaultDecayMax is the most the confidence decay discounts a face's
+// similarity by, used when the config leaves it at 0
+const DefaultDecayMax = 0.05
+
+// DefaultStaleAfterDays is how old the newest face of a user can be before
+// 'face stats' suggests re-enrolling them
+const DefaultStaleAfterDays = 730
+
+// DefaultRequestTimeout bounds the requests of 'face serve', used when the
+// config leaves request_timeout_seconds at 0
+const DefaultRequestTimeout = 30 * time.Second
+
+// Worker pool of 'face serve', used when the config leaves serve_workers
+// and serve_queue at 0
+const (
+	DefaultServeWorkers = 1
+	DefaultServeQueue   = 16
 )
 
 // Config holds application configuration
 type Config struct {
-	DatabaseType     database.DatabaseType
-	DatabasePath     string // For SQLite: file path, For PostgreSQL: connection string
-	FacesDir         string
-	ModelsDir        string
-	DefaultThreshold float64
+	DatabaseType         database.DatabaseType `json:"database_type"`
+	DatabasePath         string                `json:"database_path"`             // For SQLite: file path, For PostgreSQL: connection string
+	DatabaseSchema       string                `json:"database_schema,omitempty"` // PostgreSQL only
+	TablePrefix          string                `json:"table_prefix,omitempty"`
+	Tenant               string                `json:"tenant,omitempty"`         // PostgreSQL row-level security tenant
+	DatabaseRoles        bool                  `json:"database_roles,omitempty"` // PostgreSQL least-privilege roles
+	SQLiteDriver         string                `json:"sqlite_driver,omitempty"`  // cgo or purego, empty for the build's default
+	PGVector             bool                  `json:"pgvector,omitempty"`       // PostgreSQL similarity search in SQL with pgvector
+	AutoMigrate          bool                  `json:"auto_migrate,omitempty"`   // apply pending migrations before commands instead of refusing to run
+	FacesDir             string                `json:"faces_dir"`
+	StorageLayout        string                `json:"storage_layout,omitempty"`       // flat (default) or sharded
+	StorageBackend       string                `json:"storage_backend,omitempty"`      // local (default), tiered, s3 or database
+	EncryptionKey        string                `json:"encryption_key,omitempty"`       // hex AES-256 key encrypting stored images, embeddings and secrets
+	Encrypt              bool                  `json:"encrypt,omitempty"`              // refuse to run without an encryption key
+	EncryptionMigrating  bool                  `json:"encryption_migrating,omitempty"` // read data stored before the key was set as it is
+	S3Endpoint           string                `json:"s3_endpoint,omitempty"`
+	S3Region             string                `json:"s3_region,omitempty"`
+	S3Bucket             string                `json:"s3_bucket,omitempty"`
+	S3Prefix             string                `json:"s3_prefix,omitempty"`
+	S3Insecure           bool                  `json:"s3_insecure,omitempty"`
+	CacheSizeMB          int64                 `json:"cache_size_mb,omitempty"`  // tiered backend: local cache limit, 0 = DefaultCacheSizeMB
+	Provenance           string                `json:"provenance,omitempty"`     // metadata (default), watermark or none
+	ProvenanceKey        string                `json:"provenance_key,omitempty"` // signs the provenance of stored images if set
+	ErasureKey           string                `json:"erasure_key,omitempty"`    // signs the receipts of 'face purge' if set
+	ModelsDir            string                `json:"models_dir"`
+	PipelineBackend      string                `json:"pipeline_backend,omitempty"`     // pigo (default) or mock
+	EmbeddingModel       string                `json:"embedding_model,omitempty"`      // ONNX model computing embeddings, the backend's own if empty
+	ONNXRuntime          string                `json:"onnx_runtime,omitempty"`         // path of the ONNX Runtime shared library, found by the loader if empty
+	MaxImageMegapixels   float64               `json:"max_image_megapixels,omitempty"` // 0 = imaging.DefaultMaxMegapixels, negative = no limit
+	MaxImageDimension    int                   `json:"max_image_dimension,omitempty"`  // 0 = imaging.DefaultMaxDimension, negative = no limit
+	OversizeImages       string                `json:"oversize_images,omitempty"`      // reject (default) or downscale
+	DefaultThreshold     float64               `json:"default_threshold"`
+	RequireLiveness      bool                  `json:"require_liveness,omitempty"`       // identify and the verify commands reject faces that score as spoofs
+	LivenessModel        string                `json:"liveness_model,omitempty"`         // liveness.ModelPassive if empty
+	LivenessThreshold    float64               `json:"liveness_threshold,omitempty"`     // 0 = liveness.DefaultThreshold
+	NameTransliteration  bool                  `json:"name_transliteration,omitempty"`   // names match across scripts, e.g. Мария and Maria
+	AutoEnrich           bool                  `json:"auto_enrich,omitempty"`            // add confident identify probes as new faces
+	AutoEnrichConfidence float64               `json:"auto_enrich_confidence,omitempty"` // 0 = DefaultAutoEnrichConfidence
+	AutoEnrichQuality    float64               `json:"auto_enrich_quality,omitempty"`    // 0 = DefaultAutoEnrichQuality
+	ANNIndex             bool                  `json:"ann_index,omitempty"`              // 'face serve' identifies with an in-memory HNSW index
+	ANNEfSearch          int                   `json:"ann_ef_search,omitempty"`          // search breadth of the index, 0 = ann.DefaultEfSearch
+	Seed                 int64                 `json:"seed,omitempty"`                   // fixes random choices for reproducible runs, 0 = random
+	LogTarget            string                `json:"log_target,omitempty"`             // none (default), stderr, file or syslog
+	LogLevel             string                `json:"log_level,omitempty"`
+	LogFile              string                `json:"log_file,omitempty"`
+	LogMaxSizeMB         int                   `json:"log_max_size_mb,omitempty"`
+	LogMaxAgeDays        int                   `json:"log_max_age_days,omitempty"`
+	LogMaxBackups        int                   `json:"log_max_backups,omitempty"`
+	LogCompress          bool                  `json:"log_compress,omitempty"`
+	SyslogAddress        string                `json:"syslog_address,omitempty"` // e.g. udp://logs:514, empty for the local daemon
+	SyslogTag            string                `json:"syslog_tag,omitempty"`
+	SentryDSN            string                `json:"sentry_dsn,omitempty"` // error reporting, disabled when empty
+	SentryEnv            string                `json:"sentry_environment,omitempty"`
+	HistoryFile          string                `json:"history_file,omitempty"`         // local command history, "none" to disable
+	AuditRetentionDays   int                   `json:"audit_retention_days,omitempty"` // audit events older than this are purged, 0 = kept forever
+	TelemetryFile        string                `json:"telemetry_file,omitempty"`       // usage statistics opt-in and counts, "none" to disable
+	TelemetryEndpoint    string                `json:"telemetry_endpoint,omitempty"`   // where usage statistics are sent once enabled
+	UndoFile             string                `json:"undo_file,omitempty"`
+	UndoWindowMinutes    int                   `json:"undo_window_minutes,omitempty"` // 0 = DefaultUndoWindowMinutes, negative = no undo
+	WiegandOutput        string                `json:"wiegand_output,omitempty"`      // device or file sent the card number of identified users
+	WiegandFormat        string                `json:"wiegand_format,omitempty"`      // 26 (default) or 37
+	WiegandFacilityCode  int                   `json:"wiegand_facility_code,omitempty"`
+	MQTTBroker           string                `json:"mqtt_broker,omitempty"` // Home Assistant events, e.g. tcp://homeassistant.local:1883
+	MQTTUsername         string                `json:"mqtt_username,omitempty"`
+	MQTTPassword         string                `json:"mqtt_password,omitempty"`
+	MQTTTopic            string                `json:"mqtt_topic,omitempty"`            // homeassistant.DefaultTopic if empty
+	MQTTDiscoveryPrefix  string                `json:"mqtt_discovery_prefix,omitempty"` // homeassistant.DefaultDiscoveryPrefix if empty
+	DeepStackAPIKey      string                `json:"deepstack_api_key,omitempty"`     // required from 'face deepstack' clients if set
+	ServeAPIKey          string                `json:"serve_api_key,omitempty"`         // required from 'face serve' clients if set
+	Redaction            string                `json:"redaction,omitempty"`             // redaction level of CLI output, MQTT events and logs, full if empty
+	PseudonymKey         string                `json:"pseudonym_key,omitempty"`         // derives the pseudonymous IDs of the id-only redaction level
+	BackupKeyFile        string                `json:"backup_key_file,omitempty"`       // encrypts 'face backup' archives with this key file
+	BackupPassphrase     string                `json:"backup_passphrase,omitempty"`     // encrypts 'face backup' archives with this passphrase
+	BackupUpload         string                `json:"backup_upload,omitempty"`         // off-site target of 'face backup', e.g. s3://bucket/prefix
+	FFmpegPath           string                `json:"ffmpeg_path,omitempty"`           // ffmpeg executable 'face watch' captures with, capture.DefaultFFmpeg if empty
+	// ServeAPIKeys are further keys 'face serve' accepts, each with the
+	// redaction level of the results its clients receive
+	ServeAPIKeys []APIKey `json:"serve_api_keys,omitempty"`
+	// Queries are the reports 'face query' can run, in addition to and
+	// overriding database.BuiltinQueries
+	Queries map[string]database.Query `json:"queries,omitempty"`
+	// Cameras are the ONVIF cameras images can be taken from, by name
+	Cameras map[string]onvif.Camera `json:"cameras,omitempty"`
+	// EmbeddingModels are the ONNX models embedding_model can select, by
+	// name, in addition to and overriding modelspec.ONNXPresets
+	EmbeddingModels map[string]modelspec.ONNXModel `json:"embedding_models,omitempty"`
+	// StepUpRules say when 'face verify' also needs the user's PIN or
+	// authenticator code, by group and confidence band
+	StepUpRules    []stepup.Rule `json:"step_up,omitempty"`
+	StepUpGroupKey string        `json:"step_up_group_key,omitempty"` // metadata entry holding the group, stepup.DefaultGroupKey if empty
+	// DecayHalfLifeDays makes faces enrolled long ago match slightly
+	// less, see ConfidenceDecay; 0 = no decay
+	DecayHalfLifeDays int     `json:"confidence_decay_half_life_days,omitempty"`
+	DecayMax          float64 `json:"confidence_decay_max,omitempty"` // 0 = DefaultDecayMax
+	// StaleAfterDays is how old the newest face of a user can be before
+	// 'face stats' lists them for re-enrollment, 0 = DefaultStaleAfterDays
+	StaleAfterDays int `json:"stale_after_days,omitempty"`
+	// Notifications are the email and SMS messages sent on events, e.g. a
+	// user being enrolled
+	Notifications *notify.Config `json:"notifications,omitempty"`
+	// RequestTimeoutSeconds bounds how long a request to 'face serve' may
+	// take, 0 = DefaultRequestTimeout, negative = no limit
+	RequestTimeoutSeconds int `json:"request_timeout_seconds,omitempty"`
+	// ServeWorkers is how many images 'face serve' processes at once, each
+	// worker with its own detector and extractor, 0 = DefaultServeWorkers.
+	// ServeQueue is how many requests may wait for a worker before further
+	// ones are answered with 429, 0 = DefaultServeQueue, negative = none.
+	ServeWorkers int `json:"serve_workers,omitempty"`
+	ServeQueue   int `json:"serve_queue,omitempty"`
+	// MatchStrategy overrides the match strategy stored in the settings,
+	// see matching.Strategy; the stored one is used if empty
+	MatchStrategy string `json:"match_strategy,omitempty"`
+	// Device is the scope of the device this runs on, e.g.
+	// "acme/berlin/lobby-door": identification only matches the users of
+	// its org, site and device, see models.User.InScope. Everyone is
+	// matched if empty.
+	Device string `json:"device,omitempty"`
+
+	// faults simulates failures for integration testing, see EnableFaultInjection
+	faults *faultinject.Injector
+	// version is the version of the running program, see SetVersion
+	version string
+	// requestID identifies the run, see SetRequestID
+	requestID string
+	// fileErr is why the config file could not be read, see FileError
+	fileErr error
+}
+
+// APIKey is a key of the REST API with the redaction level and the role of
+// its clients
+type APIKey struct {
+	// Name identifies the client in logs, e.g. "lobby display"
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Redaction is a redaction.Level, full if empty
+	Redaction string `json:"redaction,omitempty"`
+	// Device is the scope of the device using the key, identifying only
+	// the users of its org, site and device; Config.Device if empty
+	Device string `json:"device,omitempty"`
+	// Role is an APIKeyRole, read if empty
+	Role string `json:"role,omitempty"`
+}
+
+// APIKeyRole is what the clients of an API key may do
+type APIKeyRole string
+
+const (
+	// APIKeyRead identifies and verifies faces and reads users
+	APIKeyRead APIKeyRole = "read"
+	// APIKeyWrite also enrolls and deletes users and faces
+	APIKeyWrite APIKeyRole = "write"
+	// APIKeyAdmin also lowers the matching threshold below the configured
+	// one. serve_api_key is an admin key.
+	APIKeyAdmin APIKeyRole = "admin"
+)
+
+// ParseAPIKeyRole parses a role, read if empty
+func ParseAPIKeyRole(s string) (APIKeyRole, error) {
+	switch role := APIKeyRole(s); role {
+	case "":
+		return APIKeyRead, nil
+	case APIKeyRead, APIKeyWrite, APIKeyAdmin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("unsupported role: %s (use read, write or admin)", s)
+	}
+}
+
+// Allows reports whether the role may do what other may
+func (r APIKeyRole) Allows(other APIKeyRole) bool {
+	rank := map[APIKeyRole]int{APIKeyRead: 1, APIKeyWrite: 2, APIKeyAdmin: 3}
+	return rank[r] >= rank[other]
 }
 
 // DefaultConfig returns the default configuration
@@ -25,44 +269,566 @@ func DefaultConfig() *Config {
 		FacesDir:         "faces",
 		ModelsDir:        "models",
 		DefaultThreshold: 0.75,
+		HistoryFile:      DefaultHistoryFile,
+		TelemetryFile:    DefaultTelemetryFile,
+		UndoFile:         DefaultUndoFile,
 	}
 }
 
-// LoadConfig loads configuration from environment variables or uses defaults
+// LoadConfig loads configuration from the config file and environment
+// variables, falling back to defaults. Environment variables take precedence
+// over the config file.
 func LoadConfig() *Config {
 	cfg := DefaultConfig()
 
+	// Config file is optional; one that exists but cannot be read is kept
+	// for FileError to report, as falling back to defaults would silently
+	// drop settings like encryption and API keys
+	if err := cfg.LoadFile(ConfigFilePath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		cfg.fileErr = err
+	}
+
+	cfg.loadDatabaseEnv()
+
+	if facesDir := os.Getenv("FACE_CLI_FACES_DIR"); facesDir != "" {
+		cfg.FacesDir = facesDir
+	}
+
+	cfg.loadStorageEnv()
+
+	cfg.loadPipelineEnv()
+
+	if mp := os.Getenv("FACE_CLI_MAX_IMAGE_MP"); mp != "" {
+		if v, err := strconv.ParseFloat(mp, 64); err == nil {
+			cfg.MaxImageMegapixels = v
+		}
+	}
+
+	if side := os.Getenv("FACE_CLI_MAX_IMAGE_DIMENSION"); side != "" {
+		if v, err := strconv.Atoi(side); err == nil {
+			cfg.MaxImageDimension = v
+		}
+	}
+
+	if oversize := os.Getenv("FACE_CLI_OVERSIZE_IMAGES"); oversize != "" {
+		cfg.OversizeImages = oversize
+	}
+
+	cfg.loadReportingEnv()
+
+	cfg.loadMatchingEnv()
+
+	cfg.loadLocalStateEnv()
+	cfg.loadEncryptionEnv()
+
+	cfg.loadIntegrationEnv()
+
+	if threshold := os.Getenv("FACE_CLI_THRESHOLD"); threshold != "" {
+		if t, err := strconv.ParseFloat(threshold, 64); err == nil && t >= 0 && t <= 1 {
+			cfg.DefaultThreshold = t
+		}
+	}
+
+	if seed := os.Getenv("FACE_CLI_SEED"); seed != "" {
+		if v, err := strconv.ParseInt(seed, 10, 64); err == nil {
+			cfg.Seed = v
+		}
+	}
+
+	return cfg
+}
+
+// loadDatabaseEnv overlays database settings from environment variables
+func (c *Config) loadDatabaseEnv() {
 	// Database type
 	if dbType := os.Getenv("FACE_CLI_DB_TYPE"); dbType != "" {
-		cfg.DatabaseType = database.ParseDatabaseType(dbType)
+		c.DatabaseType = database.ParseDatabaseType(dbType)
 	}
 
 	// Database path/connection string
 	if dbPath := os.Getenv("FACE_CLI_DB_PATH"); dbPath != "" {
-		cfg.DatabasePath = dbPath
+		c.DatabasePath = dbPath
 	}
 
 	// For PostgreSQL, check for specific env var
 	if pgURL := os.Getenv("FACE_CLI_POSTGRES_URL"); pgURL != "" {
-		cfg.DatabaseType = database.DatabaseTypePostgres
-		cfg.DatabasePath = pgURL
+		c.DatabaseType = database.DatabaseTypePostgres
+		c.DatabasePath = pgURL
 	}
 
-	if facesDir := os.Getenv("FACE_CLI_FACES_DIR"); facesDir != "" {
-		cfg.FacesDir = facesDir
+	if schema := os.Getenv("FACE_CLI_DB_SCHEMA"); schema != "" {
+		c.DatabaseSchema = schema
+	}
+
+	if prefix := os.Getenv("FACE_CLI_TABLE_PREFIX"); prefix != "" {
+		c.TablePrefix = prefix
+	}
+
+	if tenant := os.Getenv("FACE_CLI_TENANT"); tenant != "" {
+		c.Tenant = tenant
+	}
+
+	if driver := os.Getenv("FACE_CLI_SQLITE_DRIVER"); driver != "" {
+		c.SQLiteDriver = driver
+	}
+
+	if roles := os.Getenv("FACE_CLI_DB_ROLES"); roles != "" {
+		if v, err := strconv.ParseBool(roles); err == nil {
+			c.DatabaseRoles = v
+		}
+	}
+
+	if pgvector := os.Getenv("FACE_CLI_PGVECTOR"); pgvector != "" {
+		if v, err := strconv.ParseBool(pgvector); err == nil {
+			c.PGVector = v
+		}
+	}
+
+	if autoMigrate := os.Getenv("FACE_CLI_AUTO_MIGRATE"); autoMigrate != "" {
+		if v, err := strconv.ParseBool(autoMigrate); err == nil {
+			c.AutoMigrate = v
+		}
+	}
+}
+
+// loadStorageEnv overlays image storage settings from environment variables
+func (c *Config) loadStorageEnv() {
+	if layout := os.Getenv("FACE_CLI_STORAGE_LAYOUT"); layout != "" {
+		c.StorageLayout = layout
+	}
+
+	if backend := os.Getenv("FACE_CLI_STORAGE"); backend != "" {
+		c.StorageBackend = backend
+	}
+
+	if endpoint := os.Getenv("FACE_CLI_S3_ENDPOINT"); endpoint != "" {
+		c.S3Endpoint = endpoint
+	}
+
+	if region := os.Getenv("FACE_CLI_S3_REGION"); region != "" {
+		c.S3Region = region
+	}
+
+	if bucket := os.Getenv("FACE_CLI_S3_BUCKET"); bucket != "" {
+		c.S3Bucket = bucket
+	}
+
+	if prefix := os.Getenv("FACE_CLI_S3_PREFIX"); prefix != "" {
+		c.S3Prefix = prefix
+	}
+
+	if insecure := os.Getenv("FACE_CLI_S3_INSECURE"); insecure != "" {
+		if v, err := strconv.ParseBool(insecure); err == nil {
+			c.S3Insecure = v
+		}
+	}
+
+	if provenance := os.Getenv("FACE_CLI_PROVENANCE"); provenance != "" {
+		c.Provenance = provenance
+	}
+
+	if key := os.Getenv("FACE_CLI_PROVENANCE_KEY"); key != "" {
+		c.ProvenanceKey = key
+	}
+
+	if key := os.Getenv("FACE_CLI_ERASURE_KEY"); key != "" {
+		c.ErasureKey = key
+	}
+
+	if cacheSize := os.Getenv("FACE_CLI_CACHE_SIZE_MB"); cacheSize != "" {
+		if size, err := strconv.ParseInt(cacheSize, 10, 64); err == nil && size > 0 {
+			c.CacheSizeMB = size
+		}
+	}
+}
+
+// loadReportingEnv overlays logging and error reporting settings from
+// environment variables
+func (c *Config) loadReportingEnv() {
+	if target := os.Getenv("FACE_CLI_LOG_TARGET"); target != "" {
+		c.LogTarget = target
+	}
+
+	if level := os.Getenv("FACE_CLI_LOG_LEVEL"); level != "" {
+		c.LogLevel = level
+	}
+
+	if logFile := os.Getenv("FACE_CLI_LOG_FILE"); logFile != "" {
+		c.LogFile = logFile
+	}
+
+	if dsn := os.Getenv("FACE_CLI_SENTRY_DSN"); dsn != "" {
+		c.SentryDSN = dsn
+	}
+
+	if endpoint := os.Getenv("FACE_CLI_TELEMETRY_ENDPOINT"); endpoint != "" {
+		c.TelemetryEndpoint = endpoint
+	}
+
+	if days := os.Getenv("FACE_CLI_AUDIT_RETENTION_DAYS"); days != "" {
+		if v, err := strconv.Atoi(days); err == nil {
+			c.AuditRetentionDays = v
+		}
+	}
+}
+
+// loadEncryptionEnv overlays the encryption at rest settings from
+// environment variables
+func (c *Config) loadEncryptionEnv() {
+	if key := os.Getenv("FACE_CLI_ENCRYPTION_KEY"); key != "" {
+		c.EncryptionKey = key
+	}
+
+	if encrypt := os.Getenv("FACE_CLI_ENCRYPT"); encrypt != "" {
+		if v, err := strconv.ParseBool(encrypt); err == nil {
+			c.Encrypt = v
+		}
 	}
 
+	if migrating := os.Getenv("FACE_CLI_ENCRYPTION_MIGRATING"); migrating != "" {
+		if v, err := strconv.ParseBool(migrating); err == nil {
+			c.EncryptionMigrating = v
+		}
+	}
+}
+
+// loadPipelineEnv overlays the face pipeline and embedding model settings
+// from environment variables
+func (c *Config) loadPipelineEnv() {
 	if modelsDir := os.Getenv("FACE_CLI_MODEL_DIR"); modelsDir != "" {
-		cfg.ModelsDir = modelsDir
+		c.ModelsDir = modelsDir
+	}
+	if backend := os.Getenv("FACE_CLI_PIPELINE"); backend != "" {
+		c.PipelineBackend = backend
+	}
+	if model := os.Getenv("FACE_CLI_EMBEDDING_MODEL"); model != "" {
+		c.EmbeddingModel = model
+	}
+	if library := os.Getenv("FACE_CLI_ONNX_RUNTIME"); library != "" {
+		c.ONNXRuntime = library
 	}
+}
 
-	if threshold := os.Getenv("FACE_CLI_THRESHOLD"); threshold != "" {
-		if t, err := strconv.ParseFloat(threshold, 64); err == nil && t >= 0 && t <= 1 {
-			cfg.DefaultThreshold = t
+// loadMatchingEnv overlays the auto-enrichment, ANN index, liveness, serve and
+// name matching settings from environment variables
+func (c *Config) loadMatchingEnv() {
+	if enrich := os.Getenv("FACE_CLI_AUTO_ENRICH"); enrich != "" {
+		if v, err := strconv.ParseBool(enrich); err == nil {
+			c.AutoEnrich = v
 		}
 	}
 
-	return cfg
+	if index := os.Getenv("FACE_CLI_ANN_INDEX"); index != "" {
+		if v, err := strconv.ParseBool(index); err == nil {
+			c.ANNIndex = v
+		}
+	}
+
+	if transliterate := os.Getenv("FACE_CLI_NAME_TRANSLITERATION"); transliterate != "" {
+		if v, err := strconv.ParseBool(transliterate); err == nil {
+			c.NameTransliteration = v
+		}
+	}
+
+	if halfLife := os.Getenv("FACE_CLI_CONFIDENCE_DECAY_HALF_LIFE_DAYS"); halfLife != "" {
+		if v, err := strconv.Atoi(halfLife); err == nil {
+			c.DecayHalfLifeDays = v
+		}
+	}
+
+	if staleAfter := os.Getenv("FACE_CLI_STALE_AFTER_DAYS"); staleAfter != "" {
+		if v, err := strconv.Atoi(staleAfter); err == nil {
+			c.StaleAfterDays = v
+		}
+	}
+
+	if strategy := os.Getenv("FACE_CLI_MATCH_STRATEGY"); strategy != "" {
+		c.MatchStrategy = strategy
+	}
+
+	if device := os.Getenv("FACE_CLI_DEVICE"); device != "" {
+		c.Device = device
+	}
+
+	c.loadServeEnv()
+	c.loadLivenessEnv()
+}
+
+// loadServeEnv overlays the request timeout and worker pool of 'face serve'
+// from environment variables
+func (c *Config) loadServeEnv() {
+	if timeout := os.Getenv("FACE_CLI_REQUEST_TIMEOUT_SECONDS"); timeout != "" {
+		if v, err := strconv.Atoi(timeout); err == nil {
+			c.RequestTimeoutSeconds = v
+		}
+	}
+	if workers := os.Getenv("FACE_CLI_SERVE_WORKERS"); workers != "" {
+		if v, err := strconv.Atoi(workers); err == nil {
+			c.ServeWorkers = v
+		}
+	}
+	if queue := os.Getenv("FACE_CLI_SERVE_QUEUE"); queue != "" {
+		if v, err := strconv.Atoi(queue); err == nil {
+			c.ServeQueue = v
+		}
+	}
+}
+
+// loadLivenessEnv overlays the liveness settings from environment variables
+func (c *Config) loadLivenessEnv() {
+	if require := os.Getenv("FACE_CLI_REQUIRE_LIVENESS"); require != "" {
+		if v, err := strconv.ParseBool(require); err == nil {
+			c.RequireLiveness = v
+		}
+	}
+
+	if model := os.Getenv("FACE_CLI_LIVENESS_MODEL"); model != "" {
+		c.LivenessModel = model
+	}
+
+	if threshold := os.Getenv("FACE_CLI_LIVENESS_THRESHOLD"); threshold != "" {
+		if v, err := strconv.ParseFloat(threshold, 64); err == nil {
+			c.LivenessThreshold = v
+		}
+	}
+}
+
+// loadLocalStateEnv overlays the command history, telemetry and undo settings from
+// environment variables
+func (c *Config) loadLocalStateEnv() {
+	if historyFile := os.Getenv("FACE_CLI_HISTORY_FILE"); historyFile != "" {
+		c.HistoryFile = historyFile
+	}
+
+	if telemetryFile := os.Getenv("FACE_CLI_TELEMETRY_FILE"); telemetryFile != "" {
+		c.TelemetryFile = telemetryFile
+	}
+
+	if undoFile := os.Getenv("FACE_CLI_UNDO_FILE"); undoFile != "" {
+		c.UndoFile = undoFile
+	}
+
+	if window := os.Getenv("FACE_CLI_UNDO_WINDOW"); window != "" {
+		if v, err := strconv.Atoi(window); err == nil {
+			c.UndoWindowMinutes = v
+		}
+	}
+}
+
+// loadIntegrationEnv overlays the door controller, camera, Home Assistant,
+// DeepStack and REST API settings from environment variables
+func (c *Config) loadIntegrationEnv() {
+	if wiegandOut := os.Getenv("FACE_CLI_WIEGAND_OUT"); wiegandOut != "" {
+		c.WiegandOutput = wiegandOut
+	}
+
+	if ffmpeg := os.Getenv("FACE_CLI_FFMPEG"); ffmpeg != "" {
+		c.FFmpegPath = ffmpeg
+	}
+
+	if broker := os.Getenv("FACE_CLI_MQTT_BROKER"); broker != "" {
+		c.MQTTBroker = broker
+	}
+
+	if username := os.Getenv("FACE_CLI_MQTT_USERNAME"); username != "" {
+		c.MQTTUsername = username
+	}
+
+	if password := os.Getenv("FACE_CLI_MQTT_PASSWORD"); password != "" {
+		c.MQTTPassword = password
+	}
+
+	if apiKey := os.Getenv("FACE_CLI_DEEPSTACK_API_KEY"); apiKey != "" {
+		c.DeepStackAPIKey = apiKey
+	}
+
+	if apiKey := os.Getenv("FACE_CLI_SERVE_API_KEY"); apiKey != "" {
+		c.ServeAPIKey = apiKey
+	}
+
+	if level := os.Getenv("FACE_CLI_REDACTION"); level != "" {
+		c.Redaction = level
+	}
+
+	if key := os.Getenv("FACE_CLI_PSEUDONYM_KEY"); key != "" {
+		c.PseudonymKey = key
+	}
+
+	if keyFile := os.Getenv("FACE_CLI_BACKUP_KEY_FILE"); keyFile != "" {
+		c.BackupKeyFile = keyFile
+	}
+
+	if passphrase := os.Getenv("FACE_CLI_BACKUP_PASSPHRASE"); passphrase != "" {
+		c.BackupPassphrase = passphrase
+	}
+
+	if upload := os.Getenv("FACE_CLI_BACKUP_UPLOAD"); upload != "" {
+		c.BackupUpload = upload
+	}
+
+	c.loadNotifyEnv()
+}
+
+// loadNotifyEnv overlays the secrets of the notification channels from
+// environment variables, so they need not be in the config file
+func (c *Config) loadNotifyEnv() {
+	password, token := os.Getenv("FACE_CLI_SMTP_PASSWORD"), os.Getenv("FACE_CLI_TWILIO_AUTH_TOKEN")
+	if password == "" && token == "" {
+		return
+	}
+	if c.Notifications == nil {
+		c.Notifications = &notify.Config{}
+	}
+	if password != "" {
+		c.Notifications.SMTP.Password = password
+	}
+	if token != "" {
+		c.Notifications.Twilio.AuthToken = token
+	}
+}
+
+// ConfigFilePath returns the path of the config file to use
+func ConfigFilePath() string {
+	if path := os.Getenv("FACE_CLI_CONFIG"); path != "" {
+		return path
+	}
+	return DefaultConfigFile
+}
+
+// LoadFile overlays values from a JSON config file onto the configuration
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// FileError returns why the config file could not be read by LoadConfig,
+// nil if it was read or there is none
+func (c *Config) FileError() error {
+	return c.fileErr
+}
+
+// FileConfig returns the configuration of a config file alone, without
+// environment variables overlaid, the defaults if there is no file
+func FileConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := cfg.LoadFile(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Save writes the configuration to a JSON config file
+func (c *Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// redactedValue replaces secrets in Redacted, as url.URL.Redacted does
+const redactedValue = "xxxxx"
+
+// passwordPattern finds the password of a key=value connection string
+var passwordPattern = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// Redacted returns a copy of the configuration without secrets, safe to
+// share for troubleshooting
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if redacted.SentryDSN != "" {
+		redacted.SentryDSN = redactedValue
+	}
+	if redacted.MQTTPassword != "" {
+		redacted.MQTTPassword = redactedValue
+	}
+	if redacted.DeepStackAPIKey != "" {
+		redacted.DeepStackAPIKey = redactedValue
+	}
+	if redacted.ServeAPIKey != "" {
+		redacted.ServeAPIKey = redactedValue
+	}
+	if redacted.ProvenanceKey != "" {
+		redacted.ProvenanceKey = redactedValue
+	}
+	if redacted.ErasureKey != "" {
+		redacted.ErasureKey = redactedValue
+	}
+	if redacted.PseudonymKey != "" {
+		redacted.PseudonymKey = redactedValue
+	}
+	if redacted.EncryptionKey != "" {
+		redacted.EncryptionKey = redactedValue
+	}
+	if redacted.BackupPassphrase != "" {
+		redacted.BackupPassphrase = redactedValue
+	}
+	if len(c.ServeAPIKeys) > 0 {
+		redacted.ServeAPIKeys = make([]APIKey, len(c.ServeAPIKeys))
+		for i, key := range c.ServeAPIKeys {
+			key.Key = redactedValue
+			redacted.ServeAPIKeys[i] = key
+		}
+	}
+	redacted.MQTTBroker = RedactConnectionString(redacted.MQTTBroker)
+
+	if c.Notifications != nil {
+		redacted.Notifications = redactNotifications(*c.Notifications)
+	}
+
+	if len(c.Cameras) > 0 {
+		redacted.Cameras = make(map[string]onvif.Camera, len(c.Cameras))
+		for name, camera := range c.Cameras {
+			if camera.Password != "" {
+				camera.Password = redactedValue
+			}
+			redacted.Cameras[name] = camera
+		}
+	}
+
+	redacted.DatabasePath = RedactConnectionString(redacted.DatabasePath)
+	return &redacted
+}
+
+// redactNotifications returns the notification settings without the
+// passwords, tokens and webhook URLs, which hold the secret that lets
+// anyone post
+func redactNotifications(notifications notify.Config) *notify.Config {
+	if notifications.SMTP.Password != "" {
+		notifications.SMTP.Password = redactedValue
+	}
+	if notifications.Twilio.AuthToken != "" {
+		notifications.Twilio.AuthToken = redactedValue
+	}
+	notifications.Rules = slices.Clone(notifications.Rules)
+	for i := range notifications.Rules {
+		if notifications.Rules[i].Webhook != "" {
+			notifications.Rules[i].Webhook = redactedValue
+		}
+	}
+	return &notifications
+}
+
+// RedactConnectionString hides the password of a database URL or
+// key=value connection string
+func RedactConnectionString(s string) string {
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return passwordPattern.ReplaceAllString(s, "${1}"+redactedValue)
 }
 
 // Validate checks if the configuration is valid
@@ -79,10 +845,636 @@ func (c *Config) Validate() error {
 	if c.DefaultThreshold < 0 || c.DefaultThreshold > 1 {
 		return errors.New("threshold must be between 0 and 1")
 	}
+	if err := c.validateMatching(); err != nil {
+		return err
+	}
+	if err := c.validateDatabase(); err != nil {
+		return err
+	}
+	if err := c.validatePipeline(); err != nil {
+		return err
+	}
+	if err := c.validateStorage(); err != nil {
+		return err
+	}
+	if err := c.validateIntegrations(); err != nil {
+		return err
+	}
+	if err := c.validateRedaction(); err != nil {
+		return err
+	}
+	if err := c.Logging().Validate(); err != nil {
+		return err
+	}
+	return c.DatabaseOptions().Validate()
+}
+
+// validateDatabase checks the audit log and row-level security settings
+func (c *Config) validateDatabase() error {
+	if c.AuditRetentionDays < 0 {
+		return errors.New("audit_retention_days must not be negative")
+	}
+	if c.AuditRetentionDays > 0 && !c.DatabaseType.UsesMigrations() {
+		return fmt.Errorf("audit_retention_days needs the sqlite or postgres database, the %s database keeps no audit log", c.DatabaseType)
+	}
+	if c.DatabaseType == database.DatabaseTypePostgres && c.Tenant != "" && !c.DatabaseRoles {
+		return database.ErrTenantWithoutRoles
+	}
+	return nil
+}
+
+// validatePipeline checks the backend and the embedding model
+func (c *Config) validatePipeline() error {
+	if _, err := modelspec.ParseBackend(c.PipelineBackend); err != nil {
+		return err
+	}
+	_, _, err := c.ONNXModel()
+	return err
+}
+
+// validateMatching checks the auto-enrichment, ANN index, confidence decay,
+// match strategy, device scopes and liveness settings
+func (c *Config) validateMatching() error {
+	if c.AutoEnrichConfidence < 0 || c.AutoEnrichConfidence > 1 || c.AutoEnrichQuality < 0 || c.AutoEnrichQuality > 1 {
+		return errors.New("auto-enrichment confidence and quality must be between 0 and 1")
+	}
+	if c.ANNEfSearch < 0 {
+		return errors.New("ann_ef_search must not be negative")
+	}
+	if c.DecayHalfLifeDays < 0 || c.StaleAfterDays < 0 {
+		return errors.New("confidence_decay_half_life_days and stale_after_days must not be negative")
+	}
+	if c.DecayMax < 0 || c.DecayMax >= 1 {
+		return errors.New("confidence_decay_max must be at least 0 and below 1")
+	}
+	if c.LivenessThreshold < 0 || c.LivenessThreshold > 1 {
+		return errors.New("liveness_threshold must be between 0 and 1")
+	}
+	if c.MatchStrategy != "" {
+		if _, err := matching.ParseStrategy(c.MatchStrategy); err != nil {
+			return err
+		}
+	}
+	if err := c.validateDevices(); err != nil {
+		return err
+	}
+	_, err := c.Liveness()
+	return err
+}
+
+// validateDevices checks the scopes of the device and of the API keys
+func (c *Config) validateDevices() error {
+	if c.Device != "" {
+		if err := models.ValidateScopePath(c.Device); err != nil {
+			return fmt.Errorf("device: %w", err)
+		}
+	}
+	for _, k := range c.ServeAPIKeys {
+		if k.Device == "" {
+			continue
+		}
+		if err := models.ValidateScopePath(k.Device); err != nil {
+			return fmt.Errorf("API key %q: device: %w", k.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateStorage checks the image storage settings
+func (c *Config) validateStorage() error {
+	if _, err := storage.ParseLayout(c.StorageLayout); err != nil {
+		return err
+	}
+	if _, err := provenance.ParseMode(c.Provenance); err != nil {
+		return err
+	}
+	backend, err := storage.ParseBackend(c.StorageBackend)
+	if err != nil {
+		return err
+	}
+	if (backend == storage.BackendTiered || backend == storage.BackendS3) && c.S3Bucket == "" {
+		return fmt.Errorf("S3 bucket is required for the %s storage backend", backend)
+	}
+	if backend == storage.BackendDatabase && !c.DatabaseType.UsesMigrations() {
+		return fmt.Errorf("the database storage backend needs the sqlite or postgres database, not %s", c.DatabaseType)
+	}
+	if backend == storage.BackendTiered && c.CacheSizeMB < 0 {
+		return errors.New("cache size cannot be negative")
+	}
+	_, err = c.Encryption()
+	return err
+}
+
+// validateIntegrations checks the door controller output, the step-up
+// rules and the notifications
+func (c *Config) validateIntegrations() error {
+	if _, err := c.Wiegand(); err != nil {
+		return err
+	}
+	if err := c.StepUp().Validate(); err != nil {
+		return err
+	}
+	if err := telemetry.ValidateEndpoint(c.TelemetryEndpoint); err != nil {
+		return err
+	}
+	return c.Notify().Validate()
+}
+
+func (c *Config) validateRedaction() error {
+	if _, err := c.Redactor(); err != nil {
+		return err
+	}
+	for _, key := range c.ServeAPIKeys {
+		if key.Key == "" {
+			return fmt.Errorf("API key %q has no key", key.Name)
+		}
+		if _, err := redaction.ParseLevel(key.Redaction); err != nil {
+			return fmt.Errorf("API key %q: %w", key.Name, err)
+		}
+		if _, err := ParseAPIKeyRole(key.Role); err != nil {
+			return fmt.Errorf("API key %q: %w", key.Name, err)
+		}
+	}
+	return nil
+}
+
+// Logging returns the log sink settings
+func (c *Config) Logging() logging.Config {
+	return logging.Config{
+		Target:        logging.Target(c.LogTarget),
+		Level:         c.LogLevel,
+		File:          c.LogFile,
+		MaxSizeMB:     c.LogMaxSizeMB,
+		MaxAgeDays:    c.LogMaxAgeDays,
+		MaxBackups:    c.LogMaxBackups,
+		Compress:      c.LogCompress,
+		SyslogAddress: c.SyslogAddress,
+		SyslogTag:     c.SyslogTag,
+	}
+}
+
+// Wiegand returns the frame format of the door controller output
+func (c *Config) Wiegand() (wiegand.Format, error) {
+	format, err := wiegand.ParseFormat(c.WiegandFormat)
+	if err != nil {
+		return "", err
+	}
+	if c.WiegandFacilityCode < 0 || c.WiegandFacilityCode > wiegand.MaxFacilityCode {
+		return "", fmt.Errorf("Wiegand facility code must be between 0 and %d", wiegand.MaxFacilityCode)
+	}
+	return format, nil
+}
+
+// StepUp returns the policy saying when verifications need a second factor
+func (c *Config) StepUp() stepup.Policy {
+	return stepup.Policy{Rules: c.StepUpRules, GroupKey: c.StepUpGroupKey}
+}
+
+// Notify returns the notification settings of the tenant
+func (c *Config) Notify() notify.Config {
+	var notifications notify.Config
+	if c.Notifications != nil {
+		notifications = *c.Notifications
+	}
+	notifications.Tenant = c.Tenant
+	return notifications
+}
+
+// AllQueries returns the built-in queries merged with those of the config
+// file
+func (c *Config) AllQueries() map[string]database.Query {
+	queries := database.BuiltinQueries()
+	for name, q := range c.Queries {
+		queries[name] = q
+	}
+	return queries
+}
+
+// AutoEnrichThresholds returns the minimum match confidence and probe
+// quality for adding an identify probe to the matched user's faces
+func (c *Config) AutoEnrichThresholds() (confidence, quality float64) {
+	confidence, quality = c.AutoEnrichConfidence, c.AutoEnrichQuality
+	if confidence == 0 {
+		confidence = DefaultAutoEnrichConfidence
+	}
+	if quality == 0 {
+		quality = DefaultAutoEnrichQuality
+	}
+	return confidence, quality
+}
+
+// ConfidenceDecay returns how the similarity of faces enrolled long ago is
+// discounted, the zero matching.Decay if it is not
+func (c *Config) ConfidenceDecay() matching.Decay {
+	if c.DecayHalfLifeDays <= 0 {
+		return matching.Decay{}
+	}
+	return matching.Decay{
+		HalfLife: time.Duration(c.DecayHalfLifeDays) * 24 * time.Hour,
+		Max:      cmp.Or(c.DecayMax, DefaultDecayMax),
+	}
+}
+
+// StaleAfter returns how old the newest face of a user can be before they
+// should be re-enrolled
+func (c *Config) StaleAfter() time.Duration {
+	return time.Duration(cmp.Or(c.StaleAfterDays, DefaultStaleAfterDays)) * 24 * time.Hour
+}
+
+// Strategy returns the match strategy: match_strategy if set, otherwise
+// the one stored in the settings
+func (c *Config) Strategy(stored matching.Strategy) (matching.Strategy, error) {
+	return matching.ParseStrategy(cmp.Or(c.MatchStrategy, string(stored)))
+}
+
+// RequestTimeout returns how long a request to 'face serve' may take, 0 for
+// no limit
+func (c *Config) RequestTimeout() time.Duration {
+	if c.RequestTimeoutSeconds < 0 {
+		return 0
+	}
+	if c.RequestTimeoutSeconds == 0 {
+		return DefaultRequestTimeout
+	}
+	return time.Duration(c.RequestTimeoutSeconds) * time.Second
+}
+
+// Workers returns how many images 'face serve' processes at once and how
+// many requests may wait for a worker
+func (c *Config) Workers() (workers, queue int) {
+	workers, queue = cmp.Or(c.ServeWorkers, DefaultServeWorkers), cmp.Or(c.ServeQueue, DefaultServeQueue)
+	return max(workers, 1), max(queue, 0)
+}
+
+// ONNXModel returns the ONNX model selected with embedding_model, and false
+// if the backend's own model computes embeddings
+func (c *Config) ONNXModel() (modelspec.ONNXModel, bool, error) {
+	if c.EmbeddingModel == "" {
+		return modelspec.ONNXModel{}, false, nil
+	}
+	model, err := modelspec.ResolveONNX(c.EmbeddingModel, c.EmbeddingModels, c.ModelsDir)
+	if err != nil {
+		return modelspec.ONNXModel{}, false, err
+	}
+	return model, true, nil
+}
+
+// WithGalleryModel returns the config with embedding_model set to the ONNX
+// model recorded with a gallery by 'face model use', or the config itself
+// if it selects a model or the gallery's model is not an ONNX model
+func (c *Config) WithGalleryModel(embeddingModel string) *Config {
+	name, ok := modelspec.ONNXModelName(embeddingModel)
+	if c.EmbeddingModel != "" || !ok {
+		return c
+	}
+	selected := *c
+	selected.EmbeddingModel = name
+	return &selected
+}
+
+// Embedding returns the name of the model the pipeline computes embeddings
+// with, as recorded with the gallery, and their dimension. The mock
+// backend ignores embedding_model.
+func (c *Config) Embedding() (string, int, error) {
+	backend, err := modelspec.ParseBackend(c.PipelineBackend)
+	if err != nil {
+		return "", 0, err
+	}
+	if backend == modelspec.BackendMock {
+		return backend.EmbeddingModel(), modelspec.MockDimension, nil
+	}
+
+	model, ok, err := c.ONNXModel()
+	switch {
+	case err != nil:
+		return "", 0, err
+	case ok:
+		return model.EmbeddingModel(), model.Dimension, nil
+	}
+	return backend.EmbeddingModel(), modelspec.EmbeddingDimension, nil
+}
+
+// Liveness returns the model faces are scored for presentation attacks with
+func (c *Config) Liveness() (liveness.Model, error) {
+	return liveness.Lookup(c.LivenessModel)
+}
+
+// SpoofThreshold returns the spoof score above which a face is rejected
+func (c *Config) SpoofThreshold() float64 {
+	if c.LivenessThreshold == 0 {
+		return liveness.DefaultThreshold
+	}
+	return c.LivenessThreshold
+}
+
+// DatabaseOptions returns the schema and table prefix settings. An invalid
+// encryption key is left out; Encryption reports it.
+func (c *Config) DatabaseOptions() database.Options {
+	key, _ := c.Encryption()
+	return database.Options{
+		Schema:        c.DatabaseSchema,
+		TablePrefix:   c.TablePrefix,
+		Tenant:        c.Tenant,
+		Roles:         c.DatabaseRoles,
+		SQLiteDriver:  c.SQLiteDriver,
+		PGVector:      c.PGVector,
+		EncryptionKey: key,
+	}
+}
+
+// Encryption returns the key face images, embeddings and secrets are
+// encrypted with, nil if none is configured. It fails if encryption is
+// required but no key is configured. While migrating, the key also reads
+// data that is not encrypted.
+func (c *Config) Encryption() (*encryption.Key, error) {
+	if c.EncryptionKey == "" {
+		if c.Encrypt {
+			return nil, errors.New("encryption at rest is required (--encrypt), but no encryption key is configured (FACE_CLI_ENCRYPTION_KEY)")
+		}
+		return nil, nil
+	}
+	key, err := encryption.ParseKey(c.EncryptionKey)
+	if err != nil || !c.EncryptionMigrating {
+		return key, err
+	}
+	return key.AllowPlaintext(), nil
+}
+
+// ImageLimits returns the size limits applied to input images
+func (c *Config) ImageLimits() (imaging.Limits, error) {
+	limits := imaging.Limits{MaxPixels: int(c.MaxImageMegapixels * 1e6)}
+	switch {
+	case c.MaxImageMegapixels == 0:
+		limits.MaxPixels = imaging.DefaultMaxMegapixels * 1e6
+	case c.MaxImageMegapixels < 0:
+		limits.MaxPixels = 0
+	}
+	switch {
+	case c.MaxImageDimension == 0:
+		limits.MaxDimension = imaging.DefaultMaxDimension
+	case c.MaxImageDimension > 0:
+		limits.MaxDimension = c.MaxImageDimension
+	}
+
+	switch c.OversizeImages {
+	case "", "reject":
+	case "downscale":
+		limits.Downscale = true
+	default:
+		return imaging.Limits{}, fmt.Errorf("unknown oversize image policy %q (use reject or downscale)", c.OversizeImages)
+	}
+	return limits, nil
+}
+
+// UndoWindow returns how long destructive operations can be undone, 0 if
+// undo is disabled
+func (c *Config) UndoWindow() time.Duration {
+	switch {
+	case c.UndoFile == "":
+		return 0
+	case c.UndoWindowMinutes == 0:
+		return DefaultUndoWindowMinutes * time.Minute
+	case c.UndoWindowMinutes < 0:
+		return 0
+	}
+	return time.Duration(c.UndoWindowMinutes) * time.Minute
+}
+
+// AuditRetention returns how long audit events are kept, 0 if forever
+func (c *Config) AuditRetention() time.Duration {
+	if c.AuditRetentionDays <= 0 {
+		return 0
+	}
+	return time.Duration(c.AuditRetentionDays) * 24 * time.Hour
+}
+
+// ErrorReporting returns the error reporting settings for a release
+func (c *Config) ErrorReporting(release string) errreport.Config {
+	return errreport.Config{
+		DSN:         c.SentryDSN,
+		Environment: c.SentryEnv,
+		Release:     release,
+	}
+}
+
+// TelemetryEnvironment describes the installation in usage statistics
+func (c *Config) TelemetryEnvironment() telemetry.Environment {
+	backend := c.StorageBackend
+	if backend == "" {
+		backend = string(storage.BackendLocal)
+	}
+	return telemetry.Environment{
+		Version:  c.version,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Database: string(c.DatabaseType),
+		Storage:  backend,
+	}
+}
+
+// EnableFaultInjection makes the database, storage and detector fail at
+// random as described by spec (see faultinject.Parse). It is refused unless
+// the FACE_CLI_ENABLE_FAULT_INJECTION environment variable is set to 1.
+func (c *Config) EnableFaultInjection(spec string) error {
+	if os.Getenv(faultinject.EnableEnv) != "1" {
+		return fmt.Errorf("fault injection is a development mode, set %s=1 to enable it", faultinject.EnableEnv)
+	}
+
+	faultCfg, err := faultinject.Parse(spec)
+	if err != nil {
+		return err
+	}
+	if faultCfg.Seed == 0 {
+		faultCfg.Seed = c.Seed
+	}
+
+	c.faults = faultinject.New(faultCfg)
 	return nil
 }
 
+// Rand returns a source of randomness for one purpose, e.g. "noise". With a
+// seed configured, each purpose gets a reproducible sequence of its own, so
+// randomness added elsewhere does not change it; without, it is random.
+func (c *Config) Rand(purpose string) *rand.Rand {
+	if c.Seed == 0 {
+		return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())) // #nosec G404 -- not security sensitive
+	}
+	h := fnv.New64a()
+	h.Write([]byte(purpose))
+	return rand.New(rand.NewPCG(uint64(c.Seed), h.Sum64())) // #nosec G404 -- reproducible on purpose
+}
+
+// FaultInjector returns the fault injector, or nil when fault injection is
+// disabled
+func (c *Config) FaultInjector() *faultinject.Injector {
+	return c.faults
+}
+
 // GetDatabaseConnection creates a database connection based on config
 func (c *Config) GetDatabaseConnection() (database.Database, error) {
-	return database.NewDatabaseConnection(c.DatabaseType, c.DatabasePath)
+	if _, err := c.Encryption(); err != nil {
+		return nil, err
+	}
+	db, err := database.NewDatabaseConnection(c.DatabaseType, c.DatabasePath, c.DatabaseOptions())
+	if err != nil || c.faults == nil {
+		return db, err
+	}
+	return faultinject.WrapDatabase(db, c.faults), nil
+}
+
+// GetStorage creates the image storage for the configured backend. The
+// faces directory holds every image with the local backend and the cache of
+// recently used images with the tiered backend; the s3 and database
+// backends do not use it. The database backend stores images in db.
+func (c *Config) GetStorage(db database.Database) (storage.Storage, error) {
+	stor, err := c.newStorage(db)
+	if err != nil || c.faults == nil {
+		return stor, err
+	}
+	return faultinject.WrapStorage(stor, c.faults), nil
+}
+
+func (c *Config) newStorage(db database.Database) (storage.Storage, error) {
+	layout, err := storage.ParseLayout(c.StorageLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := storage.ParseBackend(c.StorageBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	stamper, err := c.ProvenanceStamper()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := c.Encryption()
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == storage.BackendDatabase {
+		stored, err := storage.NewDatabaseStorage(db, layout)
+		if err != nil {
+			return nil, err
+		}
+		stored.SetEncoder(stamper)
+		stored.SetEncryptionKey(key)
+		return stored, nil
+	}
+	if backend != storage.BackendLocal && c.S3Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket is required for the %s storage backend", backend)
+	}
+	if backend == storage.BackendS3 {
+		remote, err := storage.NewS3Storage(c.S3Config(), layout)
+		if err != nil {
+			return nil, err
+		}
+		remote.SetEncoder(stamper)
+		remote.SetEncryptionKey(key)
+		return remote, nil
+	}
+
+	local, err := storage.NewFileSystemStorage(c.FacesDir, layout)
+	if err != nil {
+		return nil, err
+	}
+	local.SetEncoder(stamper)
+	local.SetEncryptionKey(key)
+	if backend == storage.BackendLocal {
+		return local, nil
+	}
+
+	cold, err := storage.NewS3Storage(c.S3Config(), layout)
+	if err != nil {
+		return nil, err
+	}
+	cold.SetEncoder(stamper)
+	cold.SetEncryptionKey(key)
+
+	cacheSizeMB := c.CacheSizeMB
+	if cacheSizeMB == 0 {
+		cacheSizeMB = DefaultCacheSizeMB
+	}
+	return storage.NewTieredStorage(local, cold, cacheSizeMB*1024*1024)
+}
+
+// ProvenanceStamper returns the encoder adding provenance to stored face
+// images, which also verifies it
+func (c *Config) ProvenanceStamper() (*provenance.Stamper, error) {
+	mode, err := provenance.ParseMode(c.Provenance)
+	if err != nil {
+		return nil, err
+	}
+
+	stamper := &provenance.Stamper{
+		Mode:     mode,
+		Key:      []byte(c.ProvenanceKey),
+		Software: strings.TrimSpace("face " + c.version),
+		Quality:  storage.JPEGQuality,
+	}
+	if u, err := user.Current(); err == nil {
+		stamper.Operator = u.Username
+	}
+	return stamper, nil
+}
+
+// Redactor returns the redactor of CLI output, MQTT events and logs
+func (c *Config) Redactor() (*redaction.Redactor, error) {
+	return c.RedactorFor(c.Redaction)
+}
+
+// RedactorFor returns a redactor applying the level, e.g. that of an API
+// key
+func (c *Config) RedactorFor(level string) (*redaction.Redactor, error) {
+	parsed, err := redaction.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return &redaction.Redactor{Level: parsed, Key: []byte(c.PseudonymKey)}, nil
+}
+
+// SetVersion sets the version of the running program, recorded in the
+// provenance of stored images
+func (c *Config) SetVersion(version string) {
+	c.version = version
+}
+
+// SetRequestID sets the ID of the run, recorded with its audit events
+func (c *Config) SetRequestID(id string) {
+	c.requestID = id
+}
+
+// RequestID returns the ID of the run, empty if none was set
+func (c *Config) RequestID() string {
+	return c.requestID
+}
+
+// MQTT returns the Home Assistant MQTT settings
+func (c *Config) MQTT() homeassistant.Config {
+	return homeassistant.Config{
+		Broker:          c.MQTTBroker,
+		Username:        c.MQTTUsername,
+		Password:        c.MQTTPassword,
+		Topic:           c.MQTTTopic,
+		DiscoveryPrefix: c.MQTTDiscoveryPrefix,
+	}
+}
+
+// S3Config returns the object storage settings
+func (c *Config) S3Config() storage.S3Config {
+	return storage.S3Config{
+		Endpoint: c.S3Endpoint,
+		Region:   c.S3Region,
+		Bucket:   c.S3Bucket,
+		Prefix:   c.S3Prefix,
+		Insecure: c.S3Insecure,
+	}
+}
+
+// GetMigrator creates a migrator for the configured database
+func (c *Config) GetMigrator() (*database.Migrator, error) {
+	return database.NewMigrator(c.DatabaseType, c.DatabasePath, c.DatabaseOptions())
 }
@@ -0,0 +1,409 @@
+// Package ann is an approximate nearest-neighbor index of embeddings by
+// cosine similarity: a hierarchical navigable small world graph (HNSW,
+// Malkov and Yashunin 2016). Searching it takes time logarithmic in the
+// number of embeddings instead of the linear scan of a brute-force match,
+// at the price of occasionally missing a true nearest neighbor.
+package ann
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// Defaults of Options
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 100
+	DefaultEfSearch       = 64
+)
+
+// ErrInvalidEmbedding is returned when adding an embedding of zero length
+// or of a dimension other than the index's
+var ErrInvalidEmbedding = errors.New("invalid embedding")
+
+// Options tune the index. Zero values take the defaults.
+type Options struct {
+	// M is the number of neighbors linked per node and layer, twice that
+	// on the bottom layer. Larger values raise recall and memory use.
+	M int
+	// EfConstruction is the breadth of the search placing a new node.
+	// Larger values build a better graph, more slowly.
+	EfConstruction int
+	// EfSearch is the breadth of a search. Larger values raise recall and
+	// search time.
+	EfSearch int
+	// Seed seeds the random layer assignment, which decides the shape of
+	// the graph
+	Seed uint64
+}
+
+// Result is an embedding found by a search
+type Result struct {
+	ID         string
+	Similarity float64
+}
+
+type node struct {
+	id string
+	// vec is the embedding scaled to unit length, so the dot product of
+	// two vectors is their cosine similarity
+	vec     []float32
+	links   [][]int32
+	deleted bool
+}
+
+// Index is an HNSW graph. It is safe for concurrent use; searches run in
+// parallel, changes one at a time.
+type Index struct {
+	mu       sync.RWMutex
+	opts     Options
+	levelMul float64
+	rngMu    sync.Mutex
+	rng      *rand.Rand
+	// gen counts rebuilds, which renumber the nodes
+	gen int
+
+	dim      int
+	nodes    []*node
+	ids      map[string]int32
+	entry    int32
+	maxLevel int
+	deleted  int
+}
+
+// New returns an empty index
+func New(opts Options) *Index {
+	if opts.M < 2 {
+		opts.M = DefaultM
+	}
+	if opts.EfConstruction <= 0 {
+		opts.EfConstruction = DefaultEfConstruction
+	}
+	if opts.EfSearch <= 0 {
+		opts.EfSearch = DefaultEfSearch
+	}
+	return &Index{
+		opts:     opts,
+		levelMul: 1 / math.Log(float64(opts.M)),
+		rng:      rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15)),
+		ids:      make(map[string]int32),
+		entry:    -1,
+	}
+}
+
+// Len returns the number of embeddings in the index
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ids)
+}
+
+// Add adds an embedding under id, replacing any embedding already there.
+// Adds may run in parallel: the search for the neighbors of the new node,
+// most of the work, only holds a read lock.
+func (x *Index) Add(id string, embedding []float32) error {
+	vec, ok := unit(embedding)
+	if !ok {
+		return fmt.Errorf("%w: %s has zero length", ErrInvalidEmbedding, id)
+	}
+	n := &node{id: id, vec: vec, links: make([][]int32, x.randomLevel()+1)}
+
+	for {
+		x.mu.RLock()
+		if x.dim != 0 && len(vec) != x.dim {
+			x.mu.RUnlock()
+			return fmt.Errorf("%w: %s has %d dimensions, the index %d", ErrInvalidEmbedding, id, len(vec), x.dim)
+		}
+		gen, empty := x.gen, x.entry < 0
+		links := x.neighbors(vec, len(n.links)-1)
+		x.mu.RUnlock()
+
+		x.mu.Lock()
+		x.remove(id)
+		// the neighbors are stale if the graph was rebuilt or filled
+		// in the meantime
+		if x.gen != gen || empty != (x.entry < 0) {
+			x.mu.Unlock()
+			continue
+		}
+		if x.dim != 0 && len(vec) != x.dim {
+			x.mu.Unlock()
+			return fmt.Errorf("%w: %s has %d dimensions, the index %d", ErrInvalidEmbedding, id, len(vec), x.dim)
+		}
+		x.dim = len(vec)
+		n.links = links
+		x.attach(n)
+		x.mu.Unlock()
+		return nil
+	}
+}
+
+// Remove removes the embedding under id, if any
+func (x *Index) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+// remove marks the node of id deleted. Deleted nodes still route searches
+// but are never returned; once they outnumber the live nodes, the graph is
+// rebuilt without them.
+func (x *Index) remove(id string) {
+	i, ok := x.ids[id]
+	if !ok {
+		return
+	}
+	delete(x.ids, id)
+	x.nodes[i].deleted = true
+	x.deleted++
+	if x.deleted > len(x.ids) && x.deleted > 64 {
+		x.rebuild()
+	}
+}
+
+func (x *Index) rebuild() {
+	old := x.nodes
+	x.nodes, x.ids, x.entry, x.maxLevel, x.deleted = nil, make(map[string]int32, len(x.ids)), -1, 0, 0
+	x.gen++
+	for _, n := range old {
+		if !n.deleted {
+			level := x.randomLevel()
+			x.attach(&node{id: n.id, vec: n.vec, links: x.neighbors(n.vec, level)})
+		}
+	}
+}
+
+// randomLevel returns the top layer of a new node, drawn from an
+// exponential distribution so each layer has about 1/M of the nodes of the
+// layer below
+func (x *Index) randomLevel() int {
+	x.rngMu.Lock()
+	defer x.rngMu.Unlock()
+	return int(-math.Log(1-x.rng.Float64()) * x.levelMul)
+}
+
+// neighbors returns the neighbors of a new node on each layer up to level
+func (x *Index) neighbors(vec []float32, level int) [][]int32 {
+	links := make([][]int32, level+1)
+	if x.entry < 0 {
+		return links
+	}
+
+	ep := x.entry
+	for l := x.maxLevel; l > level; l-- {
+		ep = x.greedy(vec, ep, l)
+	}
+	eps := []candidate{{i: ep, sim: dot(vec, x.nodes[ep].vec)}}
+	for l := min(level, x.maxLevel); l >= 0; l-- {
+		found := x.searchLayer(vec, eps, x.opts.EfConstruction, l)
+		links[l] = x.selectNeighbors(found, x.maxLinks(l))
+		eps = found
+	}
+	return links
+}
+
+// attach adds a node with its links to the graph, linking its neighbors
+// back to it
+func (x *Index) attach(n *node) {
+	i := int32(len(x.nodes))
+	x.nodes = append(x.nodes, n)
+	x.ids[n.id] = i
+	for l, links := range n.links {
+		for _, nb := range links {
+			x.link(nb, i, l)
+		}
+	}
+
+	if level := len(n.links) - 1; x.entry < 0 || level > x.maxLevel {
+		x.entry, x.maxLevel = i, level
+	}
+}
+
+// maxLinks returns the most links a node may have on a layer
+func (x *Index) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * x.opts.M
+	}
+	return x.opts.M
+}
+
+// link adds a link from node from to node to on a layer. When from has too
+// many links, its least similar neighbor is dropped; selecting diverse
+// neighbors again would make inserts several times slower.
+func (x *Index) link(from, to int32, layer int) {
+	n := x.nodes[from]
+	if len(n.links[layer]) < x.maxLinks(layer) {
+		n.links[layer] = append(n.links[layer], to)
+		return
+	}
+
+	worst, worstSim := -1, dot(n.vec, x.nodes[to].vec)
+	for j, nb := range n.links[layer] {
+		if sim := dot(n.vec, x.nodes[nb].vec); sim < worstSim {
+			worst, worstSim = j, sim
+		}
+	}
+	if worst >= 0 {
+		n.links[layer][worst] = to
+	}
+}
+
+// selectNeighbors picks up to m of candidates sorted best first, preferring
+// ones that are closer to the node than to the neighbors already picked, so
+// links reach out in different directions. Remaining places are filled with
+// the best of the rest.
+func (x *Index) selectNeighbors(cands []candidate, m int) []int32 {
+	picked := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range cands {
+		if len(picked) == m {
+			break
+		}
+		diverse := true
+		for _, p := range picked {
+			if dot(x.nodes[c.i].vec, x.nodes[p].vec) > c.sim {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			picked = append(picked, c.i)
+		} else {
+			skipped = append(skipped, c.i)
+		}
+	}
+	for _, s := range skipped {
+		if len(picked) == m {
+			break
+		}
+		picked = append(picked, s)
+	}
+	return picked
+}
+
+// greedy walks a layer from ep to the node most similar to q
+func (x *Index) greedy(q []float32, ep int32, layer int) int32 {
+	best := dot(q, x.nodes[ep].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range x.nodes[ep].links[layer] {
+			if sim := dot(q, x.nodes[nb].vec); sim > best {
+				best, ep, changed = sim, nb, true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns the ef nodes of a layer most similar to q that a
+// best-first search from the entry points finds, best first
+func (x *Index) searchLayer(q []float32, eps []candidate, ef, layer int) []candidate {
+	visited := make(map[int32]bool, ef*4)
+	frontier := &maxHeap{}
+	found := &minHeap{}
+	for _, ep := range eps {
+		visited[ep.i] = true
+		heap.Push(frontier, ep)
+		heap.Push(found, ep)
+	}
+	for found.Len() > ef {
+		heap.Pop(found)
+	}
+
+	for frontier.Len() > 0 {
+		c := heap.Pop(frontier).(candidate)
+		if found.Len() >= ef && c.sim < (*found)[0].sim {
+			break
+		}
+		for _, nb := range x.nodes[c.i].links[layer] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			sim := dot(q, x.nodes[nb].vec)
+			if found.Len() < ef || sim > (*found)[0].sim {
+				heap.Push(frontier, candidate{i: nb, sim: sim})
+				heap.Push(found, candidate{i: nb, sim: sim})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	result := make([]candidate, found.Len())
+	for j := len(result) - 1; j >= 0; j-- {
+		result[j] = heap.Pop(found).(candidate)
+	}
+	return result
+}
+
+// Search returns up to k embeddings most similar to query, most similar
+// first. Embeddings of another dimension than the index's return nothing.
+func (x *Index) Search(query []float32, k int) []Result {
+	q, ok := unit(query)
+	if !ok || k <= 0 {
+		return nil
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.entry < 0 || len(q) != x.dim {
+		return nil
+	}
+
+	ep := x.entry
+	for l := x.maxLevel; l > 0; l-- {
+		ep = x.greedy(q, ep, l)
+	}
+	found := x.searchLayer(q, []candidate{{i: ep, sim: dot(q, x.nodes[ep].vec)}}, max(x.opts.EfSearch, k), 0)
+
+	results := make([]Result, 0, k)
+	for _, c := range found {
+		if n := x.nodes[c.i]; !n.deleted {
+			results = append(results, Result{ID: n.id, Similarity: c.sim})
+			if len(results) == k {
+				break
+			}
+		}
+	}
+	return results
+}
+
+// unit returns v scaled to unit length, and false if it has zero length
+func unit(v []float32) ([]float32, bool) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	norm := math.Sqrt(sum)
+	if norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) {
+		return nil, false
+	}
+	u := make([]float32, len(v))
+	for j, f := range v {
+		u[j] = float32(float64(f) / norm)
+	}
+	return u, true
+}
+
+// dot returns the dot product of two vectors of the same length, summed
+// in four lanes so the loop pipelines
+func dot(a, b []float32) float64 {
+	var s0, s1, s2, s3 float32
+	j := 0
+	for ; j+4 <= len(a); j += 4 {
+		s0 += a[j] * b[j]
+		s1 += a[j+1] * b[j+1]
+		s2 += a[j+2] * b[j+2]
+		s3 += a[j+3] * b[j+3]
+	}
+	for ; j < len(a); j++ {
+		s0 += a[j] * b[j]
+	}
+	return float64(s0 + s1 + s2 + s3)
+}
@@ -0,0 +1,169 @@
+package ann
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// Size of the recall tests: random embeddings spread evenly, the hardest
+// case for the graph as no neighbors stand out
+const (
+	testEmbeddings = 2000
+	testDimension  = 64
+	testQueries    = 100
+	testK          = 10
+	// testMinRecall is the share of the true nearest neighbors a search
+	// must find with the default options
+	testMinRecall = 0.95
+)
+
+func testVectors(rng *rand.Rand, n int) [][]float32 {
+	vecs := make([][]float32, n)
+	for i := range vecs {
+		vecs[i] = make([]float32, testDimension)
+		for j := range vecs[i] {
+			vecs[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vecs
+}
+
+// bruteForce returns the IDs of the k embeddings most similar to query
+func bruteForce(ids []string, vecs [][]float32, query []float32, k int) []string {
+	q, _ := unit(query)
+	type scored struct {
+		id  string
+		sim float64
+	}
+	all := make([]scored, 0, len(vecs))
+	for i, v := range vecs {
+		u, _ := unit(v)
+		all = append(all, scored{ids[i], dot(q, u)})
+	}
+	slices.SortFunc(all, func(a, b scored) int { return cmp.Compare(b.sim, a.sim) })
+	top := make([]string, 0, k)
+	for _, s := range all[:k] {
+		top = append(top, s.id)
+	}
+	return top
+}
+
+// recall returns the share of the true nearest neighbors of the queries
+// that the index finds
+func recall(t *testing.T, x *Index, ids []string, vecs, queries [][]float32) float64 {
+	t.Helper()
+	found := 0
+	for _, q := range queries {
+		want := bruteForce(ids, vecs, q, testK)
+		for _, r := range x.Search(q, testK) {
+			if slices.Contains(want, r.ID) {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(len(queries)*testK)
+}
+
+// TestRecall checks that searches find nearly all true nearest neighbors
+func TestRecall(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	vecs := testVectors(rng, testEmbeddings)
+	ids := make([]string, len(vecs))
+	x := New(Options{Seed: 1})
+	for i, v := range vecs {
+		ids[i] = fmt.Sprintf("e%d", i)
+		if err := x.Add(ids[i], v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if x.Len() != testEmbeddings {
+		t.Fatalf("index has %d embeddings, want %d", x.Len(), testEmbeddings)
+	}
+
+	if r := recall(t, x, ids, vecs, testVectors(rng, testQueries)); r < testMinRecall {
+		t.Errorf("recall@%d is %.3f, want at least %.2f", testK, r, testMinRecall)
+	}
+}
+
+// TestRecallAfterRemove checks that removed embeddings are never returned
+// and recall holds once the graph was rebuilt without them
+func TestRecallAfterRemove(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	vecs := testVectors(rng, testEmbeddings)
+	x := New(Options{Seed: 2})
+	var ids []string
+	var kept [][]float32
+	for i, v := range vecs {
+		if err := x.Add(fmt.Sprintf("e%d", i), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, v := range vecs {
+		id := fmt.Sprintf("e%d", i)
+		if i%3 != 0 {
+			x.Remove(id)
+			continue
+		}
+		ids = append(ids, id)
+		kept = append(kept, v)
+	}
+	if x.Len() != len(ids) {
+		t.Fatalf("index has %d embeddings, want %d", x.Len(), len(ids))
+	}
+
+	queries := testVectors(rng, testQueries)
+	for _, q := range queries {
+		for _, r := range x.Search(q, testK) {
+			if !slices.Contains(ids, r.ID) {
+				t.Fatalf("search returned removed embedding %s", r.ID)
+			}
+		}
+	}
+	if r := recall(t, x, ids, kept, queries); r < testMinRecall {
+		t.Errorf("recall@%d after removing is %.3f, want at least %.2f", testK, r, testMinRecall)
+	}
+}
+
+// TestAddReplaces checks that adding an ID again replaces its embedding
+func TestAddReplaces(t *testing.T) {
+	x := New(Options{})
+	if err := x.Add("a", []float32{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Add("b", []float32{0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Add("a", []float32{0.1, 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if x.Len() != 2 {
+		t.Errorf("index has %d embeddings, want 2", x.Len())
+	}
+	results := x.Search([]float32{1, 0}, 2)
+	if len(results) != 2 || results[0].ID != "a" || results[0].Similarity > 0.2 {
+		t.Errorf("search found %+v, want the replaced embedding of a", results)
+	}
+}
+
+// TestInvalidEmbedding checks that embeddings of zero length or another
+// dimension are refused, and queries of another dimension find nothing
+func TestInvalidEmbedding(t *testing.T) {
+	x := New(Options{})
+	if err := x.Add("zero", []float32{0, 0, 0}); !errors.Is(err, ErrInvalidEmbedding) {
+		t.Errorf("zero length: got %v, want ErrInvalidEmbedding", err)
+	}
+	if err := x.Add("a", []float32{1, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Add("b", []float32{1, 0}); !errors.Is(err, ErrInvalidEmbedding) {
+		t.Errorf("other dimension: got %v, want ErrInvalidEmbedding", err)
+	}
+	if results := x.Search([]float32{1, 0}, 1); len(results) != 0 {
+		t.Errorf("query of another dimension found %+v", results)
+	}
+}
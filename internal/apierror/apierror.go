@@ -0,0 +1,240 @@
+// Package apierror defines the errors of the API server: a stable code for
+// every kind of failure, the HTTP and gRPC statuses reporting it, and
+// whether a failed request may be retried.
+package apierror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/imaging"
+)
+
+// Code identifies a kind of failure. Codes are part of the API and never
+// change meaning; clients should branch on them rather than on messages.
+type Code string
+
+const (
+	// CodeInvalidArgument is a missing or malformed request field
+	CodeInvalidArgument Code = "invalid_argument"
+	// CodeUnauthenticated is a missing or wrong API key
+	CodeUnauthenticated Code = "unauthenticated"
+	// CodePermissionDenied is a request the role of the client's API key
+	// does not allow
+	CodePermissionDenied Code = "permission_denied"
+	// CodeNotFound is a user, face or avatar that does not exist
+	CodeNotFound Code = "not_found"
+	// CodeAlreadyExists is a user that was already enrolled
+	CodeAlreadyExists Code = "already_exists"
+	// CodeDuplicateName is an enrollment under the name of another user,
+	// refused by the duplicate name policy
+	CodeDuplicateName Code = "duplicate_name"
+	// CodeNoMatch is a face matching no user
+	CodeNoMatch Code = "no_match"
+	// CodeInvalidImage is an upload that cannot be decoded as an image
+	CodeInvalidImage Code = "invalid_image"
+	// CodeFaceNotDetected is an image without a face
+	CodeFaceNotDetected Code = "face_not_detected"
+	// CodeMultipleFaces is an image with several faces where one was
+	// expected
+	CodeMultipleFaces Code = "multiple_faces"
+	// CodeLowQuality is a face too poor to enroll
+	CodeLowQuality Code = "low_quality"
+	// CodeSpoofDetected is a face that failed the liveness check: a
+	// printed photo or a screen rather than a live person
+	CodeSpoofDetected Code = "spoof_detected"
+	// CodeLimitReached is a user that has the maximum number of faces
+	CodeLimitReached Code = "limit_reached"
+	// CodeTooLarge is a request or an image larger than the server accepts
+	CodeTooLarge Code = "too_large"
+	// CodeBusy is a request rejected because every worker is busy and the
+	// queue is full. It is returned before the request does anything.
+	CodeBusy Code = "busy"
+	// CodeTimeout is a request that did not finish in time
+	CodeTimeout Code = "timeout"
+	// CodeUnsupported is a feature the configured database lacks
+	CodeUnsupported Code = "unsupported"
+	// CodeInternal is any other failure of the server
+	CodeInternal Code = "internal"
+)
+
+// gRPC status codes, as numbered by google.golang.org/grpc/codes
+const (
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnauthenticated    = 16
+)
+
+// kind is how a code is reported
+type kind struct {
+	status    int
+	grpc      uint32
+	retryable bool
+}
+
+var kinds = map[Code]kind{
+	CodeInvalidArgument:  {http.StatusBadRequest, grpcInvalidArgument, false},
+	CodeUnauthenticated:  {http.StatusUnauthorized, grpcUnauthenticated, false},
+	CodePermissionDenied: {http.StatusForbidden, grpcPermissionDenied, false},
+	CodeNotFound:         {http.StatusNotFound, grpcNotFound, false},
+	CodeAlreadyExists:    {http.StatusConflict, grpcAlreadyExists, false},
+	CodeDuplicateName:    {http.StatusConflict, grpcAlreadyExists, false},
+	CodeNoMatch:          {http.StatusNotFound, grpcNotFound, false},
+	CodeInvalidImage:     {http.StatusBadRequest, grpcInvalidArgument, false},
+	CodeFaceNotDetected:  {http.StatusUnprocessableEntity, grpcInvalidArgument, false},
+	CodeMultipleFaces:    {http.StatusUnprocessableEntity, grpcInvalidArgument, false},
+	CodeLowQuality:       {http.StatusUnprocessableEntity, grpcInvalidArgument, false},
+	CodeSpoofDetected:    {http.StatusUnprocessableEntity, grpcInvalidArgument, false},
+	CodeLimitReached:     {http.StatusConflict, grpcFailedPrecondition, false},
+	CodeTooLarge:         {http.StatusRequestEntityTooLarge, grpcResourceExhausted, false},
+	CodeBusy:             {http.StatusTooManyRequests, grpcResourceExhausted, true},
+	CodeTimeout:          {http.StatusGatewayTimeout, grpcDeadlineExceeded, true},
+	CodeUnsupported:      {http.StatusNotImplemented, grpcUnimplemented, false},
+	CodeInternal:         {http.StatusInternalServerError, grpcInternal, false},
+}
+
+// internalMessage replaces the message of internal errors in responses, as
+// it may reveal details of the server. The full error is logged.
+const internalMessage = "internal server error"
+
+// Error is a failure reported to API clients
+type Error struct {
+	Code Code
+	// Details are machine-readable facts about the failure, e.g. the
+	// invalid field
+	Details map[string]any
+	err     error
+}
+
+// New returns an error with the code and a formatted message
+func New(code Code, format string, args ...any) *Error {
+	return &Error{Code: code, err: fmt.Errorf(format, args...)}
+}
+
+// Wrap returns an error with the code, reporting err
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, err: err}
+}
+
+func (e *Error) Error() string { return e.err.Error() }
+func (e *Error) Unwrap() error { return e.err }
+
+// WithDetail adds a detail to the error and returns it
+func (e *Error) WithDetail(key string, value any) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// HTTPStatus returns the HTTP status reporting the error
+func (e *Error) HTTPStatus() int {
+	return e.kind().status
+}
+
+// GRPCCode returns the gRPC status code reporting the error
+func (e *Error) GRPCCode() uint32 {
+	return e.kind().grpc
+}
+
+// Retryable reports whether the same request may succeed if sent again
+// later
+func (e *Error) Retryable() bool {
+	return e.kind().retryable
+}
+
+// Message returns the message for clients, which hides internal errors
+func (e *Error) Message() string {
+	if e.Code == CodeInternal {
+		return internalMessage
+	}
+	return e.err.Error()
+}
+
+func (e *Error) kind() kind {
+	if k, ok := kinds[e.Code]; ok {
+		return k
+	}
+	return kinds[CodeInternal]
+}
+
+// typed maps the typed errors of the rest of the program to codes
+var typed = []struct {
+	err  error
+	code Code
+}{
+	{models.ErrUserNotFound, CodeNotFound},
+	{models.ErrProbeNotFound, CodeNotFound},
+	{models.ErrScopeNotFound, CodeNotFound},
+	{models.ErrScopeExists, CodeAlreadyExists},
+	{models.ErrInvalidScope, CodeInvalidArgument},
+	{models.ErrUserAlreadyExists, CodeAlreadyExists},
+	{models.ErrDuplicateName, CodeDuplicateName},
+	{models.ErrNoMatch, CodeNoMatch},
+	{models.ErrInvalidImage, CodeInvalidImage},
+	{imaging.ErrImageTooLarge, CodeTooLarge},
+	{models.ErrFaceNotDetected, CodeFaceNotDetected},
+	{models.ErrMultipleFaces, CodeMultipleFaces},
+	{models.ErrSpoofDetected, CodeSpoofDetected},
+	{models.ErrMaxFacesReached, CodeLimitReached},
+	{models.ErrEmptyName, CodeInvalidArgument},
+	{models.ErrInvalidID, CodeInvalidArgument},
+	{models.ErrLabelTooLong, CodeInvalidArgument},
+	{models.ErrInvalidCardNumber, CodeInvalidArgument},
+	{models.ErrDimensionMismatch, CodeInvalidArgument},
+	{database.ErrChangeLogUnsupported, CodeUnsupported},
+	{database.ErrQueriesUnsupported, CodeUnsupported},
+	{context.DeadlineExceeded, CodeTimeout},
+}
+
+// From returns err as an Error: itself if it is one, the code of a typed
+// error it wraps, or CodeInternal
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Wrap(CodeTooLarge, err).WithDetail("limit_bytes", tooLarge.Limit)
+	}
+	for _, t := range typed {
+		if errors.Is(err, t.err) {
+			return Wrap(t.code, err)
+		}
+	}
+	return Wrap(CodeInternal, err)
+}
+
+// Envelope is the JSON body of error responses, under an "error" key
+type Envelope struct {
+	Code      Code           `json:"code"`
+	Message   string         `json:"message"`
+	Retryable bool           `json:"retryable"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+// Envelope returns the error as reported to clients
+func (e *Error) Envelope(requestID string) Envelope {
+	return Envelope{
+		Code:      e.Code,
+		Message:   e.Message(),
+		Retryable: e.Retryable(),
+		Details:   e.Details,
+		RequestID: requestID,
+	}
+}
@@ -0,0 +1,296 @@
+// Package backup encrypts backups and copies them to off-site targets.
+//
+// An encrypted backup starts with a header naming how its key was made,
+// followed by the data in chunks of chunkSize bytes, each sealed with
+// AES-256-GCM. Chunks are numbered and the last is marked as such, so
+// reordered, dropped or truncated chunks fail to decrypt like modified
+// ones do. The header is authenticated with every chunk.
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Extension is appended to the names of encrypted backups
+const Extension = ".enc"
+
+// MinPassphraseLength is the shortest passphrase accepted for encryption
+const MinPassphraseLength = 12
+
+// KeySize is the size of the AES-256 key and of key files
+const KeySize = 32
+
+const (
+	magic      = "FACEBKP1"
+	chunkSize  = 64 * 1024
+	saltSize   = 16
+	prefixSize = 7 // nonce prefix; the counter and last-chunk flag make up the rest
+	headerSize = len(magic) + 4 + saltSize + prefixSize
+
+	// scrypt parameters of passphrases, stored in the header
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+// Kinds of key, stored in the header
+const (
+	kindKeyFile    = 1
+	kindPassphrase = 2
+)
+
+// ErrWrongKey is returned when a backup does not decrypt with the key
+var ErrWrongKey = errors.New("wrong passphrase or key file, or the backup was modified")
+
+// ErrDamaged is returned when an encrypted backup ends early or was
+// modified after its first chunk
+var ErrDamaged = errors.New("encrypted backup is damaged or truncated")
+
+// Key is the secret a backup is encrypted with: a passphrase, or the
+// contents of a key file
+type Key struct {
+	kind   byte
+	secret []byte
+}
+
+// Passphrase returns the key of a passphrase
+func Passphrase(passphrase string) (Key, error) {
+	if len(passphrase) < MinPassphraseLength {
+		return Key{}, fmt.Errorf("passphrase must be at least %d characters", MinPassphraseLength)
+	}
+	return Key{kind: kindPassphrase, secret: []byte(passphrase)}, nil
+}
+
+// ReadKeyFile returns the key in a key file: 32 random bytes, raw or hex
+// encoded, e.g. made with 'openssl rand -hex 32'
+func ReadKeyFile(path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) != KeySize {
+		decoded, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil || len(decoded) != KeySize {
+			return Key{}, fmt.Errorf("key file %s must hold %d bytes, raw or hex encoded", path, KeySize)
+		}
+		data = decoded
+	}
+	return Key{kind: kindKeyFile, secret: data}, nil
+}
+
+func (k Key) String() string {
+	if k.kind == kindPassphrase {
+		return "passphrase"
+	}
+	return "key file"
+}
+
+// derive returns the AES key of a backup with the given header
+func (k Key) derive(header []byte) ([]byte, error) {
+	salt := header[len(magic)+4 : len(magic)+4+saltSize]
+	if header[len(magic)] == kindPassphrase {
+		logN, r, p := header[len(magic)+1], header[len(magic)+2], header[len(magic)+3]
+		if logN > 20 {
+			return nil, fmt.Errorf("encrypted backup asks for scrypt cost 2^%d, more than allowed", logN)
+		}
+		return scrypt.Key(k.secret, salt, 1<<logN, int(r), int(p), KeySize)
+	}
+
+	// a fresh salt gives every backup its own key, so nonces never repeat
+	// under one key even though the key file does
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, k.secret, salt, []byte("face backup")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// IsEncrypted reports whether r, positioned at the start of a backup,
+// holds an encrypted backup, without consuming anything
+func IsEncrypted(r *bufio.Reader) (bool, error) {
+	start, err := r.Peek(len(magic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return string(start) == magic, nil
+}
+
+// Encrypt returns a writer encrypting what is written to w. The backup is
+// only complete once Close returns without error; Close does not close w.
+func Encrypt(w io.Writer, key Key) (io.WriteCloser, error) {
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	header[len(magic)] = key.kind
+	if key.kind == kindPassphrase {
+		header[len(magic)+1], header[len(magic)+2], header[len(magic)+3] = scryptLogN, scryptR, scryptP
+	}
+	if _, err := rand.Read(header[len(magic)+4:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(key, header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encrypter{w: w, aead: aead, header: header, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Decrypt returns a reader of the decrypted contents of r
+func Decrypt(r io.Reader, key Key) (io.Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDamaged
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.New("not an encrypted backup")
+	}
+	if kind := header[len(magic)]; kind != key.kind {
+		return nil, fmt.Errorf("backup is encrypted with a %s, not a %s", Key{kind: kind}, key)
+	}
+
+	aead, err := newAEAD(key, header)
+	if err != nil {
+		return nil, err
+	}
+	return &decrypter{r: r, aead: aead, header: header, chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+func newAEAD(key Key, header []byte) (cipher.AEAD, error) {
+	aesKey, err := key.derive(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce returns the nonce of chunk n: the random prefix of the header, the
+// chunk number and whether it is the last chunk
+func nonce(header []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, header[headerSize-prefixSize:])
+	binary.BigEndian.PutUint32(nonce[prefixSize:], n)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type encrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	n      uint32
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data follows, so the last
+		// chunk is always shorter than chunkSize
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the last chunk
+func (e *encrypter) Close() error {
+	if len(e.buf) == chunkSize {
+		if err := e.seal(false); err != nil {
+			return err
+		}
+	}
+	return e.seal(true)
+}
+
+func (e *encrypter) seal(last bool) error {
+	if e.n == ^uint32(0) {
+		return errors.New("backup too large to encrypt")
+	}
+	sealed := e.aead.Seal(nil, nonce(e.header, e.n, last), e.buf, e.header)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.n++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decrypter struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	chunk  []byte
+	plain  []byte
+	n      uint32
+	done   bool
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk. A chunk shorter than a full one is the
+// last, as Close of the encrypter guarantees.
+func (d *decrypter) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrDamaged
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		d.done = true
+	case err != nil:
+		return err
+	}
+
+	plain, err := d.aead.Open(d.chunk[:0], nonce(d.header, d.n, d.done), d.chunk[:n], d.header)
+	if err != nil {
+		// the key is only wrong if no chunk opened
+		if d.n > 0 {
+			return ErrDamaged
+		}
+		return ErrWrongKey
+	}
+	d.plain = plain
+	d.n++
+	return nil
+}
@@ -0,0 +1,53 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"face/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// s3Target uploads backups to an S3-compatible bucket
+type s3Target struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Target(cfg storage.S3Config) (*s3Target, error) {
+	client, err := storage.NewS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Target{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *s3Target) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, path.Join(s.prefix, name), r, size,
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	if err != nil {
+		return fmt.Errorf("failed to upload backup to %s: %w", s, err)
+	}
+	return nil
+}
+
+func (s *s3Target) Download(ctx context.Context, name string, w io.Writer) error {
+	obj, err := s.client.GetObject(ctx, s.bucket, path.Join(s.prefix, name), minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to download backup from %s: %w", s, err)
+	}
+	defer obj.Close()
+
+	if _, err := io.Copy(w, obj); err != nil {
+		return fmt.Errorf("failed to download backup from %s: %w", s, err)
+	}
+	return nil
+}
+
+func (s *s3Target) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
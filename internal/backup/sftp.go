@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultKeyFiles are tried in ~/.ssh when no key file is given
+var defaultKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sftpTarget uploads backups to a directory of an SSH server
+type sftpTarget struct {
+	user       string
+	host       string // host[:port]
+	dir        string
+	keyFile    string
+	knownHosts string
+}
+
+func (s *sftpTarget) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	return s.session(ctx, func(client *sftp.Client) error {
+		if err := client.MkdirAll(s.dir); err != nil {
+			return err
+		}
+
+		// written under a temporary name, so an interrupted upload never
+		// looks like a complete backup
+		final := path.Join(s.dir, name)
+		partial := final + ".part"
+		file, err := client.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		if _, err := file.ReadFrom(r); err != nil {
+			file.Close()
+			client.Remove(partial)
+			return err
+		}
+		if err := file.Close(); err != nil {
+			client.Remove(partial)
+			return err
+		}
+		return client.PosixRename(partial, final)
+	})
+}
+
+func (s *sftpTarget) Download(ctx context.Context, name string, w io.Writer) error {
+	return s.session(ctx, func(client *sftp.Client) error {
+		file, err := client.Open(path.Join(s.dir, name))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = file.WriteTo(w)
+		return err
+	})
+}
+
+func (s *sftpTarget) String() string {
+	if s.user == "" {
+		return "sftp://" + s.host + s.dir
+	}
+	return "sftp://" + s.user + "@" + s.host + s.dir
+}
+
+// session connects to the server and runs fn with an SFTP client
+func (s *sftpTarget) session(ctx context.Context, fn func(*sftp.Client) error) error {
+	config, closeAgent, err := s.clientConfig()
+	if err != nil {
+		return err
+	}
+	defer closeAgent()
+
+	addr := s.host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", s, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return fmt.Errorf("host key of %s is not known: add it to known_hosts, e.g. with ssh-keyscan", addr)
+		}
+		return fmt.Errorf("failed to connect to %s: %w", s, err)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	defer sshClient.Close()
+
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return fmt.Errorf("failed to start SFTP on %s: %w", s, err)
+	}
+	defer client.Close()
+
+	if err := fn(client); err != nil {
+		return fmt.Errorf("%s: %w", s, err)
+	}
+	return nil
+}
+
+// clientConfig returns the SSH settings: the user, the keys of the agent and
+// key files, and the known hosts. The returned function closes the agent
+// connection.
+func (s *sftpTarget) clientConfig() (*ssh.ClientConfig, func(), error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	knownHostsFile := s.knownHosts
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	username := s.user
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, nil, err
+		}
+		username = current.Username
+	}
+
+	var signers []ssh.Signer
+	closeAgent := func() {}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { conn.Close() }
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+
+	keyFiles := []string{s.keyFile}
+	if s.keyFile == "" {
+		keyFiles = nil
+		for _, name := range defaultKeyFiles {
+			keyFiles = append(keyFiles, filepath.Join(home, ".ssh", name))
+		}
+	}
+	for _, keyFile := range keyFiles {
+		signer, err := readPrivateKey(keyFile)
+		if err != nil {
+			if s.keyFile == "" {
+				continue
+			}
+			closeAgent()
+			return nil, nil, err
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) == 0 {
+		closeAgent()
+		return nil, nil, errors.New("no usable SSH key for the SFTP target: give one with ?key=, or add it to an SSH agent if it has a passphrase")
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeys,
+	}, closeAgent, nil
+}
+
+func readPrivateKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, fmt.Errorf("SSH key %s is protected by a passphrase: add it to an SSH agent instead", path)
+		}
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", path, err)
+	}
+	return signer, nil
+}
@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"face/internal/storage"
+)
+
+// Target is an off-site location backups are uploaded to
+type Target interface {
+	// Upload stores a backup of the given size under name
+	Upload(ctx context.Context, name string, r io.Reader, size int64) error
+	// Download writes the backup stored under name to w
+	Download(ctx context.Context, name string, w io.Writer) error
+	// String describes the target, without secrets
+	String() string
+}
+
+// ParseTarget returns the target of a URL naming a directory:
+//
+//	s3://bucket/prefix?endpoint=minio:9000&region=eu-west-1&insecure=true
+//	sftp://user@host:22/srv/backups?key=/root/.ssh/id_ed25519&known_hosts=/root/.ssh/known_hosts
+//
+// Credentials of S3 are read as described for storage.S3Storage. SFTP
+// authenticates with the SSH agent or the key file, and only connects to
+// hosts in known_hosts (~/.ssh/known_hosts if not given).
+func ParseTarget(rawURL string) (Target, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup target: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid backup target %q: expected s3://bucket/prefix or sftp://user@host/path", rawURL)
+	}
+	query := u.Query()
+
+	switch u.Scheme {
+	case "s3":
+		cfg := storage.S3Config{
+			Endpoint: query.Get("endpoint"),
+			Region:   query.Get("region"),
+			Bucket:   u.Host,
+			Prefix:   strings.Trim(u.Path, "/"),
+		}
+		if insecure := query.Get("insecure"); insecure != "" {
+			if cfg.Insecure, err = strconv.ParseBool(insecure); err != nil {
+				return nil, fmt.Errorf("invalid backup target: insecure=%q", insecure)
+			}
+		}
+		return newS3Target(cfg)
+	case "sftp":
+		return &sftpTarget{
+			user:       u.User.Username(),
+			host:       u.Host,
+			dir:        path.Clean("/" + u.Path),
+			keyFile:    query.Get("key"),
+			knownHosts: query.Get("known_hosts"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported backup target %q: expected s3 or sftp", u.Scheme)
+	}
+}
+
+// ParseLocation returns the target and name of a URL naming a backup
+func ParseLocation(rawURL string) (Target, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid backup location: %w", err)
+	}
+	dir, name := path.Split(u.Path)
+	if name == "" {
+		return nil, "", fmt.Errorf("invalid backup location %q: no file name", rawURL)
+	}
+	u.Path = dir
+	target, err := ParseTarget(u.String())
+	if err != nil {
+		return nil, "", err
+	}
+	return target, name, nil
+}
+
+// IsLocation reports whether a backup argument is a URL rather than a file
+func IsLocation(arg string) bool {
+	return strings.HasPrefix(arg, "s3://") || strings.HasPrefix(arg, "sftp://")
+}
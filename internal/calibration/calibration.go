@@ -0,0 +1,144 @@
+// Package calibration measures how well similarity scores separate genuine
+// pairs (two images of the same person) from impostor pairs (images of two
+// different people), to choose a match threshold from labeled images rather
+// than by guessing.
+package calibration
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+)
+
+// Steps is how many intervals a curve divides thresholds 0 to 1 into, fine
+// enough for models whose scores crowd into a narrow range
+const Steps = 1000
+
+// ErrOneSided is returned when there are no genuine or no impostor scores,
+// as the error rates of one cannot be traded against the other's
+var ErrOneSided = errors.New("calibration needs both genuine and impostor pairs")
+
+// Point is the error rates of a threshold
+type Point struct {
+	Threshold float64 `json:"threshold"`
+	// FAR is the false accept rate: the share of impostor pairs scoring at
+	// least the threshold
+	FAR float64 `json:"far"`
+	// FRR is the false reject rate: the share of genuine pairs scoring
+	// below the threshold
+	FRR float64 `json:"frr"`
+}
+
+// TAR returns the true accept rate, the share of genuine pairs accepted;
+// a ROC curve plots it against the FAR
+func (p Point) TAR() float64 {
+	return 1 - p.FRR
+}
+
+// Scores are the similarities of labeled pairs
+type Scores struct {
+	Genuine  []float64
+	Impostor []float64
+}
+
+// Check returns ErrOneSided unless there are scores of both kinds
+func (s Scores) Check() error {
+	if len(s.Genuine) == 0 || len(s.Impostor) == 0 {
+		return ErrOneSided
+	}
+	return nil
+}
+
+// At returns the error rates of a threshold. A pair is accepted when its
+// score reaches the threshold, as in matching.Matches.
+func (s Scores) At(threshold float64) Point {
+	return Point{
+		Threshold: threshold,
+		FAR:       share(len(s.Impostor)-countBelow(s.Impostor, threshold), len(s.Impostor)),
+		FRR:       share(countBelow(s.Genuine, threshold), len(s.Genuine)),
+	}
+}
+
+// Curve returns the error rates of thresholds 0 to 1 in Steps steps, FAR
+// falling and FRR rising with the threshold
+func (s Scores) Curve() []Point {
+	sorted := Scores{Genuine: slices.Sorted(slices.Values(s.Genuine)), Impostor: slices.Sorted(slices.Values(s.Impostor))}
+	points := make([]Point, Steps+1)
+	for i := range points {
+		points[i] = sorted.atSorted(float64(i) / Steps)
+	}
+	return points
+}
+
+// atSorted is At for sorted scores
+func (s Scores) atSorted(threshold float64) Point {
+	below := func(scores []float64) int { return sort.SearchFloat64s(scores, threshold) }
+	return Point{
+		Threshold: threshold,
+		FAR:       share(len(s.Impostor)-below(s.Impostor), len(s.Impostor)),
+		FRR:       share(below(s.Genuine), len(s.Genuine)),
+	}
+}
+
+// AUC returns the area under the ROC curve: the chance that a genuine pair
+// scores higher than an impostor pair, ties counting half. 1 separates them
+// perfectly at some threshold, 0.5 is no better than chance.
+func (s Scores) AUC() float64 {
+	if s.Check() != nil {
+		return 0
+	}
+	impostor := slices.Sorted(slices.Values(s.Impostor))
+	var wins float64
+	for _, g := range s.Genuine {
+		lower := sort.SearchFloat64s(impostor, g)
+		upper := sort.Search(len(impostor), func(i int) bool { return impostor[i] > g })
+		wins += float64(lower) + float64(upper-lower)/2
+	}
+	return wins / float64(len(s.Genuine)*len(impostor))
+}
+
+// EqualError returns the point of a curve where FAR and FRR are closest,
+// its equal error rate being their mean there. Of equally close points, the
+// one with the fewest errors wins, then the highest threshold.
+func EqualError(curve []Point) Point {
+	best := curve[0]
+	for _, p := range curve[1:] {
+		gap, bestGap := math.Abs(p.FAR-p.FRR), math.Abs(best.FAR-best.FRR)
+		if gap < bestGap || gap == bestGap && p.FAR+p.FRR <= best.FAR+best.FRR {
+			best = p
+		}
+	}
+	return best
+}
+
+// AtFAR returns the lowest threshold of a curve whose FAR is at most
+// target, rejecting as few genuine pairs as the target allows, or false if
+// even the highest accepts more impostors
+func AtFAR(curve []Point, target float64) (Point, bool) {
+	for _, p := range curve {
+		if p.FAR <= target {
+			return p, true
+		}
+	}
+	return Point{}, false
+}
+
+// countBelow returns how many scores are below the threshold
+func countBelow(scores []float64, threshold float64) int {
+	n := 0
+	for _, s := range scores {
+		if s < threshold {
+			n++
+		}
+	}
+	return n
+}
+
+// share returns n of total as a fraction, 0 of none
+func share(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,175 @@
+// Package compression reads and writes files compressed according to their
+// name: gzip for names ending in .gz, zstd for names ending in .zst, and
+// plain otherwise.
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Format is a compression format
+type Format string
+
+const (
+	None Format = ""
+	Gzip Format = "gzip"
+	Zstd Format = "zstd"
+)
+
+// FormatOf returns the compression format implied by a file name
+func FormatOf(path string) Format {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return Gzip
+	case strings.HasSuffix(path, ".zst"):
+		return Zstd
+	default:
+		return None
+	}
+}
+
+// Open opens a file for reading, decompressing it if its name says so
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(file, FormatOf(path))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return &readCloser{Reader: r, closers: []io.Closer{r, file}}, nil
+}
+
+// NewReader decompresses r in the given format. Closing the result does
+// not close r.
+func NewReader(r io.Reader, format Format) (io.ReadCloser, error) {
+	switch format {
+	case Gzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip data: %w", err)
+		}
+		return zr, nil
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd data: %w", err)
+		}
+		return &readCloser{Reader: zr, closers: []io.Closer{zstdCloser{zr}}}, nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// Create creates or truncates a file for writing, compressing what is
+// written if its name says so. The data is only complete once Close
+// returns without error.
+func Create(path string, perm os.FileMode) (io.WriteCloser, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWriter(file, FormatOf(path))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	return &writeCloser{Writer: w, closers: []io.Closer{w, file}}, nil
+}
+
+// NewWriter compresses what is written to w in the given format. Close
+// flushes the compressor without closing w.
+func NewWriter(w io.Writer, format Format) (io.WriteCloser, error) {
+	switch format {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+// ReadFile is os.ReadFile, decompressing according to the file name
+func ReadFile(path string) ([]byte, error) {
+	r, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// WriteFile is os.WriteFile, compressing according to the file name
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	w, err := Create(path, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// readCloser closes the decompressor and then the file
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	return closeAll(r.closers)
+}
+
+// writeCloser flushes the compressor and then closes the file
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *writeCloser) Close() error {
+	return closeAll(w.closers)
+}
+
+// nopWriteCloser is a writer whose Close does nothing
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// zstdCloser adapts zstd.Decoder, whose Close returns nothing
+type zstdCloser struct {
+	d *zstd.Decoder
+}
+
+func (z zstdCloser) Close() error {
+	z.d.Close()
+	return nil
+}
+
+func closeAll(closers []io.Closer) error {
+	var first error
+	for _, c := range closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
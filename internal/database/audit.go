@@ -0,0 +1,87 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// AuditLog is implemented by the databases that keep an audit log of
+// biometric operations
+type AuditLog interface {
+	// LogAuditEvent records an event, setting its sequence number
+	LogAuditEvent(event *models.AuditEvent) error
+	// AuditEvents returns the events matching a filter, oldest first
+	AuditEvents(filter AuditFilter) ([]models.AuditEvent, error)
+	// PurgeAuditEvents deletes the events that occurred before a time,
+	// returning how many were deleted
+	PurgeAuditEvents(before time.Time) (int64, error)
+}
+
+// AuditFilter selects audit events; zero fields select every event
+type AuditFilter struct {
+	Since     time.Time
+	Until     time.Time
+	UserID    string
+	Operation string
+	Actor     string
+	ProbeID   string
+	// Limit keeps only the most recent events
+	Limit int
+}
+
+// ErrAuditLogUnsupported is returned by databases without an audit log
+var ErrAuditLogUnsupported = errors.New("the audit log needs the sqlite or postgres database")
+
+// LogAuditEvent records an event, setting its sequence number
+func (g *GormDatabase) LogAuditEvent(event *models.AuditEvent) error {
+	if err := g.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to log audit event: %w", err)
+	}
+	return nil
+}
+
+// AuditEvents returns the events matching a filter, oldest first
+func (g *GormDatabase) AuditEvents(filter AuditFilter) ([]models.AuditEvent, error) {
+	query := g.reader.Order("seq DESC")
+	if !filter.Since.IsZero() {
+		query = query.Where("occurred_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("occurred_at < ?", filter.Until)
+	}
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Operation != "" {
+		query = query.Where("operation = ?", filter.Operation)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.ProbeID != "" {
+		query = query.Where("probe_id = ?", filter.ProbeID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var events []models.AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	slices.Reverse(events)
+	return events, nil
+}
+
+// PurgeAuditEvents deletes the events that occurred before a time
+func (g *GormDatabase) PurgeAuditEvents(before time.Time) (int64, error) {
+	result := g.admin.Where("occurred_at < ?", before).Delete(&models.AuditEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge audit log: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
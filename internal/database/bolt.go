@@ -0,0 +1,577 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"face/internal/database/models"
+	"face/internal/encryption"
+	"face/internal/names"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout is how long opening waits for another process holding
+// the database file
+const boltOpenTimeout = 5 * time.Second
+
+var (
+	boltUsersBucket    = []byte("users")
+	boltSettingsBucket = []byte("settings")
+	boltSettingsKey    = []byte("settings")
+)
+
+// BoltDatabase implements the Database interface on a bbolt key-value file.
+// Each user is stored as one JSON record, faces included, keyed by ID.
+// Every change is a transaction that is synced to disk before returning,
+// and no CGO is needed.
+type BoltDatabase struct {
+	db *bolt.DB
+	// key encrypts the embeddings and secrets, nil to store them as they are
+	key *encryption.Key
+}
+
+// NewBoltDatabase opens the bbolt database at path, creating it if needed.
+// The embeddings and secrets of users are encrypted with key, if not nil.
+func NewBoltDatabase(path string, key *encryption.Key) (*BoltDatabase, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	b := &BoltDatabase{db: db, key: key}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltUsersBucket); err != nil {
+			return err
+		}
+		settings, err := tx.CreateBucketIfNotExists(boltSettingsBucket)
+		if err != nil {
+			return err
+		}
+		if settings.Get(boltSettingsKey) == nil {
+			return putJSON(settings, boltSettingsKey, models.DefaultSettings())
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt database: %w", err)
+	}
+
+	return b, nil
+}
+
+// putJSON stores v as JSON under key
+func putJSON(bucket *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+	return bucket.Put(key, data)
+}
+
+// putUser stores a user record, its embeddings and secrets encrypted with
+// the key of the database
+func (b *BoltDatabase) putUser(bucket *bolt.Bucket, user *models.User) error {
+	stored, err := sealUser(b.key, user)
+	if err != nil {
+		return err
+	}
+	return putJSON(bucket, []byte(user.ID), stored)
+}
+
+// decodeUser parses a user record, decrypting its embeddings and secrets
+func (b *BoltDatabase) decodeUser(data []byte) (*models.User, error) {
+	var stored storedUser
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, models.ErrDatabaseCorrupt
+	}
+	user, err := openUser(b.key, &stored)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// loadUser reads a user record, including users pending deletion
+func (b *BoltDatabase) loadUser(tx *bolt.Tx, id string) (*models.User, error) {
+	data := tx.Bucket(boltUsersBucket).Get([]byte(id))
+	if data == nil {
+		return nil, models.ErrUserNotFound
+	}
+	return b.decodeUser(data)
+}
+
+// scanUsers calls fn for every user record until it returns false
+func (b *BoltDatabase) scanUsers(tx *bolt.Tx, fn func(user *models.User) bool) error {
+	c := tx.Bucket(boltUsersBucket).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		user, err := b.decodeUser(v)
+		if err != nil {
+			return err
+		}
+		if !fn(user) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// updateActiveUser loads a user not pending deletion, applies update and
+// stores the result, all in one transaction
+func (b *BoltDatabase) updateActiveUser(id string, update func(user *models.User) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		user, err := b.loadUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt != nil {
+			return models.ErrUserNotFound
+		}
+		if err := update(user); err != nil {
+			return err
+		}
+		return b.putUser(tx.Bucket(boltUsersBucket), user)
+	})
+}
+
+// CreateUser adds a new user to the database
+func (b *BoltDatabase) CreateUser(user *models.User) error {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+
+	user.Name = names.Normalize(user.Name)
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	if len(user.Faces) > 0 {
+		settings, err := b.GetSettings()
+		if err != nil {
+			return err
+		}
+		if err := checkFaceEmbeddings(settings, user.Faces); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+
+	if user.Faces == nil {
+		user.Faces = []models.Face{}
+	}
+	for i := range user.Faces {
+		user.Faces[i].UserID = user.ID
+		if user.Faces[i].EnrolledAt.IsZero() {
+			user.Faces[i].EnrolledAt = now
+		}
+	}
+	if user.Metadata == nil {
+		user.Metadata = make(models.Metadata)
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(boltUsersBucket)
+		if users.Get([]byte(user.ID)) != nil {
+			return models.ErrUserAlreadyExists
+		}
+		return b.putUser(users, user)
+	})
+}
+
+// GetUser retrieves a user by ID
+func (b *BoltDatabase) GetUser(id string) (*models.User, error) {
+	var user *models.User
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		user, err = b.loadUser(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, models.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetUserByName retrieves a user by name, normalized as names are stored
+// (see names.Normalize); case still matters
+func (b *BoltDatabase) GetUserByName(name string) (*models.User, error) {
+	name = names.Normalize(name)
+	var found *models.User
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.scanUsers(tx, func(user *models.User) bool {
+			if user.Name == name && user.DeletedAt == nil {
+				found = user
+				return false
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, models.ErrUserNotFound
+	}
+	return found, nil
+}
+
+// ListUsersByName returns every user with the given name, normalized as
+// names are stored, oldest first
+func (b *BoltDatabase) ListUsersByName(name string) ([]models.User, error) {
+	name = names.Normalize(name)
+	users := []models.User{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.scanUsers(tx, func(user *models.User) bool {
+			if user.Name == name && user.DeletedAt == nil {
+				users = append(users, *user)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+	return users, nil
+}
+
+// UserExistsByName reports whether a user has the given name, normalized as
+// names are stored
+func (b *BoltDatabase) UserExistsByName(name string) (bool, error) {
+	name = names.Normalize(name)
+	exists := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.scanUsers(tx, func(user *models.User) bool {
+			exists = user.Name == name && user.DeletedAt == nil
+			return !exists
+		})
+	})
+	return exists, err
+}
+
+// UpdateUser updates an existing user
+func (b *BoltDatabase) UpdateUser(user *models.User) error {
+	user.Name = names.Normalize(user.Name)
+	if err := user.Validate(); err != nil {
+		return err
+	}
+
+	return b.updateActiveUser(user.ID, func(stored *models.User) error {
+		stored.Name = user.Name
+		stored.Email = user.Email
+		stored.Phone = user.Phone
+		stored.Metadata = user.Metadata
+		stored.CardNumber = user.CardNumber
+		stored.Badge = user.Badge
+		stored.PINHash = user.PINHash
+		stored.TOTPSecret = user.TOTPSecret
+		stored.UpdatedAt = time.Now()
+		user.UpdatedAt = stored.UpdatedAt
+		return nil
+	})
+}
+
+// SetUserAvatar records the stored image of a user's avatar
+func (b *BoltDatabase) SetUserAvatar(userID, filename string) error {
+	return b.updateActiveUser(userID, func(user *models.User) error {
+		user.Avatar = filename
+		return nil
+	})
+}
+
+// DeleteUser permanently removes a user from the database, including a
+// user previously marked with SoftDeleteUser
+func (b *BoltDatabase) DeleteUser(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		users := tx.Bucket(boltUsersBucket)
+		if users.Get([]byte(id)) == nil {
+			return models.ErrUserNotFound
+		}
+		return users.Delete([]byte(id))
+	})
+}
+
+// listUsers returns the users pending deletion or not, ordered by less
+func (b *BoltDatabase) listUsers(deleted bool, less func(a, b *models.User) bool) ([]models.User, error) {
+	users := []models.User{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.scanUsers(tx, func(user *models.User) bool {
+			if (user.DeletedAt != nil) == deleted {
+				users = append(users, *user)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(users, func(i, j int) bool { return less(&users[i], &users[j]) })
+	return users, nil
+}
+
+// ListUsers returns all users in the database, newest first
+func (b *BoltDatabase) ListUsers() ([]models.User, error) {
+	return b.listUsers(false, func(a, b *models.User) bool {
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+}
+
+// SoftDeleteUser marks a user as being deleted
+func (b *BoltDatabase) SoftDeleteUser(id string) error {
+	return b.updateActiveUser(id, func(user *models.User) error {
+		now := time.Now()
+		user.DeletedAt = &now
+		return nil
+	})
+}
+
+// RestoreUser makes a soft-deleted user visible again
+func (b *BoltDatabase) RestoreUser(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		user, err := b.loadUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt == nil {
+			return models.ErrUserNotFound
+		}
+		user.DeletedAt = nil
+		return b.putUser(tx.Bucket(boltUsersBucket), user)
+	})
+}
+
+// ListDeletedUsers returns users whose deletion has not been finalized
+func (b *BoltDatabase) ListDeletedUsers() ([]models.User, error) {
+	return b.listUsers(true, func(a, b *models.User) bool {
+		return a.DeletedAt.Before(*b.DeletedAt)
+	})
+}
+
+// AddFace adds a face to a user, evicting one if the face limit policy
+// says so
+func (b *BoltDatabase) AddFace(userID string, face *models.Face) (*models.Face, error) {
+	if face.ID == "" {
+		face.ID = uuid.New().String()
+	}
+
+	if err := face.Validate(); err != nil {
+		return nil, err
+	}
+
+	settings, err := b.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	if err := settings.CheckEmbedding(face.Embedding); err != nil {
+		return nil, err
+	}
+
+	var evicted *models.Face
+	err = b.updateActiveUser(userID, func(user *models.User) error {
+		if len(user.Faces) >= settings.MaxFacesPerUser {
+			victim, ok := settings.FaceLimitPolicy.Evict(user.Faces)
+			if !ok {
+				return models.ErrMaxFacesReached
+			}
+			evicted = &victim
+			user.Faces = removeFace(user.Faces, victim.ID)
+		}
+
+		face.UserID = userID
+		face.EnrolledAt = time.Now()
+		user.Faces = append(user.Faces, *face)
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
+}
+
+// RemoveFace removes a face from a user
+func (b *BoltDatabase) RemoveFace(userID, faceID string) error {
+	return b.updateActiveUser(userID, func(user *models.User) error {
+		kept := removeFace(user.Faces, faceID)
+		if len(kept) == len(user.Faces) {
+			return fmt.Errorf("face with ID %s not found", faceID)
+		}
+		user.Faces = kept
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// UpdateFaceFilename points a face at a new image file. Faces of users
+// pending deletion are included so their images can still be moved.
+func (b *BoltDatabase) UpdateFaceFilename(userID, faceID, filename string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		user, err := b.loadUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		for i := range user.Faces {
+			if user.Faces[i].ID == faceID {
+				user.Faces[i].Filename = filename
+				return b.putUser(tx.Bucket(boltUsersBucket), user)
+			}
+		}
+		return fmt.Errorf("face with ID %s not found", faceID)
+	})
+}
+
+// SetFaceLabel changes the label of a face
+func (b *BoltDatabase) SetFaceLabel(userID, faceID, label string) error {
+	if len(label) > models.MaxFaceLabelLength {
+		return models.ErrLabelTooLong
+	}
+
+	return b.updateFace(userID, faceID, func(f *models.Face) {
+		if f.ID == faceID {
+			f.Label = label
+		}
+	})
+}
+
+// SetPrimaryFace makes a face the user's primary face
+func (b *BoltDatabase) SetPrimaryFace(userID, faceID string) error {
+	return b.updateFace(userID, faceID, func(f *models.Face) {
+		f.Primary = f.ID == faceID
+	})
+}
+
+// updateFace applies update to every face of a user, provided the user
+// has the face faceID
+func (b *BoltDatabase) updateFace(userID, faceID string, update func(f *models.Face)) error {
+	return b.updateActiveUser(userID, func(user *models.User) error {
+		found := false
+		for i := range user.Faces {
+			found = found || user.Faces[i].ID == faceID
+		}
+		if !found {
+			return fmt.Errorf("face with ID %s not found", faceID)
+		}
+
+		for i := range user.Faces {
+			update(&user.Faces[i])
+		}
+		user.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// GetAllEmbeddings returns a map of userID to faces for matching, leaving
+// out expired visitors
+func (b *BoltDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
+	now := time.Now()
+	embeddings := make(map[string][]models.Face)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.scanUsers(tx, func(user *models.User) bool {
+			if len(user.Faces) > 0 && user.DeletedAt == nil && !user.Expired(now) {
+				embeddings[user.ID] = user.Faces
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+// ReplaceEmbeddings sets the embedding of every face and records the model
+// they were computed with, in one transaction
+func (b *BoltDatabase) ReplaceEmbeddings(embeddings map[string]models.Embedding, model string, dimension int) error {
+	if err := checkReplacement(embeddings, model, dimension); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		var (
+			updated  []*models.User
+			replaced int
+			missing  error
+		)
+		err := b.scanUsers(tx, func(user *models.User) bool {
+			n, err := replaceFaceEmbeddings(user.Faces, embeddings)
+			if err != nil {
+				missing = err
+				return false
+			}
+			replaced += n
+			updated = append(updated, user)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if missing != nil || replaced != len(embeddings) {
+			return ErrGalleryChanged
+		}
+
+		users := tx.Bucket(boltUsersBucket)
+		for _, user := range updated {
+			if err := b.putUser(users, user); err != nil {
+				return err
+			}
+		}
+
+		bucket := tx.Bucket(boltSettingsBucket)
+		settings := models.DefaultSettings()
+		if data := bucket.Get(boltSettingsKey); data != nil {
+			if err := json.Unmarshal(data, settings); err != nil {
+				return models.ErrDatabaseCorrupt
+			}
+		}
+		settings.EmbeddingModel, settings.EmbeddingDimension = model, dimension
+		return putJSON(bucket, boltSettingsKey, settings)
+	})
+}
+
+// GetSettings returns the current settings
+func (b *BoltDatabase) GetSettings() (*models.Settings, error) {
+	var settings models.Settings
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltSettingsBucket).Get(boltSettingsKey)
+		if data == nil {
+			settings = *models.DefaultSettings()
+			return nil
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return models.ErrDatabaseCorrupt
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdateSettings updates the settings
+func (b *BoltDatabase) UpdateSettings(settings *models.Settings) error {
+	settings.ID = 1
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltSettingsBucket), boltSettingsKey, settings)
+	})
+}
+
+// Close closes the database file
+func (b *BoltDatabase) Close() error {
+	return b.db.Close()
+}
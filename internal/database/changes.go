@@ -0,0 +1,41 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"face/internal/database/models"
+)
+
+// ChangeLog is implemented by the databases that record a change log
+type ChangeLog interface {
+	// ChangesSince returns up to limit changes with a sequence number
+	// above seq, oldest first
+	ChangesSince(seq int64, limit int) ([]models.Change, error)
+	// LatestChange returns the sequence number of the latest change, 0 if
+	// nothing has changed yet
+	LatestChange() (int64, error)
+}
+
+// ErrChangeLogUnsupported is returned by databases without a change log
+var ErrChangeLogUnsupported = errors.New("the change log needs the sqlite or postgres database")
+
+// ChangesSince returns up to limit changes with a sequence number above seq
+func (g *GormDatabase) ChangesSince(seq int64, limit int) ([]models.Change, error) {
+	var changes []models.Change
+	result := g.reader.Where("seq > ?", seq).Order("seq").Limit(limit).Find(&changes)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to read changes: %w", result.Error)
+	}
+	return changes, nil
+}
+
+// LatestChange returns the sequence number of the latest change
+func (g *GormDatabase) LatestChange() (int64, error) {
+	var seq int64
+	result := g.reader.Model(&models.Change{}).Select("COALESCE(MAX(seq), 0)").Scan(&seq)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to read changes: %w", result.Error)
+	}
+	return seq, nil
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 
 	"face/internal/database/models"
@@ -8,18 +9,48 @@ import (
 
 // Database defines the interface for all database implementations
 type Database interface {
-	// User operations
+	// User operations. CreateUser sets CreatedAt and UpdatedAt to the
+	// current time unless they are set, as by 'face import'. Names are
+	// stored and looked up normalized, see names.Normalize.
 	CreateUser(user *models.User) error
 	GetUser(id string) (*models.User, error)
 	GetUserByName(name string) (*models.User, error)
+	// ListUsersByName returns every user with the name, oldest first
+	ListUsersByName(name string) ([]models.User, error)
+	// UserExistsByName reports whether a user has the name, for
+	// Settings.DuplicateNamePolicy
+	UserExistsByName(name string) (bool, error)
+	// UpdateUser saves the user's own fields; faces and the avatar are
+	// changed with their dedicated methods
 	UpdateUser(user *models.User) error
+	SetUserAvatar(userID, filename string) error
 	DeleteUser(id string) error
 	ListUsers() ([]models.User, error)
 
-	// Face operations
-	AddFace(userID string, face *models.Face) error
+	// Two-phase deletion: SoftDeleteUser hides a user from all other
+	// operations, DeleteUser finalizes it once the images are gone and
+	// RestoreUser cancels a deletion that has not been finalized
+	SoftDeleteUser(id string) error
+	RestoreUser(id string) error
+	ListDeletedUsers() ([]models.User, error)
+
+	// Face operations. When the user already has the maximum number of
+	// faces, AddFace applies Settings.FaceLimitPolicy and returns the face
+	// it evicted, whose image the caller must delete.
+	AddFace(userID string, face *models.Face) (evicted *models.Face, err error)
 	RemoveFace(userID, faceID string) error
+	UpdateFaceFilename(userID, faceID, filename string) error
+	SetFaceLabel(userID, faceID, label string) error
+	// SetPrimaryFace makes a face the user's primary face, clearing the
+	// flag on their other faces
+	SetPrimaryFace(userID, faceID string) error
 	GetAllEmbeddings() (map[string][]models.Face, error)
+	// ReplaceEmbeddings sets the embedding of every face, users pending
+	// deletion included, from embeddings by face ID and records the model
+	// and dimension they were computed with in the settings, all in one
+	// transaction. It fails with ErrGalleryChanged unless embeddings holds
+	// exactly the faces in the database.
+	ReplaceEmbeddings(embeddings map[string]models.Embedding, model string, dimension int) error
 
 	// Settings operations
 	GetSettings() (*models.Settings, error)
@@ -29,6 +60,49 @@ type Database interface {
 	Close() error
 }
 
+// ErrGalleryChanged is returned by ReplaceEmbeddings when faces were added
+// or removed since the embeddings were computed
+var ErrGalleryChanged = errors.New("faces were added or removed while the embeddings were computed")
+
+// checkFaceEmbeddings checks that the faces have embeddings of the
+// gallery's dimension, see models.Settings.CheckEmbedding
+func checkFaceEmbeddings(settings *models.Settings, faces []models.Face) error {
+	for i := range faces {
+		if err := settings.CheckEmbedding(faces[i].Embedding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReplacement checks that the embeddings given to ReplaceEmbeddings
+// all have the dimension they are recorded with
+func checkReplacement(embeddings map[string]models.Embedding, model string, dimension int) error {
+	if model == "" || dimension <= 0 {
+		return fmt.Errorf("the embedding model and its dimension are required")
+	}
+	for id, embedding := range embeddings {
+		if len(embedding) != dimension {
+			return fmt.Errorf("%w: the embedding of face %s is %d-d, not %d-d", models.ErrDimensionMismatch, id, len(embedding), dimension)
+		}
+	}
+	return nil
+}
+
+// replaceFaceEmbeddings sets the embeddings of the faces, failing with
+// ErrGalleryChanged if one of them has none. It returns how many faces
+// it set.
+func replaceFaceEmbeddings(faces []models.Face, embeddings map[string]models.Embedding) (int, error) {
+	for i := range faces {
+		embedding, ok := embeddings[faces[i].ID]
+		if !ok {
+			return 0, ErrGalleryChanged
+		}
+		faces[i].Embedding = embedding
+	}
+	return len(faces), nil
+}
+
 // DatabaseType represents the type of database backend
 type DatabaseType string
 
@@ -36,17 +110,30 @@ const (
 	DatabaseTypeSQLite   DatabaseType = "sqlite"
 	DatabaseTypePostgres DatabaseType = "postgres"
 	DatabaseTypeJSON     DatabaseType = "json"
+	DatabaseTypeBolt     DatabaseType = "bolt"
 )
 
+// UsesMigrations reports whether the schema of the database type is managed
+// with 'face migrate'
+func (t DatabaseType) UsesMigrations() bool {
+	return t == DatabaseTypeSQLite || t == DatabaseTypePostgres
+}
+
 // NewDatabaseConnection creates a new database instance based on the type
-func NewDatabaseConnection(dbType DatabaseType, connectionString string) (Database, error) {
+func NewDatabaseConnection(dbType DatabaseType, connectionString string, opts Options) (Database, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
 	switch dbType {
 	case DatabaseTypeSQLite:
-		return NewSQLiteDatabase(connectionString)
+		return NewSQLiteDatabase(connectionString, opts)
 	case DatabaseTypePostgres:
-		return NewPostgresDatabase(connectionString)
+		return NewPostgresDatabase(connectionString, opts)
 	case DatabaseTypeJSON:
-		return NewJSONDatabase(connectionString)
+		return newJSONDatabase(connectionString, opts.EncryptionKey)
+	case DatabaseTypeBolt:
+		return NewBoltDatabase(connectionString, opts.EncryptionKey)
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
@@ -61,6 +148,8 @@ func ParseDatabaseType(s string) DatabaseType {
 		return DatabaseTypePostgres
 	case "json":
 		return DatabaseTypeJSON
+	case "bolt", "bbolt":
+		return DatabaseTypeBolt
 	default:
 		return DatabaseTypeSQLite
 	}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"face/internal/database/models"
+	"face/internal/encryption"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// encryptedPrefix starts the stored text of an encrypted embedding or
+// secret, followed by the base64 of its sealed value. Unencrypted
+// embeddings are stored as JSON arrays, secrets as they are.
+const encryptedPrefix = "enc:"
+
+func init() {
+	schema.RegisterSerializer("embedding", embeddingSerializer{})
+	schema.RegisterSerializer("secret", secretSerializer{})
+}
+
+// sealContext returns what a value stored in a column of a record is bound
+// to, so it does not decrypt when copied to another record or column
+func sealContext(model, id, column string) []byte {
+	return []byte(model + "/" + id + "/" + column)
+}
+
+// sealText returns the stored text of an encrypted value
+func sealText(key *encryption.Key, data, bound []byte) (string, error) {
+	sealed, err := key.Seal(data, bound)
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openText returns the value of stored text, decrypting it if it is
+// encrypted. Empty text is returned as it is.
+func openText(key *encryption.Key, text, bound []byte) ([]byte, error) {
+	encoded, ok := bytes.CutPrefix(text, []byte(encryptedPrefix))
+	if !ok {
+		if len(text) == 0 {
+			return text, nil
+		}
+		return key.Open(text, bound)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil || !encryption.Encrypted(sealed) {
+		return nil, errors.New("invalid encrypted value")
+	}
+	return key.Open(sealed, bound)
+}
+
+// sealEmbedding returns the text an embedding is stored as: its JSON,
+// encrypted if key is not nil
+func sealEmbedding(key *encryption.Key, embedding models.Embedding, bound []byte) (string, error) {
+	if embedding == nil {
+		embedding = models.Embedding{}
+	}
+	data, err := json.Marshal(embedding)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+	if key == nil {
+		return string(data), nil
+	}
+
+	text, err := sealText(key, data, bound)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt embedding: %w", err)
+	}
+	return text, nil
+}
+
+// openEmbedding parses the stored text of an embedding, decrypting it if
+// it is encrypted
+func openEmbedding(key *encryption.Key, text, bound []byte) (models.Embedding, error) {
+	text, err := openText(key, text, bound)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt embedding: %w", err)
+	}
+
+	embedding := models.Embedding{}
+	if len(text) == 0 {
+		return embedding, nil
+	}
+	if err := json.Unmarshal(text, &embedding); err != nil {
+		return nil, fmt.Errorf("invalid embedding: %w", err)
+	}
+	return embedding, nil
+}
+
+// sealSecret returns the text a second factor secret is stored as,
+// encrypted if key is not nil. An empty secret stays empty, so it still
+// reads as not set up.
+func sealSecret(key *encryption.Key, secret string, bound []byte) (string, error) {
+	if key == nil || secret == "" {
+		return secret, nil
+	}
+	text, err := sealText(key, []byte(secret), bound)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+	return text, nil
+}
+
+// openSecret returns the secret of its stored text, decrypting it if it is
+// encrypted
+func openSecret(key *encryption.Key, text string, bound []byte) (string, error) {
+	secret, err := openText(key, []byte(text), bound)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(secret), nil
+}
+
+// encryptionKeyContext is the context key of the encryption key of the
+// embedding serializer
+type encryptionKeyContext struct{}
+
+// withEncryptionKey makes the operations of db encrypt the embeddings they
+// write and decrypt those they read with key
+func withEncryptionKey(db *gorm.DB, key *encryption.Key) *gorm.DB {
+	if key == nil {
+		return db
+	}
+	return db.WithContext(context.WithValue(context.Background(), encryptionKeyContext{}, key))
+}
+
+// rowContext returns what the value of field in the row dst is bound to,
+// the row's primary key and the field's column
+func rowContext(ctx context.Context, field *schema.Field, dst reflect.Value) ([]byte, error) {
+	primary := field.Schema.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, fmt.Errorf("%s has no primary key to encrypt %s with", field.Schema.Name, field.DBName)
+	}
+	id, _ := primary.ValueOf(ctx, dst)
+	if s, ok := id.(string); ok && s != "" {
+		return sealContext(field.Schema.Name, s, field.DBName), nil
+	}
+	return nil, fmt.Errorf("cannot encrypt or decrypt %s of a %s without its %s", field.DBName, field.Schema.Name, primary.DBName)
+}
+
+// serializerKey returns the encryption key of the statement's context and
+// what the field's value in dst is bound to, nil if there is no key
+func serializerKey(ctx context.Context, field *schema.Field, dst reflect.Value) (*encryption.Key, []byte, error) {
+	key, _ := ctx.Value(encryptionKeyContext{}).(*encryption.Key)
+	if key == nil {
+		return nil, nil, nil
+	}
+	bound, err := rowContext(ctx, field, dst)
+	return key, bound, err
+}
+
+// scannedText returns the text of a column value
+func scannedText(dbValue interface{}, name string) ([]byte, error) {
+	switch v := dbValue.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("invalid type for %s", name)
+	}
+}
+
+// embeddingSerializer stores Face.Embedding in SQL with the encryption key
+// of the statement's context, if any, bound to the row's ID
+type embeddingSerializer struct{}
+
+func (embeddingSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	text, err := scannedText(dbValue, "Embedding")
+	if err != nil {
+		return err
+	}
+	key, bound, err := serializerKey(ctx, field, dst)
+	if err != nil {
+		return err
+	}
+	embedding, err := openEmbedding(key, text, bound)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).Set(reflect.ValueOf(embedding))
+	return nil
+}
+
+func (embeddingSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	embedding, _ := fieldValue.(models.Embedding)
+	key, bound, err := serializerKey(ctx, field, dst)
+	if err != nil {
+		return nil, err
+	}
+	return sealEmbedding(key, embedding, bound)
+}
+
+// secretSerializer stores User.PINHash and User.TOTPSecret in SQL like
+// embeddingSerializer
+type secretSerializer struct{}
+
+func (secretSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	text, err := scannedText(dbValue, field.Name)
+	if err != nil {
+		return err
+	}
+	key, bound, err := serializerKey(ctx, field, dst)
+	if err != nil {
+		return err
+	}
+	secret, err := openSecret(key, string(text), bound)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(secret)
+	return nil
+}
+
+func (secretSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	secret, _ := fieldValue.(string)
+	key, bound, err := serializerKey(ctx, field, dst)
+	if err != nil {
+		return nil, err
+	}
+	return sealSecret(key, secret, bound)
+}
+
+// sealedSecrets returns the stored text of the second factor secrets of a
+// user, for updates that bypass the serializer
+func sealedSecrets(db *gorm.DB, user *models.User) (pinHash, totpSecret string, err error) {
+	key, _ := db.Statement.Context.Value(encryptionKeyContext{}).(*encryption.Key)
+	if pinHash, err = sealSecret(key, user.PINHash, sealContext("User", user.ID, "pin_hash")); err != nil {
+		return "", "", err
+	}
+	if totpSecret, err = sealSecret(key, user.TOTPSecret, sealContext("User", user.ID, "totp_secret")); err != nil {
+		return "", "", err
+	}
+	return pinHash, totpSecret, nil
+}
+
+// storedUser is a user as the JSON and bolt databases store it, with
+// embeddings and secrets stored like the SQL columns
+type storedUser struct {
+	models.User
+	Faces []storedFace `json:"faces"`
+}
+
+// storedFace is a face with its embedding as stored: a JSON array, or a
+// string if it is encrypted
+type storedFace struct {
+	models.Face
+	Embedding json.RawMessage `json:"embedding"`
+}
+
+// sealUser returns a user as stored, its embeddings and secrets encrypted
+// if key is not nil
+func sealUser(key *encryption.Key, user *models.User) (*storedUser, error) {
+	stored := &storedUser{User: *user}
+	stored.User.Faces = nil
+	var err error
+	if stored.PINHash, err = sealSecret(key, user.PINHash, sealContext("User", user.ID, "pin_hash")); err != nil {
+		return nil, err
+	}
+	if stored.TOTPSecret, err = sealSecret(key, user.TOTPSecret, sealContext("User", user.ID, "totp_secret")); err != nil {
+		return nil, err
+	}
+	if user.Faces != nil {
+		stored.Faces = make([]storedFace, len(user.Faces))
+	}
+	for i, face := range user.Faces {
+		text, err := sealEmbedding(key, face.Embedding, sealContext("Face", face.ID, "embedding"))
+		if err != nil {
+			return nil, err
+		}
+		embedding := json.RawMessage(text)
+		if key != nil {
+			if embedding, err = json.Marshal(text); err != nil {
+				return nil, err
+			}
+		}
+		stored.Faces[i] = storedFace{Face: face, Embedding: embedding}
+	}
+	return stored, nil
+}
+
+// openUser returns a stored user with its embeddings and secrets decrypted
+func openUser(key *encryption.Key, stored *storedUser) (models.User, error) {
+	user := stored.User
+	var err error
+	if user.PINHash, err = openSecret(key, stored.PINHash, sealContext("User", user.ID, "pin_hash")); err != nil {
+		return models.User{}, err
+	}
+	if user.TOTPSecret, err = openSecret(key, stored.TOTPSecret, sealContext("User", user.ID, "totp_secret")); err != nil {
+		return models.User{}, err
+	}
+	if stored.Faces != nil {
+		user.Faces = make([]models.Face, len(stored.Faces))
+	}
+	for i, face := range stored.Faces {
+		text := []byte(face.Embedding)
+		var encrypted string
+		if json.Unmarshal(face.Embedding, &encrypted) == nil {
+			text = []byte(encrypted)
+		}
+		embedding, err := openEmbedding(key, text, sealContext("Face", face.ID, "embedding"))
+		if err != nil {
+			return models.User{}, err
+		}
+		user.Faces[i] = face.Face
+		user.Faces[i].Embedding = embedding
+	}
+	return user, nil
+}
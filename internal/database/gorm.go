@@ -8,12 +8,14 @@ import (
 	"time"
 
 	"face/internal/database/models"
+	"face/internal/names"
 
 	"github.com/google/uuid"
-	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
+	_ "modernc.org/sqlite" // pure-Go driver for Options.SQLiteDriver
 )
 
 //go:embed migrations/*.sql
@@ -21,14 +23,24 @@ var migrationsFS embed.FS
 
 // GormDatabase implements Database interface using GORM
 type GormDatabase struct {
-	db     *gorm.DB
+	db *gorm.DB
+	// reader and admin run read-only and administrative operations. They
+	// are db itself unless Options.Roles gives each its own role.
+	reader *gorm.DB
+	admin  *gorm.DB
 	dbType DatabaseType
+	// vectors is set when Options.PGVector pushes similarity search into
+	// SQL
+	vectors bool
 }
 
 // NewSQLiteDatabase creates a new SQLite database instance using GORM
-func NewSQLiteDatabase(filePath string) (*GormDatabase, error) {
-	db, err := gorm.Open(sqlite.Open(filePath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+func NewSQLiteDatabase(filePath string, opts Options) (*GormDatabase, error) {
+	opts = opts.forType(DatabaseTypeSQLite)
+	dialector := sqlite.New(sqlite.Config{DriverName: opts.sqliteDriverName(), DSN: filePath})
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		NamingStrategy: opts.namingStrategy(),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
@@ -36,8 +48,9 @@ func NewSQLiteDatabase(filePath string) (*GormDatabase, error) {
 
 	// Enable foreign keys for SQLite
 	db.Exec("PRAGMA foreign_keys = ON")
+	db = withEncryptionKey(db, opts.EncryptionKey)
 
-	gdb := &GormDatabase{db: db, dbType: DatabaseTypeSQLite}
+	gdb := &GormDatabase{db: db, reader: db, admin: db, dbType: DatabaseTypeSQLite}
 
 	// Ensure default settings exist
 	if err := gdb.ensureDefaultSettings(); err != nil {
@@ -47,16 +60,42 @@ func NewSQLiteDatabase(filePath string) (*GormDatabase, error) {
 	return gdb, nil
 }
 
-// NewPostgresDatabase creates a new PostgreSQL database instance using GORM
-func NewPostgresDatabase(dsn string) (*GormDatabase, error) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to open postgres database: %w", err)
+// NewPostgresDatabase creates a new PostgreSQL database instance using GORM.
+// With Options.Roles, reads, writes and administrative operations each use
+// their own connection pool running as the matching least-privilege role.
+func NewPostgresDatabase(dsn string, opts Options) (*GormDatabase, error) {
+	opts = opts.forType(DatabaseTypePostgres)
+	if opts.Tenant != "" && !opts.Roles {
+		return nil, ErrTenantWithoutRoles
+	}
+
+	gdb := &GormDatabase{dbType: DatabaseTypePostgres, vectors: opts.PGVector}
+	if opts.Roles {
+		for _, pool := range []struct {
+			db   **gorm.DB
+			role string
+		}{{&gdb.db, RoleWriter}, {&gdb.reader, RoleReader}, {&gdb.admin, RoleAdmin}} {
+			db, err := openPostgres(dsn, opts, pool.role)
+			if err != nil {
+				gdb.Close()
+				return nil, err
+			}
+			*pool.db = db
+		}
+	} else {
+		db, err := openPostgres(dsn, opts, "")
+		if err != nil {
+			return nil, err
+		}
+		gdb.db, gdb.reader, gdb.admin = db, db, db
 	}
 
-	gdb := &GormDatabase{db: db, dbType: DatabaseTypePostgres}
+	if gdb.vectors {
+		if err := gdb.checkVectorColumn(); err != nil {
+			gdb.Close()
+			return nil, err
+		}
+	}
 
 	// Ensure default settings exist
 	if err := gdb.ensureDefaultSettings(); err != nil {
@@ -69,9 +108,9 @@ func NewPostgresDatabase(dsn string) (*GormDatabase, error) {
 // ensureDefaultSettings creates default settings if not exists
 func (g *GormDatabase) ensureDefaultSettings() error {
 	var count int64
-	g.db.Model(&models.Settings{}).Count(&count)
+	g.admin.Model(&models.Settings{}).Count(&count)
 	if count == 0 {
-		return g.db.Create(models.DefaultSettings()).Error
+		return g.admin.Create(models.DefaultSettings()).Error
 	}
 	return nil
 }
@@ -82,17 +121,36 @@ func (g *GormDatabase) CreateUser(user *models.User) error {
 		user.ID = uuid.New().String()
 	}
 
+	user.Name = names.Normalize(user.Name)
 	if err := user.Validate(); err != nil {
 		return err
 	}
+	if len(user.Faces) > 0 {
+		settings, err := g.GetSettings()
+		if err != nil {
+			return err
+		}
+		if err := checkFaceEmbeddings(settings, user.Faces); err != nil {
+			return err
+		}
+	}
 
 	now := time.Now()
-	user.CreatedAt = now
-	user.UpdatedAt = now
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
 
 	if user.Faces == nil {
 		user.Faces = []models.Face{}
 	}
+	for i := range user.Faces {
+		if user.Faces[i].EnrolledAt.IsZero() {
+			user.Faces[i].EnrolledAt = now
+		}
+	}
 	if user.Metadata == nil {
 		user.Metadata = make(models.Metadata)
 	}
@@ -112,7 +170,7 @@ func (g *GormDatabase) CreateUser(user *models.User) error {
 // GetUser retrieves a user by ID
 func (g *GormDatabase) GetUser(id string) (*models.User, error) {
 	var user models.User
-	result := g.db.Preload("Faces").First(&user, "id = ?", id)
+	result := g.reader.Preload("Faces").Where("deleted_at IS NULL").First(&user, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, models.ErrUserNotFound
@@ -124,8 +182,9 @@ func (g *GormDatabase) GetUser(id string) (*models.User, error) {
 
 // GetUserByName retrieves a user by name
 func (g *GormDatabase) GetUserByName(name string) (*models.User, error) {
+	name = names.Normalize(name)
 	var user models.User
-	result := g.db.Preload("Faces").First(&user, "name = ?", name)
+	result := g.reader.Preload("Faces").Where("deleted_at IS NULL").First(&user, "name = ?", name)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, models.ErrUserNotFound
@@ -135,20 +194,62 @@ func (g *GormDatabase) GetUserByName(name string) (*models.User, error) {
 	return &user, nil
 }
 
+// ListUsersByName returns every user with the given name, oldest first
+func (g *GormDatabase) ListUsersByName(name string) ([]models.User, error) {
+	name = names.Normalize(name)
+	var users []models.User
+	result := g.reader.Preload("Faces").Where("deleted_at IS NULL AND name = ?", name).Order("created_at").Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list users by name: %w", result.Error)
+	}
+
+	if users == nil {
+		users = []models.User{}
+	}
+
+	return users, nil
+}
+
+// UserExistsByName reports whether a user has the given name
+func (g *GormDatabase) UserExistsByName(name string) (bool, error) {
+	name = names.Normalize(name)
+	var count int64
+	result := g.reader.Model(&models.User{}).Where("deleted_at IS NULL AND name = ?", name).Count(&count)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to look up user by name: %w", result.Error)
+	}
+	return count > 0, nil
+}
+
 // UpdateUser updates an existing user
 func (g *GormDatabase) UpdateUser(user *models.User) error {
+	user.Name = names.Normalize(user.Name)
 	if err := user.Validate(); err != nil {
 		return err
 	}
 
 	user.UpdatedAt = time.Now()
 
-	result := g.db.Model(user).Updates(map[string]interface{}{
-		"name":       user.Name,
-		"email":      user.Email,
-		"phone":      user.Phone,
-		"metadata":   user.Metadata,
-		"updated_at": user.UpdatedAt,
+	// Updates with a map bypass the serializer of the secrets, and would
+	// set the sealed text on the model, so they are sealed here and the
+	// model is a copy
+	pinHash, totpSecret, err := sealedSecrets(g.db, user)
+	if err != nil {
+		return err
+	}
+
+	// Faces are changed with their own methods; without Omit GORM would
+	// write back the loaded faces as well
+	result := g.db.Model(&models.User{ID: user.ID}).Omit(clause.Associations).Where("deleted_at IS NULL").Updates(map[string]interface{}{
+		"name":        user.Name,
+		"email":       user.Email,
+		"phone":       user.Phone,
+		"metadata":    user.Metadata,
+		"card_number": user.CardNumber,
+		"badge":       user.Badge,
+		"pin_hash":    pinHash,
+		"totp_secret": totpSecret,
+		"updated_at":  user.UpdatedAt,
 	})
 
 	if result.Error != nil {
@@ -162,7 +263,8 @@ func (g *GormDatabase) UpdateUser(user *models.User) error {
 	return nil
 }
 
-// DeleteUser removes a user from the database
+// DeleteUser permanently removes a user from the database, including a
+// user previously marked with SoftDeleteUser
 func (g *GormDatabase) DeleteUser(id string) error {
 	result := g.db.Delete(&models.User{}, "id = ?", id)
 	if result.Error != nil {
@@ -179,7 +281,7 @@ func (g *GormDatabase) DeleteUser(id string) error {
 // ListUsers returns all users in the database
 func (g *GormDatabase) ListUsers() ([]models.User, error) {
 	var users []models.User
-	result := g.db.Preload("Faces").Order("created_at DESC").Find(&users)
+	result := g.reader.Preload("Faces").Where("deleted_at IS NULL").Order("created_at DESC").Find(&users)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to list users: %w", result.Error)
 	}
@@ -191,27 +293,69 @@ func (g *GormDatabase) ListUsers() ([]models.User, error) {
 	return users, nil
 }
 
-// AddFace adds a face to a user
-func (g *GormDatabase) AddFace(userID string, face *models.Face) error {
+// SoftDeleteUser marks a user as being deleted
+func (g *GormDatabase) SoftDeleteUser(id string) error {
+	result := g.db.Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NULL", id).
+		Update("deleted_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark user deleted: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RestoreUser makes a soft-deleted user visible again
+func (g *GormDatabase) RestoreUser(id string) error {
+	result := g.db.Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore user: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ListDeletedUsers returns users whose deletion has not been finalized
+func (g *GormDatabase) ListDeletedUsers() ([]models.User, error) {
+	var users []models.User
+	result := g.reader.Preload("Faces").Where("deleted_at IS NOT NULL").Order("deleted_at").Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list deleted users: %w", result.Error)
+	}
+
+	if users == nil {
+		users = []models.User{}
+	}
+
+	return users, nil
+}
+
+// AddFace adds a face to a user, evicting one if the face limit policy
+// says so
+func (g *GormDatabase) AddFace(userID string, face *models.Face) (*models.Face, error) {
 	// Check if user exists
 	var user models.User
-	if err := g.db.First(&user, "id = ?", userID).Error; err != nil {
+	if err := g.db.Where("deleted_at IS NULL").First(&user, "id = ?", userID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return models.ErrUserNotFound
+			return nil, models.ErrUserNotFound
 		}
-		return fmt.Errorf("failed to find user: %w", err)
+		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
 
 	// Check max faces
 	settings, err := g.GetSettings()
 	if err != nil {
-		return err
-	}
-
-	var faceCount int64
-	g.db.Model(&models.Face{}).Where("user_id = ?", userID).Count(&faceCount)
-	if int(faceCount) >= settings.MaxFacesPerUser {
-		return models.ErrMaxFacesReached
+		return nil, err
 	}
 
 	if face.ID == "" {
@@ -219,20 +363,46 @@ func (g *GormDatabase) AddFace(userID string, face *models.Face) error {
 	}
 
 	if err := face.Validate(); err != nil {
-		return err
+		return nil, err
+	}
+	if err := settings.CheckEmbedding(face.Embedding); err != nil {
+		return nil, err
 	}
 
 	face.UserID = userID
 	face.EnrolledAt = time.Now()
 
-	if err := g.db.Create(face).Error; err != nil {
-		return fmt.Errorf("failed to add face: %w", err)
+	var evicted *models.Face
+	err = g.db.Transaction(func(tx *gorm.DB) error {
+		var faces []models.Face
+		if err := tx.Where("user_id = ?", userID).Find(&faces).Error; err != nil {
+			return fmt.Errorf("failed to load faces: %w", err)
+		}
+
+		if len(faces) >= settings.MaxFacesPerUser {
+			victim, ok := settings.FaceLimitPolicy.Evict(faces)
+			if !ok {
+				return models.ErrMaxFacesReached
+			}
+			if err := tx.Delete(&models.Face{}, "id = ? AND user_id = ?", victim.ID, userID).Error; err != nil {
+				return fmt.Errorf("failed to evict face: %w", err)
+			}
+			evicted = &victim
+		}
+
+		if err := tx.Create(face).Error; err != nil {
+			return fmt.Errorf("failed to add face: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Update user's updated_at
 	g.db.Model(&models.User{}).Where("id = ?", userID).Update("updated_at", time.Now())
 
-	return nil
+	return evicted, nil
 }
 
 // RemoveFace removes a face from a user
@@ -252,10 +422,78 @@ func (g *GormDatabase) RemoveFace(userID, faceID string) error {
 	return nil
 }
 
-// GetAllEmbeddings returns a map of userID to faces for matching
+// UpdateFaceFilename points a face at a new image file. Faces of users
+// pending deletion are included so their images can still be moved.
+func (g *GormDatabase) UpdateFaceFilename(userID, faceID, filename string) error {
+	result := g.db.Model(&models.Face{}).Where("id = ? AND user_id = ?", faceID, userID).Update("filename", filename)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update face: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("face with ID %s not found", faceID)
+	}
+
+	return nil
+}
+
+// SetUserAvatar records the stored image of a user's avatar
+func (g *GormDatabase) SetUserAvatar(userID, filename string) error {
+	result := g.db.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).Update("avatar", filename)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetFaceLabel changes the label of a face
+func (g *GormDatabase) SetFaceLabel(userID, faceID, label string) error {
+	if len(label) > models.MaxFaceLabelLength {
+		return models.ErrLabelTooLong
+	}
+
+	result := g.db.Model(&models.Face{}).Where("id = ? AND user_id = ?", faceID, userID).Update("label", label)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update face: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("face with ID %s not found", faceID)
+	}
+
+	return nil
+}
+
+// SetPrimaryFace makes a face the user's primary face
+func (g *GormDatabase) SetPrimaryFace(userID, faceID string) error {
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Face{}).Where("id = ? AND user_id = ?", faceID, userID).Update("is_primary", true)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update face: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("face with ID %s not found", faceID)
+		}
+
+		if err := tx.Model(&models.Face{}).Where("user_id = ? AND id <> ?", userID, faceID).Update("is_primary", false).Error; err != nil {
+			return fmt.Errorf("failed to update faces: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetAllEmbeddings returns a map of userID to faces for matching, leaving
+// out expired visitors
 func (g *GormDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
 	var faces []models.Face
-	result := g.db.Find(&faces)
+	activeUsers := g.reader.Model(&models.User{}).Select("id").
+		Where("deleted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+	result := g.reader.Where("user_id IN (?)", activeUsers).Find(&faces)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get embeddings: %w", result.Error)
 	}
@@ -268,15 +506,53 @@ func (g *GormDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
 	return embeddings, nil
 }
 
+// ReplaceEmbeddings sets the embedding of every face and records the model
+// they were computed with, in one transaction
+func (g *GormDatabase) ReplaceEmbeddings(embeddings map[string]models.Embedding, model string, dimension int) error {
+	if err := checkReplacement(embeddings, model, dimension); err != nil {
+		return err
+	}
+
+	return g.admin.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Face{}).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count faces: %w", err)
+		}
+		if count != int64(len(embeddings)) {
+			return ErrGalleryChanged
+		}
+
+		for id, embedding := range embeddings {
+			result := tx.Model(&models.Face{ID: id}).Select("embedding").Updates(&models.Face{ID: id, Embedding: embedding})
+			if result.Error != nil {
+				return fmt.Errorf("failed to update face: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				return ErrGalleryChanged
+			}
+		}
+
+		var settings models.Settings
+		if err := tx.First(&settings, "id = ?", 1).Error; err != nil {
+			return fmt.Errorf("failed to get settings: %w", err)
+		}
+		settings.EmbeddingModel, settings.EmbeddingDimension = model, dimension
+		if err := tx.Save(&settings).Error; err != nil {
+			return fmt.Errorf("failed to update settings: %w", err)
+		}
+		return nil
+	})
+}
+
 // GetSettings returns the current settings
 func (g *GormDatabase) GetSettings() (*models.Settings, error) {
 	var settings models.Settings
-	result := g.db.First(&settings, "id = ?", 1)
+	result := g.reader.First(&settings, "id = ?", 1)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			// Create default settings
 			settings = *models.DefaultSettings()
-			if err := g.db.Create(&settings).Error; err != nil {
+			if err := g.admin.Create(&settings).Error; err != nil {
 				return nil, fmt.Errorf("failed to create default settings: %w", err)
 			}
 			return &settings, nil
@@ -289,20 +565,29 @@ func (g *GormDatabase) GetSettings() (*models.Settings, error) {
 // UpdateSettings updates the database settings
 func (g *GormDatabase) UpdateSettings(settings *models.Settings) error {
 	settings.ID = 1
-	result := g.db.Save(settings)
+	result := g.admin.Save(settings)
 	if result.Error != nil {
 		return fmt.Errorf("failed to update settings: %w", result.Error)
 	}
 	return nil
 }
 
-// Close closes the database connection
+// Close closes the database connections
 func (g *GormDatabase) Close() error {
-	sqlDB, err := g.db.DB()
-	if err != nil {
-		return err
+	var firstErr error
+	for i, db := range []*gorm.DB{g.db, g.reader, g.admin} {
+		if db == nil || (i > 0 && db == g.db) {
+			continue
+		}
+		sqlDB, err := db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
-	return sqlDB.Close()
+	return firstErr
 }
 
 // GetDB returns the underlying GORM database (for advanced usage)
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"face/internal/database/models"
+)
+
+// IdentificationLog is implemented by the databases that record the
+// identifications of 'face watch'. The built-in "identifications" query
+// reports them.
+type IdentificationLog interface {
+	LogIdentification(identification *models.Identification) error
+}
+
+// ErrIdentificationLogUnsupported is returned by databases that cannot
+// record identifications
+var ErrIdentificationLogUnsupported = errors.New("logging identifications needs the sqlite or postgres database")
+
+// LogIdentification records an identification, setting its sequence number
+func (g *GormDatabase) LogIdentification(identification *models.Identification) error {
+	if err := g.db.Create(identification).Error; err != nil {
+		return fmt.Errorf("failed to log identification: %w", err)
+	}
+	return nil
+}
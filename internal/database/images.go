@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"face/internal/database/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImageStore is implemented by the databases that can store face images
+// themselves, for the database storage backend
+type ImageStore interface {
+	// PutImageData stores the data of an image, replacing any stored under
+	// the filename
+	PutImageData(filename string, data []byte) error
+	// ImageData returns the data of an image, or ErrImageNotFound
+	ImageData(filename string) ([]byte, error)
+	// DeleteImageData removes an image; removing a missing image is not an
+	// error
+	DeleteImageData(filename string) error
+	HasImageData(filename string) (bool, error)
+}
+
+// ErrImageStoreUnsupported is returned by databases that cannot store
+// images
+var ErrImageStoreUnsupported = errors.New("storing images in the database needs the sqlite or postgres database")
+
+// ErrImageNotFound is returned when no image is stored under a filename
+var ErrImageNotFound = errors.New("image not found in the database")
+
+// PutImageData stores the data of an image
+func (g *GormDatabase) PutImageData(filename string, data []byte) error {
+	image := models.FaceImage{Filename: filename, Data: data, CreatedAt: time.Now()}
+	result := g.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&image)
+	if result.Error != nil {
+		return fmt.Errorf("failed to store image: %w", result.Error)
+	}
+	return nil
+}
+
+// ImageData returns the data of an image
+func (g *GormDatabase) ImageData(filename string) ([]byte, error) {
+	var image models.FaceImage
+	result := g.reader.First(&image, "filename = ?", filename)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrImageNotFound, filename)
+		}
+		return nil, fmt.Errorf("failed to load image: %w", result.Error)
+	}
+	return image.Data, nil
+}
+
+// DeleteImageData removes an image
+func (g *GormDatabase) DeleteImageData(filename string) error {
+	result := g.db.Delete(&models.FaceImage{}, "filename = ?", filename)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete image: %w", result.Error)
+	}
+	return nil
+}
+
+// HasImageData reports whether an image is stored under the filename
+func (g *GormDatabase) HasImageData(filename string) (bool, error) {
+	var count int64
+	result := g.reader.Model(&models.FaceImage{}).Where("filename = ?", filename).Count(&count)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to look up image: %w", result.Error)
+	}
+	return count > 0, nil
+}
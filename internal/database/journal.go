@@ -0,0 +1,170 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"face/internal/database/models"
+	"face/internal/encryption"
+)
+
+// journalCompactMin is the number of journal records below which the JSON
+// database is never compacted. Above it, the database is compacted once
+// the journal has more records than there are users.
+const journalCompactMin = 1000
+
+// journalRecord is one line of the JSON database journal. Exactly one
+// field is set, and it holds the complete new state, so replaying a
+// record twice does no harm.
+type journalRecord struct {
+	User        *storedUser      `json:"user,omitempty"`
+	DeletedUser string           `json:"deleted_user,omitempty"`
+	Settings    *models.Settings `json:"settings,omitempty"`
+}
+
+// journalPath returns the path of the journal kept next to a JSON database
+func journalPath(filePath string) string {
+	return filePath + ".journal"
+}
+
+// apply applies a journal record to the data, decrypting the embeddings
+// of a user with key
+func (r *journalRecord) apply(jd *jsonData, key *encryption.Key) error {
+	switch {
+	case r.User != nil:
+		user, err := openUser(key, r.User)
+		if err != nil {
+			return err
+		}
+		for i := range jd.Users {
+			if jd.Users[i].ID == user.ID {
+				jd.Users[i] = user
+				return nil
+			}
+		}
+		jd.Users = append(jd.Users, user)
+	case r.DeletedUser != "":
+		for i := range jd.Users {
+			if jd.Users[i].ID == r.DeletedUser {
+				jd.Users = append(jd.Users[:i], jd.Users[i+1:]...)
+				return nil
+			}
+		}
+	case r.Settings != nil:
+		jd.Settings = *r.Settings
+	}
+	return nil
+}
+
+// replayJournal applies the journal, if any, to the data and returns the
+// number of records applied. A torn last line, left by a crash while
+// appending, is cut off so later records start on a line of their own.
+func replayJournal(path string, jd *jsonData, key *encryption.Key) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	records := 0
+	for offset := 0; offset < len(data); {
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			if err := os.Truncate(path, int64(offset)); err != nil {
+				return 0, fmt.Errorf("failed to repair journal: %w", err)
+			}
+			break
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(data[offset:offset+end], &rec); err != nil {
+			return 0, models.ErrDatabaseCorrupt
+		}
+		if err := rec.apply(jd, key); err != nil {
+			return 0, err
+		}
+		records++
+		offset += end + 1
+	}
+	return records, nil
+}
+
+// commitUser records the current state of the user at index i
+func (j *JSONDatabase) commitUser(i int) error {
+	user, err := sealUser(j.key, &j.data.Users[i])
+	if err != nil {
+		return err
+	}
+	return j.commit(&journalRecord{User: user})
+}
+
+// commitDeletedUser records the removal of a user
+func (j *JSONDatabase) commitDeletedUser(id string) error {
+	return j.commit(&journalRecord{DeletedUser: id})
+}
+
+// commitSettings records the current settings
+func (j *JSONDatabase) commitSettings() error {
+	settings := j.data.Settings
+	return j.commit(&journalRecord{Settings: &settings})
+}
+
+// commit appends a record to the journal, compacting the database into a
+// new file instead once the journal has grown large (must be called with
+// lock held)
+func (j *JSONDatabase) commit(rec *journalRecord) error {
+	if j.journalRecords >= journalCompactMin && j.journalRecords >= len(j.data.Users) {
+		return j.saveInternal()
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+
+	if j.journal == nil {
+		file, err := os.OpenFile(journalPath(j.filePath), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open journal: %w", err)
+		}
+		j.journal = file
+	}
+
+	if _, err := j.journal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	// A change is committed once its record is on disk, not in the page
+	// cache, where a power loss would take it
+	if err := j.journal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	j.journalRecords++
+	return nil
+}
+
+// dropJournal removes the journal after its records were written to the
+// database file (must be called with lock held)
+func (j *JSONDatabase) dropJournal() error {
+	if err := j.closeJournal(); err != nil {
+		return err
+	}
+	if err := os.Remove(journalPath(j.filePath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	j.journalRecords = 0
+	return nil
+}
+
+// closeJournal closes the journal file if it is open
+func (j *JSONDatabase) closeJournal() error {
+	if j.journal == nil {
+		return nil
+	}
+	err := j.journal.Close()
+	j.journal = nil
+	return err
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"face/internal/database/models"
+	"face/internal/encryption"
+
+	"github.com/google/uuid"
+)
+
+// TestJournalReplay checks that changes appended to the journal are
+// replayed when the database is opened again, without rewriting its file
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "face.json")
+	db, err := NewJSONDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &models.User{ID: uuid.NewString(), Name: "Alice"}
+	bob := &models.User{ID: uuid.NewString(), Name: "Bob"}
+	for _, u := range []*models.User{alice, bob} {
+		if err := db.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice.Name = "Alicia"
+	if err := db.UpdateUser(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteUser(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if now, err := os.ReadFile(path); err != nil || string(now) != string(file) {
+		t.Fatalf("database file was rewritten (%v)", err)
+	}
+	if records := testJournalLines(t, path); records != 4 {
+		t.Fatalf("journal has %d records, want 4", records)
+	}
+
+	db, err = NewJSONDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := testUserNames(t, db); !slices.Equal(got, []string{"Alicia"}) {
+		t.Errorf("users after replay: %v, want [Alicia]", got)
+	}
+}
+
+// TestJournalTornRecord checks that a record cut off by a crash while it
+// was appended is dropped, and later records are replayed
+func TestJournalTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "face.json")
+	db, err := NewJSONDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateUser(&models.User{ID: uuid.NewString(), Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	journal, err := os.OpenFile(journalPath(path), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.WriteString(`{"user":{"id":"torn","na`)
+	journal.Close()
+
+	db, err = NewJSONDatabase(path)
+	if err != nil {
+		t.Fatalf("open with a torn record: %v", err)
+	}
+	if err := db.CreateUser(&models.User{ID: uuid.NewString(), Name: "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = NewJSONDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := testUserNames(t, db); !slices.Equal(got, []string{"Alice", "Bob"}) {
+		t.Errorf("users after replay: %v, want [Alice Bob]", got)
+	}
+}
+
+// TestJournalCorrupt checks that a complete record that is not valid
+// refuses to open the database instead of losing changes silently
+func TestJournalCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "face.json")
+	db, err := NewJSONDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if err := os.WriteFile(journalPath(path), []byte("not json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewJSONDatabase(path); !errors.Is(err, models.ErrDatabaseCorrupt) {
+		t.Errorf("got %v, want ErrDatabaseCorrupt", err)
+	}
+}
+
+// TestJournalEncrypted checks that the journal of an encrypted database
+// holds no embedding in the clear and replays with the key only
+func TestJournalEncrypted(t *testing.T) {
+	key, err := encryption.ParseKey(strings.Repeat("ab", encryption.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "face.json")
+	db, err := newJSONDatabase(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedding := models.Embedding{0.125, -0.5, 0.75}
+	user := &models.User{ID: uuid.NewString(), Name: "Alice", Faces: []models.Face{{ID: uuid.NewString(), Filename: "f1.jpg", Embedding: embedding}}}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	journal, err := os.ReadFile(journalPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(journal), "0.125") {
+		t.Error("journal holds the embedding in the clear")
+	}
+
+	if _, err := NewJSONDatabase(path); !errors.Is(err, encryption.ErrKeyRequired) {
+		t.Errorf("open without the key: got %v, want ErrKeyRequired", err)
+	}
+	db, err = newJSONDatabase(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.GetUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Faces) != 1 || !slices.Equal(got.Faces[0].Embedding, embedding) {
+		t.Errorf("faces after replay: %+v, want the embedding %v", got.Faces, embedding)
+	}
+}
+
+// testJournalLines returns the number of records in the journal of a
+// database
+func testJournalLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(journalPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+// testUserNames returns the names of the users of a database, in order
+func testUserNames(t *testing.T, db Database) []string {
+	t.Helper()
+	users, err := db.ListUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	return names
+}
@@ -4,19 +4,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
+	"face/internal/compression"
 	"face/internal/database/models"
+	"face/internal/encryption"
+	"face/internal/names"
 
 	"github.com/google/uuid"
 )
 
 // jsonData represents the internal JSON file structure
 type jsonData struct {
-	Version  string           `json:"version"`
-	Users    []models.User    `json:"users"`
-	Settings models.Settings  `json:"settings"`
+	Version  string          `json:"version"`
+	Users    []models.User   `json:"users"`
+	Settings models.Settings `json:"settings"`
+}
+
+// jsonFile is jsonData as written to the file, with the embeddings stored
+// like the SQL column
+type jsonFile struct {
+	Version  string          `json:"version"`
+	Users    []*storedUser   `json:"users"`
+	Settings models.Settings `json:"settings"`
 }
 
 // newJSONData creates a new JSON data structure with defaults
@@ -33,18 +47,35 @@ func newJSONData() *jsonData {
 	}
 }
 
-// JSONDatabase implements a thread-safe JSON file-based database
+// JSONDatabase implements a thread-safe JSON file-based database. Files
+// whose names end in .gz or .zst are compressed.
+//
+// Changes are appended to a journal next to the file, holding the new
+// state of the changed user or settings, and are written to the file
+// itself only when the journal has grown large or on Save.
 type JSONDatabase struct {
 	filePath string
 	data     *jsonData
 	mutex    sync.RWMutex
+	// key encrypts the embeddings and secrets, nil to store them as they are
+	key *encryption.Key
+
+	journal        *os.File
+	journalRecords int
 }
 
 // NewJSONDatabase creates a new JSON database instance
 func NewJSONDatabase(filePath string) (*JSONDatabase, error) {
+	return newJSONDatabase(filePath, nil)
+}
+
+// newJSONDatabase creates a JSON database encrypting the embeddings and
+// secrets with key, if not nil
+func newJSONDatabase(filePath string, key *encryption.Key) (*JSONDatabase, error) {
 	jdb := &JSONDatabase{
 		filePath: filePath,
 		data:     newJSONData(),
+		key:      key,
 	}
 
 	if loadErr := jdb.Load(); loadErr != nil {
@@ -65,21 +96,28 @@ func (j *JSONDatabase) Load() error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
-	data, err := os.ReadFile(j.filePath)
+	data, err := compression.ReadFile(j.filePath)
 	if err != nil {
 		return err
 	}
 
-	jd := newJSONData()
-	if err := json.Unmarshal(data, jd); err != nil {
-		return models.ErrDatabaseCorrupt
+	jd, err := decodeJSONData(data, j.key)
+	if err != nil {
+		return err
+	}
+
+	records, err := replayJournal(journalPath(j.filePath), jd, j.key)
+	if err != nil {
+		return err
 	}
 
 	j.data = jd
+	j.journalRecords = records
 	return nil
 }
 
-// Save writes the database to disk with backup
+// Save writes the whole database to disk with backup, folding in the
+// journal
 func (j *JSONDatabase) Save() error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
@@ -92,9 +130,13 @@ func (j *JSONDatabase) CreateUser(user *models.User) error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
+	user.Name = names.Normalize(user.Name)
 	if err := user.Validate(); err != nil {
 		return err
 	}
+	if err := checkFaceEmbeddings(&j.data.Settings, user.Faces); err != nil {
+		return err
+	}
 
 	for i := range j.data.Users {
 		if j.data.Users[i].ID == user.ID {
@@ -103,8 +145,12 @@ func (j *JSONDatabase) CreateUser(user *models.User) error {
 	}
 
 	now := time.Now()
-	user.CreatedAt = now
-	user.UpdatedAt = now
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
 
 	if user.ID == "" {
 		user.ID = uuid.New().String()
@@ -113,13 +159,18 @@ func (j *JSONDatabase) CreateUser(user *models.User) error {
 	if user.Faces == nil {
 		user.Faces = []models.Face{}
 	}
+	for i := range user.Faces {
+		if user.Faces[i].EnrolledAt.IsZero() {
+			user.Faces[i].EnrolledAt = now
+		}
+	}
 
 	if user.Metadata == nil {
 		user.Metadata = make(models.Metadata)
 	}
 
 	j.data.Users = append(j.data.Users, *user)
-	return j.saveInternal()
+	return j.commitUser(len(j.data.Users) - 1)
 }
 
 // GetUser retrieves a user by ID
@@ -128,7 +179,7 @@ func (j *JSONDatabase) GetUser(id string) (*models.User, error) {
 	defer j.mutex.RUnlock()
 
 	for i := range j.data.Users {
-		if j.data.Users[i].ID == id {
+		if j.data.Users[i].ID == id && j.data.Users[i].DeletedAt == nil {
 			user := j.data.Users[i]
 			return &user, nil
 		}
@@ -137,13 +188,15 @@ func (j *JSONDatabase) GetUser(id string) (*models.User, error) {
 	return nil, models.ErrUserNotFound
 }
 
-// GetUserByName retrieves a user by name (case-sensitive)
+// GetUserByName retrieves a user by name, normalized as names are stored
+// (see names.Normalize); case still matters
 func (j *JSONDatabase) GetUserByName(name string) (*models.User, error) {
+	name = names.Normalize(name)
 	j.mutex.RLock()
 	defer j.mutex.RUnlock()
 
 	for i := range j.data.Users {
-		if j.data.Users[i].Name == name {
+		if j.data.Users[i].Name == name && j.data.Users[i].DeletedAt == nil {
 			user := j.data.Users[i]
 			return &user, nil
 		}
@@ -152,28 +205,79 @@ func (j *JSONDatabase) GetUserByName(name string) (*models.User, error) {
 	return nil, models.ErrUserNotFound
 }
 
+// ListUsersByName returns every user with the given name, normalized as
+// names are stored, oldest first
+func (j *JSONDatabase) ListUsersByName(name string) ([]models.User, error) {
+	name = names.Normalize(name)
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	users := []models.User{}
+	for i := range j.data.Users {
+		if j.data.Users[i].Name == name && j.data.Users[i].DeletedAt == nil {
+			users = append(users, j.data.Users[i])
+		}
+	}
+	sort.SliceStable(users, func(a, b int) bool { return users[a].CreatedAt.Before(users[b].CreatedAt) })
+	return users, nil
+}
+
+// UserExistsByName reports whether a user has the given name, normalized as
+// names are stored
+func (j *JSONDatabase) UserExistsByName(name string) (bool, error) {
+	name = names.Normalize(name)
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	for i := range j.data.Users {
+		if j.data.Users[i].Name == name && j.data.Users[i].DeletedAt == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // UpdateUser updates an existing user
 func (j *JSONDatabase) UpdateUser(user *models.User) error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
+	user.Name = names.Normalize(user.Name)
 	if err := user.Validate(); err != nil {
 		return err
 	}
 
 	for i := range j.data.Users {
-		if j.data.Users[i].ID == user.ID {
+		if j.data.Users[i].ID == user.ID && j.data.Users[i].DeletedAt == nil {
 			user.UpdatedAt = time.Now()
 			user.CreatedAt = j.data.Users[i].CreatedAt
+			user.Faces = j.data.Users[i].Faces
+			user.Avatar = j.data.Users[i].Avatar
 			j.data.Users[i] = *user
-			return j.saveInternal()
+			return j.commitUser(i)
 		}
 	}
 
 	return models.ErrUserNotFound
 }
 
-// DeleteUser removes a user from the database
+// SetUserAvatar records the stored image of a user's avatar
+func (j *JSONDatabase) SetUserAvatar(userID, filename string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i := range j.data.Users {
+		if j.data.Users[i].ID == userID && j.data.Users[i].DeletedAt == nil {
+			j.data.Users[i].Avatar = filename
+			return j.commitUser(i)
+		}
+	}
+
+	return models.ErrUserNotFound
+}
+
+// DeleteUser permanently removes a user from the database, including a
+// user previously marked with SoftDeleteUser
 func (j *JSONDatabase) DeleteUser(id string) error {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
@@ -181,7 +285,7 @@ func (j *JSONDatabase) DeleteUser(id string) error {
 	for i := range j.data.Users {
 		if j.data.Users[i].ID == id {
 			j.data.Users = append(j.data.Users[:i], j.data.Users[i+1:]...)
-			return j.saveInternal()
+			return j.commitDeletedUser(id)
 		}
 	}
 
@@ -193,26 +297,87 @@ func (j *JSONDatabase) ListUsers() ([]models.User, error) {
 	j.mutex.RLock()
 	defer j.mutex.RUnlock()
 
-	users := make([]models.User, len(j.data.Users))
-	copy(users, j.data.Users)
+	users := make([]models.User, 0, len(j.data.Users))
+	for i := range j.data.Users {
+		if j.data.Users[i].DeletedAt == nil {
+			users = append(users, j.data.Users[i])
+		}
+	}
+	return users, nil
+}
+
+// SoftDeleteUser marks a user as being deleted
+func (j *JSONDatabase) SoftDeleteUser(id string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i := range j.data.Users {
+		if j.data.Users[i].ID == id && j.data.Users[i].DeletedAt == nil {
+			now := time.Now()
+			j.data.Users[i].DeletedAt = &now
+			return j.commitUser(i)
+		}
+	}
+
+	return models.ErrUserNotFound
+}
+
+// RestoreUser makes a soft-deleted user visible again
+func (j *JSONDatabase) RestoreUser(id string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i := range j.data.Users {
+		if j.data.Users[i].ID == id && j.data.Users[i].DeletedAt != nil {
+			j.data.Users[i].DeletedAt = nil
+			return j.commitUser(i)
+		}
+	}
+
+	return models.ErrUserNotFound
+}
+
+// ListDeletedUsers returns users whose deletion has not been finalized
+func (j *JSONDatabase) ListDeletedUsers() ([]models.User, error) {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	users := []models.User{}
+	for i := range j.data.Users {
+		if j.data.Users[i].DeletedAt != nil {
+			users = append(users, j.data.Users[i])
+		}
+	}
 	return users, nil
 }
 
-// AddFace adds a face to a user
-func (j *JSONDatabase) AddFace(userID string, face *models.Face) error {
+// AddFace adds a face to a user, evicting one if the face limit policy
+// says so
+func (j *JSONDatabase) AddFace(userID string, face *models.Face) (*models.Face, error) {
 	j.mutex.Lock()
 	defer j.mutex.Unlock()
 
 	if err := face.Validate(); err != nil {
-		return err
+		return nil, err
+	}
+	if err := j.data.Settings.CheckEmbedding(face.Embedding); err != nil {
+		return nil, err
 	}
 
 	for i := range j.data.Users {
-		if j.data.Users[i].ID != userID {
+		user := &j.data.Users[i]
+		if user.ID != userID || user.DeletedAt != nil {
 			continue
 		}
-		if len(j.data.Users[i].Faces) >= j.data.Settings.MaxFacesPerUser {
-			return models.ErrMaxFacesReached
+
+		var evicted *models.Face
+		if len(user.Faces) >= j.data.Settings.MaxFacesPerUser {
+			victim, ok := j.data.Settings.FaceLimitPolicy.Evict(user.Faces)
+			if !ok {
+				return nil, models.ErrMaxFacesReached
+			}
+			evicted = &victim
+			user.Faces = removeFace(user.Faces, victim.ID)
 		}
 
 		if face.ID == "" {
@@ -220,12 +385,12 @@ func (j *JSONDatabase) AddFace(userID string, face *models.Face) error {
 		}
 
 		face.EnrolledAt = time.Now()
-		j.data.Users[i].Faces = append(j.data.Users[i].Faces, *face)
-		j.data.Users[i].UpdatedAt = time.Now()
-		return j.saveInternal()
+		user.Faces = append(user.Faces, *face)
+		user.UpdatedAt = time.Now()
+		return evicted, j.commitUser(i)
 	}
 
-	return models.ErrUserNotFound
+	return nil, models.ErrUserNotFound
 }
 
 // RemoveFace removes a face from a user
@@ -234,7 +399,7 @@ func (j *JSONDatabase) RemoveFace(userID, faceID string) error {
 	defer j.mutex.Unlock()
 
 	for i := range j.data.Users {
-		if j.data.Users[i].ID == userID {
+		if j.data.Users[i].ID == userID && j.data.Users[i].DeletedAt == nil {
 			for k := range j.data.Users[i].Faces {
 				if j.data.Users[i].Faces[k].ID == faceID {
 					j.data.Users[i].Faces = append(
@@ -242,7 +407,7 @@ func (j *JSONDatabase) RemoveFace(userID, faceID string) error {
 						j.data.Users[i].Faces[k+1:]...,
 					)
 					j.data.Users[i].UpdatedAt = time.Now()
-					return j.saveInternal()
+					return j.commitUser(i)
 				}
 			}
 			return fmt.Errorf("face with ID %s not found", faceID)
@@ -252,14 +417,100 @@ func (j *JSONDatabase) RemoveFace(userID, faceID string) error {
 	return models.ErrUserNotFound
 }
 
-// GetAllEmbeddings returns a map of userID to faces for matching
+// SetFaceLabel changes the label of a face
+func (j *JSONDatabase) SetFaceLabel(userID, faceID, label string) error {
+	if len(label) > models.MaxFaceLabelLength {
+		return models.ErrLabelTooLong
+	}
+
+	return j.updateFaces(userID, faceID, func(f *models.Face) {
+		if f.ID == faceID {
+			f.Label = label
+		}
+	})
+}
+
+// SetPrimaryFace makes a face the user's primary face
+func (j *JSONDatabase) SetPrimaryFace(userID, faceID string) error {
+	return j.updateFaces(userID, faceID, func(f *models.Face) {
+		f.Primary = f.ID == faceID
+	})
+}
+
+// updateFaces applies update to every face of a user, provided the user
+// has the face faceID
+func (j *JSONDatabase) updateFaces(userID, faceID string, update func(f *models.Face)) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i := range j.data.Users {
+		user := &j.data.Users[i]
+		if user.ID != userID || user.DeletedAt != nil {
+			continue
+		}
+
+		found := false
+		for k := range user.Faces {
+			found = found || user.Faces[k].ID == faceID
+		}
+		if !found {
+			return fmt.Errorf("face with ID %s not found", faceID)
+		}
+
+		for k := range user.Faces {
+			update(&user.Faces[k])
+		}
+		user.UpdatedAt = time.Now()
+		return j.commitUser(i)
+	}
+
+	return models.ErrUserNotFound
+}
+
+// removeFace returns faces without the face with the given ID. It builds a
+// new slice, so users returned to callers earlier keep their faces.
+func removeFace(faces []models.Face, faceID string) []models.Face {
+	kept := make([]models.Face, 0, len(faces))
+	for _, f := range faces {
+		if f.ID != faceID {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// UpdateFaceFilename points a face at a new image file. Faces of users
+// pending deletion are included so their images can still be moved.
+func (j *JSONDatabase) UpdateFaceFilename(userID, faceID, filename string) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for i := range j.data.Users {
+		if j.data.Users[i].ID != userID {
+			continue
+		}
+		for k := range j.data.Users[i].Faces {
+			if j.data.Users[i].Faces[k].ID == faceID {
+				j.data.Users[i].Faces[k].Filename = filename
+				return j.commitUser(i)
+			}
+		}
+		return fmt.Errorf("face with ID %s not found", faceID)
+	}
+
+	return models.ErrUserNotFound
+}
+
+// GetAllEmbeddings returns a map of userID to faces for matching, leaving
+// out expired visitors
 func (j *JSONDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
 	j.mutex.RLock()
 	defer j.mutex.RUnlock()
 
+	now := time.Now()
 	embeddings := make(map[string][]models.Face)
 	for i := range j.data.Users {
-		if len(j.data.Users[i].Faces) > 0 {
+		if len(j.data.Users[i].Faces) > 0 && j.data.Users[i].DeletedAt == nil && !j.data.Users[i].Expired(now) {
 			embeddings[j.data.Users[i].ID] = j.data.Users[i].Faces
 		}
 	}
@@ -267,6 +518,43 @@ func (j *JSONDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
 	return embeddings, nil
 }
 
+// ReplaceEmbeddings sets the embedding of every face and records the model
+// they were computed with, writing a new database file
+func (j *JSONDatabase) ReplaceEmbeddings(embeddings map[string]models.Embedding, model string, dimension int) error {
+	if err := checkReplacement(embeddings, model, dimension); err != nil {
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// the users are copied, so users returned to callers earlier and the
+	// data itself if the file cannot be written keep their embeddings
+	users := make([]models.User, len(j.data.Users))
+	replaced := 0
+	for i := range j.data.Users {
+		users[i] = j.data.Users[i]
+		users[i].Faces = slices.Clone(j.data.Users[i].Faces)
+		n, err := replaceFaceEmbeddings(users[i].Faces, embeddings)
+		if err != nil {
+			return err
+		}
+		replaced += n
+	}
+	if replaced != len(embeddings) {
+		return ErrGalleryChanged
+	}
+
+	previousUsers, previousSettings := j.data.Users, j.data.Settings
+	j.data.Users = users
+	j.data.Settings.EmbeddingModel, j.data.Settings.EmbeddingDimension = model, dimension
+	if err := j.saveInternal(); err != nil {
+		j.data.Users, j.data.Settings = previousUsers, previousSettings
+		return err
+	}
+	return nil
+}
+
 // GetSettings returns the current settings
 func (j *JSONDatabase) GetSettings() (*models.Settings, error) {
 	j.mutex.RLock()
@@ -282,35 +570,138 @@ func (j *JSONDatabase) UpdateSettings(settings *models.Settings) error {
 	defer j.mutex.Unlock()
 
 	j.data.Settings = *settings
-	return j.saveInternal()
+	return j.commitSettings()
+}
+
+// encodeJSONData returns the file contents of the data, its embeddings and
+// secrets encrypted with key if not nil
+func encodeJSONData(jd *jsonData, key *encryption.Key) ([]byte, error) {
+	file := jsonFile{Version: jd.Version, Users: make([]*storedUser, len(jd.Users)), Settings: jd.Settings}
+	for i := range jd.Users {
+		stored, err := sealUser(key, &jd.Users[i])
+		if err != nil {
+			return nil, err
+		}
+		file.Users[i] = stored
+	}
+
+	data, err := json.MarshalIndent(&file, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal database: %w", err)
+	}
+	return data, nil
+}
+
+// decodeJSONData parses the file contents of a JSON database, decrypting
+// encrypted embeddings and secrets with key
+func decodeJSONData(data []byte, key *encryption.Key) (*jsonData, error) {
+	jd := newJSONData()
+	file := jsonFile{Version: jd.Version, Settings: jd.Settings}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, models.ErrDatabaseCorrupt
+	}
+
+	jd.Version, jd.Settings = file.Version, file.Settings
+	for _, stored := range file.Users {
+		if stored == nil {
+			continue
+		}
+		user, err := openUser(key, stored)
+		if err != nil {
+			return nil, err
+		}
+		jd.Users = append(jd.Users, user)
+	}
+	return jd, nil
 }
 
 // saveInternal saves without acquiring the lock (must be called with lock held)
 func (j *JSONDatabase) saveInternal() error {
-	backupPath := j.filePath + ".backup"
-	if _, err := os.Stat(j.filePath); err == nil {
-		if err := os.Rename(j.filePath, backupPath); err != nil {
-			return fmt.Errorf("failed to create backup: %w", err)
-		}
+	if err := j.replaceFile(); err != nil {
+		return err
 	}
+	_ = os.Remove(j.backupPath())
+	return j.dropJournal()
+}
 
-	data, err := json.MarshalIndent(j.data, "", "  ")
+// backupPath returns the path the previous database file is kept at while
+// a new one is written
+func (j *JSONDatabase) backupPath() string {
+	return j.filePath + ".backup"
+}
+
+// replaceFile writes the data to a new database file, keeping the previous
+// file as a backup (must be called with lock held). The data is encoded
+// and written to a temporary file first, so a failure leaves the previous
+// file in place.
+func (j *JSONDatabase) replaceFile() error {
+	data, err := encodeJSONData(j.data, j.key)
+	if err != nil {
+		return err
+	}
+	tmpPath, err := j.writeTemp(data)
 	if err != nil {
-		return fmt.Errorf("failed to marshal database: %w", err)
+		return fmt.Errorf("failed to write database: %w", err)
 	}
 
-	if err := os.WriteFile(j.filePath, data, 0o600); err != nil {
+	backupPath := j.backupPath()
+	if _, err := os.Stat(j.filePath); err == nil {
+		if err := os.Rename(j.filePath, backupPath); err != nil {
+			_ = os.Remove(tmpPath)
+			return fmt.Errorf("failed to create backup: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, j.filePath); err != nil {
+		_ = os.Remove(tmpPath)
 		if _, statErr := os.Stat(backupPath); statErr == nil {
 			_ = os.Rename(backupPath, j.filePath)
 		}
 		return fmt.Errorf("failed to write database: %w", err)
 	}
-
-	_ = os.Remove(backupPath)
 	return nil
 }
 
-// Close implements the Database interface (no-op for JSON)
+// writeTemp writes data to a temporary file next to the database file,
+// compressed like it, returning its path. The file is only readable by its
+// owner, like the database file.
+func (j *JSONDatabase) writeTemp(data []byte) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(j.filePath), "."+filepath.Base(j.filePath)+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	err = writeSynced(file, data, compression.FormatOf(j.filePath))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// writeSynced writes data to a file compressed in format and flushes it to
+// disk
+func writeSynced(file *os.File, data []byte, format compression.Format) error {
+	w, err := compression.NewWriter(file, format)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Close closes the journal. The database file is left as it is, as the
+// journal is replayed on the next Load.
 func (j *JSONDatabase) Close() error {
-	return j.Save()
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.closeJournal()
 }
@@ -1,9 +1,15 @@
 package database
 
 import (
+	"bytes"
+	"database/sql"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
 	"strings"
+	"text/template"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
@@ -18,13 +24,24 @@ type Migrator struct {
 }
 
 // NewMigrator creates a new Migrator instance
-func NewMigrator(dbType DatabaseType, connectionString string) (*Migrator, error) {
-	d, err := iofs.New(migrationsFS, "migrations")
+func NewMigrator(dbType DatabaseType, connectionString string, opts Options) (*Migrator, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.forType(dbType)
+
+	d, err := iofs.New(templateFS{FS: migrationsFS, opts: opts, dbType: dbType}, "migrations")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create migration source: %w", err)
 	}
 
-	dbURL := buildDatabaseURL(dbType, connectionString)
+	dbURL := buildDatabaseURL(dbType, connectionString, opts)
+
+	if opts.Schema != "" {
+		if err := createSchema(dbURL, opts.Schema); err != nil {
+			return nil, err
+		}
+	}
 
 	m, err := migrate.NewWithSourceInstance("iofs", d, dbURL)
 	if err != nil {
@@ -82,14 +99,123 @@ func (m *Migrator) Close() error {
 }
 
 // buildDatabaseURL constructs the database URL for migrations
-func buildDatabaseURL(dbType DatabaseType, connectionString string) string {
+func buildDatabaseURL(dbType DatabaseType, connectionString string, opts Options) string {
+	var dbURL string
 	if dbType == DatabaseTypeSQLite {
-		return fmt.Sprintf("sqlite://%s", connectionString)
+		dbURL = fmt.Sprintf("sqlite://%s", connectionString)
+	} else {
+		dbURL = connectionString
+		if !strings.HasPrefix(dbURL, "postgres://") {
+			dbURL = "postgres://" + dbURL
+		}
+	}
+
+	if opts.qualifier() == "" {
+		return dbURL
+	}
+
+	// Keep the version table alongside the prefixed tables so several
+	// installations can share one database
+	table := opts.TablePrefix + "schema_migrations"
+	params := url.Values{}
+	if opts.Schema != "" {
+		params.Set("x-migrations-table", fmt.Sprintf("%q.%q", opts.Schema, table))
+		params.Set("x-migrations-table-quoted", "1")
+	} else {
+		params.Set("x-migrations-table", table)
+	}
+
+	separator := "?"
+	if strings.Contains(dbURL, "?") {
+		separator = "&"
+	}
+	return dbURL + separator + params.Encode()
+}
+
+// createSchema creates the PostgreSQL schema so the migration version
+// table can be created inside it
+func createSchema(dbURL, schemaName string) error {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	db, err := sql.Open("postgres", migrate.FilterCustomQuery(u).String())
+	if err != nil {
+		return fmt.Errorf("failed to connect for schema creation: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", schemaName)); err != nil {
+		return fmt.Errorf("failed to create schema %s: %w", schemaName, err)
+	}
+	return nil
+}
+
+// templateFS renders the embedded migrations with the configured schema
+// and table prefix, so the SQL files stay backend and prefix agnostic
+type templateFS struct {
+	fs.FS
+	opts   Options
+	dbType DatabaseType
+}
+
+// Postgres reports whether the migrations are rendered for PostgreSQL, for
+// the few statements whose syntax differs between the backends
+func (t templateFS) Postgres() bool {
+	return t.dbType == DatabaseTypePostgres
+}
+
+// PGVector reports whether the migrations add the pgvector column
+func (t templateFS) PGVector() bool {
+	return t.dbType == DatabaseTypePostgres && t.opts.PGVector
+}
+
+// Table returns the schema-qualified, prefixed name of a table or index
+func (t templateFS) Table(name string) string {
+	return t.opts.qualifier() + name
+}
+
+// Name returns the prefixed, unqualified name of an index or constraint
+func (t templateFS) Name(name string) string {
+	return t.opts.TablePrefix + name
+}
+
+// Open renders .sql files as templates and passes everything else through
+func (t templateFS) Open(name string) (fs.File, error) {
+	f, err := t.FS.Open(name)
+	if err != nil || !strings.HasSuffix(name, ".sql") {
+		return f, err
 	}
 
-	dbURL := connectionString
-	if !strings.HasPrefix(dbURL, "postgres://") {
-		dbURL = "postgres://" + dbURL
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	tmpl, err := template.New(name).Parse(string(raw))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid migration template %s: %w", name, err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to render migration %s: %w", name, err)
 	}
-	return dbURL
+
+	return &renderedFile{File: f, Reader: bytes.NewReader(rendered.Bytes())}, nil
+}
+
+// renderedFile serves rendered template content in place of the raw file
+type renderedFile struct {
+	fs.File
+	*bytes.Reader
+}
+
+// Read reads from the rendered content
+func (r *renderedFile) Read(p []byte) (int, error) {
+	return r.Reader.Read(p)
 }
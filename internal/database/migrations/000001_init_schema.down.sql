@@ -1,7 +1,7 @@
 -- Drop index
-DROP INDEX IF EXISTS idx_faces_user_id;
+DROP INDEX IF EXISTS {{.Table "idx_faces_user_id"}};
 
 -- Drop tables in reverse order
-DROP TABLE IF EXISTS settings;
-DROP TABLE IF EXISTS faces;
-DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS {{.Table "settings"}};
+DROP TABLE IF EXISTS {{.Table "faces"}};
+DROP TABLE IF EXISTS {{.Table "users"}};
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS {{.Table "idx_users_deleted_at"}};
+
+ALTER TABLE {{.Table "users"}} DROP COLUMN deleted_at;
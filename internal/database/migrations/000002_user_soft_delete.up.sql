@@ -0,0 +1,4 @@
+-- Track users whose deletion has started but not yet been finalized
+ALTER TABLE {{.Table "users"}} ADD COLUMN deleted_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS {{.Name "idx_users_deleted_at"}} ON {{.Table "users"}}(deleted_at);
@@ -0,0 +1,2 @@
+-- Size face crops are resized to before saving and extraction (0 = native size)
+ALTER TABLE {{.Table "settings"}} ADD COLUMN crop_size INTEGER NOT NULL DEFAULT 0;
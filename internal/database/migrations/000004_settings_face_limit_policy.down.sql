@@ -0,0 +1 @@
+ALTER TABLE {{.Table "settings"}} DROP COLUMN face_limit_policy;
@@ -0,0 +1,2 @@
+-- What AddFace does when a user already has max_faces_per_user faces
+ALTER TABLE {{.Table "settings"}} ADD COLUMN face_limit_policy VARCHAR(32) NOT NULL DEFAULT 'reject';
@@ -0,0 +1,2 @@
+ALTER TABLE {{.Table "faces"}} DROP COLUMN is_primary;
+ALTER TABLE {{.Table "faces"}} DROP COLUMN label;
@@ -0,0 +1,3 @@
+-- Optional description of a face photo and the face shown as the user's avatar
+ALTER TABLE {{.Table "faces"}} ADD COLUMN label VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "faces"}} ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1 @@
+ALTER TABLE {{.Table "users"}} DROP COLUMN avatar;
@@ -0,0 +1,2 @@
+-- Stored image of each user's avatar, generated from their best face
+ALTER TABLE {{.Table "users"}} ADD COLUMN avatar VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+{{if .Postgres}}
+DROP TRIGGER IF EXISTS {{.Name "faces_changes"}} ON {{.Table "faces"}};
+DROP TRIGGER IF EXISTS {{.Name "users_changes"}} ON {{.Table "users"}};
+DROP FUNCTION IF EXISTS {{.Table "record_face_change"}}();
+DROP FUNCTION IF EXISTS {{.Table "record_user_change"}}();
+{{else}}
+DROP TRIGGER IF EXISTS {{.Name "faces_changes_delete"}};
+DROP TRIGGER IF EXISTS {{.Name "faces_changes_update"}};
+DROP TRIGGER IF EXISTS {{.Name "faces_changes_insert"}};
+DROP TRIGGER IF EXISTS {{.Name "users_changes_delete"}};
+DROP TRIGGER IF EXISTS {{.Name "users_changes_update"}};
+DROP TRIGGER IF EXISTS {{.Name "users_changes_insert"}};
+{{end}}
+DROP TABLE IF EXISTS {{.Table "changes"}};
@@ -0,0 +1,92 @@
+-- Change log of users and faces, filled by triggers so every write is
+-- recorded, whichever program makes it. Read by 'face cdc'.
+{{if .Postgres}}
+CREATE TABLE IF NOT EXISTS {{.Table "changes"}} (
+    seq BIGSERIAL PRIMARY KEY,
+    entity VARCHAR(10) NOT NULL,
+    entity_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    op VARCHAR(10) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Soft-deleting a user is its deletion as far as readers are concerned;
+-- later changes to the hidden row are not recorded
+CREATE OR REPLACE FUNCTION {{.Table "record_user_change"}}() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('user', NEW.id, NEW.id, 'create');
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.deleted_at IS NULL THEN
+            INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op)
+            VALUES ('user', NEW.id, NEW.id, CASE WHEN NEW.deleted_at IS NULL THEN 'update' ELSE 'delete' END);
+        END IF;
+    ELSIF OLD.deleted_at IS NULL THEN
+        INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('user', OLD.id, OLD.id, 'delete');
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION {{.Table "record_face_change"}}() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('face', NEW.id, NEW.user_id, 'create');
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('face', NEW.id, NEW.user_id, 'update');
+    ELSE
+        INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('face', OLD.id, OLD.user_id, 'delete');
+    END IF;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER {{.Name "users_changes"}} AFTER INSERT OR UPDATE OR DELETE ON {{.Table "users"}}
+    FOR EACH ROW EXECUTE FUNCTION {{.Table "record_user_change"}}();
+CREATE TRIGGER {{.Name "faces_changes"}} AFTER INSERT OR UPDATE OR DELETE ON {{.Table "faces"}}
+    FOR EACH ROW EXECUTE FUNCTION {{.Table "record_face_change"}}();
+{{else}}
+CREATE TABLE IF NOT EXISTS {{.Table "changes"}} (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    entity VARCHAR(10) NOT NULL,
+    entity_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(36) NOT NULL,
+    op VARCHAR(10) NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Soft-deleting a user is its deletion as far as readers are concerned;
+-- later changes to the hidden row are not recorded
+CREATE TRIGGER IF NOT EXISTS {{.Name "users_changes_insert"}} AFTER INSERT ON {{.Table "users"}}
+BEGIN
+    INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('user', NEW.id, NEW.id, 'create');
+END;
+
+CREATE TRIGGER IF NOT EXISTS {{.Name "users_changes_update"}} AFTER UPDATE ON {{.Table "users"}}
+WHEN OLD.deleted_at IS NULL
+BEGIN
+    INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op)
+    VALUES ('user', NEW.id, NEW.id, CASE WHEN NEW.deleted_at IS NULL THEN 'update' ELSE 'delete' END);
+END;
+
+CREATE TRIGGER IF NOT EXISTS {{.Name "users_changes_delete"}} AFTER DELETE ON {{.Table "users"}}
+WHEN OLD.deleted_at IS NULL
+BEGIN
+    INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('user', OLD.id, OLD.id, 'delete');
+END;
+
+CREATE TRIGGER IF NOT EXISTS {{.Name "faces_changes_insert"}} AFTER INSERT ON {{.Table "faces"}}
+BEGIN
+    INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('face', NEW.id, NEW.user_id, 'create');
+END;
+
+CREATE TRIGGER IF NOT EXISTS {{.Name "faces_changes_update"}} AFTER UPDATE ON {{.Table "faces"}}
+BEGIN
+    INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('face', NEW.id, NEW.user_id, 'update');
+END;
+
+CREATE TRIGGER IF NOT EXISTS {{.Name "faces_changes_delete"}} AFTER DELETE ON {{.Table "faces"}}
+BEGIN
+    INSERT INTO {{.Table "changes"}} (entity, entity_id, user_id, op) VALUES ('face', OLD.id, OLD.user_id, 'delete');
+END;
+{{end}}
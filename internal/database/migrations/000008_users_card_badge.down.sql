@@ -0,0 +1,2 @@
+ALTER TABLE {{.Table "users"}} DROP COLUMN badge;
+ALTER TABLE {{.Table "users"}} DROP COLUMN card_number;
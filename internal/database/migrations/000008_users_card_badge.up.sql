@@ -0,0 +1,3 @@
+-- Access card number and badge ID of each user, for door controllers
+ALTER TABLE {{.Table "users"}} ADD COLUMN card_number VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "users"}} ADD COLUMN badge VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Expiry of visitors enrolled with --temporary, NULL for regular users
+ALTER TABLE {{.Table "users"}} ADD COLUMN expires_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS {{.Name "idx_users_expires_at"}} ON {{.Table "users"}}(expires_at);
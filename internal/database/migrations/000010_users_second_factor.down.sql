@@ -0,0 +1,2 @@
+ALTER TABLE {{.Table "users"}} DROP COLUMN totp_secret;
+ALTER TABLE {{.Table "users"}} DROP COLUMN pin_hash;
@@ -0,0 +1,3 @@
+-- Salted PIN hash and TOTP secret of each user, for step-up verification
+ALTER TABLE {{.Table "users"}} ADD COLUMN pin_hash VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "users"}} ADD COLUMN totp_secret VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+{{if .Postgres}}
+DROP INDEX IF EXISTS {{.Table "idx_faces_embedding_vector"}};
+DROP TRIGGER IF EXISTS {{.Name "faces_embedding_vector"}} ON {{.Table "faces"}};
+DROP FUNCTION IF EXISTS {{.Table "set_embedding_vector"}}();
+ALTER TABLE {{.Table "faces"}} DROP COLUMN IF EXISTS embedding_vector;
+{{end}}
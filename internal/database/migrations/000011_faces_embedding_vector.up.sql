@@ -0,0 +1,27 @@
+-- pgvector copy of each embedding, so similarity search runs in SQL. Only
+-- with pgvector enabled; the JSON text column stays the source of truth and
+-- a trigger keeps the copy in sync, whichever program writes the face.
+-- Embeddings of other dimensions than 128 get no copy.
+{{if .PGVector}}
+CREATE EXTENSION IF NOT EXISTS vector;
+
+ALTER TABLE {{.Table "faces"}} ADD COLUMN embedding_vector vector(128);
+
+CREATE OR REPLACE FUNCTION {{.Table "set_embedding_vector"}}() RETURNS trigger AS $$
+BEGIN
+    NEW.embedding_vector := CASE WHEN vector_dims(NEW.embedding::vector) = 128 THEN NEW.embedding::vector(128) END;
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER {{.Name "faces_embedding_vector"}} BEFORE INSERT OR UPDATE OF embedding ON {{.Table "faces"}}
+    FOR EACH ROW EXECUTE FUNCTION {{.Table "set_embedding_vector"}}();
+
+-- Filling in the existing faces is not a change to record
+ALTER TABLE {{.Table "faces"}} DISABLE TRIGGER {{.Name "faces_changes"}};
+UPDATE {{.Table "faces"}} SET embedding = embedding;
+ALTER TABLE {{.Table "faces"}} ENABLE TRIGGER {{.Name "faces_changes"}};
+
+CREATE INDEX IF NOT EXISTS {{.Name "idx_faces_embedding_vector"}} ON {{.Table "faces"}}
+    USING hnsw (embedding_vector vector_cosine_ops);
+{{end}}
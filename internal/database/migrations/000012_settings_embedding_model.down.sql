@@ -0,0 +1 @@
+ALTER TABLE {{.Table "settings"}} DROP COLUMN embedding_model;
@@ -0,0 +1,3 @@
+-- Embedding model the gallery was enrolled with, so a binary computing
+-- embeddings with another model refuses to compare against it
+ALTER TABLE {{.Table "settings"}} ADD COLUMN embedding_model VARCHAR(64) NOT NULL DEFAULT '';
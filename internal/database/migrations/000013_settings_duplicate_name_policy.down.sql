@@ -0,0 +1 @@
+ALTER TABLE {{.Table "settings"}} DROP COLUMN duplicate_name_policy;
@@ -0,0 +1,3 @@
+-- What enrolling a user with the name of an existing user does: allow,
+-- warn (refuse unless forced) or reject
+ALTER TABLE {{.Table "settings"}} ADD COLUMN duplicate_name_policy VARCHAR(16) NOT NULL DEFAULT 'allow';
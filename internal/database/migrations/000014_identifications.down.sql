@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS {{.Table "idx_identifications_user_id"}};
+DROP INDEX IF EXISTS {{.Table "idx_identifications_identified_at"}};
+
+DROP TABLE IF EXISTS {{.Table "identifications"}};
@@ -0,0 +1,25 @@
+-- Identifications made by 'face watch', for surveillance-style deployments
+-- that need to know who was seen where and when
+{{if .Postgres}}
+CREATE TABLE IF NOT EXISTS {{.Table "identifications"}} (
+    seq BIGSERIAL PRIMARY KEY,
+    identified_at TIMESTAMP NOT NULL,
+    source VARCHAR(255) NOT NULL,
+    matched BOOLEAN NOT NULL,
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    quality DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+{{else}}
+CREATE TABLE IF NOT EXISTS {{.Table "identifications"}} (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    identified_at TIMESTAMP NOT NULL,
+    source VARCHAR(255) NOT NULL,
+    matched BOOLEAN NOT NULL,
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    confidence REAL NOT NULL DEFAULT 0,
+    quality REAL NOT NULL DEFAULT 0
+);
+{{end}}
+CREATE INDEX IF NOT EXISTS {{.Name "idx_identifications_identified_at"}} ON {{.Table "identifications"}}(identified_at);
+CREATE INDEX IF NOT EXISTS {{.Name "idx_identifications_user_id"}} ON {{.Table "identifications"}}(user_id);
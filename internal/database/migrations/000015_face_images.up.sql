@@ -0,0 +1,16 @@
+-- Face images of the database storage backend, for single-file deployments
+-- without a faces directory. Images are keyed by the filename the faces
+-- table records, as an image is saved before its face.
+{{if .Postgres}}
+CREATE TABLE IF NOT EXISTS {{.Table "face_images"}} (
+    filename VARCHAR(255) PRIMARY KEY,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+{{else}}
+CREATE TABLE IF NOT EXISTS {{.Table "face_images"}} (
+    filename VARCHAR(255) PRIMARY KEY,
+    data BLOB NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+{{end}}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS {{.Table "idx_audit_events_user_id"}};
+DROP INDEX IF EXISTS {{.Table "idx_audit_events_occurred_at"}};
+
+DROP TABLE IF EXISTS {{.Table "audit_events"}};
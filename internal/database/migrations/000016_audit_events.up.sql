@@ -0,0 +1,29 @@
+-- Audit log of enrollments, identifications, verifications, deletions and
+-- exports, for compliance with GDPR and BIPA
+{{if .Postgres}}
+CREATE TABLE IF NOT EXISTS {{.Table "audit_events"}} (
+    seq BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    operation VARCHAR(32) NOT NULL,
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    result VARCHAR(32) NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    error VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT ''
+);
+{{else}}
+CREATE TABLE IF NOT EXISTS {{.Table "audit_events"}} (
+    seq INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TIMESTAMP NOT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    operation VARCHAR(32) NOT NULL,
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    result VARCHAR(32) NOT NULL,
+    confidence REAL NOT NULL DEFAULT 0,
+    error VARCHAR(64) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT ''
+);
+{{end}}
+CREATE INDEX IF NOT EXISTS {{.Name "idx_audit_events_occurred_at"}} ON {{.Table "audit_events"}}(occurred_at);
+CREATE INDEX IF NOT EXISTS {{.Name "idx_audit_events_user_id"}} ON {{.Table "audit_events"}}(user_id);
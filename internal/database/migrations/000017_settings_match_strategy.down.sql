@@ -0,0 +1 @@
+ALTER TABLE {{.Table "settings"}} DROP COLUMN match_strategy;
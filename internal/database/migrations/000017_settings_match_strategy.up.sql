@@ -0,0 +1,3 @@
+-- How a user's faces are combined into their similarity to a probe: best
+-- (closest face), average (mean embedding) or vote (top-k faces vote)
+ALTER TABLE {{.Table "settings"}} ADD COLUMN match_strategy VARCHAR(16) NOT NULL DEFAULT 'best';
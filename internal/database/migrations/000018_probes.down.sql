@@ -0,0 +1,6 @@
+ALTER TABLE {{.Table "audit_events"}} DROP COLUMN probe_id;
+
+DROP INDEX IF EXISTS {{.Table "idx_probes_user_id"}};
+DROP INDEX IF EXISTS {{.Table "idx_probes_captured_at"}};
+
+DROP TABLE IF EXISTS {{.Table "probes"}};
@@ -0,0 +1,35 @@
+-- Probes saved with 'face identify --save-probe' and 'face verify
+-- --save-probe', for human review of contested decisions; the audit event
+-- of a decision refers to its probe
+{{if .Postgres}}
+CREATE TABLE IF NOT EXISTS {{.Table "probes"}} (
+    id VARCHAR(36) PRIMARY KEY,
+    captured_at TIMESTAMP NOT NULL,
+    operation VARCHAR(32) NOT NULL,
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    matched BOOLEAN NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    quality DOUBLE PRECISION NOT NULL DEFAULT 0,
+    embedding TEXT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    request_id VARCHAR(128) NOT NULL DEFAULT ''
+);
+{{else}}
+CREATE TABLE IF NOT EXISTS {{.Table "probes"}} (
+    id VARCHAR(36) PRIMARY KEY,
+    captured_at TIMESTAMP NOT NULL,
+    operation VARCHAR(32) NOT NULL,
+    user_id VARCHAR(36) NOT NULL DEFAULT '',
+    matched BOOLEAN NOT NULL,
+    confidence REAL NOT NULL DEFAULT 0,
+    threshold REAL NOT NULL DEFAULT 0,
+    quality REAL NOT NULL DEFAULT 0,
+    embedding TEXT NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    request_id VARCHAR(128) NOT NULL DEFAULT ''
+);
+{{end}}
+CREATE INDEX IF NOT EXISTS {{.Name "idx_probes_captured_at"}} ON {{.Table "probes"}}(captured_at);
+CREATE INDEX IF NOT EXISTS {{.Name "idx_probes_user_id"}} ON {{.Table "probes"}}(user_id);
+ALTER TABLE {{.Table "audit_events"}} ADD COLUMN probe_id VARCHAR(36) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE {{.Table "users"}} DROP COLUMN scopes;
+
+DROP TABLE IF EXISTS {{.Table "scopes"}};
@@ -0,0 +1,8 @@
+-- Orgs, sites and devices of deployments with several sites under one
+-- database, and the scopes each user can be identified at
+CREATE TABLE IF NOT EXISTS {{.Table "scopes"}} (
+    path VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+ALTER TABLE {{.Table "users"}} ADD COLUMN scopes TEXT NOT NULL DEFAULT '[]';
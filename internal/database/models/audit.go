@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// Operations recorded in the audit log
+const (
+	AuditEnroll     = "enroll"
+	AuditIdentify   = "identify"
+	AuditVerify     = "verify"
+	AuditDelete     = "delete"
+	AuditRemoveFace = "remove-face"
+	AuditExport     = "export"
+	AuditPurge      = "purge"
+)
+
+// Results of audited operations
+const (
+	// AuditSucceeded is an operation that did what was asked: a user
+	// enrolled, deleted or exported, a face identified or verified
+	AuditSucceeded = "succeeded"
+	// AuditNoMatch is a face that matched nobody, or not the user it was
+	// verified against
+	AuditNoMatch = "no_match"
+	// AuditFailed is an operation that failed; Error holds why
+	AuditFailed = "failed"
+)
+
+// AuditEvent is a biometric operation, recorded for compliance. Seq
+// increases with every event. Events keep the ID of a user after the user
+// is deleted, but never their name or face.
+type AuditEvent struct {
+	Seq        int64     `gorm:"column:seq;primaryKey" json:"seq"`
+	OccurredAt time.Time `gorm:"not null" json:"occurred_at"`
+	// Actor is who performed the operation: the operator's login for
+	// commands, "api" or "api:" and the API key name for the servers
+	Actor     string `gorm:"type:varchar(255);not null" json:"actor"`
+	Operation string `gorm:"type:varchar(32);not null" json:"operation"`
+	// UserID is the user enrolled, verified, deleted or identified, empty
+	// if there is none, e.g. for an export of every user
+	UserID     string  `gorm:"type:varchar(36);not null" json:"user_id,omitempty"`
+	Result     string  `gorm:"type:varchar(32);not null" json:"result"`
+	Confidence float64 `gorm:"not null" json:"confidence,omitempty"`
+	// Error is the error class of a failed operation, the error codes of
+	// the API, e.g. face_not_detected
+	Error string `gorm:"type:varchar(64);not null" json:"error,omitempty"`
+	// RequestID ties the event to the log lines of the run or request
+	RequestID string `gorm:"type:varchar(128);not null" json:"request_id,omitempty"`
+	// ProbeID is the Probe saved with the decision of an identification
+	// or verification, if any
+	ProbeID string `gorm:"type:varchar(36);not null" json:"probe_id,omitempty"`
+}
+
+// TableName specifies the table name for AuditEvent, including any
+// configured schema and table prefix
+func (AuditEvent) TableName(namer schema.Namer) string {
+	return namer.TableName("audit_events")
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// Change operations
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Changed entities
+const (
+	ChangeEntityUser = "user"
+	ChangeEntityFace = "face"
+)
+
+// Change is an entry of the change log, which database triggers record for
+// every write to users and faces. Seq increases with every change.
+type Change struct {
+	Seq       int64     `gorm:"column:seq;primaryKey" json:"seq"`
+	Entity    string    `gorm:"type:varchar(10);not null" json:"entity"`
+	EntityID  string    `gorm:"type:varchar(36);not null" json:"id"`
+	UserID    string    `gorm:"type:varchar(36);not null" json:"user_id"`
+	Op        string    `gorm:"type:varchar(10);not null" json:"op"`
+	ChangedAt time.Time `gorm:"not null" json:"changed_at"`
+}
+
+// TableName specifies the table name for Change, including any
+// configured schema and table prefix
+func (Change) TableName(namer schema.Namer) string {
+	return namer.TableName("changes")
+}
@@ -6,12 +6,21 @@ import "errors"
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrDuplicateName     = errors.New("a user with this name already exists")
 	ErrFaceNotDetected   = errors.New("no face detected in image")
 	ErrMultipleFaces     = errors.New("multiple faces detected, expected one")
+	ErrSpoofDetected     = errors.New("face looks like a printed photo or a screen, not a live person")
 	ErrNoMatch           = errors.New("no matching user found")
 	ErrInvalidImage      = errors.New("invalid image format")
 	ErrDatabaseCorrupt   = errors.New("database file is corrupted")
 	ErrMaxFacesReached   = errors.New("maximum faces per user reached")
 	ErrEmptyName         = errors.New("user name cannot be empty")
 	ErrInvalidID         = errors.New("invalid user or face ID")
+	ErrLabelTooLong      = errors.New("face label cannot be longer than 100 characters")
+	ErrInvalidCardNumber = errors.New("card number must be up to 20 digits")
+	ErrDimensionMismatch = errors.New("embedding dimension does not match the gallery")
+	ErrProbeNotFound     = errors.New("probe not found")
+	ErrScopeNotFound     = errors.New("scope not found")
+	ErrScopeExists       = errors.New("scope already exists")
+	ErrScopeInUse        = errors.New("scope still has sites, devices or users")
 )
@@ -2,7 +2,10 @@ package models
 
 import (
 	"errors"
+	"sort"
 	"time"
+
+	"gorm.io/gorm/schema"
 )
 
 // Face represents a face image and its embedding
@@ -10,14 +13,50 @@ type Face struct {
 	ID           string    `gorm:"type:varchar(36);primaryKey" json:"id"`
 	UserID       string    `gorm:"type:varchar(36);not null;index" json:"user_id"`
 	Filename     string    `gorm:"type:varchar(255);not null" json:"filename"`
-	Embedding    Embedding `gorm:"type:text;not null" json:"embedding"`
+	Embedding    Embedding `gorm:"type:text;not null;serializer:embedding" json:"embedding"`
 	QualityScore float64   `gorm:"type:real;not null;default:0" json:"quality_score"`
 	EnrolledAt   time.Time `gorm:"not null" json:"enrolled_at"`
+	// Label describes the photo, e.g. "passport photo" or "with glasses"
+	Label string `gorm:"type:varchar(100);not null;default:''" json:"label,omitempty"`
+	// Primary marks the face used as the user's avatar; at most one face
+	// per user is primary
+	Primary bool `gorm:"column:is_primary;not null;default:false" json:"primary,omitempty"`
+}
+
+// MaxFaceLabelLength is the maximum length of Face.Label
+const MaxFaceLabelLength = 100
+
+// SortFaces orders faces for display: the primary face first, the others
+// in enrollment order
+func SortFaces(faces []Face) {
+	sort.SliceStable(faces, func(i, j int) bool {
+		return faces[i].Primary && !faces[j].Primary
+	})
+}
+
+// AvatarFace returns the face a user's avatar is made from: the primary
+// face, or else the face with the highest quality score
+func AvatarFace(faces []Face) (Face, bool) {
+	if len(faces) == 0 {
+		return Face{}, false
+	}
+
+	best := faces[0]
+	for _, f := range faces {
+		if f.Primary {
+			return f, true
+		}
+		if f.QualityScore > best.QualityScore {
+			best = f
+		}
+	}
+	return best, true
 }
 
-// TableName specifies the table name for Face
-func (Face) TableName() string {
-	return "faces"
+// TableName specifies the table name for Face, including any
+// configured schema and table prefix
+func (Face) TableName(namer schema.Namer) string {
+	return namer.TableName("faces")
 }
 
 // Validate checks if the Face struct has valid data
@@ -34,6 +73,9 @@ func (f *Face) Validate() error {
 	if f.QualityScore < 0 || f.QualityScore > 1 {
 		return errors.New("quality score must be between 0 and 1")
 	}
+	if len(f.Label) > MaxFaceLabelLength {
+		return ErrLabelTooLong
+	}
 	return nil
 }
 
@@ -44,4 +86,7 @@ type MatchResult struct {
 	FaceID     string
 	Confidence float64
 	Matched    bool
+	// Votes is how many of the faces closest to the probe are the user's,
+	// under the vote match strategy
+	Votes int
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// FaceImage is a face image stored in the database by the database storage
+// backend
+type FaceImage struct {
+	Filename  string    `gorm:"type:varchar(255);primaryKey"`
+	Data      []byte    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// TableName specifies the table name for FaceImage, including any
+// configured schema and table prefix
+func (FaceImage) TableName(namer schema.Namer) string {
+	return namer.TableName("face_images")
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// Identification is a face identified, or not, by 'face watch'. Seq
+// increases with every identification.
+type Identification struct {
+	Seq          int64     `gorm:"column:seq;primaryKey" json:"seq"`
+	IdentifiedAt time.Time `gorm:"not null" json:"identified_at"`
+	// Source is the camera device or stream the face was seen by
+	Source  string `gorm:"type:varchar(255);not null" json:"source"`
+	Matched bool   `gorm:"not null" json:"matched"`
+	// UserID is the identified user, empty if the face matched nobody
+	UserID     string  `gorm:"type:varchar(36);not null" json:"user_id,omitempty"`
+	Confidence float64 `gorm:"not null" json:"confidence,omitempty"`
+	Quality    float64 `gorm:"not null" json:"quality"`
+}
+
+// TableName specifies the table name for Identification, including any
+// configured schema and table prefix
+func (Identification) TableName(namer schema.Namer) string {
+	return namer.TableName("identifications")
+}
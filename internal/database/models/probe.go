@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// Probe is the face of an identification or verification saved with
+// --save-probe, so a contested decision can be reviewed later. The audit
+// event of the decision refers to it by ID.
+type Probe struct {
+	ID         string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	CapturedAt time.Time `gorm:"not null" json:"captured_at"`
+	// Operation is AuditIdentify or AuditVerify
+	Operation string `gorm:"type:varchar(32);not null" json:"operation"`
+	// UserID is the user identified, or verified against; empty if an
+	// identification matched nobody
+	UserID     string  `gorm:"type:varchar(36);not null" json:"user_id,omitempty"`
+	Matched    bool    `gorm:"not null" json:"matched"`
+	Confidence float64 `gorm:"not null" json:"confidence"`
+	Threshold  float64 `gorm:"not null" json:"threshold"`
+	Quality    float64 `gorm:"not null" json:"quality"`
+	// Embedding is the probe's embedding, encrypted like those of faces
+	Embedding Embedding `gorm:"type:text;not null;serializer:embedding" json:"embedding"`
+	// Filename is the stored crop of the probe's face
+	Filename  string `gorm:"type:varchar(255);not null" json:"filename"`
+	RequestID string `gorm:"type:varchar(128);not null" json:"request_id,omitempty"`
+}
+
+// TableName specifies the table name for Probe, including any configured
+// schema and table prefix
+func (Probe) TableName(namer schema.Namer) string {
+	return namer.TableName("probes")
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// Scope is an organization, a site of an organization or a device at a
+// site, for deployments with several sites under one database. Its path
+// names it and its ancestors, e.g. "acme/berlin/lobby-door": org, site and
+// device.
+type Scope struct {
+	Path string `gorm:"type:varchar(255);primaryKey" json:"path"`
+	// Name is what the scope is called, e.g. "Berlin office"; optional
+	Name      string    `gorm:"type:varchar(100);not null;default:''" json:"name,omitempty"`
+	CreatedAt time.Time `gorm:"not null" json:"created_at"`
+}
+
+// TableName specifies the table name for Scope, including any configured
+// schema and table prefix
+func (Scope) TableName(namer schema.Namer) string {
+	return namer.TableName("scopes")
+}
+
+// Kinds of scope, by the depth of their path
+const (
+	ScopeOrg    = "org"
+	ScopeSite   = "site"
+	ScopeDevice = "device"
+)
+
+// scopeKinds are the kinds of scope at each depth of a path
+var scopeKinds = []string{ScopeOrg, ScopeSite, ScopeDevice}
+
+// scopeSegment is a part of a scope path
+var scopeSegment = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ErrInvalidScope is returned for a scope path that is not of the form
+// org, org/site or org/site/device
+var ErrInvalidScope = errors.New("scope must be org, org/site or org/site/device, in lowercase letters, digits, - and _")
+
+// ValidateScopePath checks that path names an org, a site or a device
+func ValidateScopePath(path string) error {
+	segments := strings.Split(path, "/")
+	if len(segments) > len(scopeKinds) {
+		return fmt.Errorf("%w: %q", ErrInvalidScope, path)
+	}
+	for _, s := range segments {
+		if !scopeSegment.MatchString(s) {
+			return fmt.Errorf("%w: %q", ErrInvalidScope, path)
+		}
+	}
+	return nil
+}
+
+// Kind returns ScopeOrg, ScopeSite or ScopeDevice
+func (s *Scope) Kind() string {
+	return scopeKinds[strings.Count(s.Path, "/")]
+}
+
+// Parent returns the path of the org or site the scope belongs to, empty
+// for an org
+func (s *Scope) Parent() string {
+	i := strings.LastIndex(s.Path, "/")
+	if i < 0 {
+		return ""
+	}
+	return s.Path[:i]
+}
+
+// ScopeCovers reports whether scope is outer or lies within it
+func ScopeCovers(outer, scope string) bool {
+	return scope == outer || strings.HasPrefix(scope, outer+"/")
+}
+
+// Scopes are the scopes a user is assigned to, stored as a JSON array
+type Scopes []string
+
+// Scan implements sql.Scanner interface
+func (s *Scopes) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("invalid type for Scopes")
+	}
+
+	if len(bytes) == 0 {
+		*s = nil
+		return nil
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// Value implements driver.Valuer interface
+func (s Scopes) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s)
+	return string(data), err
+}
+
+// InScope reports whether the user can be identified in a scope: users
+// with no scope everywhere, others in the orgs, sites and devices within
+// their scopes and in those their scopes lie within. Every user is in the
+// empty scope.
+func (u *User) InScope(scope string) bool {
+	if scope == "" || len(u.Scopes) == 0 {
+		return true
+	}
+	for _, s := range u.Scopes {
+		if ScopeCovers(s, scope) || ScopeCovers(scope, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,24 +1,180 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+
+	"face/matching"
+
+	"gorm.io/gorm/schema"
+)
+
+// Limits for Settings.CropSize when it is enabled
+const (
+	MinCropSize = 32
+	MaxCropSize = 1024
+)
+
+// FaceLimitPolicy decides what happens when a face is added to a user who
+// already has MaxFacesPerUser faces
+type FaceLimitPolicy string
+
+const (
+	// FaceLimitReject fails with ErrMaxFacesReached
+	FaceLimitReject FaceLimitPolicy = "reject"
+	// FaceLimitEvictLowestQuality replaces the face with the lowest quality
+	FaceLimitEvictLowestQuality FaceLimitPolicy = "evict-lowest-quality"
+	// FaceLimitEvictOldest replaces the face enrolled first
+	FaceLimitEvictOldest FaceLimitPolicy = "evict-oldest"
+)
+
+// ParseFaceLimitPolicy parses a face limit policy; empty means FaceLimitReject
+func ParseFaceLimitPolicy(s string) (FaceLimitPolicy, error) {
+	switch p := FaceLimitPolicy(s); p {
+	case "":
+		return FaceLimitReject, nil
+	case FaceLimitReject, FaceLimitEvictLowestQuality, FaceLimitEvictOldest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown face limit policy %q (use reject, evict-lowest-quality or evict-oldest)", s)
+	}
+}
+
+// Evict picks the face to replace under the policy, or returns false if
+// the policy rejects new faces
+func (p FaceLimitPolicy) Evict(faces []Face) (Face, bool) {
+	var less func(a, b *Face) bool
+	switch p {
+	case FaceLimitEvictLowestQuality:
+		less = func(a, b *Face) bool { return a.QualityScore < b.QualityScore }
+	case FaceLimitEvictOldest:
+		less = func(a, b *Face) bool { return a.EnrolledAt.Before(b.EnrolledAt) }
+	default:
+		return Face{}, false
+	}
+
+	if len(faces) == 0 {
+		return Face{}, false
+	}
+	evict := 0
+	for i := 1; i < len(faces); i++ {
+		if less(&faces[i], &faces[evict]) {
+			evict = i
+		}
+	}
+	return faces[evict], true
+}
+
+// DuplicateNamePolicy decides whether a user can be enrolled with the name
+// of an existing user
+type DuplicateNamePolicy string
+
+const (
+	// DuplicateNameAllow enrolls the user
+	DuplicateNameAllow DuplicateNamePolicy = "allow"
+	// DuplicateNameWarn fails with ErrDuplicateName unless the enrollment
+	// is forced
+	DuplicateNameWarn DuplicateNamePolicy = "warn"
+	// DuplicateNameReject fails with ErrDuplicateName
+	DuplicateNameReject DuplicateNamePolicy = "reject"
+)
+
+// ParseDuplicateNamePolicy parses a duplicate name policy; empty means
+// DuplicateNameAllow
+func ParseDuplicateNamePolicy(s string) (DuplicateNamePolicy, error) {
+	switch p := DuplicateNamePolicy(s); p {
+	case "":
+		return DuplicateNameAllow, nil
+	case DuplicateNameAllow, DuplicateNameWarn, DuplicateNameReject:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate name policy %q (use allow, warn or reject)", s)
+	}
+}
+
+// Admits reports whether the policy enrolls a user whose name is taken,
+// with or without the enrollment being forced
+func (p DuplicateNamePolicy) Admits(force bool) bool {
+	switch p {
+	case DuplicateNameWarn:
+		return force
+	case DuplicateNameReject:
+		return false
+	default:
+		return true
+	}
+}
+
 // Settings stores global configuration
 type Settings struct {
 	ID                 int     `gorm:"primaryKey" json:"id"`
 	MatchThreshold     float64 `gorm:"type:real;not null;default:0.6" json:"match_threshold"`
 	MaxFacesPerUser    int     `gorm:"not null;default:10" json:"max_faces_per_user"`
 	EmbeddingDimension int     `gorm:"not null;default:128" json:"embedding_dimension"`
+	// EmbeddingModel is the model the gallery's embeddings were computed
+	// with, see config.Config.Embedding; empty until first recorded
+	EmbeddingModel string `gorm:"type:varchar(64);not null;default:''" json:"embedding_model,omitempty"`
+	// CropSize is the width and height every face crop is resized to before
+	// it is saved and embedded; 0 keeps the detector's native crop size
+	CropSize int `gorm:"not null;default:0" json:"crop_size"`
+	// FaceLimitPolicy applies when a user has MaxFacesPerUser faces
+	FaceLimitPolicy FaceLimitPolicy `gorm:"type:varchar(32);not null;default:reject" json:"face_limit_policy"`
+	// DuplicateNamePolicy applies when a user is enrolled with a name
+	// another user has
+	DuplicateNamePolicy DuplicateNamePolicy `gorm:"type:varchar(16);not null;default:allow" json:"duplicate_name_policy"`
+	// MatchStrategy is how a user's faces are combined into their
+	// similarity to a probe, unless the config overrides it
+	MatchStrategy matching.Strategy `gorm:"type:varchar(16);not null;default:best" json:"match_strategy"`
 }
 
-// TableName specifies the table name for Settings
-func (Settings) TableName() string {
-	return "settings"
+// TableName specifies the table name for Settings, including any
+// configured schema and table prefix
+func (Settings) TableName(namer schema.Namer) string {
+	return namer.TableName("settings")
 }
 
 // DefaultSettings returns default settings
 func DefaultSettings() *Settings {
 	return &Settings{
-		ID:                 1,
-		MatchThreshold:     0.6,
-		MaxFacesPerUser:    10,
-		EmbeddingDimension: 128,
+		ID:                  1,
+		MatchThreshold:      0.6,
+		MaxFacesPerUser:     10,
+		EmbeddingDimension:  128,
+		FaceLimitPolicy:     FaceLimitReject,
+		DuplicateNamePolicy: DuplicateNameAllow,
+		MatchStrategy:       matching.StrategyBest,
+	}
+}
+
+// CheckEmbedding returns ErrDimensionMismatch if the gallery's embedding
+// model is recorded and the embedding does not have its dimension
+func (s *Settings) CheckEmbedding(embedding Embedding) error {
+	if s.EmbeddingModel == "" || s.EmbeddingDimension <= 0 || len(embedding) == s.EmbeddingDimension {
+		return nil
+	}
+	return fmt.Errorf("%w: the embedding is %d-d, the gallery holds %d-d embeddings of %s",
+		ErrDimensionMismatch, len(embedding), s.EmbeddingDimension, s.EmbeddingModel)
+}
+
+// Validate checks if the Settings struct has valid data
+func (s *Settings) Validate() error {
+	if s.MatchThreshold < 0 || s.MatchThreshold > 1 {
+		return errors.New("match threshold must be between 0 and 1")
+	}
+	if s.MaxFacesPerUser < 1 {
+		return errors.New("max faces per user must be at least 1")
+	}
+	if s.CropSize != 0 && (s.CropSize < MinCropSize || s.CropSize > MaxCropSize) {
+		return fmt.Errorf("crop size must be 0 (disabled) or between %d and %d", MinCropSize, MaxCropSize)
+	}
+	if _, err := ParseFaceLimitPolicy(string(s.FaceLimitPolicy)); err != nil {
+		return err
+	}
+	if _, err := ParseDuplicateNamePolicy(string(s.DuplicateNamePolicy)); err != nil {
+		return err
+	}
+	if _, err := matching.ParseStrategy(string(s.MatchStrategy)); err != nil {
+		return err
 	}
+	return nil
 }
@@ -2,24 +2,72 @@ package models
 
 import (
 	"errors"
+	"strings"
 	"time"
+
+	"gorm.io/gorm/schema"
 )
 
 // User represents a registered user in the system
 type User struct {
-	ID        string    `gorm:"type:varchar(36);primaryKey" json:"id"`
-	Name      string    `gorm:"type:varchar(100);not null" json:"name"`
-	Email     string    `gorm:"type:varchar(255)" json:"email,omitempty"`
-	Phone     string    `gorm:"type:varchar(50)" json:"phone,omitempty"`
-	Metadata  Metadata  `gorm:"type:text" json:"metadata,omitempty"`
-	Faces     []Face    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"faces"`
-	CreatedAt time.Time `gorm:"not null" json:"created_at"`
-	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
+	ID       string   `gorm:"type:varchar(36);primaryKey" json:"id"`
+	Name     string   `gorm:"type:varchar(100);not null" json:"name"`
+	Email    string   `gorm:"type:varchar(255)" json:"email,omitempty"`
+	Phone    string   `gorm:"type:varchar(50)" json:"phone,omitempty"`
+	Metadata Metadata `gorm:"type:text" json:"metadata,omitempty"`
+	Faces    []Face   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"faces"`
+	// Avatar is the stored image of the user's avatar, empty if none has
+	// been generated
+	Avatar string `gorm:"type:varchar(255);not null;default:''" json:"avatar,omitempty"`
+	// Scopes are the orgs, sites and devices the user can be identified
+	// at, see InScope; everywhere if none
+	Scopes Scopes `gorm:"type:text;not null;default:'[]'" json:"scopes,omitempty"`
+	// CardNumber is the number of the user's access card, sent to door
+	// controllers on a match
+	CardNumber string `gorm:"type:varchar(20);not null;default:''" json:"card_number,omitempty"`
+	// Badge is the user's badge or employee ID as printed on their card
+	Badge string `gorm:"type:varchar(64);not null;default:''" json:"badge,omitempty"`
+	// ExpiresAt is set for visitors enrolled with 'face enroll --temporary'.
+	// Once it has passed, the user is no longer matched and is purged by
+	// 'face prune'.
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	// PINHash and TOTPSecret are the user's second factors for step-up
+	// verification, empty if not set up. They are stored with the user,
+	// encrypted like embeddings, but never shown, see ClearSecrets.
+	PINHash    string     `gorm:"type:varchar(255);not null;default:'';serializer:secret" json:"pin_hash,omitempty"`
+	TOTPSecret string     `gorm:"type:varchar(255);not null;default:'';serializer:secret" json:"totp_secret,omitempty"`
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
+	UpdatedAt  time.Time  `gorm:"not null" json:"updated_at"`
+	DeletedAt  *time.Time `gorm:"index" json:"deleted_at,omitempty"` // set while a deletion is in progress
+}
+
+// Limits of User.CardNumber and User.Badge
+const (
+	MaxCardNumberLength = 20
+	MaxBadgeLength      = 64
+)
+
+// IsVisitor reports whether the user was enrolled as a temporary visitor
+func (u *User) IsVisitor() bool {
+	return u.ExpiresAt != nil
 }
 
-// TableName specifies the table name for User
-func (User) TableName() string {
-	return "users"
+// Expired reports whether the user is a visitor whose access has expired
+func (u *User) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// ClearSecrets removes the second factor secrets from a user about to be
+// printed or sent elsewhere
+func (u *User) ClearSecrets() {
+	u.PINHash = ""
+	u.TOTPSecret = ""
+}
+
+// TableName specifies the table name for User, including any
+// configured schema and table prefix
+func (User) TableName(namer schema.Namer) string {
+	return namer.TableName("users")
 }
 
 // Validate checks if the User struct has valid data
@@ -33,5 +81,11 @@ func (u *User) Validate() error {
 	if len(u.Name) > 100 {
 		return errors.New("name exceeds maximum length of 100 characters")
 	}
+	if len(u.CardNumber) > MaxCardNumberLength || strings.Trim(u.CardNumber, "0123456789") != "" {
+		return ErrInvalidCardNumber
+	}
+	if len(u.Badge) > MaxBadgeLength {
+		return errors.New("badge exceeds maximum length of 64 characters")
+	}
 	return nil
 }
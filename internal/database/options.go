@@ -0,0 +1,120 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"face/internal/encryption"
+
+	"gorm.io/gorm/schema"
+)
+
+// identifierPattern restricts schema names and prefixes to plain SQL identifiers
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// tenantPattern restricts tenant names to short, printable identifiers
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Options holds optional settings shared by the database backends
+type Options struct {
+	// Schema places all tables in a PostgreSQL schema (ignored by SQLite)
+	Schema string
+	// TablePrefix is prepended to every table and index name
+	TablePrefix string
+	// Tenant limits every operation to the rows of one tenant once
+	// row-level security is installed (PostgreSQL only)
+	Tenant string
+	// Roles runs each operation as the reader, writer or admin role
+	// installed by InstallRoles (PostgreSQL only)
+	Roles bool
+	// PGVector searches embeddings in SQL with the pgvector extension; the
+	// migrations then add a vector column (PostgreSQL only)
+	PGVector bool
+	// SQLiteDriver selects SQLiteDriverCGO or SQLiteDriverPureGo, empty for
+	// the build's default (SQLite only)
+	SQLiteDriver string
+	// EncryptionKey encrypts the embeddings of faces and the second factor
+	// secrets of users as they are written and decrypts them as they are
+	// read (every backend). Values written without a key are only read if
+	// the key allows plaintext.
+	EncryptionKey *encryption.Key
+}
+
+// SQLite drivers selectable with Options.SQLiteDriver
+const (
+	// SQLiteDriverCGO is github.com/mattn/go-sqlite3, which needs CGO
+	SQLiteDriverCGO = "cgo"
+	// SQLiteDriverPureGo is modernc.org/sqlite, which does not
+	SQLiteDriverPureGo = "purego"
+)
+
+// Validate checks that schema and prefix are safe SQL identifiers
+func (o Options) Validate() error {
+	if o.Schema != "" && !identifierPattern.MatchString(o.Schema) {
+		return fmt.Errorf("invalid schema name %q", o.Schema)
+	}
+	if o.TablePrefix != "" && !identifierPattern.MatchString(o.TablePrefix) {
+		return fmt.Errorf("invalid table prefix %q", o.TablePrefix)
+	}
+	if o.Tenant != "" && !tenantPattern.MatchString(o.Tenant) {
+		return fmt.Errorf("invalid tenant %q", o.Tenant)
+	}
+	if o.PGVector && o.EncryptionKey != nil {
+		return errors.New("encrypted embeddings cannot be searched with pgvector, disable one of them")
+	}
+	switch o.SQLiteDriver {
+	case "", SQLiteDriverCGO, SQLiteDriverPureGo:
+	default:
+		return fmt.Errorf("unknown sqlite driver %q (use cgo or purego)", o.SQLiteDriver)
+	}
+	return nil
+}
+
+// forType drops settings that the given backend does not support
+func (o Options) forType(dbType DatabaseType) Options {
+	if dbType != DatabaseTypePostgres {
+		o.Schema = ""
+		o.Tenant = ""
+		o.Roles = false
+		o.PGVector = false
+	}
+	if dbType != DatabaseTypeSQLite {
+		o.SQLiteDriver = ""
+	}
+	return o
+}
+
+// SQLiteDriverInUse returns the SQLite driver the options select,
+// SQLiteDriverCGO or SQLiteDriverPureGo
+func (o Options) SQLiteDriverInUse() string {
+	if o.SQLiteDriver == "" {
+		return defaultSQLiteDriver
+	}
+	return o.SQLiteDriver
+}
+
+// sqliteDriverName returns the database/sql name of the selected SQLite
+// driver
+func (o Options) sqliteDriverName() string {
+	if o.SQLiteDriverInUse() == SQLiteDriverPureGo {
+		return "sqlite"
+	}
+	return "sqlite3"
+}
+
+// qualifier returns the schema-qualified prefix for table names
+func (o Options) qualifier() string {
+	if o.Schema != "" {
+		return o.Schema + "." + o.TablePrefix
+	}
+	return o.TablePrefix
+}
+
+// namingStrategy returns the GORM naming strategy applying schema and prefix
+func (o Options) namingStrategy() schema.NamingStrategy {
+	return schema.NamingStrategy{
+		TablePrefix:   o.qualifier(),
+		SingularTable: true,
+	}
+}
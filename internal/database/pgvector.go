@@ -0,0 +1,97 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"face/internal/database/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// VectorDimension is the dimension of the pgvector embedding column.
+// Embeddings of other dimensions are left out of vector searches.
+const VectorDimension = 128
+
+// vectorColumn is the pgvector copy of faces.embedding, kept in sync by a
+// trigger so the JSON text column stays the source of truth
+const vectorColumn = "embedding_vector"
+
+// VectorSearcher is implemented by the databases that can search
+// embeddings themselves: PostgreSQL with pgvector enabled
+type VectorSearcher interface {
+	// VectorSearch reports whether NearestFaces is available
+	VectorSearch() bool
+	// NearestFaces returns up to k faces of active users most similar to
+	// the embedding, most similar first
+	NearestFaces(embedding []float32, k int) ([]FaceSimilarity, error)
+}
+
+// FaceSimilarity is a face found by a vector search
+type FaceSimilarity struct {
+	FaceID     string
+	UserID     string
+	Similarity float64
+}
+
+// ErrVectorSearchUnsupported is returned by databases without vector search
+var ErrVectorSearchUnsupported = errors.New("vector search needs the postgres database with pgvector enabled")
+
+// checkVectorColumn fails if pgvector is enabled before its migration has
+// been applied
+func (g *GormDatabase) checkVectorColumn() error {
+	if !g.reader.Migrator().HasColumn(&models.Face{}, vectorColumn) {
+		return fmt.Errorf("pgvector is enabled but the faces table has no %s column: apply migration 11 with pgvector enabled", vectorColumn)
+	}
+	return nil
+}
+
+// VectorSearch reports whether the database searches embeddings with pgvector
+func (g *GormDatabase) VectorSearch() bool {
+	return g.vectors
+}
+
+// NearestFaces searches the faces by cosine distance in SQL, using the
+// HNSW index of the vector column
+func (g *GormDatabase) NearestFaces(embedding []float32, k int) ([]FaceSimilarity, error) {
+	if !g.vectors {
+		return nil, ErrVectorSearchUnsupported
+	}
+	if len(embedding) != VectorDimension {
+		return nil, fmt.Errorf("embedding has %d dimensions, the vector column %d", len(embedding), VectorDimension)
+	}
+
+	vec := vectorLiteral(embedding)
+	distance := clause.Expr{SQL: vectorColumn + " <=> ?::vector", Vars: []interface{}{vec}}
+	activeUsers := g.reader.Model(&models.User{}).Select("id").
+		Where("deleted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+
+	var found []FaceSimilarity
+	result := g.reader.Model(&models.Face{}).
+		Select("id AS face_id, user_id, 1 - ("+vectorColumn+" <=> ?::vector) AS similarity", vec).
+		Where(vectorColumn+" IS NOT NULL AND user_id IN (?)", activeUsers).
+		Order(clause.OrderBy{Expression: distance}).
+		Limit(k).
+		Scan(&found)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %w", result.Error)
+	}
+	return found, nil
+}
+
+// vectorLiteral formats an embedding as pgvector's text input, e.g. [1,-0.5]
+func vectorLiteral(embedding []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range embedding {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"face/internal/database/models"
+)
+
+// MinIDPrefix is the shortest ID prefix accepted in place of a full ID.
+// Shorter prefixes only match IDs exactly.
+const MinIDPrefix = 4
+
+// maxAmbiguousMatches is how many matching IDs an AmbiguousIDError lists
+const maxAmbiguousMatches = 5
+
+// AmbiguousIDError is returned when an ID prefix matches several IDs
+type AmbiguousIDError struct {
+	Prefix string
+	// Matches holds some of the matching IDs
+	Matches []string
+}
+
+func (e *AmbiguousIDError) Error() string {
+	return fmt.Sprintf("ID prefix %q is ambiguous, it matches %s; type more characters",
+		e.Prefix, strings.Join(e.Matches, ", "))
+}
+
+// UserIDPrefixer is implemented by the databases that can look up user IDs
+// by prefix without loading every user
+type UserIDPrefixer interface {
+	// UserIDsWithPrefix returns up to limit IDs of users not pending
+	// deletion that start with prefix
+	UserIDsWithPrefix(prefix string, limit int) ([]string, error)
+}
+
+// MatchIDPrefix returns the one of ids that equals id or, if none does,
+// starts with it, like git accepts short commit hashes. It returns an empty
+// string if nothing matches and an AmbiguousIDError if several IDs do.
+func MatchIDPrefix(id string, ids []string) (string, error) {
+	var matches []string
+	for _, candidate := range ids {
+		if candidate == id {
+			return id, nil
+		}
+		if len(id) >= MinIDPrefix && strings.HasPrefix(candidate, strings.ToLower(id)) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", nil
+	case 1:
+		return matches[0], nil
+	}
+	if len(matches) > maxAmbiguousMatches {
+		matches = matches[:maxAmbiguousMatches]
+	}
+	return "", &AmbiguousIDError{Prefix: id, Matches: matches}
+}
+
+// GetUserByIDPrefix returns the user whose ID is id or starts with it
+func GetUserByIDPrefix(db Database, id string) (*models.User, error) {
+	user, err := db.GetUser(id)
+	if err == nil || !errors.Is(err, models.ErrUserNotFound) || len(id) < MinIDPrefix {
+		return user, err
+	}
+
+	var ids []string
+	if prefixer, ok := db.(UserIDPrefixer); ok {
+		ids, err = prefixer.UserIDsWithPrefix(strings.ToLower(id), maxAmbiguousMatches+1)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		users, err := db.ListUsers()
+		if err != nil {
+			return nil, err
+		}
+		for i := range users {
+			ids = append(ids, users[i].ID)
+		}
+	}
+
+	match, err := MatchIDPrefix(id, ids)
+	if err != nil {
+		return nil, err
+	}
+	if match == "" {
+		return nil, models.ErrUserNotFound
+	}
+	return db.GetUser(match)
+}
+
+// UserIDsWithPrefix returns up to limit IDs of active users starting with
+// prefix
+func (g *GormDatabase) UserIDsWithPrefix(prefix string, limit int) ([]string, error) {
+	// Only characters of UUIDs, so the prefix cannot contain LIKE wildcards
+	if strings.Trim(prefix, "0123456789abcdef-") != "" {
+		return nil, nil
+	}
+
+	var ids []string
+	result := g.reader.Model(&models.User{}).
+		Where("deleted_at IS NULL AND id LIKE ?", prefix+"%").
+		Order("id").Limit(limit).Pluck("id", &ids)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to look up user IDs: %w", result.Error)
+	}
+	return ids, nil
+}
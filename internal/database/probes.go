@@ -0,0 +1,86 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"face/internal/database/models"
+
+	"gorm.io/gorm"
+)
+
+// ProbeStore is implemented by the databases that keep the probes saved by
+// 'face identify --save-probe' and 'face verify --save-probe'
+type ProbeStore interface {
+	SaveProbe(probe *models.Probe) error
+	// GetProbe returns models.ErrProbeNotFound if there is no such probe
+	GetProbe(id string) (*models.Probe, error)
+	// DeleteProbes deletes the probes matching a filter and returns them,
+	// so their images can be deleted too
+	DeleteProbes(filter ProbeFilter) ([]models.Probe, error)
+}
+
+// ProbeFilter selects the probes to delete: those captured before a time,
+// or of a user. A zero filter selects none.
+type ProbeFilter struct {
+	Before time.Time
+	UserID string
+}
+
+// ErrProbeStoreUnsupported is returned by databases that cannot keep
+// probes
+var ErrProbeStoreUnsupported = errors.New("saving probes needs the sqlite or postgres database")
+
+// SaveProbe records a probe
+func (g *GormDatabase) SaveProbe(probe *models.Probe) error {
+	if err := g.db.Create(probe).Error; err != nil {
+		return fmt.Errorf("failed to save probe: %w", err)
+	}
+	return nil
+}
+
+// GetProbe returns a probe by ID
+func (g *GormDatabase) GetProbe(id string) (*models.Probe, error) {
+	var probe models.Probe
+	if err := g.reader.First(&probe, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.ErrProbeNotFound
+		}
+		return nil, fmt.Errorf("failed to read probe: %w", err)
+	}
+	return &probe, nil
+}
+
+// DeleteProbes deletes the probes matching a filter and returns them
+func (g *GormDatabase) DeleteProbes(filter ProbeFilter) ([]models.Probe, error) {
+	if filter.Before.IsZero() && filter.UserID == "" {
+		return nil, nil
+	}
+
+	var probes []models.Probe
+	err := g.admin.Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if !filter.Before.IsZero() {
+			query = query.Where("captured_at < ?", filter.Before)
+		}
+		if filter.UserID != "" {
+			query = query.Where("user_id = ?", filter.UserID)
+		}
+		if err := query.Find(&probes).Error; err != nil {
+			return err
+		}
+		if len(probes) == 0 {
+			return nil
+		}
+		ids := make([]string, len(probes))
+		for i := range probes {
+			ids[i] = probes[i].ID
+		}
+		return tx.Delete(&models.Probe{}, "id IN ?", ids).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete probes: %w", err)
+	}
+	return probes, nil
+}
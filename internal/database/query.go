@@ -0,0 +1,215 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+// Query is a predefined, read-only report. Its SQL is a template like the
+// migrations, so {{.Table "faces"}} expands to the configured table name,
+// and it takes parameters as named arguments (@department).
+type Query struct {
+	Description string   `json:"description,omitempty"`
+	SQL         string   `json:"sql"`
+	Params      []string `json:"params,omitempty"`
+	// Counts are the columns holding counts, which get differential-privacy
+	// noise when the report is run with an epsilon
+	Counts []string `json:"counts,omitempty"`
+	// Epsilon always adds noise to the counts with this privacy budget,
+	// for reports meant to be shared
+	Epsilon float64 `json:"epsilon,omitempty"`
+	// Sensitivity is the most one person can change a count,
+	// privacy.DefaultSensitivity if 0
+	Sensitivity int64 `json:"sensitivity,omitempty"`
+}
+
+// QueryResult holds the rows of a query rendered as strings
+type QueryResult struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// Querier is implemented by the databases that can run queries
+type Querier interface {
+	RunQuery(q Query, params map[string]string) (*QueryResult, error)
+}
+
+// ErrNotReadOnly is returned for queries that are not a single SELECT
+var ErrNotReadOnly = errors.New("only single SELECT queries are allowed")
+
+// ErrQueriesUnsupported is returned by databases that cannot run queries
+var ErrQueriesUnsupported = errors.New("queries need the sqlite or postgres database")
+
+// readOnlyPattern matches statements that start like a read-only query
+var readOnlyPattern = regexp.MustCompile(`(?is)^\s*(select|with)\b`)
+
+// BuiltinQueries are available even when the config file defines none
+func BuiltinQueries() map[string]Query {
+	return map[string]Query{
+		"faces_per_user": {
+			Description: "Number of enrolled faces per user",
+			SQL: `SELECT u.name, u.id, COUNT(f.id) AS faces
+FROM {{.Table "users"}} u LEFT JOIN {{.Table "faces"}} f ON f.user_id = u.id
+WHERE u.deleted_at IS NULL
+GROUP BY u.id, u.name
+ORDER BY faces DESC, u.name`,
+		},
+		"low_quality_faces": {
+			Description: "Faces with a quality score below max_quality",
+			SQL: `SELECT u.name, f.id AS face_id, f.quality_score
+FROM {{.Table "faces"}} f JOIN {{.Table "users"}} u ON u.id = f.user_id
+WHERE u.deleted_at IS NULL AND f.quality_score < @max_quality
+ORDER BY f.quality_score`,
+			Params: []string{"max_quality"},
+		},
+		"identifications": {
+			Description: "Faces identified by 'face watch' since a time, e.g. 2026-01-31",
+			SQL: `SELECT i.identified_at, i.source, i.matched, u.name, i.user_id, i.confidence, i.quality
+FROM {{.Table "identifications"}} i LEFT JOIN {{.Table "users"}} u ON u.id = i.user_id AND i.matched
+WHERE i.identified_at >= @since
+ORDER BY i.identified_at`,
+			Params: []string{"since"},
+		},
+	}
+}
+
+// CheckParams verifies that params supplies exactly the parameters the
+// query declares
+func (q Query) CheckParams(params map[string]string) error {
+	declared := make(map[string]bool, len(q.Params))
+	var missing []string
+	for _, name := range q.Params {
+		declared[name] = true
+		if _, ok := params[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing query parameter(s): %s", strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown query parameter(s): %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// RunQuery runs a predefined query in a read-only transaction
+func (g *GormDatabase) RunQuery(q Query, params map[string]string) (*QueryResult, error) {
+	if err := q.CheckParams(params); err != nil {
+		return nil, err
+	}
+
+	statement, err := g.renderQuery(q.SQL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Named arguments are passed as one map, which must be left out when
+	// there are none
+	var args []interface{}
+	if len(params) > 0 {
+		named := make(map[string]interface{}, len(params))
+		for name, value := range params {
+			named[name] = value
+		}
+		args = append(args, named)
+	}
+
+	var result *QueryResult
+	err = g.reader.Transaction(func(tx *gorm.DB) error {
+		if g.dbType == DatabaseTypeSQLite {
+			// SQLite ignores read-only transactions, so enforce it on the
+			// connection for the duration of the query
+			if err := tx.Exec("PRAGMA query_only = ON").Error; err != nil {
+				return err
+			}
+			defer tx.Exec("PRAGMA query_only = OFF")
+		}
+
+		rows, err := tx.Raw(statement, args...).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		result, err = scanRows(rows)
+		return err
+	}, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return result, nil
+}
+
+// renderQuery expands the table names in a query template and makes sure
+// the result is a single read-only statement
+func (g *GormDatabase) renderQuery(text string) (string, error) {
+	tmpl, err := template.New("query").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %w", err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, queryTables{g.reader.NamingStrategy}); err != nil {
+		return "", fmt.Errorf("failed to render query: %w", err)
+	}
+
+	statement := strings.TrimRight(strings.TrimSpace(rendered.String()), ";")
+	if !readOnlyPattern.MatchString(statement) || strings.Contains(statement, ";") {
+		return "", ErrNotReadOnly
+	}
+	return statement, nil
+}
+
+// queryTables is the template data of queries
+type queryTables struct {
+	namer interface{ TableName(string) string }
+}
+
+// Table returns the schema-qualified, prefixed name of a table
+func (t queryTables) Table(name string) string {
+	return t.namer.TableName(name)
+}
+
+func scanRows(rows *sql.Rows) (*QueryResult, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Columns: columns, Rows: [][]string{}}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
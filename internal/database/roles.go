@@ -0,0 +1,129 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"text/template"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+//go:embed security/*.sql
+var securityFS embed.FS
+
+// Least-privilege PostgreSQL roles installed by InstallRoles
+const (
+	RoleReader = "face_reader"
+	RoleWriter = "face_writer"
+	RoleAdmin  = "face_admin"
+)
+
+// TenantSetting is the PostgreSQL setting holding the tenant of a
+// connection, which the row-level security policies compare rows against
+const TenantSetting = "face.tenant"
+
+// ErrTenantWithoutRoles is returned for a tenant set without the roles,
+// whose connection would not be bound to the tenant's rows
+var ErrTenantWithoutRoles = errors.New("tenant needs database_roles: without the least-privilege roles the connection is not limited to the tenant's rows")
+
+// openPostgres opens a connection pool, running as role and scoped to the
+// configured tenant when they are set
+func openPostgres(dsn string, opts Options, role string) (*gorm.DB, error) {
+	dialector := postgres.Open(dsn)
+	if role != "" || opts.Tenant != "" {
+		pgxConfig, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid postgres connection string: %w", err)
+		}
+		if role != "" {
+			pgxConfig.RuntimeParams["role"] = role
+		}
+		if opts.Tenant != "" {
+			pgxConfig.RuntimeParams[TenantSetting] = opts.Tenant
+		}
+		dialector = postgres.New(postgres.Config{Conn: stdlib.OpenDB(*pgxConfig)})
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:         logger.Default.LogMode(logger.Silent),
+		NamingStrategy: opts.namingStrategy(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres database: %w", err)
+	}
+	return withEncryptionKey(db, opts.EncryptionKey), nil
+}
+
+// rolesTemplate is the template data of the role installation script
+type rolesTemplate struct {
+	templateFS
+	Reader, Writer, Admin string
+	// Login is the role the application connects as
+	Login  string
+	Schema string
+}
+
+// CurrentTenant is the SQL expression for the tenant of the connection
+func (rolesTemplate) CurrentTenant() string {
+	return fmt.Sprintf("COALESCE(current_setting('%s', true), '')", TenantSetting)
+}
+
+// InstallRoles creates the reader, writer and admin roles, grants them to
+// login and enables per-tenant row-level security on the user and face
+// tables. It must run as a role that owns the tables, after migrations.
+func InstallRoles(connectionString string, opts Options, login string) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if !identifierPattern.MatchString(login) {
+		return fmt.Errorf("invalid role name %q", login)
+	}
+	opts = opts.forType(DatabaseTypePostgres)
+
+	raw, err := securityFS.ReadFile("security/postgres_roles.sql")
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("roles").Parse(string(raw))
+	if err != nil {
+		return fmt.Errorf("invalid roles template: %w", err)
+	}
+
+	var script bytes.Buffer
+	data := rolesTemplate{
+		templateFS: templateFS{opts: opts, dbType: DatabaseTypePostgres},
+		Reader:     RoleReader,
+		Writer:     RoleWriter,
+		Admin:      RoleAdmin,
+		Login:      login,
+		Schema:     opts.Schema,
+	}
+	if err := tmpl.Execute(&script, data); err != nil {
+		return fmt.Errorf("failed to render roles script: %w", err)
+	}
+
+	u, err := url.Parse(buildDatabaseURL(DatabaseTypePostgres, connectionString, opts))
+	if err != nil {
+		return fmt.Errorf("invalid database URL: %w", err)
+	}
+
+	db, err := sql.Open("postgres", migrate.FilterCustomQuery(u).String())
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(script.String()); err != nil {
+		return fmt.Errorf("failed to install roles: %w", err)
+	}
+	return nil
+}
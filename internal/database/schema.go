@@ -0,0 +1,110 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+)
+
+// ErrSchemaMismatch is matched by errors.Is for any SchemaError
+var ErrSchemaMismatch = errors.New("database schema does not match this binary")
+
+// SchemaError reports a database whose schema is not the one this binary
+// was built for, so commands fail up front instead of part way through
+type SchemaError struct {
+	// Version is the applied migration, 0 if none has been
+	Version uint
+	// Dirty is set when migration Version failed part way
+	Dirty bool
+	// Required is the newest migration of the binary
+	Required uint
+}
+
+// Error implements the error interface
+func (e *SchemaError) Error() string {
+	switch {
+	case e.Dirty:
+		return fmt.Sprintf("database schema migration %d did not complete", e.Version)
+	case e.Version > e.Required:
+		return fmt.Sprintf("database schema version %d is newer than this binary supports (%d)", e.Version, e.Required)
+	case e.Version == 0:
+		return fmt.Sprintf("database has no schema yet (this binary needs version %d)", e.Required)
+	default:
+		return fmt.Sprintf("database schema is at version %d, this binary needs version %d", e.Version, e.Required)
+	}
+}
+
+// Unwrap allows errors.Is(err, ErrSchemaMismatch)
+func (e *SchemaError) Unwrap() error {
+	return ErrSchemaMismatch
+}
+
+// Upgradable reports whether applying the pending migrations resolves the
+// mismatch
+func (e *SchemaError) Upgradable() bool {
+	return !e.Dirty && e.Version < e.Required
+}
+
+// Remediation describes how to bring the database and the binary together
+func (e *SchemaError) Remediation() string {
+	var b strings.Builder
+	switch {
+	case e.Dirty:
+		fmt.Fprintf(&b, "Migration %d stopped part way, leaving the schema in between versions.\n", e.Version)
+		b.WriteString("Restore a backup taken before migrating, or undo the migration by hand and\n")
+		b.WriteString("record the version the schema is back at, then migrate again:\n")
+		fmt.Fprintf(&b, "  face migrate force %d\n", previousVersion(e.Version))
+		b.WriteString("  face migrate up\n")
+	case e.Version > e.Required:
+		b.WriteString("The database was migrated by a newer release of face. Run that release,\n")
+		b.WriteString("or roll the schema back with it before downgrading:\n")
+		fmt.Fprintf(&b, "  face migrate down --steps %d\n", e.Version-e.Required)
+	case e.Version == 0:
+		b.WriteString("Create the schema:\n")
+		b.WriteString("  face migrate up\n")
+		b.WriteString("or run the command with --auto-migrate (FACE_CLI_AUTO_MIGRATE=true) to create it first.\n")
+	default:
+		b.WriteString("Back up the database, then apply the pending migrations:\n")
+		b.WriteString("  face migrate up\n")
+		b.WriteString("or run the command with --auto-migrate (FACE_CLI_AUTO_MIGRATE=true) to migrate first.\n")
+	}
+	return b.String()
+}
+
+// previousVersion returns the migration before version, -1 for none as
+// 'face migrate force' takes it
+func previousVersion(version uint) int {
+	if version <= 1 {
+		return -1
+	}
+	return int(version) - 1
+}
+
+// CheckSchema returns a *SchemaError unless the database is at the newest
+// migration of the binary
+func (m *Migrator) CheckSchema() error {
+	required, err := LatestMigration()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := m.migrate.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if dirty || version != required {
+		return &SchemaError{Version: version, Dirty: dirty, Required: required}
+	}
+	return nil
+}
+
+// Force records version as the applied migration without running any,
+// after a failed migration has been repaired by hand
+func (m *Migrator) Force(version int) error {
+	if err := m.migrate.Force(version); err != nil {
+		return fmt.Errorf("failed to force version: %w", err)
+	}
+	return nil
+}
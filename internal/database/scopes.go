@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"face/internal/database/models"
+
+	"gorm.io/gorm"
+)
+
+// ScopeStore is implemented by the databases that keep the orgs, sites and
+// devices of a deployment with several sites, see models.Scope
+type ScopeStore interface {
+	// CreateScope adds an org, or a site or device of an existing org or
+	// site. It returns models.ErrScopeExists if the path is taken.
+	CreateScope(scope *models.Scope) error
+	// ListScopes returns every scope, ordered by path so each comes right
+	// after the org or site it belongs to
+	ListScopes() ([]models.Scope, error)
+	// DeleteScope deletes a scope, or returns models.ErrScopeInUse if it
+	// has sites or devices or users are assigned to it
+	DeleteScope(path string) error
+	// SetUserScopes assigns a user to existing scopes, replacing their
+	// scopes; none lets them be identified everywhere
+	SetUserScopes(userID string, scopes []string) error
+}
+
+// ErrScopeStoreUnsupported is returned by databases that cannot keep
+// scopes
+var ErrScopeStoreUnsupported = errors.New("orgs, sites and devices need the sqlite or postgres database")
+
+// CreateScope adds a scope
+func (g *GormDatabase) CreateScope(scope *models.Scope) error {
+	if err := models.ValidateScopePath(scope.Path); err != nil {
+		return err
+	}
+	if scope.CreatedAt.IsZero() {
+		scope.CreatedAt = time.Now()
+	}
+
+	return g.admin.Transaction(func(tx *gorm.DB) error {
+		if parent := scope.Parent(); parent != "" {
+			if err := scopesExist(tx, []string{parent}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(scope).Error; err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "duplicate") {
+				return fmt.Errorf("%w: %s", models.ErrScopeExists, scope.Path)
+			}
+			return fmt.Errorf("failed to create scope: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListScopes returns every scope by path
+func (g *GormDatabase) ListScopes() ([]models.Scope, error) {
+	var scopes []models.Scope
+	if err := g.reader.Order("path").Find(&scopes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list scopes: %w", err)
+	}
+	return scopes, nil
+}
+
+// DeleteScope deletes a scope that has no sites, devices or users
+func (g *GormDatabase) DeleteScope(path string) error {
+	return g.admin.Transaction(func(tx *gorm.DB) error {
+		if err := scopesExist(tx, []string{path}); err != nil {
+			return err
+		}
+
+		// _ in a path matches any character in LIKE, so the matches are
+		// checked again
+		var below []string
+		if err := tx.Model(&models.Scope{}).Where("path LIKE ?", path+"/%").Pluck("path", &below).Error; err != nil {
+			return fmt.Errorf("failed to delete scope: %w", err)
+		}
+		children := 0
+		for _, p := range below {
+			if strings.HasPrefix(p, path+"/") {
+				children++
+			}
+		}
+		// users pending deletion count too, as they can be restored
+		var assigned []models.Scopes
+		if err := tx.Model(&models.User{}).Where("scopes <> ?", "[]").Pluck("scopes", &assigned).Error; err != nil {
+			return fmt.Errorf("failed to delete scope: %w", err)
+		}
+		users := 0
+		for _, scopes := range assigned {
+			if slices.Contains(scopes, path) {
+				users++
+			}
+		}
+		if children > 0 || users > 0 {
+			return fmt.Errorf("%w: %s has %d site(s) or device(s) and %d user(s)", models.ErrScopeInUse, path, children, users)
+		}
+
+		if err := tx.Delete(&models.Scope{}, "path = ?", path).Error; err != nil {
+			return fmt.Errorf("failed to delete scope: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetUserScopes replaces the scopes of a user
+func (g *GormDatabase) SetUserScopes(userID string, scopes []string) error {
+	scopes = slices.Compact(slices.Sorted(slices.Values(scopes)))
+
+	return g.db.Transaction(func(tx *gorm.DB) error {
+		if err := scopesExist(tx, scopes); err != nil {
+			return err
+		}
+		result := tx.Model(&models.User{}).Where("id = ? AND deleted_at IS NULL", userID).Updates(map[string]interface{}{
+			"scopes":     models.Scopes(scopes),
+			"updated_at": time.Now(),
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to set scopes: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return models.ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+// scopesExist returns models.ErrScopeNotFound naming the first of paths
+// that does not exist
+func scopesExist(tx *gorm.DB, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	var found []string
+	if err := tx.Model(&models.Scope{}).Where("path IN ?", paths).Pluck("path", &found).Error; err != nil {
+		return fmt.Errorf("failed to read scopes: %w", err)
+	}
+	for _, path := range paths {
+		if !slices.Contains(found, path) {
+			return fmt.Errorf("%w: %s", models.ErrScopeNotFound, path)
+		}
+	}
+	return nil
+}
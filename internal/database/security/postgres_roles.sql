@@ -0,0 +1,124 @@
+-- Least-privilege roles and per-tenant row-level security for PostgreSQL.
+-- Applied by 'face migrate install-roles'; safe to run again, and must be
+-- run again after migrations add tables.
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '{{.Reader}}') THEN
+        CREATE ROLE {{.Reader}} NOLOGIN;
+    END IF;
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '{{.Writer}}') THEN
+        CREATE ROLE {{.Writer}} NOLOGIN;
+    END IF;
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '{{.Admin}}') THEN
+        CREATE ROLE {{.Admin}} NOLOGIN;
+    END IF;
+END
+$$;
+
+-- Each role can do everything the role below it can
+GRANT {{.Reader}} TO {{.Writer}};
+GRANT {{.Writer}} TO {{.Admin}};
+GRANT {{.Reader}}, {{.Writer}}, {{.Admin}} TO {{.Login}};
+
+{{if .Schema}}GRANT USAGE ON SCHEMA {{.Schema}} TO {{.Reader}};{{end}}
+GRANT SELECT ON {{.Table "users"}}, {{.Table "faces"}}, {{.Table "settings"}}, {{.Table "changes"}}, {{.Table "identifications"}} TO {{.Reader}};
+GRANT INSERT, UPDATE, DELETE ON {{.Table "users"}}, {{.Table "faces"}} TO {{.Writer}};
+GRANT SELECT ON {{.Table "face_images"}} TO {{.Reader}};
+GRANT INSERT, UPDATE, DELETE ON {{.Table "face_images"}} TO {{.Writer}};
+GRANT INSERT ON {{.Table "identifications"}} TO {{.Writer}};
+GRANT USAGE ON SEQUENCE {{.Table "identifications_seq_seq"}} TO {{.Writer}};
+-- The audit log is appended to by every role and purged only by the admin
+GRANT SELECT, INSERT ON {{.Table "audit_events"}} TO {{.Reader}};
+GRANT USAGE ON SEQUENCE {{.Table "audit_events_seq_seq"}} TO {{.Reader}};
+GRANT DELETE ON {{.Table "audit_events"}} TO {{.Admin}};
+-- Probes are saved with the audit events of decisions and purged with them
+GRANT SELECT, INSERT ON {{.Table "probes"}} TO {{.Reader}};
+GRANT DELETE ON {{.Table "probes"}} TO {{.Admin}};
+-- The change log is written by triggers running as the writer
+GRANT INSERT ON {{.Table "changes"}} TO {{.Writer}};
+GRANT USAGE ON SEQUENCE {{.Table "changes_seq_seq"}} TO {{.Writer}};
+GRANT INSERT, UPDATE ON {{.Table "settings"}} TO {{.Admin}};
+-- Orgs, sites and devices are managed by the admin; assigning users to
+-- them is a change to the users
+GRANT SELECT ON {{.Table "scopes"}} TO {{.Reader}};
+GRANT INSERT, DELETE ON {{.Table "scopes"}} TO {{.Admin}};
+
+-- Rows belong to the tenant of the connection that created them. Rows that
+-- existed before installation belong to the empty tenant. The policies are
+-- forced, so they bind the table owner too; only superusers and roles with
+-- BYPASSRLS see every tenant.
+ALTER TABLE {{.Table "users"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "users"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "faces"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "faces"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "changes"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "changes"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "face_images"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "face_images"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "identifications"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "identifications"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "audit_events"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "audit_events"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "probes"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "probes"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+ALTER TABLE {{.Table "scopes"}} ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE {{.Table "scopes"}} ALTER COLUMN tenant_id SET DEFAULT {{.CurrentTenant}};
+CREATE INDEX IF NOT EXISTS {{.Name "idx_users_tenant_id"}} ON {{.Table "users"}}(tenant_id);
+CREATE INDEX IF NOT EXISTS {{.Name "idx_faces_tenant_id"}} ON {{.Table "faces"}}(tenant_id);
+
+ALTER TABLE {{.Table "users"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "users"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "users_tenant_isolation"}} ON {{.Table "users"}};
+CREATE POLICY {{.Name "users_tenant_isolation"}} ON {{.Table "users"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "faces"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "faces"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "faces_tenant_isolation"}} ON {{.Table "faces"}};
+CREATE POLICY {{.Name "faces_tenant_isolation"}} ON {{.Table "faces"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "changes"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "changes"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "changes_tenant_isolation"}} ON {{.Table "changes"}};
+CREATE POLICY {{.Name "changes_tenant_isolation"}} ON {{.Table "changes"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "identifications"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "identifications"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "identifications_tenant_isolation"}} ON {{.Table "identifications"}};
+CREATE POLICY {{.Name "identifications_tenant_isolation"}} ON {{.Table "identifications"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "face_images"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "face_images"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "face_images_tenant_isolation"}} ON {{.Table "face_images"}};
+CREATE POLICY {{.Name "face_images_tenant_isolation"}} ON {{.Table "face_images"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "audit_events"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "audit_events"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "audit_events_tenant_isolation"}} ON {{.Table "audit_events"}};
+CREATE POLICY {{.Name "audit_events_tenant_isolation"}} ON {{.Table "audit_events"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "probes"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "probes"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "probes_tenant_isolation"}} ON {{.Table "probes"}};
+CREATE POLICY {{.Name "probes_tenant_isolation"}} ON {{.Table "probes"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
+
+ALTER TABLE {{.Table "scopes"}} ENABLE ROW LEVEL SECURITY;
+ALTER TABLE {{.Table "scopes"}} FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS {{.Name "scopes_tenant_isolation"}} ON {{.Table "scopes"}};
+CREATE POLICY {{.Name "scopes_tenant_isolation"}} ON {{.Table "scopes"}}
+    USING (tenant_id = {{.CurrentTenant}})
+    WITH CHECK (tenant_id = {{.CurrentTenant}});
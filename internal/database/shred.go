@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"face/internal/erasure"
+)
+
+// CopyShredder is implemented by the databases that keep copies of their
+// data in files of their own, which still hold a user after the user is
+// deleted
+type CopyShredder interface {
+	// ShredCopies rewrites the database from the data it holds now and
+	// shreds the files holding earlier copies, returning them
+	ShredCopies() ([]erasure.File, error)
+}
+
+// ErrShreddingUnsupported is returned by databases without copies of their
+// own to shred
+var ErrShreddingUnsupported = errors.New("only the json database keeps copies of its data to shred")
+
+// ShredCopies compacts the database into a new file, then shreds the
+// previous file, which Save keeps as a backup while writing, and the
+// journal. A backup left behind by an interrupted save is shredded first.
+func (j *JSONDatabase) ShredCopies() ([]erasure.File, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var files []erasure.File
+	shred := func(path string) error {
+		sum, existed, err := erasure.Shred(path)
+		if existed {
+			files = append(files, erasure.File{Path: path, SHA256: sum, Action: erasure.ActionShredded, ErasedAt: time.Now().UTC()})
+		}
+		return err
+	}
+
+	if err := shred(j.backupPath()); err != nil {
+		return files, err
+	}
+	if err := j.replaceFile(); err != nil {
+		return files, err
+	}
+	if err := j.closeJournal(); err != nil {
+		return files, err
+	}
+	for _, path := range []string{j.backupPath(), journalPath(j.filePath)} {
+		if err := shred(path); err != nil {
+			return files, err
+		}
+	}
+	j.journalRecords = 0
+	return files, nil
+}
@@ -0,0 +1,6 @@
+//go:build cgo && !sqlite_purego
+
+package database
+
+// defaultSQLiteDriver is the SQLite driver used unless configured otherwise
+const defaultSQLiteDriver = SQLiteDriverCGO
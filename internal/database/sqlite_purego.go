@@ -0,0 +1,8 @@
+//go:build !cgo || sqlite_purego
+
+package database
+
+// defaultSQLiteDriver is the SQLite driver used unless configured otherwise.
+// Builds without CGO, or with the sqlite_purego tag, default to the pure-Go
+// driver.
+const defaultSQLiteDriver = SQLiteDriverPureGo
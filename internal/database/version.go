@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// ServerVersioner is implemented by the databases that can report the
+// version of the database server or library behind them
+type ServerVersioner interface {
+	ServerVersion() (string, error)
+}
+
+// ServerVersion returns the version of SQLite or of the PostgreSQL server
+func (g *GormDatabase) ServerVersion() (string, error) {
+	query := "SELECT sqlite_version()"
+	if g.dbType == DatabaseTypePostgres {
+		query = "SHOW server_version"
+	}
+	var version string
+	if err := g.reader.Raw(query).Scan(&version).Error; err != nil {
+		return "", fmt.Errorf("failed to read server version: %w", err)
+	}
+	return version, nil
+}
+
+// LatestMigration returns the version of the newest embedded migration, the
+// schema version 'face migrate up' brings a database to
+func LatestMigration() (uint, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	var latest uint
+	for _, e := range entries {
+		prefix, _, ok := strings.Cut(e.Name(), "_")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(prefix, 10, 32); err == nil && uint(v) > latest {
+			latest = uint(v)
+		}
+	}
+	return latest, nil
+}
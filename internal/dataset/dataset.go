@@ -0,0 +1,242 @@
+// Package dataset reads and writes dataset archives: a portable copy of
+// everything enrolled, for backups and for moving between database
+// backends. An archive is a tar file holding, in this order,
+//
+//	manifest.json                     Manifest
+//	settings.json                     the shared settings
+//	users.jsonl                       one user per line, with their faces
+//	                                  and embeddings
+//	                                  (NaN and Infinity are read as well,
+//	                                  for archives of other tools)
+//	images/<user id>/<face id>.jpg    the stored face images, if included
+//
+// Readers rely on the order, so an archive is imported in a single pass
+// without holding the images in memory.
+package dataset
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// FormatVersion is the version of the archive format written by Writer
+const FormatVersion = 1
+
+// Names of the entries of an archive
+const (
+	manifestName = "manifest.json"
+	settingsName = "settings.json"
+	usersName    = "users.jsonl"
+	imagesDir    = "images/"
+)
+
+// ErrInvalidArchive is returned when reading data that is not a dataset
+// archive
+var ErrInvalidArchive = errors.New("not a dataset archive")
+
+// Manifest describes an archive
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Source is the release of face that wrote the archive
+	Source string `json:"source"`
+	// DatabaseType is the backend the data was exported from
+	DatabaseType       string `json:"database_type"`
+	EmbeddingModel     string `json:"embedding_model,omitempty"`
+	EmbeddingDimension int    `json:"embedding_dimension"`
+	Users              int    `json:"users"`
+	Faces              int    `json:"faces"`
+	// Images is set when the archive holds the face images
+	Images bool `json:"images"`
+}
+
+// Writer writes an archive
+type Writer struct {
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+// NewWriter returns a writer of an archive to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{tw: tar.NewWriter(w), modTime: time.Now()}
+}
+
+// WriteData writes the manifest, settings and users. Images, if any, are
+// written after with WriteImage.
+func (w *Writer) WriteData(manifest *Manifest, settings *models.Settings, users []models.User) error {
+	manifest.FormatVersion = FormatVersion
+	for _, entry := range []struct {
+		name string
+		v    interface{}
+	}{{manifestName, manifest}, {settingsName, settings}} {
+		data, err := json.MarshalIndent(entry.v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", entry.name, err)
+		}
+		if err := w.writeFile(entry.name, append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	var lines bytes.Buffer
+	enc := json.NewEncoder(&lines)
+	for i := range users {
+		if err := enc.Encode(&users[i]); err != nil {
+			return fmt.Errorf("failed to encode user %s: %w", users[i].ID, err)
+		}
+	}
+	return w.writeFile(usersName, lines.Bytes())
+}
+
+// WriteImage writes the stored image of a face
+func (w *Writer) WriteImage(userID, faceID string, data []byte) error {
+	return w.writeFile(imagePath(userID, faceID), data)
+}
+
+// Close finishes the archive, without closing the underlying writer
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+func (w *Writer) writeFile(name string, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: w.modTime}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// Reader reads an archive. The manifest, settings and users are read by
+// NewReader; the images follow with NextImage.
+type Reader struct {
+	Manifest Manifest
+	Settings models.Settings
+	// Users are in the order of users.jsonl, one per line
+	Users []models.User
+	// Coerced are the faces whose embeddings had values that did not fit
+	// a float32, by face ID
+	Coerced map[string]Coercion
+
+	tr *tar.Reader
+}
+
+// NewReader reads the manifest, settings and users of an archive
+func NewReader(r io.Reader) (*Reader, error) {
+	ar := &Reader{tr: tar.NewReader(r)}
+
+	if err := ar.readJSON(manifestName, &ar.Manifest); err != nil {
+		return nil, err
+	}
+	if ar.Manifest.FormatVersion < 1 {
+		return nil, fmt.Errorf("%w: no format version", ErrInvalidArchive)
+	}
+	if ar.Manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("archive format %d is newer than this release supports (%d)", ar.Manifest.FormatVersion, FormatVersion)
+	}
+	if err := ar.readJSON(settingsName, &ar.Settings); err != nil {
+		return nil, err
+	}
+
+	if err := ar.next(usersName); err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(ar.tr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	for scanner.Scan() {
+		user, coerced, err := decodeUser(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("%w: user %d: %v", ErrInvalidArchive, len(ar.Users)+1, err)
+		}
+		ar.Users = append(ar.Users, user)
+		for id, c := range coerced {
+			if ar.Coerced == nil {
+				ar.Coerced = make(map[string]Coercion)
+			}
+			ar.Coerced[id] = c
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", usersName, err)
+	}
+	return ar, nil
+}
+
+// NextImage returns the next face image, and io.EOF after the last
+func (r *Reader) NextImage() (userID, faceID string, data []byte, err error) {
+	header, err := r.tr.Next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", "", nil, io.EOF
+		}
+		return "", "", nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	userID, faceID, ok := parseImagePath(header.Name)
+	if !ok {
+		return "", "", nil, fmt.Errorf("%w: unexpected entry %s", ErrInvalidArchive, header.Name)
+	}
+	if data, err = io.ReadAll(r.tr); err != nil {
+		return "", "", nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+	}
+	return userID, faceID, data, nil
+}
+
+// next advances to the entry called name, which must come next
+func (r *Reader) next(name string) error {
+	header, err := r.tr.Next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: %s missing", ErrInvalidArchive, name)
+		}
+		return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if header.Name != name {
+		return fmt.Errorf("%w: expected %s, found %s", ErrInvalidArchive, name, header.Name)
+	}
+	return nil
+}
+
+func (r *Reader) readJSON(name string, v interface{}) error {
+	if err := r.next(name); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(r.tr).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, name, err)
+	}
+	return nil
+}
+
+func imagePath(userID, faceID string) string {
+	return imagesDir + userID + "/" + faceID + ".jpg"
+}
+
+// parseImagePath returns the user and face of an image entry, refusing
+// names that are not exactly images/<user id>/<face id>.jpg
+func parseImagePath(name string) (userID, faceID string, ok bool) {
+	rest, found := strings.CutPrefix(name, imagesDir)
+	if !found || path.Clean(name) != name {
+		return "", "", false
+	}
+	userID, file, found := strings.Cut(rest, "/")
+	faceID, isJPEG := strings.CutSuffix(file, ".jpg")
+	if !found || !isJPEG || userID == "" || faceID == "" || strings.Contains(faceID, "/") {
+		return "", "", false
+	}
+	return userID, faceID, true
+}
@@ -0,0 +1,162 @@
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"face/internal/database/models"
+)
+
+// Coercion counts the values of an embedding that changed beyond rounding
+// when converted to the float32 embeddings are stored as
+type Coercion struct {
+	// Overflowed values were beyond the float32 range and became ±Inf
+	Overflowed int `json:"overflowed,omitempty"`
+	// Underflowed values were too small for a float32 and became 0
+	Underflowed int `json:"underflowed,omitempty"`
+}
+
+// nonFinite are the names Python's json module and others write NaN and
+// infinities as, which are not JSON
+var nonFinite = map[string]float32{
+	"NaN":       float32(math.NaN()),
+	"Infinity":  float32(math.Inf(1)),
+	"-Infinity": float32(math.Inf(-1)),
+}
+
+// archivedUser is a line of users.jsonl, with embeddings read leniently
+type archivedUser struct {
+	models.User
+	Faces []archivedFace `json:"faces"`
+}
+
+// archivedFace is a face of an archived user
+type archivedFace struct {
+	models.Face
+	Embedding archivedEmbedding `json:"embedding"`
+}
+
+// archivedEmbedding is an embedding as archived, which archives written by
+// other tools may hold in float64 or with non-finite values
+type archivedEmbedding struct {
+	values   models.Embedding
+	coercion Coercion
+}
+
+// UnmarshalJSON reads an array of numbers, or of the names of non-finite
+// values, as float32
+func (e *archivedEmbedding) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		return nil
+	}
+
+	e.values = make(models.Embedding, len(raw))
+	for i, r := range raw {
+		if name, err := strconv.Unquote(string(r)); err == nil {
+			v, ok := nonFinite[name]
+			if !ok {
+				return fmt.Errorf("embedding value %d is %s, not a number", i, r)
+			}
+			e.values[i] = v
+			continue
+		}
+
+		literal := string(r)
+		v, err := strconv.ParseFloat(literal, 32)
+		switch {
+		case errors.Is(err, strconv.ErrRange):
+			e.coercion.Overflowed++
+		case err != nil:
+			return fmt.Errorf("embedding value %d is %s, not a number", i, r)
+		case v == 0 && nonZero(literal):
+			e.coercion.Underflowed++
+		}
+		e.values[i] = float32(v)
+	}
+	return nil
+}
+
+// nonZero reports whether a number literal has a non-zero digit before
+// its exponent
+func nonZero(literal string) bool {
+	mantissa, _, _ := strings.Cut(strings.ToLower(literal), "e")
+	return strings.ContainsAny(mantissa, "123456789")
+}
+
+// decodeUser decodes a line of users.jsonl, returning the user and the
+// coercions of their faces' embeddings by face ID
+func decodeUser(line []byte) (models.User, map[string]Coercion, error) {
+	var archived archivedUser
+	if err := json.Unmarshal(quoteNonFinite(line), &archived); err != nil {
+		return models.User{}, nil, err
+	}
+
+	user := archived.User
+	var coerced map[string]Coercion
+	if archived.Faces != nil {
+		user.Faces = make([]models.Face, len(archived.Faces))
+	}
+	for i, f := range archived.Faces {
+		user.Faces[i] = f.Face
+		user.Faces[i].Embedding = f.Embedding.values
+		if f.Embedding.coercion != (Coercion{}) {
+			if coerced == nil {
+				coerced = make(map[string]Coercion)
+			}
+			coerced[f.ID] = f.Embedding.coercion
+		}
+	}
+	return user, coerced, nil
+}
+
+// quoteNonFinite quotes the bare NaN, Infinity and -Infinity of a line
+// outside strings, so it parses as JSON
+func quoteNonFinite(line []byte) []byte {
+	var out []byte
+	inString, escaped := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inString:
+			inString = escaped || c != '"'
+			escaped = !escaped && c == '\\'
+		case c == '"':
+			inString = true
+		default:
+			if name := nonFiniteAt(line[i:]); name != "" {
+				if out == nil {
+					out = append(make([]byte, 0, len(line)+8), line[:i]...)
+				}
+				out = strconv.AppendQuote(out, name)
+				i += len(name) - 1
+				continue
+			}
+		}
+		if out != nil {
+			out = append(out, c)
+		}
+	}
+	if out == nil {
+		return line
+	}
+	return out
+}
+
+// nonFiniteAt returns the name of a non-finite value rest starts with
+func nonFiniteAt(rest []byte) string {
+	for name := range nonFinite {
+		if bytes.HasPrefix(rest, []byte(name)) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,388 @@
+package deadline
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/erasure"
+)
+
+// databaseStage is the stage of the Error of a database call
+const databaseStage = "database"
+
+// boundDatabase runs the operations of a database as stages of a context
+type boundDatabase struct {
+	db  database.Database
+	ctx context.Context
+}
+
+// WrapDatabase returns a database whose reads return an Error once the
+// deadline of ctx passes. Writes are not started once it has passed, but a
+// write that has started runs to the end: the database cannot be
+// interrupted, and an abandoned write could still take effect after its
+// caller gave up, e.g. enrolling a user twice when the client retries.
+// Close is not bound, so the database is always released.
+func WrapDatabase(db database.Database, ctx context.Context) database.Database {
+	if ctx == nil || ctx.Done() == nil {
+		return db
+	}
+	if bound, ok := db.(*boundDatabase); ok {
+		db = bound.db
+	}
+	return &boundDatabase{db: db, ctx: ctx}
+}
+
+// runWrite runs a write unless ctx is done, waiting for it to finish
+func runWrite(ctx context.Context, fn func() error) error {
+	_, err := doWrite(ctx, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// doWrite is runWrite for a write with a result
+func doWrite[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	if ctx.Err() != nil {
+		var zero T
+		return zero, Err(ctx, databaseStage)
+	}
+	return fn()
+}
+
+func (b *boundDatabase) CreateUser(user *models.User) error {
+	return runWrite(b.ctx, func() error { return b.db.CreateUser(user) })
+}
+
+func (b *boundDatabase) GetUser(id string) (*models.User, error) {
+	return Do(b.ctx, databaseStage, func() (*models.User, error) { return b.db.GetUser(id) })
+}
+
+func (b *boundDatabase) GetUserByName(name string) (*models.User, error) {
+	return Do(b.ctx, databaseStage, func() (*models.User, error) { return b.db.GetUserByName(name) })
+}
+
+func (b *boundDatabase) ListUsersByName(name string) ([]models.User, error) {
+	return Do(b.ctx, databaseStage, func() ([]models.User, error) { return b.db.ListUsersByName(name) })
+}
+
+func (b *boundDatabase) UserExistsByName(name string) (bool, error) {
+	return Do(b.ctx, databaseStage, func() (bool, error) { return b.db.UserExistsByName(name) })
+}
+
+func (b *boundDatabase) UpdateUser(user *models.User) error {
+	return runWrite(b.ctx, func() error { return b.db.UpdateUser(user) })
+}
+
+func (b *boundDatabase) SetUserAvatar(userID, filename string) error {
+	return runWrite(b.ctx, func() error { return b.db.SetUserAvatar(userID, filename) })
+}
+
+func (b *boundDatabase) DeleteUser(id string) error {
+	return runWrite(b.ctx, func() error { return b.db.DeleteUser(id) })
+}
+
+func (b *boundDatabase) ListUsers() ([]models.User, error) {
+	return Do(b.ctx, databaseStage, b.db.ListUsers)
+}
+
+func (b *boundDatabase) SoftDeleteUser(id string) error {
+	return runWrite(b.ctx, func() error { return b.db.SoftDeleteUser(id) })
+}
+
+func (b *boundDatabase) RestoreUser(id string) error {
+	return runWrite(b.ctx, func() error { return b.db.RestoreUser(id) })
+}
+
+func (b *boundDatabase) ListDeletedUsers() ([]models.User, error) {
+	return Do(b.ctx, databaseStage, b.db.ListDeletedUsers)
+}
+
+func (b *boundDatabase) AddFace(userID string, face *models.Face) (*models.Face, error) {
+	return doWrite(b.ctx, func() (*models.Face, error) { return b.db.AddFace(userID, face) })
+}
+
+func (b *boundDatabase) RemoveFace(userID, faceID string) error {
+	return runWrite(b.ctx, func() error { return b.db.RemoveFace(userID, faceID) })
+}
+
+func (b *boundDatabase) UpdateFaceFilename(userID, faceID, filename string) error {
+	return runWrite(b.ctx, func() error { return b.db.UpdateFaceFilename(userID, faceID, filename) })
+}
+
+func (b *boundDatabase) SetFaceLabel(userID, faceID, label string) error {
+	return runWrite(b.ctx, func() error { return b.db.SetFaceLabel(userID, faceID, label) })
+}
+
+func (b *boundDatabase) SetPrimaryFace(userID, faceID string) error {
+	return runWrite(b.ctx, func() error { return b.db.SetPrimaryFace(userID, faceID) })
+}
+
+func (b *boundDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
+	return Do(b.ctx, databaseStage, b.db.GetAllEmbeddings)
+}
+
+func (b *boundDatabase) ReplaceEmbeddings(embeddings map[string]models.Embedding, model string, dimension int) error {
+	return runWrite(b.ctx, func() error { return b.db.ReplaceEmbeddings(embeddings, model, dimension) })
+}
+
+func (b *boundDatabase) GetSettings() (*models.Settings, error) {
+	return Do(b.ctx, databaseStage, b.db.GetSettings)
+}
+
+func (b *boundDatabase) UpdateSettings(settings *models.Settings) error {
+	return runWrite(b.ctx, func() error { return b.db.UpdateSettings(settings) })
+}
+
+// ChangesSince reads the change log if the wrapped database has one
+func (b *boundDatabase) ChangesSince(seq int64, limit int) ([]models.Change, error) {
+	changeLog, ok := b.db.(database.ChangeLog)
+	if !ok {
+		return nil, database.ErrChangeLogUnsupported
+	}
+	return Do(b.ctx, databaseStage, func() ([]models.Change, error) { return changeLog.ChangesSince(seq, limit) })
+}
+
+// LatestChange reads the change log if the wrapped database has one
+func (b *boundDatabase) LatestChange() (int64, error) {
+	changeLog, ok := b.db.(database.ChangeLog)
+	if !ok {
+		return 0, database.ErrChangeLogUnsupported
+	}
+	return Do(b.ctx, databaseStage, changeLog.LatestChange)
+}
+
+// LogIdentification records an identification if the wrapped database
+// can
+func (b *boundDatabase) LogIdentification(identification *models.Identification) error {
+	log, ok := b.db.(database.IdentificationLog)
+	if !ok {
+		return database.ErrIdentificationLogUnsupported
+	}
+	return runWrite(b.ctx, func() error { return log.LogIdentification(identification) })
+}
+
+// ShredCopies shreds the copies of the wrapped database if it has any
+func (b *boundDatabase) ShredCopies() ([]erasure.File, error) {
+	shredder, ok := b.db.(database.CopyShredder)
+	if !ok {
+		return nil, database.ErrShreddingUnsupported
+	}
+	return doWrite(b.ctx, shredder.ShredCopies)
+}
+
+// LogAuditEvent records an audit event if the wrapped database can. It is
+// not bound, so the failure of an operation that timed out is recorded.
+func (b *boundDatabase) LogAuditEvent(event *models.AuditEvent) error {
+	log, ok := b.db.(database.AuditLog)
+	if !ok {
+		return database.ErrAuditLogUnsupported
+	}
+	return log.LogAuditEvent(event)
+}
+
+// AuditEvents reads the audit log if the wrapped database has one
+func (b *boundDatabase) AuditEvents(filter database.AuditFilter) ([]models.AuditEvent, error) {
+	log, ok := b.db.(database.AuditLog)
+	if !ok {
+		return nil, database.ErrAuditLogUnsupported
+	}
+	return Do(b.ctx, databaseStage, func() ([]models.AuditEvent, error) { return log.AuditEvents(filter) })
+}
+
+// PurgeAuditEvents purges the audit log if the wrapped database has one
+func (b *boundDatabase) PurgeAuditEvents(before time.Time) (int64, error) {
+	log, ok := b.db.(database.AuditLog)
+	if !ok {
+		return 0, database.ErrAuditLogUnsupported
+	}
+	return doWrite(b.ctx, func() (int64, error) { return log.PurgeAuditEvents(before) })
+}
+
+// probeStore returns the probe store of the wrapped database
+func (b *boundDatabase) probeStore() (database.ProbeStore, error) {
+	store, ok := b.db.(database.ProbeStore)
+	if !ok {
+		return nil, database.ErrProbeStoreUnsupported
+	}
+	return store, nil
+}
+
+// SaveProbe saves a probe if the wrapped database can
+func (b *boundDatabase) SaveProbe(probe *models.Probe) error {
+	store, err := b.probeStore()
+	if err != nil {
+		return err
+	}
+	return runWrite(b.ctx, func() error { return store.SaveProbe(probe) })
+}
+
+// GetProbe reads a probe if the wrapped database keeps them
+func (b *boundDatabase) GetProbe(id string) (*models.Probe, error) {
+	store, err := b.probeStore()
+	if err != nil {
+		return nil, err
+	}
+	return Do(b.ctx, databaseStage, func() (*models.Probe, error) { return store.GetProbe(id) })
+}
+
+// DeleteProbes deletes probes if the wrapped database keeps them
+func (b *boundDatabase) DeleteProbes(filter database.ProbeFilter) ([]models.Probe, error) {
+	store, err := b.probeStore()
+	if err != nil {
+		return nil, err
+	}
+	return doWrite(b.ctx, func() ([]models.Probe, error) { return store.DeleteProbes(filter) })
+}
+
+// scopeStore returns the scope store of the wrapped database
+func (b *boundDatabase) scopeStore() (database.ScopeStore, error) {
+	store, ok := b.db.(database.ScopeStore)
+	if !ok {
+		return nil, database.ErrScopeStoreUnsupported
+	}
+	return store, nil
+}
+
+// CreateScope adds a scope if the wrapped database keeps them
+func (b *boundDatabase) CreateScope(scope *models.Scope) error {
+	store, err := b.scopeStore()
+	if err != nil {
+		return err
+	}
+	return runWrite(b.ctx, func() error { return store.CreateScope(scope) })
+}
+
+// ListScopes lists the scopes if the wrapped database keeps them
+func (b *boundDatabase) ListScopes() ([]models.Scope, error) {
+	store, err := b.scopeStore()
+	if err != nil {
+		return nil, err
+	}
+	return Do(b.ctx, databaseStage, store.ListScopes)
+}
+
+// DeleteScope deletes a scope if the wrapped database keeps them
+func (b *boundDatabase) DeleteScope(path string) error {
+	store, err := b.scopeStore()
+	if err != nil {
+		return err
+	}
+	return runWrite(b.ctx, func() error { return store.DeleteScope(path) })
+}
+
+// SetUserScopes assigns a user to scopes if the wrapped database keeps them
+func (b *boundDatabase) SetUserScopes(userID string, scopes []string) error {
+	store, err := b.scopeStore()
+	if err != nil {
+		return err
+	}
+	return runWrite(b.ctx, func() error { return store.SetUserScopes(userID, scopes) })
+}
+
+// imageStore returns the image store of the wrapped database
+func (b *boundDatabase) imageStore() (database.ImageStore, error) {
+	store, ok := b.db.(database.ImageStore)
+	if !ok {
+		return nil, database.ErrImageStoreUnsupported
+	}
+	return store, nil
+}
+
+// PutImageData stores an image if the wrapped database can
+func (b *boundDatabase) PutImageData(filename string, data []byte) error {
+	store, err := b.imageStore()
+	if err != nil {
+		return err
+	}
+	return runWrite(b.ctx, func() error { return store.PutImageData(filename, data) })
+}
+
+// ImageData returns an image if the wrapped database can store them
+func (b *boundDatabase) ImageData(filename string) ([]byte, error) {
+	store, err := b.imageStore()
+	if err != nil {
+		return nil, err
+	}
+	return Do(b.ctx, databaseStage, func() ([]byte, error) { return store.ImageData(filename) })
+}
+
+// DeleteImageData removes an image if the wrapped database can store them
+func (b *boundDatabase) DeleteImageData(filename string) error {
+	store, err := b.imageStore()
+	if err != nil {
+		return err
+	}
+	return runWrite(b.ctx, func() error { return store.DeleteImageData(filename) })
+}
+
+// HasImageData looks up an image if the wrapped database can store them
+func (b *boundDatabase) HasImageData(filename string) (bool, error) {
+	store, err := b.imageStore()
+	if err != nil {
+		return false, err
+	}
+	return Do(b.ctx, databaseStage, func() (bool, error) { return store.HasImageData(filename) })
+}
+
+// VectorSearch reports whether the wrapped database searches embeddings
+func (b *boundDatabase) VectorSearch() bool {
+	searcher, ok := b.db.(database.VectorSearcher)
+	return ok && searcher.VectorSearch()
+}
+
+// NearestFaces searches the embeddings if the wrapped database can
+func (b *boundDatabase) NearestFaces(embedding []float32, k int) ([]database.FaceSimilarity, error) {
+	searcher, ok := b.db.(database.VectorSearcher)
+	if !ok {
+		return nil, database.ErrVectorSearchUnsupported
+	}
+	return Do(b.ctx, databaseStage, func() ([]database.FaceSimilarity, error) { return searcher.NearestFaces(embedding, k) })
+}
+
+// UserIDsWithPrefix looks up user IDs by prefix, listing every user if the
+// wrapped database cannot look them up itself
+func (b *boundDatabase) UserIDsWithPrefix(prefix string, limit int) ([]string, error) {
+	return Do(b.ctx, databaseStage, func() ([]string, error) {
+		if prefixer, ok := b.db.(database.UserIDPrefixer); ok {
+			return prefixer.UserIDsWithPrefix(prefix, limit)
+		}
+		users, err := b.db.ListUsers()
+		if err != nil {
+			return nil, err
+		}
+		var ids []string
+		for i := range users {
+			if strings.HasPrefix(users[i].ID, prefix) && len(ids) < limit {
+				ids = append(ids, users[i].ID)
+			}
+		}
+		return ids, nil
+	})
+}
+
+// ServerVersion reports the version of the wrapped database's server, empty
+// if it cannot
+func (b *boundDatabase) ServerVersion() (string, error) {
+	versioner, ok := b.db.(database.ServerVersioner)
+	if !ok {
+		return "", nil
+	}
+	return Do(b.ctx, databaseStage, versioner.ServerVersion)
+}
+
+// RunQuery runs the query if the wrapped database supports queries
+func (b *boundDatabase) RunQuery(q database.Query, params map[string]string) (*database.QueryResult, error) {
+	querier, ok := b.db.(database.Querier)
+	if !ok {
+		return nil, database.ErrQueriesUnsupported
+	}
+	return Do(b.ctx, databaseStage, func() (*database.QueryResult, error) { return querier.RunQuery(q, params) })
+}
+
+// Close is not bound, so the database is always released
+func (b *boundDatabase) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,123 @@
+// Package deadline bounds how long the stages of a command or request may
+// run. Detection, extraction and database reads cannot be interrupted, so a
+// stage that misses its deadline is left to finish in the background and
+// its result is discarded; the caller gets an Error at once instead of
+// waiting on a hung camera or a slow disk. Database writes are waited for,
+// see WrapDatabase.
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Error is returned when a stage does not finish before the deadline of its
+// context. It wraps context.DeadlineExceeded.
+type Error struct {
+	// Stage is what was running, e.g. "detection"
+	Stage string
+	// Timeout is the timeout the deadline was set with by WithTimeout, 0
+	// if it was set otherwise
+	Timeout time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("timed out after %s during %s", e.Timeout, e.Stage)
+	}
+	return fmt.Sprintf("deadline exceeded during %s", e.Stage)
+}
+
+// Unwrap allows errors.Is(err, context.DeadlineExceeded)
+func (e *Error) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// timeoutKey is the context key of the timeout set by WithTimeout
+type timeoutKey struct{}
+
+// WithTimeout returns a context that expires after timeout, remembering it
+// for the Error of a stage that misses it, unless ctx expires earlier.
+// Without a timeout, ctx itself is returned.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	if earlier, ok := ctx.Deadline(); ok && time.Until(earlier) < timeout {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(context.WithValue(ctx, timeoutKey{}, timeout), timeout)
+}
+
+// stagesKey is the context key of the stages counted by WithStages
+type stagesKey struct{}
+
+// WithStages returns a context whose stages are counted by wg until they
+// finish, including those abandoned when the context ended, so a detector
+// they use is not handed to anyone else while they still run. Without wg,
+// ctx itself is returned.
+func WithStages(ctx context.Context, wg *sync.WaitGroup) context.Context {
+	if wg == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, stagesKey{}, wg)
+}
+
+// Run runs a stage, returning an Error as soon as the deadline of ctx
+// passes or the context's error when it is cancelled. A stage is not
+// started once ctx is done. Without a context that can end, fn runs
+// directly.
+func Run(ctx context.Context, stage string, fn func() error) error {
+	_, err := Do(ctx, stage, func() (struct{}, error) {
+		return struct{}{}, fn()
+	})
+	return err
+}
+
+// Do is Run for a stage with a result
+func Do[T any](ctx context.Context, stage string, fn func() (T, error)) (T, error) {
+	var zero T
+	if ctx == nil || ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return zero, Err(ctx, stage)
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	stages, _ := ctx.Value(stagesKey{}).(*sync.WaitGroup)
+	if stages != nil {
+		stages.Add(1)
+	}
+	go func() {
+		if stages != nil {
+			defer stages.Done()
+		}
+		value, err := fn()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, Err(ctx, stage)
+	}
+}
+
+// Err returns the error of a stage that could not finish because ctx
+// ended: an Error if its deadline passed, the context's error otherwise
+func Err(ctx context.Context, stage string) error {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ctx.Err()
+	}
+	timeout, _ := ctx.Value(timeoutKey{}).(time.Duration)
+	return &Error{Stage: stage, Timeout: timeout}
+}
@@ -0,0 +1,92 @@
+package embedding
+
+import (
+	"sort"
+
+	"face/internal/database/models"
+)
+
+// Contamination is a face whose nearest neighbors mostly belong to another
+// user, which suggests it was enrolled under the wrong user
+type Contamination struct {
+	UserID          string
+	FaceID          string
+	SuggestedUserID string
+	// Votes is how many of the Neighbors nearest faces belong to the
+	// suggested user
+	Votes     int
+	Neighbors int
+	// Confidence is the similarity-weighted share of the neighbors that
+	// belong to the suggested user, between 0 and 1
+	Confidence float64
+}
+
+// FindContamination checks the k nearest neighbors of every face and reports
+// the faces for which at least minShare of them belong to a single other
+// user, highest confidence first. Faces with fewer than k neighbors, i.e. in
+// databases of at most k faces, are not checked. faces maps user IDs to
+// their faces, as returned by Database.GetAllEmbeddings.
+func FindContamination(faces map[string][]models.Face, k int, minShare float64) []Contamination {
+	var result []Contamination
+	for userID, userFaces := range faces {
+		for _, f := range userFaces {
+			if c, ok := checkContamination(faces, userID, f, k, minShare); ok {
+				result = append(result, c)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].FaceID < result[j].FaceID
+	})
+	return result
+}
+
+func checkContamination(faces map[string][]models.Face, userID string, f models.Face, k int, minShare float64) (Contamination, bool) {
+	neighbors := Nearest(f.Embedding, faces, k, f.ID)
+	if len(neighbors) < k {
+		return Contamination{}, false
+	}
+
+	votes := make(map[string]int)
+	weights := make(map[string]float64)
+	var total float64
+	for _, nb := range neighbors {
+		votes[nb.UserID]++
+		if nb.Similarity > 0 {
+			weights[nb.UserID] += nb.Similarity
+			total += nb.Similarity
+		}
+	}
+
+	var suggested string
+	for candidate, n := range votes {
+		if candidate == userID {
+			continue
+		}
+		if suggested == "" || n > votes[suggested] || (n == votes[suggested] && candidate < suggested) {
+			suggested = candidate
+		}
+	}
+
+	if suggested == "" || float64(votes[suggested]) < minShare*float64(len(neighbors)) {
+		return Contamination{}, false
+	}
+
+	confidence := 0.0
+	if total > 0 {
+		confidence = weights[suggested] / total
+	}
+
+	return Contamination{
+		UserID:          userID,
+		FaceID:          f.ID,
+		SuggestedUserID: suggested,
+		Votes:           votes[suggested],
+		Neighbors:       len(neighbors),
+		Confidence:      confidence,
+	}, true
+}
@@ -0,0 +1,47 @@
+// Package embedding provides vector math for analyzing stored face embeddings.
+package embedding
+
+import (
+	"sort"
+
+	"face/internal/database/models"
+	"face/matching"
+)
+
+// Neighbor is a stored face and its similarity to a query embedding
+type Neighbor struct {
+	UserID     string
+	FaceID     string
+	Similarity float64
+}
+
+// Nearest returns the n faces most similar to query, most similar first,
+// skipping the face with ID exclude. faces maps user IDs to their faces, as
+// returned by Database.GetAllEmbeddings.
+func Nearest(query []float32, faces map[string][]models.Face, n int, exclude string) []Neighbor {
+	var neighbors []Neighbor
+	for userID, userFaces := range faces {
+		for _, f := range userFaces {
+			if f.ID == exclude {
+				continue
+			}
+			neighbors = append(neighbors, Neighbor{
+				UserID:     userID,
+				FaceID:     f.ID,
+				Similarity: matching.CosineSimilarity(query, f.Embedding),
+			})
+		}
+	}
+
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Similarity != neighbors[j].Similarity {
+			return neighbors[i].Similarity > neighbors[j].Similarity
+		}
+		return neighbors[i].FaceID < neighbors[j].FaceID
+	})
+
+	if len(neighbors) > n {
+		neighbors = neighbors[:n]
+	}
+	return neighbors
+}
@@ -0,0 +1,78 @@
+package embedding
+
+import (
+	"sort"
+
+	"face/internal/database/models"
+	"face/matching"
+)
+
+// MinOutlierFaces is the number of faces a user needs for outlier
+// detection; with only two faces there is no telling which one is wrong
+const MinOutlierFaces = 3
+
+// Outlier is a face that is far from the other faces of its user
+type Outlier struct {
+	FaceID string
+	// Similarity is the cosine similarity to the centroid of the user's
+	// other faces
+	Similarity float64
+}
+
+// Centroid returns the mean of embeddings of equal dimension, or nil if
+// there are none
+func Centroid(embeddings [][]float32) []float32 {
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	sum := make([]float64, len(embeddings[0]))
+	for _, e := range embeddings {
+		for k := range sum {
+			sum[k] += float64(e[k])
+		}
+	}
+
+	centroid := make([]float32, len(sum))
+	for k, v := range sum {
+		centroid[k] = float32(v / float64(len(embeddings)))
+	}
+	return centroid
+}
+
+// FindOutliers returns the faces whose similarity to the centroid of the
+// other faces of the same user is below minSimilarity, least similar first.
+// Each face is compared with a centroid that leaves it out, so a single
+// wrong photo cannot pull the centroid towards itself. Users with fewer than
+// MinOutlierFaces faces have no outliers.
+func FindOutliers(faces []models.Face, minSimilarity float64) []Outlier {
+	if len(faces) < MinOutlierFaces {
+		return nil
+	}
+
+	var outliers []Outlier
+	for i := range faces {
+		others := make([][]float32, 0, len(faces)-1)
+		for j := range faces {
+			if j != i && len(faces[j].Embedding) == len(faces[i].Embedding) {
+				others = append(others, faces[j].Embedding)
+			}
+		}
+
+		// A face embedded by another model than all the others is an
+		// outlier by definition
+		similarity := 0.0
+		if len(others) > 0 {
+			similarity = matching.CosineSimilarity(faces[i].Embedding, Centroid(others))
+		}
+
+		if similarity < minSimilarity {
+			outliers = append(outliers, Outlier{FaceID: faces[i].ID, Similarity: similarity})
+		}
+	}
+
+	sort.Slice(outliers, func(i, j int) bool {
+		return outliers[i].Similarity < outliers[j].Similarity
+	})
+	return outliers
+}
@@ -0,0 +1,316 @@
+package embedding
+
+import "math"
+
+// Point is a 2-D projection of an embedding
+type Point struct {
+	X float64
+	Y float64
+}
+
+// ProjectPCA projects embeddings onto their first two principal components.
+// All embeddings must have the same dimension.
+func ProjectPCA(data [][]float32) []Point {
+	points := make([]Point, len(data))
+	if len(data) == 0 {
+		return points
+	}
+
+	centered := center(data)
+	first := principalComponent(centered, nil)
+	second := principalComponent(centered, first)
+
+	for i, row := range centered {
+		points[i] = Point{X: dot(row, first), Y: dot(row, second)}
+	}
+	return points
+}
+
+// TSNEOptions configures ProjectTSNE
+type TSNEOptions struct {
+	Perplexity float64 // effective number of neighbors, typically 5-50
+	Iterations int
+}
+
+// DefaultTSNEOptions returns the usual t-SNE settings
+func DefaultTSNEOptions() TSNEOptions {
+	return TSNEOptions{Perplexity: 30, Iterations: 1000}
+}
+
+// ProjectTSNE projects embeddings to two dimensions with exact t-SNE, which
+// keeps similar faces close together and so shows cluster structure better
+// than PCA. It takes O(n²) time and memory per iteration, which is fine for
+// a few thousand faces. The layout starts from the PCA projection, so the
+// result is deterministic.
+func ProjectTSNE(data [][]float32, opts TSNEOptions) []Point {
+	n := len(data)
+	if n < 3 {
+		return ProjectPCA(data)
+	}
+
+	perplexity := math.Min(opts.Perplexity, float64(n-1)/3)
+	p := jointProbabilities(squaredDistances(data), math.Max(perplexity, 1))
+
+	// Start from a tiny copy of the PCA layout
+	y := ProjectPCA(data)
+	var spread float64
+	for _, pt := range y {
+		spread = math.Max(spread, math.Max(math.Abs(pt.X), math.Abs(pt.Y)))
+	}
+	for i := range y {
+		if spread > 0 {
+			y[i].X = y[i].X / spread * 1e-4
+			y[i].Y = y[i].Y / spread * 1e-4
+		}
+	}
+
+	optimizeTSNE(p, y, opts.Iterations)
+	return y
+}
+
+// optimizeTSNE runs gradient descent with momentum and adaptive gains
+func optimizeTSNE(p [][]float64, y []Point, iterations int) {
+	const (
+		learningRate      = 200.0
+		exaggeration      = 12.0
+		exaggerationIters = 250
+	)
+
+	n := len(y)
+	velocity := make([]Point, n)
+	gains := make([]Point, n)
+	for i := range gains {
+		gains[i] = Point{1, 1}
+	}
+	num := make([][]float64, n)
+	for i := range num {
+		num[i] = make([]float64, n)
+	}
+
+	for iter := 0; iter < iterations; iter++ {
+		scale, momentum := 1.0, 0.8
+		if iter < exaggerationIters {
+			scale, momentum = exaggeration, 0.5
+		}
+
+		// Student-t similarities in the low dimensional space
+		var sum float64
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				dx, dy := y[i].X-y[j].X, y[i].Y-y[j].Y
+				v := 1 / (1 + dx*dx + dy*dy)
+				num[i][j], num[j][i] = v, v
+				sum += 2 * v
+			}
+		}
+
+		for i := 0; i < n; i++ {
+			var grad Point
+			for j := 0; j < n; j++ {
+				if i == j {
+					continue
+				}
+				mult := 4 * (scale*p[i][j] - math.Max(num[i][j]/sum, 1e-12)) * num[i][j]
+				grad.X += mult * (y[i].X - y[j].X)
+				grad.Y += mult * (y[i].Y - y[j].Y)
+			}
+
+			gains[i].X = updateGain(gains[i].X, grad.X, velocity[i].X)
+			gains[i].Y = updateGain(gains[i].Y, grad.Y, velocity[i].Y)
+			velocity[i].X = momentum*velocity[i].X - learningRate*gains[i].X*grad.X
+			velocity[i].Y = momentum*velocity[i].Y - learningRate*gains[i].Y*grad.Y
+		}
+
+		for i := range y {
+			y[i].X += velocity[i].X
+			y[i].Y += velocity[i].Y
+		}
+	}
+}
+
+// updateGain grows the step size of a coordinate while the gradient keeps
+// pointing the same way and shrinks it when it flips
+func updateGain(gain, grad, velocity float64) float64 {
+	if (grad > 0) != (velocity > 0) {
+		gain += 0.2
+	} else {
+		gain *= 0.8
+	}
+	return math.Max(gain, 0.01)
+}
+
+// jointProbabilities computes the symmetric t-SNE input similarities,
+// calibrating a Gaussian per point to the given perplexity
+func jointProbabilities(dist [][]float64, perplexity float64) [][]float64 {
+	n := len(dist)
+	p := make([][]float64, n)
+	for i := range p {
+		p[i] = conditionalProbabilities(dist[i], i, math.Log(perplexity))
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			v := math.Max((p[i][j]+p[j][i])/(2*float64(n)), 1e-12)
+			p[i][j], p[j][i] = v, v
+		}
+	}
+	return p
+}
+
+// conditionalProbabilities binary searches the precision of the Gaussian
+// around point self until the entropy of its neighbor distribution matches
+// targetEntropy
+func conditionalProbabilities(dist []float64, self int, targetEntropy float64) []float64 {
+	row := make([]float64, len(dist))
+	beta, lo, hi := 1.0, 0.0, math.Inf(1)
+
+	for attempt := 0; attempt < 50; attempt++ {
+		var sum, weighted float64
+		for j, d := range dist {
+			row[j] = 0
+			if j != self {
+				row[j] = math.Exp(-d * beta)
+				sum += row[j]
+				weighted += d * row[j]
+			}
+		}
+		if sum == 0 {
+			sum = 1e-12
+		}
+		entropy := math.Log(sum) + beta*weighted/sum
+		for j := range row {
+			row[j] /= sum
+		}
+
+		diff := entropy - targetEntropy
+		if math.Abs(diff) < 1e-5 {
+			break
+		}
+		if diff > 0 {
+			lo = beta
+			if math.IsInf(hi, 1) {
+				beta *= 2
+			} else {
+				beta = (beta + hi) / 2
+			}
+		} else {
+			hi = beta
+			beta = (beta + lo) / 2
+		}
+	}
+
+	return row
+}
+
+func squaredDistances(data [][]float32) [][]float64 {
+	n := len(data)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			var d float64
+			for k := range data[i] {
+				diff := float64(data[i][k]) - float64(data[j][k])
+				d += diff * diff
+			}
+			dist[i][j], dist[j][i] = d, d
+		}
+	}
+	return dist
+}
+
+// center subtracts the mean embedding from every embedding
+func center(data [][]float32) [][]float64 {
+	mean := make([]float64, len(data[0]))
+	for _, row := range data {
+		for k, v := range row {
+			mean[k] += float64(v)
+		}
+	}
+	for k := range mean {
+		mean[k] /= float64(len(data))
+	}
+
+	centered := make([][]float64, len(data))
+	for i, row := range data {
+		centered[i] = make([]float64, len(row))
+		for k, v := range row {
+			centered[i][k] = float64(v) - mean[k]
+		}
+	}
+	return centered
+}
+
+// principalComponent finds the direction of largest variance by power
+// iteration, orthogonal to exclude if given
+func principalComponent(data [][]float64, exclude []float64) []float64 {
+	dim := len(data[0])
+
+	// Start from the row farthest from the mean, which is never orthogonal
+	// to every component of interest
+	v := make([]float64, dim)
+	var longest float64
+	for _, row := range data {
+		if l := dot(row, row); l > longest {
+			longest = l
+			copy(v, row)
+		}
+	}
+	if longest == 0 {
+		v[0] = 1
+	}
+
+	for iter := 0; iter < 100; iter++ {
+		if exclude != nil {
+			orthogonalize(v, exclude)
+		}
+		if !normalize(v) {
+			break
+		}
+
+		// v = XᵀX v
+		next := make([]float64, dim)
+		for _, row := range data {
+			proj := dot(row, v)
+			for k := range next {
+				next[k] += proj * row[k]
+			}
+		}
+		v = next
+	}
+
+	if exclude != nil {
+		orthogonalize(v, exclude)
+	}
+	normalize(v)
+	return v
+}
+
+func orthogonalize(v, against []float64) {
+	proj := dot(v, against)
+	for k := range v {
+		v[k] -= proj * against[k]
+	}
+}
+
+// normalize scales v to unit length, reporting false if it is zero
+func normalize(v []float64) bool {
+	length := math.Sqrt(dot(v, v))
+	if length == 0 {
+		return false
+	}
+	for k := range v {
+		v[k] /= length
+	}
+	return true
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for k := range a {
+		sum += a[k] * b[k]
+	}
+	return sum
+}
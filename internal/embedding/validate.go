@@ -0,0 +1,115 @@
+package embedding
+
+import (
+	"fmt"
+	"math"
+
+	"face/matching"
+)
+
+// Kinds of Anomaly
+const (
+	// AnomalyDimension is an embedding of another dimension than expected
+	AnomalyDimension = "dimension"
+	// AnomalyNonFinite is an embedding with NaN or infinite values
+	AnomalyNonFinite = "non_finite"
+	// AnomalyOverflow is an embedding with values beyond the float32 range
+	// embeddings are stored in
+	AnomalyOverflow = "overflow"
+	// AnomalyOutOfRange is an embedding with values beyond Limits.MaxAbs
+	AnomalyOutOfRange = "out_of_range"
+	// AnomalyZero is an embedding of zero length, similar to nothing
+	AnomalyZero = "zero"
+	// AnomalyUnderflow is an embedding with values too small for a float32,
+	// stored as 0
+	AnomalyUnderflow = "underflow"
+	// AnomalyNotNormalized is an embedding whose length is not 1
+	AnomalyNotNormalized = "not_normalized"
+)
+
+// normTolerance is how far from 1 the length of a normalized embedding may
+// be, float32 rounding included
+const normTolerance = 1e-3
+
+// Anomaly is something wrong with an embedding
+type Anomaly struct {
+	Kind string `json:"kind"`
+	// Values is how many values are affected, for the kinds about values
+	Values int    `json:"values,omitempty"`
+	Detail string `json:"detail"`
+	// Fatal anomalies make an embedding unusable for matching; the others
+	// are worth knowing but harmless
+	Fatal bool `json:"fatal"`
+}
+
+// Limits are what Validate expects of embeddings
+type Limits struct {
+	// Dimension is the length embeddings must have, unchecked if 0
+	Dimension int
+	// MaxAbs bounds the magnitude of values, unchecked if 0, e.g. 1 for a
+	// model whose embeddings are normalized
+	MaxAbs float64
+	// Normalized reports embeddings whose length is not 1
+	Normalized bool
+}
+
+// Validate returns the anomalies of an embedding under limits, fatal ones
+// first
+func Validate(e []float32, limits Limits) []Anomaly {
+	var anomalies []Anomaly
+	if limits.Dimension > 0 && len(e) != limits.Dimension {
+		anomalies = append(anomalies, Anomaly{Kind: AnomalyDimension, Fatal: true,
+			Detail: fmt.Sprintf("%d-d, expected %d-d", len(e), limits.Dimension)})
+	}
+
+	nonFinite, outOfRange := 0, 0
+	for _, v := range e {
+		switch {
+		case math.IsNaN(float64(v)) || math.IsInf(float64(v), 0):
+			nonFinite++
+		case limits.MaxAbs > 0 && math.Abs(float64(v)) > limits.MaxAbs:
+			outOfRange++
+		}
+	}
+	if nonFinite > 0 {
+		anomalies = append(anomalies, Anomaly{Kind: AnomalyNonFinite, Values: nonFinite, Fatal: true,
+			Detail: fmt.Sprintf("%d NaN or infinite value(s)", nonFinite)})
+		return anomalies
+	}
+	if outOfRange > 0 {
+		anomalies = append(anomalies, Anomaly{Kind: AnomalyOutOfRange, Values: outOfRange, Fatal: true,
+			Detail: fmt.Sprintf("%d value(s) beyond ±%g", outOfRange, limits.MaxAbs)})
+	}
+
+	norm := matching.Norm(e)
+	switch {
+	case norm == 0:
+		anomalies = append(anomalies, Anomaly{Kind: AnomalyZero, Fatal: true, Detail: "all values are 0"})
+	case limits.Normalized && math.Abs(norm-1) > normTolerance:
+		anomalies = append(anomalies, Anomaly{Kind: AnomalyNotNormalized, Detail: fmt.Sprintf("length %.4f", norm)})
+	}
+	return anomalies
+}
+
+// Normalize scales an embedding to length 1, reporting whether it changed;
+// embeddings of zero length or with non-finite values are left as they are
+func Normalize(e []float32) bool {
+	norm := matching.Norm(e)
+	if norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) || math.Abs(norm-1) <= normTolerance/10 {
+		return false
+	}
+	for i := range e {
+		e[i] = float32(float64(e[i]) / norm)
+	}
+	return true
+}
+
+// Fatal reports whether any of the anomalies is fatal
+func Fatal(anomalies []Anomaly) bool {
+	for _, a := range anomalies {
+		if a.Fatal {
+			return true
+		}
+	}
+	return false
+}
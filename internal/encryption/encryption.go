@@ -0,0 +1,127 @@
+// Package encryption encrypts face images, embeddings and second factor
+// secrets at rest with AES-256-GCM. Encrypted data starts with a marker and
+// is bound to where it is stored, e.g. the face an embedding belongs to, so
+// it does not decrypt when copied to another record. Data stored before
+// encryption was enabled is only read while migrating, see AllowPlaintext.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of the AES-256 key
+const KeySize = 32
+
+// marker starts every encrypted value; the nonce and the sealed data
+// follow
+const marker = "FACEENC1"
+
+// ErrKeyRequired is returned when encrypted data is read without a key
+var ErrKeyRequired = errors.New("face data is encrypted, but no encryption key is configured")
+
+// ErrWrongKey is returned when encrypted data does not decrypt with the key
+var ErrWrongKey = errors.New("face data does not decrypt with the encryption key, or was modified or moved")
+
+// ErrNotEncrypted is returned when data that is not encrypted is read with
+// a key, e.g. data stored before the key was set
+var ErrNotEncrypted = errors.New("face data is not encrypted, although an encryption key is configured (set encryption_migrating to read it until it is encrypted)")
+
+// Key encrypts and decrypts stored data. A nil Key stores data as it is
+// and only reads data that is not encrypted.
+type Key struct {
+	aead cipher.AEAD
+	// plaintext reads data that is not encrypted as it is
+	plaintext bool
+}
+
+// ParseKey returns the key of its hex encoding, 64 hex digits, e.g. made
+// with 'openssl rand -hex 32'
+func ParseKey(s string) (*Key, error) {
+	secret, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(secret) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d hex digits", 2*KeySize)
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return &Key{aead: aead}, nil
+}
+
+// AllowPlaintext returns a copy of the key that reads data that is not
+// encrypted as it is, instead of failing with ErrNotEncrypted, while the
+// data stored before the key was set is encrypted
+func (k *Key) AllowPlaintext() *Key {
+	if k == nil {
+		return nil
+	}
+	allowed := *k
+	allowed.plaintext = true
+	return &allowed
+}
+
+// Encrypted reports whether data was encrypted by a Key
+func Encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(marker))
+}
+
+// additionalData returns the data authenticated with the sealed data:
+// the marker and what the data is bound to
+func additionalData(context []byte) []byte {
+	return append([]byte(marker), context...)
+}
+
+// Seal encrypts data, with a random nonce, bound to context, e.g. the ID of
+// the record it is stored in; Open must be given the same context
+func (k *Key) Seal(data, context []byte) ([]byte, error) {
+	if k == nil {
+		return data, nil
+	}
+
+	nonceSize := k.aead.NonceSize()
+	out := make([]byte, len(marker)+nonceSize, len(marker)+nonceSize+len(data)+k.aead.Overhead())
+	copy(out, marker)
+	nonce := out[len(marker):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.aead.Seal(out, nonce, data, additionalData(context)), nil
+}
+
+// Open decrypts data sealed by Seal with the same context. Data that is
+// not encrypted is returned as it is without a key, or with a key that
+// allows plaintext; otherwise it is ErrNotEncrypted.
+func (k *Key) Open(data, context []byte) ([]byte, error) {
+	if !Encrypted(data) {
+		if k != nil && !k.plaintext {
+			return nil, ErrNotEncrypted
+		}
+		return data, nil
+	}
+	if k == nil {
+		return nil, ErrKeyRequired
+	}
+
+	sealed := data[len(marker):]
+	nonceSize := k.aead.NonceSize()
+	if len(sealed) < nonceSize+k.aead.Overhead() {
+		return nil, ErrWrongKey
+	}
+	plain, err := k.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], additionalData(context))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
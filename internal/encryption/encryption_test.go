@@ -0,0 +1,93 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T, digit string) *Key {
+	t.Helper()
+	key, err := ParseKey(strings.Repeat(digit, 2*KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestSealBindsContext checks that sealed data opens only with the context
+// it was sealed with, so data copied to another record is refused
+func TestSealBindsContext(t *testing.T) {
+	key := testKey(t, "a")
+	data := []byte("embedding of face 1")
+
+	sealed, err := key.Seal(data, []byte("face-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Encrypted(sealed) || bytes.Contains(sealed, data) {
+		t.Fatalf("data is not encrypted: %q", sealed)
+	}
+
+	plain, err := key.Open(sealed, []byte("face-1"))
+	if err != nil {
+		t.Fatalf("open with the same context: %v", err)
+	}
+	if !bytes.Equal(plain, data) {
+		t.Errorf("opened %q, want %q", plain, data)
+	}
+
+	for _, context := range []string{"face-2", "", "face-1 "} {
+		if _, err := key.Open(sealed, []byte(context)); !errors.Is(err, ErrWrongKey) {
+			t.Errorf("open with context %q: got %v, want ErrWrongKey", context, err)
+		}
+	}
+}
+
+// TestOpenRefuses checks the errors of data that cannot be opened
+func TestOpenRefuses(t *testing.T) {
+	key := testKey(t, "a")
+	sealed, err := key.Seal([]byte("secret"), []byte("user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		key  *Key
+		data []byte
+		want error
+	}{
+		{"other key", testKey(t, "b"), sealed, ErrWrongKey},
+		{"tampered", key, tampered, ErrWrongKey},
+		{"truncated", key, sealed[:len(marker)+4], ErrWrongKey},
+		{"no key", nil, sealed, ErrKeyRequired},
+		{"plaintext", key, []byte("secret"), ErrNotEncrypted},
+	}
+	for _, tt := range tests {
+		if _, err := tt.key.Open(tt.data, []byte("user-1")); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestAllowPlaintext checks that a migrating key reads plaintext as it is
+// and still opens sealed data
+func TestAllowPlaintext(t *testing.T) {
+	key := testKey(t, "a").AllowPlaintext()
+	plain, err := key.Open([]byte("old data"), []byte("user-1"))
+	if err != nil || string(plain) != "old data" {
+		t.Fatalf("got %q, %v; want the data as it is", plain, err)
+	}
+
+	sealed, err := key.Seal([]byte("new data"), []byte("user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := key.Open(sealed, []byte("user-1")); err != nil || string(plain) != "new data" {
+		t.Errorf("got %q, %v; want the new data", plain, err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package erasure records the erasure of a user by 'face purge' in a
+// receipt: what was deleted, with hashes of the data so a copy found later
+// can be matched against it, and when. The receipt is covered by a digest,
+// HMAC-signed when a key is configured, so it cannot be changed unnoticed.
+// The package also shreds files that held copies of the erased data.
+package erasure
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// ReceiptVersion is the version of the receipt format
+const ReceiptVersion = 1
+
+// Actions taken on a file
+const (
+	// ActionDeleted is a file or object deleted through its storage
+	ActionDeleted = "deleted"
+	// ActionShredded is a file overwritten with random data before it was
+	// removed
+	ActionShredded = "shredded"
+)
+
+var (
+	// ErrTampered is returned when a receipt changed after it was written
+	ErrTampered = errors.New("receipt changed after it was written")
+	// ErrUnsigned is returned for an unsigned receipt when a key is
+	// configured, since anyone can write an unsigned receipt
+	ErrUnsigned = errors.New("receipt is not signed")
+	// ErrNoKey is returned for a signed receipt when no key is configured
+	// to check the signature
+	ErrNoKey = errors.New("receipt is signed but no key is configured")
+)
+
+// Receipt is the proof of erasure of a user. It holds no personal data but
+// the user ID; the name and the embeddings are hashed.
+type Receipt struct {
+	Version int    `json:"version"`
+	ID      string `json:"receipt_id"`
+	UserID  string `json:"user_id"`
+	// NameSHA256 is the hash of the user's name as stored
+	NameSHA256 string `json:"name_sha256"`
+	// Operator is the login of the user who ran the purge
+	Operator    string    `json:"operator,omitempty"`
+	Database    string    `json:"database"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+	Faces       []Face    `json:"faces"`
+	Files       []File    `json:"files"`
+	// Digest covers every other field; it is an HMAC-SHA256 when Signed,
+	// a plain SHA-256 otherwise
+	Digest string `json:"digest"`
+	Signed bool   `json:"signed"`
+}
+
+// Face is an erased face
+type Face struct {
+	ID              string `json:"face_id"`
+	EmbeddingSHA256 string `json:"embedding_sha256"`
+}
+
+// File is an erased image or copy of the database
+type File struct {
+	Path string `json:"path"`
+	// SHA256 is the hash of the contents before erasure, empty if they
+	// could not be read
+	SHA256   string    `json:"sha256,omitempty"`
+	Action   string    `json:"action"`
+	ErasedAt time.Time `json:"erased_at"`
+}
+
+// HashString returns the hex SHA-256 of a string
+func HashString(s string) string {
+	return HashBytes([]byte(s))
+}
+
+// HashBytes returns the hex SHA-256 of data
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashEmbedding returns the hex SHA-256 of an embedding's float32 values in
+// little-endian order, as in gallery bundles
+func HashEmbedding(e []float32) string {
+	data := make([]byte, 4*len(e))
+	for i, v := range e {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+	}
+	return HashBytes(data)
+}
+
+// Seal sets the digest of the receipt, signing it with key if not empty
+func (r *Receipt) Seal(key []byte) error {
+	r.Signed = len(key) > 0
+	digest, err := r.digest(key)
+	if err != nil {
+		return err
+	}
+	r.Digest = digest
+	return nil
+}
+
+// Check checks the digest of the receipt with key, which must be the key it
+// was signed with
+func (r *Receipt) Check(key []byte) error {
+	switch {
+	case r.Signed && len(key) == 0:
+		return ErrNoKey
+	case !r.Signed && len(key) > 0:
+		return ErrUnsigned
+	}
+	digest, err := r.digest(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(digest), []byte(r.Digest)) {
+		return ErrTampered
+	}
+	return nil
+}
+
+// digest returns the hex digest of the receipt's JSON without the digest
+func (r *Receipt) digest(key []byte) (string, error) {
+	unsealed := *r
+	unsealed.Digest = ""
+	data, err := json.Marshal(&unsealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode receipt: %w", err)
+	}
+
+	var h hash.Hash
+	if r.Signed {
+		h = hmac.New(sha256.New, key)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Shred overwrites a file with random data, syncs it to disk and removes
+// it, returning the hash of its previous contents. It returns false if the
+// file does not exist. Copy-on-write file systems and SSDs may keep the old
+// blocks regardless.
+func Shred(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	_, err = io.CopyN(file, rand.Reader, int64(len(data)))
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to overwrite %s: %w", path, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return "", false, fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return HashBytes(data), true, nil
+}
@@ -0,0 +1,137 @@
+package erasure
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testReceipt() *Receipt {
+	now := time.Date(2024, 6, 3, 9, 12, 44, 0, time.UTC)
+	return &Receipt{
+		Version:     ReceiptVersion,
+		ID:          "0b5e0c52-3f0e-4d8a-9c41-7a9f2f1b6d10",
+		UserID:      "1c7c769f-fc5c-4ac4-b163-e125dc63a318",
+		NameSHA256:  HashString("Alice"),
+		Database:    "sqlite",
+		StartedAt:   now,
+		CompletedAt: now.Add(time.Second),
+		Faces:       []Face{{ID: "f1", EmbeddingSHA256: HashEmbedding([]float32{0.5, -0.25})}},
+		Files:       []File{{Path: "faces/f1.jpg", SHA256: HashString("jpeg"), Action: ActionDeleted, ErasedAt: now}},
+	}
+}
+
+// TestReceiptDigest checks that a sealed receipt checks with the key it was
+// sealed with, also after a round trip through JSON, and no other
+func TestReceiptDigest(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("receipt key")} {
+		r := testReceipt()
+		if err := r.Seal(key); err != nil {
+			t.Fatal(err)
+		}
+		if r.Signed != (key != nil) {
+			t.Errorf("key %q: signed %v", key, r.Signed)
+		}
+
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var read Receipt
+		if err := json.Unmarshal(data, &read); err != nil {
+			t.Fatal(err)
+		}
+		if err := read.Check(key); err != nil {
+			t.Errorf("key %q: check after JSON: %v", key, err)
+		}
+	}
+
+	signed := testReceipt()
+	if err := signed.Seal([]byte("receipt key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := signed.Check([]byte("other key")); !errors.Is(err, ErrTampered) {
+		t.Errorf("other key: got %v, want ErrTampered", err)
+	}
+	if err := signed.Check(nil); !errors.Is(err, ErrNoKey) {
+		t.Errorf("no key: got %v, want ErrNoKey", err)
+	}
+
+	unsigned := testReceipt()
+	if err := unsigned.Seal(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := unsigned.Check([]byte("receipt key")); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned with a key: got %v, want ErrUnsigned", err)
+	}
+}
+
+// TestReceiptTampered checks that changing any part of a sealed receipt is
+// noticed, including turning a signed receipt into an unsigned one
+func TestReceiptTampered(t *testing.T) {
+	key := []byte("receipt key")
+	changes := map[string]func(r *Receipt){
+		"user":      func(r *Receipt) { r.UserID = "someone else" },
+		"completed": func(r *Receipt) { r.CompletedAt = r.CompletedAt.Add(time.Hour) },
+		"face":      func(r *Receipt) { r.Faces[0].EmbeddingSHA256 = HashString("other") },
+		"file":      func(r *Receipt) { r.Files[0].Action = ActionShredded },
+		"dropped":   func(r *Receipt) { r.Files = nil },
+	}
+	for name, change := range changes {
+		r := testReceipt()
+		if err := r.Seal(key); err != nil {
+			t.Fatal(err)
+		}
+		change(r)
+		if err := r.Check(key); !errors.Is(err, ErrTampered) {
+			t.Errorf("%s changed: got %v, want ErrTampered", name, err)
+		}
+	}
+
+	r := testReceipt()
+	if err := r.Seal(key); err != nil {
+		t.Fatal(err)
+	}
+	r.UserID = "someone else"
+	if err := r.Seal(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Check(key); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("resealed unsigned: got %v, want ErrUnsigned", err)
+	}
+}
+
+// TestHashEmbedding checks the hash of the little-endian float32 values
+func TestHashEmbedding(t *testing.T) {
+	// 1.0 is 0x3f800000, so the bytes 00 00 80 3f
+	if got, want := HashEmbedding([]float32{1}), HashBytes([]byte{0, 0, 0x80, 0x3f}); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// TestShred checks that a shredded file is gone and its hash is that of
+// its contents before
+func TestShred(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "face.json.backup")
+	if err := os.WriteFile(path, []byte("copy of the database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, ok, err := Shred(path)
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v; want the file shredded", ok, err)
+	}
+	if sum != HashString("copy of the database") {
+		t.Errorf("hash %s is not that of the contents", sum)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file still exists: %v", err)
+	}
+
+	if _, ok, err := Shred(path); ok || err != nil {
+		t.Errorf("missing file: got %v, %v; want false, nil", ok, err)
+	}
+}
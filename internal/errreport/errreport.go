@@ -0,0 +1,103 @@
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// flushTimeout bounds how long reporting may delay process exit
+const flushTimeout = 2 * time.Second
+
+// Config describes the error reporting destination. Reporting is disabled
+// when DSN is empty.
+type Config struct {
+	DSN         string
+	Environment string
+	Release     string
+}
+
+// Context describes where an error happened. Empty fields are not sent.
+type Context struct {
+	Command string
+	Tags    map[string]string
+}
+
+var enabled bool
+
+// Init enables error reporting. It does nothing when no DSN is configured.
+func Init(cfg Config) error {
+	if cfg.DSN == "" {
+		return nil
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         cfg.DSN,
+		Environment: cfg.Environment,
+		Release:     cfg.Release,
+		// Only errors are reported; never attach request bodies, images or
+		// other potentially biometric data
+		SendDefaultPII: false,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize error reporting: %w", err)
+	}
+
+	enabled = true
+	return nil
+}
+
+// Enabled reports whether errors are being sent
+func Enabled() bool {
+	return enabled
+}
+
+// SetContext records where subsequent errors happen, e.g. the running
+// command or a camera name
+func SetContext(ctx Context) {
+	if !enabled {
+		return
+	}
+
+	sentry.ConfigureScope(func(scope *sentry.Scope) {
+		if ctx.Command != "" {
+			scope.SetTag("command", ctx.Command)
+		}
+		for key, value := range ctx.Tags {
+			if value != "" {
+				scope.SetTag(key, value)
+			}
+		}
+	})
+}
+
+// CaptureError reports an error
+func CaptureError(err error) {
+	if !enabled || err == nil {
+		return
+	}
+	sentry.CaptureException(err)
+}
+
+// Recover reports a panic and re-panics. It must be deferred directly:
+// 'defer errreport.Recover()'.
+func Recover() {
+	if !enabled {
+		return
+	}
+
+	if r := recover(); r != nil {
+		sentry.CurrentHub().RecoverWithContext(context.Background(), r)
+		Flush()
+		panic(r)
+	}
+}
+
+// Flush waits for queued reports to be sent
+func Flush() {
+	if enabled {
+		sentry.Flush(flushTimeout)
+	}
+}
@@ -0,0 +1,198 @@
+// Package evaluation measures how well a model and a threshold identify
+// people in a labeled dataset: some images of each person are enrolled, the
+// others are identified against them, and the decisions are compared with
+// the labels.
+package evaluation
+
+import (
+	"cmp"
+	"slices"
+
+	"face/matching"
+)
+
+// Probe is an image identified against the enrolled people
+type Probe struct {
+	Image  string `json:"image"`
+	Person string `json:"person"`
+	// Enrolled is false for people with no enrolled images, who should not
+	// be identified as anyone
+	Enrolled  bool      `json:"enrolled"`
+	Embedding []float32 `json:"-"`
+}
+
+// Result is the closest enrolled person to a probe
+type Result struct {
+	Probe
+	// Predicted is the closest enrolled person, empty if none is enrolled
+	Predicted  string  `json:"predicted"`
+	Confidence float64 `json:"confidence"`
+	// Rank1 is whether the closest person is the probe's own, whatever the
+	// threshold
+	Rank1 bool `json:"rank1"`
+}
+
+// Accepted reports whether the result is a match at the threshold
+func (r Result) Accepted(threshold float64) bool {
+	return r.Predicted != "" && matching.Matches(r.Confidence, threshold)
+}
+
+// Identify ranks the enrolled people for each probe, scoring them with the
+// strategy. People are the candidates' names.
+func Identify(strategy matching.Strategy, enrolled []matching.Candidate, probes []Probe) []Result {
+	results := make([]Result, len(probes))
+	for i, p := range probes {
+		results[i] = Result{Probe: p}
+		scores := strategy.Rank(p.Embedding, enrolled, 1)
+		if len(scores) == 0 {
+			continue
+		}
+		results[i].Predicted, results[i].Confidence = scores[0].Name, scores[0].Confidence
+		results[i].Rank1 = p.Enrolled && scores[0].Name == p.Person
+	}
+	return results
+}
+
+// Metrics are the decisions at a threshold. A probe of an enrolled person
+// is a true positive when accepted as them, a false positive when accepted
+// as someone else and a false negative when rejected; a probe of someone
+// not enrolled is a false positive when accepted and a true negative when
+// rejected.
+type Metrics struct {
+	Threshold      float64 `json:"threshold"`
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	TrueNegatives  int     `json:"true_negatives"`
+	// Accuracy is the share of probes decided correctly
+	Accuracy float64 `json:"accuracy"`
+	// Precision is the share of accepted probes accepted as the right
+	// person
+	Precision float64 `json:"precision"`
+	// Recall is the share of probes of enrolled people accepted as them
+	Recall float64 `json:"recall"`
+}
+
+// At returns the metrics of the results at a threshold
+func At(results []Result, threshold float64) Metrics {
+	m := Metrics{Threshold: threshold}
+	enrolled := 0
+	for _, r := range results {
+		if r.Enrolled {
+			enrolled++
+		}
+		accepted := r.Accepted(threshold)
+		switch {
+		case accepted && r.Rank1:
+			m.TruePositives++
+		case accepted:
+			m.FalsePositives++
+		case r.Enrolled:
+			m.FalseNegatives++
+		default:
+			m.TrueNegatives++
+		}
+	}
+	m.Accuracy = share(m.TruePositives+m.TrueNegatives, len(results))
+	m.Precision = share(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = share(m.TruePositives, enrolled)
+	return m
+}
+
+// Rank1Rate returns the share of probes of enrolled people whose closest
+// enrolled person is their own, the rank-1 identification rate
+func Rank1Rate(results []Result) float64 {
+	enrolled, rank1 := 0, 0
+	for _, r := range results {
+		if r.Enrolled {
+			enrolled++
+		}
+		if r.Rank1 {
+			rank1++
+		}
+	}
+	return share(rank1, enrolled)
+}
+
+// Confusion is how the probes of one person were decided at a threshold
+type Confusion struct {
+	Person   string `json:"person"`
+	Enrolled bool   `json:"enrolled"`
+	Probes   int    `json:"probes"`
+	Correct  int    `json:"correct"`
+	Rejected int    `json:"rejected"`
+	// MistakenFor counts the probes accepted as each other person
+	MistakenFor map[string]int `json:"mistaken_for,omitempty"`
+	// MistakenBy counts the probes of other people accepted as this one
+	MistakenBy map[string]int `json:"mistaken_by,omitempty"`
+}
+
+// Errors returns how many probes of the person were decided wrongly, or
+// of others were mistaken for them
+func (c Confusion) Errors() int {
+	return c.Probes - c.Correct + sum(c.MistakenBy)
+}
+
+// Confusions returns the confusion of every person with probes or mistaken
+// for someone, those with the most errors first, then by name
+func Confusions(results []Result, threshold float64) []Confusion {
+	people := make(map[string]*Confusion)
+	person := func(name string, enrolled bool) *Confusion {
+		c, ok := people[name]
+		if !ok {
+			c = &Confusion{Person: name, Enrolled: enrolled}
+			people[name] = c
+		}
+		return c
+	}
+
+	for _, r := range results {
+		c := person(r.Person, r.Enrolled)
+		c.Probes++
+		accepted := r.Accepted(threshold)
+		switch {
+		case accepted && r.Rank1:
+			c.Correct++
+		case accepted:
+			count(&c.MistakenFor, r.Predicted)
+			count(&person(r.Predicted, true).MistakenBy, r.Person)
+		case r.Enrolled:
+			c.Rejected++
+		default:
+			c.Correct++
+		}
+	}
+
+	confusions := make([]Confusion, 0, len(people))
+	for _, c := range people {
+		confusions = append(confusions, *c)
+	}
+	slices.SortFunc(confusions, func(a, b Confusion) int {
+		return cmp.Or(cmp.Compare(b.Errors(), a.Errors()), cmp.Compare(a.Person, b.Person))
+	})
+	return confusions
+}
+
+// count adds one to the count of key, making the map if needed
+func count(counts *map[string]int, key string) {
+	if *counts == nil {
+		*counts = make(map[string]int)
+	}
+	(*counts)[key]++
+}
+
+func sum(counts map[string]int) int {
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// share returns n of total as a fraction, 0 of none
+func share(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
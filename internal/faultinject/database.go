@@ -0,0 +1,454 @@
+package faultinject
+
+import (
+	"strings"
+	"time"
+
+	"face/internal/database"
+	"face/internal/database/models"
+	"face/internal/erasure"
+)
+
+// faultyDatabase fails database operations at random
+type faultyDatabase struct {
+	db  database.Database
+	inj *Injector
+}
+
+// WrapDatabase returns a database whose operations fail with the
+// probability configured for the db component
+func WrapDatabase(db database.Database, inj *Injector) database.Database {
+	return &faultyDatabase{db: db, inj: inj}
+}
+
+func (f *faultyDatabase) CreateUser(user *models.User) error {
+	if err := f.inj.Fail(Database, "CreateUser"); err != nil {
+		return err
+	}
+	return f.db.CreateUser(user)
+}
+
+func (f *faultyDatabase) GetUser(id string) (*models.User, error) {
+	if err := f.inj.Fail(Database, "GetUser"); err != nil {
+		return nil, err
+	}
+	return f.db.GetUser(id)
+}
+
+func (f *faultyDatabase) GetUserByName(name string) (*models.User, error) {
+	if err := f.inj.Fail(Database, "GetUserByName"); err != nil {
+		return nil, err
+	}
+	return f.db.GetUserByName(name)
+}
+
+func (f *faultyDatabase) ListUsersByName(name string) ([]models.User, error) {
+	if err := f.inj.Fail(Database, "ListUsersByName"); err != nil {
+		return nil, err
+	}
+	return f.db.ListUsersByName(name)
+}
+
+func (f *faultyDatabase) UserExistsByName(name string) (bool, error) {
+	if err := f.inj.Fail(Database, "UserExistsByName"); err != nil {
+		return false, err
+	}
+	return f.db.UserExistsByName(name)
+}
+
+func (f *faultyDatabase) UpdateUser(user *models.User) error {
+	if err := f.inj.Fail(Database, "UpdateUser"); err != nil {
+		return err
+	}
+	return f.db.UpdateUser(user)
+}
+
+func (f *faultyDatabase) DeleteUser(id string) error {
+	if err := f.inj.Fail(Database, "DeleteUser"); err != nil {
+		return err
+	}
+	return f.db.DeleteUser(id)
+}
+
+func (f *faultyDatabase) ListUsers() ([]models.User, error) {
+	if err := f.inj.Fail(Database, "ListUsers"); err != nil {
+		return nil, err
+	}
+	return f.db.ListUsers()
+}
+
+func (f *faultyDatabase) SoftDeleteUser(id string) error {
+	if err := f.inj.Fail(Database, "SoftDeleteUser"); err != nil {
+		return err
+	}
+	return f.db.SoftDeleteUser(id)
+}
+
+func (f *faultyDatabase) RestoreUser(id string) error {
+	if err := f.inj.Fail(Database, "RestoreUser"); err != nil {
+		return err
+	}
+	return f.db.RestoreUser(id)
+}
+
+func (f *faultyDatabase) ListDeletedUsers() ([]models.User, error) {
+	if err := f.inj.Fail(Database, "ListDeletedUsers"); err != nil {
+		return nil, err
+	}
+	return f.db.ListDeletedUsers()
+}
+
+func (f *faultyDatabase) AddFace(userID string, face *models.Face) (*models.Face, error) {
+	if err := f.inj.Fail(Database, "AddFace"); err != nil {
+		return nil, err
+	}
+	return f.db.AddFace(userID, face)
+}
+
+func (f *faultyDatabase) RemoveFace(userID, faceID string) error {
+	if err := f.inj.Fail(Database, "RemoveFace"); err != nil {
+		return err
+	}
+	return f.db.RemoveFace(userID, faceID)
+}
+
+func (f *faultyDatabase) UpdateFaceFilename(userID, faceID, filename string) error {
+	if err := f.inj.Fail(Database, "UpdateFaceFilename"); err != nil {
+		return err
+	}
+	return f.db.UpdateFaceFilename(userID, faceID, filename)
+}
+
+func (f *faultyDatabase) SetFaceLabel(userID, faceID, label string) error {
+	if err := f.inj.Fail(Database, "SetFaceLabel"); err != nil {
+		return err
+	}
+	return f.db.SetFaceLabel(userID, faceID, label)
+}
+
+func (f *faultyDatabase) SetUserAvatar(userID, filename string) error {
+	if err := f.inj.Fail(Database, "SetUserAvatar"); err != nil {
+		return err
+	}
+	return f.db.SetUserAvatar(userID, filename)
+}
+
+func (f *faultyDatabase) SetPrimaryFace(userID, faceID string) error {
+	if err := f.inj.Fail(Database, "SetPrimaryFace"); err != nil {
+		return err
+	}
+	return f.db.SetPrimaryFace(userID, faceID)
+}
+
+func (f *faultyDatabase) GetAllEmbeddings() (map[string][]models.Face, error) {
+	if err := f.inj.Fail(Database, "GetAllEmbeddings"); err != nil {
+		return nil, err
+	}
+	return f.db.GetAllEmbeddings()
+}
+
+func (f *faultyDatabase) ReplaceEmbeddings(embeddings map[string]models.Embedding, model string, dimension int) error {
+	if err := f.inj.Fail(Database, "ReplaceEmbeddings"); err != nil {
+		return err
+	}
+	return f.db.ReplaceEmbeddings(embeddings, model, dimension)
+}
+
+func (f *faultyDatabase) GetSettings() (*models.Settings, error) {
+	if err := f.inj.Fail(Database, "GetSettings"); err != nil {
+		return nil, err
+	}
+	return f.db.GetSettings()
+}
+
+func (f *faultyDatabase) UpdateSettings(settings *models.Settings) error {
+	if err := f.inj.Fail(Database, "UpdateSettings"); err != nil {
+		return err
+	}
+	return f.db.UpdateSettings(settings)
+}
+
+// ChangesSince reads the change log if the wrapped database has one
+func (f *faultyDatabase) ChangesSince(seq int64, limit int) ([]models.Change, error) {
+	changeLog, ok := f.db.(database.ChangeLog)
+	if !ok {
+		return nil, database.ErrChangeLogUnsupported
+	}
+	if err := f.inj.Fail(Database, "ChangesSince"); err != nil {
+		return nil, err
+	}
+	return changeLog.ChangesSince(seq, limit)
+}
+
+// LatestChange reads the change log if the wrapped database has one
+func (f *faultyDatabase) LatestChange() (int64, error) {
+	changeLog, ok := f.db.(database.ChangeLog)
+	if !ok {
+		return 0, database.ErrChangeLogUnsupported
+	}
+	if err := f.inj.Fail(Database, "LatestChange"); err != nil {
+		return 0, err
+	}
+	return changeLog.LatestChange()
+}
+
+// LogIdentification records an identification if the wrapped database
+// can
+func (f *faultyDatabase) LogIdentification(identification *models.Identification) error {
+	log, ok := f.db.(database.IdentificationLog)
+	if !ok {
+		return database.ErrIdentificationLogUnsupported
+	}
+	if err := f.inj.Fail(Database, "LogIdentification"); err != nil {
+		return err
+	}
+	return log.LogIdentification(identification)
+}
+
+// ShredCopies shreds the copies of the wrapped database if it has any
+func (f *faultyDatabase) ShredCopies() ([]erasure.File, error) {
+	shredder, ok := f.db.(database.CopyShredder)
+	if !ok {
+		return nil, database.ErrShreddingUnsupported
+	}
+	if err := f.inj.Fail(Database, "ShredCopies"); err != nil {
+		return nil, err
+	}
+	return shredder.ShredCopies()
+}
+
+// auditLog returns the audit log of the wrapped database, failing like
+// the database does
+func (f *faultyDatabase) auditLog(method string) (database.AuditLog, error) {
+	log, ok := f.db.(database.AuditLog)
+	if !ok {
+		return nil, database.ErrAuditLogUnsupported
+	}
+	return log, f.inj.Fail(Database, method)
+}
+
+// LogAuditEvent records an audit event if the wrapped database can
+func (f *faultyDatabase) LogAuditEvent(event *models.AuditEvent) error {
+	log, err := f.auditLog("LogAuditEvent")
+	if err != nil {
+		return err
+	}
+	return log.LogAuditEvent(event)
+}
+
+// AuditEvents reads the audit log if the wrapped database has one
+func (f *faultyDatabase) AuditEvents(filter database.AuditFilter) ([]models.AuditEvent, error) {
+	log, err := f.auditLog("AuditEvents")
+	if err != nil {
+		return nil, err
+	}
+	return log.AuditEvents(filter)
+}
+
+// PurgeAuditEvents purges the audit log if the wrapped database has one
+func (f *faultyDatabase) PurgeAuditEvents(before time.Time) (int64, error) {
+	log, err := f.auditLog("PurgeAuditEvents")
+	if err != nil {
+		return 0, err
+	}
+	return log.PurgeAuditEvents(before)
+}
+
+// probeStore returns the probe store of the wrapped database, failing like
+// the database does
+func (f *faultyDatabase) probeStore(method string) (database.ProbeStore, error) {
+	store, ok := f.db.(database.ProbeStore)
+	if !ok {
+		return nil, database.ErrProbeStoreUnsupported
+	}
+	return store, f.inj.Fail(Database, method)
+}
+
+// SaveProbe saves a probe if the wrapped database can
+func (f *faultyDatabase) SaveProbe(probe *models.Probe) error {
+	store, err := f.probeStore("SaveProbe")
+	if err != nil {
+		return err
+	}
+	return store.SaveProbe(probe)
+}
+
+// GetProbe reads a probe if the wrapped database keeps them
+func (f *faultyDatabase) GetProbe(id string) (*models.Probe, error) {
+	store, err := f.probeStore("GetProbe")
+	if err != nil {
+		return nil, err
+	}
+	return store.GetProbe(id)
+}
+
+// DeleteProbes deletes probes if the wrapped database keeps them
+func (f *faultyDatabase) DeleteProbes(filter database.ProbeFilter) ([]models.Probe, error) {
+	store, err := f.probeStore("DeleteProbes")
+	if err != nil {
+		return nil, err
+	}
+	return store.DeleteProbes(filter)
+}
+
+// scopeStore returns the scope store of the wrapped database, failing like
+// the database does
+func (f *faultyDatabase) scopeStore(method string) (database.ScopeStore, error) {
+	store, ok := f.db.(database.ScopeStore)
+	if !ok {
+		return nil, database.ErrScopeStoreUnsupported
+	}
+	return store, f.inj.Fail(Database, method)
+}
+
+// CreateScope adds a scope if the wrapped database keeps them
+func (f *faultyDatabase) CreateScope(scope *models.Scope) error {
+	store, err := f.scopeStore("CreateScope")
+	if err != nil {
+		return err
+	}
+	return store.CreateScope(scope)
+}
+
+// ListScopes lists the scopes if the wrapped database keeps them
+func (f *faultyDatabase) ListScopes() ([]models.Scope, error) {
+	store, err := f.scopeStore("ListScopes")
+	if err != nil {
+		return nil, err
+	}
+	return store.ListScopes()
+}
+
+// DeleteScope deletes a scope if the wrapped database keeps them
+func (f *faultyDatabase) DeleteScope(path string) error {
+	store, err := f.scopeStore("DeleteScope")
+	if err != nil {
+		return err
+	}
+	return store.DeleteScope(path)
+}
+
+// SetUserScopes assigns a user to scopes if the wrapped database keeps them
+func (f *faultyDatabase) SetUserScopes(userID string, scopes []string) error {
+	store, err := f.scopeStore("SetUserScopes")
+	if err != nil {
+		return err
+	}
+	return store.SetUserScopes(userID, scopes)
+}
+
+// imageStore returns the image store of the wrapped database, failing like
+// the database does
+func (f *faultyDatabase) imageStore(method string) (database.ImageStore, error) {
+	store, ok := f.db.(database.ImageStore)
+	if !ok {
+		return nil, database.ErrImageStoreUnsupported
+	}
+	return store, f.inj.Fail(Database, method)
+}
+
+// PutImageData stores an image if the wrapped database can
+func (f *faultyDatabase) PutImageData(filename string, data []byte) error {
+	store, err := f.imageStore("PutImageData")
+	if err != nil {
+		return err
+	}
+	return store.PutImageData(filename, data)
+}
+
+// ImageData returns an image if the wrapped database can store them
+func (f *faultyDatabase) ImageData(filename string) ([]byte, error) {
+	store, err := f.imageStore("ImageData")
+	if err != nil {
+		return nil, err
+	}
+	return store.ImageData(filename)
+}
+
+// DeleteImageData removes an image if the wrapped database can store them
+func (f *faultyDatabase) DeleteImageData(filename string) error {
+	store, err := f.imageStore("DeleteImageData")
+	if err != nil {
+		return err
+	}
+	return store.DeleteImageData(filename)
+}
+
+// HasImageData looks up an image if the wrapped database can store them
+func (f *faultyDatabase) HasImageData(filename string) (bool, error) {
+	store, err := f.imageStore("HasImageData")
+	if err != nil {
+		return false, err
+	}
+	return store.HasImageData(filename)
+}
+
+// VectorSearch reports whether the wrapped database searches embeddings
+func (f *faultyDatabase) VectorSearch() bool {
+	searcher, ok := f.db.(database.VectorSearcher)
+	return ok && searcher.VectorSearch()
+}
+
+// NearestFaces searches the embeddings if the wrapped database can
+func (f *faultyDatabase) NearestFaces(embedding []float32, k int) ([]database.FaceSimilarity, error) {
+	searcher, ok := f.db.(database.VectorSearcher)
+	if !ok {
+		return nil, database.ErrVectorSearchUnsupported
+	}
+	if err := f.inj.Fail(Database, "NearestFaces"); err != nil {
+		return nil, err
+	}
+	return searcher.NearestFaces(embedding, k)
+}
+
+// UserIDsWithPrefix looks up user IDs by prefix, listing every user if the
+// wrapped database cannot look them up itself
+func (f *faultyDatabase) UserIDsWithPrefix(prefix string, limit int) ([]string, error) {
+	if err := f.inj.Fail(Database, "UserIDsWithPrefix"); err != nil {
+		return nil, err
+	}
+	if prefixer, ok := f.db.(database.UserIDPrefixer); ok {
+		return prefixer.UserIDsWithPrefix(prefix, limit)
+	}
+	users, err := f.db.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for i := range users {
+		if strings.HasPrefix(users[i].ID, prefix) && len(ids) < limit {
+			ids = append(ids, users[i].ID)
+		}
+	}
+	return ids, nil
+}
+
+// ServerVersion reports the version of the wrapped database's server, empty
+// if it cannot
+func (f *faultyDatabase) ServerVersion() (string, error) {
+	versioner, ok := f.db.(database.ServerVersioner)
+	if !ok {
+		return "", nil
+	}
+	if err := f.inj.Fail(Database, "ServerVersion"); err != nil {
+		return "", err
+	}
+	return versioner.ServerVersion()
+}
+
+// RunQuery runs the query if the wrapped database supports queries
+func (f *faultyDatabase) RunQuery(q database.Query, params map[string]string) (*database.QueryResult, error) {
+	querier, ok := f.db.(database.Querier)
+	if !ok {
+		return nil, database.ErrQueriesUnsupported
+	}
+	if err := f.inj.Fail(Database, "RunQuery"); err != nil {
+		return nil, err
+	}
+	return querier.RunQuery(q, params)
+}
+
+// Close never fails so resources are always released
+func (f *faultyDatabase) Close() error {
+	return f.db.Close()
+}
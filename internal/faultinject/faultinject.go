@@ -0,0 +1,128 @@
+package faultinject
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnableEnv must be set to 1 for fault injection to be accepted
+const EnableEnv = "FACE_CLI_ENABLE_FAULT_INJECTION"
+
+// ErrInjected is wrapped by every simulated failure
+var ErrInjected = errors.New("injected fault")
+
+// Component is a part of the pipeline that can be made to fail
+type Component string
+
+const (
+	Detector Component = "detector"
+	Database Component = "db"
+	Storage  Component = "storage"
+)
+
+// Config holds the failure probability of each component
+type Config struct {
+	Probabilities map[Component]float64
+	// Delay is waited before a database fault is returned, simulating a
+	// timeout rather than an immediate error
+	Delay time.Duration
+	// Seed makes the sequence of faults reproducible; 0 picks a random seed
+	Seed int64
+}
+
+// Parse reads a spec such as "detector=0.2,db=0.1,storage=0.05,delay=2s,seed=42"
+func Parse(spec string) (Config, error) {
+	cfg := Config{Probabilities: make(map[Component]float64)}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Config{}, fmt.Errorf("invalid fault spec %q, expected key=value", part)
+		}
+
+		switch key {
+		case "delay":
+			delay, err := time.ParseDuration(value)
+			if err != nil || delay < 0 {
+				return Config{}, fmt.Errorf("invalid fault delay %q", value)
+			}
+			cfg.Delay = delay
+		case "seed":
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid fault seed %q", value)
+			}
+			cfg.Seed = seed
+		case string(Detector), string(Database), string(Storage):
+			p, err := strconv.ParseFloat(value, 64)
+			if err != nil || p < 0 || p > 1 {
+				return Config{}, fmt.Errorf("invalid fault probability %q for %s, expected 0.0-1.0", value, key)
+			}
+			cfg.Probabilities[Component(key)] = p
+		default:
+			return Config{}, fmt.Errorf("unknown fault component %q (detector, db, storage, delay, seed)", key)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Injector decides when a component fails, so integrators can exercise
+// their retry and fallback logic. It is a development aid and must never be
+// enabled in production. A nil Injector never fails.
+type Injector struct {
+	cfg Config
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// New creates an injector
+func New(cfg Config) *Injector {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &Injector{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(seed)), // #nosec G404 -- simulated faults, not security sensitive
+	}
+}
+
+// Fail returns an error wrapping ErrInjected with the configured
+// probability of the component, and nil otherwise
+func (i *Injector) Fail(component Component, operation string) error {
+	if i == nil {
+		return nil
+	}
+
+	p := i.cfg.Probabilities[component]
+	if p == 0 {
+		return nil
+	}
+
+	i.mu.Lock()
+	roll := i.rng.Float64()
+	i.mu.Unlock()
+
+	if roll >= p {
+		return nil
+	}
+
+	if component == Database && i.cfg.Delay > 0 {
+		time.Sleep(i.cfg.Delay)
+		return fmt.Errorf("%w: %s %s timed out after %s", ErrInjected, component, operation, i.cfg.Delay)
+	}
+	return fmt.Errorf("%w: %s %s failed", ErrInjected, component, operation)
+}
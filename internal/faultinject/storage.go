@@ -0,0 +1,47 @@
+package faultinject
+
+import (
+	"image"
+
+	"face/internal/storage"
+)
+
+// faultyStorage fails image storage operations at random
+type faultyStorage struct {
+	storage.Storage
+	inj *Injector
+}
+
+// WrapStorage returns a storage whose operations fail with the probability
+// configured for the storage component
+func WrapStorage(s storage.Storage, inj *Injector) storage.Storage {
+	return &faultyStorage{Storage: s, inj: inj}
+}
+
+func (f *faultyStorage) SaveImage(userID, faceID string, img image.Image) (string, error) {
+	if err := f.inj.Fail(Storage, "SaveImage"); err != nil {
+		return "", err
+	}
+	return f.Storage.SaveImage(userID, faceID, img)
+}
+
+func (f *faultyStorage) LoadImage(filename string) (image.Image, error) {
+	if err := f.inj.Fail(Storage, "LoadImage"); err != nil {
+		return nil, err
+	}
+	return f.Storage.LoadImage(filename)
+}
+
+func (f *faultyStorage) LoadData(filename string) ([]byte, error) {
+	if err := f.inj.Fail(Storage, "LoadData"); err != nil {
+		return nil, err
+	}
+	return f.Storage.LoadData(filename)
+}
+
+func (f *faultyStorage) DeleteImage(filename string) error {
+	if err := f.inj.Fail(Storage, "DeleteImage"); err != nil {
+		return err
+	}
+	return f.Storage.DeleteImage(filename)
+}
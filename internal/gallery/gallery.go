@@ -0,0 +1,260 @@
+// Package gallery encodes the enrolled embeddings as compact binary bundles
+// for devices that identify faces offline. A snapshot holds the whole
+// gallery; a delta holds the users changed since an earlier revision.
+//
+// All integers are little endian. A bundle is a header
+//
+//	magic     [4]byte  "FGAL" for snapshots, "FGDL" for deltas
+//	version   uint16   FormatVersion
+//	from      int64    revision a delta applies to, 0 for snapshots
+//	revision  int64    revision the bundle brings the gallery to
+//	dimension uint16   embedding dimension
+//	count     uint32   number of entries
+//
+// followed by count entries
+//
+//	op        uint8    OpUpsert or OpDelete
+//	user id   string
+//	name      string   upserts only
+//	faces     uint16   upserts only, then per face its id string and
+//	                   dimension float32 values
+//
+// where a string is a uint16 length followed by UTF-8 bytes. An upsert
+// replaces everything known about the user.
+//
+// The package needs nothing but the standard library, as the matching
+// package reads snapshots with it on devices.
+package gallery
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// FormatVersion is the version of the bundle format written by Write
+const FormatVersion = 1
+
+var (
+	snapshotMagic = [4]byte{'F', 'G', 'A', 'L'}
+	deltaMagic    = [4]byte{'F', 'G', 'D', 'L'}
+)
+
+// ErrInvalidBundle is returned when reading data that is not a bundle
+var ErrInvalidBundle = errors.New("not a gallery bundle")
+
+// Op is what an entry does to the user it describes
+type Op uint8
+
+const (
+	// OpUpsert adds the user or replaces what is known about them
+	OpUpsert Op = 1
+	// OpDelete removes the user
+	OpDelete Op = 2
+)
+
+// Face is an enrolled face in a bundle
+type Face struct {
+	ID        string
+	Embedding []float32
+}
+
+// Entry is one user in a bundle
+type Entry struct {
+	Op     Op
+	UserID string
+	Name   string
+	Faces  []Face
+}
+
+// Bundle is a snapshot or delta of the gallery
+type Bundle struct {
+	Delta bool
+	// From is the revision a delta applies to
+	From int64
+	// Revision is the revision of the gallery after applying the bundle
+	Revision int64
+	Entries  []Entry
+}
+
+// Delete returns the entry removing a user
+func Delete(userID string) Entry {
+	return Entry{Op: OpDelete, UserID: userID}
+}
+
+// Dimension returns the embedding dimension shared by every face, 0 if
+// there are no faces
+func (b *Bundle) Dimension() (int, error) {
+	dim := 0
+	for _, e := range b.Entries {
+		for _, f := range e.Faces {
+			if dim == 0 {
+				dim = len(f.Embedding)
+			} else if len(f.Embedding) != dim {
+				return 0, fmt.Errorf("face %s has %d dimensions, expected %d", f.ID, len(f.Embedding), dim)
+			}
+		}
+	}
+	if dim > math.MaxUint16 {
+		return 0, fmt.Errorf("embedding dimension %d is too large", dim)
+	}
+	return dim, nil
+}
+
+// Write encodes the bundle
+func (b *Bundle) Write(w io.Writer) error {
+	dim, err := b.Dimension()
+	if err != nil {
+		return err
+	}
+
+	bw := &writer{w: bufio.NewWriter(w)}
+	magic := snapshotMagic
+	if b.Delta {
+		magic = deltaMagic
+	}
+	bw.put(magic)
+	bw.put(uint16(FormatVersion))
+	bw.put(b.From)
+	bw.put(b.Revision)
+	bw.put(uint16(dim))
+	bw.put(uint32(len(b.Entries)))
+
+	for _, e := range b.Entries {
+		bw.put(uint8(e.Op))
+		bw.putString(e.UserID)
+		if e.Op == OpDelete {
+			continue
+		}
+		bw.putString(e.Name)
+		if len(e.Faces) > math.MaxUint16 {
+			return fmt.Errorf("user %s has too many faces", e.UserID)
+		}
+		bw.put(uint16(len(e.Faces)))
+		for _, f := range e.Faces {
+			bw.putString(f.ID)
+			bw.put(f.Embedding)
+		}
+	}
+
+	if bw.err != nil {
+		return fmt.Errorf("failed to write bundle: %w", bw.err)
+	}
+	return bw.w.Flush()
+}
+
+// Read decodes a bundle
+func Read(r io.Reader) (*Bundle, error) {
+	br := &reader{r: bufio.NewReader(r)}
+
+	var magic [4]byte
+	var version, dim uint16
+	var count uint32
+	b := &Bundle{}
+	br.get(&magic)
+	br.get(&version)
+	br.get(&b.From)
+	br.get(&b.Revision)
+	br.get(&dim)
+	br.get(&count)
+	if br.err != nil {
+		return nil, fmt.Errorf("failed to read bundle header: %w", br.err)
+	}
+
+	switch {
+	case magic == deltaMagic:
+		b.Delta = true
+	case magic != snapshotMagic:
+		return nil, ErrInvalidBundle
+	}
+	if version != FormatVersion {
+		return nil, fmt.Errorf("unsupported gallery bundle version %d", version)
+	}
+
+	for i := uint32(0); i < count && br.err == nil; i++ {
+		b.Entries = append(b.Entries, br.entry(int(dim)))
+	}
+	if br.err != nil {
+		return nil, fmt.Errorf("failed to read bundle: %w", br.err)
+	}
+	return b, nil
+}
+
+// writer remembers the first error so encoding reads straight through
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (w *writer) put(v interface{}) {
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.LittleEndian, v)
+	}
+}
+
+func (w *writer) putString(s string) {
+	if len(s) > math.MaxUint16 {
+		if w.err == nil {
+			w.err = fmt.Errorf("string of %d bytes is too long", len(s))
+		}
+		return
+	}
+	w.put(uint16(len(s)))
+	if w.err == nil {
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+// reader remembers the first error so decoding reads straight through
+type reader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *reader) get(v interface{}) {
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.LittleEndian, v)
+	}
+}
+
+func (r *reader) getString() string {
+	var n uint16
+	r.get(&n)
+	if r.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	_, r.err = io.ReadFull(r.r, buf)
+	return string(buf)
+}
+
+func (r *reader) entry(dim int) Entry {
+	var op uint8
+	r.get(&op)
+	e := Entry{Op: Op(op), UserID: r.getString()}
+	if r.err != nil {
+		return e
+	}
+
+	switch e.Op {
+	case OpDelete:
+		return e
+	case OpUpsert:
+	default:
+		r.err = fmt.Errorf("unknown entry operation %d", op)
+		return e
+	}
+
+	e.Name = r.getString()
+	var faces uint16
+	r.get(&faces)
+	for i := 0; i < int(faces) && r.err == nil; i++ {
+		f := Face{ID: r.getString(), Embedding: make([]float32, dim)}
+		r.get(f.Embedding)
+		e.Faces = append(e.Faces, f)
+	}
+	return e
+}
@@ -0,0 +1,72 @@
+// Package history keeps a local log of the commands run on this machine,
+// one JSON object per line, so operators' actions can be reviewed
+// independently of the database.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Entry is one recorded command
+type Entry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user,omitempty"`
+	Command string    `json:"command"`
+	Args    []string  `json:"args,omitempty"`
+	// Flags holds the flags set on the command line, secrets redacted
+	Flags      map[string]string `json:"flags,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+	// Error is empty if the command succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Append adds an entry to the history file, creating it if needed
+func Append(path string, entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return file.Close()
+}
+
+// Read returns the entries of the history file, oldest first. A missing
+// file is an empty history; lines that cannot be parsed are skipped.
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,232 @@
+// Package homeassistant publishes recognition events to an MQTT broker
+// following the Home Assistant MQTT discovery conventions, so enrolled
+// users show up as device trackers and cameras as sensors without any
+// configuration in Home Assistant.
+package homeassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"face/internal/database/models"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// Defaults used when the config leaves the topics empty
+const (
+	DefaultTopic           = "face"
+	DefaultDiscoveryPrefix = "homeassistant"
+)
+
+// timeout bounds connecting and each publish, so an unreachable broker
+// cannot hang a command
+const timeout = 10 * time.Second
+
+// Tracker states of a person
+const (
+	stateHome    = "home"
+	stateNotHome = "not_home"
+)
+
+// stateUnknown is the camera sensor state when a face matched no one
+const stateUnknown = "unknown"
+
+// Config holds the broker settings
+type Config struct {
+	Broker   string // e.g. tcp://homeassistant.local:1883
+	Username string
+	Password string
+	// Topic prefixes the state and event topics, DefaultTopic if empty
+	Topic string
+	// DiscoveryPrefix is Home Assistant's discovery prefix,
+	// DefaultDiscoveryPrefix if empty
+	DiscoveryPrefix string
+}
+
+// Recognition is the result of identifying a face
+type Recognition struct {
+	Matched    bool      `json:"matched"`
+	UserID     string    `json:"user_id,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	FaceID     string    `json:"face_id,omitempty"`
+	Confidence float64   `json:"confidence"`
+	Camera     string    `json:"camera,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Publisher is a connection to the broker
+type Publisher struct {
+	client mqtt.Client
+	cfg    Config
+}
+
+// Connect connects to the broker
+func Connect(cfg Config) (*Publisher, error) {
+	if cfg.Broker == "" {
+		return nil, errors.New("MQTT broker cannot be empty")
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = DefaultTopic
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+
+	// A unique client ID, so concurrent commands do not disconnect each other
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID("face-" + uuid.New().String()[:8]).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetConnectTimeout(timeout).
+		SetAutoReconnect(false)
+
+	client := mqtt.NewClient(opts)
+	if err := wait(client.Connect()); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	return &Publisher{client: client, cfg: cfg}, nil
+}
+
+// Close disconnects from the broker after sending pending messages
+func (p *Publisher) Close() {
+	p.client.Disconnect(250)
+}
+
+// AnnouncePerson publishes the discovery config of the user's device
+// tracker. Home Assistant users can then assign the tracker to a person.
+func (p *Publisher) AnnouncePerson(user *models.User) error {
+	id := objectID(user.ID)
+	config := map[string]any{
+		"name":                  user.Name,
+		"unique_id":             id,
+		"object_id":             id,
+		"state_topic":           p.personTopic(user.ID, "state"),
+		"json_attributes_topic": p.personTopic(user.ID, "attributes"),
+		"payload_home":          stateHome,
+		"payload_not_home":      stateNotHome,
+		"source_type":           "router",
+		"icon":                  "mdi:face-recognition",
+		"device":                p.device(),
+	}
+	return p.publishJSON(p.discoveryTopic("device_tracker", id), config, true)
+}
+
+// ForgetPerson removes the user's device tracker from Home Assistant
+func (p *Publisher) ForgetPerson(userID string) error {
+	return p.publish(p.discoveryTopic("device_tracker", objectID(userID)), "", true)
+}
+
+// AnnounceCamera publishes the discovery config of a sensor holding the
+// name of the person last recognized by the camera
+func (p *Publisher) AnnounceCamera(camera string) error {
+	id := objectID("camera_" + slug(camera))
+	config := map[string]any{
+		"name":                  camera + " person",
+		"unique_id":             id,
+		"object_id":             id,
+		"state_topic":           p.cameraTopic(camera, "person"),
+		"json_attributes_topic": p.cameraTopic(camera, "attributes"),
+		"icon":                  "mdi:cctv",
+		"device":                p.device(),
+	}
+	return p.publishJSON(p.discoveryTopic("sensor", id), config, true)
+}
+
+// PublishRecognition publishes a recognition event on <topic>/events and,
+// for a match, marks the person home with the match as attributes. With a
+// camera, the camera's sensor is updated too.
+func (p *Publisher) PublishRecognition(r Recognition) error {
+	if err := p.publishJSON(p.cfg.Topic+"/events", r, false); err != nil {
+		return err
+	}
+
+	if r.Matched {
+		if err := p.publish(p.personTopic(r.UserID, "state"), stateHome, true); err != nil {
+			return err
+		}
+		if err := p.publishJSON(p.personTopic(r.UserID, "attributes"), r, true); err != nil {
+			return err
+		}
+	}
+
+	if r.Camera == "" {
+		return nil
+	}
+	person := stateUnknown
+	if r.Matched {
+		person = r.Name
+	}
+	if err := p.publish(p.cameraTopic(r.Camera, "person"), person, true); err != nil {
+		return err
+	}
+	return p.publishJSON(p.cameraTopic(r.Camera, "attributes"), r, true)
+}
+
+// device groups the entities under one device in Home Assistant
+func (p *Publisher) device() map[string]any {
+	return map[string]any{
+		"identifiers": []string{"face_recognition_" + slug(p.cfg.Topic)},
+		"name":        "Face Recognition",
+		"model":       "face CLI",
+	}
+}
+
+func (p *Publisher) personTopic(userID, leaf string) string {
+	return fmt.Sprintf("%s/person/%s/%s", p.cfg.Topic, userID, leaf)
+}
+
+func (p *Publisher) cameraTopic(camera, leaf string) string {
+	return fmt.Sprintf("%s/camera/%s/%s", p.cfg.Topic, slug(camera), leaf)
+}
+
+func (p *Publisher) discoveryTopic(component, id string) string {
+	return fmt.Sprintf("%s/%s/%s/config", p.cfg.DiscoveryPrefix, component, id)
+}
+
+func (p *Publisher) publishJSON(topic string, v any, retained bool) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal MQTT message: %w", err)
+	}
+	return p.publish(topic, string(payload), retained)
+}
+
+func (p *Publisher) publish(topic, payload string, retained bool) error {
+	if err := wait(p.client.Publish(topic, 1, retained, payload)); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// wait waits for an MQTT operation to complete
+func wait(token mqtt.Token) error {
+	if !token.WaitTimeout(timeout) {
+		return errors.New("timed out")
+	}
+	return token.Error()
+}
+
+// objectID returns the Home Assistant object ID of an entity
+func objectID(id string) string {
+	return "face_" + strings.ReplaceAll(id, "-", "_")
+}
+
+// slug turns a name into a topic level and ID part: lowercase letters,
+// digits and underscores
+func slug(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,188 @@
+// Package hooks runs custom stages before and after face detection,
+// embedding extraction and matching, e.g. business rules, extra logging or
+// an external presentation attack detection service.
+//
+// Hooks are compiled in: a file of the fork registers them from an init
+// function, so ProcessImage and the commands do not need patching.
+//
+//	func init() {
+//		hooks.Register("pad", hooks.Hook{
+//			BeforeDetect: func(img image.Image) (image.Image, error) {
+//				if spoof(img) {
+//					return nil, errors.New("presentation attack detected")
+//				}
+//				return img, nil
+//			},
+//		})
+//	}
+//
+// Hooks run in the order they were registered. Every command and server
+// processing faces runs them; what a stage returns replaces its input for
+// the next hook and the rest of the pipeline.
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	"face/internal/database/models"
+	"face/internal/pipeline"
+)
+
+// Hook is a set of stages; any of them may be nil. An error of a stage
+// fails the processing of the image, as a detection error would, except
+// that AfterMatch returning models.ErrNoMatch rejects only the match.
+type Hook struct {
+	// BeforeDetect runs on each image before faces are detected and can
+	// return a replacement of the same size, e.g. a preprocessed image
+	BeforeDetect func(img image.Image) (image.Image, error)
+	// AfterDetect runs on the faces detected in an image, largest first,
+	// and can drop or replace them; no faces left means no face detected
+	AfterDetect func(img image.Image, detections []*pipeline.Detection) ([]*pipeline.Detection, error)
+	// BeforeExtract runs on each face crop before its embedding is
+	// extracted and can return a replacement
+	BeforeExtract func(crop image.Image) (image.Image, error)
+	// AfterExtract runs on each extracted embedding and can return a
+	// replacement
+	AfterExtract func(crop image.Image, embedding []float32) ([]float32, error)
+	// BeforeMatch runs before an embedding is matched against enrolled
+	// users, for identification and verification
+	BeforeMatch func(embedding []float32) error
+	// AfterMatch runs on each user the embedding matched. Returning
+	// models.ErrNoMatch rejects the match, e.g. for a user who is not
+	// allowed in at this time.
+	AfterMatch func(embedding []float32, match *models.MatchResult) error
+}
+
+type registered struct {
+	name string
+	hook Hook
+}
+
+var (
+	mu    sync.RWMutex
+	hooks []registered
+)
+
+// Register adds a hook under a unique name. It panics if the name is empty
+// or already registered, as it is meant to be called from init functions.
+func Register(name string, hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" {
+		panic("hooks: Register with an empty name")
+	}
+	for _, r := range hooks {
+		if r.name == name {
+			panic(fmt.Sprintf("hooks: Register called twice for %q", name))
+		}
+	}
+	hooks = append(hooks, registered{name: name, hook: hook})
+}
+
+// Names returns the names of the registered hooks, in the order they run
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, len(hooks))
+	for i, r := range hooks {
+		names[i] = r.name
+	}
+	return names
+}
+
+// each calls fn with every registered hook, stopping at the first error,
+// which is prefixed with the name of the hook
+func each(fn func(h *Hook) error) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for i := range hooks {
+		if err := fn(&hooks[i].hook); err != nil {
+			return fmt.Errorf("hook %s: %w", hooks[i].name, err)
+		}
+	}
+	return nil
+}
+
+// BeforeDetect runs the BeforeDetect stages on an image
+func BeforeDetect(img image.Image) (image.Image, error) {
+	err := each(func(h *Hook) error {
+		if h.BeforeDetect == nil {
+			return nil
+		}
+		var err error
+		img, err = h.BeforeDetect(img)
+		return err
+	})
+	return img, err
+}
+
+// AfterDetect runs the AfterDetect stages on the faces detected in an
+// image
+func AfterDetect(img image.Image, detections []*pipeline.Detection) ([]*pipeline.Detection, error) {
+	err := each(func(h *Hook) error {
+		if h.AfterDetect == nil {
+			return nil
+		}
+		var err error
+		detections, err = h.AfterDetect(img, detections)
+		return err
+	})
+	return detections, err
+}
+
+// BeforeExtract runs the BeforeExtract stages on a face crop
+func BeforeExtract(crop image.Image) (image.Image, error) {
+	err := each(func(h *Hook) error {
+		if h.BeforeExtract == nil {
+			return nil
+		}
+		var err error
+		crop, err = h.BeforeExtract(crop)
+		return err
+	})
+	return crop, err
+}
+
+// AfterExtract runs the AfterExtract stages on the embedding of a crop
+func AfterExtract(crop image.Image, embedding []float32) ([]float32, error) {
+	err := each(func(h *Hook) error {
+		if h.AfterExtract == nil {
+			return nil
+		}
+		var err error
+		embedding, err = h.AfterExtract(crop, embedding)
+		return err
+	})
+	return embedding, err
+}
+
+// BeforeMatch runs the BeforeMatch stages on an embedding
+func BeforeMatch(embedding []float32) error {
+	return each(func(h *Hook) error {
+		if h.BeforeMatch == nil {
+			return nil
+		}
+		return h.BeforeMatch(embedding)
+	})
+}
+
+// AfterMatch runs the AfterMatch stages on a match. It returns
+// models.ErrNoMatch if a hook rejected the match.
+func AfterMatch(embedding []float32, match *models.MatchResult) error {
+	err := each(func(h *Hook) error {
+		if h.AfterMatch == nil {
+			return nil
+		}
+		return h.AfterMatch(embedding, match)
+	})
+	if errors.Is(err, models.ErrNoMatch) {
+		return models.ErrNoMatch
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// annotationColour is the colour of the boxes and labels of Annotate,
+// chosen to stand out from skin tones and most backgrounds
+var annotationColour = color.RGBA{R: 0, G: 200, B: 255, A: 255}
+
+// Annotate returns a copy of an image with a box drawn around each face and
+// labelled with its number, starting at 1, so an operator can tell which
+// face is which. Lines and labels grow with the image, to stay readable
+// when it is shown scaled down.
+func Annotate(img image.Image, boxes []image.Rectangle) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Src)
+
+	short := min(bounds.Dx(), bounds.Dy())
+	width := max(2, short/300)
+	scale := max(1, short/400)
+	for i, box := range boxes {
+		outline(out, box, width)
+		label(out, box, strconv.Itoa(i+1), scale)
+	}
+	return out
+}
+
+// outline draws the border of r, width pixels wide, inside r
+func outline(img *image.RGBA, r image.Rectangle, width int) {
+	fill(img, image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+width).Intersect(r), annotationColour)
+	fill(img, image.Rect(r.Min.X, r.Max.Y-width, r.Max.X, r.Max.Y).Intersect(r), annotationColour)
+	fill(img, image.Rect(r.Min.X, r.Min.Y, r.Min.X+width, r.Max.Y).Intersect(r), annotationColour)
+	fill(img, image.Rect(r.Max.X-width, r.Min.Y, r.Max.X, r.Max.Y).Intersect(r), annotationColour)
+}
+
+// label writes text in black on a tag of the annotation colour above the
+// top left corner of r, or inside it when r is at the top of the image
+func label(img *image.RGBA, r image.Rectangle, text string, scale int) {
+	face := basicfont.Face7x13
+	const padding = 2
+	tag := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, text).Ceil()+2*padding, face.Height+padding))
+	fill(tag, tag.Bounds(), annotationColour)
+	drawer := font.Drawer{
+		Dst:  tag,
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+		Dot:  fixed.P(padding, face.Ascent+padding/2),
+	}
+	drawer.DrawString(text)
+
+	size := tag.Bounds().Size().Mul(scale)
+	at := image.Pt(r.Min.X, r.Min.Y-size.Y)
+	if at.Y < img.Bounds().Min.Y {
+		at.Y = r.Min.Y
+	}
+	xdraw.NearestNeighbor.Scale(img, image.Rectangle{Min: at, Max: at.Add(size)}, tag, tag.Bounds(), draw.Over, nil)
+}
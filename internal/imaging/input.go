@@ -0,0 +1,145 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders of the accepted input formats
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"face/internal/database/models"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// sniffLen is how much of a file Sniff needs to identify it
+const sniffLen = 32
+
+// signature is the magic bytes a format starts with, at offset
+type signature struct {
+	offset int
+	magic  string
+	format string
+}
+
+// inputFormats are the image formats accepted as input. Of multi-frame
+// images, the first frame is used: the first frame of an animated GIF, the
+// default image of an animated PNG, the first page of a TIFF.
+var inputFormats = []signature{
+	{0, "\xff\xd8\xff", "jpeg"},
+	{0, "\x89PNG\r\n\x1a\n", "png"},
+	{0, "GIF87a", "gif"},
+	{0, "GIF89a", "gif"},
+	{8, "WEBP", "webp"},
+	{0, "BM", "bmp"},
+	{0, "II*\x00", "tiff"},
+	{0, "MM\x00*", "tiff"},
+}
+
+// otherFormats are files commonly sent instead of an image, named in the
+// error rejecting them
+var otherFormats = []signature{
+	{0, "%PDF-", "a PDF document"},
+	{0, "PK\x03\x04", "a ZIP archive or office document"},
+	{4, "ftypheic", "a HEIC image, which is not supported; convert it to JPEG"},
+	{4, "ftypheix", "a HEIC image, which is not supported; convert it to JPEG"},
+	{4, "ftypmif1", "a HEIF image, which is not supported; convert it to JPEG"},
+	{4, "ftypavif", "an AVIF image, which is not supported; convert it to JPEG"},
+	{4, "ftyp", "a video"},
+	{0, "<svg", "an SVG drawing"},
+	{0, "<?xml", "an XML document"},
+	{0, "<!DOCTYPE", "an HTML document"},
+	{0, "<html", "an HTML document"},
+}
+
+// Sniff identifies the format of an input image from its first bytes. Files
+// of other formats are rejected with an error wrapping
+// models.ErrInvalidImage that says what they are, if known, so that
+// nothing else is handed to the decoders.
+func Sniff(header []byte) (string, error) {
+	if len(header) == 0 {
+		return "", fmt.Errorf("%w: the file is empty", models.ErrInvalidImage)
+	}
+	for _, sig := range inputFormats {
+		if !sig.match(header) {
+			continue
+		}
+		if sig.format == "webp" && animatedWebP(header) {
+			return "", fmt.Errorf("%w: animated WebP is not supported; send a still image", models.ErrInvalidImage)
+		}
+		return sig.format, nil
+	}
+	for _, sig := range otherFormats {
+		if sig.match(header) {
+			return "", fmt.Errorf("%w: the file is %s", models.ErrInvalidImage, sig.format)
+		}
+	}
+	return "", fmt.Errorf("%w: the file is not a JPEG, PNG, GIF, WebP, BMP or TIFF image", models.ErrInvalidImage)
+}
+
+func (s signature) match(header []byte) bool {
+	return len(header) >= s.offset+len(s.magic) && string(header[s.offset:s.offset+len(s.magic)]) == s.magic
+}
+
+// animatedWebP reports whether a WebP file has the animation flag of the
+// extended format set. The WebP decoder reads still images only.
+func animatedWebP(header []byte) bool {
+	const animationBit = 1 << 1
+	return len(header) > 20 && string(header[0:4]) == "RIFF" && string(header[12:16]) == "VP8X" && header[20]&animationBit != 0
+}
+
+// DecodeInput decodes an input image, e.g. an upload: it sniffs the format,
+// applies the limits and decodes the first frame. Every failure is a typed
+// error: models.ErrInvalidImage for files that are not images or are
+// corrupt, ErrImageTooLarge for images over the limits, so that callers
+// never see a decoder panic.
+func DecodeInput(r io.ReadSeeker, limits Limits) (image.Image, error) {
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+	if _, err := Sniff(header[:n]); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+
+	config, err := safeDecode(r, image.DecodeConfig)
+	if err != nil {
+		return nil, err
+	}
+	if err := limits.Check(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read image file: %w", err)
+	}
+
+	img, err := safeDecode(r, func(r io.Reader) (image.Image, string, error) { return image.Decode(r) })
+	if err != nil {
+		return nil, err
+	}
+	return limits.Fit(img), nil
+}
+
+// safeDecode runs a decoder, turning its errors and panics on corrupt data
+// into errors wrapping models.ErrInvalidImage
+func safeDecode[T any](r io.Reader, decode func(io.Reader) (T, string, error)) (result T, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%w: the image is corrupt (%v)", models.ErrInvalidImage, p)
+		}
+	}()
+
+	result, _, err = decode(r)
+	if err != nil {
+		return result, fmt.Errorf("%w: the image is corrupt (%v)", models.ErrInvalidImage, err)
+	}
+	return result, nil
+}
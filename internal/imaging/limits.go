@@ -0,0 +1,93 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// DefaultMaxMegapixels is the input image size limit unless configured
+// otherwise. A decoded image takes about 4 bytes per pixel, so this keeps
+// one image around 200MB.
+const DefaultMaxMegapixels = 50
+
+// DefaultMaxDimension is the largest width or height of an input image
+// unless configured otherwise
+const DefaultMaxDimension = 20000
+
+// maxDownscaleFactor bounds the images scaled down instead of rejected, as
+// they are decoded in full first: images up to this many times MaxPixels
+// are scaled down, larger ones are still rejected
+const maxDownscaleFactor = 4
+
+// ErrImageTooLarge is returned for input images over the size limit
+var ErrImageTooLarge = errors.New("image is too large")
+
+// Limits bounds the size of input images, so a single huge photo cannot
+// exhaust the memory of the process
+type Limits struct {
+	// MaxPixels is the largest image accepted, 0 for no limit
+	MaxPixels int
+	// MaxDimension is the largest width or height accepted, 0 for no
+	// limit
+	MaxDimension int
+	// Downscale scales larger images down to the limits after decoding
+	// instead of rejecting them before decoding, up to maxDownscaleFactor
+	// times MaxPixels
+	Downscale bool
+}
+
+// Check returns ErrImageTooLarge if an image of the given size must be
+// rejected without decoding it
+func (l Limits) Check(width, height int) error {
+	if l.MaxDimension > 0 && !l.Downscale && (width > l.MaxDimension || height > l.MaxDimension) {
+		return fmt.Errorf("%w: %dx%d is over the limit of %d pixels a side", ErrImageTooLarge, width, height, l.MaxDimension)
+	}
+
+	maxPixels := l.MaxPixels
+	if l.Downscale {
+		maxPixels *= maxDownscaleFactor
+	}
+	if maxPixels <= 0 || width*height <= maxPixels {
+		return nil
+	}
+	return fmt.Errorf("%w: %dx%d is %.1f megapixels, the limit is %.1f",
+		ErrImageTooLarge, width, height, float64(width*height)/1e6, float64(maxPixels)/1e6)
+}
+
+// Fit scales an image down to at most MaxPixels and MaxDimension, keeping
+// its aspect ratio, if the limits allow downscaling. Other images are
+// returned as they are.
+func (l Limits) Fit(img image.Image) image.Image {
+	if !l.Downscale {
+		return img
+	}
+
+	bounds := img.Bounds()
+	scale := 1.0
+	if pixels := bounds.Dx() * bounds.Dy(); l.MaxPixels > 0 && pixels > l.MaxPixels {
+		scale = math.Sqrt(float64(l.MaxPixels) / float64(pixels))
+	}
+	if side := max(bounds.Dx(), bounds.Dy()); l.MaxDimension > 0 && side > l.MaxDimension {
+		scale = min(scale, float64(l.MaxDimension)/float64(side))
+	}
+	if scale == 1 {
+		return img
+	}
+
+	width := int(float64(bounds.Dx()) * scale)
+	height := int(float64(bounds.Dy()) * scale)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,106 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// Pixelate replaces each block x block square of r with its average colour
+func Pixelate(img *image.RGBA, r image.Rectangle, block int) {
+	r = r.Intersect(img.Bounds())
+	if block < 1 {
+		block = 1
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y += block {
+		for x := r.Min.X; x < r.Max.X; x += block {
+			cell := image.Rect(x, y, x+block, y+block).Intersect(r)
+			fill(img, cell, average(img, cell))
+		}
+	}
+}
+
+// Blur box-blurs r with the radius three times, which comes close to a
+// Gaussian blur. Only pixels inside r are read, so nothing outside leaks
+// into the blurred area.
+func Blur(img *image.RGBA, r image.Rectangle, radius int) {
+	r = r.Intersect(img.Bounds())
+	if radius < 1 || r.Empty() {
+		return
+	}
+	for range 3 {
+		boxBlur(img, r, radius, 1, 0)
+		boxBlur(img, r, radius, 0, 1)
+	}
+}
+
+// boxBlur averages each pixel of r with its neighbours up to radius away
+// in the direction (dx, dy), using a running sum per line
+func boxBlur(img *image.RGBA, r image.Rectangle, radius, dx, dy int) {
+	lines, length := r.Dy(), r.Dx()
+	if dy == 1 {
+		lines, length = r.Dx(), r.Dy()
+	}
+
+	line := make([][4]int, length)
+	for l := 0; l < lines; l++ {
+		at := func(i int) int {
+			x, y := r.Min.X+i*dx+l*dy, r.Min.Y+i*dy+l*dx
+			return img.PixOffset(x, y)
+		}
+		for i := range line {
+			o := at(i)
+			line[i] = [4]int{int(img.Pix[o]), int(img.Pix[o+1]), int(img.Pix[o+2]), int(img.Pix[o+3])}
+		}
+
+		var sum [4]int
+		for i := 0; i <= radius && i < length; i++ {
+			addPixel(&sum, line[i], 1)
+		}
+		count := min(radius+1, length)
+		for i := range line {
+			o := at(i)
+			for c := range 4 {
+				img.Pix[o+c] = uint8(sum[c] / count)
+			}
+			if next := i + radius + 1; next < length {
+				addPixel(&sum, line[next], 1)
+				count++
+			}
+			if prev := i - radius; prev >= 0 {
+				addPixel(&sum, line[prev], -1)
+				count--
+			}
+		}
+	}
+}
+
+func addPixel(sum *[4]int, p [4]int, sign int) {
+	for c := range 4 {
+		sum[c] += sign * p[c]
+	}
+}
+
+// average returns the mean colour of r
+func average(img *image.RGBA, r image.Rectangle) color.RGBA {
+	var sum [4]int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			o := img.PixOffset(x, y)
+			addPixel(&sum, [4]int{int(img.Pix[o]), int(img.Pix[o+1]), int(img.Pix[o+2]), int(img.Pix[o+3])}, 1)
+		}
+	}
+	n := r.Dx() * r.Dy()
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), uint8(sum[3] / n)}
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
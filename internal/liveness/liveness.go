@@ -0,0 +1,93 @@
+// Package liveness scores how likely a face is a presentation attack: a
+// printed photo or a screen held up to the camera instead of a live
+// person. The built-in passive model looks for the traces recapturing
+// leaves in a single image; a PAD (presentation attack detection) model can
+// be compiled in instead, like the stages of package hooks:
+//
+//	func init() {
+//		liveness.Register("vendor-pad", liveness.ModelFunc(func(img image.Image, box image.Rectangle) (float64, error) {
+//			return vendorpad.Score(img, box)
+//		}))
+//	}
+//
+// and selected with liveness_model in the config file.
+package liveness
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"sync"
+)
+
+// ModelPassive is the name of the built-in passive model
+const ModelPassive = "passive"
+
+// DefaultThreshold is the spoof score above which a face is rejected
+const DefaultThreshold = 0.5
+
+// Model scores faces for presentation attacks. Models must be safe for
+// concurrent use, as the servers' workers share them.
+type Model interface {
+	// Score returns the spoof score of the face in the box of an image,
+	// from 0 (live) to 1 (spoof)
+	Score(img image.Image, box image.Rectangle) (float64, error)
+}
+
+// ModelFunc adapts a function to a Model
+type ModelFunc func(img image.Image, box image.Rectangle) (float64, error)
+
+// Score calls f
+func (f ModelFunc) Score(img image.Image, box image.Rectangle) (float64, error) {
+	return f(img, box)
+}
+
+var (
+	mu     sync.RWMutex
+	models = map[string]Model{ModelPassive: Passive{}}
+)
+
+// Register adds a model under a unique name. It panics if the name is
+// empty or already registered, as it is meant to be called from init
+// functions.
+func Register(name string, model Model) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" {
+		panic("liveness: Register with an empty name")
+	}
+	if _, ok := models[name]; ok {
+		panic(fmt.Sprintf("liveness: Register called twice for %q", name))
+	}
+	models[name] = model
+}
+
+// Lookup returns the model registered under a name; empty means
+// ModelPassive
+func Lookup(name string) (Model, error) {
+	if name == "" {
+		name = ModelPassive
+	}
+
+	mu.RLock()
+	model, ok := models[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown liveness model %q (registered: %v)", name, Names())
+	}
+	return model, nil
+}
+
+// Names returns the names of the registered models, sorted
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,225 @@
+package liveness
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// analysisSize is the side of the square the face is scaled to before its
+// spectrum is measured
+const analysisSize = 64
+
+// Frequency bands of the spectrum, in cycles across the face. The lowest
+// frequencies are the shape and shading of the face and say nothing about
+// how it was captured.
+const (
+	bandMin      = 2
+	bandHigh     = 16
+	bandMoireMin = 8
+	bandMoireMax = 30
+)
+
+// Reference values of the signals for live faces, and how far past them a
+// signal moves the score. They were set on a small set of images and their
+// recaptures; a PAD model does better.
+const (
+	liveHighFrequency  = 0.10
+	scaleHighFrequency = 0.03
+	liveMoire          = 2.3
+	scaleMoire         = 0.3
+	liveSaturation     = 0.35
+	scaleSaturation    = 0.1
+	// grayscale is the saturation below which the image is taken to come
+	// from a monochrome or infrared camera, where colour says nothing
+	grayscale = 0.02
+	// liveBias keeps a face with every signal at its live value at a low
+	// score
+	liveBias = -2
+)
+
+// Signals are the measurements of the passive model
+type Signals struct {
+	// HighFrequency is the share of the face's spectral energy in the high
+	// frequencies. Recapturing a face blurs away its fine skin texture, so
+	// prints and screens have less.
+	HighFrequency float64 `json:"high_frequency"`
+	// Moire is how far the strongest frequency of the face stands out of
+	// the frequencies around it, as the log of their ratio. Screen pixels
+	// and print halftones leave sharp periodic peaks.
+	Moire float64 `json:"moire"`
+	// Saturation is the mean colour saturation of the face; prints and
+	// screens reproduce skin tones with less of it
+	Saturation float64 `json:"saturation"`
+	// Spoof is the score combining the signals, from 0 (live) to 1 (spoof)
+	Spoof float64 `json:"spoof"`
+}
+
+// Passive is the built-in model. It needs a single image and no model
+// files: it looks for the loss of fine texture, the moiré and the washed
+// out colours of a face that was printed or shown on a screen and captured
+// again. It is a heuristic, not certified presentation attack detection;
+// blurry or very small faces of live people can score as spoofs.
+type Passive struct{}
+
+// Score returns the spoof score of the face in the box of an image
+func (Passive) Score(img image.Image, box image.Rectangle) (float64, error) {
+	return Analyze(img, box).Spoof, nil
+}
+
+// Analyze measures the face in the box of an image
+func Analyze(img image.Image, box image.Rectangle) Signals {
+	box = box.Intersect(img.Bounds())
+	if box.Empty() {
+		return Signals{}
+	}
+
+	face := image.NewRGBA(image.Rect(0, 0, analysisSize, analysisSize))
+	draw.ApproxBiLinear.Scale(face, face.Bounds(), img, box, draw.Src, nil)
+
+	power := spectrum(face)
+	s := Signals{
+		HighFrequency: highFrequencyShare(power),
+		Moire:         moire(power),
+		Saturation:    saturation(face),
+	}
+
+	// A signal only counts past its live value: the sharp pixel grid of a
+	// screen must not make up for its moiré.
+	z := liveBias +
+		max(0, (liveHighFrequency-s.HighFrequency)/scaleHighFrequency) +
+		max(0, (s.Moire-liveMoire)/scaleMoire)
+	if s.Saturation >= grayscale {
+		z += max(0, (liveSaturation-s.Saturation)/scaleSaturation)
+	}
+	s.Spoof = 1 / (1 + math.Exp(-z))
+	return s
+}
+
+// spectrum returns the power spectrum of the face's luminance under a Hann
+// window, computed as a separable discrete Fourier transform
+func spectrum(face *image.RGBA) [analysisSize][analysisSize]float64 {
+	const n = analysisSize
+	var cos, sin [n][n]float64
+	var window [n]float64
+	for k := 0; k < n; k++ {
+		window[k] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(k)/(n-1))
+		for x := 0; x < n; x++ {
+			angle := 2 * math.Pi * float64(k*x%n) / n
+			cos[k][x], sin[k][x] = math.Cos(angle), math.Sin(angle)
+		}
+	}
+
+	var luma [n][n]float64
+	var mean float64
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			luma[y][x] = float64(color.GrayModel.Convert(face.At(x, y)).(color.Gray).Y) / 255
+			mean += luma[y][x]
+		}
+	}
+	mean /= n * n
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			luma[y][x] = (luma[y][x] - mean) * window[x] * window[y]
+		}
+	}
+
+	// rows, then columns
+	var re, im [n][n]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < n; u++ {
+			for x := 0; x < n; x++ {
+				re[y][u] += luma[y][x] * cos[u][x]
+				im[y][u] -= luma[y][x] * sin[u][x]
+			}
+		}
+	}
+	var power [n][n]float64
+	for u := 0; u < n; u++ {
+		for v := 0; v < n; v++ {
+			var r, i float64
+			for y := 0; y < n; y++ {
+				r += re[y][u]*cos[v][y] + im[y][u]*sin[v][y]
+				i += im[y][u]*cos[v][y] - re[y][u]*sin[v][y]
+			}
+			power[v][u] = r*r + i*i
+		}
+	}
+	return power
+}
+
+// radius returns the frequency of a bin of the spectrum, in cycles across
+// the face
+func radius(u, v int) float64 {
+	fu, fv := min(u, analysisSize-u), min(v, analysisSize-v)
+	return math.Hypot(float64(fu), float64(fv))
+}
+
+// highFrequencyShare returns the share of the energy above bandMin that is
+// above bandHigh
+func highFrequencyShare(power [analysisSize][analysisSize]float64) float64 {
+	var total, high float64
+	for v := 0; v < analysisSize; v++ {
+		for u := 0; u < analysisSize; u++ {
+			r := radius(u, v)
+			if r < bandMin {
+				continue
+			}
+			total += power[v][u]
+			if r >= bandHigh {
+				high += power[v][u]
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return high / total
+}
+
+// moire returns the log of the ratio of the strongest bin of the moiré band
+// to the mean of the bins at its frequency. The spectrum of a natural image
+// falls off smoothly, so its bins are near the mean of their ring.
+func moire(power [analysisSize][analysisSize]float64) float64 {
+	var ringSum [bandMoireMax + 1]float64
+	var ringCount [bandMoireMax + 1]int
+	for v := 0; v < analysisSize; v++ {
+		for u := 0; u < analysisSize; u++ {
+			if r := int(math.Round(radius(u, v))); r >= bandMoireMin && r <= bandMoireMax {
+				ringSum[r] += power[v][u]
+				ringCount[r]++
+			}
+		}
+	}
+
+	peak := 0.0
+	for v := 0; v < analysisSize; v++ {
+		for u := 0; u < analysisSize; u++ {
+			r := int(math.Round(radius(u, v)))
+			if r < bandMoireMin || r > bandMoireMax || ringSum[r] == 0 {
+				continue
+			}
+			peak = math.Max(peak, power[v][u]*float64(ringCount[r])/ringSum[r])
+		}
+	}
+	if peak == 0 {
+		return 0
+	}
+	return math.Log(peak)
+}
+
+// saturation returns the mean HSV saturation of the face
+func saturation(face *image.RGBA) float64 {
+	var sum float64
+	for i := 0; i < len(face.Pix); i += 4 {
+		r, g, b := face.Pix[i], face.Pix[i+1], face.Pix[i+2]
+		hi, lo := max(r, g, b), min(r, g, b)
+		if hi > 0 {
+			sum += float64(hi-lo) / float64(hi)
+		}
+	}
+	return sum / float64(analysisSize*analysisSize)
+}
@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RequestIDPattern keeps request IDs from other systems safe to log
+var RequestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Target selects where log records are written
+type Target string
+
+const (
+	// TargetNone discards log records
+	TargetNone Target = "none"
+	// TargetStderr writes log records to standard error
+	TargetStderr Target = "stderr"
+	// TargetFile writes log records to a file rotated by size and age
+	TargetFile Target = "file"
+	// TargetSyslog sends log records to a local or remote syslog daemon
+	TargetSyslog Target = "syslog"
+)
+
+// Defaults for file rotation
+const (
+	DefaultMaxSizeMB  = 100
+	DefaultMaxBackups = 5
+)
+
+// Config describes the log sink
+type Config struct {
+	Target Target
+	Level  string // debug, info, warn or error
+
+	// File target
+	File       string
+	MaxSizeMB  int  // rotate when the file grows beyond this size
+	MaxAgeDays int  // remove rotated files older than this, 0 keeps them
+	MaxBackups int  // keep at most this many rotated files
+	Compress   bool // gzip rotated files
+
+	// Syslog target
+	SyslogAddress string // e.g. udp://logs:514, empty for the local daemon
+	SyslogTag     string
+}
+
+// ParseTarget converts a string to Target
+func ParseTarget(s string) (Target, error) {
+	switch Target(strings.ToLower(s)) {
+	case "", TargetNone:
+		return TargetNone, nil
+	case TargetStderr:
+		return TargetStderr, nil
+	case TargetFile:
+		return TargetFile, nil
+	case TargetSyslog:
+		return TargetSyslog, nil
+	default:
+		return "", fmt.Errorf("unsupported log target: %s", s)
+	}
+}
+
+// ParseLevel converts a string to a slog level
+func ParseLevel(s string) (slog.Level, error) {
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unsupported log level: %s", s)
+	}
+	return level, nil
+}
+
+// Validate checks if the configuration is valid
+func (c Config) Validate() error {
+	target, err := ParseTarget(string(c.Target))
+	if err != nil {
+		return err
+	}
+	if _, err := ParseLevel(c.Level); err != nil {
+		return err
+	}
+	if target == TargetFile && c.File == "" {
+		return errors.New("log file cannot be empty for the file log target")
+	}
+	if c.MaxSizeMB < 0 || c.MaxAgeDays < 0 || c.MaxBackups < 0 {
+		return errors.New("log rotation limits cannot be negative")
+	}
+	return nil
+}
+
+// New creates a logger for the configured sink. The returned closer
+// releases the sink and must be called when the logger is no longer used.
+func New(cfg Config) (*slog.Logger, io.Closer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	target, _ := ParseTarget(string(cfg.Target))
+	level, _ := ParseLevel(cfg.Level)
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch target {
+	case TargetStderr:
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nopCloser{}, nil
+
+	case TargetFile:
+		file := &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    orDefault(cfg.MaxSizeMB, DefaultMaxSizeMB),
+			MaxAge:     cfg.MaxAgeDays,
+			MaxBackups: orDefault(cfg.MaxBackups, DefaultMaxBackups),
+			Compress:   cfg.Compress,
+		}
+		return slog.New(slog.NewJSONHandler(file, opts)), file, nil
+
+	case TargetSyslog:
+		handler, closer, err := newSyslogHandler(cfg.SyslogAddress, cfg.SyslogTag, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return slog.New(handler), closer, nil
+
+	default:
+		return slog.New(slog.NewTextHandler(io.Discard, opts)), nopCloser{}, nil
+	}
+}
+
+// nopCloser is returned for sinks that need no cleanup
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func orDefault(value, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"sync"
+)
+
+// syslogWriter sends each formatted record with the priority of its level
+type syslogWriter struct {
+	mu    sync.Mutex
+	w     *syslog.Writer
+	level slog.Level
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimRight(p, "\n"))
+
+	var err error
+	switch {
+	case s.level >= slog.LevelError:
+		err = s.w.Err(msg)
+	case s.level >= slog.LevelWarn:
+		err = s.w.Warning(msg)
+	case s.level >= slog.LevelInfo:
+		err = s.w.Info(msg)
+	default:
+		err = s.w.Debug(msg)
+	}
+	return len(p), err
+}
+
+// syslogHandler formats records as text and hands them to the syslog writer
+type syslogHandler struct {
+	slog.Handler
+	out *syslogWriter
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), out: h.out}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), out: h.out}
+}
+
+// newSyslogHandler connects to syslog. An empty address uses the local
+// daemon; otherwise it is network://host:port, e.g. udp://logs:514.
+func newSyslogHandler(address, tag string, opts *slog.HandlerOptions) (slog.Handler, io.Closer, error) {
+	var network, raddr string
+	if address != "" {
+		u, err := url.Parse(address)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, nil, fmt.Errorf("invalid syslog address %q, expected e.g. udp://host:514", address)
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+
+	if tag == "" {
+		tag = "face"
+	}
+
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	out := &syslogWriter{w: w}
+	textOpts := *opts
+	textOpts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		// syslog timestamps and classifies records itself
+		if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+			return slog.Attr{}
+		}
+		return a
+	}
+
+	return &syslogHandler{Handler: slog.NewTextHandler(out, &textOpts), out: out}, w, nil
+}
@@ -0,0 +1,237 @@
+package modelfiles
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File describes a model file expected in the models directory
+type File struct {
+	Name   string
+	URL    string
+	Size   int64
+	SHA256 string
+}
+
+// Required lists the model files the detection pipeline depends on
+var Required = []File{
+	{
+		Name:   "facefinder",
+		URL:    "https://raw.githubusercontent.com/esimov/pigo/master/cascade/facefinder",
+		Size:   239632,
+		SHA256: "d8014993e7298c7b1865d1f8b855d6dbf4ec5c808bf879e2091ab6837abf90cd",
+	},
+}
+
+// Status reports the state of a single model file on disk
+type Status struct {
+	File    File
+	Path    string
+	Present bool
+	Size    int64
+	SHA256  string
+}
+
+// Valid reports whether the file is present and matches its expected checksum
+func (s *Status) Valid() bool {
+	return s.Present && s.SHA256 == s.File.SHA256
+}
+
+// Check inspects every required model file in dir
+func Check(dir string) ([]Status, error) {
+	statuses := make([]Status, 0, len(Required))
+	for _, f := range Required {
+		status := Status{File: f, Path: filepath.Join(dir, f.Name)}
+
+		info, err := os.Stat(status.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				statuses = append(statuses, status)
+				continue
+			}
+			return nil, fmt.Errorf("failed to stat %s: %w", status.Path, err)
+		}
+
+		sum, err := fileSHA256(status.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		status.Present = true
+		status.Size = info.Size()
+		status.SHA256 = sum
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ErrModelsMissing is matched by errors.Is for any MissingError
+var ErrModelsMissing = errors.New("required model files are missing")
+
+// MissingError lists the model files that are absent or corrupt
+type MissingError struct {
+	Dir   string
+	Files []Status
+}
+
+// Error implements the error interface
+func (e *MissingError) Error() string {
+	names := make([]string, len(e.Files))
+	for i := range e.Files {
+		names[i] = e.Files[i].File.Name
+	}
+	return fmt.Sprintf("required model files missing in %s: %s", e.Dir, strings.Join(names, ", "))
+}
+
+// Unwrap allows errors.Is(err, ErrModelsMissing)
+func (e *MissingError) Unwrap() error {
+	return ErrModelsMissing
+}
+
+// Remediation describes each missing file and how to download it
+func (e *MissingError) Remediation() string {
+	var b strings.Builder
+	for i := range e.Files {
+		s := &e.Files[i]
+		reason := "missing"
+		if s.Present {
+			reason = fmt.Sprintf("checksum mismatch (got %s)", s.SHA256)
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", s.File.Name, reason)
+		fmt.Fprintf(&b, "    expected size:   %d bytes\n", s.File.Size)
+		fmt.Fprintf(&b, "    expected sha256: %s\n", s.File.SHA256)
+	}
+
+	b.WriteString("\nDownload the missing files with:\n")
+	for i := range e.Files {
+		s := &e.Files[i]
+		fmt.Fprintf(&b, "  curl -fL -o %s %s\n", s.Path, s.File.URL)
+	}
+
+	return b.String()
+}
+
+// Require returns a *MissingError if any required model file in dir is
+// absent or does not match its expected checksum
+func Require(dir string) error {
+	statuses, err := Check(dir)
+	if err != nil {
+		return err
+	}
+
+	var missing []Status
+	for i := range statuses {
+		if !statuses[i].Valid() {
+			missing = append(missing, statuses[i])
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingError{Dir: dir, Files: missing}
+	}
+	return nil
+}
+
+// MaxDownloadSize bounds the download of a file without a known size
+const MaxDownloadSize = 2 << 30
+
+// Download fetches a model file to path, replacing it only once the
+// download matches the expected size, if known, and checksum. Files without
+// a checksum are refused, as a tampered model would go unnoticed.
+func Download(ctx context.Context, client *http.Client, f File, path string) error {
+	if f.URL == "" {
+		return fmt.Errorf("%s has no download URL", f.Name)
+	}
+	if f.SHA256 == "" {
+		return fmt.Errorf("%s has no checksum to verify the download with", f.Name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", f.Name, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", f.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", f.Name, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create models directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", f.Name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	limit := int64(MaxDownloadSize)
+	if f.Size > 0 {
+		limit = f.Size
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(resp.Body, limit+1))
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", f.Name, err)
+	}
+
+	switch sum := hex.EncodeToString(h.Sum(nil)); {
+	case n > limit:
+		return fmt.Errorf("download of %s is larger than %d bytes", f.Name, limit)
+	case f.Size > 0 && n != f.Size:
+		return fmt.Errorf("download of %s has %d bytes, expected %d", f.Name, n, f.Size)
+	case !strings.EqualFold(sum, f.SHA256):
+		return fmt.Errorf("download of %s has checksum %s, expected %s", f.Name, sum, f.SHA256)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to install %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// Verify reports whether the file at path matches the checksum of f, and
+// false without an error if it does not exist
+func Verify(f File, path string) (bool, error) {
+	sum, err := fileSHA256(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(sum, f.SHA256), nil
+}
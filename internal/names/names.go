@@ -0,0 +1,105 @@
+// Package names normalizes the names of users, so the same name typed on
+// different keyboards is stored alike, and compares them for search and
+// duplicate detection regardless of case, accents and, optionally, script:
+// with transliteration, "Мария" and "Maria" are the same name.
+package names
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns the name as it is stored: in Unicode normalization form
+// C, so "é" typed as one code point or as "e" and a combining accent is the
+// same, trimmed and with every run of white space made a single space
+func Normalize(name string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(name)), " ")
+}
+
+// Key returns the form of a name that search compares: lower case, without
+// accents, and with punctuation made a space. With transliteration,
+// Cyrillic and Greek letters are written in Latin ones, and the spellings
+// transliterations differ in are folded: "Мария", "Mariya" and "Maria" all
+// become "maria". Such keys are loose, e.g. "Anna" and "Ana" are the same.
+func Key(name string, transliterate bool) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// accents, separated from their letters by NFKD
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			r = unicode.ToLower(r)
+			if latin, ok := transliterations[r]; ok && transliterate {
+				b.WriteString(latin)
+				continue
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	key := strings.Join(strings.Fields(b.String()), " ")
+	if transliterate {
+		key = fold(key)
+	}
+	return key
+}
+
+// Equal reports whether two names are the same name
+func Equal(a, b string, transliterate bool) bool {
+	return Key(a, transliterate) == Key(b, transliterate)
+}
+
+// Contains reports whether a name contains the query
+func Contains(name, query string, transliterate bool) bool {
+	return strings.Contains(Key(name, transliterate), Key(query, transliterate))
+}
+
+// folds make the Latin spellings of a transliterated name alike, longest
+// first
+var folds = strings.NewReplacer(
+	"kh", "h",
+	"ph", "f",
+	"x", "ks",
+	"y", "i",
+	"j", "i",
+	"w", "v",
+)
+
+// fold folds the spellings of a transliterated name and makes doubled
+// letters single, as transliterations of "ия" give "iia" or "iya"
+func fold(key string) string {
+	key = folds.Replace(key)
+	var b strings.Builder
+	var last rune
+	for _, r := range key {
+		if r != last || r == ' ' {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
+
+// transliterations write the lower case Cyrillic letters of Russian,
+// Ukrainian, Belarusian, Serbian, Macedonian and Kazakh and the Greek
+// letters in Latin ones, mostly as passports do (ICAO 9303). Letters with
+// accents, such as "ё", "й" and "ά", are decomposed by NFKD first.
+var transliterations = map[rune]string{
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+	'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "",
+	'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ґ': "g",
+	'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѕ': "dz",
+	'ә': "a", 'ғ': "g", 'қ': "k", 'ң': "n", 'ө': "o", 'ұ': "u", 'ү': "u", 'һ': "h",
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
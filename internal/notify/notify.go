@@ -0,0 +1,518 @@
+// Package notify sends notifications of events, e.g. a user being enrolled,
+// by email (SMTP), SMS (Twilio) and Slack or Microsoft Teams webhooks.
+// Which events are sent where is configured as rules, each with a
+// text/template message and optionally a rate limit.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// Event is something notifications can be sent about
+type Event string
+
+// Events of notification rules
+const (
+	// EventEnrolled is sent when a user is enrolled
+	EventEnrolled Event = "enrolled"
+	// EventExpiring is sent by 'face notify expiring' for visitors whose
+	// access expires soon
+	EventExpiring Event = "expiring"
+	// EventWatchlistMatch is sent when a user on the watchlist is
+	// identified
+	EventWatchlistMatch Event = "watchlist_match"
+	// EventVerifyFailures is sent when verifying a user failed repeatedly
+	EventVerifyFailures Event = "verify_failures"
+	// EventSystemError is sent when a request fails with an internal error
+	EventSystemError Event = "system_error"
+)
+
+// Events lists every event
+var Events = []Event{EventEnrolled, EventExpiring, EventWatchlistMatch, EventVerifyFailures, EventSystemError}
+
+// Severities of events
+const (
+	SeverityInfo = "info"
+	SeverityHigh = "high"
+)
+
+// Severity returns how urgent the event is
+func (e Event) Severity() string {
+	switch e {
+	case EventWatchlistMatch, EventVerifyFailures, EventSystemError:
+		return SeverityHigh
+	default:
+		return SeverityInfo
+	}
+}
+
+// Channel is how a notification is delivered
+type Channel string
+
+// Channels of notification rules
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+	ChannelSlack Channel = "slack"
+	ChannelTeams Channel = "teams"
+)
+
+// DefaultWatchlistKey is the metadata entry putting a user on the watchlist
+const DefaultWatchlistKey = "watchlist"
+
+// Repeated verification failure defaults, used when the config leaves them
+// at 0
+const (
+	DefaultVerifyFailures             = 3
+	DefaultVerifyFailureWindowMinutes = 10
+)
+
+// timeout bounds sending one notification, so an unreachable server cannot
+// hang a command
+const timeout = 15 * time.Second
+
+// Default templates of each event, used when a rule has none
+var (
+	defaultSubjects = map[Event]string{
+		EventEnrolled:       "{{.Name}} was enrolled",
+		EventExpiring:       "Access of {{.Name}} expires {{.ExpiresAt.Format \"2006-01-02 15:04\"}}",
+		EventWatchlistMatch: "Watchlist match: {{.Name}}",
+		EventVerifyFailures: "Repeated verification failures: {{.Name}}",
+		EventSystemError:    "Face recognition error",
+	}
+	defaultTemplates = map[Event]string{
+		EventEnrolled:       "{{.Name}} was enrolled with {{.Faces}} face(s) at {{.Time.Format \"2006-01-02 15:04\"}}.",
+		EventExpiring:       "Access of {{.Name}} expires at {{.ExpiresAt.Format \"2006-01-02 15:04\"}}.",
+		EventWatchlistMatch: "{{.Name}} was identified{{if .Camera}} at {{.Camera}}{{end}} with {{printf \"%.0f\" .Percent}}% confidence at {{.Time.Format \"2006-01-02 15:04\"}}.",
+		EventVerifyFailures: "Verifying {{.Name}} failed {{.Failures}} times, most recently at {{.Time.Format \"2006-01-02 15:04\"}}.",
+		EventSystemError:    "A request failed at {{.Time.Format \"2006-01-02 15:04\"}}: {{.Error}}{{if .RequestID}} (request {{.RequestID}}){{end}}",
+	}
+)
+
+// Config holds the notification settings of the config file
+type Config struct {
+	SMTP   SMTPConfig   `json:"smtp,omitempty"`
+	Twilio TwilioConfig `json:"twilio,omitempty"`
+	Rules  []Rule       `json:"rules,omitempty"`
+	// WatchlistKey is the metadata entry that, set to true, puts a user on
+	// the watchlist, DefaultWatchlistKey if empty
+	WatchlistKey string `json:"watchlist_key,omitempty"`
+	// VerifyFailures is how many failed verifications of a user within
+	// VerifyFailureWindowMinutes send verify_failures,
+	// DefaultVerifyFailures if 0
+	VerifyFailures             int `json:"verify_failures,omitempty"`
+	VerifyFailureWindowMinutes int `json:"verify_failure_window_minutes,omitempty"` // DefaultVerifyFailureWindowMinutes if 0
+
+	// Tenant is the tenant of the installation, which rules can be
+	// limited to; set from the tenant of the config, not the notifications
+	Tenant string `json:"-"`
+}
+
+// Rule sends a message about an event to recipients
+type Rule struct {
+	Event   Event   `json:"event"`
+	Channel Channel `json:"channel"`
+	// To are email addresses, or phone numbers in E.164 format for SMS
+	To []string `json:"to,omitempty"`
+	// Webhook is the incoming webhook URL of Slack or Teams
+	Webhook string `json:"webhook,omitempty"`
+	// Subject is the template of the email subject or the title of the
+	// Slack or Teams message, a default of the event if empty
+	Subject string `json:"subject,omitempty"`
+	// Template is the template of the message, a default of the event if
+	// empty
+	Template string `json:"template,omitempty"`
+	// MinIntervalMinutes rate limits the rule: messages sent sooner after
+	// the previous one are suppressed and counted in the next, 0 for no
+	// limit. The limit holds within one process, e.g. 'face serve'.
+	MinIntervalMinutes int `json:"min_interval_minutes,omitempty"`
+	// Tenants limits the rule to installations of these tenants, every
+	// installation if empty
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// Data is what message templates are executed with
+type Data struct {
+	Event      Event
+	Severity   string
+	Time       time.Time
+	Tenant     string
+	UserID     string
+	Name       string
+	Email      string
+	Phone      string
+	Faces      int
+	Confidence float64
+	Camera     string
+	ExpiresAt  time.Time
+	// Failures is the number of failed verifications of verify_failures
+	Failures int
+	// Error and RequestID describe the failed request of system_error
+	Error     string
+	RequestID string
+	// Suppressed is the number of messages of the rule the rate limit
+	// suppressed since the previous one
+	Suppressed int
+}
+
+// Percent returns the confidence in percent
+func (d Data) Percent() float64 {
+	return d.Confidence * 100
+}
+
+// UserData returns the data of an event about a user, as of now
+func UserData(event Event, user *models.User) Data {
+	data := Data{
+		Event:  event,
+		Time:   time.Now(),
+		UserID: user.ID,
+		Name:   user.Name,
+		Email:  user.Email,
+		Phone:  user.Phone,
+		Faces:  len(user.Faces),
+	}
+	if user.ExpiresAt != nil {
+		data.ExpiresAt = *user.ExpiresAt
+	}
+	return data
+}
+
+// Enabled reports whether any rule sends notifications of the event
+func (c Config) Enabled(event Event) bool {
+	for _, r := range c.Rules {
+		if r.Event == event && r.appliesTo(c.Tenant) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnWatchlist reports whether the user's metadata puts them on the
+// watchlist
+func (c Config) OnWatchlist(user *models.User) bool {
+	key := c.WatchlistKey
+	if key == "" {
+		key = DefaultWatchlistKey
+	}
+
+	switch v := user.Metadata[key].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// VerifyFailureLimit returns how many failed verifications of a user within
+// which time send verify_failures
+func (c Config) VerifyFailureLimit() (int, time.Duration) {
+	failures, minutes := c.VerifyFailures, c.VerifyFailureWindowMinutes
+	if failures == 0 {
+		failures = DefaultVerifyFailures
+	}
+	if minutes == 0 {
+		minutes = DefaultVerifyFailureWindowMinutes
+	}
+	return failures, time.Duration(minutes) * time.Minute
+}
+
+// Validate checks the rules and that the channels they use are configured
+func (c Config) Validate() error {
+	if c.VerifyFailures < 0 || c.VerifyFailureWindowMinutes < 0 {
+		return errors.New("verify_failures and verify_failure_window_minutes must not be negative")
+	}
+	for i, r := range c.Rules {
+		if err := c.validateRule(r); err != nil {
+			return fmt.Errorf("notification rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (c Config) validateRule(r Rule) error {
+	if _, ok := defaultTemplates[r.Event]; !ok {
+		return fmt.Errorf("unknown event %q (use enrolled, expiring, watchlist_match, verify_failures or system_error)", r.Event)
+	}
+	if r.MinIntervalMinutes < 0 {
+		return errors.New("min_interval_minutes must not be negative")
+	}
+	if err := c.validateChannel(r); err != nil {
+		return err
+	}
+	if _, _, err := r.templates(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateChannel checks that the rule has recipients and its channel is
+// configured
+func (c Config) validateChannel(r Rule) error {
+	switch r.Channel {
+	case ChannelEmail, ChannelSMS:
+		if len(r.To) == 0 {
+			return errors.New("no recipients")
+		}
+	case ChannelSlack, ChannelTeams:
+		if u, err := url.Parse(r.Webhook); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%s needs the webhook URL", r.Channel)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown channel %q (use email, sms, slack or teams)", r.Channel)
+	}
+
+	if r.Channel == ChannelEmail && (c.SMTP.Host == "" || c.SMTP.From == "") {
+		return errors.New("email needs smtp host and from")
+	}
+	if r.Channel == ChannelSMS && (c.Twilio.AccountSID == "" || c.Twilio.AuthToken == "" || c.Twilio.From == "") {
+		return errors.New("sms needs twilio account_sid, auth_token and from")
+	}
+	return nil
+}
+
+// appliesTo reports whether the rule applies to an installation of the
+// tenant
+func (r Rule) appliesTo(tenant string) bool {
+	return len(r.Tenants) == 0 || slices.Contains(r.Tenants, tenant)
+}
+
+// Recipients describes where the rule sends messages, without secrets
+func (r Rule) Recipients() string {
+	if r.Channel == ChannelSlack || r.Channel == ChannelTeams {
+		if u, err := url.Parse(r.Webhook); err == nil {
+			return r.Channel.String() + " webhook at " + u.Host
+		}
+		return r.Channel.String() + " webhook"
+	}
+	return r.Channel.String() + " to " + strings.Join(r.To, ", ")
+}
+
+func (c Channel) String() string {
+	return string(c)
+}
+
+// templates parses the subject and message templates of the rule
+func (r Rule) templates() (*template.Template, *template.Template, error) {
+	subject, text := r.Subject, r.Template
+	if subject == "" {
+		subject = defaultSubjects[r.Event]
+	}
+	if text == "" {
+		text = defaultTemplates[r.Event]
+	}
+
+	subjectTmpl, err := template.New("subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+	textTmpl, err := template.New("template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return subjectTmpl, textTmpl, nil
+}
+
+// Message is a rendered notification
+type Message struct {
+	Channel  Channel
+	To       []string
+	Webhook  string
+	Severity string
+	Subject  string // email subject, or Slack and Teams title
+	Body     string
+}
+
+// Render returns the message of the rule for the data
+func (r Rule) Render(data Data) (Message, error) {
+	subjectTmpl, textTmpl, err := r.templates()
+	if err != nil {
+		return Message{}, err
+	}
+
+	data.Severity = data.Event.Severity()
+	var subject, body bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render subject: %w", err)
+	}
+	if err := textTmpl.Execute(&body, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render message: %w", err)
+	}
+	if data.Suppressed > 0 {
+		fmt.Fprintf(&body, "\n(%d similar notification(s) suppressed by the rate limit)", data.Suppressed)
+	}
+	return Message{
+		Channel:  r.Channel,
+		To:       r.To,
+		Webhook:  r.Webhook,
+		Severity: data.Severity,
+		Subject:  strings.TrimSpace(subject.String()),
+		Body:     body.String(),
+	}, nil
+}
+
+// Notifier sends the notifications of the configured rules
+type Notifier struct {
+	cfg Config
+
+	// mu guards the rate limits: when each rule last sent a message, and
+	// how many it suppressed since
+	mu         sync.Mutex
+	lastSent   map[int]time.Time
+	suppressed map[int]int
+}
+
+// New returns a notifier of the configuration
+func New(cfg Config) (*Notifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Notifier{cfg: cfg, lastSent: make(map[int]time.Time), suppressed: make(map[int]int)}, nil
+}
+
+// Rules returns the rules of the event that apply to the tenant
+func (n *Notifier) Rules(event Event) []Rule {
+	var rules []Rule
+	for _, i := range n.ruleIndexes(event) {
+		rules = append(rules, n.cfg.Rules[i])
+	}
+	return rules
+}
+
+func (n *Notifier) ruleIndexes(event Event) []int {
+	var indexes []int
+	for i, r := range n.cfg.Rules {
+		if r.Event == event && r.appliesTo(n.cfg.Tenant) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Notify sends the message of every rule of the event, except those the
+// rate limit of their rule suppresses. A failing rule does not keep the
+// others from being sent; the errors of all are returned.
+func (n *Notifier) Notify(ctx context.Context, data Data) error {
+	if data.Tenant == "" {
+		data.Tenant = n.cfg.Tenant
+	}
+
+	var errs []error
+	for _, i := range n.ruleIndexes(data.Event) {
+		r := n.cfg.Rules[i]
+		suppressed, ok := n.admit(i, r, data.Time)
+		if !ok {
+			continue
+		}
+		data.Suppressed = suppressed
+
+		msg, err := r.Render(data)
+		if err == nil {
+			err = n.Send(ctx, msg)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Recipients(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// admit applies the rate limit of rule i to a message at t, returning
+// whether it may be sent and how many messages were suppressed before it
+func (n *Notifier) admit(i int, r Rule, t time.Time) (int, bool) {
+	if r.MinIntervalMinutes == 0 {
+		return 0, true
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if last, ok := n.lastSent[i]; ok && t.Sub(last) < time.Duration(r.MinIntervalMinutes)*time.Minute {
+		n.suppressed[i]++
+		return 0, false
+	}
+	suppressed := n.suppressed[i]
+	n.lastSent[i] = t
+	n.suppressed[i] = 0
+	return suppressed, true
+}
+
+// Send delivers a message to each of its recipients
+func (n *Notifier) Send(ctx context.Context, msg Message) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch msg.Channel {
+	case ChannelEmail:
+		return sendEmail(ctx, n.cfg.SMTP, msg)
+	case ChannelSlack, ChannelTeams:
+		return sendWebhook(ctx, msg)
+	}
+	var errs []error
+	for _, to := range msg.To {
+		if err := sendSMS(ctx, n.cfg.Twilio, to, msg.Body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FailureCounter counts the failures of each key, e.g. of verifying a
+// user, reporting when a key failed a number of times within a window
+type FailureCounter struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+// NewFailureCounter returns a counter reporting limit failures within
+// window
+func NewFailureCounter(limit int, window time.Duration) *FailureCounter {
+	return &FailureCounter{limit: limit, window: window, failures: make(map[string][]time.Time)}
+}
+
+// Fail records a failure of the key at t, returning the number of failures
+// within the window and whether it reached the limit. The count starts
+// over once it does, so a key keeps failing for limit more failures before
+// it is reported again.
+func (c *FailureCounter) Fail(key string, t time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recent := c.failures[key][:0]
+	for _, f := range c.failures[key] {
+		if t.Sub(f) < c.window {
+			recent = append(recent, f)
+		}
+	}
+	recent = append(recent, t)
+	if len(recent) >= c.limit {
+		delete(c.failures, key)
+		return len(recent), true
+	}
+	c.failures[key] = recent
+	return len(recent), false
+}
+
+// Succeed forgets the failures of the key
+func (c *FailureCounter) Succeed(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.failures, key)
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultTwilioURL is the Twilio REST API, used when the config has none
+const DefaultTwilioURL = "https://api.twilio.com"
+
+// TwilioConfig holds the Twilio account sending SMS
+type TwilioConfig struct {
+	AccountSID string `json:"account_sid,omitempty"`
+	AuthToken  string `json:"auth_token,omitempty"`
+	// From is the sending phone number or messaging service SID
+	From string `json:"from,omitempty"`
+	// APIURL is the base URL of the API, DefaultTwilioURL if empty
+	APIURL string `json:"api_url,omitempty"`
+}
+
+// sendSMS sends a text message to one phone number
+func sendSMS(ctx context.Context, cfg TwilioConfig, to, body string) error {
+	base := cfg.APIURL
+	if base == "" {
+		base = DefaultTwilioURL
+	}
+	endpoint := strings.TrimSuffix(base, "/") + "/2010-04-01/Accounts/" + url.PathEscape(cfg.AccountSID) + "/Messages.json"
+
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(cfg.From, "MG") {
+		form.Set("MessagingServiceSid", cfg.From)
+	} else {
+		form.Set("From", cfg.From)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(cfg.AccountSID, cfg.AuthToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS to %s: %w", to, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// Twilio explains refusals, e.g. an unverified number, in the body
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("failed to send SMS to %s: %s", to, apiErr.Message)
+		}
+		return fmt.Errorf("failed to send SMS to %s: %s", to, resp.Status)
+	}
+	return nil
+}
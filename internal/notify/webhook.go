@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sendWebhook posts a message to a Slack or Teams incoming webhook
+func sendWebhook(ctx context.Context, msg Message) error {
+	var payload any
+	if msg.Channel == ChannelSlack {
+		payload = slackPayload(msg)
+	} else {
+		payload = teamsPayload(msg)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the URL holds the webhook's secret, so it is left out
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to post to the %s webhook: %w", msg.Channel, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// both explain refusals, e.g. a revoked webhook, in a short body
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if text := strings.TrimSpace(string(data)); text != "" {
+			return fmt.Errorf("%s webhook refused the message: %s: %s", msg.Channel, resp.Status, text)
+		}
+		return fmt.Errorf("%s webhook refused the message: %s", msg.Channel, resp.Status)
+	}
+	return nil
+}
+
+// slackPayload returns the Slack message of a notification, the title in
+// bold and high severity ones marked
+func slackPayload(msg Message) map[string]any {
+	title := msg.Subject
+	if msg.Severity == SeverityHigh {
+		title = ":rotating_light: " + title
+	}
+	return map[string]any{"text": "*" + title + "*\n" + msg.Body}
+}
+
+// teamsPayload returns the Teams message of a notification as an Adaptive
+// Card, which both incoming webhooks and Workflows accept
+func teamsPayload(msg Message) map[string]any {
+	title := map[string]any{"type": "TextBlock", "text": msg.Subject, "weight": "bolder", "size": "medium", "wrap": true}
+	if msg.Severity == SeverityHigh {
+		title["color"] = "attention"
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []any{
+			title,
+			map[string]any{"type": "TextBlock", "text": msg.Body, "wrap": true},
+		},
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{
+			map[string]any{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package onvif
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// discoveryAddress is the WS-Discovery multicast group and port
+const discoveryAddress = "239.255.255.250:3702"
+
+// probe asks ONVIF video devices to announce themselves
+const probe = `<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope"
+  xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing"
+  xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery"
+  xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<e:Header>
+  <w:MessageID>uuid:%s</w:MessageID>
+  <w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>
+  <w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>
+</e:Header>
+<e:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></e:Body>
+</e:Envelope>`
+
+// Device is a camera that answered a discovery probe
+type Device struct {
+	// Address is the first device service URL the camera announced
+	Address string
+	// Addresses are all the device service URLs, e.g. one per network
+	Addresses []string
+	// Name, Hardware and Location come from the camera's ONVIF scopes
+	// and may be empty
+	Name     string
+	Hardware string
+	Location string
+}
+
+// Discover sends a WS-Discovery probe to the local network and returns the
+// cameras that answer within timeout, ordered by address
+func Discover(timeout time.Duration) ([]Device, error) {
+	group, err := net.ResolveUDPAddr("udp4", discoveryAddress)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open discovery socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteToUDP([]byte(fmt.Sprintf(probe, uuid.New().String())), group); err != nil {
+		return nil, fmt.Errorf("failed to send discovery probe: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]Device)
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read discovery replies: %w", err)
+		}
+		for _, d := range parseProbeMatches(buf[:n]) {
+			found[d.Address] = d
+		}
+	}
+
+	devices := make([]Device, 0, len(found))
+	for _, d := range found {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Address < devices[j].Address })
+	return devices, nil
+}
+
+// parseProbeMatches returns the devices of a ProbeMatches message, none if
+// the message is something else
+func parseProbeMatches(data []byte) []Device {
+	var msg struct {
+		Matches []struct {
+			Scopes string `xml:"Scopes"`
+			XAddrs string `xml:"XAddrs"`
+		} `xml:"Body>ProbeMatches>ProbeMatch"`
+	}
+	if xml.Unmarshal(data, &msg) != nil {
+		return nil
+	}
+
+	var devices []Device
+	for _, m := range msg.Matches {
+		addrs := strings.Fields(m.XAddrs)
+		if len(addrs) == 0 {
+			continue
+		}
+		d := Device{Address: addrs[0], Addresses: addrs}
+		for _, scope := range strings.Fields(m.Scopes) {
+			d.setScope(scope)
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// setScope records an onvif://www.onvif.org/<kind>/<value> scope
+func (d *Device) setScope(scope string) {
+	rest, ok := strings.CutPrefix(scope, "onvif://www.onvif.org/")
+	if !ok {
+		return
+	}
+	kind, value, _ := strings.Cut(rest, "/")
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+
+	switch kind {
+	case "name":
+		d.Name = value
+	case "hardware":
+		d.Hardware = value
+	case "location":
+		if d.Location == "" {
+			d.Location = value
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package onvif finds ONVIF cameras on the local network and asks them for
+// their snapshot and stream URLs, so cameras can be added by name instead
+// of by hand-crafted URLs. Only the few device and media service calls
+// needed for that are implemented.
+package onvif
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Camera is the configuration of an ONVIF camera
+type Camera struct {
+	// Address is the device service URL, e.g.
+	// http://192.168.1.20/onvif/device_service, as found by Discover
+	Address  string `json:"onvif"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Profile is the token or name of the media profile to use, the first
+	// profile if empty
+	Profile string `json:"profile,omitempty"`
+}
+
+// Profile is a media profile of a camera, a combination of video source
+// and encoder settings
+type Profile struct {
+	Token string
+	Name  string
+}
+
+// maxSnapshotBytes bounds the size of a downloaded snapshot
+const maxSnapshotBytes = 32 << 20
+
+// Client talks to one camera
+type Client struct {
+	camera Camera
+	http   *http.Client
+}
+
+// NewClient creates a client for a camera
+func NewClient(camera Camera) (*Client, error) {
+	if camera.Address == "" {
+		return nil, errors.New("camera has no ONVIF address")
+	}
+	return &Client{camera: camera, http: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+// Profiles returns the media profiles of the camera
+func (c *Client) Profiles() ([]Profile, error) {
+	media, err := c.mediaAddress()
+	if err != nil {
+		return nil, err
+	}
+	return c.profiles(media)
+}
+
+// profiles returns the media profiles of the media service at media
+func (c *Client) profiles(media string) ([]Profile, error) {
+	var resp struct {
+		Profiles []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+		} `xml:"Body>GetProfilesResponse>Profiles"`
+	}
+	if err := c.call(media, `<GetProfiles xmlns="http://www.onvif.org/ver10/media/wsdl"/>`, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get profiles: %w", err)
+	}
+
+	profiles := make([]Profile, len(resp.Profiles))
+	for i, p := range resp.Profiles {
+		profiles[i] = Profile{Token: p.Token, Name: p.Name}
+	}
+	return profiles, nil
+}
+
+// SnapshotURI returns the URL of a JPEG snapshot of the configured profile
+func (c *Client) SnapshotURI() (string, error) {
+	return c.mediaURI("GetSnapshotUri", "")
+}
+
+// StreamURI returns the RTSP URL of the configured profile's stream,
+// without credentials
+func (c *Client) StreamURI() (string, error) {
+	setup := `<StreamSetup><Stream xmlns="http://www.onvif.org/ver10/schema">RTP-Unicast</Stream>` +
+		`<Transport xmlns="http://www.onvif.org/ver10/schema"><Protocol>RTSP</Protocol></Transport></StreamSetup>`
+	return c.mediaURI("GetStreamUri", setup)
+}
+
+// Snapshot downloads a snapshot of the configured profile, returning the
+// image data
+func (c *Client) Snapshot() ([]byte, error) {
+	uri, err := c.SnapshotURI()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.get(uri, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if resp, err = c.get(uri, challenge); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download snapshot: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSnapshotBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	if len(data) > maxSnapshotBytes {
+		return nil, errors.New("snapshot is too large")
+	}
+	return data, nil
+}
+
+// get requests a URL, answering the authentication challenge if given
+func (c *Client) get(uri, challenge string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot URL: %w", err)
+	}
+	if challenge != "" {
+		if err := authorize(req, challenge, c.camera.Username, c.camera.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	return resp, nil
+}
+
+// mediaURI calls GetSnapshotUri or GetStreamUri for the configured profile
+func (c *Client) mediaURI(method, setup string) (string, error) {
+	media, err := c.mediaAddress()
+	if err != nil {
+		return "", err
+	}
+	token, err := c.profileToken(media)
+	if err != nil {
+		return "", err
+	}
+
+	// The response element is named after the method, so any element of
+	// the body is accepted
+	var resp struct {
+		Body struct {
+			Response struct {
+				URI string `xml:"MediaUri>Uri"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	body := fmt.Sprintf(`<%s xmlns="http://www.onvif.org/ver10/media/wsdl">%s<ProfileToken>%s</ProfileToken></%s>`,
+		method, setup, xmlEscape(token), method)
+	if err := c.call(media, body, &resp); err != nil {
+		return "", fmt.Errorf("%s failed: %w", method, err)
+	}
+	uri := resp.Body.Response.URI
+	if uri == "" {
+		return "", fmt.Errorf("camera returned no URI for profile %s", token)
+	}
+	return uri, nil
+}
+
+// profileToken returns the token of the configured profile
+func (c *Client) profileToken(media string) (string, error) {
+	profiles, err := c.profiles(media)
+	if err != nil {
+		return "", err
+	}
+	if len(profiles) == 0 {
+		return "", errors.New("camera has no media profiles")
+	}
+	if c.camera.Profile == "" {
+		return profiles[0].Token, nil
+	}
+	for _, p := range profiles {
+		if p.Token == c.camera.Profile || p.Name == c.camera.Profile {
+			return p.Token, nil
+		}
+	}
+	return "", fmt.Errorf("camera has no profile %q", c.camera.Profile)
+}
+
+// mediaAddress returns the URL of the camera's media service
+func (c *Client) mediaAddress() (string, error) {
+	var resp struct {
+		XAddr string `xml:"Body>GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+	}
+	body := `<GetCapabilities xmlns="http://www.onvif.org/ver10/device/wsdl"><Category>Media</Category></GetCapabilities>`
+	if err := c.call(c.camera.Address, body, &resp); err != nil {
+		return "", fmt.Errorf("failed to get capabilities: %w", err)
+	}
+	if resp.XAddr == "" {
+		return "", errors.New("camera has no media service")
+	}
+	return resp.XAddr, nil
+}
+
+// call sends a SOAP request and decodes the response envelope into resp
+func (c *Client) call(address, body string, resp any) error {
+	var envelope bytes.Buffer
+	envelope.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	envelope.WriteString(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Header>`)
+	if c.camera.Username != "" {
+		envelope.WriteString(usernameToken(c.camera.Username, c.camera.Password, time.Now()))
+	}
+	envelope.WriteString(`</s:Header><s:Body>`)
+	envelope.WriteString(body)
+	envelope.WriteString(`</s:Body></s:Envelope>`)
+
+	httpResp, err := c.http.Post(address, "application/soap+xml; charset=utf-8", &envelope)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var fault struct {
+		Reason string `xml:"Body>Fault>Reason>Text"`
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		if xml.Unmarshal(data, &fault) == nil && fault.Reason != "" {
+			return fmt.Errorf("%s: %s", httpResp.Status, fault.Reason)
+		}
+		return errors.New(httpResp.Status)
+	}
+
+	if err := xml.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// usernameToken returns the WS-Security header authenticating ONVIF calls,
+// with the password digested as the ONVIF core specification requires
+func usernameToken(username, password string, now time.Time) string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	created := now.UTC().Format(time.RFC3339)
+
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	return `<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">` +
+		`<UsernameToken><Username>` + xmlEscape(username) + `</Username>` +
+		`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">` + digest + `</Password>` +
+		`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">` +
+		base64.StdEncoding.EncodeToString(nonce) + `</Nonce>` +
+		`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">` + created + `</Created>` +
+		`</UsernameToken></Security>`
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
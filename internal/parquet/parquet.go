@@ -0,0 +1,305 @@
+// Package parquet writes flat tables as Apache Parquet files, which data
+// tools read without a schema of their own. It writes what 'face audit
+// export' needs: required string, timestamp and number columns, plainly
+// encoded, optionally compressed with gzip.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of the values of a column
+type Type int
+
+const (
+	// String columns hold string values, as UTF-8 byte arrays
+	String Type = iota
+	// Timestamp columns hold time.Time values, as milliseconds since the
+	// Unix epoch
+	Timestamp
+	// Int64 columns hold int64 values
+	Int64
+	// Double columns hold float64 values
+	Double
+)
+
+// Column is a column of a file
+type Column struct {
+	Name string
+	Type Type
+}
+
+// RowGroupRows is the number of rows buffered before they are written out
+// as a row group
+const RowGroupRows = 65536
+
+// magic starts and ends every Parquet file
+const magic = "PAR1"
+
+// createdBy names the writer of the files in their metadata
+const createdBy = "face"
+
+// Values of the enums of the Parquet format
+const (
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	repetitionRequired = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	pageData           = 0
+
+	codecUncompressed = 0
+	codecGzip         = 2
+)
+
+// Writer writes rows to a Parquet file. Rows are buffered into row groups,
+// and the file is complete once Close returns.
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	columns []Column
+	gzip    bool
+
+	// values are the plain encoded values of the buffered rows, by column
+	values []bytes.Buffer
+	rows   int64
+
+	groups    []rowGroup
+	totalRows int64
+	err       error
+}
+
+// rowGroup is a row group written to the file
+type rowGroup struct {
+	rows   int64
+	chunks []columnChunk
+}
+
+// columnChunk is the page of a column in a row group
+type columnChunk struct {
+	offset             int64
+	uncompressed, size int64
+}
+
+// NewWriter returns a writer of rows of columns to w, compressing the pages
+// with gzip if compress is set
+func NewWriter(w io.Writer, columns []Column, compress bool) *Writer {
+	return &Writer{w: w, columns: columns, gzip: compress, values: make([]bytes.Buffer, len(columns))}
+}
+
+// Write adds a row, one value per column: a string, time.Time, int64 or
+// float64 as the column's type says
+func (w *Writer) Write(row []any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(row), len(w.columns))
+	}
+	for i, v := range row {
+		if err := w.encode(i, v); err != nil {
+			return err
+		}
+	}
+	w.rows++
+	if w.rows >= RowGroupRows {
+		return w.flush()
+	}
+	return nil
+}
+
+// encode appends the plain encoding of a value to its column
+func (w *Writer) encode(i int, v any) error {
+	col, buf := w.columns[i], &w.values[i]
+	switch col.Type {
+	case String:
+		s, ok := v.(string)
+		if !ok {
+			break
+		}
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+		buf.WriteString(s)
+		return nil
+	case Timestamp:
+		t, ok := v.(time.Time)
+		if !ok {
+			break
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(t.UnixMilli())))
+		return nil
+	case Int64:
+		n, ok := v.(int64)
+		if !ok {
+			break
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(n)))
+		return nil
+	case Double:
+		f, ok := v.(float64)
+		if !ok {
+			break
+		}
+		buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)))
+		return nil
+	}
+	return fmt.Errorf("invalid value %v for column %s", v, col.Name)
+}
+
+// Close writes the buffered rows and the footer of the file. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.offset == 0 {
+		w.write([]byte(magic))
+	}
+	if w.rows > 0 {
+		w.flush()
+	}
+	footer := w.footer()
+	w.write(footer)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.write([]byte(magic))
+	return w.err
+}
+
+// flush writes the buffered rows as a row group, one data page per column
+func (w *Writer) flush() error {
+	if w.offset == 0 {
+		w.write([]byte(magic))
+	}
+	group := rowGroup{rows: w.rows}
+	for i := range w.columns {
+		group.chunks = append(group.chunks, w.writePage(w.values[i].Bytes()))
+		w.values[i].Reset()
+	}
+	w.groups = append(w.groups, group)
+	w.totalRows += w.rows
+	w.rows = 0
+	return w.err
+}
+
+// writePage writes the values of a column as a data page
+func (w *Writer) writePage(values []byte) columnChunk {
+	data := values
+	if w.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(values)
+		zw.Close()
+		data = buf.Bytes()
+	}
+
+	t := newThriftWriter()
+	t.I32(1, pageData)
+	t.I32(2, int32(len(values)))
+	t.I32(3, int32(len(data)))
+	t.Begin(5)
+	t.I32(1, int32(w.rows))
+	t.I32(2, encodingPlain)
+	t.I32(3, encodingRLE)
+	t.I32(4, encodingRLE)
+	t.End()
+	header := t.Bytes()
+
+	chunk := columnChunk{
+		offset:       w.offset,
+		uncompressed: int64(len(header) + len(values)),
+		size:         int64(len(header) + len(data)),
+	}
+	w.write(header)
+	w.write(data)
+	return chunk
+}
+
+// footer encodes the metadata of the file
+func (w *Writer) footer() []byte {
+	codec := int32(codecUncompressed)
+	if w.gzip {
+		codec = codecGzip
+	}
+
+	t := newThriftWriter()
+	t.I32(1, 1)
+	t.List(2, thriftStruct, len(w.columns)+1)
+	t.Begin(0)
+	t.String(4, "schema")
+	t.I32(5, int32(len(w.columns)))
+	t.End()
+	for _, col := range w.columns {
+		physical, converted := col.types()
+		t.Begin(0)
+		t.I32(1, physical)
+		t.I32(3, repetitionRequired)
+		t.String(4, col.Name)
+		if converted >= 0 {
+			t.I32(6, converted)
+		}
+		t.End()
+	}
+	t.I64(3, w.totalRows)
+	t.List(4, thriftStruct, len(w.groups))
+	for _, group := range w.groups {
+		var total int64
+		t.Begin(0)
+		t.List(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			physical, _ := w.columns[i].types()
+			t.Begin(0)
+			t.I64(2, chunk.offset)
+			t.Begin(3)
+			t.I32(1, physical)
+			t.List(2, thriftI32, 1)
+			t.ListI32(encodingPlain)
+			t.List(3, thriftBinary, 1)
+			t.ListString(w.columns[i].Name)
+			t.I32(4, codec)
+			t.I64(5, group.rows)
+			t.I64(6, chunk.uncompressed)
+			t.I64(7, chunk.size)
+			t.I64(9, chunk.offset)
+			t.End()
+			t.End()
+			total += chunk.uncompressed
+		}
+		t.I64(2, total)
+		t.I64(3, group.rows)
+		t.End()
+	}
+	t.String(6, createdBy)
+	return t.Bytes()
+}
+
+// types returns the physical and converted types of a column, -1 if it has
+// no converted type
+func (c Column) types() (physical, converted int32) {
+	switch c.Type {
+	case Timestamp:
+		return physicalInt64, convertedTimestampMillis
+	case Int64:
+		return physicalInt64, -1
+	case Double:
+		return physicalDouble, -1
+	default:
+		return physicalByteArray, convertedUTF8
+	}
+}
+
+// write writes to the underlying writer, keeping the first error
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	w.err = err
+}
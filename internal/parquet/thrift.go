@@ -0,0 +1,109 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Field types of the Thrift compact protocol, which encodes the page
+// headers and the file footer
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes a Thrift struct in the compact protocol. Fields
+// must be written in increasing order of their IDs.
+type thriftWriter struct {
+	buf bytes.Buffer
+	// last is the ID of the last field written in each open struct
+	last []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+// field writes the header of a field
+func (t *thriftWriter) field(id int16, typ byte) {
+	top := len(t.last) - 1
+	if delta := id - t.last[top]; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last[top] = id
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// I32 writes an i32 field
+func (t *thriftWriter) I32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+// I64 writes an i64 field
+func (t *thriftWriter) I64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+// String writes a binary field
+func (t *thriftWriter) String(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// Begin opens a struct field, or a struct element of a list if id is 0
+func (t *thriftWriter) Begin(id int16) {
+	if id != 0 {
+		t.field(id, thriftStruct)
+	}
+	t.last = append(t.last, 0)
+}
+
+// End closes the struct opened last
+func (t *thriftWriter) End() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// List writes the header of a list field of n elements of a type
+func (t *thriftWriter) List(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.varint(uint64(n))
+}
+
+// ListI32 writes an element of a list of i32
+func (t *thriftWriter) ListI32(v int32) {
+	t.varint(zigzag(int64(v)))
+}
+
+// ListString writes an element of a list of binary
+func (t *thriftWriter) ListString(s string) {
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// Bytes ends the outermost struct and returns the encoding
+func (t *thriftWriter) Bytes() []byte {
+	t.buf.WriteByte(0)
+	return t.buf.Bytes()
+}
@@ -0,0 +1,198 @@
+// Package pdf writes simple PDF documents: pages of text in the standard
+// Helvetica fonts, filled rectangles and JPEG images, which is what the
+// reports of 'face report' are drawn with.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+// Document is a PDF document being drawn
+type Document struct {
+	pages  []*Page
+	images []*Image
+}
+
+// Page is a page of a document. Coordinates are in points from the top
+// left corner of the page.
+type Page struct {
+	content bytes.Buffer
+	images  []*Image
+}
+
+// Image is a JPEG image added to a document
+type Image struct {
+	data          []byte
+	width, height int
+	colorSpace    string
+	// object is the object number of the image, set while writing
+	object int
+}
+
+// New returns an empty document
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage adds an A4 page to the end of the document and returns it
+func (d *Document) AddPage() *Page {
+	page := &Page{}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// AddJPEG adds a JPEG image to the document, to be drawn on its pages
+func (d *Document) AddJPEG(data []byte) (*Image, error) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JPEG: %w", err)
+	}
+	img := &Image{data: data, width: cfg.Width, height: cfg.Height}
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		img.colorSpace = "/DeviceGray"
+	case color.CMYKModel:
+		img.colorSpace = "/DeviceCMYK"
+	default:
+		img.colorSpace = "/DeviceRGB"
+	}
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// Text draws a line of text with its baseline at y, in Helvetica or
+// Helvetica-Bold. Characters outside Latin-1 are drawn as '?'.
+func (p *Page) Text(x, y, size float64, bold bool, c color.Color, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT %s /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n",
+		fill(c), font, size, x, PageHeight-y, escape(s))
+}
+
+// Rect fills a rectangle whose top left corner is at x, y
+func (p *Page) Rect(x, y, w, h float64, c color.Color) {
+	fmt.Fprintf(&p.content, "%s %.2f %.2f %.2f %.2f re f\n", fill(c), x, PageHeight-y-h, w, h)
+}
+
+// Image draws an image of the document into a box whose top left corner is
+// at x, y
+func (p *Page) Image(img *Image, x, y, w, h float64) {
+	i := len(p.images)
+	for j, drawn := range p.images {
+		if drawn == img {
+			i = j
+		}
+	}
+	if i == len(p.images) {
+		p.images = append(p.images, img)
+	}
+	fmt.Fprintf(&p.content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, x, PageHeight-y-h, i)
+}
+
+// TextWidth returns the approximate width of text in Helvetica at a size,
+// for laying out text without font metrics
+func TextWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.52
+}
+
+// fill returns the operator setting the fill color
+func fill(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("%.3f %.3f %.3f rg", float64(r)/0xffff, float64(g)/0xffff, float64(b)/0xffff)
+}
+
+// escape encodes text as the bytes of a PDF string in WinAnsiEncoding
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 0x20 && r < 0x7f:
+			b.WriteByte(byte(r))
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// WriteTo writes the document to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	out := &writer{}
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1 to 4 are the catalog, the page tree and the fonts, then
+	// come the images and each page with its content
+	pagesStart := 5 + len(d.images)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pagesStart+2*i)
+	}
+	out.object("<< /Type /Catalog /Pages 2 0 R >>")
+	out.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	out.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	out.object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for _, img := range d.images {
+		img.object = out.stream(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			img.width, img.height, img.colorSpace), img.data)
+	}
+	for i, page := range d.pages {
+		var xobjects strings.Builder
+		for j, img := range page.images {
+			fmt.Fprintf(&xobjects, " /Im%d %d 0 R", j, img.object)
+		}
+		out.object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject <<%s >> >> >>",
+			PageWidth, PageHeight, pagesStart+2*i+1, xobjects.String()))
+		out.stream("<<", page.content.Bytes())
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(out.offsets)+1)
+	for _, offset := range out.offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(out.offsets)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// writer buffers a document, remembering the offset of each object
+type writer struct {
+	bytes.Buffer
+	offsets []int
+}
+
+// object writes the next object and returns its number
+func (w *writer) object(dict string) int {
+	w.offsets = append(w.offsets, w.Len())
+	fmt.Fprintf(w, "%d 0 obj\n%s\nendobj\n", len(w.offsets), dict)
+	return len(w.offsets)
+}
+
+// stream writes the next object as a stream of data, its dictionary
+// started by dict, and returns its number
+func (w *writer) stream(dict string, data []byte) int {
+	w.offsets = append(w.offsets, w.Len())
+	fmt.Fprintf(w, "%d 0 obj\n%s /Length %d >>\nstream\n", len(w.offsets), dict, len(data))
+	w.Write(data)
+	w.WriteString("\nendstream\nendobj\n")
+	return len(w.offsets)
+}
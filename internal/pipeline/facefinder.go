@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// faceFinderFile is the Pigo cascade in the models directory
+const faceFinderFile = "facefinder"
+
+// Pigo cascade settings for finding every face of an image
+const (
+	minFaceSize = 20
+	// minFaceScore is the cluster score from which a detection counts as
+	// a face; lower scores are mostly textures that look like faces
+	minFaceScore = 5.0
+	// faceOverlap is the intersection over union above which detections
+	// are merged into one face
+	faceOverlap = 0.2
+)
+
+// loadFaceFinder unpacks the Pigo cascade from the models directory
+func loadFaceFinder(modelsDir string) (*pigo.Pigo, error) {
+	data, err := os.ReadFile(filepath.Join(modelsDir, faceFinderFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read face cascade: %w", err)
+	}
+	finder, err := pigo.NewPigo().Unpack(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack face cascade: %w", err)
+	}
+	return finder, nil
+}
+
+// findFaces returns the boxes of every face in the image, largest first.
+// Like Pigo, it expects the image to start at the origin, as decoded images
+// do.
+func findFaces(finder *pigo.Pigo, img image.Image) []image.Rectangle {
+	bounds := img.Bounds()
+	cols, rows := bounds.Dx(), bounds.Dy()
+	params := pigo.CascadeParams{
+		MinSize:     minFaceSize,
+		MaxSize:     max(cols, rows),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: pigo.RgbToGrayscale(img),
+			Rows:   rows,
+			Cols:   cols,
+			Dim:    cols,
+		},
+	}
+
+	detections := finder.ClusterDetections(finder.RunCascade(params, 0), faceOverlap)
+
+	var boxes []image.Rectangle
+	for _, d := range detections {
+		if d.Q < minFaceScore {
+			continue
+		}
+		half := d.Scale / 2
+		box := image.Rect(d.Col-half, d.Row-half, d.Col+half, d.Row+half)
+		if box = box.Intersect(bounds); !box.Empty() {
+			boxes = append(boxes, box)
+		}
+	}
+
+	sort.Slice(boxes, func(i, j int) bool {
+		return boxes[i].Dx()*boxes[i].Dy() > boxes[j].Dx()*boxes[j].Dy()
+	})
+	return boxes
+}
@@ -0,0 +1,130 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+
+	"face/internal/pipeline/modelspec"
+)
+
+// ErrNoFace is returned by the mock detector for images of a single colour
+var ErrNoFace = errors.New("no face detected")
+
+// NewMock returns a detector and extractor that load no models. The detector
+// treats the whole image as the face, unless it is a single solid colour, and
+// the extractor derives a unit-length embedding from a hash of the pixels.
+// The same image always gives the same embedding and different images give
+// nearly orthogonal ones, so enrollment and identification flows can be
+// tested quickly and reproducibly.
+func NewMock() (Detector, Extractor) {
+	return mockDetector{}, mockExtractor{}
+}
+
+type mockDetector struct{}
+
+func (mockDetector) DetectLargestFace(img image.Image) (*Detection, error) {
+	if isBlank(img) {
+		return nil, ErrNoFace
+	}
+	return &Detection{Crop: img, Quality: 1, Box: img.Bounds()}, nil
+}
+
+// DetectFaces finds the same single face as DetectLargestFace, since the
+// mock cannot tell faces apart
+func (d mockDetector) DetectFaces(img image.Image) ([]*Detection, error) {
+	if isBlank(img) {
+		return nil, nil
+	}
+	detection, err := d.DetectLargestFace(img)
+	if err != nil {
+		return nil, err
+	}
+	return []*Detection{detection}, nil
+}
+
+func (mockDetector) Close() {}
+
+type mockExtractor struct{}
+
+func (mockExtractor) Extract(img image.Image) ([]float32, error) {
+	if img.Bounds().Empty() {
+		return nil, errors.New("empty image")
+	}
+
+	digest := pixelHash(img)
+
+	// Stretch the digest to modelspec.MockDimension values by hashing it with a counter
+	embedding := make([]float32, 0, modelspec.MockDimension)
+	var block [sha256.Size + 4]byte
+	copy(block[:], digest[:])
+	for counter := uint32(0); len(embedding) < modelspec.MockDimension; counter++ {
+		binary.BigEndian.PutUint32(block[sha256.Size:], counter)
+		sum := sha256.Sum256(block[:])
+		for i := 0; i+4 <= len(sum) && len(embedding) < modelspec.MockDimension; i += 4 {
+			v := binary.BigEndian.Uint32(sum[i : i+4])
+			embedding = append(embedding, float32(v)/math.MaxUint32*2-1)
+		}
+	}
+
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+	for i := range embedding {
+		embedding[i] = float32(float64(embedding[i]) / norm)
+	}
+
+	return embedding, nil
+}
+
+func (mockExtractor) Close() {}
+
+// pixelHash hashes the size and pixel values of an image, so the result does
+// not depend on how the image was encoded
+func pixelHash(img image.Image) [sha256.Size]byte {
+	h := sha256.New()
+	b := img.Bounds()
+
+	var buf [8]byte
+	binary.BigEndian.PutUint32(buf[:4], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(buf[4:], uint32(b.Dy()))
+	h.Write(buf[:])
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			binary.BigEndian.PutUint16(buf[0:], uint16(r))
+			binary.BigEndian.PutUint16(buf[2:], uint16(g))
+			binary.BigEndian.PutUint16(buf[4:], uint16(bl))
+			binary.BigEndian.PutUint16(buf[6:], uint16(a))
+			h.Write(buf[:])
+		}
+	}
+
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	return digest
+}
+
+// isBlank reports whether every pixel of an image has the same colour
+func isBlank(img image.Image) bool {
+	b := img.Bounds()
+	if b.Empty() {
+		return true
+	}
+
+	r0, g0, b0, a0 := img.At(b.Min.X, b.Min.Y).RGBA()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if r != r0 || g != g0 || bl != b0 || a != a0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+// Package modelspec names the pipeline backends and embedding models. It
+// has no model code, so the config can parse and check them without
+// loading a detector.
+package modelspec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend selects the detection and embedding implementation
+type Backend string
+
+const (
+	// BackendPigo uses the Pigo detector and the embedding model
+	BackendPigo Backend = "pigo"
+	// BackendMock needs no models and derives embeddings from image hashes
+	BackendMock Backend = "mock"
+)
+
+// Embedding models of the backends. Embeddings of different models cannot
+// be compared, so the model is recorded with the gallery; a change to how a
+// backend computes embeddings gets a new version.
+const (
+	ModelHOGLBPRegion = "hog-lbp-region/1"
+	ModelMockSHA256   = "mock-sha256/1"
+)
+
+// EmbeddingModel returns the model computing the embeddings of the backend
+func (b Backend) EmbeddingModel() string {
+	if b == BackendMock {
+		return ModelMockSHA256
+	}
+	return ModelHOGLBPRegion
+}
+
+// ParseBackend parses a pipeline backend name; empty means BackendPigo
+func ParseBackend(s string) (Backend, error) {
+	switch strings.ToLower(s) {
+	case "", string(BackendPigo):
+		return BackendPigo, nil
+	case string(BackendMock):
+		return BackendMock, nil
+	default:
+		return "", fmt.Errorf("unknown pipeline backend %q (use pigo or mock)", s)
+	}
+}
+
+// MockDimension is the size of the embeddings of the mock backend
+const MockDimension = 128
@@ -0,0 +1,131 @@
+package modelspec
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ONNXModel is a face recognition model in the ONNX format that replaces the
+// built-in embedding model, e.g. ArcFace, FaceNet or MobileFaceNet. It takes
+// a square RGB face crop of InputSize pixels, with (value - Mean) / Std
+// channel values, and returns an embedding of Dimension values.
+type ONNXModel struct {
+	// Name identifies the model in the gallery's settings, see
+	// EmbeddingModel
+	Name string `json:"-"`
+	// Path is the .onnx file, <models_dir>/<name>.onnx if empty
+	Path      string `json:"path,omitempty"`
+	InputSize int    `json:"input_size,omitempty"`
+	Dimension int    `json:"dimension,omitempty"`
+	// Mean and Std normalize the channel values, DefaultONNXMean and
+	// DefaultONNXStd if zero
+	Mean float32 `json:"mean,omitempty"`
+	Std  float32 `json:"std,omitempty"`
+	// BGR feeds the channels in BGR order, as models trained with OpenCV
+	// expect
+	BGR bool `json:"bgr,omitempty"`
+	// NHWC feeds the crop channels last, as models converted from
+	// TensorFlow expect; the default is channels first (NCHW)
+	NHWC bool `json:"nhwc,omitempty"`
+	// InputName and OutputName select the tensors of models with several,
+	// the first ones if empty
+	InputName  string `json:"input_name,omitempty"`
+	OutputName string `json:"output_name,omitempty"`
+	// URL and SHA256 are where 'face model download' fetches the file from
+	// and the checksum it must have
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Channel normalization of ONNX models that do not set their own
+const (
+	DefaultONNXMean = 127.5
+	DefaultONNXStd  = 128
+)
+
+// EmbeddingDimension is the size of the embeddings of the built-in models
+const EmbeddingDimension = 128
+
+// ONNXPresets are the input sizes, dimensions and normalization of common
+// models, by name. A model of the config file with one of these names only
+// needs the fields that differ, e.g. a path.
+var ONNXPresets = map[string]ONNXModel{
+	// InsightFace ArcFace, e.g. w600k_r50.onnx
+	"arcface": {InputSize: 112, Dimension: 512, Mean: 127.5, Std: 127.5},
+	// FaceNet (Inception-ResNet v1) exported from facenet-pytorch
+	"facenet": {InputSize: 160, Dimension: 512, Mean: 127.5, Std: 128},
+	// MobileFaceNet with a 128-d embedding layer
+	"mobilefacenet": {InputSize: 112, Dimension: 128, Mean: 127.5, Std: 128},
+}
+
+// maxONNXNameLength keeps EmbeddingModel within the column of
+// models.Settings.EmbeddingModel
+const maxONNXNameLength = 48
+
+// ResolveONNX returns the ONNX model of a name: the model of that name in
+// models, with the fields it leaves unset taken from the preset of the same
+// name, or the preset alone
+func ResolveONNX(name string, models map[string]ONNXModel, modelsDir string) (ONNXModel, error) {
+	model, configured := models[name]
+	preset, isPreset := ONNXPresets[name]
+	if !configured && !isPreset {
+		return ONNXModel{}, fmt.Errorf("unknown embedding model %q (presets: %s; or add it to embedding_models)", name, strings.Join(ONNXPresetNames(), ", "))
+	}
+
+	model.Name = name
+	if model.Path == "" {
+		model.Path = filepath.Join(modelsDir, name+".onnx")
+	}
+	model.InputSize = cmp.Or(model.InputSize, preset.InputSize)
+	model.Dimension = cmp.Or(model.Dimension, preset.Dimension)
+	model.Mean = cmp.Or(model.Mean, preset.Mean, DefaultONNXMean)
+	model.Std = cmp.Or(model.Std, preset.Std, DefaultONNXStd)
+	return model, model.Validate()
+}
+
+// ONNXPresetNames returns the names of the presets, sorted
+func ONNXPresetNames() []string {
+	names := make([]string, 0, len(ONNXPresets))
+	for name := range ONNXPresets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Validate checks that the model can be run
+func (m ONNXModel) Validate() error {
+	switch {
+	case m.Name == "" || len(m.Name) > maxONNXNameLength || strings.ContainsAny(m.Name, "/: "):
+		return fmt.Errorf("invalid embedding model name %q (use up to %d characters, no '/', ':' or spaces)", m.Name, maxONNXNameLength)
+	case m.InputSize <= 0:
+		return fmt.Errorf("embedding model %s: input_size must be set and positive", m.Name)
+	case m.Dimension <= 0:
+		return fmt.Errorf("embedding model %s: dimension must be set and positive", m.Name)
+	case m.Std <= 0:
+		return fmt.Errorf("embedding model %s: std must be positive", m.Name)
+	}
+	return nil
+}
+
+// EmbeddingModel returns the name recorded with the gallery for the
+// embeddings of the model. Replacing the file of a model with a different
+// network needs a new name, as its embeddings cannot be compared.
+func (m ONNXModel) EmbeddingModel() string {
+	return fmt.Sprintf("onnx:%s/%d", m.Name, m.Dimension)
+}
+
+// ONNXModelName returns the name of the ONNX model of an embedding model
+// recorded with a gallery, see EmbeddingModel, and false if the recorded
+// model is not an ONNX model
+func ONNXModelName(embeddingModel string) (string, bool) {
+	rest, ok := strings.CutPrefix(embeddingModel, "onnx:")
+	if !ok {
+		return "", false
+	}
+	name, _, ok := strings.Cut(rest, "/")
+	return name, ok && name != ""
+}
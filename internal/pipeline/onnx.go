@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+
+	"face/internal/imaging"
+	"face/internal/pipeline/modelspec"
+)
+
+// ErrONNXUnsupported is returned by NewONNX in builds without ONNX Runtime
+var ErrONNXUnsupported = errors.New("this build has no ONNX Runtime support: rebuild with -tags onnx")
+
+// inputShape returns the shape of the input tensor of one face of a model
+func inputShape(m modelspec.ONNXModel) []int64 {
+	size := int64(m.InputSize)
+	if m.NHWC {
+		return []int64{1, size, size, 3}
+	}
+	return []int64{1, 3, size, size}
+}
+
+// input converts a face crop to the input tensor values of a model
+func input(m modelspec.ONNXModel, img image.Image) []float32 {
+	size := m.InputSize
+	crop := imaging.NormalizeCrop(img, size).(*image.RGBA)
+
+	plane := size * size
+	data := make([]float32, 3*plane)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			p := crop.PixOffset(x, y)
+			rgb := [3]uint8{crop.Pix[p], crop.Pix[p+1], crop.Pix[p+2]}
+			if m.BGR {
+				rgb[0], rgb[2] = rgb[2], rgb[0]
+			}
+			for c, v := range rgb {
+				value := (float32(v) - m.Mean) / m.Std
+				if m.NHWC {
+					data[(y*size+x)*3+c] = value
+				} else {
+					data[c*plane+y*size+x] = value
+				}
+			}
+		}
+	}
+	return data
+}
+
+// output checks the output of a model and scales it to unit length, so
+// that cosine similarities of the embeddings are comparable to those of the
+// built-in models
+func output(m modelspec.ONNXModel, values []float32) ([]float32, error) {
+	if len(values) != m.Dimension {
+		return nil, fmt.Errorf("embedding model %s returned %d values, configured dimension is %d", m.Name, len(values), m.Dimension)
+	}
+
+	var norm float64
+	for _, v := range values {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) {
+		return nil, fmt.Errorf("embedding model %s returned an invalid embedding", m.Name)
+	}
+	norm = math.Sqrt(norm)
+
+	embedding := make([]float32, len(values))
+	for i, v := range values {
+		embedding[i] = float32(float64(v) / norm)
+	}
+	return embedding, nil
+}
@@ -0,0 +1,101 @@
+//go:build onnx
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+
+	"face/internal/pipeline/modelspec"
+)
+
+var (
+	ortOnce sync.Once
+	ortErr  error
+)
+
+// initONNXRuntime loads the ONNX Runtime shared library once per process;
+// an empty library is looked up by the dynamic loader
+func initONNXRuntime(library string) error {
+	ortOnce.Do(func() {
+		if library != "" {
+			ort.SetSharedLibraryPath(library)
+		}
+		ortErr = ort.InitializeEnvironment()
+	})
+	if ortErr != nil {
+		return fmt.Errorf("failed to load ONNX Runtime (set onnx_runtime to the path of libonnxruntime): %w", ortErr)
+	}
+	return nil
+}
+
+// NewONNX loads an ONNX face recognition model as the extractor, using the
+// ONNX Runtime shared library at library
+func NewONNX(model modelspec.ONNXModel, library string) (Extractor, error) {
+	if err := model.Validate(); err != nil {
+		return nil, err
+	}
+	if err := initONNXRuntime(library); err != nil {
+		return nil, err
+	}
+
+	input, output := model.InputName, model.OutputName
+	if input == "" || output == "" {
+		inputs, outputs, err := ort.GetInputOutputInfo(model.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedding model %s: %w", model.Path, err)
+		}
+		if len(inputs) == 0 || len(outputs) == 0 {
+			return nil, fmt.Errorf("embedding model %s has no inputs or outputs", model.Path)
+		}
+		if input == "" {
+			input = inputs[0].Name
+		}
+		if output == "" {
+			output = outputs[0].Name
+		}
+	}
+
+	session, err := ort.NewDynamicAdvancedSession(model.Path, []string{input}, []string{output}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedding model %s: %w", model.Path, err)
+	}
+	return &onnxExtractor{model: model, session: session}, nil
+}
+
+type onnxExtractor struct {
+	model   modelspec.ONNXModel
+	session *ort.DynamicAdvancedSession
+}
+
+func (e *onnxExtractor) Extract(img image.Image) ([]float32, error) {
+	if img.Bounds().Empty() {
+		return nil, errors.New("empty image")
+	}
+
+	input, err := ort.NewTensor(ort.NewShape(inputShape(e.model)...), input(e.model, img))
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+
+	outputs := []ort.Value{nil}
+	if err := e.session.Run([]ort.Value{input}, outputs); err != nil {
+		return nil, fmt.Errorf("embedding model %s failed: %w", e.model.Name, err)
+	}
+	defer outputs[0].Destroy()
+
+	tensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("embedding model %s returned %v values, not float32", e.model.Name, outputs[0].DataType())
+	}
+	return output(e.model, tensor.GetData())
+}
+
+func (e *onnxExtractor) Close() {
+	e.session.Destroy()
+}
@@ -0,0 +1,14 @@
+//go:build !onnx
+
+package pipeline
+
+import "face/internal/pipeline/modelspec"
+
+// NewONNX fails in builds without the onnx tag, which keep the binary free
+// of cgo and the ONNX Runtime library
+func NewONNX(model modelspec.ONNXModel, library string) (Extractor, error) {
+	if err := model.Validate(); err != nil {
+		return nil, err
+	}
+	return nil, ErrONNXUnsupported
+}
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"image"
+	"sync"
+
+	"face/internal/face"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// NewPigo wraps the model-based detector and extractor. The Pigo cascade in
+// modelsDir is loaded too when all faces of an image are needed.
+func NewPigo(detector *face.Detector, extractor face.Extractor, modelsDir string) (Detector, Extractor) {
+	return NewPigoDetector(detector, modelsDir), &pigoExtractor{extractor}
+}
+
+// NewPigoDetector wraps the model-based detector alone, for use with another
+// extractor such as NewONNX
+func NewPigoDetector(detector *face.Detector, modelsDir string) Detector {
+	return &pigoDetector{detector: detector, modelsDir: modelsDir}
+}
+
+type pigoDetector struct {
+	detector  *face.Detector
+	modelsDir string
+
+	finderOnce sync.Once
+	finder     *pigo.Pigo
+	finderErr  error
+}
+
+func (d *pigoDetector) DetectLargestFace(img image.Image) (*Detection, error) {
+	rect, err := d.detector.DetectLargestFace(img)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Detection{
+		Crop:    d.detector.CropFace(img, rect),
+		Quality: d.detector.CalculateQuality(img, rect),
+		Box:     rect,
+	}, nil
+}
+
+func (d *pigoDetector) DetectFaces(img image.Image) ([]*Detection, error) {
+	d.finderOnce.Do(func() {
+		d.finder, d.finderErr = loadFaceFinder(d.modelsDir)
+	})
+	if d.finderErr != nil {
+		return nil, d.finderErr
+	}
+
+	boxes := findFaces(d.finder, img)
+	detections := make([]*Detection, len(boxes))
+	for i, rect := range boxes {
+		detections[i] = &Detection{
+			Crop:    d.detector.CropFace(img, rect),
+			Quality: d.detector.CalculateQuality(img, rect),
+			Box:     rect,
+		}
+	}
+	return detections, nil
+}
+
+func (d *pigoDetector) Close() {
+	d.detector.Close()
+}
+
+type pigoExtractor struct {
+	extractor face.Extractor
+}
+
+func (e *pigoExtractor) Extract(img image.Image) ([]float32, error) {
+	return e.extractor.Extract(img)
+}
+
+func (e *pigoExtractor) Close() {
+	e.extractor.Close()
+}
@@ -0,0 +1,28 @@
+// Package pipeline abstracts the face detection and embedding backends so
+// the real models can be swapped for a deterministic mock in tests.
+package pipeline
+
+import "image"
+
+// Detection is a face found in an image
+type Detection struct {
+	Crop    image.Image
+	Quality float64
+	// Box is where the face is in the image
+	Box image.Rectangle
+}
+
+// Detector finds faces in images
+type Detector interface {
+	DetectLargestFace(img image.Image) (*Detection, error)
+	// DetectFaces returns every face in the image, largest first, and
+	// none if there are no faces
+	DetectFaces(img image.Image) ([]*Detection, error)
+	Close()
+}
+
+// Extractor computes face embeddings from face crops
+type Extractor interface {
+	Extract(img image.Image) ([]float32, error)
+	Close()
+}
@@ -0,0 +1,69 @@
+// Package privacy adds differential-privacy noise to aggregate counts, so
+// reports can be shared without revealing whether any one person is in
+// them.
+package privacy
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+// DefaultSensitivity is how much one person changes a count unless
+// configured otherwise
+const DefaultSensitivity = 1
+
+// Noise adds noise to counts
+type Noise struct {
+	// Epsilon is the privacy budget of one report: lower is more private
+	// and noisier
+	Epsilon float64
+	// Sensitivity is the most one person can change any count, e.g. the
+	// number of times they can be counted, DefaultSensitivity if 0
+	Sensitivity int64
+	// Rand is the source of the noise, the global source of math/rand/v2
+	// if nil. A seeded source makes the noise reproducible, and anyone
+	// knowing the seed can remove it.
+	Rand *rand.Rand
+}
+
+// Validate checks the noise parameters
+func (n Noise) Validate() error {
+	if n.Epsilon <= 0 || math.IsInf(n.Epsilon, 0) || math.IsNaN(n.Epsilon) {
+		return errors.New("epsilon must be a positive number")
+	}
+	if n.Sensitivity < 0 {
+		return errors.New("sensitivity cannot be negative")
+	}
+	return nil
+}
+
+// Count returns count plus two-sided geometric noise, the discrete form of
+// the Laplace mechanism, clamped at 0. Each call spends Epsilon of the
+// privacy budget.
+func (n Noise) Count(count int64) int64 {
+	sensitivity := n.Sensitivity
+	if sensitivity == 0 {
+		sensitivity = DefaultSensitivity
+	}
+
+	// The difference of two geometric variables with success probability
+	// 1-alpha is distributed as P(k) ~ alpha^|k|
+	alpha := math.Exp(-n.Epsilon / float64(sensitivity))
+	noisy := count + n.geometric(alpha) - n.geometric(alpha)
+	return max(noisy, 0)
+}
+
+// geometric returns the number of failures before the first success of
+// trials failing with probability alpha
+func (n Noise) geometric(alpha float64) int64 {
+	if alpha <= 0 {
+		return 0
+	}
+	uniform := rand.Float64
+	if n.Rand != nil {
+		uniform = n.Rand.Float64
+	}
+	u := 1 - uniform() // (0, 1], so the logarithm is finite
+	return int64(math.Floor(math.Log(u) / math.Log(alpha)))
+}
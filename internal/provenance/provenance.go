@@ -0,0 +1,210 @@
+// Package provenance records where stored face crops come from: when and by
+// whom they were enrolled, from which source image and with which software.
+// The record is embedded as XMP metadata in the JPEG and covered by a digest,
+// HMAC-signed when a key is configured, so images changed or swapped after
+// they were stored can be detected. An optional invisible watermark survives
+// the metadata being stripped.
+package provenance
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"image/jpeg"
+	"strings"
+	"time"
+)
+
+// Mode selects what is added to stored face images
+type Mode string
+
+const (
+	// ModeMetadata embeds the provenance record as XMP metadata
+	ModeMetadata Mode = "metadata"
+	// ModeWatermark also adds an invisible watermark to the pixels
+	ModeWatermark Mode = "watermark"
+	// ModeNone stores images without provenance
+	ModeNone Mode = "none"
+)
+
+// ParseMode converts a string to Mode
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", ModeMetadata:
+		return ModeMetadata, nil
+	case ModeWatermark, ModeNone:
+		return Mode(s), nil
+	default:
+		return "", fmt.Errorf("unsupported provenance mode: %s", s)
+	}
+}
+
+var (
+	// ErrMissing is returned for images without provenance metadata, e.g.
+	// stored before provenance was enabled
+	ErrMissing = errors.New("no provenance metadata")
+	// ErrStripped is returned for images whose watermark is intact but
+	// whose provenance metadata was removed
+	ErrStripped = errors.New("provenance metadata was removed, the watermark is intact")
+	// ErrTampered is returned when the image or its provenance changed
+	// after it was stored
+	ErrTampered = errors.New("image or provenance changed after the image was stored")
+	// ErrUnsigned is returned for unsigned provenance when a key is
+	// configured, since anyone can write an unsigned record
+	ErrUnsigned = errors.New("provenance is not signed")
+	// ErrNoKey is returned for signed provenance when no key is configured
+	// to check the signature
+	ErrNoKey = errors.New("provenance is signed but no key is configured")
+	// ErrNoWatermark is returned when the record says the image was
+	// watermarked but the watermark is not found
+	ErrNoWatermark = errors.New("watermark not found")
+)
+
+// Record describes where a stored face image comes from
+type Record struct {
+	FaceID     string
+	UserID     string
+	EnrolledAt time.Time
+	// SourceSHA256 is the hash of the image file the face was cropped from,
+	// empty if it did not come from a file
+	SourceSHA256 string
+	// Operator is the login of the user who ran the enrollment
+	Operator string
+	// Software is the name and version of the program that stored the image
+	Software  string
+	Watermark bool
+	// Digest covers the image data and the other fields; it is an
+	// HMAC-SHA256 when Signed, a plain SHA-256 otherwise
+	Digest string
+	Signed bool
+}
+
+// Source is a face crop together with the hash of the image file it was
+// cropped from, for the Stamper to record
+type Source struct {
+	image.Image
+	SHA256 string
+}
+
+// Stamper encodes face images for storage with their provenance
+type Stamper struct {
+	Mode Mode
+	// Key signs the digests when set
+	Key      []byte
+	Software string
+	Operator string
+	// Quality is the JPEG quality images are encoded with
+	Quality int
+}
+
+// Encode encodes a face image as JPEG with its provenance. The image may be
+// a Source to record the hash of the source image.
+func (s *Stamper) Encode(userID, faceID string, img image.Image) ([]byte, error) {
+	var sourceHash string
+	if src, ok := img.(*Source); ok {
+		img, sourceHash = src.Image, src.SHA256
+	}
+	if s.Mode == ModeWatermark {
+		img = Watermark(img, s.watermarkSeed(faceID))
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.Quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	if s.Mode == ModeNone {
+		return buf.Bytes(), nil
+	}
+
+	record := &Record{
+		FaceID:       faceID,
+		UserID:       userID,
+		EnrolledAt:   time.Now().UTC().Truncate(time.Second),
+		SourceSHA256: sourceHash,
+		Operator:     s.Operator,
+		Software:     s.Software,
+		Watermark:    s.Mode == ModeWatermark,
+		Signed:       len(s.Key) > 0,
+	}
+	record.Digest = s.digest(buf.Bytes(), record)
+
+	return embedXMP(buf.Bytes(), record)
+}
+
+// Verify checks a stored image of the face and returns its provenance. The
+// record is returned along with ErrTampered, ErrUnsigned, ErrNoKey and
+// ErrNoWatermark, so callers can show what the image claims to be.
+func (s *Stamper) Verify(data []byte, faceID string) (*Record, error) {
+	record, image, err := extractXMP(data)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		if s.hasWatermark(data, faceID) {
+			return nil, ErrStripped
+		}
+		return nil, ErrMissing
+	}
+
+	switch {
+	case record.Signed && len(s.Key) == 0:
+		return record, ErrNoKey
+	case !record.Signed && len(s.Key) > 0:
+		return record, ErrUnsigned
+	}
+	if !hmac.Equal([]byte(s.digest(image, record)), []byte(record.Digest)) {
+		return record, ErrTampered
+	}
+	if record.FaceID != faceID {
+		return record, fmt.Errorf("%w: it was stored for face %s", ErrTampered, record.FaceID)
+	}
+	if record.Watermark && !s.hasWatermark(data, faceID) {
+		return record, ErrNoWatermark
+	}
+	return record, nil
+}
+
+// digest returns the hex digest of the image data and the record's fields
+func (s *Stamper) digest(image []byte, record *Record) string {
+	var h hash.Hash
+	if record.Signed {
+		h = hmac.New(sha256.New, s.Key)
+	} else {
+		h = sha256.New()
+	}
+
+	h.Write(image)
+	fields := []string{
+		record.FaceID, record.UserID, record.EnrolledAt.UTC().Format(time.RFC3339),
+		record.SourceSHA256, record.Operator, record.Software, fmt.Sprint(record.Watermark),
+	}
+	h.Write([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// watermarkSeed derives the watermark pattern of a face, from the key when
+// set so the watermark cannot be forged without it
+func (s *Stamper) watermarkSeed(faceID string) [32]byte {
+	if len(s.Key) == 0 {
+		return sha256.Sum256([]byte("face watermark\n" + faceID))
+	}
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte("face watermark\n" + faceID))
+	var seed [32]byte
+	copy(seed[:], mac.Sum(nil))
+	return seed
+}
+
+// hasWatermark reports whether the image carries the watermark of the face
+func (s *Stamper) hasWatermark(data []byte, faceID string) bool {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	return WatermarkScore(img, s.watermarkSeed(faceID)) >= WatermarkThreshold
+}
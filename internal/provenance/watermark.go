@@ -0,0 +1,97 @@
+package provenance
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+)
+
+// watermarkStrength is how much the watermark brightens or darkens each
+// pixel, out of 255; too little to see, enough to survive JPEG encoding
+const watermarkStrength = 3
+
+// WatermarkThreshold is the score from which an image counts as carrying a
+// watermark. Scores of images without it follow a standard normal
+// distribution, so false positives are practically impossible.
+const WatermarkThreshold = 6.0
+
+// Watermark returns a copy of the image with the pseudo-random pattern
+// derived from the seed added to its brightness
+func Watermark(img image.Image, seed [32]byte) *image.RGBA {
+	bounds := img.Bounds()
+	marked := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	pattern := watermarkPattern(seed, bounds.Dx(), bounds.Dy())
+
+	for y := range bounds.Dy() {
+		for x := range bounds.Dx() {
+			c := color.RGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			delta := int(pattern[y*bounds.Dx()+x]) * watermarkStrength
+			marked.SetRGBA(x, y, color.RGBA{
+				R: clamp(int(c.R) + delta),
+				G: clamp(int(c.G) + delta),
+				B: clamp(int(c.B) + delta),
+				A: c.A,
+			})
+		}
+	}
+	return marked
+}
+
+// WatermarkScore correlates the fine detail of the image's brightness with
+// the pattern derived from the seed. It is about 0 for images without the
+// watermark and well above WatermarkThreshold for images with it.
+func WatermarkScore(img image.Image, seed [32]byte) float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 3 || h < 3 {
+		return 0
+	}
+
+	luma := make([]float64, w*h)
+	for y := range h {
+		for x := range w {
+			luma[y*w+x] = float64(color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y)
+		}
+	}
+
+	pattern := watermarkPattern(seed, w, h)
+	var correlation, energy float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			// Subtracting the neighbourhood mean removes the image content
+			// and keeps the fine detail the pattern is part of
+			var mean float64
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					mean += luma[(y+dy)*w+x+dx]
+				}
+			}
+			detail := luma[y*w+x] - mean/9
+			correlation += detail * float64(pattern[y*w+x])
+			energy += detail * detail
+		}
+	}
+	if energy == 0 {
+		return 0
+	}
+	return correlation / math.Sqrt(energy)
+}
+
+// watermarkPattern returns +1 or -1 for each pixel of a w x h image
+func watermarkPattern(seed [32]byte, w, h int) []int8 {
+	rng := rand.New(rand.NewChaCha8(seed))
+	pattern := make([]int8, w*h)
+	for i := range pattern {
+		if rng.Uint64()&1 == 0 {
+			pattern[i] = -1
+		} else {
+			pattern[i] = 1
+		}
+	}
+	return pattern
+}
+
+func clamp(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
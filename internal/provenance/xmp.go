@@ -0,0 +1,171 @@
+package provenance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JPEG markers
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1
+)
+
+// xmpHeader starts the APP1 segment holding XMP metadata
+const xmpHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+// namespace is the XMP namespace of the provenance fields
+const namespace = "https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/"
+
+// XMP namespaces of the standard fields used
+const (
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsXMP = "http://ns.adobe.com/xap/1.0/"
+)
+
+// xmpDescription is the rdf:Description element of the XMP packet
+type xmpDescription struct {
+	CreateDate   string `xml:"http://ns.adobe.com/xap/1.0/ CreateDate,attr"`
+	CreatorTool  string `xml:"http://ns.adobe.com/xap/1.0/ CreatorTool,attr"`
+	FaceID       string `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ FaceID,attr"`
+	UserID       string `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ UserID,attr"`
+	SourceSHA256 string `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ SourceSHA256,attr"`
+	Operator     string `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ Operator,attr"`
+	Watermark    bool   `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ Watermark,attr"`
+	Digest       string `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ Digest,attr"`
+	DigestMethod string `xml:"https://github.com/salawatbro/face-recognition-go/ns/provenance/1.0/ DigestMethod,attr"`
+}
+
+// xmpPacket is the x:xmpmeta element of the XMP packet
+type xmpPacket struct {
+	Descriptions []xmpDescription `xml:"RDF>Description"`
+}
+
+// Digest methods
+const (
+	digestSHA256 = "SHA-256"
+	digestHMAC   = "HMAC-SHA256"
+)
+
+// embedXMP inserts the record as an XMP segment right after the start of
+// the JPEG data
+func embedXMP(data []byte, record *Record) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errors.New("not a JPEG image")
+	}
+
+	packet := xmpPacketFor(record)
+	length := 2 + len(xmpHeader) + len(packet)
+	if length > 0xFFFF {
+		return nil, errors.New("provenance metadata too large")
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 2 + length)
+	buf.Write(data[:2])
+	buf.Write([]byte{0xFF, markerAPP1})
+	_ = binary.Write(&buf, binary.BigEndian, uint16(length))
+	buf.WriteString(xmpHeader)
+	buf.WriteString(packet)
+	buf.Write(data[2:])
+	return buf.Bytes(), nil
+}
+
+// xmpPacketFor formats the record as an XMP packet
+func xmpPacketFor(record *Record) string {
+	method := digestSHA256
+	if record.Signed {
+		method = digestHMAC
+	}
+
+	attrs := [][2]string{
+		{"xmp:CreateDate", record.EnrolledAt.UTC().Format(time.RFC3339)},
+		{"xmp:CreatorTool", record.Software},
+		{"face:FaceID", record.FaceID},
+		{"face:UserID", record.UserID},
+		{"face:SourceSHA256", record.SourceSHA256},
+		{"face:Operator", record.Operator},
+		{"face:Watermark", fmt.Sprint(record.Watermark)},
+		{"face:Digest", record.Digest},
+		{"face:DigestMethod", method},
+	}
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="` + nsRDF + `">`)
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:xmp="` + nsXMP + `" xmlns:face="` + namespace + `"`)
+	for _, attr := range attrs {
+		b.WriteString(" " + attr[0] + `="`)
+		_ = xml.EscapeText(&b, []byte(attr[1]))
+		b.WriteString(`"`)
+	}
+	b.WriteString(`/></rdf:RDF></x:xmpmeta><?xpacket end="r"?>`)
+	return b.String()
+}
+
+// extractXMP finds the provenance segment of JPEG data. It returns the
+// record, nil if there is none, and the data without the segment.
+func extractXMP(data []byte) (*Record, []byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, nil, errors.New("not a JPEG image")
+	}
+
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == markerSOS {
+			break
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, nil, errors.New("truncated JPEG image")
+		}
+
+		payload := data[pos+4 : end]
+		if marker == markerAPP1 && bytes.HasPrefix(payload, []byte(xmpHeader)) && bytes.Contains(payload, []byte(namespace)) {
+			record, err := parseXMP(payload[len(xmpHeader):])
+			if err != nil {
+				return nil, nil, err
+			}
+			stripped := append(append([]byte{}, data[:pos]...), data[end:]...)
+			return record, stripped, nil
+		}
+		pos = end
+	}
+	return nil, data, nil
+}
+
+// parseXMP reads the record from an XMP packet
+func parseXMP(packet []byte) (*Record, error) {
+	var parsed xmpPacket
+	if err := xml.Unmarshal(packet, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid provenance metadata: %w", err)
+	}
+
+	for _, d := range parsed.Descriptions {
+		if d.FaceID == "" {
+			continue
+		}
+		enrolledAt, err := time.Parse(time.RFC3339, d.CreateDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provenance date: %w", err)
+		}
+		return &Record{
+			FaceID:       d.FaceID,
+			UserID:       d.UserID,
+			EnrolledAt:   enrolledAt,
+			SourceSHA256: d.SourceSHA256,
+			Operator:     d.Operator,
+			Software:     d.CreatorTool,
+			Watermark:    d.Watermark,
+			Digest:       d.Digest,
+			Signed:       d.DigestMethod == digestHMAC,
+		}, nil
+	}
+	return nil, errors.New("invalid provenance metadata: no face ID")
+}
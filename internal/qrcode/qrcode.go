@@ -0,0 +1,65 @@
+// Package qrcode renders QR codes for terminals and as PNG files, so IDs
+// can be handed to badge printers and phones without retyping them.
+package qrcode
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// quietZone is the light border around a terminal code, in modules. The
+// standard asks for 4; 2 is enough for phone cameras and saves space.
+const quietZone = 2
+
+// pngScale is the size of a module in a PNG, in pixels
+const pngScale = 8
+
+// Terminal writes a QR code of text using Unicode half blocks, two
+// modules per character row. Light modules are drawn, so the code reads
+// correctly on the usual dark terminal background.
+func Terminal(w io.Writer, text string) error {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	light := func(x, y int) bool { return !code.Black(x, y) }
+	var b strings.Builder
+	for y := -quietZone; y < code.Size+quietZone; y += 2 {
+		for x := -quietZone; x < code.Size+quietZone; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// WritePNG saves a QR code of text as a black on white PNG image
+func WritePNG(path, text string) error {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.Scale = pngScale
+
+	if err := os.WriteFile(path, code.PNG(), 0o644); err != nil {
+		return fmt.Errorf("failed to write QR code: %w", err)
+	}
+	return nil
+}
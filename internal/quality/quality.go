@@ -0,0 +1,172 @@
+// Package quality measures why a face image is poor and turns the
+// measurements into hints a person in front of a camera can act on, e.g.
+// "face too small — move closer".
+package quality
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// Hint codes. Codes are part of the API and never change meaning; clients
+// should branch on them, e.g. to show their own translated messages.
+const (
+	HintFaceTooSmall = "face_too_small"
+	HintTooDark      = "too_dark"
+	HintTooBright    = "too_bright"
+	HintLowContrast  = "low_contrast"
+	HintBlurry       = "blurry"
+	HintTurnedLeft   = "turned_left"
+	HintTurnedRight  = "turned_right"
+)
+
+// Limits of the sub-scores, outside of which a hint is given
+const (
+	MinFaceWidth  = 80 // pixels
+	MinBrightness = 0.25
+	MaxBrightness = 0.80
+	MinContrast   = 0.06
+	MinSharpness  = 0.0015
+	MaxYaw        = 0.25
+)
+
+// analysisSize is the side of the square the face is scaled to before it
+// is measured, so faces of every size are measured alike
+const analysisSize = 96
+
+// The features of a face are within these coordinates of the scaled face;
+// the outline of the face and the background are outside
+const (
+	featuresMin = analysisSize / 5
+	featuresMax = analysisSize - analysisSize/5
+)
+
+// Hint is a problem with a face image and what to do about it
+type Hint struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var messages = map[string]string{
+	HintFaceTooSmall: "face too small — move closer",
+	HintTooDark:      "image too dark — add light in front of the face",
+	HintTooBright:    "image too bright — avoid direct light on the face",
+	HintLowContrast:  "low contrast — face the light, avoid light behind you",
+	HintBlurry:       "image blurry — hold still",
+	HintTurnedLeft:   "face turned too far left — look straight at the camera",
+	HintTurnedRight:  "face turned too far right — look straight at the camera",
+}
+
+// Scores are the sub-scores of a face image
+type Scores struct {
+	// FaceWidth is the width of the face in pixels
+	FaceWidth int `json:"face_width"`
+	// Brightness is the mean luminance of the face, from 0 (black) to 1
+	// (white)
+	Brightness float64 `json:"brightness"`
+	// Contrast is the standard deviation of the luminance of the face
+	Contrast float64 `json:"contrast"`
+	// Sharpness is the variance of the Laplacian of the face's luminance;
+	// blurred faces have little
+	Sharpness float64 `json:"sharpness"`
+	// Yaw estimates how far the face is turned, from -1 (to the person's
+	// right) to 1 (to their left), by how far its features are off the
+	// centre of the face box. It is a rough estimate: no landmarks are
+	// located.
+	Yaw float64 `json:"yaw"`
+}
+
+// Analyze measures the face in the box of an image
+func Analyze(img image.Image, box image.Rectangle) Scores {
+	box = box.Intersect(img.Bounds())
+	if box.Empty() {
+		return Scores{}
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, analysisSize, analysisSize))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, box, draw.Src, nil)
+	luma := func(x, y int) float64 {
+		return float64(gray.Pix[y*gray.Stride+x]) / 255
+	}
+
+	var sum, sumSq float64
+	for y := 0; y < analysisSize; y++ {
+		for x := 0; x < analysisSize; x++ {
+			v := luma(x, y)
+			sum += v
+			sumSq += v * v
+		}
+	}
+	n := float64(analysisSize * analysisSize)
+	mean := sum / n
+
+	// The Laplacian measures sharpness, and the gradient inside the face,
+	// which is strong at the eyes, nose and mouth, locates the features
+	var lapSum, lapSumSq, gradSum, gradX float64
+	for y := 1; y < analysisSize-1; y++ {
+		for x := 1; x < analysisSize-1; x++ {
+			lap := luma(x-1, y) + luma(x+1, y) + luma(x, y-1) + luma(x, y+1) - 4*luma(x, y)
+			lapSum += lap
+			lapSumSq += lap * lap
+
+			if x < featuresMin || x >= featuresMax || y < featuresMin || y >= featuresMax {
+				continue
+			}
+			grad := math.Abs(luma(x+1, y)-luma(x-1, y)) + math.Abs(luma(x, y+1)-luma(x, y-1))
+			gradSum += grad
+			gradX += grad * (float64(x-featuresMin)/(featuresMax-featuresMin-1)*2 - 1)
+		}
+	}
+	inner := float64((analysisSize - 2) * (analysisSize - 2))
+	lapMean := lapSum / inner
+
+	s := Scores{
+		FaceWidth:  box.Dx(),
+		Brightness: mean,
+		Contrast:   math.Sqrt(math.Max(sumSq/n-mean*mean, 0)),
+		Sharpness:  lapSumSq/inner - lapMean*lapMean,
+	}
+	if gradSum > 0 {
+		// features drawn to the right of the image are a face turned to
+		// the person's left
+		s.Yaw = gradX / gradSum
+	}
+	return s
+}
+
+// Hints returns a hint for every sub-score out of its limits, most
+// important first
+func (s Scores) Hints() []Hint {
+	if s.FaceWidth == 0 {
+		return nil
+	}
+	var codes []string
+	if s.FaceWidth < MinFaceWidth {
+		codes = append(codes, HintFaceTooSmall)
+	}
+	switch {
+	case s.Brightness < MinBrightness:
+		codes = append(codes, HintTooDark)
+	case s.Brightness > MaxBrightness:
+		codes = append(codes, HintTooBright)
+	case s.Contrast < MinContrast:
+		codes = append(codes, HintLowContrast)
+	}
+	if s.Sharpness < MinSharpness && s.Contrast >= MinContrast {
+		codes = append(codes, HintBlurry)
+	}
+	switch {
+	case s.Yaw > MaxYaw:
+		codes = append(codes, HintTurnedLeft)
+	case s.Yaw < -MaxYaw:
+		codes = append(codes, HintTurnedRight)
+	}
+
+	hints := make([]Hint, len(codes))
+	for i, code := range codes {
+		hints[i] = Hint{Code: code, Message: messages[code]}
+	}
+	return hints
+}
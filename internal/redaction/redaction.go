@@ -0,0 +1,96 @@
+// Package redaction limits what consumers of identification results learn
+// about the identified users, so low-trust consumers such as a display
+// screen never receive contact details.
+package redaction
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"face/internal/database/models"
+)
+
+// Level is how much of a user a consumer may see
+type Level string
+
+const (
+	// LevelFull shows every field except second factor secrets
+	LevelFull Level = "full"
+	// LevelNameOnly shows the user ID and name
+	LevelNameOnly Level = "name-only"
+	// LevelIDOnly shows a pseudonymous ID instead of the user ID, which
+	// stays the same for a user but cannot be looked up
+	LevelIDOnly Level = "id-only"
+)
+
+// ParseLevel converts a string to Level
+func ParseLevel(s string) (Level, error) {
+	switch Level(s) {
+	case "", LevelFull:
+		return LevelFull, nil
+	case LevelNameOnly, LevelIDOnly:
+		return Level(s), nil
+	default:
+		return "", fmt.Errorf("unsupported redaction level: %s (use full, name-only or id-only)", s)
+	}
+}
+
+// pseudonymLength is the number of hex digits of pseudonymous IDs
+const pseudonymLength = 24
+
+// Redactor applies a redaction level to users and their IDs
+type Redactor struct {
+	Level Level
+	// Key derives pseudonymous IDs, so they cannot be computed from user
+	// IDs without it. Without a key they are plain hashes.
+	Key []byte
+}
+
+// User returns a copy of the user with only the fields the level allows
+func (r *Redactor) User(user *models.User) *models.User {
+	switch r.Level {
+	case LevelNameOnly:
+		return &models.User{ID: user.ID, Name: user.Name}
+	case LevelIDOnly:
+		return &models.User{ID: r.UserID(user.ID)}
+	default:
+		redacted := *user
+		redacted.ClearSecrets()
+		return &redacted
+	}
+}
+
+// UserID returns the ID to show for a user: the pseudonymous ID at
+// LevelIDOnly, the user ID otherwise
+func (r *Redactor) UserID(id string) string {
+	if r.Level != LevelIDOnly || id == "" {
+		return id
+	}
+
+	mac := hmac.New(sha256.New, r.Key)
+	if len(r.Key) == 0 {
+		mac = sha256.New()
+	}
+	mac.Write([]byte("face pseudonym\n" + id))
+	return "p-" + hex.EncodeToString(mac.Sum(nil))[:pseudonymLength]
+}
+
+// Label returns how to refer to a user in messages: the name, or the
+// pseudonymous ID at LevelIDOnly
+func (r *Redactor) Label(user *models.User) string {
+	if r.Level == LevelIDOnly {
+		return r.UserID(user.ID)
+	}
+	return user.Name
+}
+
+// FaceID returns the face ID to show, empty at LevelIDOnly since face IDs
+// lead back to the user
+func (r *Redactor) FaceID(id string) string {
+	if r.Level == LevelIDOnly {
+		return ""
+	}
+	return id
+}
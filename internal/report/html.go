@@ -0,0 +1,53 @@
+package report
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+//go:embed report.html
+var htmlSource string
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date":     func(t time.Time) string { return t.Format("2006-01-02") },
+	"datetime": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+	"percent":  func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+	"share":    share,
+	"decision": Sample.Decision,
+	"jpeg": func(data []byte) template.URL {
+		return template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(data))
+	},
+}).Parse(htmlSource))
+
+// WriteHTML writes the report as a self-contained HTML page, with the
+// sample probes embedded
+func (r *Report) WriteHTML(w io.Writer) error {
+	if err := htmlTemplate.Execute(w, r); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	return nil
+}
+
+// share returns n as a percentage of most, 0 if most is 0
+func share(n, most int) float64 {
+	if most == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(most)
+}
+
+// Decision describes the decision made on a sample
+func (s Sample) Decision() string {
+	switch {
+	case s.Matched && s.Label != "":
+		return fmt.Sprintf("%s (%.1f%%)", s.Label, s.Confidence*100)
+	case s.Matched:
+		return fmt.Sprintf("matched (%.1f%%)", s.Confidence*100)
+	default:
+		return "no match"
+	}
+}
@@ -0,0 +1,189 @@
+package report
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+
+	"face/internal/pdf"
+)
+
+// Layout of the PDF report, in points
+const (
+	pdfMargin    = 50.0
+	pdfRow       = 15.0
+	pdfBarX      = 340.0
+	pdfBarWidth  = pdf.PageWidth - pdfMargin - pdfBarX
+	pdfThumb     = 72.0
+	pdfThumbGap  = 10.0
+	pdfThumbText = 24.0
+	// pdfThumbsPerRow thumbnails fit the width of a page
+	pdfThumbsPerRow = 6
+)
+
+// Colors of the PDF report, those of the HTML report
+var (
+	pdfText     = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	pdfMuted    = color.RGBA{0x77, 0x77, 0x77, 0xff}
+	pdfRule     = color.RGBA{0xcc, 0xcc, 0xcc, 0xff}
+	pdfMatches  = color.RGBA{0x3a, 0x8f, 0x4b, 0xff}
+	pdfUnknown  = color.RGBA{0xe0, 0xa0, 0x30, 0xff}
+	pdfRejected = color.RGBA{0xc8, 0x44, 0x3a, 0xff}
+	pdfFailed   = color.RGBA{0x9a, 0x9a, 0x9a, 0xff}
+)
+
+// pdfLayout draws the report top to bottom, adding pages as they fill
+type pdfLayout struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+// need starts a new page unless h points are left on the current one
+func (l *pdfLayout) need(h float64) {
+	if l.page == nil || l.y+h > pdf.PageHeight-pdfMargin {
+		l.page = l.doc.AddPage()
+		l.y = pdfMargin
+	}
+}
+
+// text draws a line of text at x on the current line
+func (l *pdfLayout) text(x, size float64, bold bool, c color.Color, s string) {
+	l.page.Text(x, l.y, size, bold, c, s)
+}
+
+// heading starts a section
+func (l *pdfLayout) heading(title string) {
+	l.need(3 * pdfRow)
+	l.y += 1.5 * pdfRow
+	l.text(pdfMargin, 13, true, pdfText, title)
+	l.page.Rect(pdfMargin, l.y+4, pdf.PageWidth-2*pdfMargin, 0.5, pdfRule)
+	l.y += 1.5 * pdfRow
+}
+
+// WritePDF writes the report as a PDF document, with the sample probes
+// embedded
+func (r *Report) WritePDF(w io.Writer) error {
+	l := &pdfLayout{doc: pdf.New()}
+	l.need(0)
+	l.y += 10
+	l.text(pdfMargin, 20, true, pdfText, "Identification report")
+	l.y += pdfRow + 3
+	l.text(pdfMargin, 10, false, pdfMuted, fmt.Sprintf("%s to %s  -  generated %s",
+		r.From.Format("2006-01-02"), r.To.Format("2006-01-02"), r.Generated.Local().Format("2006-01-02 15:04")))
+
+	r.pdfSummary(l)
+	r.pdfDays(l)
+	r.pdfTopUsers(l)
+	if err := r.pdfSamples(l); err != nil {
+		return err
+	}
+
+	if _, err := l.doc.WriteTo(w); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+func (r *Report) pdfSummary(l *pdfLayout) {
+	l.heading("Summary")
+	rows := []struct {
+		label, value string
+	}{
+		{"Identifications", strconv.Itoa(r.Identifications)},
+		{"Verifications", strconv.Itoa(r.Verifications)},
+		{"Matches", strconv.Itoa(r.Matches)},
+		{"Unknown faces", strconv.Itoa(r.Unknown)},
+		{"Rejected verifications", strconv.Itoa(r.Rejected)},
+		{"Failed", strconv.Itoa(r.Failed)},
+		{"Unknown rate", fmt.Sprintf("%.1f%%", r.UnknownRate()*100)},
+	}
+	for _, row := range rows {
+		l.text(pdfMargin, 11, false, pdfText, row.label)
+		l.text(pdfMargin+200-pdf.TextWidth(row.value, 11), 11, true, pdfText, row.value)
+		l.y += pdfRow
+	}
+}
+
+func (r *Report) pdfDays(l *pdfLayout) {
+	l.heading("Matches per day")
+	x := pdfMargin
+	for _, item := range []struct {
+		c     color.Color
+		label string
+	}{{pdfMatches, "matches"}, {pdfUnknown, "unknown"}, {pdfRejected, "rejected"}, {pdfFailed, "failed"}} {
+		l.page.Rect(x, l.y-8, 9, 9, item.c)
+		l.text(x+13, 9, false, pdfMuted, item.label)
+		x += 80
+	}
+	l.y += pdfRow
+
+	columns := []float64{140, 195, 250, 305}
+	header := func() {
+		l.text(pdfMargin, 9, true, pdfText, "Day")
+		for i, title := range []string{"Matches", "Unknown", "Rejected", "Failed"} {
+			l.text(columns[i]-pdf.TextWidth(title, 9), 9, true, pdfText, title)
+		}
+		l.y += pdfRow
+	}
+	header()
+
+	most := r.MaxDay()
+	for _, d := range r.Days {
+		if l.y+pdfRow > pdf.PageHeight-pdfMargin {
+			l.need(pdfRow)
+			header()
+		}
+		l.text(pdfMargin, 10, false, pdfText, d.Date.Format("2006-01-02"))
+		x := pdfBarX
+		for i, n := range []int{d.Matches, d.Unknown, d.Rejected, d.Failed} {
+			value := strconv.Itoa(n)
+			l.text(columns[i]-pdf.TextWidth(value, 10), 10, false, pdfText, value)
+			w := share(n, most) / 100 * pdfBarWidth
+			l.page.Rect(x, l.y-9, w, 10, []color.Color{pdfMatches, pdfUnknown, pdfRejected, pdfFailed}[i])
+			x += w
+		}
+		l.y += pdfRow
+	}
+}
+
+func (r *Report) pdfTopUsers(l *pdfLayout) {
+	l.heading("Top users")
+	if len(r.TopUsers) == 0 {
+		l.text(pdfMargin, 11, false, pdfText, "No matches.")
+		l.y += pdfRow
+		return
+	}
+	for _, u := range r.TopUsers {
+		l.need(pdfRow)
+		value := strconv.Itoa(u.Matches)
+		l.text(pdfMargin, 11, false, pdfText, u.Label)
+		l.text(pdf.PageWidth-pdfMargin-pdf.TextWidth(value, 11), 11, false, pdfText, value)
+		l.y += pdfRow
+	}
+}
+
+func (r *Report) pdfSamples(l *pdfLayout) error {
+	if len(r.Samples) == 0 {
+		return nil
+	}
+	l.heading("Sample probes")
+	for i, s := range r.Samples {
+		if i%pdfThumbsPerRow == 0 {
+			if i > 0 {
+				l.y += pdfThumb + pdfThumbText
+			}
+			l.need(pdfThumb + pdfThumbText)
+		}
+		img, err := l.doc.AddJPEG(s.JPEG)
+		if err != nil {
+			return err
+		}
+		x := pdfMargin + float64(i%pdfThumbsPerRow)*(pdfThumb+pdfThumbGap)
+		l.page.Image(img, x, l.y, pdfThumb, pdfThumb)
+		l.page.Text(x, l.y+pdfThumb+10, 7, false, pdfMuted, s.CapturedAt.Local().Format("2006-01-02 15:04"))
+		l.page.Text(x, l.y+pdfThumb+19, 7, false, pdfText, s.Decision())
+	}
+	return nil
+}
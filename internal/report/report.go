@@ -0,0 +1,156 @@
+// Package report summarizes the identifications and verifications of the
+// audit log over a range of days, for management and compliance reviews,
+// and renders the summary as HTML or PDF.
+package report
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// TopUsers is the number of users listed by how often they were matched
+const TopUsers = 10
+
+// Report is the summary of the identifications and verifications of a
+// range of days
+type Report struct {
+	// From and To are the first and last day of the range
+	From, To  time.Time
+	Generated time.Time
+
+	Identifications int
+	Verifications   int
+	// Matches are the identifications that found a user and the
+	// verifications that confirmed one
+	Matches int
+	// Unknown are the identifications that found no user, Rejected the
+	// verifications that did not confirm the user
+	Unknown  int
+	Rejected int
+	// Failed are the operations that failed before a decision, e.g. for
+	// lack of a face
+	Failed int
+
+	Days     []Day
+	TopUsers []UserMatches
+	// Samples are probes saved with decisions of the range, see
+	// 'face identify --save-probe'
+	Samples []Sample
+
+	// decided counts the identifications that matched or found no user
+	decided int
+}
+
+// Day is the decisions of a day
+type Day struct {
+	Date                               time.Time
+	Matches, Unknown, Rejected, Failed int
+}
+
+// Total returns the number of operations of the day
+func (d Day) Total() int {
+	return d.Matches + d.Unknown + d.Rejected + d.Failed
+}
+
+// UserMatches is how often a user was matched
+type UserMatches struct {
+	// Label names the user as the redaction level allows
+	Label   string
+	Matches int
+}
+
+// Sample is a probe saved with a decision
+type Sample struct {
+	CapturedAt time.Time
+	Operation  string
+	Matched    bool
+	Confidence float64
+	// Label names the user decided for, empty if there is none
+	Label string
+	// JPEG is the crop of the face
+	JPEG []byte
+}
+
+// New summarizes the identification and verification events of the days
+// from to to. label names the user of an ID as the redaction level allows.
+func New(from, to time.Time, events []models.AuditEvent, label func(userID string) string) *Report {
+	r := &Report{From: from, To: to, Generated: time.Now()}
+	days := make(map[string]*Day)
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		r.Days = append(r.Days, Day{Date: d})
+	}
+	for i := range r.Days {
+		days[r.Days[i].Date.Format(time.DateOnly)] = &r.Days[i]
+	}
+
+	matches := make(map[string]int)
+	for _, e := range events {
+		day := days[e.OccurredAt.In(from.Location()).Format(time.DateOnly)]
+		if day == nil || (e.Operation != models.AuditIdentify && e.Operation != models.AuditVerify) {
+			continue
+		}
+		r.count(day, &e, matches)
+	}
+
+	for userID, n := range matches {
+		r.TopUsers = append(r.TopUsers, UserMatches{Label: label(userID), Matches: n})
+	}
+	slices.SortFunc(r.TopUsers, func(a, b UserMatches) int {
+		return cmp.Or(b.Matches-a.Matches, cmp.Compare(a.Label, b.Label))
+	})
+	r.TopUsers = r.TopUsers[:min(len(r.TopUsers), TopUsers)]
+	return r
+}
+
+// count adds an identification or verification of a day, and the user
+// matched to matches
+func (r *Report) count(day *Day, e *models.AuditEvent, matches map[string]int) {
+	identify := e.Operation == models.AuditIdentify
+	if identify {
+		r.Identifications++
+	} else {
+		r.Verifications++
+	}
+	switch {
+	case e.Result == models.AuditSucceeded:
+		r.Matches++
+		day.Matches++
+		if identify {
+			r.decided++
+		}
+		if e.UserID != "" {
+			matches[e.UserID]++
+		}
+	case e.Result == models.AuditNoMatch && identify:
+		r.Unknown++
+		day.Unknown++
+		r.decided++
+	case e.Result == models.AuditNoMatch:
+		r.Rejected++
+		day.Rejected++
+	default:
+		r.Failed++
+		day.Failed++
+	}
+}
+
+// UnknownRate returns the share of the identifications decided that found
+// no user, 0 without any
+func (r *Report) UnknownRate() float64 {
+	if r.decided == 0 {
+		return 0
+	}
+	return float64(r.Unknown) / float64(r.decided)
+}
+
+// MaxDay returns the most operations of a day, for scaling charts
+func (r *Report) MaxDay() int {
+	most := 0
+	for _, d := range r.Days {
+		most = max(most, d.Total())
+	}
+	return most
+}
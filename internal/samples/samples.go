@@ -0,0 +1,118 @@
+package samples
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// DefaultSize is the edge length of generated sample images
+const DefaultSize = 160
+
+// Person describes the facial layout of a synthetic identity
+type Person struct {
+	Seed      int64
+	Skin      color.RGBA
+	FaceWidth float64 // relative to image size
+	EyeGap    float64 // relative to face width
+	EyeY      float64 // relative to face height
+	MouthW    float64 // relative to face width
+	NoseLen   float64 // relative to face height
+}
+
+// NewPerson derives a deterministic synthetic identity from a seed
+func NewPerson(seed int64) Person {
+	r := rand.New(rand.NewSource(seed)) // #nosec G404 -- deterministic test data
+	return Person{
+		Seed: seed,
+		Skin: color.RGBA{
+			R: uint8(150 + r.Intn(90)),
+			G: uint8(100 + r.Intn(80)),
+			B: uint8(70 + r.Intn(70)),
+			A: 255,
+		},
+		FaceWidth: 0.55 + r.Float64()*0.15,
+		EyeGap:    0.30 + r.Float64()*0.15,
+		EyeY:      0.35 + r.Float64()*0.10,
+		MouthW:    0.30 + r.Float64()*0.20,
+		NoseLen:   0.12 + r.Float64()*0.10,
+	}
+}
+
+// Render draws the person as a size×size RGBA image. Different variation
+// values produce slightly shifted, re-lit shots of the same person.
+func (p Person) Render(size, variation int) *image.RGBA {
+	r := rand.New(rand.NewSource(p.Seed*1000 + int64(variation))) // #nosec G404 -- deterministic test data
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	s := float64(size)
+	shiftX := (r.Float64() - 0.5) * 0.04 * s
+	shiftY := (r.Float64() - 0.5) * 0.04 * s
+	light := 0.9 + r.Float64()*0.2
+
+	cx, cy := s/2+shiftX, s/2+shiftY
+	faceW := p.FaceWidth * s / 2
+	faceH := faceW * 1.3
+
+	background := color.RGBA{R: 200, G: 205, B: 210, A: 255}
+	dark := color.RGBA{R: 40, G: 30, B: 30, A: 255}
+	lips := color.RGBA{R: 150, G: 60, B: 60, A: 255}
+
+	eyeY := cy - faceH + 2*faceH*p.EyeY
+	eyeDX := faceW * p.EyeGap
+	noseTop := eyeY + faceH*0.05
+	noseBottom := noseTop + 2*faceH*p.NoseLen
+	mouthY := noseBottom + faceH*0.18
+	mouthW := faceW * p.MouthW
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			fx, fy := float64(x), float64(y)
+			c := background
+
+			if ellipse(fx, fy, cx, cy, faceW, faceH) {
+				c = p.Skin
+			}
+			if ellipse(fx, fy, cx-eyeDX, eyeY, faceW*0.14, faceH*0.06) ||
+				ellipse(fx, fy, cx+eyeDX, eyeY, faceW*0.14, faceH*0.06) {
+				c = dark
+			}
+			if math.Abs(fx-cx) < faceW*0.05 && fy > noseTop && fy < noseBottom {
+				c = shade(p.Skin, 0.75)
+			}
+			if ellipse(fx, fy, cx, mouthY, mouthW, faceH*0.05) {
+				c = lips
+			}
+
+			noise := 1 + (r.Float64()-0.5)*0.06
+			img.SetRGBA(x, y, shade(c, light*noise))
+		}
+	}
+
+	return img
+}
+
+// Face renders the first variation of the person derived from seed
+func Face(seed int64) *image.RGBA {
+	return NewPerson(seed).Render(DefaultSize, 0)
+}
+
+func ellipse(x, y, cx, cy, rx, ry float64) bool {
+	dx, dy := (x-cx)/rx, (y-cy)/ry
+	return dx*dx+dy*dy <= 1
+}
+
+func shade(c color.RGBA, f float64) color.RGBA {
+	return color.RGBA{R: clamp(float64(c.R) * f), G: clamp(float64(c.G) * f), B: clamp(float64(c.B) * f), A: c.A}
+}
+
+func clamp(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
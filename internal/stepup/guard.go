@@ -0,0 +1,99 @@
+package stepup
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// Attempt limits of a Guard: after MaxFailures wrong PINs or codes in a
+// row, a user's second factor is refused for LockoutPeriod
+const (
+	MaxFailures   = 5
+	LockoutPeriod = 15 * time.Minute
+)
+
+// ErrLockedOut is returned while a user's second factor is locked after too
+// many wrong attempts
+var ErrLockedOut = errors.New("too many wrong PINs or authenticator codes, try again later")
+
+// ErrCodeUsed is returned for an authenticator code that was already
+// accepted, which may have been seen by someone else
+var ErrCodeUsed = errors.New("authenticator code was already used")
+
+// Guard checks second factors like Check, limiting the attempts of each
+// user and accepting each authenticator code once. It keeps its state in
+// memory, so the limits hold within one process, e.g. 'face serve'.
+type Guard struct {
+	mu    sync.Mutex
+	users map[string]*attempts
+}
+
+// attempts is what a Guard knows about a user's second factor
+type attempts struct {
+	// failures counts the wrong attempts in a row, and those in progress
+	failures    int
+	lockedUntil time.Time
+	// lastStep is the TOTP time step of the last accepted code
+	lastStep int64
+}
+
+// NewGuard returns a guard without attempts
+func NewGuard() *Guard {
+	return &Guard{users: make(map[string]*attempts)}
+}
+
+// Check verifies the second factor given for the user at now. An attempt
+// counts as wrong until it has been checked, so attempts sent at once
+// cannot get past the limit.
+func (g *Guard) Check(user *models.User, secret string, now time.Time) error {
+	if !HasFactor(user) {
+		return ErrNoFactor
+	}
+	if err := g.begin(user.ID, now); err != nil {
+		return err
+	}
+	step, err := check(user, secret, now)
+	return g.end(user.ID, step, err)
+}
+
+// begin counts an attempt of the user, failing if they are locked out
+func (g *Guard) begin(userID string, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a := g.users[userID]
+	if a == nil {
+		a = &attempts{}
+		g.users[userID] = a
+	}
+	if now.Before(a.lockedUntil) {
+		return ErrLockedOut
+	}
+	a.failures++
+	if a.failures >= MaxFailures {
+		a.failures = 0
+		a.lockedUntil = now.Add(LockoutPeriod)
+	}
+	return nil
+}
+
+// end records the result of an attempt begun by begin, rejecting a TOTP
+// step that was accepted before
+func (g *Guard) end(userID string, step int64, err error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a := g.users[userID]
+	if err == nil && step != 0 && step <= a.lastStep {
+		err = ErrCodeUsed
+	}
+	if err != nil {
+		return err
+	}
+	a.failures, a.lockedUntil = 0, time.Time{}
+	a.lastStep = max(a.lastStep, step)
+	return nil
+}
@@ -0,0 +1,80 @@
+package stepup
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PIN length limits
+const (
+	MinPINLength = 4
+	MaxPINLength = 12
+)
+
+// pinIterations is the PBKDF2 work factor of new PIN hashes. PINs have few
+// combinations, so the hash is deliberately slow.
+const pinIterations = 600_000
+
+// pinScheme prefixes PIN hashes, so the scheme can change later
+const pinScheme = "pbkdf2-sha256"
+
+// ErrInvalidPIN is returned for PINs that are not 4 to 12 digits
+var ErrInvalidPIN = fmt.Errorf("PIN must be %d to %d digits", MinPINLength, MaxPINLength)
+
+// HashPIN returns a salted hash of the PIN to store
+func HashPIN(pin string) (string, error) {
+	if len(pin) < MinPINLength || len(pin) > MaxPINLength || strings.Trim(pin, "0123456789") != "" {
+		return "", ErrInvalidPIN
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, pin, salt, pinIterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", pinScheme, pinIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// CheckPIN reports whether the PIN matches a hash made by HashPIN
+func CheckPIN(hash, pin string) bool {
+	iterations, salt, want, err := parsePINHash(hash)
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, pin, salt, iterations, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, want) == 1
+}
+
+func parsePINHash(hash string) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != pinScheme {
+		return 0, nil, nil, errors.New("unknown PIN hash scheme")
+	}
+	if iterations, err = strconv.Atoi(parts[1]); err != nil || iterations <= 0 {
+		return 0, nil, nil, errors.New("invalid PIN hash")
+	}
+
+	enc := base64.RawStdEncoding
+	if salt, err = enc.DecodeString(parts[2]); err != nil {
+		return 0, nil, nil, errors.New("invalid PIN hash")
+	}
+	if key, err = enc.DecodeString(parts[3]); err != nil || len(key) == 0 {
+		return 0, nil, nil, errors.New("invalid PIN hash")
+	}
+	return iterations, salt, key, nil
+}
@@ -0,0 +1,115 @@
+// Package stepup adds a second factor to face verification: salted PIN
+// hashes, TOTP codes, and the policy saying which verifications need one.
+package stepup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// DefaultGroupKey is the metadata entry holding a user's group
+const DefaultGroupKey = "group"
+
+// Rule requires a second factor from the users of a group whose face
+// matched with a confidence in the band below BelowConfidence
+type Rule struct {
+	// Group is the user group the rule applies to, every user if empty
+	Group string `json:"group,omitempty"`
+	// BelowConfidence is the confidence from which the face alone is
+	// enough, 0 to always require a second factor
+	BelowConfidence float64 `json:"below_confidence,omitempty"`
+}
+
+// Policy says when a verification needs a second factor
+type Policy struct {
+	Rules []Rule
+	// GroupKey is the metadata entry holding a user's group, or a list of
+	// groups, DefaultGroupKey if empty
+	GroupKey string
+}
+
+// Validate checks the rules
+func (p Policy) Validate() error {
+	for _, r := range p.Rules {
+		if r.BelowConfidence < 0 || r.BelowConfidence > 1 {
+			return errors.New("step-up below_confidence must be between 0 and 1")
+		}
+	}
+	return nil
+}
+
+// Required reports whether verifying the user with the confidence needs a
+// second factor
+func (p Policy) Required(user *models.User, confidence float64) bool {
+	for _, r := range p.Rules {
+		if r.Group != "" && !p.inGroup(user, r.Group) {
+			continue
+		}
+		if r.BelowConfidence == 0 || confidence < r.BelowConfidence {
+			return true
+		}
+	}
+	return false
+}
+
+// inGroup reports whether the user's metadata puts them in the group
+func (p Policy) inGroup(user *models.User, group string) bool {
+	key := p.GroupKey
+	if key == "" {
+		key = DefaultGroupKey
+	}
+
+	switch v := user.Metadata[key].(type) {
+	case string:
+		return strings.EqualFold(v, group)
+	case []any:
+		for _, g := range v {
+			if strings.EqualFold(fmt.Sprint(g), group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ErrNoFactor is returned when a second factor is required from a user who
+// has none
+var ErrNoFactor = errors.New("user has no PIN or authenticator set up")
+
+// ErrWrongFactor is returned when the PIN or code does not match
+var ErrWrongFactor = errors.New("wrong PIN or authenticator code")
+
+// HasFactor reports whether the user has set up a second factor
+func HasFactor(user *models.User) bool {
+	return user.PINHash != "" || user.TOTPSecret != ""
+}
+
+// Check verifies the second factor given for the user: the current code of
+// their authenticator app, or their PIN if they have no authenticator. The
+// PIN is weaker, so it is not accepted from users with both.
+func Check(user *models.User, secret string) error {
+	_, err := check(user, secret, time.Now())
+	return err
+}
+
+// check is Check at now, also returning the TOTP time step of an accepted
+// authenticator code, 0 for a PIN
+func check(user *models.User, secret string, now time.Time) (int64, error) {
+	switch {
+	case user.TOTPSecret != "":
+		if step, ok := totpStep(user.TOTPSecret, secret, now); ok {
+			return step, nil
+		}
+	case user.PINHash != "":
+		if CheckPIN(user.PINHash, secret) {
+			return 0, nil
+		}
+	default:
+		return 0, ErrNoFactor
+	}
+	return 0, ErrWrongFactor
+}
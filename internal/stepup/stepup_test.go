@@ -0,0 +1,144 @@
+package stepup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"face/internal/database/models"
+)
+
+// rfcSecret is the secret of the test vectors of RFC 6238,
+// "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCode checks codes against the SHA-1 test vectors of RFC 6238,
+// of which authenticator apps show the last six digits
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.want {
+			t.Errorf("code at %d: got %s, want %s", tt.unix, code, tt.want)
+		}
+	}
+}
+
+// TestTOTPSkew checks that the codes of the neighbouring periods are
+// accepted, and older or newer ones are not
+func TestTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	for periods, want := range map[int]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, err := TOTPCode(rfcSecret, now.Add(time.Duration(periods)*totpPeriod))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := totpStep(rfcSecret, code, now); ok != want {
+			t.Errorf("code %d period(s) away: accepted %v, want %v", periods, ok, want)
+		}
+	}
+}
+
+// TestCheckPIN checks PINs against their hash, and refuses PINs that are
+// not 4 to 12 digits
+func TestCheckPIN(t *testing.T) {
+	for _, pin := range []string{"123", "1234567890123", "12a4", ""} {
+		if _, err := HashPIN(pin); !errors.Is(err, ErrInvalidPIN) {
+			t.Errorf("HashPIN(%q): got %v, want ErrInvalidPIN", pin, err)
+		}
+	}
+
+	user := &models.User{PINHash: testPINHash(t, "4711")}
+	if err := Check(user, "4711"); err != nil {
+		t.Errorf("right PIN: %v", err)
+	}
+	if err := Check(user, "4712"); !errors.Is(err, ErrWrongFactor) {
+		t.Errorf("wrong PIN: got %v, want ErrWrongFactor", err)
+	}
+	if CheckPIN("md5$1$abc$def", "4711") {
+		t.Error("PIN accepted against a hash of an unknown scheme")
+	}
+	if err := Check(&models.User{}, "4711"); !errors.Is(err, ErrNoFactor) {
+		t.Errorf("no factor: got %v, want ErrNoFactor", err)
+	}
+}
+
+// TestCheckPrefersAuthenticator checks that a user with a PIN and an
+// authenticator must give the authenticator code
+func TestCheckPrefersAuthenticator(t *testing.T) {
+	now := time.Now()
+	user := &models.User{PINHash: testPINHash(t, "4711"), TOTPSecret: rfcSecret}
+	if _, err := check(user, "4711", now); !errors.Is(err, ErrWrongFactor) {
+		t.Errorf("PIN of a user with an authenticator: got %v, want ErrWrongFactor", err)
+	}
+	code, err := TOTPCode(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := check(user, code, now); err != nil {
+		t.Errorf("authenticator code: %v", err)
+	}
+}
+
+// TestGuard checks the lockout after MaxFailures wrong codes and that an
+// accepted code is not accepted again
+func TestGuard(t *testing.T) {
+	g := NewGuard()
+	user := &models.User{ID: "u1", TOTPSecret: rfcSecret}
+	now := time.Unix(1111111109, 0)
+	code, err := TOTPCode(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range MaxFailures {
+		if err := g.Check(user, "000000", now); !errors.Is(err, ErrWrongFactor) {
+			t.Fatalf("wrong code %d: got %v, want ErrWrongFactor", i+1, err)
+		}
+	}
+	if err := g.Check(user, code, now); !errors.Is(err, ErrLockedOut) {
+		t.Fatalf("right code while locked out: got %v, want ErrLockedOut", err)
+	}
+	if err := g.Check(&models.User{ID: "u2", TOTPSecret: rfcSecret}, code, now); err != nil {
+		t.Errorf("another user is locked out too: %v", err)
+	}
+
+	later := now.Add(LockoutPeriod)
+	code, err = TOTPCode(rfcSecret, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(user, code, later); err != nil {
+		t.Fatalf("right code after the lockout: %v", err)
+	}
+	if err := g.Check(user, code, later); !errors.Is(err, ErrCodeUsed) {
+		t.Errorf("code used twice: got %v, want ErrCodeUsed", err)
+	}
+	earlier, err := TOTPCode(rfcSecret, later.Add(-totpPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(user, earlier, later); !errors.Is(err, ErrCodeUsed) {
+		t.Errorf("code older than the one used: got %v, want ErrCodeUsed", err)
+	}
+}
+
+func testPINHash(t *testing.T, pin string) string {
+	t.Helper()
+	hash, err := HashPIN(pin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
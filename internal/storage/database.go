@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"image"
+
+	"face/internal/database"
+	"face/internal/encryption"
+)
+
+// DatabaseStorage stores images in the database itself, so a single SQLite
+// file holds everything. Images are kept as the JPEG files of the local
+// backend would be, under the same filenames.
+type DatabaseStorage struct {
+	store         database.ImageStore
+	layout        Layout
+	encoder       Encoder
+	encryptionKey *encryption.Key
+}
+
+// NewDatabaseStorage creates a storage keeping images in the database, which
+// must be able to store them
+func NewDatabaseStorage(db database.Database, layout Layout) (*DatabaseStorage, error) {
+	store, ok := db.(database.ImageStore)
+	if !ok {
+		return nil, database.ErrImageStoreUnsupported
+	}
+	return &DatabaseStorage{store: store, layout: layout}, nil
+}
+
+// SetEncoder sets the encoder of newly saved images
+func (d *DatabaseStorage) SetEncoder(encoder Encoder) {
+	d.encoder = encoder
+}
+
+// SetEncryptionKey sets the key images are encrypted with as they are saved
+// and decrypted with as they are loaded; images saved without one are still
+// loaded
+func (d *DatabaseStorage) SetEncryptionKey(key *encryption.Key) {
+	d.encryptionKey = key
+}
+
+// SaveImage stores an image
+func (d *DatabaseStorage) SaveImage(userID, faceID string, img image.Image) (string, error) {
+	data, err := encode(d.encoder, userID, faceID, img)
+	if err != nil {
+		return "", err
+	}
+	filename := Filename(d.layout, userID, faceID)
+	if data, err = seal(d.encryptionKey, filename, data); err != nil {
+		return "", err
+	}
+
+	if err := d.store.PutImageData(filename, data); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// LoadImage loads an image
+func (d *DatabaseStorage) LoadImage(filename string) (image.Image, error) {
+	data, err := d.LoadData(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(data)
+}
+
+// LoadData returns the stored bytes of an image
+func (d *DatabaseStorage) LoadData(filename string) ([]byte, error) {
+	data, err := d.store.ImageData(filename)
+	if err != nil {
+		return nil, err
+	}
+	return open(d.encryptionKey, filename, data)
+}
+
+// DeleteImage removes an image; deleting a missing image is not an error
+func (d *DatabaseStorage) DeleteImage(filename string) error {
+	return d.store.DeleteImageData(filename)
+}
+
+// Exists checks if an image is stored
+func (d *DatabaseStorage) Exists(filename string) bool {
+	exists, err := d.store.HasImageData(filename)
+	return err == nil && exists
+}
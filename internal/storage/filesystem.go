@@ -1,44 +1,108 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
+	_ "image/jpeg" // decoders of the accepted input formats
+	_ "image/png"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"face/internal/encryption"
+	"face/internal/imaging"
 )
 
+// Layout controls where new images are placed inside the base directory
+type Layout string
+
+const (
+	// LayoutFlat stores every image directly in the base directory
+	LayoutFlat Layout = "flat"
+	// LayoutSharded spreads images over two levels of hash-named
+	// subdirectories (ab/cd/<hash>.jpg) to keep directories small
+	LayoutSharded Layout = "sharded"
+)
+
+// ErrListingUnsupported is returned when images cannot be listed from the
+// filesystem alone; callers should list a user's images from the database
+var ErrListingUnsupported = errors.New("listing images is not supported by the sharded layout")
+
+// ParseLayout converts a string to Layout
+func ParseLayout(s string) (Layout, error) {
+	switch Layout(s) {
+	case "", LayoutFlat:
+		return LayoutFlat, nil
+	case LayoutSharded:
+		return LayoutSharded, nil
+	default:
+		return "", fmt.Errorf("unsupported storage layout: %s", s)
+	}
+}
+
 // FileSystemStorage handles file-based image storage
 type FileSystemStorage struct {
-	baseDir string
+	baseDir       string
+	layout        Layout
+	encoder       Encoder
+	encryptionKey *encryption.Key
 }
 
 // NewFileSystemStorage creates a new filesystem storage
-func NewFileSystemStorage(baseDir string) (*FileSystemStorage, error) {
+func NewFileSystemStorage(baseDir string, layout Layout) (*FileSystemStorage, error) {
 	if err := os.MkdirAll(baseDir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create base directory: %w", err)
 	}
 
 	return &FileSystemStorage{
 		baseDir: baseDir,
+		layout:  layout,
 	}, nil
 }
 
+// Filename returns the relative, slash-separated name under which the image
+// of a face is stored with the given layout
+func Filename(layout Layout, userID, faceID string) string {
+	name := fmt.Sprintf("user_%s_face_%s.jpg", userID, faceID)
+	if layout != LayoutSharded {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])
+	return path.Join(hash[0:2], hash[2:4], hash+".jpg")
+}
+
+// SetEncoder sets the encoder of newly saved images
+func (fs *FileSystemStorage) SetEncoder(encoder Encoder) {
+	fs.encoder = encoder
+}
+
+// SetEncryptionKey sets the key images are encrypted with as they are saved
+// and decrypted with as they are loaded; images saved without one are still
+// loaded
+func (fs *FileSystemStorage) SetEncryptionKey(key *encryption.Key) {
+	fs.encryptionKey = key
+}
+
 // SaveImage saves an image with a specific filename
 func (fs *FileSystemStorage) SaveImage(userID, faceID string, img image.Image) (string, error) {
-	filename := fmt.Sprintf("user_%s_face_%s.jpg", userID, faceID)
-	fullPath := filepath.Join(fs.baseDir, filename)
-
-	file, err := os.Create(fullPath)
+	data, err := encode(fs.encoder, userID, faceID, img)
 	if err != nil {
-		return "", fmt.Errorf("failed to create image file: %w", err)
+		return "", err
+	}
+	filename := Filename(fs.layout, userID, faceID)
+	if data, err = seal(fs.encryptionKey, filename, data); err != nil {
+		return "", err
 	}
-	defer file.Close()
 
-	if err := jpeg.Encode(file, img, &jpeg.Options{Quality: 95}); err != nil {
-		return "", fmt.Errorf("failed to encode image: %w", err)
+	if err := fs.writeFile(filename, data); err != nil {
+		return "", err
 	}
 
 	return filename, nil
@@ -46,62 +110,116 @@ func (fs *FileSystemStorage) SaveImage(userID, faceID string, img image.Image) (
 
 // LoadImage loads an image from a filename
 func (fs *FileSystemStorage) LoadImage(filename string) (image.Image, error) {
-	fullPath := filepath.Join(fs.baseDir, filename)
-
-	file, err := os.Open(fullPath)
+	data, err := fs.LoadData(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open image file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	return decodeImage(data)
+}
 
-	img, _, err := image.Decode(file)
+// LoadData reads the bytes of an image file
+func (fs *FileSystemStorage) LoadData(filename string) ([]byte, error) {
+	data, err := os.ReadFile(fs.fullPath(filename))
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
+		return nil, fmt.Errorf("failed to read image file: %w", err)
 	}
-
-	return img, nil
+	return open(fs.encryptionKey, filename, data)
 }
 
 // LoadImageFromPath loads an image from an absolute or relative path
 func (fs *FileSystemStorage) LoadImageFromPath(path string) (image.Image, error) {
+	return LoadImageFromPath(path)
+}
+
+// LoadImageFromPath loads an image from an absolute or relative path
+// outside of any storage directory
+func LoadImageFromPath(path string) (image.Image, error) {
+	return LoadInputImage(path, imaging.Limits{})
+}
+
+// LoadInputImage loads an image to process from an absolute or relative
+// path, applying the size limits. Images that must be rejected are
+// rejected from their header, before decoding them.
+func LoadInputImage(path string, limits imaging.Limits) (image.Image, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open image file: %w", err)
 	}
 	defer file.Close()
 
-	ext := strings.ToLower(filepath.Ext(path))
-	var img image.Image
-
-	switch ext {
-	case ".jpg", ".jpeg":
-		img, err = jpeg.Decode(file)
-	case ".png":
-		img, err = png.Decode(file)
-	default:
-		img, _, err = image.Decode(file)
-	}
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %w", err)
-	}
+	return DecodeInputImage(file, limits)
+}
 
-	return img, nil
+// DecodeInputImage decodes an image to process, e.g. an upload, applying
+// the size limits like LoadInputImage. Files that are not images are
+// rejected from their first bytes, see imaging.DecodeInput.
+func DecodeInputImage(r io.ReadSeeker, limits imaging.Limits) (image.Image, error) {
+	return imaging.DecodeInput(r, limits)
 }
 
 // DeleteImage removes an image file
 func (fs *FileSystemStorage) DeleteImage(filename string) error {
-	fullPath := filepath.Join(fs.baseDir, filename)
+	fullPath := fs.fullPath(filename)
 
 	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete image: %w", err)
 	}
 
+	fs.removeEmptyDirs(filepath.Dir(fullPath))
 	return nil
 }
 
-// ListImages lists all images for a specific user
+// MoveImage renames a stored image, creating directories as needed. An
+// encrypted image is bound to its filename, so it is sealed again under
+// the new one.
+func (fs *FileSystemStorage) MoveImage(from, to string) error {
+	if fs.encryptionKey != nil {
+		return fs.resealImage(from, to)
+	}
+
+	toPath := fs.fullPath(to)
+	if err := os.MkdirAll(filepath.Dir(toPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	fromPath := fs.fullPath(from)
+	if err := os.Rename(fromPath, toPath); err != nil {
+		return fmt.Errorf("failed to move image: %w", err)
+	}
+
+	fs.removeEmptyDirs(filepath.Dir(fromPath))
+	return nil
+}
+
+// resealImage moves an image by writing it sealed under its new filename
+// and then removing the old file
+func (fs *FileSystemStorage) resealImage(from, to string) error {
+	data, err := fs.LoadData(from)
+	if err != nil {
+		return err
+	}
+	if data, err = seal(fs.encryptionKey, to, data); err != nil {
+		return err
+	}
+	if err := fs.writeFile(to, data); err != nil {
+		return err
+	}
+	return fs.DeleteImage(from)
+}
+
+// Layout returns the layout used for newly saved images
+func (fs *FileSystemStorage) Layout() Layout {
+	return fs.layout
+}
+
+// ListImages lists all images for a specific user. Only the flat layout
+// encodes the user in the filename; with the sharded layout the images of a
+// user must be listed from their face records in the database.
 func (fs *FileSystemStorage) ListImages(userID string) ([]string, error) {
+	if fs.layout == LayoutSharded {
+		return nil, ErrListingUnsupported
+	}
+
 	pattern := filepath.Join(fs.baseDir, fmt.Sprintf("user_%s_face_*.jpg", userID))
 
 	matches, err := filepath.Glob(pattern)
@@ -135,7 +253,37 @@ func (fs *FileSystemStorage) DeleteAllUserImages(userID string) error {
 
 // Exists checks if an image file exists
 func (fs *FileSystemStorage) Exists(filename string) bool {
-	fullPath := filepath.Join(fs.baseDir, filename)
+	fullPath := fs.fullPath(filename)
 	_, err := os.Stat(fullPath)
 	return err == nil
 }
+
+// writeFile stores already encoded image data under a filename
+func (fs *FileSystemStorage) writeFile(filename string, data []byte) error {
+	fullPath := fs.fullPath(filename)
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	if err := os.WriteFile(fullPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write image file: %w", err)
+	}
+
+	return nil
+}
+
+// fullPath resolves a stored, slash-separated filename inside the base directory
+func (fs *FileSystemStorage) fullPath(filename string) string {
+	return filepath.Join(fs.baseDir, filepath.FromSlash(filename))
+}
+
+// removeEmptyDirs removes now-empty shard directories up to the base directory
+func (fs *FileSystemStorage) removeEmptyDirs(dir string) {
+	base := filepath.Clean(fs.baseDir)
+	for dir = filepath.Clean(dir); dir != base && strings.HasPrefix(dir, base); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
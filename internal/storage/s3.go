@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"path"
+
+	"face/internal/encryption"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// ErrObjectNotFound is returned when an image is not in the bucket
+var ErrObjectNotFound = errors.New("object not found")
+
+// DefaultS3Endpoint is used when no endpoint is configured
+const DefaultS3Endpoint = "s3.amazonaws.com"
+
+// S3Config holds the settings of an S3-compatible bucket (AWS S3, MinIO, ...)
+type S3Config struct {
+	Endpoint string // host[:port], e.g. minio:9000; defaults to DefaultS3Endpoint
+	Region   string
+	Bucket   string
+	Prefix   string // optional key prefix inside the bucket
+	Insecure bool   // use plain HTTP, e.g. for a local MinIO
+}
+
+// S3Storage stores images as objects in an S3-compatible bucket.
+// Credentials are read from the standard AWS_ACCESS_KEY_ID /
+// AWS_SECRET_ACCESS_KEY (or MINIO_ROOT_USER / MINIO_ROOT_PASSWORD)
+// environment variables, the AWS credentials file, or the instance role.
+type S3Storage struct {
+	client        *minio.Client
+	bucket        string
+	prefix        string
+	layout        Layout
+	encoder       Encoder
+	encryptionKey *encryption.Key
+}
+
+// NewS3Storage creates a new S3 storage
+func NewS3Storage(cfg S3Config, layout Layout) (*S3Storage, error) {
+	client, err := NewS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: cfg.Prefix,
+		layout: layout,
+	}, nil
+}
+
+// NewS3Client returns a client of the bucket, with credentials found as
+// described for S3Storage
+func NewS3Client(cfg S3Config) (*minio.Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("S3 bucket cannot be empty")
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+	})
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultS3Endpoint
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+	return client, nil
+}
+
+// SetEncoder sets the encoder of newly saved images
+func (s *S3Storage) SetEncoder(encoder Encoder) {
+	s.encoder = encoder
+}
+
+// SetEncryptionKey sets the key images are encrypted with as they are saved
+// and decrypted with as they are loaded; images saved without one are still
+// loaded
+func (s *S3Storage) SetEncryptionKey(key *encryption.Key) {
+	s.encryptionKey = key
+}
+
+// SaveImage uploads an image
+func (s *S3Storage) SaveImage(userID, faceID string, img image.Image) (string, error) {
+	data, err := encode(s.encoder, userID, faceID, img)
+	if err != nil {
+		return "", err
+	}
+	filename := Filename(s.layout, userID, faceID)
+	if data, err = seal(s.encryptionKey, filename, data); err != nil {
+		return "", err
+	}
+
+	if err := s.putObject(filename, data); err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
+
+// LoadImage downloads an image
+func (s *S3Storage) LoadImage(filename string) (image.Image, error) {
+	data, err := s.LoadData(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(data)
+}
+
+// LoadData downloads the bytes of an image
+func (s *S3Storage) LoadData(filename string) ([]byte, error) {
+	data, err := s.getObject(filename)
+	if err != nil {
+		return nil, err
+	}
+	return open(s.encryptionKey, filename, data)
+}
+
+// DeleteImage removes an image; deleting a missing image is not an error
+func (s *S3Storage) DeleteImage(filename string) error {
+	err := s.client.RemoveObject(context.Background(), s.bucket, s.key(filename), minio.RemoveObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete image from S3: %w", err)
+	}
+	return nil
+}
+
+// Exists checks if an image is in the bucket
+func (s *S3Storage) Exists(filename string) bool {
+	_, err := s.client.StatObject(context.Background(), s.bucket, s.key(filename), minio.StatObjectOptions{})
+	return err == nil
+}
+
+// putObject uploads already encoded image data
+func (s *S3Storage) putObject(filename string, data []byte) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(filename),
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "image/jpeg"})
+	if err != nil {
+		return fmt.Errorf("failed to upload image to S3: %w", err)
+	}
+	return nil
+}
+
+// getObject downloads encoded image data
+func (s *S3Storage) getObject(filename string) ([]byte, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.key(filename), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image from S3: %w", err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, filename)
+		}
+		return nil, fmt.Errorf("failed to download image from S3: %w", err)
+	}
+
+	return data, nil
+}
+
+// key returns the object key of a stored filename
+func (s *S3Storage) key(filename string) string {
+	return path.Join(s.prefix, filename)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"face/internal/encryption"
+)
+
+// Storage stores the cropped face image of each enrolled face. Filenames
+// returned by SaveImage are what the database records and what LoadImage,
+// LoadData, DeleteImage and Exists expect.
+type Storage interface {
+	SaveImage(userID, faceID string, img image.Image) (string, error)
+	LoadImage(filename string) (image.Image, error)
+	// LoadData returns the stored bytes of an image, e.g. to check its
+	// provenance
+	LoadData(filename string) ([]byte, error)
+	DeleteImage(filename string) error
+	Exists(filename string) bool
+}
+
+// Backend selects the Storage implementation
+type Backend string
+
+const (
+	// BackendLocal stores images in the faces directory
+	BackendLocal Backend = "local"
+	// BackendTiered keeps recently used images in the faces directory as a
+	// size-limited cache and every image in S3-compatible object storage
+	BackendTiered Backend = "tiered"
+	// BackendS3 stores every image in S3-compatible object storage only, so
+	// images survive container restarts and are shared by every instance
+	BackendS3 Backend = "s3"
+	// BackendDatabase stores every image in the database, for single-file
+	// deployments with SQLite
+	BackendDatabase Backend = "database"
+)
+
+// ParseBackend converts a string to Backend
+func ParseBackend(s string) (Backend, error) {
+	switch Backend(s) {
+	case "", BackendLocal:
+		return BackendLocal, nil
+	case BackendTiered, BackendS3, BackendDatabase:
+		return Backend(s), nil
+	default:
+		return "", fmt.Errorf("unsupported storage backend: %s (use local, tiered, s3 or database)", s)
+	}
+}
+
+// JPEGQuality is the quality face images are stored with
+const JPEGQuality = 95
+
+// Encoder encodes the face images of a storage, e.g. to add provenance
+// metadata. Without one, images are stored as plain JPEG.
+type Encoder interface {
+	Encode(userID, faceID string, img image.Image) ([]byte, error)
+}
+
+// encode encodes a face image with the encoder of a backend, if any
+func encode(encoder Encoder, userID, faceID string, img image.Image) ([]byte, error) {
+	if encoder != nil {
+		return encoder.Encode(userID, faceID, img)
+	}
+	return encodeJPEG(img)
+}
+
+// encodeJPEG encodes a face image the way every backend stores it
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// seal encrypts encoded image data with key, if not nil, bound to the
+// filename it is stored under
+func seal(key *encryption.Key, filename string, data []byte) ([]byte, error) {
+	sealed, err := key.Seal(data, imageContext(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt image: %w", err)
+	}
+	return sealed, nil
+}
+
+// open decrypts the image data stored under filename if it is encrypted
+func open(key *encryption.Key, filename string, data []byte) ([]byte, error) {
+	plain, err := key.Open(data, imageContext(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt image: %w", err)
+	}
+	return plain, nil
+}
+
+// imageContext returns what the image stored under filename is bound to,
+// so an image does not decrypt when copied over another face's image
+func imageContext(filename string) []byte {
+	return []byte("image/" + filename)
+}
+
+// decodeImage decodes stored image data
+func decodeImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
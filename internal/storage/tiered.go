@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TieredStorage keeps every image in S3 (the cold tier) and the recently
+// used ones in a size-limited local directory (the hot tier). Images missing
+// locally are fetched from S3 on LoadImage and cached again.
+//
+// Recency is tracked through file modification times, so the least recently
+// used images are evicted first even across separate CLI invocations.
+type TieredStorage struct {
+	hot      *FileSystemStorage
+	cold     *S3Storage
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // filename -> element in order
+	order   *list.List               // most recently used at the front
+	size    int64
+}
+
+// cacheEntry is one image held in the hot tier
+type cacheEntry struct {
+	filename string
+	size     int64
+}
+
+// NewTieredStorage creates a tiered storage. The hot tier is trimmed to
+// maxBytes immediately, in case the limit was lowered.
+func NewTieredStorage(hot *FileSystemStorage, cold *S3Storage, maxBytes int64) (*TieredStorage, error) {
+	t := &TieredStorage{
+		hot:      hot,
+		cold:     cold,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+
+	if err := t.scan(); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.evict("")
+
+	return t, nil
+}
+
+// SaveImage uploads an image to S3 and keeps a copy in the hot tier
+func (t *TieredStorage) SaveImage(userID, faceID string, img image.Image) (string, error) {
+	data, err := encode(t.hot.encoder, userID, faceID, img)
+	if err != nil {
+		return "", err
+	}
+	filename := Filename(t.hot.layout, userID, faceID)
+	if data, err = seal(t.hot.encryptionKey, filename, data); err != nil {
+		return "", err
+	}
+
+	if err := t.cold.putObject(filename, data); err != nil {
+		return "", err
+	}
+
+	if err := t.hot.writeFile(filename, data); err != nil {
+		return "", err
+	}
+	t.cached(filename, int64(len(data)))
+
+	return filename, nil
+}
+
+// LoadImage loads an image from the hot tier, fetching it from S3 on a miss
+func (t *TieredStorage) LoadImage(filename string) (image.Image, error) {
+	if t.hot.Exists(filename) {
+		t.touch(filename)
+		return t.hot.LoadImage(filename)
+	}
+
+	data, err := t.fetch(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(data)
+}
+
+// LoadData reads the bytes of an image like LoadImage
+func (t *TieredStorage) LoadData(filename string) ([]byte, error) {
+	if t.hot.Exists(filename) {
+		t.touch(filename)
+		return t.hot.LoadData(filename)
+	}
+	return t.fetch(filename)
+}
+
+// fetch downloads an image missing from the hot tier, caches it as it is
+// stored and returns it decrypted
+func (t *TieredStorage) fetch(filename string) ([]byte, error) {
+	data, err := t.cold.getObject(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.hot.writeFile(filename, data); err != nil {
+		return nil, err
+	}
+	t.cached(filename, int64(len(data)))
+
+	return open(t.hot.encryptionKey, filename, data)
+}
+
+// DeleteImage removes an image from both tiers
+func (t *TieredStorage) DeleteImage(filename string) error {
+	if err := t.cold.DeleteImage(filename); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.remove(filename)
+	t.mu.Unlock()
+
+	return t.hot.DeleteImage(filename)
+}
+
+// Exists checks if an image exists in either tier
+func (t *TieredStorage) Exists(filename string) bool {
+	return t.hot.Exists(filename) || t.cold.Exists(filename)
+}
+
+// scan rebuilds the recency list from the hot tier directory
+func (t *TieredStorage) scan() error {
+	type cachedFile struct {
+		filename string
+		size     int64
+		modTime  time.Time
+	}
+
+	var files []cachedFile
+	err := filepath.WalkDir(t.hot.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(t.hot.baseDir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, cachedFile{filepath.ToSlash(rel), info.Size(), info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan image cache: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	for _, f := range files {
+		t.entries[f.filename] = t.order.PushBack(&cacheEntry{f.filename, f.size})
+		t.size += f.size
+	}
+
+	return nil
+}
+
+// cached records an image just written to the hot tier and evicts others
+// if the tier is now over its limit
+func (t *TieredStorage) cached(filename string, size int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remove(filename)
+	t.entries[filename] = t.order.PushFront(&cacheEntry{filename, size})
+	t.size += size
+	t.evict(filename)
+}
+
+// touch marks an image as recently used
+func (t *TieredStorage) touch(filename string) {
+	t.mu.Lock()
+	if elem, ok := t.entries[filename]; ok {
+		t.order.MoveToFront(elem)
+	}
+	t.mu.Unlock()
+
+	now := time.Now()
+	_ = os.Chtimes(t.hot.fullPath(filename), now, now)
+}
+
+// remove forgets an image; the caller must hold mu
+func (t *TieredStorage) remove(filename string) {
+	elem, ok := t.entries[filename]
+	if !ok {
+		return
+	}
+	if entry, ok := elem.Value.(*cacheEntry); ok {
+		t.size -= entry.size
+	}
+	t.order.Remove(elem)
+	delete(t.entries, filename)
+}
+
+// evict deletes least recently used images from the hot tier until it fits
+// its limit, never evicting keep; the caller must hold mu
+func (t *TieredStorage) evict(keep string) {
+	for t.size > t.maxBytes {
+		elem := t.order.Back()
+		if elem == nil {
+			return
+		}
+		entry, ok := elem.Value.(*cacheEntry)
+		if !ok || entry.filename == keep {
+			return
+		}
+
+		if err := t.offload(entry.filename); err != nil {
+			return
+		}
+		t.remove(entry.filename)
+	}
+}
+
+// offload drops the hot copy of an image, first uploading it if it only
+// exists locally (e.g. images saved before tiering was enabled)
+func (t *TieredStorage) offload(filename string) error {
+	if !t.cold.Exists(filename) {
+		data, err := os.ReadFile(t.hot.fullPath(filename))
+		if err != nil {
+			return fmt.Errorf("failed to read cached image: %w", err)
+		}
+		if err := t.cold.putObject(filename, data); err != nil {
+			return err
+		}
+	}
+
+	return t.hot.DeleteImage(filename)
+}
@@ -0,0 +1,226 @@
+// Package telemetry counts how often each command runs and how it fails,
+// and sends the counts to the maintainers' endpoint about once a day. It is
+// off unless the operator enables it: until then no state is kept and no
+// request is made. Counts are all that is sent; never names, images,
+// embeddings, paths, flags or error messages.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SendInterval is how often counts are sent
+const SendInterval = 24 * time.Hour
+
+// retryInterval is how long to wait after a report could not be sent
+const retryInterval = time.Hour
+
+// sendTimeout bounds how long sending may delay the end of a command
+const sendTimeout = 3 * time.Second
+
+// DoNotTrackEnv is the environment variable (https://consoledonottrack.com)
+// that disables telemetry whatever the state says
+const DoNotTrackEnv = "DO_NOT_TRACK"
+
+// Counts are the runs of a command
+type Counts struct {
+	Runs int `json:"runs"`
+	// Errors are the failed runs by error class, e.g. "face_not_detected"
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// State is what is kept on this machine between runs
+type State struct {
+	Enabled bool `json:"enabled"`
+	// InstallID is random and tells the reports of one installation
+	// apart; it is generated when telemetry is enabled
+	InstallID string `json:"install_id,omitempty"`
+	// Since is when the counts started
+	Since    time.Time `json:"since"`
+	LastSent time.Time `json:"last_sent"`
+	// LastAttempt is when sending last failed
+	LastAttempt time.Time          `json:"last_attempt"`
+	Commands    map[string]*Counts `json:"commands,omitempty"`
+}
+
+// Environment describes the installation in reports
+type Environment struct {
+	Version  string `json:"version"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Database string `json:"database"`
+	Storage  string `json:"storage"`
+}
+
+// Report is the body sent to the endpoint
+type Report struct {
+	InstallID   string             `json:"install_id"`
+	Environment Environment        `json:"environment"`
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	Commands    map[string]*Counts `json:"commands"`
+}
+
+// DoNotTrack reports whether DO_NOT_TRACK is set to a true value
+func DoNotTrack() bool {
+	v, err := strconv.ParseBool(os.Getenv(DoNotTrackEnv))
+	return err == nil && v
+}
+
+// ValidateEndpoint checks that an endpoint, if set, is an HTTP(S) URL
+func ValidateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("telemetry endpoint must be an http or https URL: %q", endpoint)
+	}
+	return nil
+}
+
+// Load returns the state saved at path, a disabled one if there is none
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read telemetry file: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse telemetry file: %w", err)
+	}
+	return &state, nil
+}
+
+// Save replaces the state at path
+func Save(path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write telemetry file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write telemetry file: %w", err)
+	}
+	return nil
+}
+
+// Enable turns counting on, with a new install ID if there is none
+func (s *State) Enable(now time.Time) {
+	s.Enabled = true
+	if s.InstallID == "" {
+		s.InstallID = uuid.New().String()
+	}
+	if s.Since.IsZero() {
+		s.Since = now
+	}
+}
+
+// Disable turns counting off and drops the counts not yet sent
+func (s *State) Disable() {
+	s.Enabled = false
+	s.Since = time.Time{}
+	s.Commands = nil
+}
+
+// Record counts a run of a command, failed with an error of errClass if
+// it is not empty
+func (s *State) Record(command, errClass string) {
+	if s.Commands == nil {
+		s.Commands = make(map[string]*Counts)
+	}
+	counts, ok := s.Commands[command]
+	if !ok {
+		counts = &Counts{}
+		s.Commands[command] = counts
+	}
+	counts.Runs++
+	if errClass != "" {
+		if counts.Errors == nil {
+			counts.Errors = make(map[string]int)
+		}
+		counts.Errors[errClass]++
+	}
+}
+
+// Due reports whether counts are waiting to be sent, were started
+// SendInterval ago and sending did not just fail
+func (s *State) Due(now time.Time) bool {
+	return s.Enabled && len(s.Commands) > 0 &&
+		now.Sub(s.Since) >= SendInterval && now.Sub(s.LastAttempt) >= retryInterval
+}
+
+// Report returns the counts as they would be sent now
+func (s *State) Report(env Environment, now time.Time) *Report {
+	commands := s.Commands
+	if commands == nil {
+		commands = map[string]*Counts{}
+	}
+	return &Report{
+		InstallID:   s.InstallID,
+		Environment: env,
+		From:        s.Since,
+		To:          now,
+		Commands:    commands,
+	}
+}
+
+// Sent starts new counts after a report was sent
+func (s *State) Sent(now time.Time) {
+	s.LastSent = now
+	s.LastAttempt = time.Time{}
+	s.Since = now
+	s.Commands = nil
+}
+
+// Failed keeps the counts after a report could not be sent, to be sent
+// again later
+func (s *State) Failed(now time.Time) {
+	s.LastAttempt = now
+}
+
+// Send posts a report to the endpoint as JSON
+func Send(ctx context.Context, endpoint string, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telemetry report: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid telemetry endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send telemetry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
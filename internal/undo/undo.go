@@ -0,0 +1,114 @@
+// Package undo remembers the most recent destructive operation run on this
+// machine, so it can be reversed within a short window. A record can hold a
+// user's details and the embedding of a removed face, so it is encrypted
+// like the database when an encryption key is configured.
+package undo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"face/internal/database/models"
+	"face/internal/encryption"
+)
+
+// Operations that can be undone
+const (
+	OpDelete     = "delete"
+	OpUpdate     = "update"
+	OpRemoveFace = "remove-face"
+)
+
+// sealContext is what an encrypted record is bound to, so no other
+// encrypted face data can be passed off as one
+const sealContext = "undo"
+
+// Record describes an operation and what is needed to reverse it
+type Record struct {
+	Op       string    `json:"op"`
+	Time     time.Time `json:"time"`
+	UserID   string    `json:"user_id"`
+	UserName string    `json:"user_name"`
+	// UserIDs are the users of a delete of several users at once, e.g. of
+	// 'face delete --all', UserID being the first; empty for one user
+	UserIDs []string `json:"user_ids,omitempty"`
+	// Before holds the user's own fields before an update, nil if they
+	// were not changed
+	Before *models.User `json:"before,omitempty"`
+	// RemovedFace is a face removed by the operation. Its image is kept
+	// until the record is discarded.
+	RemovedFace *models.Face `json:"removed_face,omitempty"`
+	// Seq is the latest change log entry after the operation, 0 if the
+	// database has no change log
+	Seq int64 `json:"seq,omitempty"`
+}
+
+// Expired reports whether the record is older than window
+func (r *Record) Expired(window time.Duration) bool {
+	return time.Since(r.Time) > window
+}
+
+// Users returns the IDs of the users of the operation
+func (r *Record) Users() []string {
+	if len(r.UserIDs) > 0 {
+		return r.UserIDs
+	}
+	return []string{r.UserID}
+}
+
+// Covers reports whether the operation was on the user
+func (r *Record) Covers(userID string) bool {
+	return slices.Contains(r.Users(), userID)
+}
+
+// Load returns the record saved at path, nil if there is none, decrypting
+// it with key if it was encrypted
+func Load(path string, key *encryption.Key) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo file: %w", err)
+	}
+	if data, err = key.Open(data, []byte(sealContext)); err != nil {
+		return nil, fmt.Errorf("failed to read undo file: %w", err)
+	}
+
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse undo file: %w", err)
+	}
+	return &record, nil
+}
+
+// Save replaces the record at path, encrypted with key unless it is nil
+func Save(path string, record *Record, key *encryption.Key) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo record: %w", err)
+	}
+	if data, err = key.Seal(data, []byte(sealContext)); err != nil {
+		return fmt.Errorf("failed to encrypt undo record: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write undo file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write undo file: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the record at path, if any
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove undo file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package wiegand encodes card numbers as Wiegand frames, the format door
+// controllers read from card readers, so a face match can open a door like
+// presenting the user's card would.
+package wiegand
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Format is a Wiegand frame layout
+type Format string
+
+// Supported formats
+const (
+	// Format26 is HID H10301: 8-bit facility code and 16-bit card number
+	Format26 Format = "26"
+	// Format37 is HID H10302: 35-bit card number without facility code
+	Format37 Format = "37"
+)
+
+// ParseFormat parses a format name, "" meaning Format26
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", Format26:
+		return Format26, nil
+	case Format37:
+		return Format37, nil
+	}
+	return "", fmt.Errorf("unknown Wiegand format %q (expected 26 or 37)", s)
+}
+
+// MaxFacilityCode is the largest facility code of Format26
+const MaxFacilityCode = 255
+
+// Encode returns the frame of a card number as a string of '0' and '1',
+// first bit first. The facility code is ignored by Format37.
+func Encode(format Format, facility int, cardNumber string) (string, error) {
+	card, err := strconv.ParseUint(cardNumber, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid card number %q", cardNumber)
+	}
+
+	var data string
+	switch format {
+	case Format26:
+		if facility < 0 || facility > MaxFacilityCode {
+			return "", fmt.Errorf("facility code %d is out of range 0-%d", facility, MaxFacilityCode)
+		}
+		if card > 0xFFFF {
+			return "", fmt.Errorf("card number %s does not fit the 26-bit format, use the 37-bit format", cardNumber)
+		}
+		data = fmt.Sprintf("%08b%016b", facility, card)
+	case Format37:
+		if card >= 1<<35 {
+			return "", fmt.Errorf("card number %s does not fit the 37-bit format", cardNumber)
+		}
+		data = fmt.Sprintf("%035b", card)
+	default:
+		return "", fmt.Errorf("unknown Wiegand format %q", format)
+	}
+
+	// The leading bit gives the first half of the data even parity, the
+	// trailing bit the second half odd parity. With 35 data bits, the
+	// halves share the middle bit.
+	half := (len(data) + 1) / 2
+	first, second := data[:half], data[len(data)-half:]
+	return parity(first, 0) + data + parity(second, 1), nil
+}
+
+// parity returns the bit that makes the number of ones in bits plus the
+// bit even (want 0) or odd (want 1)
+func parity(bits string, want int) string {
+	return strconv.Itoa((strings.Count(bits, "1") + want) % 2)
+}
+
+// Write sends a frame to path, a Wiegand output device or a file read by
+// one, as a line of '0' and '1'
+func Write(path, frame string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open Wiegand output: %w", err)
+	}
+	if _, err := f.WriteString(frame + "\n"); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write Wiegand frame: %w", err)
+	}
+	return f.Close()
+}
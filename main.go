@@ -1,13 +1,21 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"time"
 
 	"face/cmd"
 	"face/config"
 	"face/internal/database"
+	"face/internal/errreport"
+	"face/internal/logging"
+	"face/internal/modelfiles"
 
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +23,14 @@ var (
 	cfg     *config.Config
 	verbose bool
 	dbType  string
+
+	faultInject string
+	requestID   string
+
+	logCloser io.Closer
+	command   string
+	executed  *cobra.Command
+	started   time.Time
 )
 
 var rootCmd = &cobra.Command{
@@ -26,18 +42,37 @@ Enroll users with face images and identify people from photos.
 Supported database backends:
   - sqlite (default): Local file-based database
   - postgres: PostgreSQL server database
-  - json: Legacy JSON file database`,
+  - json: Legacy JSON file database
+  - bolt: Embedded key-value file database, no CGO needed`,
 	Version: "2.0.0",
+	PersistentPreRunE: func(c *cobra.Command, args []string) error {
+		return setupCommand(c)
+	},
 }
 
 func init() {
 	cfg = config.LoadConfig()
+	cfg.SetVersion(rootCmd.Version)
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
-	rootCmd.PersistentFlags().StringVar(&dbType, "db-type", string(cfg.DatabaseType), "database type (sqlite, postgres, json)")
+	rootCmd.PersistentFlags().StringVar(&dbType, "db-type", string(cfg.DatabaseType), "database type (sqlite, postgres, json, bolt)")
 	rootCmd.PersistentFlags().StringVar(&cfg.DatabasePath, "db", cfg.DatabasePath, "database path or connection string")
 	rootCmd.PersistentFlags().StringVar(&cfg.FacesDir, "faces-dir", cfg.FacesDir, "directory for face images")
+	rootCmd.PersistentFlags().StringVar(&cfg.StorageBackend, "storage", cfg.StorageBackend, "face image storage (local, tiered, s3, database)")
+	rootCmd.PersistentFlags().StringVar(&cfg.S3Bucket, "bucket", cfg.S3Bucket, "S3 bucket of the tiered and s3 storage")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Encrypt, "encrypt", cfg.Encrypt, "refuse to run unless stored images and embeddings are encrypted (needs FACE_CLI_ENCRYPTION_KEY)")
 	rootCmd.PersistentFlags().Float64Var(&cfg.DefaultThreshold, "threshold", cfg.DefaultThreshold, "matching threshold (0.0-1.0)")
+	rootCmd.PersistentFlags().StringVar(&cfg.EmbeddingModel, "model", cfg.EmbeddingModel, "ONNX embedding model: arcface, facenet, mobilefacenet or an embedding_models entry (built-in model if empty)")
+	rootCmd.PersistentFlags().StringVar(&cfg.MatchStrategy, "match-strategy", cfg.MatchStrategy, "how users' faces are scored: best, average or vote (stored setting if empty)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Device, "device", cfg.Device, "scope of this device, e.g. acme/berlin/lobby-door: identify only its users (everyone if empty)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.AutoMigrate, "auto-migrate", cfg.AutoMigrate, "apply pending database migrations before running the command")
+	rootCmd.PersistentFlags().Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of random choices, for reproducible runs (0 = random)")
+
+	rootCmd.PersistentFlags().StringVar(&requestID, "request-id", os.Getenv("FACE_CLI_REQUEST_ID"), "ID attached to log lines and error reports of this run, generated if empty")
+
+	// Development only, see faultinject.Parse for the spec format
+	rootCmd.PersistentFlags().StringVar(&faultInject, "fault-inject", "", "simulate failures, e.g. detector=0.2,db=0.1,storage=0.1,delay=2s")
+	_ = rootCmd.PersistentFlags().MarkHidden("fault-inject")
 
 	// Update config with flag values before each command runs
 	cobra.OnInitialize(func() {
@@ -46,16 +81,161 @@ func init() {
 
 	rootCmd.AddCommand(cmd.NewEnrollCmd(cfg))
 	rootCmd.AddCommand(cmd.NewIdentifyCmd(cfg))
+	rootCmd.AddCommand(cmd.NewIdentifyBatchCmd(cfg))
+	rootCmd.AddCommand(cmd.NewMatchCmd(cfg))
 	rootCmd.AddCommand(cmd.NewVerifyCmd(cfg))
+	rootCmd.AddCommand(cmd.NewVerifyDualCmd(cfg))
+	rootCmd.AddCommand(cmd.NewVerifyBatchCmd(cfg))
+	rootCmd.AddCommand(cmd.NewCalibrateCmd(cfg))
+	rootCmd.AddCommand(cmd.NewEvalCmd(cfg))
+	rootCmd.AddCommand(cmd.NewFactorCmd(cfg))
+	rootCmd.AddCommand(cmd.NewRedactCmd(cfg))
 	rootCmd.AddCommand(cmd.NewListCmd(cfg))
+	rootCmd.AddCommand(cmd.NewShowCmd(cfg))
 	rootCmd.AddCommand(cmd.NewDeleteCmd(cfg))
+	rootCmd.AddCommand(cmd.NewPurgeCmd(cfg))
 	rootCmd.AddCommand(cmd.NewUpdateCmd(cfg))
+	rootCmd.AddCommand(cmd.NewUndoCmd(cfg))
+	rootCmd.AddCommand(cmd.NewPruneCmd(cfg))
+	rootCmd.AddCommand(cmd.NewScopeCmd(cfg))
 	rootCmd.AddCommand(cmd.NewMigrateCmd(cfg))
+	rootCmd.AddCommand(cmd.NewInitCmd(cfg))
+	rootCmd.AddCommand(cmd.NewSelftestCmd(cfg))
+	rootCmd.AddCommand(cmd.NewModelCmd(cfg))
+	rootCmd.AddCommand(cmd.NewReembedCmd(cfg))
+	rootCmd.AddCommand(cmd.NewDemoCmd(cfg))
+	rootCmd.AddCommand(cmd.NewDoctorCmd(cfg))
+	rootCmd.AddCommand(cmd.NewDiagCmd(cfg))
+	rootCmd.AddCommand(cmd.NewVersionCmd(cfg))
+	rootCmd.AddCommand(cmd.NewHistoryCmd(cfg))
+	rootCmd.AddCommand(cmd.NewAuditCmd(cfg))
+	rootCmd.AddCommand(cmd.NewReportCmd(cfg))
+	rootCmd.AddCommand(cmd.NewTelemetryCmd(cfg))
+	rootCmd.AddCommand(cmd.NewStorageCmd(cfg))
+	rootCmd.AddCommand(cmd.NewSettingsCmd(cfg))
+	rootCmd.AddCommand(cmd.NewTestSuiteCmd(cfg))
+	rootCmd.AddCommand(cmd.NewEmbeddingCmd(cfg))
+	rootCmd.AddCommand(cmd.NewOutliersCmd(cfg))
+	rootCmd.AddCommand(cmd.NewStatsCmd(cfg))
+	rootCmd.AddCommand(cmd.NewQueryCmd(cfg))
+	rootCmd.AddCommand(cmd.NewCDCCmd(cfg))
+	rootCmd.AddCommand(cmd.NewGalleryCmd(cfg))
+	rootCmd.AddCommand(cmd.NewExportCmd(cfg))
+	rootCmd.AddCommand(cmd.NewImportCmd(cfg))
+	rootCmd.AddCommand(cmd.NewBackupCmd(cfg))
+	rootCmd.AddCommand(cmd.NewNotifyCmd(cfg))
+	rootCmd.AddCommand(cmd.NewMQTTCmd(cfg))
+	rootCmd.AddCommand(cmd.NewServeCmd(cfg))
+	rootCmd.AddCommand(cmd.NewDeepStackCmd(cfg))
+	rootCmd.AddCommand(cmd.NewCamerasCmd(cfg))
+	rootCmd.AddCommand(cmd.NewWatchCmd(cfg))
+}
+
+// setupCommand installs the configured log sink as the default logger and
+// enables error reporting context and fault injection for the command
+func setupCommand(c *cobra.Command) error {
+	if err := cfg.FileError(); err != nil {
+		// init writes a new config file, so it runs to replace a broken one
+		if c.Name() != "init" {
+			return fmt.Errorf("%w; fix or remove the config file, or run 'face init' to write a new one", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	if requestID == "" {
+		requestID = uuid.New().String()
+	} else if !logging.RequestIDPattern.MatchString(requestID) {
+		return fmt.Errorf("invalid request ID %q (use up to 128 letters, digits, '.', '_', ':' or '-')", requestID)
+	}
+
+	logCfg := cfg.Logging()
+	if verbose && logCfg.Level == "" {
+		logCfg.Level = "debug"
+	}
+
+	logger, closer, err := logging.New(logCfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize logging: %w", err)
+	}
+
+	slog.SetDefault(logger.With("request_id", requestID))
+	cfg.SetRequestID(requestID)
+	logCloser = closer
+	command = c.CommandPath()
+	executed = c
+	started = time.Now()
+
+	errreport.SetContext(errreport.Context{
+		Command: command,
+		Tags:    map[string]string{"request_id": requestID},
+	})
+
+	if faultInject != "" {
+		if err := cfg.EnableFaultInjection(faultInject); err != nil {
+			return err
+		}
+		slog.Warn("fault injection enabled", "spec", faultInject)
+		fmt.Fprintf(os.Stderr, "⚠ Fault injection enabled: %s\n", faultInject)
+	}
+
+	if cfg.EncryptionMigrating && cfg.EncryptionKey != "" {
+		slog.Warn("reading unencrypted face data", "setting", "encryption_migrating")
+		fmt.Fprintln(os.Stderr, "⚠ Warning: encryption_migrating is set, so face data that is not encrypted is read as it is; unset it once the data is encrypted")
+	}
+
+	slog.Debug("command started", "command", command)
+	return nil
+}
+
+// requestIDRecorded reports whether the request ID ends up in a log or an
+// error report, and so is worth showing to the user
+func requestIDRecorded() bool {
+	target, _ := logging.ParseTarget(cfg.LogTarget)
+	return target != logging.TargetNone || cfg.SentryDSN != ""
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	if err := errreport.Init(cfg.ErrorReporting("face@" + rootCmd.Version)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	defer errreport.Recover()
+
+	err := rootCmd.Execute()
+	if command != "" {
+		if err != nil {
+			slog.Error("command failed", "command", command, "error", err, "duration_ms", time.Since(started).Milliseconds())
+		} else {
+			slog.Info("command finished", "command", command, "duration_ms", time.Since(started).Milliseconds())
+		}
+	}
+	if err := cmd.RecordHistory(cfg, executed, requestID, started, err); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if err := cmd.RecordTelemetry(cfg, executed, err); err != nil {
+		slog.Debug("usage statistics not recorded", "error", err)
+	}
+	if logCloser != nil {
+		logCloser.Close()
+	}
+
+	if err != nil {
+		errreport.CaptureError(err)
+		errreport.Flush()
+
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if command != "" && requestIDRecorded() {
+			fmt.Fprintf(os.Stderr, "Request ID: %s\n", requestID)
+		}
+
+		var missingErr *modelfiles.MissingError
+		if errors.As(err, &missingErr) {
+			fmt.Fprintf(os.Stderr, "\n%s", missingErr.Remediation())
+		}
+		var schemaErr *database.SchemaError
+		if errors.As(err, &schemaErr) {
+			fmt.Fprintf(os.Stderr, "\n%s", schemaErr.Remediation())
+		}
+
 		os.Exit(1)
 	}
 }
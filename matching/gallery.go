@@ -0,0 +1,134 @@
+package matching
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"face/internal/gallery"
+)
+
+var (
+	// ErrUnknownUser is returned when verifying against a user who is not
+	// in the gallery
+	ErrUnknownUser = errors.New("user not in the gallery")
+	// ErrDeltaBundle is returned when reading a delta bundle as a snapshot
+	ErrDeltaBundle = errors.New("gallery bundle is a delta, expected a snapshot")
+)
+
+// Gallery is a set of candidates to identify and verify probes against
+type Gallery struct {
+	// Revision is the revision of the snapshot the gallery was read from
+	Revision int64
+	// Strategy is how candidates are scored, StrategyBest if empty
+	Strategy Strategy
+
+	candidates []Candidate
+	index      map[string]int
+	dim        int
+}
+
+// NewGallery returns a gallery of candidates, which must have distinct IDs
+// and embeddings of one dimension
+func NewGallery(candidates []Candidate) (*Gallery, error) {
+	g := &Gallery{candidates: candidates, index: make(map[string]int, len(candidates))}
+	for i, c := range candidates {
+		if _, ok := g.index[c.ID]; ok {
+			return nil, fmt.Errorf("candidate %q is in the gallery twice", c.ID)
+		}
+		g.index[c.ID] = i
+
+		for _, e := range c.Embeddings {
+			if g.dim == 0 {
+				g.dim = len(e)
+			}
+			if len(e) != g.dim {
+				return nil, fmt.Errorf("candidate %q has a %d-d embedding, expected %d-d", c.ID, len(e), g.dim)
+			}
+		}
+	}
+	return g, nil
+}
+
+// ReadSnapshot reads a gallery snapshot bundle. Users without faces are
+// left out.
+func ReadSnapshot(r io.Reader) (*Gallery, error) {
+	bundle, err := gallery.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Delta {
+		return nil, ErrDeltaBundle
+	}
+
+	var candidates []Candidate
+	for _, entry := range bundle.Entries {
+		c := Candidate{ID: entry.UserID, Name: entry.Name}
+		for _, f := range entry.Faces {
+			c.Embeddings = append(c.Embeddings, f.Embedding)
+		}
+		if len(c.Embeddings) > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+
+	g, err := NewGallery(candidates)
+	if err != nil {
+		return nil, err
+	}
+	g.Revision = bundle.Revision
+	return g, nil
+}
+
+// Len returns the number of candidates
+func (g *Gallery) Len() int {
+	return len(g.candidates)
+}
+
+// Dimension returns the dimension of the embeddings, 0 if there are none
+func (g *Gallery) Dimension() int {
+	return g.dim
+}
+
+// checkProbe checks that a probe has the dimension of the gallery
+func (g *Gallery) checkProbe(probe []float32) error {
+	if g.dim != 0 && len(probe) != g.dim {
+		return fmt.Errorf("probe embedding is %d-d, the gallery's are %d-d", len(probe), g.dim)
+	}
+	return nil
+}
+
+// Rank scores every candidate against the probe, most similar first. n > 0
+// keeps the n best.
+func (g *Gallery) Rank(probe []float32, n int) ([]Score, error) {
+	if err := g.checkProbe(probe); err != nil {
+		return nil, err
+	}
+	return g.Strategy.Rank(probe, g.candidates, n), nil
+}
+
+// Identify returns the candidate most similar to the probe and whether it
+// reaches the threshold (1:N). An empty gallery matches nobody.
+func (g *Gallery) Identify(probe []float32, threshold float64) (Score, bool, error) {
+	ranked, err := g.Rank(probe, 1)
+	if err != nil || len(ranked) == 0 {
+		return Score{}, false, err
+	}
+	return ranked[0], Matches(ranked[0].Confidence, threshold), nil
+}
+
+// Verify returns the similarity of the probe to a user and whether it
+// reaches the threshold (1:1)
+func (g *Gallery) Verify(userID string, probe []float32, threshold float64) (Score, bool, error) {
+	i, ok := g.index[userID]
+	if !ok {
+		return Score{}, false, ErrUnknownUser
+	}
+	if err := g.checkProbe(probe); err != nil {
+		return Score{}, false, err
+	}
+
+	c := g.candidates[i]
+	score := Score{ID: c.ID, Name: c.Name, Confidence: g.Strategy.Score(probe, c.Embeddings)}
+	return score, Matches(score.Confidence, threshold), nil
+}
@@ -0,0 +1,106 @@
+// Package matching scores face embeddings against enrolled users. It is
+// the scoring code of the CLI and the servers, and needs nothing but the
+// standard library, so client apps can build it for WebAssembly (see
+// matching/wasm) or bind it with gomobile (see matching/mobile) and verify
+// faces on the device against a gallery snapshot from 'face gallery
+// snapshot', with the same results as the server.
+//
+// Embeddings must come from the model the gallery was enrolled with.
+package matching
+
+import (
+	"math"
+	"time"
+)
+
+// Norm returns the Euclidean length of an embedding
+func Norm(e []float32) float64 {
+	var sum float64
+	for _, v := range e {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum)
+}
+
+// CosineSimilarity returns the cosine of the angle between two embeddings,
+// or 0 if their dimensions differ or either has zero length
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+
+	norms := Norm(a) * Norm(b)
+	if norms == 0 {
+		return 0
+	}
+	return dot / norms
+}
+
+// Best returns the similarity of the embedding closest to the probe, -1 if
+// there are none. A user is as similar to a probe as their closest face.
+func Best(probe []float32, embeddings [][]float32) float64 {
+	best := -1.0
+	for _, e := range embeddings {
+		best = math.Max(best, CosineSimilarity(probe, e))
+	}
+	return best
+}
+
+// Matches reports whether a similarity reaches the threshold
+func Matches(confidence, threshold float64) bool {
+	return confidence >= threshold
+}
+
+// Decay discounts the similarity of faces enrolled long ago, as people's
+// appearance drifts from their enrollment photos. A face loses up to Max of
+// its similarity, half of that once it is HalfLife old, three quarters at
+// twice HalfLife, and so on. The zero Decay discounts nothing.
+type Decay struct {
+	HalfLife time.Duration
+	Max      float64
+}
+
+// Enabled reports whether the decay discounts anything
+func (d Decay) Enabled() bool {
+	return d.HalfLife > 0 && d.Max > 0
+}
+
+// Apply returns the similarity of a face of the given age, discounted.
+// Negative similarities are returned as they are, as discounting them
+// would make the face more similar.
+func (d Decay) Apply(similarity float64, age time.Duration) float64 {
+	if !d.Enabled() || age <= 0 || similarity <= 0 {
+		return similarity
+	}
+	decayed := 1 - math.Exp2(-age.Hours()/d.HalfLife.Hours())
+	return similarity * (1 - d.Max*decayed)
+}
+
+// Candidate is an enrolled user with the embeddings of their faces
+type Candidate struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name,omitempty"`
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Score is the similarity of a candidate to a probe
+type Score struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name,omitempty"`
+	Confidence float64 `json:"confidence"`
+	// Votes is how many of the faces closest to the probe are the
+	// candidate's, under StrategyVote
+	Votes int `json:"votes,omitempty"`
+}
+
+// Rank scores the candidates against the probe by their closest face, most
+// similar first and candidates equally similar in their order. n > 0 keeps
+// the n best. See Strategy.Rank for the other strategies.
+func Rank(probe []float32, candidates []Candidate, n int) []Score {
+	return StrategyBest.Rank(probe, candidates, n)
+}
@@ -0,0 +1,118 @@
+// Package mobile binds the matching package for Android and iOS apps:
+//
+//	gomobile bind -target android -javapkg com.example.face ./matching/mobile
+//	gomobile bind -target ios ./matching/mobile
+//
+// gomobile cannot pass float slices, so embeddings are passed as bytes: the
+// float32 values in little-endian order, as in gallery bundles.
+package mobile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"face/matching"
+)
+
+// Gallery is a gallery snapshot to identify and verify probes against
+type Gallery struct {
+	g *matching.Gallery
+}
+
+// Match is the result of identifying or verifying a probe
+type Match struct {
+	UserID     string
+	Name       string
+	Confidence float64
+	Matched    bool
+}
+
+// LoadGallery reads a snapshot bundle from 'face gallery snapshot' or the
+// server's /gallery/snapshot, uncompressed
+func LoadGallery(snapshot []byte) (*Gallery, error) {
+	g, err := matching.ReadSnapshot(bytes.NewReader(snapshot))
+	if err != nil {
+		return nil, err
+	}
+	return &Gallery{g: g}, nil
+}
+
+// Size returns the number of users in the gallery
+func (g *Gallery) Size() int {
+	return g.g.Len()
+}
+
+// Revision returns the revision of the snapshot
+func (g *Gallery) Revision() int64 {
+	return g.g.Revision
+}
+
+// Dimension returns the dimension of the gallery's embeddings
+func (g *Gallery) Dimension() int {
+	return g.g.Dimension()
+}
+
+// SetStrategy sets how users are scored, best (the default), average or
+// vote; use the server's match strategy for the same results
+func (g *Gallery) SetStrategy(strategy string) error {
+	parsed, err := matching.ParseStrategy(strategy)
+	if err != nil {
+		return err
+	}
+	g.g.Strategy = parsed
+	return nil
+}
+
+// Identify returns the user most similar to the probe (1:N); Matched tells
+// whether they reach the threshold
+func (g *Gallery) Identify(probe []byte, threshold float64) (*Match, error) {
+	embedding, err := decodeEmbedding(probe)
+	if err != nil {
+		return nil, err
+	}
+	score, matched, err := g.g.Identify(embedding, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Match{UserID: score.ID, Name: score.Name, Confidence: score.Confidence, Matched: matched}, nil
+}
+
+// Verify checks the probe against one user (1:1)
+func (g *Gallery) Verify(userID string, probe []byte, threshold float64) (*Match, error) {
+	embedding, err := decodeEmbedding(probe)
+	if err != nil {
+		return nil, err
+	}
+	score, matched, err := g.g.Verify(userID, embedding, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return &Match{UserID: score.ID, Name: score.Name, Confidence: score.Confidence, Matched: matched}, nil
+}
+
+// Similarity returns the cosine similarity of two embeddings
+func Similarity(a, b []byte) (float64, error) {
+	ea, err := decodeEmbedding(a)
+	if err != nil {
+		return 0, err
+	}
+	eb, err := decodeEmbedding(b)
+	if err != nil {
+		return 0, err
+	}
+	return matching.CosineSimilarity(ea, eb), nil
+}
+
+// decodeEmbedding decodes little-endian float32 values
+func decodeEmbedding(data []byte) ([]float32, error) {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil, fmt.Errorf("embedding of %d bytes is not a list of float32 values", len(data))
+	}
+	e := make([]float32, len(data)/4)
+	for i := range e {
+		e[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return e, nil
+}
@@ -0,0 +1,158 @@
+package matching
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Strategy is how the faces of a candidate are combined into their
+// similarity to a probe. Which is most accurate depends on the model and
+// the gallery: best suits few faces per user, average suits users with
+// many faces of varying quality, and vote suits large galleries where a
+// single lookalike face should not outrank a user whose faces agree.
+type Strategy string
+
+const (
+	// StrategyBest scores a candidate by their face closest to the probe
+	StrategyBest Strategy = "best"
+	// StrategyAverage scores a candidate by the mean of their embeddings,
+	// a template that evens out faces of poor quality
+	StrategyAverage Strategy = "average"
+	// StrategyVote ranks candidates by how many of the VoteK faces closest
+	// to the probe, across the gallery, are theirs, scoring them by the
+	// mean similarity of those faces
+	StrategyVote Strategy = "vote"
+)
+
+// VoteK is how many of the faces closest to a probe vote under
+// StrategyVote
+const VoteK = 5
+
+// ParseStrategy parses a matching strategy; empty means StrategyBest
+func ParseStrategy(s string) (Strategy, error) {
+	switch strategy := Strategy(s); strategy {
+	case "":
+		return StrategyBest, nil
+	case StrategyBest, StrategyAverage, StrategyVote:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown match strategy %q (use best, average or vote)", s)
+	}
+}
+
+// Average returns the similarity of the probe to the mean of the
+// embeddings, each scaled to unit length first, -1 if there are none
+func Average(probe []float32, embeddings [][]float32) float64 {
+	if len(embeddings) == 0 {
+		return -1
+	}
+	template := make([]float32, len(probe))
+	for _, e := range embeddings {
+		norm := Norm(e)
+		if len(e) != len(template) || norm == 0 {
+			continue
+		}
+		for i, v := range e {
+			template[i] += float32(float64(v) / norm)
+		}
+	}
+	return CosineSimilarity(probe, template)
+}
+
+// Score returns the similarity of the probe to one candidate's embeddings.
+// There is nobody to vote against in a 1:1 comparison, so StrategyVote
+// scores like StrategyBest.
+func (s Strategy) Score(probe []float32, embeddings [][]float32) float64 {
+	if s == StrategyAverage {
+		return Average(probe, embeddings)
+	}
+	return Best(probe, embeddings)
+}
+
+// Vote is the result of a candidate under StrategyVote
+type Vote struct {
+	// Votes is how many of the k faces closest to the probe are theirs
+	Votes int
+	// Confidence is the mean similarity of those faces, or of their
+	// closest face if they have no votes
+	Confidence float64
+	// Face is the index of their closest face, -1 if they have none
+	Face int
+}
+
+// Votes counts the votes of the k faces most similar to a probe, given the
+// similarity of every face of every candidate, so callers can discount
+// faces before they vote. Equally similar faces vote in candidate order.
+func Votes(similarities [][]float64, k int) []Vote {
+	type face struct {
+		candidate  int
+		similarity float64
+	}
+	var faces []face
+	votes := make([]Vote, len(similarities))
+	for i, candidate := range similarities {
+		votes[i] = Vote{Confidence: -1, Face: -1}
+		for j, similarity := range candidate {
+			faces = append(faces, face{candidate: i, similarity: similarity})
+			if similarity > votes[i].Confidence {
+				votes[i].Confidence, votes[i].Face = similarity, j
+			}
+		}
+	}
+
+	sort.SliceStable(faces, func(a, b int) bool { return faces[a].similarity > faces[b].similarity })
+	sums := make([]float64, len(similarities))
+	for _, f := range faces[:min(k, len(faces))] {
+		votes[f.candidate].Votes++
+		sums[f.candidate] += f.similarity
+	}
+	for i := range votes {
+		if votes[i].Votes > 0 {
+			votes[i].Confidence = sums[i] / float64(votes[i].Votes)
+		}
+	}
+	return votes
+}
+
+// Rank scores the candidates against the probe with the strategy, most
+// similar first and candidates equally similar in their order. Under
+// StrategyVote candidates with more votes come first. n > 0 keeps the n
+// best.
+func (s Strategy) Rank(probe []float32, candidates []Candidate, n int) []Score {
+	var ranked []Score
+	if s == StrategyVote {
+		ranked = voteScores(probe, candidates)
+	} else {
+		ranked = make([]Score, len(candidates))
+		for i, c := range candidates {
+			ranked[i] = Score{ID: c.ID, Name: c.Name, Confidence: s.Score(probe, c.Embeddings)}
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Votes != ranked[j].Votes {
+			return ranked[i].Votes > ranked[j].Votes
+		}
+		return ranked[i].Confidence > ranked[j].Confidence
+	})
+	if n > 0 && len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// voteScores scores the candidates against the probe under StrategyVote,
+// in their order
+func voteScores(probe []float32, candidates []Candidate) []Score {
+	similarities := make([][]float64, len(candidates))
+	for i, c := range candidates {
+		for _, e := range c.Embeddings {
+			similarities[i] = append(similarities[i], CosineSimilarity(probe, e))
+		}
+	}
+	scores := make([]Score, len(candidates))
+	for i, v := range Votes(similarities, VoteK) {
+		scores[i] = Score{ID: candidates[i].ID, Name: candidates[i].Name, Confidence: v.Confidence, Votes: v.Votes}
+	}
+	return scores
+}
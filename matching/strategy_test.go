@@ -0,0 +1,114 @@
+package matching
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// testGallery has a lookalike: alice has one face very close to the probe
+// [1 0] and one unlike it, bob has three faces fairly close, and carol one
+// further away
+var testGallery = []Candidate{
+	{ID: "alice", Embeddings: [][]float32{{1, 0.1}, {0, 1}}},
+	{ID: "bob", Embeddings: [][]float32{{1, 0.3}, {1, 0.3}, {1, 0.3}}},
+	{ID: "carol", Embeddings: [][]float32{{1, 1}}},
+}
+
+// TestParseStrategy checks the strategy names and that empty means best
+func TestParseStrategy(t *testing.T) {
+	for s, want := range map[string]Strategy{"": StrategyBest, "best": StrategyBest, "average": StrategyAverage, "vote": StrategyVote} {
+		if got, err := ParseStrategy(s); err != nil || got != want {
+			t.Errorf("ParseStrategy(%q): got %q, %v; want %q", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"Best", "mean", " vote"} {
+		if _, err := ParseStrategy(s); err == nil {
+			t.Errorf("ParseStrategy(%q): no error", s)
+		}
+	}
+}
+
+// TestStrategyRank checks the order each strategy ranks the gallery in:
+// best trusts the lookalike face, average and vote the user whose faces
+// agree
+func TestStrategyRank(t *testing.T) {
+	probe := []float32{1, 0}
+	tests := []struct {
+		strategy Strategy
+		want     []string
+	}{
+		{StrategyBest, []string{"alice", "bob", "carol"}},
+		{StrategyAverage, []string{"bob", "carol", "alice"}},
+		{StrategyVote, []string{"bob", "alice", "carol"}},
+	}
+	for _, tt := range tests {
+		ranked := tt.strategy.Rank(probe, testGallery, 0)
+		if got := testScoreIDs(ranked); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: ranked %v, want %v", tt.strategy, got, tt.want)
+		}
+	}
+
+	if got := testScoreIDs(StrategyVote.Rank(probe, testGallery, 1)); !slices.Equal(got, []string{"bob"}) {
+		t.Errorf("vote with n = 1: ranked %v, want [bob]", got)
+	}
+}
+
+// TestScore checks the similarity of single candidates, and that a vote
+// compares like best when there is nobody to vote against
+func TestScore(t *testing.T) {
+	probe := []float32{1, 0}
+	alice := testGallery[0].Embeddings
+	if got, want := StrategyBest.Score(probe, alice), CosineSimilarity(probe, alice[0]); got != want {
+		t.Errorf("best: got %f, want %f", got, want)
+	}
+	if got, want := StrategyVote.Score(probe, alice), StrategyBest.Score(probe, alice); got != want {
+		t.Errorf("vote: got %f, want %f as best", got, want)
+	}
+	// The unit lengths of [1 0.1] and [0 1] add up to about [0.995 1.0995]
+	if got := StrategyAverage.Score(probe, alice); math.Abs(got-0.671) > 0.001 {
+		t.Errorf("average: got %f, want about 0.671", got)
+	}
+	for _, s := range []Strategy{StrategyBest, StrategyAverage} {
+		if got := s.Score(probe, nil); got != -1 {
+			t.Errorf("%s of no embeddings: got %f, want -1", s, got)
+		}
+	}
+}
+
+// TestVotes checks the votes and confidence of candidates, including those
+// with no votes or no faces, and that ties vote in candidate order
+func TestVotes(t *testing.T) {
+	votes := Votes([][]float64{
+		{0.9, 0.5},
+		{0.7, 0.9},
+		{0.3},
+		nil,
+	}, 3)
+	want := []Vote{
+		{Votes: 1, Confidence: 0.9, Face: 0},
+		{Votes: 2, Confidence: 0.8, Face: 1},
+		{Votes: 0, Confidence: 0.3, Face: 0},
+		{Votes: 0, Confidence: -1, Face: -1},
+	}
+	for i := range want {
+		if votes[i].Votes != want[i].Votes || votes[i].Face != want[i].Face || math.Abs(votes[i].Confidence-want[i].Confidence) > 1e-9 {
+			t.Errorf("candidate %d: got %+v, want %+v", i, votes[i], want[i])
+		}
+	}
+
+	if got := Votes([][]float64{{0.5}, {0.5}}, 1); got[0].Votes != 1 || got[1].Votes != 0 {
+		t.Errorf("tie: got %+v, want the first candidate to have the vote", got)
+	}
+	if got := Votes([][]float64{{0.5}}, VoteK); got[0].Votes != 1 {
+		t.Errorf("fewer faces than k: got %+v, want one vote", got)
+	}
+}
+
+func testScoreIDs(scores []Score) []string {
+	ids := make([]string, len(scores))
+	for i, s := range scores {
+		ids[i] = s.ID
+	}
+	return ids
+}
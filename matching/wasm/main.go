@@ -0,0 +1,113 @@
+//go:build js && wasm
+
+// Command wasm exposes the matching package to JavaScript, for web apps
+// verifying faces in the browser against a gallery snapshot:
+//
+//	GOOS=js GOARCH=wasm go build -o face-matching.wasm ./matching/wasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+//
+// Once the module runs, the global faceMatching has
+//
+//	loadGallery(bytes)        a gallery from a Uint8Array snapshot bundle
+//	similarity(a, b)          the cosine similarity of two embeddings
+//
+// and a gallery has size, revision and dimension, and
+//
+//	identify(embedding, threshold)          {id, name, confidence, matched}
+//	verify(userId, embedding, threshold)    {id, name, confidence, matched}
+//	setStrategy(name)                       best, average or vote, see matching.Strategy
+//
+// Embeddings are Float32Arrays or arrays of numbers. Failures return
+// {error: "..."} rather than throwing.
+package main
+
+import (
+	"bytes"
+	"syscall/js"
+
+	"face/matching"
+)
+
+func main() {
+	js.Global().Set("faceMatching", js.ValueOf(map[string]any{
+		"loadGallery": js.FuncOf(loadGallery),
+		"similarity":  js.FuncOf(similarity),
+	}))
+	select {}
+}
+
+// loadGallery reads a snapshot bundle into a gallery object
+func loadGallery(_ js.Value, args []js.Value) any {
+	if len(args) != 1 {
+		return failure("loadGallery(bytes) takes a Uint8Array")
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	g, err := matching.ReadSnapshot(bytes.NewReader(data))
+	if err != nil {
+		return failure(err.Error())
+	}
+	return map[string]any{
+		"size":      g.Len(),
+		"revision":  g.Revision,
+		"dimension": g.Dimension(),
+		"identify": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if len(args) != 2 {
+				return failure("identify(embedding, threshold) takes two arguments")
+			}
+			score, matched, err := g.Identify(embedding(args[0]), args[1].Float())
+			return result(score, matched, err)
+		}),
+		"verify": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if len(args) != 3 {
+				return failure("verify(userId, embedding, threshold) takes three arguments")
+			}
+			score, matched, err := g.Verify(args[0].String(), embedding(args[1]), args[2].Float())
+			return result(score, matched, err)
+		}),
+		"setStrategy": js.FuncOf(func(_ js.Value, args []js.Value) any {
+			if len(args) != 1 {
+				return failure("setStrategy(name) takes one argument")
+			}
+			strategy, err := matching.ParseStrategy(args[0].String())
+			if err != nil {
+				return failure(err.Error())
+			}
+			g.Strategy = strategy
+			return nil
+		}),
+	}
+}
+
+func similarity(_ js.Value, args []js.Value) any {
+	if len(args) != 2 {
+		return failure("similarity(a, b) takes two embeddings")
+	}
+	return matching.CosineSimilarity(embedding(args[0]), embedding(args[1]))
+}
+
+// embedding converts a Float32Array or an array of numbers
+func embedding(v js.Value) []float32 {
+	e := make([]float32, v.Get("length").Int())
+	for i := range e {
+		e[i] = float32(v.Index(i).Float())
+	}
+	return e
+}
+
+func result(score matching.Score, matched bool, err error) any {
+	if err != nil {
+		return failure(err.Error())
+	}
+	return map[string]any{
+		"id":         score.ID,
+		"name":       score.Name,
+		"confidence": score.Confidence,
+		"matched":    matched,
+	}
+}
+
+func failure(message string) any {
+	return map[string]any{"error": message}
+}